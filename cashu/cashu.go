@@ -3,6 +3,7 @@
 package cashu
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
@@ -10,6 +11,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/bits"
 
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/fxamacker/cbor/v2"
@@ -19,23 +21,57 @@ type Unit int
 
 const (
 	Sat Unit = iota
+	// Msat is experimental. Amounts of msat keysets are in millisatoshis.
+	Msat
+	// amounts of fiat units are in cents
+	Usd
+	Eur
 
 	BOLT11_METHOD = "bolt11"
+	BOLT12_METHOD = "bolt12"
 )
 
 func (unit Unit) String() string {
 	switch unit {
 	case Sat:
 		return "sat"
+	case Msat:
+		return "msat"
+	case Usd:
+		return "usd"
+	case Eur:
+		return "eur"
 	default:
 		return "unknown"
 	}
 }
 
+// IsFiat returns whether the amounts of the unit are not in bitcoin
+func (unit Unit) IsFiat() bool {
+	return unit == Usd || unit == Eur
+}
+
+func UnitFromString(unit string) (Unit, error) {
+	switch unit {
+	case "sat":
+		return Sat, nil
+	case "msat":
+		return Msat, nil
+	case "usd":
+		return Usd, nil
+	case "eur":
+		return Eur, nil
+	default:
+		return 0, ErrInvalidUnit
+	}
+}
+
 var (
-	ErrInvalidTokenV3 = errors.New("invalid V3 token")
-	ErrInvalidTokenV4 = errors.New("invalid V4 token")
-	ErrInvalidUnit    = errors.New("invalid unit")
+	ErrInvalidTokenV3  = errors.New("invalid V3 token")
+	ErrInvalidTokenV4  = errors.New("invalid V4 token")
+	ErrInvalidUnit     = errors.New("invalid unit")
+	ErrAmountOverflow  = errors.New("amount overflow")
+	ErrAmountUnderflow = errors.New("amount underflow")
 )
 
 // Cashu BlindedMessage. See https://github.com/cashubtc/nuts/blob/main/00.md#blindedmessage
@@ -79,6 +115,40 @@ func (bm BlindedMessages) Amount() uint64 {
 	return totalAmount
 }
 
+// CheckedAmount returns the total amount of the blinded messages
+// or ErrAmountOverflow if it does not fit in an uint64
+func (bm BlindedMessages) CheckedAmount() (uint64, error) {
+	var totalAmount uint64 = 0
+	for _, msg := range bm {
+		var err error
+		if totalAmount, err = CheckedAdd(totalAmount, msg.Amount); err != nil {
+			return 0, err
+		}
+	}
+	return totalAmount, nil
+}
+
+// B_s returns the B_ of each blinded message
+func (bm BlindedMessages) B_s() []string {
+	B_s := make([]string, len(bm))
+	for i, msg := range bm {
+		B_s[i] = msg.B_
+	}
+	return B_s
+}
+
+// HasDuplicates reports whether any B_ is repeated in the blinded messages
+func (bm BlindedMessages) HasDuplicates() bool {
+	seen := make(map[string]bool, len(bm))
+	for _, msg := range bm {
+		if seen[msg.B_] {
+			return true
+		}
+		seen[msg.B_] = true
+	}
+	return false
+}
+
 // Cashu BlindedSignature. See https://github.com/cashubtc/nuts/blob/main/00.md#blindsignature
 type BlindedSignature struct {
 	Amount uint64 `json:"amount"`
@@ -129,6 +199,32 @@ func (proofs Proofs) Amount() uint64 {
 	return totalAmount
 }
 
+// CheckedAmount returns the total amount of the proofs
+// or ErrAmountOverflow if it does not fit in an uint64
+func (proofs Proofs) CheckedAmount() (uint64, error) {
+	var totalAmount uint64 = 0
+	for _, proof := range proofs {
+		var err error
+		if totalAmount, err = CheckedAdd(totalAmount, proof.Amount); err != nil {
+			return 0, err
+		}
+	}
+	return totalAmount, nil
+}
+
+// HasDuplicates reports whether any secret is repeated in the proofs.
+// Proofs with the same secret have the same Y so only one can be spent.
+func (proofs Proofs) HasDuplicates() bool {
+	seen := make(map[string]bool, len(proofs))
+	for _, proof := range proofs {
+		if seen[proof.Secret] {
+			return true
+		}
+		seen[proof.Secret] = true
+	}
+	return false
+}
+
 // Cashu token. See https://github.com/cashubtc/nuts/blob/main/00.md#token-format
 type Token interface {
 	Proofs() Proofs
@@ -168,8 +264,8 @@ func NewTokenV3(proofs Proofs, mint string, unit Unit, includeDLEQ bool) (TokenV
 		}
 	}
 
-	if unit != Sat {
-		return TokenV3{}, ErrInvalidUnit
+	if _, err := UnitFromString(unit.String()); err != nil {
+		return TokenV3{}, err
 	}
 
 	tokenProof := TokenV3Proof{Mint: mint, Proofs: proofs}
@@ -223,8 +319,29 @@ func (t TokenV3) Amount() uint64 {
 	return totalAmount
 }
 
+// SplitByMint returns a token for each of the mints in the token
+// in the order they first appear. Entries with the same mint are merged.
+func (t TokenV3) SplitByMint() []TokenV3 {
+	var tokens []TokenV3
+	index := make(map[string]int)
+	for _, tokenProof := range t.Token {
+		i, ok := index[tokenProof.Mint]
+		if !ok {
+			i = len(tokens)
+			index[tokenProof.Mint] = i
+			tokens = append(tokens, TokenV3{
+				Token: []TokenV3Proof{{Mint: tokenProof.Mint}},
+				Unit:  t.Unit,
+				Memo:  t.Memo,
+			})
+		}
+		tokens[i].Token[0].Proofs = append(tokens[i].Token[0].Proofs, tokenProof.Proofs...)
+	}
+	return tokens
+}
+
 func (t TokenV3) Serialize() (string, error) {
-	jsonBytes, err := json.Marshal(t)
+	jsonBytes, err := MarshalCanonical(t)
 	if err != nil {
 		return "", err
 	}
@@ -297,10 +414,13 @@ func (d *DLEQV4) MarshalJSON() ([]byte, error) {
 }
 
 func NewTokenV4(proofs Proofs, mint string, unit Unit, includeDLEQ bool) (TokenV4, error) {
-	if unit != Sat {
-		return TokenV4{}, ErrInvalidUnit
+	if _, err := UnitFromString(unit.String()); err != nil {
+		return TokenV4{}, err
 	}
 
+	// keysets are kept in the order they first appear in the
+	// proofs so the serialized token is always the same
+	var keysetIds []string
 	proofsMap := make(map[string][]ProofV4)
 	for _, proof := range proofs {
 		C, err := hex.DecodeString(proof.C)
@@ -342,19 +462,19 @@ func NewTokenV4(proofs Proofs, mint string, unit Unit, includeDLEQ bool) (TokenV
 				proofV4.DLEQ = dleq
 			}
 		}
+		if _, ok := proofsMap[proof.Id]; !ok {
+			keysetIds = append(keysetIds, proof.Id)
+		}
 		proofsMap[proof.Id] = append(proofsMap[proof.Id], proofV4)
 	}
 
-	proofsV4 := make([]TokenV4Proof, len(proofsMap))
-	i := 0
-	for k, v := range proofsMap {
-		keysetIdBytes, err := hex.DecodeString(k)
+	proofsV4 := make([]TokenV4Proof, len(keysetIds))
+	for i, id := range keysetIds {
+		keysetIdBytes, err := hex.DecodeString(id)
 		if err != nil {
 			return TokenV4{}, fmt.Errorf("invalid keyset id: %v", err)
 		}
-		proofV4 := TokenV4Proof{Id: keysetIdBytes, Proofs: v}
-		proofsV4[i] = proofV4
-		i++
+		proofsV4[i] = TokenV4Proof{Id: keysetIdBytes, Proofs: proofsMap[id]}
 	}
 
 	return TokenV4{MintURL: mint, Unit: unit.String(), TokenProofs: proofsV4}, nil
@@ -433,6 +553,20 @@ func (t TokenV4) Serialize() (string, error) {
 	return token, nil
 }
 
+// MarshalCanonical returns the JSON encoding of v as other implementations
+// produce it. Unlike json.Marshal, characters such as <, > and & in strings
+// are not escaped so the bytes match when they are hashed or compared.
+func MarshalCanonical(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	// Encode adds a newline
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
 type CashuErrCode int
 
 // Error represents an error to be returned by the mint
@@ -459,6 +593,7 @@ const (
 	LightningBackendErrCode CashuErrCode = 2
 
 	UnitErrCode                        CashuErrCode = 11005
+	UnitMismatchErrCode                CashuErrCode = 11010
 	PaymentMethodErrCode               CashuErrCode = 11007
 	BlindedMessageAlreadySignedErrCode CashuErrCode = 10002
 
@@ -466,8 +601,9 @@ const (
 	ProofAlreadyUsedErrCode        CashuErrCode = 11001
 	InsufficientProofAmountErrCode CashuErrCode = 11002
 
-	UnknownKeysetErrCode  CashuErrCode = 12001
-	InactiveKeysetErrCode CashuErrCode = 12002
+	UnknownKeysetErrCode      CashuErrCode = 12001
+	InactiveKeysetErrCode     CashuErrCode = 12002
+	KeysetNotActiveYetErrCode CashuErrCode = 12003
 
 	AmountLimitExceeded            CashuErrCode = 11006
 	MintQuoteRequestNotPaidErrCode CashuErrCode = 20001
@@ -486,6 +622,7 @@ var (
 	UnknownKeysetErr             = Error{Detail: "unknown keyset", Code: UnknownKeysetErrCode}
 	PaymentMethodNotSupportedErr = Error{Detail: "payment method not supported", Code: PaymentMethodErrCode}
 	UnitNotSupportedErr          = Error{Detail: "unit not supported", Code: UnitErrCode}
+	UnitMismatchErr              = Error{Detail: "inputs and outputs not of the same unit", Code: UnitMismatchErrCode}
 	InvalidBlindedMessageAmount  = Error{Detail: "invalid amount in blinded message", Code: StandardErrCode}
 	BlindedMessageAlreadySigned  = Error{Detail: "blinded message already signed", Code: BlindedMessageAlreadySignedErrCode}
 	MintQuoteRequestNotPaid      = Error{Detail: "quote request has not been paid", Code: MintQuoteRequestNotPaidErrCode}
@@ -498,16 +635,22 @@ var (
 	InvalidProofErr              = Error{Detail: "invalid proof", Code: InvalidProofErrCode}
 	NoProofsProvided             = Error{Detail: "no proofs provided", Code: InvalidProofErrCode}
 	DuplicateProofs              = Error{Detail: "duplicate proofs", Code: InvalidProofErrCode}
+	DuplicateOutputs             = Error{Detail: "duplicate outputs", Code: StandardErrCode}
 	QuoteNotExistErr             = Error{Detail: "quote does not exist", Code: MeltQuoteErrCode}
 	QuotePending                 = Error{Detail: "quote is pending", Code: MeltQuotePendingErrCode}
 	MeltQuoteAlreadyPaid         = Error{Detail: "quote already paid", Code: MeltQuoteAlreadyPaidErrCode}
 	MeltAmountExceededErr        = Error{Detail: "max amount for melting exceeded", Code: AmountLimitExceeded}
 	MeltQuoteForRequestExists    = Error{Detail: "melt quote for payment request already exists", Code: MeltQuoteErrCode}
+	MeltQuoteSuperseded          = Error{Detail: "melt quote was superseded by a new quote", Code: MeltQuoteErrCode}
+	InvalidPaymentHashErr        = Error{Detail: "invalid payment hash", Code: StandardErrCode}
+	ExchangeRateUnavailableErr   = Error{Detail: "exchange rate for unit not available", Code: UnitErrCode}
 	InsufficientProofsAmount     = Error{
 		Detail: "amount of input proofs is below amount needed for transaction",
 		Code:   InsufficientProofAmountErrCode,
 	}
 	InactiveKeysetSignatureRequest = Error{Detail: "requested signature from inactive keyset", Code: InactiveKeysetErrCode}
+	KeysetNotActiveYetErr          = Error{Detail: "keyset is not active yet in this mint", Code: KeysetNotActiveYetErrCode}
+	QuoteLookupPubkeyRequired      = Error{Detail: "only quotes with a pubkey can be looked up by payment hash", Code: StandardErrCode}
 )
 
 // Given an amount, it returns list of amounts e.g 13 -> [1, 4, 8]
@@ -524,18 +667,43 @@ func AmountSplit(amount uint64) []uint64 {
 	return rv
 }
 
-func CheckDuplicateProofs(proofs Proofs) bool {
-	proofsMap := make(map[Proof]bool)
-
-	for _, proof := range proofs {
-		if proofsMap[proof] {
-			return true
-		} else {
-			proofsMap[proof] = true
+// CheckedAdd returns the sum of the amounts
+// or ErrAmountOverflow if it does not fit in an uint64
+func CheckedAdd(amounts ...uint64) (uint64, error) {
+	var total uint64 = 0
+	for _, amount := range amounts {
+		var carry uint64
+		total, carry = bits.Add64(total, amount, 0)
+		if carry != 0 {
+			return 0, ErrAmountOverflow
 		}
 	}
+	return total, nil
+}
 
-	return false
+// CheckedSub returns x - y or ErrAmountUnderflow if y is greater than x
+func CheckedSub(x, y uint64) (uint64, error) {
+	diff, borrow := bits.Sub64(x, y, 0)
+	if borrow != 0 {
+		return 0, ErrAmountUnderflow
+	}
+	return diff, nil
+}
+
+// CheckedMul returns x * y or ErrAmountOverflow if it does not fit in an uint64
+func CheckedMul(x, y uint64) (uint64, error) {
+	hi, product := bits.Mul64(x, y)
+	if hi != 0 {
+		return 0, ErrAmountOverflow
+	}
+	return product, nil
+}
+
+// CheckDuplicateProofs reports whether any secret is repeated in the proofs.
+//
+// Deprecated: use Proofs.HasDuplicates
+func CheckDuplicateProofs(proofs Proofs) bool {
+	return proofs.HasDuplicates()
 }
 
 func GenerateRandomQuoteId() (string, error) {
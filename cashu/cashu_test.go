@@ -2,6 +2,8 @@ package cashu
 
 import (
 	"encoding/hex"
+	"math"
+	"math/big"
 	"reflect"
 	"testing"
 )
@@ -310,3 +312,241 @@ func TestSerializeTokenV3(t *testing.T) {
 		}
 	}
 }
+
+// tokens created from the proofs should match the NUT-00 test vectors
+// byte for byte so they are the same as the ones from other implementations.
+func TestNewTokenV4Vector(t *testing.T) {
+	proofs := Proofs{
+		{
+			Amount: 1,
+			Id:     "00ffd48b8f5ecf80",
+			Secret: "acc12435e7b8484c3cf1850149218af90f716a52bf4a5ed347e48ecc13f77388",
+			C:      "0244538319de485d55bed3b29a642bee5879375ab9e7a620e11e48ba482421f3cf",
+		},
+		{
+			Amount: 2,
+			Id:     "00ad268c4d1f5826",
+			Secret: "1323d3d4707a58ad2e23ada4e9f1f49f5a5b4ac7b708eb0d61f738f48307e8ee",
+			C:      "023456aa110d84b4ac747aebd82c3b005aca50bf457ebd5737a4414fac3ae7d94d",
+		},
+		{
+			Amount: 1,
+			Id:     "00ad268c4d1f5826",
+			Secret: "56bcbcbb7cc6406b3fa5d57d2174f4eff8b4402b176926d3a57d3c3dcbb59d57",
+			C:      "0273129c5719e599379a974a626363c333c56cafc0e6d01abe46d5808280789c63",
+		},
+	}
+	expected := "cashuBo2F0gqJhaUgA_9SLj17PgGFwgaNhYQFhc3hAYWNjMTI0MzVlN2I4NDg0YzNjZjE4NTAxNDkyMThhZjkwZjcxNmE1MmJmNGE1ZWQzNDdlNDhlY2MxM2Y3NzM4OGFjWCECRFODGd5IXVW-07KaZCvuWHk3WrnnpiDhHki6SCQh88-iYWlIAK0mjE0fWCZhcIKjYWECYXN4QDEzMjNkM2Q0NzA3YTU4YWQyZTIzYWRhNGU5ZjFmNDlmNWE1YjRhYzdiNzA4ZWIwZDYxZjczOGY0ODMwN2U4ZWVhY1ghAjRWqhENhLSsdHrr2Cw7AFrKUL9Ffr1XN6RBT6w659lNo2FhAWFzeEA1NmJjYmNiYjdjYzY0MDZiM2ZhNWQ1N2QyMTc0ZjRlZmY4YjQ0MDJiMTc2OTI2ZDNhNTdkM2MzZGNiYjU5ZDU3YWNYIQJzEpxXGeWZN5qXSmJjY8MzxWyvwObQGr5G1YCCgHicY2FtdWh0dHA6Ly9sb2NhbGhvc3Q6MzMzOGF1Y3NhdA"
+
+	// keysets could come in any order if they were taken from a map
+	for range 20 {
+		token, err := NewTokenV4(proofs, "http://localhost:3338", Sat, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokenString, err := token.Serialize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tokenString != expected {
+			t.Fatalf("expected '%v'\n\n but got '%v' instead", expected, tokenString)
+		}
+	}
+}
+
+func TestTokenV3SplitByMint(t *testing.T) {
+	token := TokenV3{
+		Token: []TokenV3Proof{
+			{Mint: "http://mint1", Proofs: Proofs{{Amount: 1, Secret: "s1"}}},
+			{Mint: "http://mint2", Proofs: Proofs{{Amount: 2, Secret: "s2"}}},
+			{Mint: "http://mint1", Proofs: Proofs{{Amount: 4, Secret: "s3"}, {Amount: 8, Secret: "s4"}}},
+		},
+		Unit: "sat",
+		Memo: "memo",
+	}
+
+	tokens := token.SplitByMint()
+	if len(tokens) != 2 {
+		t.Fatalf("expected 2 tokens but got %v", len(tokens))
+	}
+	expected := []struct {
+		mint   string
+		amount uint64
+		proofs int
+	}{
+		{mint: "http://mint1", amount: 13, proofs: 3},
+		{mint: "http://mint2", amount: 2, proofs: 1},
+	}
+	for i, split := range tokens {
+		if split.Mint() != expected[i].mint || split.Amount() != expected[i].amount ||
+			len(split.Proofs()) != expected[i].proofs || len(split.Token) != 1 {
+			t.Errorf("unexpected token for mint '%v': %+v", expected[i].mint, split)
+		}
+		if split.Unit != token.Unit || split.Memo != token.Memo {
+			t.Errorf("expected unit and memo of token but got '%v' and '%v'", split.Unit, split.Memo)
+		}
+	}
+}
+
+func TestMarshalCanonical(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{
+			value:    TokenV3{Token: []TokenV3Proof{}, Unit: "sat", Memo: "<fish & chips>"},
+			expected: `{"token":[],"unit":"sat","memo":"<fish & chips>"}`,
+		},
+		{
+			value:    Proof{Amount: 1, Id: "009a1f293253e41e", Secret: "a", C: "02"},
+			expected: `{"amount":1,"id":"009a1f293253e41e","secret":"a","C":"02"}`,
+		},
+	}
+
+	for _, test := range tests {
+		jsonBytes, err := MarshalCanonical(test.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(jsonBytes) != test.expected {
+			t.Errorf("expected '%v' but got '%v'", test.expected, string(jsonBytes))
+		}
+	}
+}
+
+func TestCheckedAmount(t *testing.T) {
+	tests := []struct {
+		amounts  []uint64
+		expected uint64
+		err      error
+	}{
+		{amounts: nil, expected: 0},
+		{amounts: []uint64{1, 2, 4, 8}, expected: 15},
+		{amounts: []uint64{1 << 63, 1<<63 - 1}, expected: 1<<64 - 1},
+		{amounts: []uint64{1 << 63, 1 << 63}, err: ErrAmountOverflow},
+		{amounts: []uint64{1, 1<<64 - 1, 8}, err: ErrAmountOverflow},
+	}
+
+	for _, test := range tests {
+		proofs := make(Proofs, len(test.amounts))
+		blindedMessages := make(BlindedMessages, len(test.amounts))
+		for i, amount := range test.amounts {
+			proofs[i] = Proof{Amount: amount}
+			blindedMessages[i] = BlindedMessage{Amount: amount}
+		}
+
+		amount, err := proofs.CheckedAmount()
+		if err != test.err || amount != test.expected {
+			t.Errorf("expected %v and error '%v' for proofs %v but got %v and '%v'",
+				test.expected, test.err, test.amounts, amount, err)
+		}
+		amount, err = blindedMessages.CheckedAmount()
+		if err != test.err || amount != test.expected {
+			t.Errorf("expected %v and error '%v' for blinded messages %v but got %v and '%v'",
+				test.expected, test.err, test.amounts, amount, err)
+		}
+	}
+}
+
+func TestCheckedArithmetic(t *testing.T) {
+	if sum, err := CheckedAdd(); sum != 0 || err != nil {
+		t.Fatalf("expected 0 for empty sum but got %v and '%v'", sum, err)
+	}
+	if sum, err := CheckedAdd(math.MaxUint64-1, 1); sum != math.MaxUint64 || err != nil {
+		t.Fatalf("expected %v but got %v and '%v'", uint64(math.MaxUint64), sum, err)
+	}
+	if _, err := CheckedAdd(1, math.MaxUint64-1, 1); err != ErrAmountOverflow {
+		t.Fatalf("expected error '%v' but got '%v'", ErrAmountOverflow, err)
+	}
+
+	if diff, err := CheckedSub(math.MaxUint64, math.MaxUint64); diff != 0 || err != nil {
+		t.Fatalf("expected 0 but got %v and '%v'", diff, err)
+	}
+	if _, err := CheckedSub(0, 1); err != ErrAmountUnderflow {
+		t.Fatalf("expected error '%v' but got '%v'", ErrAmountUnderflow, err)
+	}
+
+	if product, err := CheckedMul(math.MaxUint64/1000, 1000); product != math.MaxUint64/1000*1000 || err != nil {
+		t.Fatalf("unexpected product %v and error '%v'", product, err)
+	}
+	if _, err := CheckedMul(math.MaxUint64/1000+1, 1000); err != ErrAmountOverflow {
+		t.Fatalf("expected error '%v' but got '%v'", ErrAmountOverflow, err)
+	}
+}
+
+// FuzzCheckedAmount checks the checked sums against arbitrary
+// precision so that an overflow can never wrap to a smaller amount
+func FuzzCheckedAmount(f *testing.F) {
+	f.Add(uint64(1), uint64(2), uint64(4))
+	f.Add(uint64(math.MaxUint64), uint64(1), uint64(0))
+	f.Add(uint64(1<<63), uint64(1<<63-1), uint64(1))
+	f.Add(uint64(math.MaxUint64/2), uint64(math.MaxUint64/2), uint64(1))
+
+	f.Fuzz(func(t *testing.T, a, b, c uint64) {
+		expected := new(big.Int).SetUint64(a)
+		expected.Add(expected, new(big.Int).SetUint64(b))
+		expected.Add(expected, new(big.Int).SetUint64(c))
+		fits := expected.IsUint64()
+
+		sum, err := CheckedAdd(a, b, c)
+		if fits && (err != nil || sum != expected.Uint64()) {
+			t.Fatalf("expected %v but got %v and '%v'", expected, sum, err)
+		}
+		if !fits && err != ErrAmountOverflow {
+			t.Fatalf("expected overflow for %v + %v + %v but got %v", a, b, c, sum)
+		}
+
+		proofs := Proofs{{Amount: a}, {Amount: b}, {Amount: c}}
+		blindedMessages := BlindedMessages{{Amount: a}, {Amount: b}, {Amount: c}}
+		proofsAmount, proofsErr := proofs.CheckedAmount()
+		messagesAmount, messagesErr := blindedMessages.CheckedAmount()
+		if proofsAmount != sum || proofsErr != err || messagesAmount != sum || messagesErr != err {
+			t.Fatalf("checked amounts %v ('%v') and %v ('%v') do not match sum %v ('%v')",
+				proofsAmount, proofsErr, messagesAmount, messagesErr, sum, err)
+		}
+
+		product, err := CheckedMul(a, b)
+		expected.Mul(new(big.Int).SetUint64(a), new(big.Int).SetUint64(b))
+		if expected.IsUint64() != (err == nil) || (err == nil && product != expected.Uint64()) {
+			t.Fatalf("unexpected product %v and error '%v' for %v * %v", product, err, a, b)
+		}
+
+		diff, err := CheckedSub(a, b)
+		if (a >= b) != (err == nil) || (err == nil && diff != a-b) {
+			t.Fatalf("unexpected difference %v and error '%v' for %v - %v", diff, err, a, b)
+		}
+	})
+}
+
+func TestHasDuplicates(t *testing.T) {
+	proofs := Proofs{
+		{Amount: 1, Secret: "secret1", C: "C1"},
+		{Amount: 2, Secret: "secret2", C: "C2"},
+	}
+	if proofs.HasDuplicates() {
+		t.Fatal("expected no duplicate proofs")
+	}
+	// same secret is a duplicate even with a different witness
+	withWitness := proofs[0]
+	withWitness.Witness = "witness"
+	if !append(proofs, withWitness).HasDuplicates() {
+		t.Fatal("expected duplicate proofs")
+	}
+	if (Proofs{}).HasDuplicates() {
+		t.Fatal("expected no duplicate proofs")
+	}
+
+	blindedMessages := BlindedMessages{
+		{Amount: 1, B_: "B_1", Id: "id"},
+		{Amount: 1, B_: "B_2", Id: "id"},
+	}
+	if blindedMessages.HasDuplicates() {
+		t.Fatal("expected no duplicate blinded messages")
+	}
+	if !append(blindedMessages, BlindedMessage{Amount: 2, B_: "B_1", Id: "other"}).HasDuplicates() {
+		t.Fatal("expected duplicate blinded messages")
+	}
+	if !reflect.DeepEqual(blindedMessages.B_s(), []string{"B_1", "B_2"}) {
+		t.Fatalf("unexpected B_s %v", blindedMessages.B_s())
+	}
+}
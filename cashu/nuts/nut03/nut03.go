@@ -3,13 +3,73 @@
 // [NUT-03]: https://github.com/cashubtc/nuts/blob/main/03.md
 package nut03
 
-import "github.com/elnosh/gonuts/cashu"
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/elnosh/gonuts/cashu"
+)
 
 type PostSwapRequest struct {
 	Inputs  cashu.Proofs          `json:"inputs"`
 	Outputs cashu.BlindedMessages `json:"outputs"`
 }
 
+// EncodeStream writes the request as JSON without
+// building the whole encoded request in memory.
+func (r PostSwapRequest) EncodeStream(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`{"inputs":`)
+	if err := cashu.EncodeArrayStream(bw, r.Inputs); err != nil {
+		return err
+	}
+	bw.WriteString(`,"outputs":`)
+	if err := cashu.EncodeArrayStream(bw, r.Outputs); err != nil {
+		return err
+	}
+	bw.WriteString("}")
+	return bw.Flush()
+}
+
+// DecodeStream reads the request from the reader one proof or output at a time.
+// It errors if inputs or outputs have more than maxItems elements.
+func (r *PostSwapRequest) DecodeStream(rd io.Reader, maxItems int) error {
+	return cashu.DecodeObjectStream(json.NewDecoder(rd), map[string]func(*json.Decoder) error{
+		"inputs": func(dec *json.Decoder) (err error) {
+			r.Inputs, err = cashu.DecodeArrayStream[cashu.Proof](dec, maxItems)
+			return
+		},
+		"outputs": func(dec *json.Decoder) (err error) {
+			r.Outputs, err = cashu.DecodeArrayStream[cashu.BlindedMessage](dec, maxItems)
+			return
+		},
+	})
+}
+
 type PostSwapResponse struct {
 	Signatures cashu.BlindedSignatures `json:"signatures"`
 }
+
+// EncodeStream writes the response as JSON without
+// building the whole encoded response in memory.
+func (r PostSwapResponse) EncodeStream(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`{"signatures":`)
+	if err := cashu.EncodeArrayStream(bw, r.Signatures); err != nil {
+		return err
+	}
+	bw.WriteString("}")
+	return bw.Flush()
+}
+
+// DecodeStream reads the response from the reader one signature at a time.
+// It errors if there are more than maxItems signatures.
+func (r *PostSwapResponse) DecodeStream(rd io.Reader, maxItems int) error {
+	return cashu.DecodeObjectStream(json.NewDecoder(rd), map[string]func(*json.Decoder) error{
+		"signatures": func(dec *json.Decoder) (err error) {
+			r.Signatures, err = cashu.DecodeArrayStream[cashu.BlindedSignature](dec, maxItems)
+			return
+		},
+	})
+}
@@ -4,7 +4,9 @@
 package nut04
 
 import (
+	"bufio"
 	"encoding/json"
+	"io"
 
 	"github.com/elnosh/gonuts/cashu"
 )
@@ -51,6 +53,10 @@ func StringToState(state string) State {
 type PostMintQuoteBolt11Request struct {
 	Amount uint64 `json:"amount"`
 	Unit   string `json:"unit"`
+	// memo of the invoice. Only if the mint supports the description option
+	Description string `json:"description,omitempty"`
+	// NUT-20 pubkey that has to sign the mint request
+	Pubkey string `json:"pubkey,omitempty"`
 }
 
 type PostMintQuoteBolt11Response struct {
@@ -58,17 +64,87 @@ type PostMintQuoteBolt11Response struct {
 	Request string `json:"request"`
 	State   State  `json:"state"`
 	Expiry  uint64 `json:"expiry"`
+	Pubkey  string `json:"pubkey,omitempty"`
 }
 
 type PostMintBolt11Request struct {
 	Quote   string                `json:"quote"`
 	Outputs cashu.BlindedMessages `json:"outputs"`
+	// NUT-20 signature if the quote has a pubkey
+	Signature string `json:"signature,omitempty"`
+}
+
+// EncodeStream writes the request as JSON without
+// building the whole encoded request in memory.
+func (r PostMintBolt11Request) EncodeStream(w io.Writer) error {
+	quote, err := json.Marshal(r.Quote)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`{"quote":`)
+	bw.Write(quote)
+	bw.WriteString(`,"outputs":`)
+	if err := cashu.EncodeArrayStream(bw, r.Outputs); err != nil {
+		return err
+	}
+	if len(r.Signature) > 0 {
+		signature, err := json.Marshal(r.Signature)
+		if err != nil {
+			return err
+		}
+		bw.WriteString(`,"signature":`)
+		bw.Write(signature)
+	}
+	bw.WriteString("}")
+	return bw.Flush()
+}
+
+// DecodeStream reads the request from the reader one output at a time.
+// It errors if there are more than maxItems outputs.
+func (r *PostMintBolt11Request) DecodeStream(rd io.Reader, maxItems int) error {
+	return cashu.DecodeObjectStream(json.NewDecoder(rd), map[string]func(*json.Decoder) error{
+		"quote": func(dec *json.Decoder) error {
+			return dec.Decode(&r.Quote)
+		},
+		"outputs": func(dec *json.Decoder) (err error) {
+			r.Outputs, err = cashu.DecodeArrayStream[cashu.BlindedMessage](dec, maxItems)
+			return
+		},
+		"signature": func(dec *json.Decoder) error {
+			return dec.Decode(&r.Signature)
+		},
+	})
 }
 
 type PostMintBolt11Response struct {
 	Signatures cashu.BlindedSignatures `json:"signatures"`
 }
 
+// EncodeStream writes the response as JSON without
+// building the whole encoded response in memory.
+func (r PostMintBolt11Response) EncodeStream(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`{"signatures":`)
+	if err := cashu.EncodeArrayStream(bw, r.Signatures); err != nil {
+		return err
+	}
+	bw.WriteString("}")
+	return bw.Flush()
+}
+
+// DecodeStream reads the response from the reader one signature at a time.
+// It errors if there are more than maxItems signatures.
+func (r *PostMintBolt11Response) DecodeStream(rd io.Reader, maxItems int) error {
+	return cashu.DecodeObjectStream(json.NewDecoder(rd), map[string]func(*json.Decoder) error{
+		"signatures": func(dec *json.Decoder) (err error) {
+			r.Signatures, err = cashu.DecodeArrayStream[cashu.BlindedSignature](dec, maxItems)
+			return
+		},
+	})
+}
+
 type TempQuote struct {
 	Quote   string `json:"quote"`
 	Request string `json:"request"`
@@ -0,0 +1,44 @@
+package nut04
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/elnosh/gonuts/cashu"
+)
+
+func TestPostMintBolt11RequestStream(t *testing.T) {
+	outputs := cashu.BlindedMessages{
+		{Amount: 1, Id: "00456a94ab4e1c46", B_: "0342e5bcc77f5b2a3c2afb40bb591a1e27da83cddc968abdc0ec4904201a201834"},
+		{Amount: 2, Id: "00456a94ab4e1c46", B_: "032fd3c4dc49a2844a89998d5e9d5b0f0b00dde9310063acb8a92e2fdafa4126d4"},
+	}
+	tests := []PostMintBolt11Request{
+		{Quote: "quote", Outputs: outputs},
+		{Quote: "quote", Outputs: outputs, Signature: "abcd"},
+	}
+
+	for _, request := range tests {
+		var buf bytes.Buffer
+		if err := request.EncodeStream(&buf); err != nil {
+			t.Fatalf("unexpected error encoding request: %v", err)
+		}
+		var unmarshaled PostMintBolt11Request
+		if err := json.Unmarshal(buf.Bytes(), &unmarshaled); err != nil {
+			t.Fatalf("unexpected error unmarshaling request: %v", err)
+		}
+		if !reflect.DeepEqual(unmarshaled, request) {
+			t.Fatalf("expected request '%+v' but got '%+v'", request, unmarshaled)
+		}
+
+		encoded, _ := json.Marshal(request)
+		var decoded PostMintBolt11Request
+		if err := decoded.DecodeStream(bytes.NewReader(encoded), 10); err != nil {
+			t.Fatalf("unexpected error decoding request: %v", err)
+		}
+		if !reflect.DeepEqual(decoded, request) {
+			t.Fatalf("expected decoded request '%+v' but got '%+v'", request, decoded)
+		}
+	}
+}
@@ -5,6 +5,7 @@ package nut05
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/elnosh/gonuts/cashu"
 )
@@ -44,15 +45,87 @@ func StringToState(state string) State {
 }
 
 type PostMeltQuoteBolt11Request struct {
-	Request string               `json:"request"`
-	Unit    string               `json:"unit"`
-	Options map[string]MppOption `json:"options,omitempty"`
+	Request string       `json:"request"`
+	Unit    string       `json:"unit"`
+	Options *MeltOptions `json:"options,omitempty"`
 }
 
+// MeltOptions are the options in a melt quote request.
+// Options that are not known are kept as is when
+// marshaling so they are not dropped.
+type MeltOptions struct {
+	Mpp        *MppOption
+	Amountless *AmountlessOption
+
+	unknown map[string]json.RawMessage
+}
+
+// MppOption to request a quote to pay part of the invoice amount as defined in NUT-15
 type MppOption struct {
 	Amount uint64 `json:"amount"`
 }
 
+// AmountlessOption sets the amount to pay for an invoice without an amount
+type AmountlessOption struct {
+	AmountMsat uint64 `json:"amount_msat"`
+}
+
+const (
+	mppOptionKey        = "mpp"
+	amountlessOptionKey = "amountless"
+)
+
+func (options MeltOptions) MarshalJSON() ([]byte, error) {
+	optionsMap := make(map[string]any, len(options.unknown)+2)
+	for key, value := range options.unknown {
+		optionsMap[key] = value
+	}
+	if options.Mpp != nil {
+		optionsMap[mppOptionKey] = options.Mpp
+	}
+	if options.Amountless != nil {
+		optionsMap[amountlessOptionKey] = options.Amountless
+	}
+	return json.Marshal(optionsMap)
+}
+
+func (options *MeltOptions) UnmarshalJSON(data []byte) error {
+	optionsMap := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &optionsMap); err != nil {
+		return err
+	}
+
+	*options = MeltOptions{}
+	for key, value := range optionsMap {
+		switch key {
+		case mppOptionKey:
+			if string(value) == "null" {
+				continue
+			}
+			var mpp MppOption
+			if err := json.Unmarshal(value, &mpp); err != nil {
+				return fmt.Errorf("invalid mpp option: %v", err)
+			}
+			options.Mpp = &mpp
+		case amountlessOptionKey:
+			if string(value) == "null" {
+				continue
+			}
+			var amountless AmountlessOption
+			if err := json.Unmarshal(value, &amountless); err != nil {
+				return fmt.Errorf("invalid amountless option: %v", err)
+			}
+			options.Amountless = &amountless
+		default:
+			if options.unknown == nil {
+				options.unknown = make(map[string]json.RawMessage)
+			}
+			options.unknown[key] = value
+		}
+	}
+	return nil
+}
+
 type PostMeltQuoteBolt11Response struct {
 	Quote      string                  `json:"quote"`
 	Amount     uint64                  `json:"amount"`
@@ -0,0 +1,52 @@
+package nut05
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMeltOptionsJSON(t *testing.T) {
+	data := `{"request":"lnbc1","unit":"sat","options":{"future":{"key":"value"},"mpp":{"amount":1000}}}`
+
+	var request PostMeltQuoteBolt11Request
+	if err := json.Unmarshal([]byte(data), &request); err != nil {
+		t.Fatalf("unexpected error unmarshaling request: %v", err)
+	}
+	if request.Options == nil || request.Options.Mpp == nil || request.Options.Mpp.Amount != 1000 {
+		t.Fatalf("expected mpp option with amount 1000 but got '%+v'", request.Options)
+	}
+	if request.Options.Amountless != nil {
+		t.Fatalf("unexpected amountless option '%+v'", request.Options.Amountless)
+	}
+
+	// unknown options are kept
+	marshaled, err := json.Marshal(request)
+	if err != nil {
+		t.Fatalf("unexpected error marshaling request: %v", err)
+	}
+	if string(marshaled) != data {
+		t.Fatalf("expected '%v' but got '%v'", data, string(marshaled))
+	}
+
+	request = PostMeltQuoteBolt11Request{
+		Request: "lnbc1",
+		Unit:    "sat",
+		Options: &MeltOptions{Amountless: &AmountlessOption{AmountMsat: 5000}},
+	}
+	marshaled, _ = json.Marshal(request)
+	expected := `{"request":"lnbc1","unit":"sat","options":{"amountless":{"amount_msat":5000}}}`
+	if string(marshaled) != expected {
+		t.Fatalf("expected '%v' but got '%v'", expected, string(marshaled))
+	}
+
+	// no options are omitted
+	marshaled, _ = json.Marshal(PostMeltQuoteBolt11Request{Request: "lnbc1", Unit: "sat"})
+	expected = `{"request":"lnbc1","unit":"sat"}`
+	if string(marshaled) != expected {
+		t.Fatalf("expected '%v' but got '%v'", expected, string(marshaled))
+	}
+
+	if err := json.Unmarshal([]byte(`{"options":{"mpp":{"amount":"abc"}}}`), &request); err == nil {
+		t.Fatal("expected error for invalid mpp option")
+	}
+}
@@ -21,6 +21,22 @@ type MintInfo struct {
 	URLs            []string      `json:"urls,omitempty"`
 	Time            int64         `json:"time,omitempty"`
 	Nuts            NutsMap       `json:"nuts"`
+	// extension with the limits of the mint on requests
+	Limits *OperationalLimits `json:"limits,omitempty"`
+}
+
+// OperationalLimits are the limits the mint enforces on requests so that
+// wallets can adapt the size of their requests instead of hitting errors.
+type OperationalLimits struct {
+	MaxInputs  int `json:"max_inputs,omitempty"`
+	MaxOutputs int `json:"max_outputs,omitempty"`
+	// max size in bytes of a request body
+	MaxRequestSize int64 `json:"max_request_size,omitempty"`
+	// max websocket subscriptions per connection (NUT-17)
+	MaxSubscriptions int `json:"max_subscriptions,omitempty"`
+	// seconds for which mint and melt quotes are valid
+	MintQuoteTTL uint64 `json:"mint_quote_ttl,omitempty"`
+	MeltQuoteTTL uint64 `json:"melt_quote_ttl,omitempty"`
 }
 
 type ContactInfo struct {
@@ -31,17 +47,18 @@ type ContactInfo struct {
 // custom unmarshal to ignore contact field if on old format
 func (mi *MintInfo) UnmarshalJSON(data []byte) error {
 	var tempInfo struct {
-		Name            string          `json:"name"`
-		Pubkey          string          `json:"pubkey"`
-		Version         string          `json:"version"`
-		Description     string          `json:"description"`
-		LongDescription string          `json:"description_long,omitempty"`
-		Contact         json.RawMessage `json:"contact,omitempty"`
-		Motd            string          `json:"motd,omitempty"`
-		IconURL         string          `json:"icon_url,omitempty"`
-		URLs            []string        `json:"urls,omitempty"`
-		Time            int64           `json:"time,omitempty"`
-		Nuts            NutsMap         `json:"nuts"`
+		Name            string             `json:"name"`
+		Pubkey          string             `json:"pubkey"`
+		Version         string             `json:"version"`
+		Description     string             `json:"description"`
+		LongDescription string             `json:"description_long,omitempty"`
+		Contact         json.RawMessage    `json:"contact,omitempty"`
+		Motd            string             `json:"motd,omitempty"`
+		IconURL         string             `json:"icon_url,omitempty"`
+		URLs            []string           `json:"urls,omitempty"`
+		Time            int64              `json:"time,omitempty"`
+		Nuts            NutsMap            `json:"nuts"`
+		Limits          *OperationalLimits `json:"limits,omitempty"`
 	}
 
 	if err := json.Unmarshal(data, &tempInfo); err != nil {
@@ -58,6 +75,7 @@ func (mi *MintInfo) UnmarshalJSON(data []byte) error {
 	mi.URLs = tempInfo.URLs
 	mi.Time = tempInfo.Time
 	mi.Nuts = tempInfo.Nuts
+	mi.Limits = tempInfo.Limits
 	json.Unmarshal(tempInfo.Contact, &mi.Contact)
 
 	return nil
@@ -69,10 +87,43 @@ type NutSetting struct {
 }
 
 type MethodSetting struct {
-	Method    string `json:"method"`
-	Unit      string `json:"unit"`
-	MinAmount uint64 `json:"min_amount,omitempty"`
-	MaxAmount uint64 `json:"max_amount,omitempty"`
+	Method    string         `json:"method"`
+	Unit      string         `json:"unit"`
+	MinAmount uint64         `json:"min_amount,omitempty"`
+	MaxAmount uint64         `json:"max_amount,omitempty"`
+	Options   *MethodOptions `json:"options,omitempty"`
+}
+
+// MethodOptions are the optional fields of quote requests supported for the method
+type MethodOptions struct {
+	// mint quote requests can have a description for the invoice
+	Description bool `json:"description,omitempty"`
+}
+
+// MethodSetting returns the setting of the method and unit in the
+// NUT-04 or NUT-05 settings of the info, if the mint supports it
+func (mi MintInfo) MethodSetting(nut int, method, unit string) (MethodSetting, bool) {
+	setting, ok := mi.Nuts[nut]
+	if !ok {
+		return MethodSetting{}, false
+	}
+	// nuts in info from mints are decoded without a type
+	nutSetting, ok := setting.(NutSetting)
+	if !ok {
+		jsonSetting, err := json.Marshal(setting)
+		if err != nil || json.Unmarshal(jsonSetting, &nutSetting) != nil {
+			return MethodSetting{}, false
+		}
+	}
+	if nutSetting.Disabled {
+		return MethodSetting{}, false
+	}
+	for _, methodSetting := range nutSetting.Methods {
+		if methodSetting.Method == method && methodSetting.Unit == unit {
+			return methodSetting, true
+		}
+	}
+	return MethodSetting{}, false
 }
 
 type NutsMap map[int]any
@@ -1,8 +1,15 @@
 package nut07
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 )
 
 type State int
@@ -45,6 +52,10 @@ type PostCheckStateRequest struct {
 
 type PostCheckStateResponse struct {
 	States []ProofState `json:"states"`
+	// set if the mint signs the states with the pubkey in its info (NUT-06)
+	// so the response can be shown to others as proof of the states at the time
+	Timestamp int64  `json:"timestamp,omitempty"`
+	Signature string `json:"signature,omitempty"`
 }
 
 type ProofState struct {
@@ -85,3 +96,39 @@ func (state *ProofState) UnmarshalJSON(data []byte) error {
 
 	return nil
 }
+
+// msgHash is the hash of the Y and state of each proof followed by the timestamp
+func msgHash(states []ProofState, timestamp int64) [32]byte {
+	var msg strings.Builder
+	for _, state := range states {
+		msg.WriteString(state.Y)
+		msg.WriteString(state.State.String())
+	}
+	msg.WriteString(strconv.FormatInt(timestamp, 10))
+	return sha256.Sum256([]byte(msg.String()))
+}
+
+// SignStates returns the hex encoded schnorr signature of the states at the timestamp
+func SignStates(states []ProofState, timestamp int64, key *btcec.PrivateKey) (string, error) {
+	hash := msgHash(states, timestamp)
+	signature, err := schnorr.Sign(key, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(signature.Serialize()), nil
+}
+
+// VerifyStates checks that the response was signed by the mint with
+// the pubkey. It is false if the response does not have a signature.
+func VerifyStates(response PostCheckStateResponse, pubkey *btcec.PublicKey) bool {
+	sigBytes, err := hex.DecodeString(response.Signature)
+	if err != nil || pubkey == nil {
+		return false
+	}
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return false
+	}
+	hash := msgHash(response.States, response.Timestamp)
+	return sig.Verify(hash[:], pubkey)
+}
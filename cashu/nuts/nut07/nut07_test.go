@@ -0,0 +1,61 @@
+package nut07
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+func TestSignStates(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	otherKey, _ := btcec.NewPrivateKey()
+	states := []ProofState{
+		{Y: "02e8b2e8fa4c4e1b2e4fa0e26b3bd6d4b5ae1a3bbd9b1e2e0c5a8a8e1c6b1b3f0a", State: Spent, Witness: "witness"},
+		{Y: "03a2b0c0cb8b0c5c18b6b06b0e0a4f84ed1eb1bdcf03dbe3e7c8fc6b8e1f4e0e21", State: Unspent},
+	}
+	var timestamp int64 = 1700000000
+
+	signature, err := SignStates(states, timestamp, key)
+	if err != nil {
+		t.Fatalf("unexpected error signing states: %v", err)
+	}
+	response := PostCheckStateResponse{States: states, Timestamp: timestamp, Signature: signature}
+	if !VerifyStates(response, key.PubKey()) {
+		t.Fatal("expected valid signature")
+	}
+
+	// signature is kept after encoding the response
+	jsonResponse, err := json.Marshal(&response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded PostCheckStateResponse
+	if err := json.Unmarshal(jsonResponse, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !VerifyStates(decoded, key.PubKey()) {
+		t.Fatal("expected valid signature after decoding response")
+	}
+
+	otherState := []ProofState{states[0], {Y: states[1].Y, State: Spent}}
+	tests := []struct {
+		name     string
+		response PostCheckStateResponse
+		pubkey   *btcec.PublicKey
+	}{
+		{"other state", PostCheckStateResponse{otherState, timestamp, signature}, key.PubKey()},
+		{"other proofs", PostCheckStateResponse{states[:1], timestamp, signature}, key.PubKey()},
+		{"other timestamp", PostCheckStateResponse{states, timestamp + 1, signature}, key.PubKey()},
+		{"other pubkey", response, otherKey.PubKey()},
+		{"invalid signature", PostCheckStateResponse{states, timestamp, "abcd"}, key.PubKey()},
+		{"no signature", PostCheckStateResponse{States: states}, key.PubKey()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if VerifyStates(test.response, test.pubkey) {
+				t.Fatal("expected invalid signature")
+			}
+		})
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync"
+
+	"github.com/elnosh/gonuts/cashu"
 )
 
 type SecretKind int
@@ -22,9 +25,76 @@ func (kind SecretKind) String() string {
 		return "P2PK"
 	case HTLC:
 		return "HTLC"
-	default:
-		return "anyonecanspend"
 	}
+	if name, ok := customKindName(kind); ok {
+		return name
+	}
+	return "anyonecanspend"
+}
+
+// MinCustomKind is the lowest number of a kind registered with RegisterKind.
+// Numbers below it are reserved for the kinds of the spec.
+const MinCustomKind SecretKind = 100
+
+var (
+	customKindsMu sync.RWMutex
+	// names of the kinds registered with RegisterKind
+	customKinds = make(map[SecretKind]string)
+)
+
+// RegisterKind adds a well-known secret kind besides P2PK and HTLC, i.e for
+// conditions used in private deployments. The kind is a fixed number chosen
+// by the caller (MinCustomKind or higher) so that it does not depend on the
+// order in which kinds are registered. Secrets of the kind can then be created
+// with NewSecretFromSpendingCondition and are deserialized with it instead of
+// as AnyoneCanSpend. Registering the same kind and name again is a no-op.
+func RegisterKind(kind SecretKind, name string) error {
+	if kind < MinCustomKind {
+		return fmt.Errorf("NUT-10 kind %d is reserved. Custom kinds start at %d", int(kind), int(MinCustomKind))
+	}
+	if len(name) == 0 || name == P2PK.String() || name == HTLC.String() || name == AnyoneCanSpend.String() {
+		return fmt.Errorf("invalid name '%v' for NUT-10 kind", name)
+	}
+
+	customKindsMu.Lock()
+	defer customKindsMu.Unlock()
+	if registered, ok := customKinds[kind]; ok {
+		if registered != name {
+			return fmt.Errorf("NUT-10 kind %d is already registered as '%v'", int(kind), registered)
+		}
+		return nil
+	}
+	for registeredKind, registered := range customKinds {
+		if registered == name {
+			return fmt.Errorf("NUT-10 kind '%v' is already registered as %d", name, int(registeredKind))
+		}
+	}
+	customKinds[kind] = name
+	return nil
+}
+
+// IsCustomKind returns true if the kind was registered with RegisterKind
+func IsCustomKind(kind SecretKind) bool {
+	_, ok := customKindName(kind)
+	return ok
+}
+
+func customKindName(kind SecretKind) (string, bool) {
+	customKindsMu.RLock()
+	defer customKindsMu.RUnlock()
+	name, ok := customKinds[kind]
+	return name, ok
+}
+
+func customKindFromString(name string) (SecretKind, bool) {
+	customKindsMu.RLock()
+	defer customKindsMu.RUnlock()
+	for kind, registered := range customKinds {
+		if registered == name {
+			return kind, true
+		}
+	}
+	return AnyoneCanSpend, false
 }
 
 type WellKnownSecret struct {
@@ -40,7 +110,7 @@ type SecretData struct {
 
 // SerializeSecret returns the json string to be put in the secret field of a proof
 func SerializeSecret(secret WellKnownSecret) (string, error) {
-	jsonSecret, err := json.Marshal(secret.Data)
+	jsonSecret, err := cashu.MarshalCanonical(secret.Data)
 	if err != nil {
 		return "", err
 	}
@@ -74,7 +144,8 @@ func DeserializeSecret(serializedSecret string) (WellKnownSecret, error) {
 	case "HTLC":
 		secret.Kind = HTLC
 	default:
-		secret.Kind = AnyoneCanSpend
+		// AnyoneCanSpend if the kind was not registered
+		secret.Kind, _ = customKindFromString(kind)
 	}
 
 	if err := json.Unmarshal(rawJsonSecret[1], &secret.Data); err != nil {
@@ -99,7 +170,8 @@ func NewSecretFromSpendingCondition(spendingCondition SpendingCondition) (string
 	}
 	nonce := hex.EncodeToString(nonceBytes)
 
-	if spendingCondition.Kind != P2PK && spendingCondition.Kind != HTLC {
+	kind := spendingCondition.Kind
+	if kind != P2PK && kind != HTLC && !IsCustomKind(kind) {
 		return "", fmt.Errorf("invalid NUT-10 kind '%s' to create new secret", spendingCondition.Kind)
 	}
 
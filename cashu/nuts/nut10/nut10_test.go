@@ -36,6 +36,20 @@ func TestSerializeSecret(t *testing.T) {
 			},
 			expectedSecret: `["HTLC", {"nonce":"da62796403af76c80cd6ce9153ed3746","data":"033281c37677ea273eb7183b783067f5244933ef78d8c3f15b1a77cb246099c26e","tags":[["pubkeys","02698c4e2b5f9534cd0687d87513c759790cf829aa5739184a3e3735471fbda904"]]}]`,
 		},
+		// characters escaped by encoding/json by default are kept as is
+		{
+			secret: WellKnownSecret{
+				Kind: P2PK,
+				Data: SecretData{
+					Nonce: "da62796403af76c80cd6ce9153ed3746",
+					Data:  "033281c37677ea273eb7183b783067f5244933ef78d8c3f15b1a77cb246099c26e",
+					Tags: [][]string{
+						{"memo", "<fish & chips>"},
+					},
+				},
+			},
+			expectedSecret: `["P2PK", {"nonce":"da62796403af76c80cd6ce9153ed3746","data":"033281c37677ea273eb7183b783067f5244933ef78d8c3f15b1a77cb246099c26e","tags":[["memo","<fish & chips>"]]}]`,
+		},
 	}
 
 	for _, test := range tests {
@@ -95,3 +109,66 @@ func TestDeserializeSecret(t *testing.T) {
 		}
 	}
 }
+
+func TestRegisterKind(t *testing.T) {
+	for _, name := range []string{"", "P2PK", "HTLC", "anyonecanspend"} {
+		if err := RegisterKind(MinCustomKind, name); err == nil {
+			t.Fatalf("expected error registering kind '%v'", name)
+		}
+	}
+	if err := RegisterKind(HTLC+1, "ESCROW"); err == nil {
+		t.Fatal("expected error registering kind with reserved number")
+	}
+
+	jsonSecret := `["ESCROW", {"nonce":"da62796403af76c80cd6ce9153ed3746","data":"escrow data","tags":[]}]`
+	secret, err := DeserializeSecret(jsonSecret)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if secret.Kind != AnyoneCanSpend {
+		t.Fatalf("expected unregistered kind to be '%v' but got '%v'", AnyoneCanSpend, secret.Kind)
+	}
+	if _, err := NewSecretFromSpendingCondition(SpendingCondition{Kind: HTLC + 100}); err == nil {
+		t.Fatal("expected error creating secret of unregistered kind")
+	}
+
+	kind := MinCustomKind + 1
+	if err := RegisterKind(kind, "ESCROW"); err != nil {
+		t.Fatalf("got unexpected error registering kind: %v", err)
+	}
+	if !IsCustomKind(kind) || kind.String() != "ESCROW" {
+		t.Fatalf("expected custom kind 'ESCROW' but got '%v'", kind)
+	}
+	if err := RegisterKind(kind, "ESCROW"); err != nil {
+		t.Fatalf("got unexpected error registering same kind again: %v", err)
+	}
+	if err := RegisterKind(kind, "OTHER"); err == nil {
+		t.Fatal("expected error registering another name with the same number")
+	}
+	if err := RegisterKind(kind+1, "ESCROW"); err == nil {
+		t.Fatal("expected error registering the name with another number")
+	}
+	if IsCustomKind(kind+1) || IsCustomKind(MinCustomKind) {
+		t.Fatal("unexpected custom kind that was not registered")
+	}
+
+	secret, err = DeserializeSecret(jsonSecret)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if secret.Kind != kind {
+		t.Fatalf("expected kind '%v' but got '%v'", kind, secret.Kind)
+	}
+
+	newSecret, err := NewSecretFromSpendingCondition(SpendingCondition{Kind: kind, Data: "escrow data"})
+	if err != nil {
+		t.Fatalf("got unexpected error creating secret: %v", err)
+	}
+	secret, err = DeserializeSecret(newSecret)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if secret.Kind != kind || secret.Data.Data != "escrow data" {
+		t.Fatalf("unexpected secret: %+v", secret)
+	}
+}
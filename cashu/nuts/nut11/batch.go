@@ -0,0 +1,216 @@
+package nut11
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+// SignatureBatch verifies schnorr signatures together with a single
+// multi-scalar multiplication (BIP-340 batch verification) which is faster
+// than verifying them one by one. It only tells if all the signatures
+// are valid, not which ones are not.
+type SignatureBatch struct {
+	items []batchItem
+	// set if a signature or message could not be parsed
+	invalid bool
+}
+
+type batchItem struct {
+	hash      []byte
+	signature *schnorr.Signature
+	pubkey    *btcec.PublicKey
+}
+
+// Add a signature of the hash that should be from the pubkey
+func (b *SignatureBatch) Add(hash []byte, signature string, pubkey *btcec.PublicKey) {
+	sig, err := ParseSignature(signature)
+	if err != nil || len(hash) != sha256.Size || pubkey == nil {
+		b.invalid = true
+		return
+	}
+	b.items = append(b.items, batchItem{hash: hash, signature: sig, pubkey: pubkey})
+}
+
+func (b *SignatureBatch) Len() int {
+	return len(b.items)
+}
+
+// Verify returns true if all the signatures in the batch are valid
+func (b *SignatureBatch) Verify() bool {
+	if b.invalid {
+		return false
+	}
+	switch len(b.items) {
+	case 0:
+		return true
+	case 1:
+		item := b.items[0]
+		return item.signature.Verify(item.hash, item.pubkey)
+	}
+
+	// for random a_i (a_0 = 1) check that:
+	// (sum a_i*s_i)G + sum a_i*(-R_i) + sum a_i*e_i*(-P_i) = infinity
+	// The terms for the same pubkey are added in one scalar so that
+	// signatures from the same key (i.e SIG_ALL) only cost their R_i.
+	var sSum btcec.ModNScalar
+	scalars := make([]btcec.ModNScalar, 0, 2*len(b.items))
+	points := make([]btcec.JacobianPoint, 0, 2*len(b.items))
+	pubkeyIdx := make(map[[32]byte]int)
+	for i, item := range b.items {
+		sigBytes := item.signature.Serialize()
+		var r btcec.FieldVal
+		var s btcec.ModNScalar
+		if r.SetByteSlice(sigBytes[:32]) || s.SetByteSlice(sigBytes[32:]) {
+			return false
+		}
+
+		var R btcec.JacobianPoint
+		R.X.Set(&r)
+		// y is odd to get -R_i for the even y of R_i
+		if !btcec.DecompressY(&R.X, true, &R.Y) {
+			return false
+		}
+		R.Z.SetInt(1)
+
+		var a btcec.ModNScalar
+		if i == 0 {
+			a.SetInt(1)
+		} else if !randomScalar(&a) {
+			return false
+		}
+		s.Mul(&a)
+		sSum.Add(&s)
+		scalars = append(scalars, a)
+		points = append(points, R)
+
+		pBytes := schnorr.SerializePubKey(item.pubkey)
+		var e btcec.ModNScalar
+		e.SetBytes(challenge(sigBytes[:32], pBytes, item.hash))
+		e.Mul(&a)
+
+		key := [32]byte(pBytes)
+		if idx, ok := pubkeyIdx[key]; ok {
+			scalars[idx].Add(&e)
+			continue
+		}
+		var P btcec.JacobianPoint
+		item.pubkey.AsJacobian(&P)
+		// -P_i for the even y of P_i
+		if !P.Y.IsOdd() {
+			P.Y.Negate(1).Normalize()
+		}
+		pubkeyIdx[key] = len(scalars)
+		scalars = append(scalars, e)
+		points = append(points, P)
+	}
+
+	var sG, sum, result btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(&sSum, &sG)
+	multiScalarMult(scalars, points, &sum)
+	btcec.AddNonConst(&sG, &sum, &result)
+	return (result.X.IsZero() && result.Y.IsZero()) || result.Z.IsZero()
+}
+
+// challenge is the BIP-340 tagged hash of R, P and the message
+func challenge(r, p, msg []byte) *[32]byte {
+	tag := sha256.Sum256([]byte("BIP0340/challenge"))
+	h := sha256.New()
+	h.Write(tag[:])
+	h.Write(tag[:])
+	h.Write(r)
+	h.Write(p)
+	h.Write(msg)
+	var e [32]byte
+	copy(e[:], h.Sum(nil))
+	return &e
+}
+
+// randomScalar sets a to a random 128 bit scalar, which is enough for the
+// security of the batch and makes the multiplications by a_i cheaper
+func randomScalar(a *btcec.ModNScalar) bool {
+	var b [32]byte
+	for a.IsZero() {
+		if _, err := rand.Read(b[16:]); err != nil {
+			return false
+		}
+		a.SetBytes(&b)
+	}
+	return true
+}
+
+// multiScalarMult computes sum k_i*P_i with 4-bit windows (Strauss)
+// so that the doublings are shared by all the points. Points need
+// to be normalized.
+func multiScalarMult(scalars []btcec.ModNScalar, points []btcec.JacobianPoint, result *btcec.JacobianPoint) {
+	// tables[i][j] = (j+1)*P_i in affine coordinates
+	// so that the additions are cheaper
+	tables := make([][15]btcec.JacobianPoint, len(points))
+	for i := range points {
+		tables[i][0].Set(&points[i])
+		btcec.DoubleNonConst(&points[i], &tables[i][1])
+		for j := 2; j < 15; j++ {
+			btcec.AddNonConst(&tables[i][j-1], &points[i], &tables[i][j])
+		}
+	}
+	toAffine(tables)
+
+	scalarBytes := make([][32]byte, len(scalars))
+	for i := range scalars {
+		scalarBytes[i] = scalars[i].Bytes()
+	}
+
+	var acc, tmp btcec.JacobianPoint
+	for byteIdx := 0; byteIdx < 32; byteIdx++ {
+		for _, shift := range []uint{4, 0} {
+			for range 4 {
+				btcec.DoubleNonConst(&acc, &tmp)
+				acc.Set(&tmp)
+			}
+			for i := range scalarBytes {
+				if window := (scalarBytes[i][byteIdx] >> shift) & 0x0f; window > 0 {
+					btcec.AddNonConst(&acc, &tables[i][window-1], &tmp)
+					acc.Set(&tmp)
+				}
+			}
+		}
+	}
+	result.Set(&acc)
+}
+
+// toAffine converts the points to affine coordinates with a single
+// field inversion (Montgomery's trick). Points can not be infinity.
+func toAffine(tables [][15]btcec.JacobianPoint) {
+	n := len(tables) * 15
+	point := func(i int) *btcec.JacobianPoint {
+		return &tables[i/15][i%15]
+	}
+
+	// products[i] = Z_0 * ... * Z_i
+	products := make([]btcec.FieldVal, n)
+	products[0].Set(&point(0).Z)
+	for i := 1; i < n; i++ {
+		products[i].Mul2(&products[i-1], &point(i).Z).Normalize()
+	}
+	var inv btcec.FieldVal
+	inv.Set(&products[n-1]).Inverse()
+
+	for i := n - 1; i >= 0; i-- {
+		p := point(i)
+		// zInv = 1/Z_i
+		var zInv, zInv2, zInv3 btcec.FieldVal
+		if i > 0 {
+			zInv.Mul2(&inv, &products[i-1])
+			inv.Mul(&p.Z)
+		} else {
+			zInv.Set(&inv)
+		}
+		zInv2.SquareVal(&zInv)
+		zInv3.Mul2(&zInv2, &zInv)
+		p.X.Mul(&zInv2).Normalize()
+		p.Y.Mul(&zInv3).Normalize()
+		p.Z.SetInt(1)
+	}
+}
@@ -0,0 +1,232 @@
+package nut11
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+)
+
+func randomHash() []byte {
+	var b [32]byte
+	rand.Read(b[:])
+	hash := sha256.Sum256(b[:])
+	return hash[:]
+}
+
+func sign(t testing.TB, key *btcec.PrivateKey, hash []byte) string {
+	sig, err := schnorr.Sign(key, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(sig.Serialize())
+}
+
+func generateKeys(n int) []*btcec.PrivateKey {
+	keys := make([]*btcec.PrivateKey, n)
+	for i := range keys {
+		keys[i], _ = btcec.NewPrivateKey()
+	}
+	return keys
+}
+
+func TestSignatureBatch(t *testing.T) {
+	var empty SignatureBatch
+	if !empty.Verify() {
+		t.Fatal("expected empty batch to be valid")
+	}
+
+	keys := generateKeys(5)
+	hashes := make([][]byte, 20)
+	signatures := make([]string, 20)
+	for i := range hashes {
+		hashes[i] = randomHash()
+		signatures[i] = sign(t, keys[i%len(keys)], hashes[i])
+	}
+	newBatch := func(signatures []string, keys []*btcec.PrivateKey) *SignatureBatch {
+		var batch SignatureBatch
+		for i := range signatures {
+			batch.Add(hashes[i], signatures[i], keys[i%len(keys)].PubKey())
+		}
+		return &batch
+	}
+
+	for _, n := range []int{1, 2, 20} {
+		if !newBatch(signatures[:n], keys).Verify() {
+			t.Fatalf("expected batch of %v valid signatures to be valid", n)
+		}
+	}
+
+	// signature of another message
+	invalidSignatures := append([]string{}, signatures...)
+	invalidSignatures[7] = sign(t, keys[7%len(keys)], randomHash())
+	if newBatch(invalidSignatures, keys).Verify() {
+		t.Fatal("expected batch with invalid signature to be invalid")
+	}
+
+	// signatures from different keys
+	otherKeys := append(generateKeys(1), keys[1:]...)
+	if newBatch(signatures, otherKeys).Verify() {
+		t.Fatal("expected batch with wrong pubkey to be invalid")
+	}
+
+	invalidSignatures = append([]string{}, signatures...)
+	invalidSignatures[3] = "notasignature"
+	if newBatch(invalidSignatures, keys).Verify() {
+		t.Fatal("expected batch with invalid signature encoding to be invalid")
+	}
+}
+
+func TestHasValidSignaturesForAll(t *testing.T) {
+	keys := generateKeys(3)
+	pubkeys := make([]*btcec.PublicKey, len(keys))
+	for i, key := range keys {
+		pubkeys[i] = key.PubKey()
+	}
+
+	// 2-of-3 multisig signed with the second and third keys
+	newSignatures := func(n int) ([][]byte, [][]string) {
+		hashes := make([][]byte, n)
+		signatures := make([][]string, n)
+		for i := range hashes {
+			hashes[i] = randomHash()
+			signatures[i] = []string{sign(t, keys[1], hashes[i]), sign(t, keys[2], hashes[i])}
+		}
+		return hashes, signatures
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(hashes [][]byte, signatures [][]string)
+		expected bool
+	}{
+		{
+			name:     "valid",
+			modify:   func(hashes [][]byte, signatures [][]string) {},
+			expected: true,
+		},
+		{
+			name: "signatures in different order",
+			modify: func(hashes [][]byte, signatures [][]string) {
+				signatures[5][0], signatures[5][1] = signatures[5][1], signatures[5][0]
+			},
+			expected: true,
+		},
+		{
+			name: "extra signature",
+			modify: func(hashes [][]byte, signatures [][]string) {
+				signatures[3] = append(signatures[3], sign(t, keys[0], hashes[3]))
+			},
+			expected: true,
+		},
+		{
+			name: "not enough signatures in first message",
+			modify: func(hashes [][]byte, signatures [][]string) {
+				signatures[0] = signatures[0][:1]
+			},
+			expected: false,
+		},
+		{
+			name: "not enough signatures",
+			modify: func(hashes [][]byte, signatures [][]string) {
+				signatures[8] = signatures[8][:1]
+			},
+			expected: false,
+		},
+		{
+			name: "invalid signature",
+			modify: func(hashes [][]byte, signatures [][]string) {
+				signatures[4][1] = sign(t, keys[2], randomHash())
+			},
+			expected: false,
+		},
+		{
+			name: "signature from key not in the list",
+			modify: func(hashes [][]byte, signatures [][]string) {
+				signatures[6][0] = sign(t, generateKeys(1)[0], hashes[6])
+			},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			hashes, signatures := newSignatures(10)
+			test.modify(hashes, signatures)
+			if valid := HasValidSignaturesForAll(hashes, signatures, 2, pubkeys); valid != test.expected {
+				t.Fatalf("expected '%v' but got '%v'", test.expected, valid)
+			}
+		})
+	}
+}
+
+func BenchmarkSignatureBatch(b *testing.B) {
+	for _, n := range []int{2, 10, 100} {
+		keys := generateKeys(n)
+		hashes := make([][]byte, n)
+		signatures := make([]string, n)
+		for i := range hashes {
+			hashes[i] = randomHash()
+			signatures[i] = sign(b, keys[i], hashes[i])
+		}
+
+		b.Run(fmt.Sprintf("one-by-one/%v", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for j := range signatures {
+					if !HasValidSignatures(hashes[j], signatures[j:j+1], 1, []*btcec.PublicKey{keys[j].PubKey()}) {
+						b.Fatal("invalid signature")
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("batch/%v", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var batch SignatureBatch
+				for j := range signatures {
+					batch.Add(hashes[j], signatures[j], keys[j].PubKey())
+				}
+				if !batch.Verify() {
+					b.Fatal("invalid batch")
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkHasValidSignaturesForAll(b *testing.B) {
+	// 3-of-3 multisig for a SIG_ALL swap with 50 outputs
+	keys := generateKeys(3)
+	pubkeys := make([]*btcec.PublicKey, len(keys))
+	for i, key := range keys {
+		pubkeys[i] = key.PubKey()
+	}
+	hashes := make([][]byte, 50)
+	signatures := make([][]string, 50)
+	for i := range hashes {
+		hashes[i] = randomHash()
+		for _, key := range keys {
+			signatures[i] = append(signatures[i], sign(b, key, hashes[i]))
+		}
+	}
+
+	b.Run("one-by-one", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := range hashes {
+				if !HasValidSignatures(hashes[j], signatures[j], len(keys), pubkeys) {
+					b.Fatal("invalid signatures")
+				}
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if !HasValidSignaturesForAll(hashes, signatures, len(keys), pubkeys) {
+				b.Fatal("invalid signatures")
+			}
+		}
+	})
+}
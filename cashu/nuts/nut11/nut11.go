@@ -38,6 +38,8 @@ var (
 	NSigsMustBePositiveErr   = cashu.Error{Detail: "n_sigs must be a positive integer", Code: NUT11ErrCode}
 	EmptyPubkeysErr          = cashu.Error{Detail: "pubkeys tag cannot be empty if n_sigs tag is present", Code: NUT11ErrCode}
 	InvalidWitness           = cashu.Error{Detail: "invalid witness", Code: NUT11ErrCode}
+	WitnessTooLargeErr       = cashu.Error{Detail: "witness too large", Code: NUT11ErrCode}
+	TooManySignaturesErr     = cashu.Error{Detail: "too many signatures in witness", Code: NUT11ErrCode}
 	InvalidKindErr           = cashu.Error{Detail: "invalid kind in secret", Code: NUT11ErrCode}
 	DuplicateSignaturesErr   = cashu.Error{Detail: "witness has duplicate signatures", Code: NUT11ErrCode}
 	NotEnoughSignaturesErr   = cashu.Error{Detail: "not enough valid signatures provided", Code: NUT11ErrCode}
@@ -317,6 +319,74 @@ func HasValidSignatures(hash []byte, signatures []string, Nsigs int, pubkeys []*
 	return validSignatures >= Nsigs
 }
 
+// HasValidSignaturesForAll checks that each hash has at least Nsigs valid signatures
+// from the pubkeys, as HasValidSignatures does for one. The signatures of the
+// first hash are matched to their pubkeys and the signatures in the same position
+// for the rest of the hashes are checked with the same pubkeys in a batch.
+// If that fails (i.e signatures were added in a different order), each hash
+// is checked on its own.
+func HasValidSignaturesForAll(hashes [][]byte, signatures [][]string, Nsigs int, pubkeys []*btcec.PublicKey) bool {
+	if len(hashes) == 0 || len(hashes) != len(signatures) {
+		return len(hashes) == len(signatures)
+	}
+
+	signers := matchSigners(hashes[0], signatures[0], pubkeys)
+	signersCount := 0
+	for _, signer := range signers {
+		if signer >= 0 {
+			signersCount++
+		}
+	}
+	if signersCount < Nsigs {
+		return false
+	}
+
+	var batch SignatureBatch
+	for i := 1; i < len(hashes); i++ {
+		if len(signatures[i]) != len(signers) {
+			batch.invalid = true
+			break
+		}
+		for j, signer := range signers {
+			if signer >= 0 {
+				batch.Add(hashes[i], signatures[i][j], pubkeys[signer])
+			}
+		}
+	}
+	if batch.Verify() {
+		return true
+	}
+
+	for i := 1; i < len(hashes); i++ {
+		if !HasValidSignatures(hashes[i], signatures[i], Nsigs, pubkeys) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSigners returns the index of the pubkey that made each
+// signature or -1 if the signature is not valid for any of them
+func matchSigners(hash []byte, signatures []string, pubkeys []*btcec.PublicKey) []int {
+	signers := make([]int, len(signatures))
+	used := make([]bool, len(pubkeys))
+	for i, signature := range signatures {
+		signers[i] = -1
+		sig, err := ParseSignature(signature)
+		if err != nil {
+			continue
+		}
+		for j, pubkey := range pubkeys {
+			if !used[j] && sig.Verify(hash, pubkey) {
+				signers[i] = j
+				used[j] = true
+				break
+			}
+		}
+	}
+	return signers
+}
+
 func ParsePublicKey(key string) (*btcec.PublicKey, error) {
 	hexPubkey, err := hex.DecodeString(key)
 	if err != nil {
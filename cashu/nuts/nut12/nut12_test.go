@@ -45,3 +45,53 @@ func TestVerifyProofDLEQ(t *testing.T) {
 		t.Errorf("DLEQ verification on proof failed")
 	}
 }
+
+// the proof of the NUT-12 vector has to keep its DLEQ
+// through the encoding and decoding of tokens
+func TestProofDLEQTokenRoundTrip(t *testing.T) {
+	Ahex, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	A, _ := secp256k1.ParsePubKey(Ahex)
+
+	proof := cashu.Proof{
+		Amount: 1,
+		Id:     "00882760bfa2eb41",
+		Secret: "daf4dd00a2b68a0858a80450f52c8a7d2ccf87d375e43e216e0c571f089f63e9",
+		C:      "024369d2d22a80ecf78f3937da9d5f30c1b9f74f0c32684d583cca0fa6a61cdcfc",
+		DLEQ: &cashu.DLEQProof{
+			E: "b31e58ac6527f34975ffab13e70a48b6d2b0d35abc4b03f0151f09ee1a9763d4",
+			S: "8fbae004c59e754d71df67e392b6ae4e29293113ddc2ec86592a0431d16306d8",
+			R: "a6d13fcd7a18442e6076f5e1e7c887ad5de40a019824bdfa9fe740d302e8d861",
+		},
+	}
+
+	tokenV4, err := cashu.NewTokenV4(cashu.Proofs{proof}, "http://localhost:3338", cashu.Sat, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating token: %v", err)
+	}
+	tokenV3, err := cashu.NewTokenV3(cashu.Proofs{proof}, "http://localhost:3338", cashu.Sat, true)
+	if err != nil {
+		t.Fatalf("unexpected error creating token: %v", err)
+	}
+
+	for _, token := range []cashu.Token{tokenV4, tokenV3} {
+		serialized, err := token.Serialize()
+		if err != nil {
+			t.Fatalf("unexpected error serializing token: %v", err)
+		}
+		decoded, err := cashu.DecodeToken(serialized)
+		if err != nil {
+			t.Fatalf("unexpected error decoding token: %v", err)
+		}
+
+		proofs := decoded.Proofs()
+		if len(proofs) != 1 || proofs[0].DLEQ == nil {
+			t.Fatalf("expected proof with DLEQ in token '%v'", serialized)
+		}
+		if *proofs[0].DLEQ != *proof.DLEQ {
+			t.Fatalf("expected DLEQ '%+v' but got '%+v'", *proof.DLEQ, *proofs[0].DLEQ)
+		}
+		if !VerifyProofDLEQ(proofs[0], A) {
+			t.Fatalf("DLEQ verification on proof from token '%v' failed", serialized)
+		}
+	}
+}
@@ -2,10 +2,14 @@ package nut13
 
 import (
 	"encoding/hex"
+	"errors"
 	"testing"
 
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
 	"github.com/tyler-smith/go-bip39"
 )
 
@@ -72,3 +76,126 @@ func TestSecretDerivation(t *testing.T) {
 	}
 
 }
+
+func TestScan(t *testing.T) {
+	seed := bip39.NewSeed("half depart obvious quality work element tank gorilla view sugar picture humble", "")
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mintMaster, _ := hdkeychain.NewMaster(make([]byte, 32), &chaincfg.MainNetParams)
+	keyset, err := crypto.GenerateKeyset(mintMaster, 0, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+	keys := make(map[uint64]*secp256k1.PublicKey)
+	for amount, key := range keyset.Keys {
+		keys[amount] = key.PublicKey
+	}
+
+	keysetPath, err := DeriveKeysetPath(master, keyset.Id)
+	if err != nil {
+		t.Fatalf("could not derive keyset path: %v", err)
+	}
+	// outputs the mint signed before
+	signedCounters := map[uint32]bool{2: true, 5: true, 25: true}
+	signed := make(map[string]bool)
+	for counter := range signedCounters {
+		derived, err := DeriveOutputs(keysetPath, keyset.Id, counter, 1)
+		if err != nil {
+			t.Fatalf("error deriving outputs: %v", err)
+		}
+		signed[derived[0].Output.B_] = true
+	}
+
+	restoreCalls := 0
+	restore := func(outputs cashu.BlindedMessages) (cashu.BlindedMessages, cashu.BlindedSignatures, error) {
+		restoreCalls++
+		var signedOutputs cashu.BlindedMessages
+		var signatures cashu.BlindedSignatures
+		for _, output := range outputs {
+			if !signed[output.B_] {
+				continue
+			}
+			B_bytes, _ := hex.DecodeString(output.B_)
+			B_, _ := secp256k1.ParsePubKey(B_bytes)
+			C_ := crypto.SignBlindedMessage(B_, keyset.Keys[8].PrivateKey)
+			signedOutputs = append(signedOutputs, output)
+			signatures = append(signatures, cashu.BlindedSignature{
+				Amount: 8,
+				Id:     keyset.Id,
+				C_:     hex.EncodeToString(C_.SerializeCompressed()),
+			})
+		}
+		return signedOutputs, signatures, nil
+	}
+
+	batches := 0
+	result, err := Scan(master, keyset.Id, keys, restore, ScanConfig{
+		BatchSize: 10,
+		GapLimit:  2,
+		OnBatch: func(proofs []RestoredProof) error {
+			batches++
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error scanning: %v", err)
+	}
+
+	if len(result.Proofs) != len(signedCounters) {
+		t.Fatalf("expected %v proofs but got %v", len(signedCounters), len(result.Proofs))
+	}
+	for _, restored := range result.Proofs {
+		if !signedCounters[restored.Counter] {
+			t.Fatalf("unexpected proof restored for counter %v", restored.Counter)
+		}
+		C, _ := hex.DecodeString(restored.Proof.C)
+		Cpoint, _ := secp256k1.ParsePubKey(C)
+		if !crypto.Verify(restored.Proof.Secret, keyset.Keys[8].PrivateKey, Cpoint) {
+			t.Fatalf("invalid proof restored for counter %v", restored.Counter)
+		}
+	}
+	if result.NextCounter != 26 {
+		t.Fatalf("expected next counter of 26 but got %v", result.NextCounter)
+	}
+	// batches 0-9 and 20-29 had signatures and scan stopped after 30-49 were empty
+	if batches != 2 {
+		t.Fatalf("expected 2 batches with signatures but got %v", batches)
+	}
+	if restoreCalls != 5 {
+		t.Fatalf("expected 5 restore requests but got %v", restoreCalls)
+	}
+
+	// interrupt a scan after the second batch and resume it
+	var lastProgress ScanProgress
+	errInterrupted := errors.New("interrupted")
+	_, err = Scan(master, keyset.Id, keys, restore, ScanConfig{
+		BatchSize: 10,
+		GapLimit:  2,
+		OnProgress: func(progress ScanProgress) error {
+			lastProgress = progress
+			if progress.Counter == 20 {
+				return errInterrupted
+			}
+			return nil
+		},
+	})
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("expected interrupted scan but got %v", err)
+	}
+	if lastProgress != (ScanProgress{Counter: 20, EmptyBatches: 1, NextCounter: 6}) {
+		t.Fatalf("unexpected progress of interrupted scan: %+v", lastProgress)
+	}
+
+	restoreCalls = 0
+	resumed, err := Scan(master, keyset.Id, keys, restore, ScanConfig{BatchSize: 10, GapLimit: 2, Resume: &lastProgress})
+	if err != nil {
+		t.Fatalf("unexpected error resuming scan: %v", err)
+	}
+	if resumed.NextCounter != 26 || restoreCalls != 3 {
+		t.Fatalf("expected resumed scan to end at 26 after 3 requests but got %v after %v",
+			resumed.NextCounter, restoreCalls)
+	}
+}
@@ -0,0 +1,227 @@
+package nut13
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+)
+
+const (
+	DefaultBatchSize = 100
+	// number of consecutive batches without signatures after which a scan stops
+	DefaultGapLimit = 3
+)
+
+// DerivedOutput is a blinded message derived from a counter
+// with the secret and blinding factor to unblind its signature.
+type DerivedOutput struct {
+	Counter uint32
+	Secret  string
+	R       *secp256k1.PrivateKey
+	Output  cashu.BlindedMessage
+}
+
+// RestoredProof is a proof from an output for which the mint
+// returned a signature and the counter it was derived from.
+type RestoredProof struct {
+	Counter uint32
+	Proof   cashu.Proof
+}
+
+// RestoreFunc sends the outputs to the restore endpoint of the mint (NUT-09).
+// It returns the outputs that had been signed and their signatures.
+type RestoreFunc func(outputs cashu.BlindedMessages) (cashu.BlindedMessages, cashu.BlindedSignatures, error)
+
+type ScanConfig struct {
+	// counter from which to start the scan
+	StartCounter uint32
+	// DefaultBatchSize and DefaultGapLimit if not set
+	BatchSize int
+	GapLimit  int
+	// OnBatch is called with the proofs restored in each batch that had signatures.
+	// The scan stops if it returns an error. Optional.
+	OnBatch func(proofs []RestoredProof) error
+	// OnProgress is called after each batch with how far the scan got so that
+	// it can be saved and resumed later. The scan stops if it returns an error.
+	// Optional.
+	OnProgress func(progress ScanProgress) error
+	// Resume continues an interrupted scan from its last progress
+	// instead of starting at StartCounter. Optional.
+	Resume *ScanProgress
+}
+
+// ScanProgress is the state of a scan after a batch
+type ScanProgress struct {
+	// counter of the next batch to scan
+	Counter uint32
+	// consecutive batches without signatures before Counter
+	EmptyBatches int
+	// one after the highest counter with a signature found so far
+	NextCounter uint32
+}
+
+type ScanResult struct {
+	Proofs []RestoredProof
+	// counter the wallet should use next for the keyset. It is one after
+	// the highest counter with a signature or StartCounter if none was found.
+	NextCounter uint32
+}
+
+// DeriveOutputs derives count outputs for the keyset starting at counter.
+// Amounts of the outputs are not set since they are only used to restore.
+func DeriveOutputs(keysetPath *hdkeychain.ExtendedKey, keysetId string, counter uint32, count int) ([]DerivedOutput, error) {
+	outputs := make([]DerivedOutput, count)
+	for i := range outputs {
+		secret, err := DeriveSecret(keysetPath, counter)
+		if err != nil {
+			return nil, err
+		}
+		r, err := DeriveBlindingFactor(keysetPath, counter)
+		if err != nil {
+			return nil, err
+		}
+		B_, r, err := crypto.BlindMessage(secret, r)
+		if err != nil {
+			return nil, err
+		}
+
+		outputs[i] = DerivedOutput{
+			Counter: counter,
+			Secret:  secret,
+			R:       r,
+			Output:  cashu.BlindedMessage{B_: hex.EncodeToString(B_.SerializeCompressed()), Id: keysetId},
+		}
+		counter++
+	}
+	return outputs, nil
+}
+
+// Scan derives batches of outputs for the keyset and asks the mint which ones
+// it had signed until GapLimit consecutive batches have no signatures.
+// keys are the public keys of the keyset used to unblind the signatures.
+func Scan(
+	master *hdkeychain.ExtendedKey,
+	keysetId string,
+	keys map[uint64]*secp256k1.PublicKey,
+	restore RestoreFunc,
+	config ScanConfig,
+) (ScanResult, error) {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultBatchSize
+	}
+	if config.GapLimit <= 0 {
+		config.GapLimit = DefaultGapLimit
+	}
+
+	keysetPath, err := DeriveKeysetPath(master, keysetId)
+	if err != nil {
+		return ScanResult{}, err
+	}
+
+	result := ScanResult{NextCounter: config.StartCounter}
+	counter := config.StartCounter
+	emptyBatches := 0
+	if config.Resume != nil {
+		result.NextCounter = config.Resume.NextCounter
+		counter = config.Resume.Counter
+		emptyBatches = config.Resume.EmptyBatches
+	}
+	for emptyBatches < config.GapLimit {
+		derived, err := DeriveOutputs(keysetPath, keysetId, counter, config.BatchSize)
+		if err != nil {
+			return ScanResult{}, err
+		}
+		counter += uint32(config.BatchSize)
+
+		batch, err := restoreBatch(derived, keys, restore)
+		if err != nil {
+			return ScanResult{}, err
+		}
+		if len(batch) == 0 {
+			emptyBatches++
+		} else {
+			emptyBatches = 0
+			for _, restored := range batch {
+				if restored.Counter+1 > result.NextCounter {
+					result.NextCounter = restored.Counter + 1
+				}
+			}
+			result.Proofs = append(result.Proofs, batch...)
+			if config.OnBatch != nil {
+				if err := config.OnBatch(batch); err != nil {
+					return ScanResult{}, err
+				}
+			}
+		}
+
+		if config.OnProgress != nil {
+			progress := ScanProgress{Counter: counter, EmptyBatches: emptyBatches, NextCounter: result.NextCounter}
+			if err := config.OnProgress(progress); err != nil {
+				return ScanResult{}, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// restoreBatch gets the signatures for the outputs and unblinds them
+func restoreBatch(
+	derived []DerivedOutput,
+	keys map[uint64]*secp256k1.PublicKey,
+	restore RestoreFunc,
+) ([]RestoredProof, error) {
+	outputs := make(cashu.BlindedMessages, len(derived))
+	byB_ := make(map[string]DerivedOutput, len(derived))
+	for i, output := range derived {
+		outputs[i] = output.Output
+		byB_[output.Output.B_] = output
+	}
+
+	signedOutputs, signatures, err := restore(outputs)
+	if err != nil {
+		return nil, err
+	}
+	if len(signedOutputs) != len(signatures) {
+		return nil, errors.New("number of outputs and signatures from mint do not match")
+	}
+
+	proofs := make([]RestoredProof, len(signatures))
+	for i, signature := range signatures {
+		// match signatures by the output since the mint only returns those signed
+		output, ok := byB_[signedOutputs[i].B_]
+		if !ok {
+			return nil, fmt.Errorf("mint returned signature for unknown output '%v'", signedOutputs[i].B_)
+		}
+		key, ok := keys[signature.Amount]
+		if !ok {
+			return nil, fmt.Errorf("key not found for amount %v", signature.Amount)
+		}
+
+		C_bytes, err := hex.DecodeString(signature.C_)
+		if err != nil {
+			return nil, err
+		}
+		C_, err := secp256k1.ParsePubKey(C_bytes)
+		if err != nil {
+			return nil, err
+		}
+		C := crypto.UnblindSignature(C_, output.R, key)
+
+		proofs[i] = RestoredProof{
+			Counter: output.Counter,
+			Proof: cashu.Proof{
+				Amount: signature.Amount,
+				Secret: output.Secret,
+				C:      hex.EncodeToString(C.SerializeCompressed()),
+				Id:     signature.Id,
+			},
+		}
+	}
+	return proofs, nil
+}
@@ -0,0 +1,106 @@
+// Package nut17 contains structs as defined in [NUT-17]
+//
+// [NUT-17]: https://github.com/cashubtc/nuts/blob/main/17.md
+package nut17
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/elnosh/gonuts/cashu/nuts/nut06"
+)
+
+type SubscriptionKind string
+
+const (
+	Bolt11MintQuote SubscriptionKind = "bolt11_mint_quote"
+	Bolt11MeltQuote SubscriptionKind = "bolt11_melt_quote"
+	ProofState      SubscriptionKind = "proof_state"
+
+	JSONRPC     = "2.0"
+	Subscribe   = "subscribe"
+	Unsubscribe = "unsubscribe"
+)
+
+type WsRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	Method  string        `json:"method"`
+	Params  RequestParams `json:"params"`
+	Id      int           `json:"id"`
+}
+
+type RequestParams struct {
+	Kind    SubscriptionKind `json:"kind,omitempty"`
+	SubId   string           `json:"subId"`
+	Filters []string         `json:"filters,omitempty"`
+}
+
+type WsResponse struct {
+	JSONRPC string         `json:"jsonrpc"`
+	Result  *Result        `json:"result,omitempty"`
+	Error   *ResponseError `json:"error,omitempty"`
+	Id      int            `json:"id"`
+}
+
+type Result struct {
+	Status string `json:"status"`
+	SubId  string `json:"subId"`
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e ResponseError) Error() string {
+	return fmt.Sprintf("%v (code %v)", e.Message, e.Code)
+}
+
+// WsNotification is sent by the mint when the state of
+// one of the filters in a subscription changes. The payload is a
+// mint quote, melt quote or proof state depending on the kind.
+type WsNotification struct {
+	JSONRPC string             `json:"jsonrpc"`
+	Method  string             `json:"method"`
+	Params  NotificationParams `json:"params"`
+}
+
+type NotificationParams struct {
+	SubId   string          `json:"subId"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type Settings struct {
+	Supported []SupportedMethod `json:"supported"`
+}
+
+type SupportedMethod struct {
+	Method   string             `json:"method"`
+	Unit     string             `json:"unit"`
+	Commands []SubscriptionKind `json:"commands"`
+}
+
+// SupportedKinds returns the kinds of subscriptions the mint
+// supports for the method and unit. None if it does not support NUT-17.
+func SupportedKinds(info nut06.MintInfo, method, unit string) []SubscriptionKind {
+	// nuts in the info are decoded without a type
+	setting, ok := info.Nuts[17]
+	if !ok {
+		return nil
+	}
+	jsonSetting, err := json.Marshal(setting)
+	if err != nil {
+		return nil
+	}
+	var settings Settings
+	if err := json.Unmarshal(jsonSetting, &settings); err != nil {
+		return nil
+	}
+
+	for _, supported := range settings.Supported {
+		if supported.Method == method && supported.Unit == unit {
+			return supported.Commands
+		}
+	}
+	return nil
+}
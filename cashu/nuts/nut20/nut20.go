@@ -0,0 +1,82 @@
+// Package nut20 contains the signing of mint requests as defined in [NUT-20]
+//
+// [NUT-20]: https://github.com/cashubtc/nuts/blob/main/20.md
+package nut20
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/elnosh/gonuts/cashu"
+)
+
+const (
+	InvalidSignatureErrCode cashu.CashuErrCode = 20008
+	PubkeyRequiredErrCode   cashu.CashuErrCode = 20009
+)
+
+// NUT-20 specific errors
+var (
+	InvalidSignatureErr = cashu.Error{Detail: "mint quote with pubkey but no valid signature provided", Code: InvalidSignatureErrCode}
+	InvalidPubkeyErr    = cashu.Error{Detail: "invalid pubkey in mint quote request", Code: cashu.StandardErrCode}
+	PubkeyRequiredErr   = cashu.Error{Detail: "pubkey required for mint quote", Code: PubkeyRequiredErrCode}
+)
+
+// Settings advertised in the mint info. If PubkeyRequiredAbove is set,
+// mint quotes for a greater amount need a pubkey.
+type Settings struct {
+	Supported           bool   `json:"supported"`
+	PubkeyRequiredAbove uint64 `json:"pubkey_required_above,omitempty"`
+}
+
+// msgHash is the hash of the quote id followed by the B_ of the outputs
+func msgHash(quoteId string, outputs cashu.BlindedMessages) [32]byte {
+	var msg strings.Builder
+	msg.WriteString(quoteId)
+	for _, output := range outputs {
+		msg.WriteString(output.B_)
+	}
+	return sha256.Sum256([]byte(msg.String()))
+}
+
+// SignMintRequest returns the hex encoded signature of the mint request
+// for the quote with the key whose pubkey was in the quote request
+func SignMintRequest(quoteId string, outputs cashu.BlindedMessages, key *btcec.PrivateKey) (string, error) {
+	hash := msgHash(quoteId, outputs)
+	signature, err := schnorr.Sign(key, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(signature.Serialize()), nil
+}
+
+// VerifyMintRequest checks that the signature of the mint request
+// is valid for the pubkey of the quote
+func VerifyMintRequest(quoteId string, outputs cashu.BlindedMessages, signature string, pubkey *btcec.PublicKey) bool {
+	sigBytes, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return false
+	}
+	hash := msgHash(quoteId, outputs)
+	return sig.Verify(hash[:], pubkey)
+}
+
+// ParsePubkey parses the hex encoded compressed pubkey of a mint quote request
+func ParsePubkey(pubkey string) (*btcec.PublicKey, error) {
+	pubkeyBytes, err := hex.DecodeString(pubkey)
+	if err != nil || len(pubkeyBytes) != btcec.PubKeyBytesLenCompressed {
+		return nil, InvalidPubkeyErr
+	}
+	key, err := btcec.ParsePubKey(pubkeyBytes)
+	if err != nil {
+		return nil, InvalidPubkeyErr
+	}
+	return key, nil
+}
@@ -0,0 +1,99 @@
+package nut20
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/elnosh/gonuts/cashu"
+)
+
+func TestSignMintRequest(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	otherKey, _ := btcec.NewPrivateKey()
+	quoteId := "9d745270-1405-46de-b5c5-e2762b4f5e00"
+	outputs := cashu.BlindedMessages{
+		{Amount: 1, Id: "00456a94ab4e1c46", B_: "0342e5bcc77f5b2a3c2afb40bb591a1e27da83cddc968abdc0ec4904201a201834"},
+		{Amount: 1, Id: "00456a94ab4e1c46", B_: "032fd3c4dc49a2844a89998d5e9d5b0f0b00dde9310063acb8a92e2fdafa4126d4"},
+	}
+
+	signature, err := SignMintRequest(quoteId, outputs, key)
+	if err != nil {
+		t.Fatalf("unexpected error signing request: %v", err)
+	}
+	if !VerifyMintRequest(quoteId, outputs, signature, key.PubKey()) {
+		t.Fatal("expected valid signature")
+	}
+
+	tests := []struct {
+		name      string
+		quoteId   string
+		outputs   cashu.BlindedMessages
+		signature string
+		pubkey    *btcec.PublicKey
+	}{
+		{"other quote", "other", outputs, signature, key.PubKey()},
+		{"other outputs", quoteId, outputs[:1], signature, key.PubKey()},
+		{"other pubkey", quoteId, outputs, signature, otherKey.PubKey()},
+		{"invalid signature", quoteId, outputs, "abcd", key.PubKey()},
+		{"no signature", quoteId, outputs, "", key.PubKey()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if VerifyMintRequest(test.quoteId, test.outputs, test.signature, test.pubkey) {
+				t.Fatal("expected invalid signature")
+			}
+		})
+	}
+}
+
+func TestParsePubkey(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	pubkey := hex.EncodeToString(key.PubKey().SerializeCompressed())
+	parsed, err := ParsePubkey(pubkey)
+	if err != nil {
+		t.Fatalf("unexpected error parsing pubkey: %v", err)
+	}
+	if !parsed.IsEqual(key.PubKey()) {
+		t.Fatal("parsed pubkey does not match")
+	}
+
+	uncompressed := hex.EncodeToString(key.PubKey().SerializeUncompressed())
+	for _, invalid := range []string{"", "zz", pubkey[:20], uncompressed} {
+		if _, err := ParsePubkey(invalid); err != InvalidPubkeyErr {
+			t.Fatalf("expected error '%v' for pubkey '%v' but got '%v'", InvalidPubkeyErr, invalid, err)
+		}
+	}
+}
+
+// vector from the NUT-20 spec
+func TestMintRequestVector(t *testing.T) {
+	quoteId := "9d745270-1405-46de-b5c5-e2762b4f5e00"
+	outputs := cashu.BlindedMessages{
+		{Amount: 1, Id: "00456a94ab4e1c46", B_: "0342e5bcc77f5b2a3c2afb40bb591a1e27da83cddc968abdc0ec4904201a201834"},
+		{Amount: 1, Id: "00456a94ab4e1c46", B_: "032fd3c4dc49a2844a89998d5e9d5b0f0b00dde9310063acb8a92e2fdafa4126d4"},
+		{Amount: 1, Id: "00456a94ab4e1c46", B_: "033b6fde50b6a0dfe61ad148fff167ad9cf8308ded5f6f6b2fe000a036c464c311"},
+		{Amount: 1, Id: "00456a94ab4e1c46", B_: "02be5a55f03e5c0aaea77595d574bce92c6d57a2a0fb2b5955c0b87e4520e06b53"},
+		{Amount: 1, Id: "00456a94ab4e1c46", B_: "02209fc2873f28521cbdde7f7b3bb1521002463f5979686fd156f23fe6a8aa2b79"},
+	}
+	pubkey, err := ParsePubkey("03d56ce4e446a85bbdaa547b4ec2b073d40ff802831352b8272b7dd7a4de5a7cac")
+	if err != nil {
+		t.Fatalf("unexpected error parsing pubkey: %v", err)
+	}
+	signature := "d4b386f21f7aa7172f0994ee6e4dd966539484247ea71c99b81b8e09b1bb2acbc0026a43c221fd773471dc30d6a32b04692e6837ddaccf0830a63128308e4ee0"
+
+	expectedHash := "56b0ae5673e16308add75b19a6af8a747c8d3dfc24850fd838425792a22c99dc"
+	hash := msgHash(quoteId, outputs)
+	if hex.EncodeToString(hash[:]) != expectedHash {
+		t.Fatalf("expected message hash '%v' but got '%x'", expectedHash, hash)
+	}
+
+	if !VerifyMintRequest(quoteId, outputs, signature, pubkey) {
+		t.Fatal("expected valid signature")
+	}
+	// order of the outputs is part of the message
+	reversed := cashu.BlindedMessages{outputs[4], outputs[3], outputs[2], outputs[1], outputs[0]}
+	if VerifyMintRequest(quoteId, reversed, signature, pubkey) {
+		t.Fatal("expected invalid signature for outputs in other order")
+	}
+}
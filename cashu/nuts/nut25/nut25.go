@@ -0,0 +1,58 @@
+// Package nut25 contains structs as defined in [NUT-25] to mint
+// and melt with BOLT12 offers. Offers can be paid more than once,
+// so the amount that can be minted from a quote is what has been
+// paid to the offer minus what has already been issued.
+//
+// [NUT-25]: https://github.com/cashubtc/nuts/blob/main/25.md
+package nut25
+
+import (
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+)
+
+type PostMintQuoteBolt12Request struct {
+	// amount of the offer. Offers for any amount if 0
+	Amount      uint64 `json:"amount,omitempty"`
+	Unit        string `json:"unit"`
+	Description string `json:"description,omitempty"`
+	// NUT-20 pubkey that has to sign the mint requests. It is
+	// required since anyone that sees the offer could pay it.
+	Pubkey string `json:"pubkey"`
+}
+
+type PostMintQuoteBolt12Response struct {
+	Quote string `json:"quote"`
+	// the BOLT12 offer (lno1...)
+	Request string `json:"request"`
+	Amount  uint64 `json:"amount,omitempty"`
+	Unit    string `json:"unit"`
+	// unix time the offer expires. 0 if it does not expire
+	Expiry       uint64 `json:"expiry,omitempty"`
+	Pubkey       string `json:"pubkey"`
+	AmountPaid   uint64 `json:"amount_paid"`
+	AmountIssued uint64 `json:"amount_issued"`
+}
+
+// Mintable returns the amount that can be minted from the quote
+func (quote PostMintQuoteBolt12Response) Mintable() uint64 {
+	if quote.AmountPaid < quote.AmountIssued {
+		return 0
+	}
+	return quote.AmountPaid - quote.AmountIssued
+}
+
+// PostMintBolt12Request has the same fields as the request to mint with BOLT11.
+// The signature is required since all BOLT12 quotes have a pubkey.
+type PostMintBolt12Request = nut04.PostMintBolt11Request
+
+type PostMintBolt12Response = nut04.PostMintBolt11Response
+
+// PostMeltQuoteBolt12Request has the same fields as the melt quote request
+// for BOLT11 with the offer (lno1...) as the request. The amount to pay to
+// offers for any amount is set with the amountless option.
+type PostMeltQuoteBolt12Request = nut05.PostMeltQuoteBolt11Request
+
+type PostMeltQuoteBolt12Response = nut05.PostMeltQuoteBolt11Response
+
+type PostMeltBolt12Request = nut05.PostMeltBolt11Request
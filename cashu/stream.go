@@ -0,0 +1,109 @@
+package cashu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxStreamItems is the default max number of elements
+// in an array read when decoding a stream.
+const DefaultMaxStreamItems = 10000
+
+var ErrTooManyItems = errors.New("too many items in request")
+
+// DecodeObjectStream reads a JSON object from the decoder and calls the handler
+// for each field that has one. Values of fields without a handler are skipped.
+func DecodeObjectStream(dec *json.Decoder, fields map[string]func(*json.Decoder) error) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '{' {
+		return fmt.Errorf("expected JSON object but got '%v'", token)
+	}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("expected object key but got '%v'", token)
+		}
+
+		if handler, ok := fields[key]; ok {
+			if err := handler(dec); err != nil {
+				return err
+			}
+		} else {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+		}
+	}
+
+	// closing '}'
+	_, err = dec.Token()
+	return err
+}
+
+// DecodeArrayStream decodes a JSON array from the decoder one element at a time
+// so that only one element is buffered. It returns ErrTooManyItems if the array
+// has more than maxItems elements. A null value is decoded as a nil slice.
+func DecodeArrayStream[T any](dec *json.Decoder, maxItems int) ([]T, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, nil
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, fmt.Errorf("expected JSON array but got '%v'", token)
+	}
+
+	items := []T{}
+	for dec.More() {
+		if len(items) >= maxItems {
+			return nil, ErrTooManyItems
+		}
+		var item T
+		if err := dec.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	// closing ']'
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// EncodeArrayStream writes the items as a JSON array encoding
+// one element at a time instead of the whole array at once.
+// Callers should pass a buffered writer.
+func EncodeArrayStream[T any](w io.Writer, items []T) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	// encoder adds a newline after each element which is valid whitespace
+	enc := json.NewEncoder(w)
+	for i, item := range items {
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
@@ -0,0 +1,177 @@
+package cashu
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testSwapRequest struct {
+	Inputs  Proofs          `json:"inputs"`
+	Outputs BlindedMessages `json:"outputs"`
+}
+
+func (r testSwapRequest) encodeStream(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(`{"inputs":`)
+	if err := EncodeArrayStream(bw, r.Inputs); err != nil {
+		return err
+	}
+	bw.WriteString(`,"outputs":`)
+	if err := EncodeArrayStream(bw, r.Outputs); err != nil {
+		return err
+	}
+	bw.WriteString("}")
+	return bw.Flush()
+}
+
+func (r *testSwapRequest) decodeStream(rd io.Reader, maxItems int) error {
+	return DecodeObjectStream(json.NewDecoder(rd), map[string]func(*json.Decoder) error{
+		"inputs": func(dec *json.Decoder) (err error) {
+			r.Inputs, err = DecodeArrayStream[Proof](dec, maxItems)
+			return
+		},
+		"outputs": func(dec *json.Decoder) (err error) {
+			r.Outputs, err = DecodeArrayStream[BlindedMessage](dec, maxItems)
+			return
+		},
+	})
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	request := generateSwapRequest(50)
+
+	var buf bytes.Buffer
+	if err := request.encodeStream(&buf); err != nil {
+		t.Fatalf("unexpected error encoding: %v", err)
+	}
+
+	expected, _ := json.Marshal(request)
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, buf.Bytes()); err != nil {
+		t.Fatalf("streamed encoding is not valid json: %v", err)
+	}
+	if !bytes.Equal(compacted.Bytes(), expected) {
+		t.Fatalf("streamed encoding does not match json.Marshal:\n%s\n%s", compacted.Bytes(), expected)
+	}
+
+	var decoded testSwapRequest
+	if err := decoded.decodeStream(&buf, DefaultMaxStreamItems); err != nil {
+		t.Fatalf("unexpected error decoding: %v", err)
+	}
+	if !reflect.DeepEqual(request, decoded) {
+		t.Fatal("decoded request does not match encoded one")
+	}
+}
+
+func TestDecodeStream(t *testing.T) {
+	tests := []struct {
+		body        string
+		maxItems    int
+		expected    testSwapRequest
+		expectedErr error
+	}{
+		{
+			body:     `{"unknown":{"a":[1,2]},"inputs":[{"amount":1,"id":"00","secret":"s","C":"c"}],"outputs":null}`,
+			maxItems: 10,
+			expected: testSwapRequest{Inputs: Proofs{{Amount: 1, Id: "00", Secret: "s", C: "c"}}},
+		},
+		{
+			body:        `{"inputs":[{"amount":1},{"amount":2},{"amount":4}]}`,
+			maxItems:    2,
+			expectedErr: ErrTooManyItems,
+		},
+		{
+			body:        ``,
+			maxItems:    2,
+			expectedErr: io.EOF,
+		},
+	}
+
+	for _, test := range tests {
+		var request testSwapRequest
+		err := request.decodeStream(strings.NewReader(test.body), test.maxItems)
+		if !errors.Is(err, test.expectedErr) {
+			t.Fatalf("expected error '%v' but got '%v'", test.expectedErr, err)
+		}
+		if err == nil && !reflect.DeepEqual(test.expected, request) {
+			t.Fatalf("expected request '%+v' but got '%+v'", test.expected, request)
+		}
+	}
+
+	invalid := []string{`[]`, `{"inputs":{}}`, `{"inputs":[{"amount":"1"}]}`, `{"inputs":[`}
+	for _, body := range invalid {
+		var request testSwapRequest
+		if err := request.decodeStream(strings.NewReader(body), 10); err == nil {
+			t.Fatalf("expected error decoding '%v' but got nil", body)
+		}
+	}
+}
+
+func generateSwapRequest(num int) testSwapRequest {
+	request := testSwapRequest{
+		Inputs:  make(Proofs, num),
+		Outputs: make(BlindedMessages, num),
+	}
+	for i := 0; i < num; i++ {
+		request.Inputs[i] = Proof{
+			Amount: 1 << (i % 20),
+			Id:     "009a1f293253e41e",
+			Secret: "407915bc212be61a77e3e6d2aeb4c727980bda51cd06a6afc29e2861768a7837" + strconv.Itoa(i),
+			C:      "02bc9097997d81afb2cc7346b5e4345a9346bd2a506eb7958598a72f0cf85163ea",
+		}
+		request.Outputs[i] = BlindedMessage{
+			Amount: 1 << (i % 20),
+			Id:     "009a1f293253e41e",
+			B_:     "02634a2c2b34bec9e8a4aba4361f6bf202d7fa2365379b0840afe249a7a9d71239",
+		}
+	}
+	return request
+}
+
+func BenchmarkEncodeSwapRequest(b *testing.B) {
+	request := generateSwapRequest(5000)
+
+	b.Run("marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			jsonRequest, _ := json.Marshal(request)
+			io.Copy(io.Discard, bytes.NewReader(jsonRequest))
+		}
+	})
+
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			request.encodeStream(io.Discard)
+		}
+	})
+}
+
+func BenchmarkDecodeSwapRequest(b *testing.B) {
+	request := generateSwapRequest(5000)
+	jsonRequest, _ := json.Marshal(request)
+
+	b.Run("unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var decoded testSwapRequest
+			body, _ := io.ReadAll(bytes.NewReader(jsonRequest))
+			json.Unmarshal(body, &decoded)
+		}
+	})
+
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var decoded testSwapRequest
+			decoded.decodeStream(bytes.NewReader(jsonRequest), DefaultMaxStreamItems)
+		}
+	})
+}
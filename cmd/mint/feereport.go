@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+
+	"github.com/elnosh/gonuts/mint"
+	"github.com/elnosh/gonuts/mint/lightning"
+)
+
+// runFeeReport prints the impact of a proposed fee change without applying it.
+// It loads the mint from the configured path but does not start the server.
+func runFeeReport(config mint.Config, args []string) int {
+	flags := flag.NewFlagSet("feereport", flag.ContinueOnError)
+	fee := flags.Uint("fee", 0, "proposed input fee in ppk")
+	rotate := flags.Bool("rotate", false, "apply proposed fee to a new keyset instead of the active one")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	// lightning backend is not used for the report
+	config.LightningClient = &lightning.FakeBackend{}
+	config.LogLevel = mint.Disable
+
+	m, err := mint.LoadMint(config)
+	if err != nil {
+		fmt.Printf("error loading mint: %v\n", err)
+		return 1
+	}
+
+	report, err := m.FeeChangeReport(*fee, *rotate)
+	if err != nil {
+		fmt.Printf("error building fee report: %v\n", err)
+		return 1
+	}
+
+	action := "change fee of active keyset"
+	if report.Rotate {
+		action = "rotate to new keyset"
+	}
+	fmt.Printf("Proposed: %v from %v to %v ppk\n\n", action, report.CurrentInputFeePpk, report.ProposedInputFeePpk)
+
+	for _, keyset := range report.Keysets {
+		status := "inactive"
+		if keyset.Active {
+			status = "active"
+		}
+		fmt.Printf("Keyset %v (%v, fee %v ppk): %v proofs, %v sats\n",
+			keyset.Id, status, keyset.InputFeePpk, keyset.OutstandingProofs, keyset.OutstandingAmount)
+
+		amounts := make([]uint64, 0, len(keyset.Denominations))
+		for amount := range keyset.Denominations {
+			amounts = append(amounts, amount)
+		}
+		slices.Sort(amounts)
+		for _, amount := range amounts {
+			fmt.Printf("    %v: %v\n", amount, keyset.Denominations[amount])
+		}
+	}
+
+	fmt.Printf("\nOutstanding: %v proofs, %v sats\n", report.OutstandingProofs, report.OutstandingAmount)
+	fmt.Printf("Estimated fee income at current fees: %v sats\n", report.CurrentFeeIncome)
+	fmt.Printf("Estimated fee income after change: %v sats\n", report.ProposedFeeIncome)
+	if report.Rotate {
+		fmt.Printf("Estimated swap churn: %v proofs, %v sats\n", report.SwapChurnProofs, report.SwapChurnAmount)
+	}
+
+	return 0
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/elnosh/gonuts/mint"
+	"github.com/elnosh/gonuts/mint/lightning"
+)
+
+// runFees prints the input fees collected by each keyset and the totals by unit.
+// It loads the mint from the configured path but does not start the server.
+func runFees(config mint.Config, args []string) int {
+	flags := flag.NewFlagSet("fees", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	// lightning backend is not used to read fees
+	config.LightningClient = &lightning.FakeBackend{}
+	config.LogLevel = mint.Disable
+
+	m, err := mint.LoadMint(config)
+	if err != nil {
+		fmt.Printf("error loading mint: %v\n", err)
+		return 1
+	}
+
+	revenue, err := m.FeeRevenue()
+	if err != nil {
+		fmt.Printf("error getting fee revenue: %v\n", err)
+		return 1
+	}
+
+	var units []string
+	totals := make(map[string]uint64)
+	for _, keyset := range revenue {
+		status := "inactive"
+		if keyset.Active {
+			status = "active"
+		}
+		fmt.Printf("Keyset %v (%v, %v, fee %v ppk): %v\n",
+			keyset.Id, keyset.Unit, status, keyset.InputFeePpk, keyset.Fees)
+
+		if _, ok := totals[keyset.Unit]; !ok {
+			units = append(units, keyset.Unit)
+		}
+		totals[keyset.Unit] += keyset.Fees
+	}
+
+	fmt.Println()
+	for _, unit := range units {
+		fmt.Printf("Total %v: %v\n", unit, totals[unit])
+	}
+
+	return 0
+}
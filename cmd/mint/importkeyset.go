@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/elnosh/gonuts/mint"
+	"github.com/elnosh/gonuts/mint/lightning"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// runImportKeyset imports a keyset generated by another mint implementation
+// as verify-only so that proofs issued with it can still be redeemed.
+func runImportKeyset(config mint.Config, args []string) int {
+	flags := flag.NewFlagSet("importkeyset", flag.ContinueOnError)
+	seedHex := flags.String("seed", "", "hex encoded BIP32 seed of the keyset")
+	mnemonic := flags.String("mnemonic", "", "BIP39 mnemonic from which the seed is derived (cdk)")
+	secret := flags.String("secret", "", "private key string used directly as seed (nutshell MINT_PRIVATE_KEY)")
+	path := flags.String("path", "", "derivation path of the keyset. i.e m/0'/0'/0'")
+	maxOrder := flags.Int("max-order", mint.DefaultImportMaxOrder, "number of keys in the keyset")
+	fee := flags.Uint("fee", 0, "input fee in ppk of the keyset")
+	id := flags.String("id", "", "id of the keyset in the other mint to check the derivation")
+	unit := flags.String("unit", "sat", "unit of the keyset")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	seed, err := importSeed(*seedHex, *mnemonic, *secret)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	if len(*path) == 0 {
+		fmt.Println("derivation path of the keyset is required")
+		return 1
+	}
+
+	// lightning backend is not used for the import
+	config.LightningClient = &lightning.FakeBackend{}
+	config.LogLevel = mint.Disable
+
+	m, err := mint.LoadMint(config)
+	if err != nil {
+		fmt.Printf("error loading mint: %v\n", err)
+		return 1
+	}
+
+	keyset, err := m.ImportKeyset(mint.KeysetImport{
+		Seed:           seed,
+		DerivationPath: *path,
+		MaxOrder:       *maxOrder,
+		InputFeePpk:    *fee,
+		Id:             *id,
+		Unit:           *unit,
+	})
+	if err != nil {
+		fmt.Printf("error importing keyset: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("imported verify-only keyset '%v' with %v keys\n", keyset.Id, len(keyset.Keys))
+	return 0
+}
+
+func importSeed(seedHex, mnemonic, secret string) ([]byte, error) {
+	set := 0
+	for _, s := range []string{seedHex, mnemonic, secret} {
+		if len(s) > 0 {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, errors.New("specify one of seed, mnemonic or secret")
+	}
+
+	switch {
+	case len(seedHex) > 0:
+		seed, err := hex.DecodeString(seedHex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid seed: %v", err)
+		}
+		return seed, nil
+	case len(mnemonic) > 0:
+		if !bip39.IsMnemonicValid(mnemonic) {
+			return nil, errors.New("invalid mnemonic")
+		}
+		return bip39.NewSeed(mnemonic, ""), nil
+	default:
+		return []byte(secret), nil
+	}
+}
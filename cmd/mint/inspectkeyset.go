@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/elnosh/gonuts/mint"
+)
+
+// runInspectKeyset prints the public keys of the keysets in the db and
+// verifies the stored ids against the ids recomputed from the keys.
+// It exits with an error if any id does not match.
+func runInspectKeyset(config mint.Config, args []string) int {
+	flags := flag.NewFlagSet("inspectkeyset", flag.ContinueOnError)
+	id := flags.String("id", "", "id of the keyset to inspect. All keysets if not set")
+	showKeys := flags.Bool("keys", false, "print the public keys of all keysets. Always printed if id is set")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	keysets, err := mint.InspectKeysets(config, *id)
+	if err != nil {
+		fmt.Printf("error inspecting keysets: %v\n", err)
+		return 1
+	}
+
+	mismatches := 0
+	for i, keyset := range keysets {
+		if i > 0 {
+			fmt.Println()
+		}
+		status := "inactive"
+		if keyset.Active {
+			status = "active"
+		}
+		if keyset.VerifyOnly {
+			status = "verify-only"
+		}
+		fmt.Printf("Keyset %v (%v, unit %v, fee %v ppk)\n", keyset.Id, status, keyset.Unit, keyset.InputFeePpk)
+		if keyset.VerifyOnly {
+			fmt.Printf("    derivation path: %v\n", keyset.DerivationPath)
+		} else {
+			fmt.Printf("    derivation path idx: %v\n", keyset.DerivationPathIdx)
+		}
+		fmt.Printf("    derived id: %v\n", keyset.DerivedId)
+		fmt.Printf("    derived legacy id: %v\n", keyset.DerivedLegacyId)
+		if keyset.Match() {
+			fmt.Println("    id: OK")
+		} else {
+			mismatches++
+			fmt.Println("    id: MISMATCH - stored id was not derived from the keys")
+		}
+
+		if len(*id) > 0 || *showKeys {
+			fmt.Printf("    keys (%v):\n", len(keyset.PublicKeys))
+			for _, amount := range keyset.Amounts() {
+				fmt.Printf("        %v: %v\n", amount, keyset.PublicKeys[amount])
+			}
+		}
+	}
+
+	if mismatches > 0 {
+		fmt.Printf("\n%v of %v keysets do not match their id\n", mismatches, len(keysets))
+		return 1
+	}
+	return 0
+}
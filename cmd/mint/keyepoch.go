@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/elnosh/gonuts/mint"
+	"github.com/elnosh/gonuts/mint/lightning"
+)
+
+// runKeyEpoch prints the signed statement of the keysets of the mint and the amounts
+// they issued and redeemed, or verifies the signature of a statement in a file.
+// It loads the mint from the configured path but does not start the server.
+func runKeyEpoch(config mint.Config, args []string) int {
+	flags := flag.NewFlagSet("keyepoch", flag.ContinueOnError)
+	out := flags.String("out", "", "file to write the statement to instead of printing it")
+	verify := flags.String("verify", "", "file with a statement to verify")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	if len(*verify) > 0 {
+		return verifyKeyEpoch(*verify)
+	}
+
+	// lightning backend is not used for the statement
+	config.LightningClient = &lightning.FakeBackend{}
+	config.LogLevel = mint.Disable
+
+	m, err := mint.LoadMint(config)
+	if err != nil {
+		fmt.Printf("error loading mint: %v\n", err)
+		return 1
+	}
+
+	keyEpoch, err := m.KeyEpoch()
+	if err != nil {
+		fmt.Printf("error building key epoch: %v\n", err)
+		return 1
+	}
+	jsonEpoch, err := json.MarshalIndent(keyEpoch, "", "  ")
+	if err != nil {
+		fmt.Printf("error encoding key epoch: %v\n", err)
+		return 1
+	}
+
+	if len(*out) == 0 {
+		fmt.Println(string(jsonEpoch))
+		return 0
+	}
+	if err := os.WriteFile(*out, jsonEpoch, 0644); err != nil {
+		fmt.Printf("error writing key epoch: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Key epoch at %v for %v keysets written to %v\n", keyEpoch.Timestamp, len(keyEpoch.Keysets), *out)
+	return 0
+}
+
+func verifyKeyEpoch(path string) int {
+	jsonEpoch, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Printf("error reading key epoch: %v\n", err)
+		return 1
+	}
+	var keyEpoch mint.KeyEpoch
+	if err := json.Unmarshal(jsonEpoch, &keyEpoch); err != nil {
+		fmt.Printf("invalid key epoch: %v\n", err)
+		return 1
+	}
+	if !mint.VerifyKeyEpoch(keyEpoch) {
+		fmt.Printf("Invalid signature for pubkey %v\n", keyEpoch.Pubkey)
+		return 1
+	}
+
+	fmt.Printf("Valid signature for pubkey %v at %v\n\n", keyEpoch.Pubkey, keyEpoch.Timestamp)
+	for _, keyset := range keyEpoch.Keysets {
+		status := "inactive"
+		if keyset.Active {
+			status = "active"
+		}
+		fmt.Printf("Keyset %v (%v, %v): issued %v, redeemed %v, outstanding %v\n",
+			keyset.Id, keyset.Unit, status, keyset.Issued, keyset.Redeemed,
+			keyset.Issued-min(keyset.Issued, keyset.Redeemed))
+	}
+	return 0
+}
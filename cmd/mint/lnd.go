@@ -0,0 +1,29 @@
+//go:build !nolnd
+
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/elnosh/gonuts/mint/lightning"
+)
+
+// reloadLndCredentials reloads the LND credentials
+// from the env if the backend of the mint is LND
+func reloadLndCredentials(lightningClient lightning.Client) {
+	lndClient, ok := lightningClient.(*lightning.LndClient)
+	if !ok {
+		return
+	}
+	lndConfig, err := lightning.LndConfigFromEnv(os.Getenv)
+	if err != nil {
+		log.Printf("error reading LND config: %v", err)
+		return
+	}
+	if err := lndClient.Reload(lndConfig); err != nil {
+		log.Printf("error reloading LND credentials, keeping previous ones: %v", err)
+		return
+	}
+	log.Println("reloaded LND credentials")
+}
@@ -12,14 +12,13 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut06"
 	"github.com/elnosh/gonuts/mint"
 	"github.com/elnosh/gonuts/mint/lightning"
 	"github.com/joho/godotenv"
-	"github.com/lightningnetwork/lnd/macaroons"
-	"google.golang.org/grpc/credentials"
-	"gopkg.in/macaroon.v2"
 )
 
 func configFromEnv() (*mint.Config, error) {
@@ -42,6 +41,14 @@ func configFromEnv() (*mint.Config, error) {
 		port = 3338
 	}
 
+	var httpRedirectPort int
+	if redirectPort := os.Getenv("MINT_HTTP_REDIRECT_PORT"); len(redirectPort) > 0 {
+		httpRedirectPort, err = strconv.Atoi(redirectPort)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MINT_HTTP_REDIRECT_PORT: %v", err)
+		}
+	}
+
 	mintPath := os.Getenv("MINT_DB_PATH")
 	// if MINT_DB_PATH is empty, use $HOME/.gonuts/mint
 	if len(mintPath) == 0 {
@@ -66,7 +73,15 @@ func configFromEnv() (*mint.Config, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid MINTING_MAX_AMOUNT: %v", err)
 		}
-		mintLimits.MintingSettings = mint.MintMethodSettings{MaxAmount: maxMint}
+		mintLimits.MintingSettings.MaxAmount = maxMint
+	}
+
+	if pubkeyRequiredEnv, ok := os.LookupEnv("MINTING_PUBKEY_REQUIRED_ABOVE"); ok {
+		pubkeyRequiredAbove, err := strconv.ParseUint(pubkeyRequiredEnv, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MINTING_PUBKEY_REQUIRED_ABOVE: %v", err)
+		}
+		mintLimits.MintingSettings.PubkeyRequiredAbove = pubkeyRequiredAbove
 	}
 
 	if maxMeltEnv, ok := os.LookupEnv("MELTING_MAX_AMOUNT"); ok {
@@ -122,80 +137,335 @@ func configFromEnv() (*mint.Config, error) {
 		}
 	}
 
-	var lightningClient lightning.Client
-	switch os.Getenv("LIGHTNING_BACKEND") {
-	case "Lnd":
-		// read values for setting up LND
-		host := os.Getenv("LND_GRPC_HOST")
-		if host == "" {
-			return nil, errors.New("LND_GRPC_HOST cannot be empty")
-		}
-		certPath := os.Getenv("LND_CERT_PATH")
-		if certPath == "" {
-			return nil, errors.New("LND_CERT_PATH cannot be empty")
-		}
-		macaroonPath := os.Getenv("LND_MACAROON_PATH")
-		if macaroonPath == "" {
-			return nil, errors.New("LND_MACAROON_PATH cannot be empty")
-		}
+	ipPolicy, err := ipPolicyFromEnv("")
+	if err != nil {
+		return nil, err
+	}
 
-		creds, err := credentials.NewClientTLSFromFile(certPath, "")
+	var adminPort int
+	if port := os.Getenv("ADMIN_PORT"); len(port) > 0 {
+		adminPort, err = strconv.Atoi(port)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("invalid ADMIN_PORT: %v", err)
 		}
+	}
+	adminIPPolicy, err := ipPolicyFromEnv("ADMIN_")
+	if err != nil {
+		return nil, err
+	}
 
-		macaroonBytes, err := os.ReadFile(macaroonPath)
+	corsPolicy := mint.CORSPolicy{}
+	if origins := os.Getenv("CORS_ALLOWED_ORIGINS"); len(origins) > 0 {
+		if err := json.Unmarshal([]byte(origins), &corsPolicy.AllowedOrigins); err != nil {
+			return nil, fmt.Errorf("error parsing CORS allowed origins: %v", err)
+		}
+	}
+	if methods := os.Getenv("CORS_ALLOWED_METHODS"); len(methods) > 0 {
+		if err := json.Unmarshal([]byte(methods), &corsPolicy.AllowedMethods); err != nil {
+			return nil, fmt.Errorf("error parsing CORS allowed methods: %v", err)
+		}
+	}
+	if headers := os.Getenv("CORS_ALLOWED_HEADERS"); len(headers) > 0 {
+		if err := json.Unmarshal([]byte(headers), &corsPolicy.AllowedHeaders); err != nil {
+			return nil, fmt.Errorf("error parsing CORS allowed headers: %v", err)
+		}
+	}
+	if maxAge := os.Getenv("CORS_MAX_AGE"); len(maxAge) > 0 {
+		duration, err := time.ParseDuration(maxAge)
 		if err != nil {
-			return nil, fmt.Errorf("error reading macaroon: os.ReadFile %v", err)
+			return nil, fmt.Errorf("invalid CORS_MAX_AGE: %v", err)
 		}
+		corsPolicy.MaxAge = duration
+	}
 
-		macaroon := &macaroon.Macaroon{}
-		if err = macaroon.UnmarshalBinary(macaroonBytes); err != nil {
-			return nil, fmt.Errorf("unable to decode macaroon: %v", err)
+	doubleSpendPolicy := mint.DoubleSpendPolicy{}
+	if maxAttempts := os.Getenv("DOUBLE_SPEND_MAX_ATTEMPTS"); len(maxAttempts) > 0 {
+		attempts, err := strconv.Atoi(maxAttempts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DOUBLE_SPEND_MAX_ATTEMPTS: %v", err)
 		}
-		macarooncreds, err := macaroons.NewMacaroonCredential(macaroon)
+		doubleSpendPolicy.MaxAttempts = attempts
+	}
+	if window := os.Getenv("DOUBLE_SPEND_WINDOW"); len(window) > 0 {
+		duration, err := time.ParseDuration(window)
 		if err != nil {
-			return nil, fmt.Errorf("error setting macaroon creds: %v", err)
+			return nil, fmt.Errorf("invalid DOUBLE_SPEND_WINDOW: %v", err)
 		}
-		lndConfig := lightning.LndConfig{
-			GRPCHost: host,
-			Cert:     creds,
-			Macaroon: macarooncreds,
+		doubleSpendPolicy.Window = duration
+	}
+	if banDuration := os.Getenv("DOUBLE_SPEND_BAN_DURATION"); len(banDuration) > 0 {
+		duration, err := time.ParseDuration(banDuration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DOUBLE_SPEND_BAN_DURATION: %v", err)
 		}
+		doubleSpendPolicy.BanDuration = duration
+	}
 
-		lightningClient, err = lightning.SetupLndClient(lndConfig)
+	quoteRateLimit := mint.QuoteRateLimit{}
+	if perClient := os.Getenv("MINT_QUOTE_LIMIT_PER_CLIENT"); len(perClient) > 0 {
+		limit, err := strconv.Atoi(perClient)
 		if err != nil {
-			return nil, fmt.Errorf("error setting LND client: %v", err)
+			return nil, fmt.Errorf("invalid MINT_QUOTE_LIMIT_PER_CLIENT: %v", err)
 		}
-	case "FakeBackend":
-		lightningClient = &lightning.FakeBackend{}
-	default:
-		return nil, errors.New("invalid lightning backend")
+		quoteRateLimit.PerClient = limit
+	}
+	if refill := os.Getenv("MINT_QUOTE_LIMIT_REFILL"); len(refill) > 0 {
+		duration, err := time.ParseDuration(refill)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MINT_QUOTE_LIMIT_REFILL: %v", err)
+		}
+		quoteRateLimit.Refill = duration
+	}
+	if maxUnpaid := os.Getenv("MINT_QUOTE_MAX_UNPAID"); len(maxUnpaid) > 0 {
+		limit, err := strconv.Atoi(maxUnpaid)
+		if err != nil {
+			return nil, fmt.Errorf("invalid MINT_QUOTE_MAX_UNPAID: %v", err)
+		}
+		quoteRateLimit.MaxUnpaid = limit
+	}
+
+	alertConfig, err := alertConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	quoteWebhook := mint.QuoteWebhook{
+		URL:    os.Getenv("MINT_QUOTE_WEBHOOK_URL"),
+		Secret: os.Getenv("MINT_QUOTE_WEBHOOK_SECRET"),
 	}
 
 	enableMPP := false
 	if strings.ToLower(os.Getenv("ENABLE_MPP")) == "true" {
 		enableMPP = true
 	}
+	enableAMP := false
+	if strings.ToLower(os.Getenv("ENABLE_AMP")) == "true" {
+		enableAMP = true
+	}
+	enableBOLT12 := false
+	if strings.ToLower(os.Getenv("ENABLE_BOLT12")) == "true" {
+		enableBOLT12 = true
+	}
+	invoiceOptions := lightning.InvoiceOptions{
+		PrivateRouteHints: strings.ToLower(os.Getenv("INVOICE_PRIVATE_ROUTE_HINTS")) == "true",
+		FallbackAddress:   os.Getenv("INVOICE_FALLBACK_ADDRESS"),
+	}
+	if expiry := os.Getenv("INVOICE_EXPIRY_SECONDS"); len(expiry) > 0 {
+		seconds, err := strconv.ParseUint(expiry, 10, 32)
+		if err != nil || seconds == 0 {
+			return nil, fmt.Errorf("invalid INVOICE_EXPIRY_SECONDS: %v", expiry)
+		}
+		invoiceOptions.Expiry = time.Duration(seconds) * time.Second
+	}
+
+	enableMsatUnit := strings.ToLower(os.Getenv("ENABLE_MSAT_UNIT")) == "true"
+	var units []cashu.Unit
+	var exchangeRates mint.ExchangeRates
+	if unitsEnv := os.Getenv("UNITS"); len(unitsEnv) > 0 {
+		for _, unitStr := range strings.Split(unitsEnv, ",") {
+			unit, err := cashu.UnitFromString(strings.ToLower(strings.TrimSpace(unitStr)))
+			if err != nil || !unit.IsFiat() {
+				return nil, fmt.Errorf("invalid unit in UNITS: %v", unitStr)
+			}
+			units = append(units, unit)
+		}
+		exchangeRates = &mint.CoinbaseExchangeRates{URL: os.Getenv("EXCHANGE_RATES_URL")}
+	}
+	signProofStates := strings.ToLower(os.Getenv("SIGN_PROOF_STATES")) == "true"
+	publishKeyEpochs := strings.ToLower(os.Getenv("PUBLISH_KEY_EPOCHS")) == "true"
+	redeemOnly := strings.ToLower(os.Getenv("REDEEM_ONLY")) == "true"
+	hideInternalSettlement := strings.ToLower(os.Getenv("HIDE_INTERNAL_SETTLEMENT")) == "true"
+	deriveKeysetsOnStartup := strings.ToLower(os.Getenv("DERIVE_KEYSETS_ON_STARTUP")) == "true"
+	faucetMode := strings.ToLower(os.Getenv("FAUCET_MODE")) == "true"
+	var faucetSettleDelay time.Duration
+	if delay := os.Getenv("FAUCET_SETTLE_DELAY"); len(delay) > 0 {
+		faucetSettleDelay, err = time.ParseDuration(delay)
+		if err != nil || faucetSettleDelay < 0 {
+			return nil, fmt.Errorf("invalid FAUCET_SETTLE_DELAY: %v", delay)
+		}
+	}
 
 	logLevel := mint.Info
 	if strings.ToLower(os.Getenv("LOG")) == "debug" {
 		logLevel = mint.Debug
 	}
+	logClientFingerprint := strings.ToLower(os.Getenv("LOG_CLIENT_FINGERPRINT")) == "true"
 
 	return &mint.Config{
-		DerivationPathIdx: uint32(derivationPathIdx),
-		Port:              port,
-		MintPath:          mintPath,
-		InputFeePpk:       inputFeePpk,
-		MintInfo:          mintInfo,
-		Limits:            mintLimits,
-		LightningClient:   lightningClient,
-		EnableMPP:         enableMPP,
-		LogLevel:          logLevel,
+		DerivationPathIdx:      uint32(derivationPathIdx),
+		Port:                   port,
+		ListenAddress:          os.Getenv("MINT_LISTEN_ADDRESS"),
+		BasePath:               os.Getenv("MINT_BASE_PATH"),
+		TLSCertFile:            os.Getenv("MINT_TLS_CERT_PATH"),
+		TLSKeyFile:             os.Getenv("MINT_TLS_KEY_PATH"),
+		HTTPRedirectPort:       httpRedirectPort,
+		AdminPort:              adminPort,
+		AdminIPPolicy:          adminIPPolicy,
+		MintPath:               mintPath,
+		InputFeePpk:            inputFeePpk,
+		MintInfo:               mintInfo,
+		Limits:                 mintLimits,
+		EnableMPP:              enableMPP,
+		EnableAMP:              enableAMP,
+		EnableBOLT12:           enableBOLT12,
+		InvoiceOptions:         invoiceOptions,
+		EnableMsatUnit:         enableMsatUnit,
+		Units:                  units,
+		ExchangeRates:          exchangeRates,
+		SignProofStates:        signProofStates,
+		PublishKeyEpochs:       publishKeyEpochs,
+		RedeemOnly:             redeemOnly,
+		HideInternalSettlement: hideInternalSettlement,
+		DeriveKeysetsOnStartup: deriveKeysetsOnStartup,
+		FaucetMode:             faucetMode,
+		FaucetSettleDelay:      faucetSettleDelay,
+		Network:                os.Getenv("BITCOIN_NETWORK"),
+		LogLevel:               logLevel,
+		LogClientFingerprint:   logClientFingerprint,
+		IPPolicy:               ipPolicy,
+		CORS:                   corsPolicy,
+		WebsocketAdminToken:    os.Getenv("MINT_WS_ADMIN_TOKEN"),
+		DoubleSpends:           doubleSpendPolicy,
+		QuoteRateLimit:         quoteRateLimit,
+		Alerts:                 alertConfig,
+		QuoteWebhook:           quoteWebhook,
 	}, nil
 }
 
+// ipPolicyFromEnv reads the IP lists and trusted proxies of
+// a policy from the env variables with the prefix.
+func ipPolicyFromEnv(prefix string) (mint.IPPolicy, error) {
+	ipPolicy := mint.IPPolicy{}
+	lists := []struct {
+		name string
+		list *[]string
+	}{
+		{"IP_ALLOWLIST", &ipPolicy.AllowList},
+		{"IP_DENYLIST", &ipPolicy.DenyList},
+		{"TRUSTED_PROXIES", &ipPolicy.TrustedProxies},
+	}
+	for _, l := range lists {
+		if value := os.Getenv(prefix + l.name); len(value) > 0 {
+			if err := json.Unmarshal([]byte(value), l.list); err != nil {
+				return ipPolicy, fmt.Errorf("error parsing %v: %v", prefix+l.name, err)
+			}
+		}
+	}
+	return ipPolicy, nil
+}
+
+// alertConfigFromEnv sets up the notifiers and thresholds for alerts.
+// Alerts are disabled if no notifier is set.
+func alertConfigFromEnv() (mint.AlertConfig, error) {
+	alertConfig := mint.AlertConfig{}
+
+	if webhookURL := os.Getenv("ALERT_WEBHOOK_URL"); len(webhookURL) > 0 {
+		if _, err := url.Parse(webhookURL); err != nil {
+			return alertConfig, fmt.Errorf("invalid alert webhook url: %v", err)
+		}
+		alertConfig.Notifiers = append(alertConfig.Notifiers, &mint.WebhookNotifier{URL: webhookURL})
+	}
+
+	if botToken := os.Getenv("ALERT_TELEGRAM_BOT_TOKEN"); len(botToken) > 0 {
+		chatId := os.Getenv("ALERT_TELEGRAM_CHAT_ID")
+		if len(chatId) == 0 {
+			return alertConfig, errors.New("ALERT_TELEGRAM_CHAT_ID cannot be empty if ALERT_TELEGRAM_BOT_TOKEN is set")
+		}
+		alertConfig.Notifiers = append(alertConfig.Notifiers, &mint.TelegramNotifier{
+			BotToken: botToken,
+			ChatId:   chatId,
+		})
+	}
+
+	if smtpAddress := os.Getenv("ALERT_EMAIL_SMTP_ADDRESS"); len(smtpAddress) > 0 {
+		from := os.Getenv("ALERT_EMAIL_FROM")
+		to := os.Getenv("ALERT_EMAIL_TO")
+		if len(from) == 0 || len(to) == 0 {
+			return alertConfig, errors.New("ALERT_EMAIL_FROM and ALERT_EMAIL_TO need to be set if ALERT_EMAIL_SMTP_ADDRESS is set")
+		}
+		alertConfig.Notifiers = append(alertConfig.Notifiers, &mint.EmailNotifier{
+			SMTPAddress: smtpAddress,
+			Username:    os.Getenv("ALERT_EMAIL_USERNAME"),
+			Password:    os.Getenv("ALERT_EMAIL_PASSWORD"),
+			From:        from,
+			To:          strings.Split(to, ","),
+		})
+	}
+
+	if checkInterval := os.Getenv("ALERT_CHECK_INTERVAL"); len(checkInterval) > 0 {
+		interval, err := time.ParseDuration(checkInterval)
+		if err != nil {
+			return alertConfig, fmt.Errorf("invalid ALERT_CHECK_INTERVAL: %v", err)
+		}
+		alertConfig.CheckInterval = interval
+	}
+	if repeatInterval := os.Getenv("ALERT_REPEAT_INTERVAL"); len(repeatInterval) > 0 {
+		interval, err := time.ParseDuration(repeatInterval)
+		if err != nil {
+			return alertConfig, fmt.Errorf("invalid ALERT_REPEAT_INTERVAL: %v", err)
+		}
+		alertConfig.RepeatInterval = interval
+	}
+	if pendingMeltAge := os.Getenv("ALERT_PENDING_MELT_AGE"); len(pendingMeltAge) > 0 {
+		age, err := time.ParseDuration(pendingMeltAge)
+		if err != nil {
+			return alertConfig, fmt.Errorf("invalid ALERT_PENDING_MELT_AGE: %v", err)
+		}
+		alertConfig.PendingMeltAge = age
+	}
+	if dbErrorThreshold := os.Getenv("ALERT_DB_ERROR_THRESHOLD"); len(dbErrorThreshold) > 0 {
+		threshold, err := strconv.Atoi(dbErrorThreshold)
+		if err != nil {
+			return alertConfig, fmt.Errorf("invalid ALERT_DB_ERROR_THRESHOLD: %v", err)
+		}
+		alertConfig.DBErrorThreshold = threshold
+	}
+	if strings.ToLower(os.Getenv("ALERT_RECONCILE_BALANCE")) == "true" {
+		alertConfig.ReconcileBalance = true
+	}
+
+	return alertConfig, nil
+}
+
+// lightningClientFromEnv sets up the lightning backend specified in the
+// LIGHTNING_BACKEND env variable. Other backends can be added by importing
+// a package that registers them with lightning.Register.
+func lightningClientFromEnv() (lightning.Client, error) {
+	backend := os.Getenv("LIGHTNING_BACKEND")
+	if len(backend) == 0 {
+		return nil, fmt.Errorf("LIGHTNING_BACKEND is not set. Available backends: %v",
+			strings.Join(lightning.Backends(), ", "))
+	}
+	return lightning.New(backend, os.Getenv)
+}
+
+// reloadOnHangup reloads the config from the env (and .env file) when the process
+// gets a SIGHUP. The settings that can be changed while running are applied and
+// the LND credentials are reloaded so they can be rotated without a restart.
+func reloadOnHangup(mintServer *mint.MintServer, lightningClient lightning.Client) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			if err := godotenv.Overload(); err != nil {
+				log.Printf("error reloading .env file: %v", err)
+				continue
+			}
+
+			mintConfig, err := configFromEnv()
+			if err != nil {
+				log.Printf("error reading config, keeping previous one: %v", err)
+			} else if changes, err := mintServer.ReloadConfig(*mintConfig); err != nil {
+				log.Printf("error reloading config: %v", err)
+			} else if len(changes) == 0 {
+				log.Println("no changes in config to reload")
+			}
+			reloadLndCredentials(lightningClient)
+		}
+	}()
+}
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
@@ -206,10 +476,38 @@ func main() {
 		log.Fatalf("error reading config: %v", err)
 	}
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "selftest":
+			os.Exit(runSelfTest(*mintConfig))
+		case "feereport":
+			os.Exit(runFeeReport(*mintConfig, os.Args[2:]))
+		case "fees":
+			os.Exit(runFees(*mintConfig, os.Args[2:]))
+		case "importkeyset":
+			os.Exit(runImportKeyset(*mintConfig, os.Args[2:]))
+		case "inspectkeyset":
+			os.Exit(runInspectKeyset(*mintConfig, os.Args[2:]))
+		case "pending":
+			os.Exit(runPending(*mintConfig, os.Args[2:]))
+		case "keyepoch":
+			os.Exit(runKeyEpoch(*mintConfig, os.Args[2:]))
+		}
+	}
+
+	// the mint settles the quotes itself in faucet mode
+	if !mintConfig.FaucetMode {
+		mintConfig.LightningClient, err = lightningClientFromEnv()
+		if err != nil {
+			log.Fatalf("error setting up lightning backend: %v", err)
+		}
+	}
+
 	mintServer, err := mint.SetupMintServer(*mintConfig)
 	if err != nil {
 		log.Fatalf("error starting mint server: %v", err)
 	}
+	reloadOnHangup(mintServer, mintConfig.LightningClient)
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
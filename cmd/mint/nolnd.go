@@ -0,0 +1,9 @@
+//go:build nolnd
+
+package main
+
+import "github.com/elnosh/gonuts/mint/lightning"
+
+// the LND backend is left out of builds with the nolnd tag
+// so there are no credentials to reload
+func reloadLndCredentials(lightning.Client) {}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/elnosh/gonuts/mint"
+	"github.com/elnosh/gonuts/mint/lightning"
+)
+
+// runPending prints the proofs pending for melts and the mint quotes
+// that have not been issued. It loads the mint from the configured
+// path but does not start the server.
+func runPending(config mint.Config, args []string) int {
+	flags := flag.NewFlagSet("pending", flag.ContinueOnError)
+	proofsOnly := flags.Bool("proofs", false, "only print the pending proofs")
+	quotesOnly := flags.Bool("quotes", false, "only print the mint quotes that have not been issued")
+	showExpired := flags.Bool("expired", false, "include unpaid mint quotes that expired")
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	// lightning backend is not used for the report
+	config.LightningClient = &lightning.FakeBackend{}
+	config.LogLevel = mint.Disable
+
+	m, err := mint.LoadMint(config)
+	if err != nil {
+		fmt.Printf("error loading mint: %v\n", err)
+		return 1
+	}
+
+	report, err := m.PendingReport()
+	if err != nil {
+		fmt.Printf("error building pending report: %v\n", err)
+		return 1
+	}
+
+	now := time.Now()
+	if !*quotesOnly {
+		fmt.Printf("Pending proofs: %v\n", report.PendingProofs)
+		units := make([]string, 0, len(report.PendingAmounts))
+		for unit := range report.PendingAmounts {
+			units = append(units, unit)
+		}
+		slices.Sort(units)
+		for _, unit := range units {
+			fmt.Printf("    %v %v\n", report.PendingAmounts[unit], unit)
+		}
+		for _, quote := range report.MeltQuotes {
+			state := quote.State
+			if len(state) == 0 {
+				state = "not found"
+			}
+			age := "unknown"
+			if !quote.PendingSince.IsZero() {
+				age = now.Sub(quote.PendingSince).Truncate(time.Second).String()
+			}
+			fmt.Printf("Melt quote %v (%v): %v proofs, %v %v, pending for %v\n",
+				quote.QuoteId, state, quote.Proofs, quote.Amount, quote.Unit, age)
+		}
+	}
+
+	if !*proofsOnly {
+		if !*quotesOnly {
+			fmt.Println()
+		}
+		fmt.Printf("Paid mint quotes not issued: %v\n", len(report.PaidMintQuotes))
+		for _, quote := range report.PaidMintQuotes {
+			fmt.Printf("    %v: %v %v\n", quote.QuoteId, quote.Amount, quote.Unit)
+		}
+
+		var unpaid []mint.PendingMintQuote
+		for _, quote := range report.UnpaidMintQuotes {
+			if !quote.Expired || *showExpired {
+				unpaid = append(unpaid, quote)
+			}
+		}
+		fmt.Printf("Mint quotes awaiting payment: %v\n", len(unpaid))
+		for _, quote := range unpaid {
+			expiry := "expires in " + quote.Expiry.Sub(now).Truncate(time.Second).String()
+			if quote.Expired {
+				expiry = "expired"
+			}
+			fmt.Printf("    %v: %v %v, %v\n", quote.QuoteId, quote.Amount, quote.Unit, expiry)
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut12"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint"
+	"github.com/elnosh/gonuts/mint/lightning"
+	"github.com/elnosh/gonuts/wallet"
+	"github.com/elnosh/gonuts/wallet/client"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+const selfTestAmount = 2100
+
+type selfTestResult int
+
+const (
+	passed selfTestResult = iota
+	failed
+	skipped
+)
+
+type selfTestCheck struct {
+	name string
+	run  func(st *selfTest) error
+}
+
+// errSkip is returned by a check that does
+// not apply to the mint being tested
+type errSkip struct {
+	reason string
+}
+
+func (e errSkip) Error() string {
+	return e.reason
+}
+
+type selfTest struct {
+	mintURL string
+	dir     string
+	wallet  *wallet.Wallet
+}
+
+var selfTestChecks = []selfTestCheck{
+	{name: "info (NUT-06)", run: checkInfo},
+	{name: "keys (NUT-01, NUT-02)", run: checkKeys},
+	{name: "mint (NUT-04)", run: checkMint},
+	{name: "swap (NUT-03)", run: checkSwap},
+	{name: "dleq (NUT-12)", run: checkDLEQ},
+	{name: "checkstate (NUT-07)", run: checkState},
+	{name: "melt (NUT-05)", run: checkMelt},
+	{name: "p2pk (NUT-11)", run: checkP2PK},
+	{name: "htlc (NUT-14)", run: checkHTLC},
+	{name: "restore (NUT-09, NUT-13)", run: checkRestore},
+	{name: "websockets (NUT-17)", run: checkWebsockets},
+}
+
+// runSelfTest starts the mint with the config passed against the FakeBackend
+// and runs the checks against it. It returns the exit code for the process.
+func runSelfTest(config mint.Config) int {
+	dir, err := os.MkdirTemp("", "gonuts-selftest")
+	if err != nil {
+		fmt.Printf("error creating temp dir: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	port, err := availablePort()
+	if err != nil {
+		fmt.Printf("error getting port for mint: %v\n", err)
+		return 1
+	}
+
+	config.MintPath = filepath.Join(dir, "mint")
+	config.Port = port
+	// self-test runs locally over plain HTTP
+	config.ListenAddress = "127.0.0.1"
+	config.TLSCertFile = ""
+	config.TLSKeyFile = ""
+	config.HTTPRedirectPort = 0
+	config.LightningClient = &lightning.FakeBackend{}
+	config.LogLevel = mint.Disable
+
+	mintServer, err := mint.SetupMintServer(config)
+	if err != nil {
+		fmt.Printf("error setting up mint: %v\n", err)
+		return 1
+	}
+	go func() {
+		if err := mintServer.Start(); err != nil {
+			fmt.Printf("error running mint: %v\n", err)
+		}
+	}()
+	defer mintServer.Shutdown()
+
+	mintURL := fmt.Sprintf("http://127.0.0.1:%v", port)
+	if basePath := strings.Trim(config.BasePath, "/"); len(basePath) > 0 {
+		mintURL += "/" + basePath
+	}
+	if err := waitForMint(mintURL); err != nil {
+		fmt.Printf("mint did not start: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("running self-test against mint at %v\n\n", mintURL)
+
+	st := &selfTest{mintURL: mintURL, dir: dir}
+	results := make(map[selfTestResult]int)
+	for _, check := range selfTestChecks {
+		err := check.run(st)
+		var skip errSkip
+		switch {
+		case err == nil:
+			results[passed]++
+			fmt.Printf("[PASS] %v\n", check.name)
+		case errors.As(err, &skip):
+			results[skipped]++
+			fmt.Printf("[SKIP] %v: %v\n", check.name, skip.reason)
+		default:
+			results[failed]++
+			fmt.Printf("[FAIL] %v: %v\n", check.name, err)
+		}
+	}
+
+	fmt.Printf("\npassed: %v, failed: %v, skipped: %v\n", results[passed], results[failed], results[skipped])
+	if results[failed] > 0 {
+		return 1
+	}
+	return 0
+}
+
+func availablePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func waitForMint(mintURL string) error {
+	var err error
+	for i := 0; i < 50; i++ {
+		if _, err = client.GetMintInfo(mintURL); err == nil {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return err
+}
+
+// loadWallet returns the wallet used for the checks.
+// It gets created on first use.
+func (st *selfTest) loadWallet() (*wallet.Wallet, error) {
+	if st.wallet != nil {
+		return st.wallet, nil
+	}
+
+	// the wallet is only needed while the checks run
+	w, err := wallet.NewWallet(wallet.Options{
+		Config: wallet.Config{CurrentMintURL: st.mintURL},
+		DB:     storage.NewMemoryDB(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error loading wallet: %v", err)
+	}
+	st.wallet = w
+	return w, nil
+}
+
+// fundedWallet returns the wallet used for the checks
+// with at least amount in balance.
+func (st *selfTest) fundedWallet(amount uint64) (*wallet.Wallet, error) {
+	w, err := st.loadWallet()
+	if err != nil {
+		return nil, err
+	}
+	if w.GetBalance() >= amount {
+		return w, nil
+	}
+
+	// FakeBackend invoices are paid as soon as they are created
+	mintQuote, err := w.RequestMint(amount, st.mintURL)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting mint quote: %v", err)
+	}
+	if _, err := w.MintTokens(mintQuote.Quote); err != nil {
+		return nil, fmt.Errorf("error minting tokens: %v", err)
+	}
+	return w, nil
+}
+
+func checkInfo(st *selfTest) error {
+	info, err := client.GetMintInfo(st.mintURL)
+	if err != nil {
+		return err
+	}
+	if len(info.Pubkey) == 0 {
+		return errors.New("mint info does not have a pubkey")
+	}
+	for _, nut := range []int{4, 5} {
+		if _, ok := info.Nuts[nut]; !ok {
+			return fmt.Errorf("mint info does not have settings for NUT-%02d", nut)
+		}
+	}
+	return nil
+}
+
+func checkKeys(st *selfTest) error {
+	keysResponse, err := client.GetActiveKeysets(st.mintURL)
+	if err != nil {
+		return err
+	}
+	if len(keysResponse.Keysets) == 0 {
+		return errors.New("mint returned no active keysets")
+	}
+
+	for _, keyset := range keysResponse.Keysets {
+		keys, err := crypto.MapPubKeys(keyset.Keys)
+		if err != nil {
+			return fmt.Errorf("invalid keys in keyset '%v': %v", keyset.Id, err)
+		}
+		if id := crypto.DeriveKeysetId(keys); id != keyset.Id {
+			return fmt.Errorf("keyset id '%v' does not match id '%v' derived from keys", keyset.Id, id)
+		}
+	}
+
+	keysetsResponse, err := client.GetAllKeysets(st.mintURL)
+	if err != nil {
+		return err
+	}
+	if len(keysetsResponse.Keysets) < len(keysResponse.Keysets) {
+		return errors.New("list of keysets does not include all the active keysets")
+	}
+	return nil
+}
+
+func checkMint(st *selfTest) error {
+	w, err := st.loadWallet()
+	if err != nil {
+		return err
+	}
+
+	mintQuote, err := w.RequestMint(selfTestAmount, st.mintURL)
+	if err != nil {
+		return fmt.Errorf("error requesting mint quote: %v", err)
+	}
+	minted, err := w.MintTokens(mintQuote.Quote)
+	if err != nil {
+		return fmt.Errorf("error minting tokens: %v", err)
+	}
+	if minted != selfTestAmount {
+		return fmt.Errorf("expected to mint %v but got %v", selfTestAmount, minted)
+	}
+
+	// second attempt with the same quote should fail
+	if _, err := w.MintTokens(mintQuote.Quote); err == nil {
+		return errors.New("was able to mint twice with the same quote")
+	}
+	return nil
+}
+
+func checkSwap(st *selfTest) error {
+	w, err := st.fundedWallet(selfTestAmount)
+	if err != nil {
+		return err
+	}
+
+	proofs, err := w.Send(100, st.mintURL, true)
+	if err != nil {
+		return fmt.Errorf("error preparing proofs to send: %v", err)
+	}
+	token, err := cashu.NewTokenV4(proofs, st.mintURL, cashu.Sat, false)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Receive(token, false); err != nil {
+		return fmt.Errorf("error receiving token: %v", err)
+	}
+
+	// proofs are now spent so receiving them again should fail
+	if _, err := w.Receive(token, false); err == nil {
+		return errors.New("was able to swap already spent proofs")
+	}
+	return nil
+}
+
+func checkDLEQ(st *selfTest) error {
+	w, err := st.fundedWallet(selfTestAmount)
+	if err != nil {
+		return err
+	}
+
+	proofs, err := w.Send(100, st.mintURL, true)
+	if err != nil {
+		return fmt.Errorf("error preparing proofs to send: %v", err)
+	}
+	for _, proof := range proofs {
+		if proof.DLEQ == nil {
+			return errors.New("mint did not include DLEQ proof in signatures")
+		}
+	}
+
+	keyset, err := wallet.GetMintActiveKeyset(st.mintURL, cashu.Sat)
+	if err != nil {
+		return err
+	}
+	if !nut12.VerifyProofsDLEQ(proofs, *keyset) {
+		return errors.New("invalid DLEQ proofs")
+	}
+
+	token, err := cashu.NewTokenV4(proofs, st.mintURL, cashu.Sat, true)
+	if err != nil {
+		return err
+	}
+	_, err = w.Receive(token, false)
+	return err
+}
+
+func checkState(st *selfTest) error {
+	w, err := st.fundedWallet(selfTestAmount)
+	if err != nil {
+		return err
+	}
+
+	proofs, err := w.Send(100, st.mintURL, true)
+	if err != nil {
+		return fmt.Errorf("error preparing proofs to send: %v", err)
+	}
+
+	if err := expectProofsState(st.mintURL, proofs, nut07.Unspent); err != nil {
+		return err
+	}
+
+	token, err := cashu.NewTokenV4(proofs, st.mintURL, cashu.Sat, false)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Receive(token, false); err != nil {
+		return fmt.Errorf("error receiving token: %v", err)
+	}
+
+	return expectProofsState(st.mintURL, proofs, nut07.Spent)
+}
+
+func expectProofsState(mintURL string, proofs cashu.Proofs, state nut07.State) error {
+	Ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			return err
+		}
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+	}
+
+	response, err := client.PostCheckProofState(mintURL, nut07.PostCheckStateRequest{Ys: Ys})
+	if err != nil {
+		return err
+	}
+	if len(response.States) != len(Ys) {
+		return fmt.Errorf("expected %v proof states but got %v", len(Ys), len(response.States))
+	}
+	for _, proofState := range response.States {
+		if proofState.State != state {
+			return fmt.Errorf("expected proof state '%v' but got '%v'", state, proofState.State)
+		}
+	}
+	return nil
+}
+
+func checkMelt(st *selfTest) error {
+	w, err := st.fundedWallet(selfTestAmount)
+	if err != nil {
+		return err
+	}
+
+	invoice, _, _, err := lightning.CreateFakeInvoice(100, false)
+	if err != nil {
+		return err
+	}
+	meltQuote, err := w.RequestMeltQuote(invoice, st.mintURL)
+	if err != nil {
+		return fmt.Errorf("error requesting melt quote: %v", err)
+	}
+
+	meltResponse, err := w.Melt(meltQuote.Quote)
+	if err != nil {
+		return fmt.Errorf("error melting: %v", err)
+	}
+	if meltResponse.State != nut05.Paid {
+		return fmt.Errorf("expected melt quote to be paid but got '%v'", meltResponse.State)
+	}
+	if len(meltResponse.Preimage) == 0 {
+		return errors.New("paid melt quote does not have preimage")
+	}
+	return nil
+}
+
+func checkP2PK(st *selfTest) error {
+	w, err := st.fundedWallet(selfTestAmount)
+	if err != nil {
+		return err
+	}
+
+	proofs, err := w.SendToPubkey(100, st.mintURL, w.GetReceivePubkey(), nil, true)
+	if err != nil {
+		return fmt.Errorf("error locking proofs to pubkey: %v", err)
+	}
+	token, err := cashu.NewTokenV4(proofs, st.mintURL, cashu.Sat, false)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Receive(token, false); err != nil {
+		return fmt.Errorf("error receiving P2PK locked token: %v", err)
+	}
+	return nil
+}
+
+func checkHTLC(st *selfTest) error {
+	w, err := st.fundedWallet(selfTestAmount)
+	if err != nil {
+		return err
+	}
+
+	var random [32]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return err
+	}
+	preimage := hex.EncodeToString(random[:])
+
+	proofs, err := w.HTLCLockedProofs(100, st.mintURL, preimage, nil, true)
+	if err != nil {
+		return fmt.Errorf("error creating HTLC locked proofs: %v", err)
+	}
+	token, err := cashu.NewTokenV4(proofs, st.mintURL, cashu.Sat, false)
+	if err != nil {
+		return err
+	}
+
+	wrongPreimage := sha256.Sum256(random[:])
+	if _, err := w.ReceiveHTLC(token, hex.EncodeToString(wrongPreimage[:])); err == nil {
+		return errors.New("was able to redeem HTLC with wrong preimage")
+	}
+	if _, err := w.ReceiveHTLC(token, preimage); err != nil {
+		return fmt.Errorf("error receiving HTLC locked token: %v", err)
+	}
+	return nil
+}
+
+func checkRestore(st *selfTest) error {
+	w, err := st.fundedWallet(selfTestAmount)
+	if err != nil {
+		return err
+	}
+
+	balance := w.GetBalance()
+	restored, err := wallet.Restore(filepath.Join(st.dir, "restored"), w.Mnemonic(), []string{st.mintURL})
+	if err != nil {
+		return fmt.Errorf("error restoring wallet: %v", err)
+	}
+	if restored != balance {
+		return fmt.Errorf("expected to restore %v but restored %v", balance, restored)
+	}
+	return nil
+}
+
+func checkWebsockets(st *selfTest) error {
+	return errSkip{reason: "not supported by this mint"}
+}
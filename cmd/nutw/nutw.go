@@ -2,23 +2,32 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut05"
 	"github.com/elnosh/gonuts/cashu/nuts/nut11"
+	"github.com/elnosh/gonuts/cashu/nuts/nut13"
 	"github.com/elnosh/gonuts/wallet"
+	"github.com/elnosh/gonuts/wallet/lnbits"
+	"github.com/elnosh/gonuts/wallet/storage"
 	"github.com/joho/godotenv"
 	decodepay "github.com/nbd-wtf/ln-decodepay"
 	"github.com/urfave/cli/v2"
@@ -35,6 +44,7 @@ func walletConfig() (wallet.Config, error) {
 			return wallet.Config{
 				WalletPath:     defaultWalletPath(),
 				CurrentMintURL: "http://127.0.0.1:3338",
+				PriceProvider:  &wallet.MempoolPriceProvider{},
 			}, nil
 		}
 	}
@@ -48,7 +58,55 @@ func walletConfig() (wallet.Config, error) {
 	if len(mint) == 0 {
 		mint = "http://127.0.0.1:3338"
 	}
-	config := wallet.Config{WalletPath: walletPath, CurrentMintURL: mint}
+	config := wallet.Config{
+		WalletPath:     walletPath,
+		CurrentMintURL: mint,
+		PriceProvider:  &wallet.MempoolPriceProvider{URL: os.Getenv("PRICE_SOURCE_URL")},
+	}
+
+	if retention := os.Getenv("QUOTE_RETENTION"); len(retention) > 0 {
+		duration, err := time.ParseDuration(retention)
+		if err != nil {
+			return wallet.Config{}, fmt.Errorf("invalid QUOTE_RETENTION: %v", err)
+		}
+		config.QuoteRetention = duration
+	}
+	if refresh := os.Getenv("REFRESH_AFTER_RECEIVE"); len(refresh) > 0 {
+		refreshAfterReceive, err := strconv.ParseBool(refresh)
+		if err != nil {
+			return wallet.Config{}, fmt.Errorf("invalid REFRESH_AFTER_RECEIVE: %v", err)
+		}
+		config.RefreshAfterReceive = refreshAfterReceive
+	}
+	if maxFeePercent := os.Getenv("RECEIVE_MAX_FEE_PERCENT"); len(maxFeePercent) > 0 {
+		percent, err := strconv.ParseFloat(maxFeePercent, 64)
+		if err != nil {
+			return wallet.Config{}, fmt.Errorf("invalid RECEIVE_MAX_FEE_PERCENT: %v", err)
+		}
+		config.ReceiveFeePolicy.MaxFeePercent = percent
+	}
+	if version := os.Getenv("TOKEN_VERSION"); len(version) > 0 {
+		tokenVersion, err := wallet.ParseTokenVersion(version)
+		if err != nil {
+			return wallet.Config{}, fmt.Errorf("invalid TOKEN_VERSION: %v", err)
+		}
+		config.TokenVersion = tokenVersion
+	}
+	if minAmount := os.Getenv("RECEIVE_MIN_AMOUNT"); len(minAmount) > 0 {
+		amount, err := strconv.ParseUint(minAmount, 10, 64)
+		if err != nil {
+			return wallet.Config{}, fmt.Errorf("invalid RECEIVE_MIN_AMOUNT: %v", err)
+		}
+		config.ReceiveFeePolicy.MinAmount = amount
+	}
+
+	// log to stderr so it does not mix with the output of commands
+	switch strings.ToLower(os.Getenv("LOG")) {
+	case "debug":
+		config.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	case "info":
+		config.Logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
 
 	return config, nil
 }
@@ -89,6 +147,11 @@ func setupWallet(ctx *cli.Context) error {
 	if err != nil {
 		printErr(err)
 	}
+
+	// resolve operations that did not complete in a previous run
+	if _, err := nutw.Recover(); err != nil {
+		fmt.Printf("could not recover pending operations: %v\n", err)
+	}
 	return nil
 }
 
@@ -96,19 +159,29 @@ func main() {
 	app := &cli.App{
 		Name:  "nutw",
 		Usage: "cashu wallet",
+		After: warnCounterConflicts,
 		Commands: []*cli.Command{
 			balanceCmd,
 			mintCmd,
 			sendCmd,
 			receiveCmd,
+			receiveBatchCmd,
 			payCmd,
 			pendingCmd,
 			quotesCmd,
 			p2pkLockCmd,
 			mnemonicCmd,
+			fingerprintCmd,
 			restoreCmd,
 			currentMintCmd,
 			decodeCmd,
+			watchCmd,
+			reconcileCmd,
+			refreshCmd,
+			scheduleCmd,
+			statementCmd,
+			evacuateCmd,
+			serveCmd,
 		},
 	}
 
@@ -118,7 +191,8 @@ func main() {
 }
 
 const (
-	pendingFlag = "pending"
+	pendingFlag  = "pending"
+	currencyFlag = "currency"
 )
 
 var balanceCmd = &cli.Command{
@@ -132,6 +206,10 @@ var balanceCmd = &cli.Command{
 			Usage:              "show pending balance",
 			DisableDefaultText: true,
 		},
+		&cli.StringFlag{
+			Name:  currencyFlag,
+			Usage: "also show balance in currency (i.e USD, EUR)",
+		},
 	},
 }
 
@@ -151,6 +229,20 @@ func getBalance(ctx *cli.Context) error {
 
 	fmt.Printf("\nTotal balance: %v sats\n", totalBalance)
 
+	for unit, balance := range nutw.GetBalanceByUnit() {
+		if unit != cashu.Sat && balance > 0 {
+			fmt.Printf("Total balance in %v: %v\n", unit, balance)
+		}
+	}
+
+	if currency := ctx.String(currencyFlag); len(currency) > 0 {
+		converted, err := nutw.ConvertAmount(totalBalance, currency)
+		if err != nil {
+			printErr(err)
+		}
+		fmt.Printf("Total balance in %v: %.2f\n", strings.ToUpper(currency), converted)
+	}
+
 	if ctx.Bool(pendingFlag) {
 		pendingBalance := nutw.PendingBalance()
 		fmt.Printf("Pending balance: %v sats\n", pendingBalance)
@@ -160,7 +252,8 @@ func getBalance(ctx *cli.Context) error {
 }
 
 const (
-	preimageFlag = "preimage"
+	preimageFlag   = "preimage"
+	ignoreFeesFlag = "ignore-fees"
 )
 
 var receiveCmd = &cli.Command{
@@ -174,6 +267,11 @@ var receiveCmd = &cli.Command{
 			Name:  preimageFlag,
 			Usage: "preimage if receiving ecash HTLC",
 		},
+		&cli.BoolFlag{
+			Name:               ignoreFeesFlag,
+			Usage:              "receive even if the fees exceed RECEIVE_MAX_FEE_PERCENT or RECEIVE_MIN_AMOUNT",
+			DisableDefaultText: true,
+		},
 	},
 }
 
@@ -203,6 +301,10 @@ func receive(ctx *cli.Context) error {
 	swap := true
 	trustedMints := nutw.TrustedMints()
 
+	if tokenV3, ok := token.(*cashu.TokenV3); ok && len(tokenV3.SplitByMint()) > 1 {
+		return receiveMultiMint(*tokenV3, trustedMints)
+	}
+
 	isTrusted := slices.Contains(trustedMints, mintURL)
 	if !isTrusted {
 		fmt.Printf("Token received comes from an untrusted mint: %v. Do you wish to trust this mint? (y/n) ", mintURL)
@@ -225,8 +327,17 @@ func receive(ctx *cli.Context) error {
 		swap = false
 	}
 
-	receivedAmount, err := nutw.Receive(token, swap)
+	receive := nutw.Receive
+	if ctx.Bool(ignoreFeesFlag) {
+		receive = nutw.ReceiveIgnoringFeePolicy
+	}
+	receivedAmount, err := receive(token, swap)
 	if err != nil {
+		var feeErr *wallet.ReceiveFeeError
+		if errors.As(err, &feeErr) {
+			printErr(fmt.Errorf("token too small to redeem economically: fees would be %v sats (%.1f%%) of %v sats. "+
+				"Use --%v to receive it anyway", feeErr.Fees, feeErr.FeePercent(), feeErr.Amount, ignoreFeesFlag))
+		}
 		printErr(err)
 	}
 
@@ -234,7 +345,144 @@ func receive(ctx *cli.Context) error {
 	return nil
 }
 
-const invoiceFlag = "invoice"
+// receiveMultiMint receives a V3 token with proofs from several mints.
+// Proofs from untrusted mints are swapped to the default mint unless
+// the user chooses to trust them.
+func receiveMultiMint(token cashu.TokenV3, trustedMints []string) error {
+	var untrusted []string
+	for _, mintToken := range token.SplitByMint() {
+		if !slices.Contains(trustedMints, mintToken.Mint()) {
+			untrusted = append(untrusted, mintToken.Mint())
+		}
+	}
+
+	swap := false
+	if len(untrusted) > 0 {
+		fmt.Printf("Token received has proofs from untrusted mints: %v. Do you wish to trust these mints? (y/n) ",
+			strings.Join(untrusted, ", "))
+
+		reader := bufio.NewReader(os.Stdin)
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			log.Fatal("error reading input, please try again")
+		}
+		input = strings.ToLower(strings.TrimSpace(input))
+		if input == "y" || input == "yes" {
+			fmt.Println("Tokens from unknown mints will be added")
+		} else {
+			fmt.Println("Tokens will be swapped to your default trusted mint")
+			swap = true
+		}
+	}
+
+	receipts, err := nutw.ReceiveByMint(token, swap)
+	var received uint64
+	for _, receipt := range receipts {
+		if receipt.Err != nil {
+			fmt.Printf("%v: could not receive %v sats: %v\n", receipt.Mint, receipt.Amount, receipt.Err)
+			continue
+		}
+		fmt.Printf("%v: %v sats received\n", receipt.Mint, receipt.Received)
+		received += receipt.Received
+	}
+	fmt.Printf("%v sats received\n", received)
+	if err != nil {
+		printErr(errors.New("could not receive the proofs from all the mints in the token"))
+	}
+	return nil
+}
+
+const (
+	concurrencyFlag = "concurrency"
+	addMintsFlag    = "add-mints"
+)
+
+var receiveBatchCmd = &cli.Command{
+	Name:      "receive-batch",
+	Usage:     "Receive tokens from a file or stdin with one token per line",
+	ArgsUsage: "[FILE]",
+	Before:    setupWallet,
+	Action:    receiveBatch,
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  concurrencyFlag,
+			Usage: "max number of tokens checked against their mints at the same time",
+			Value: 4,
+		},
+		&cli.BoolFlag{
+			Name:               addMintsFlag,
+			Usage:              "add the mints of the tokens to the wallet instead of swapping to the default mint",
+			DisableDefaultText: true,
+		},
+		&cli.BoolFlag{
+			Name:               ignoreFeesFlag,
+			Usage:              "receive even if the fees exceed RECEIVE_MAX_FEE_PERCENT or RECEIVE_MIN_AMOUNT",
+			DisableDefaultText: true,
+		},
+	},
+}
+
+func receiveBatch(ctx *cli.Context) error {
+	input := os.Stdin
+	if path := ctx.Args().First(); len(path) > 0 && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			printErr(err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	// skip empty lines and comments
+	var tokens []string
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) > 0 && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		printErr(fmt.Errorf("error reading tokens: %v", err))
+	}
+	if len(tokens) == 0 {
+		printErr(errors.New("no tokens to receive"))
+	}
+
+	receipts := nutw.ReceiveBatch(tokens, wallet.BatchReceiveOptions{
+		Concurrency:     ctx.Int(concurrencyFlag),
+		SwapToTrusted:   !ctx.Bool(addMintsFlag),
+		IgnoreFeePolicy: ctx.Bool(ignoreFeesFlag),
+	})
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "#\tMINT\tAMOUNT\tRECEIVED\tSTATUS\tREASON")
+	counts := make(map[wallet.BatchReceiveStatus]int)
+	var received uint64
+	for _, receipt := range receipts {
+		reason := ""
+		if receipt.Err != nil {
+			reason = receipt.Err.Error()
+		}
+		fmt.Fprintf(writer, "%v\t%v\t%v\t%v\t%v\t%v\n", receipt.Index+1, receipt.Mint,
+			receipt.Amount, receipt.Received, receipt.Status, reason)
+		counts[receipt.Status]++
+		received += receipt.Received
+	}
+	writer.Flush()
+
+	fmt.Printf("\n%v accepted, %v already spent, %v failed. %v sats received\n",
+		counts[wallet.BatchReceiveAccepted], counts[wallet.BatchReceiveAlreadySpent],
+		counts[wallet.BatchReceiveFailed], received)
+	return nil
+}
+
+const (
+	invoiceFlag     = "invoice"
+	waitFlag        = "wait"
+	descriptionFlag = "description"
+)
 
 var mintCmd = &cli.Command{
 	Name:      "mint",
@@ -246,6 +494,14 @@ var mintCmd = &cli.Command{
 			Name:  invoiceFlag,
 			Usage: "Specify paid invoice to mint tokens",
 		},
+		&cli.DurationFlag{
+			Name:  waitFlag,
+			Usage: "wait up to the duration for the invoice to be paid and mint the tokens",
+		},
+		&cli.StringFlag{
+			Name:  descriptionFlag,
+			Usage: "memo of the invoice if the mint supports it",
+		},
 	},
 	Action: mint,
 }
@@ -265,7 +521,7 @@ func mint(ctx *cli.Context) error {
 		printErr(errors.New("specify an amount to mint"))
 	}
 	amountStr := args.First()
-	err := requestMint(amountStr)
+	err := requestMint(amountStr, ctx.String(descriptionFlag), ctx.Duration(waitFlag))
 	if err != nil {
 		printErr(err)
 	}
@@ -273,19 +529,32 @@ func mint(ctx *cli.Context) error {
 	return nil
 }
 
-func requestMint(amountStr string) error {
+func requestMint(amountStr, description string, wait time.Duration) error {
 	amount, err := strconv.ParseUint(amountStr, 10, 64)
 	if err != nil {
 		return errors.New("invalid amount")
 	}
 
-	mintResponse, err := nutw.RequestMint(amount, nutw.CurrentMint())
+	mintResponse, err := nutw.RequestMintWithDescription(amount, nutw.CurrentMint(), description)
 	if err != nil {
 		return err
 	}
 
 	fmt.Printf("invoice: %v\n\n", mintResponse.Request)
-	fmt.Println("after paying the invoice you can redeem the ecash using the --invoice flag")
+	if wait <= 0 {
+		fmt.Println("after paying the invoice you can redeem the ecash using the --invoice flag")
+		return nil
+	}
+
+	fmt.Println("waiting for the invoice to be paid...")
+	mintedAmount, err := nutw.MintWhenPaid(context.Background(), mintResponse.Quote, wallet.WaitOptions{Timeout: wait})
+	if err != nil {
+		if errors.Is(err, wallet.ErrWaitTimeout) {
+			fmt.Println("invoice was not paid. After paying it you can redeem the ecash using the --invoice flag")
+		}
+		return err
+	}
+	fmt.Printf("%v sats successfully minted\n", mintedAmount)
 	return nil
 }
 
@@ -313,6 +582,7 @@ const (
 	refundKeysFlag   = "refund-keys"
 	noFeesFlag       = "no-fees"
 	legacyFlag       = "legacy"
+	tokenVersionFlag = "token-version"
 	includeDLEQFlag  = "include-dleq"
 )
 
@@ -364,6 +634,10 @@ var sendCmd = &cli.Command{
 			Usage:              "generate token in legacy (V3) format",
 			DisableDefaultText: true,
 		},
+		&cli.StringFlag{
+			Name:  tokenVersionFlag,
+			Usage: "version of the token generated (v3 or v4). Overrides TOKEN_VERSION",
+		},
 		&cli.BoolFlag{
 			Name:               includeDLEQFlag,
 			Usage:              "include DLEQ proofs",
@@ -459,16 +733,21 @@ func send(ctx *cli.Context) error {
 		includeDLEQ = true
 	}
 
-	var token cashu.Token
+	tokenVersion := wallet.DefaultTokenVersion
 	if ctx.Bool(legacyFlag) {
-		token, _ = cashu.NewTokenV3(proofsToSend, selectedMint, cashu.Sat, includeDLEQ)
-	} else {
-		token, err = cashu.NewTokenV4(proofsToSend, selectedMint, cashu.Sat, includeDLEQ)
+		tokenVersion = wallet.TokenV3
+	} else if ctx.IsSet(tokenVersionFlag) {
+		tokenVersion, err = wallet.ParseTokenVersion(ctx.String(tokenVersionFlag))
 		if err != nil {
-			printErr(fmt.Errorf("could not serialize token: %v", err))
+			printErr(err)
 		}
 	}
 
+	token, err := nutw.NewToken(proofsToSend, selectedMint, tokenVersion, includeDLEQ)
+	if err != nil {
+		printErr(fmt.Errorf("could not serialize token: %v", err))
+	}
+
 	tokenString, err := token.Serialize()
 	if err != nil {
 		printErr(fmt.Errorf("could not serialize token: %v", err))
@@ -479,18 +758,32 @@ func send(ctx *cli.Context) error {
 }
 
 const (
-	multimintFlag = "multimint"
+	multimintFlag   = "multimint"
+	requoteFlag     = "requote"
+	offerAmountFlag = "amount"
 )
 
 var payCmd = &cli.Command{
 	Name:      "pay",
-	Usage:     "Pay a lightning invoice",
-	ArgsUsage: "[INVOICE]",
+	Usage:     "Pay a lightning invoice or BOLT12 offer",
+	ArgsUsage: "[INVOICE|OFFER]",
 	Flags: []cli.Flag{
+		&cli.Uint64Flag{
+			Name:  offerAmountFlag,
+			Usage: "amount in sats to pay to an offer for any amount",
+		},
 		&cli.BoolFlag{
 			Name:  multimintFlag,
 			Usage: "pay invoice using funds from multiple mints",
 		},
+		&cli.DurationFlag{
+			Name:  waitFlag,
+			Usage: "if the payment is pending, wait up to the duration for it to complete",
+		},
+		&cli.IntFlag{
+			Name:  requoteFlag,
+			Usage: "if the payment fails, retry it up to this many times with a higher fee reserve",
+		},
 	},
 	Before: setupWallet,
 	Action: pay,
@@ -502,11 +795,19 @@ func pay(ctx *cli.Context) error {
 		printErr(errors.New("specify a lightning invoice to pay"))
 	}
 	invoice := args.First()
+	isOffer := wallet.IsOffer(invoice)
+	if isOffer && ctx.Bool(multimintFlag) {
+		printErr(errors.New("offers can not be paid with funds from multiple mints"))
+	}
 
-	// check invoice passed is valid
-	bolt11, err := decodepay.Decodepay(invoice)
-	if err != nil {
-		printErr(fmt.Errorf("invalid invoice: %v", err))
+	var bolt11 decodepay.Bolt11
+	if !isOffer {
+		// check invoice passed is valid
+		var err error
+		bolt11, err = decodepay.Decodepay(invoice)
+		if err != nil {
+			printErr(fmt.Errorf("invalid invoice: %v", err))
+		}
 	}
 
 	if ctx.Bool(multimintFlag) {
@@ -520,6 +821,9 @@ func pay(ctx *cli.Context) error {
 			fmt.Printf("Mint %v: %v ---- balance: %v sats\n", i+1, mint, balance)
 		}
 
+		if bolt11.MSatoshi%1000 != 0 {
+			printErr(fmt.Errorf("invoice amount of %v msat can not be split in sats", bolt11.MSatoshi))
+		}
 		invoiceAmount := bolt11.MSatoshi / 1000
 		fmt.Printf("\nAmount of invoice to pay: %v", invoiceAmount)
 
@@ -572,7 +876,15 @@ func pay(ctx *cli.Context) error {
 					printErr(fmt.Errorf("could not do multimint payment: %v", err))
 				}
 
-				for _, response := range meltResponses {
+				for i, response := range meltResponses {
+					if response.State == nut05.Pending && ctx.Duration(waitFlag) > 0 {
+						opts := wallet.WaitOptions{Timeout: ctx.Duration(waitFlag)}
+						state, err := nutw.WaitForMeltQuote(context.Background(), response.Quote, opts)
+						if err == nil {
+							response = *state
+							meltResponses[i] = response
+						}
+					}
 					if response.State == nut05.Pending {
 						fmt.Println("payment is pending")
 						return nil
@@ -595,7 +907,13 @@ func pay(ctx *cli.Context) error {
 	} else {
 		// do regular single mint payment if multimint not set
 		selectedMint := promptMintSelection("pay invoice")
-		meltQuote, err := nutw.RequestMeltQuote(invoice, selectedMint)
+		var meltQuote *nut05.PostMeltQuoteBolt11Response
+		var err error
+		if isOffer {
+			meltQuote, err = nutw.RequestMeltQuoteBolt12(invoice, ctx.Uint64(offerAmountFlag), selectedMint)
+		} else {
+			meltQuote, err = nutw.RequestMeltQuote(invoice, selectedMint)
+		}
 		if err != nil {
 			printErr(err)
 		}
@@ -604,6 +922,30 @@ func pay(ctx *cli.Context) error {
 		if err != nil {
 			printErr(err)
 		}
+		// the payment could have failed because the fee reserve was not enough
+		for i := 0; i < ctx.Int(requoteFlag) && meltResult.State == nut05.Unpaid; i++ {
+			meltQuote, err = nutw.RequoteMelt(meltQuote.Quote)
+			if err != nil {
+				printErr(err)
+			}
+			fmt.Printf("payment failed. Retrying with fee reserve of %v\n", meltQuote.FeeReserve)
+			meltResult, err = nutw.Melt(meltQuote.Quote)
+			if err != nil {
+				printErr(err)
+			}
+		}
+		if meltResult.State == nut05.Pending && ctx.Duration(waitFlag) > 0 {
+			fmt.Println("payment is pending. Waiting for it to complete...")
+			opts := wallet.WaitOptions{Timeout: ctx.Duration(waitFlag)}
+			meltResult, err = nutw.WaitForMeltQuote(context.Background(), meltQuote.Quote, opts)
+			if err != nil && !errors.Is(err, wallet.ErrWaitTimeout) {
+				printErr(err)
+			}
+			if err != nil {
+				fmt.Println("payment is still pending")
+				return nil
+			}
+		}
 
 		switch meltResult.State {
 		case nut05.Paid:
@@ -621,6 +963,8 @@ func pay(ctx *cli.Context) error {
 const (
 	removeFlag  = "remove"
 	reclaimFlag = "reclaim"
+	lockedFlag  = "locked"
+	reissueFlag = "reissue"
 )
 
 var pendingCmd = &cli.Command{
@@ -639,6 +983,15 @@ var pendingCmd = &cli.Command{
 			Usage:              "reclaim unspent pending proofs",
 			DisableDefaultText: true,
 		},
+		&cli.BoolFlag{
+			Name:               lockedFlag,
+			Usage:              "export unspent locked ecash (P2PK or HTLC) that was sent",
+			DisableDefaultText: true,
+		},
+		&cli.StringFlag{
+			Name:  reissueFlag,
+			Usage: "reclaim P2PK locked ecash with the id that expired unclaimed and send it again with a new locktime",
+		},
 	},
 }
 
@@ -666,6 +1019,44 @@ func pending(ctx *cli.Context) error {
 		return nil
 	}
 
+	if ctx.IsSet(reissueFlag) {
+		lockedToken, err := nutw.ReissueLockedSend(ctx.String(reissueFlag), nil, nil, false)
+		if err != nil {
+			printErr(err)
+		}
+		fmt.Printf("[%v] %v sats locked to %v until %v\n", lockedToken.Id, lockedToken.Amount,
+			lockedToken.LockTarget, time.Unix(lockedToken.Locktime, 0).Format(time.RFC3339))
+		fmt.Printf("%v\n", lockedToken.Token)
+		return nil
+	}
+
+	if ctx.Bool(lockedFlag) {
+		lockedTokens, err := nutw.ExportLockedTokens()
+		if err != nil {
+			printErr(err)
+		}
+		if len(lockedTokens) == 0 {
+			fmt.Println("no unspent locked ecash")
+			return nil
+		}
+
+		for _, lockedToken := range lockedTokens {
+			fmt.Printf("[%v] %v sats from %v locked with %v to %v\n",
+				lockedToken.Id, lockedToken.Amount, lockedToken.Mint, lockedToken.Kind, lockedToken.LockTarget)
+			if len(lockedToken.Pubkeys) > 0 {
+				fmt.Printf("additional public keys: %v\n", lockedToken.Pubkeys)
+			}
+			if lockedToken.Locktime > 0 {
+				fmt.Printf("locktime: %v\n", time.Unix(lockedToken.Locktime, 0).Format(time.RFC3339))
+			}
+			if len(lockedToken.RefundKeys) > 0 {
+				fmt.Printf("refund public keys: %v\n", lockedToken.RefundKeys)
+			}
+			fmt.Printf("%v\n\n", lockedToken.Token)
+		}
+		return nil
+	}
+
 	pendingBalance := nutw.PendingBalance()
 	fmt.Printf("Pending balance: %v sats\n", pendingBalance)
 	return nil
@@ -673,6 +1064,7 @@ func pending(ctx *cli.Context) error {
 
 const (
 	checkFlag = "check"
+	renewFlag = "renew"
 )
 
 var quotesCmd = &cli.Command{
@@ -684,6 +1076,10 @@ var quotesCmd = &cli.Command{
 			Name:  checkFlag,
 			Usage: "check state of quote",
 		},
+		&cli.StringFlag{
+			Name:  renewFlag,
+			Usage: "renew unpaid mint quote before it expires while running 'nutw watch'",
+		},
 	},
 	Action: quotes,
 }
@@ -691,6 +1087,15 @@ var quotesCmd = &cli.Command{
 func quotes(ctx *cli.Context) error {
 	pendingQuotes := nutw.GetPendingMeltQuotes()
 
+	if ctx.IsSet(renewFlag) {
+		quote := ctx.String(renewFlag)
+		if err := nutw.SetQuoteRenewal(quote, true); err != nil {
+			printErr(err)
+		}
+		fmt.Printf("mint quote '%v' will be renewed before it expires\n", quote)
+		return nil
+	}
+
 	if ctx.IsSet(checkFlag) {
 		quote := ctx.String(checkFlag)
 
@@ -753,9 +1158,80 @@ func mnemonic(ctx *cli.Context) error {
 	return nil
 }
 
+var fingerprintCmd = &cli.Command{
+	Name:   "fingerprint",
+	Usage:  "Fingerprint of the seed to compare wallets across devices",
+	Before: setupWallet,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:               checkFlag,
+			Usage:              "check with the trusted mints if another device used the seed",
+			DisableDefaultText: true,
+		},
+	},
+	Action: fingerprint,
+}
+
+func fingerprint(ctx *cli.Context) error {
+	fmt.Printf("fingerprint: %v\n", nutw.Fingerprint())
+	if !ctx.Bool(checkFlag) {
+		return nil
+	}
+
+	for _, mint := range nutw.TrustedMints() {
+		conflict, err := nutw.CheckCounters(mint)
+		if err != nil {
+			fmt.Printf("could not check counters with mint '%v': %v\n", mint, err)
+			continue
+		}
+		if conflict == nil {
+			fmt.Printf("%v: no outputs from other devices\n", mint)
+		}
+	}
+	return nil
+}
+
+// warnCounterConflicts prints the conflicts with other
+// devices using the seed found while running a command
+func warnCounterConflicts(ctx *cli.Context) error {
+	if nutw == nil {
+		return nil
+	}
+	for _, conflict := range nutw.CounterConflicts() {
+		fmt.Fprintf(os.Stderr, "warning: another device is using the seed of this wallet with mint '%v'. "+
+			"Moved counter of keyset '%v' from %v to %v\n",
+			conflict.Mint, conflict.KeysetId, conflict.Counter, conflict.NextCounter)
+	}
+	return nil
+}
+
+const (
+	restoreMintsFlag = "mints"
+	gapLimitFlag     = "gap-limit"
+	batchSizeFlag    = "batch-size"
+)
+
 var restoreCmd = &cli.Command{
-	Name:   "restore",
-	Usage:  "Restore wallet from mnemonic",
+	Name:  "restore",
+	Usage: "Restore wallet from mnemonic",
+	Description: "Scans all the keysets of the mints for proofs of the mnemonic. " +
+		"If a restore is interrupted, running it again with the same mnemonic resumes it.",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  restoreMintsFlag,
+			Usage: "mints to restore from. Current mint if not set",
+		},
+		&cli.IntFlag{
+			Name:  gapLimitFlag,
+			Usage: "consecutive batches without proofs after which the scan of a keyset stops",
+			Value: nut13.DefaultGapLimit,
+		},
+		&cli.IntFlag{
+			Name:  batchSizeFlag,
+			Usage: "number of outputs checked with the mint in each request",
+			Value: nut13.DefaultBatchSize,
+		},
+	},
 	Action: restore,
 }
 
@@ -773,12 +1249,29 @@ func restore(ctx *cli.Context) error {
 	}
 	mnemonic = mnemonic[:len(mnemonic)-1]
 
-	amountRestored, err := wallet.Restore(config.WalletPath, mnemonic, []string{config.CurrentMintURL})
+	mints := ctx.StringSlice(restoreMintsFlag)
+	if len(mints) == 0 {
+		mints = []string{config.CurrentMintURL}
+	}
+	restoreConfig := wallet.RestoreConfig{
+		Mints:     mints,
+		BatchSize: ctx.Int(batchSizeFlag),
+		GapLimit:  ctx.Int(gapLimitFlag),
+		OnProgress: func(progress storage.RestoreProgress) {
+			if progress.Done {
+				fmt.Printf("%v: keyset '%v' restored %v\n", progress.Mint, progress.KeysetId, progress.Restored)
+			} else {
+				fmt.Printf("%v: keyset '%v' scanned up to counter %v\n", progress.Mint, progress.KeysetId, progress.Counter)
+			}
+		},
+	}
+
+	amountRestored, err := wallet.RestoreWithConfig(config.WalletPath, mnemonic, restoreConfig)
 	if err != nil {
 		printErr(fmt.Errorf("error restoring wallet: %v", err))
 	}
 
-	fmt.Printf("restored proofs for amount: %v\n", amountRestored)
+	fmt.Printf("restored proofs for amount: %v sats\n", amountRestored)
 	return nil
 }
 
@@ -868,6 +1361,496 @@ func decode(ctx *cli.Context) error {
 	return nil
 }
 
+const (
+	intervalFlag = "interval"
+	autoMintFlag = "mint"
+)
+
+var watchCmd = &cli.Command{
+	Name:   "watch",
+	Usage:  "watch for paid quotes and spent tokens and show balance updates",
+	Before: setupWallet,
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  intervalFlag,
+			Usage: "how often to check state in mints without websocket support",
+			Value: wallet.DefaultWatchInterval,
+		},
+		&cli.BoolFlag{
+			Name:               autoMintFlag,
+			Usage:              "mint tokens when a mint quote is paid",
+			DisableDefaultText: true,
+		},
+	},
+	Action: watch,
+}
+
+func watch(ctx *cli.Context) error {
+	watchCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	autoMint := ctx.Bool(autoMintFlag)
+	fmt.Printf("Watching wallet. Balance: %v sats\n", nutw.GetBalance())
+	handler := func(event wallet.Event) {
+		switch event.Kind {
+		case wallet.MintQuotePaid:
+			fmt.Printf("Invoice for mint quote '%v' of %v sats was paid\n", event.QuoteId, event.Amount)
+			if autoMint {
+				mintedAmount, err := nutw.MintTokens(event.QuoteId)
+				if err != nil {
+					fmt.Printf("could not mint tokens: %v\n", err)
+				} else {
+					fmt.Printf("%v sats successfully minted\n", mintedAmount)
+				}
+			}
+		case wallet.MeltQuotePaid:
+			fmt.Printf("Payment for melt quote '%v' of %v sats succeeded\n", event.QuoteId, event.Amount)
+		case wallet.MeltQuoteFailed:
+			fmt.Printf("Payment for melt quote '%v' of %v sats failed\n", event.QuoteId, event.Amount)
+		case wallet.ProofsSpent:
+			fmt.Printf("Token of %v sats sent from mint '%v' was received\n", event.Amount, event.Mint)
+		case wallet.MintRetiring:
+			fmt.Printf("Mint '%v' is retiring. Motd: '%v'\n", event.Mint, event.Motd)
+			fmt.Printf("Move the balance in it with 'nutw evacuate %v <MINT URL>'\n", event.Mint)
+		case wallet.MintQuoteRenewed:
+			fmt.Printf("Mint quote '%v' was renewed with quote '%v'. Invoice: %v\n",
+				event.PreviousQuoteId, event.QuoteId, event.PaymentRequest)
+		case wallet.MintQuoteRenewalFailed:
+			fmt.Printf("Mint quote '%v' expired and could not be renewed: %v\n", event.QuoteId, event.Err)
+		}
+		fmt.Printf("Balance: %v sats ---- pending balance: %v sats\n", nutw.GetBalance(), nutw.PendingBalance())
+	}
+
+	if err := nutw.Watch(watchCtx, ctx.Duration(intervalFlag), handler); err != nil {
+		printErr(err)
+	}
+	return nil
+}
+
+const (
+	sampleFlag     = "sample"
+	quarantineFlag = "quarantine"
+)
+
+var reconcileCmd = &cli.Command{
+	Name:   "reconcile",
+	Usage:  "check that a sample of the proofs in the wallet are unspent in the mints",
+	Before: setupWallet,
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  sampleFlag,
+			Usage: "number of proofs to check from each mint",
+			Value: wallet.DefaultReconcileSampleSize,
+		},
+		&cli.BoolFlag{
+			Name:               quarantineFlag,
+			Usage:              "remove proofs that the mint reports as spent from the wallet",
+			DisableDefaultText: true,
+		},
+		&cli.DurationFlag{
+			Name:  intervalFlag,
+			Usage: "keep checking every interval instead of once",
+		},
+	},
+	Action: reconcile,
+}
+
+func reconcile(ctx *cli.Context) error {
+	options := wallet.ReconcileOptions{
+		Interval:   ctx.Duration(intervalFlag),
+		SampleSize: ctx.Int(sampleFlag),
+		Quarantine: ctx.Bool(quarantineFlag),
+	}
+	printReport := func(report wallet.ReconcileReport) {
+		for mint, checked := range report.Checked {
+			fmt.Printf("Checked %v proofs from mint '%v'\n", checked, mint)
+		}
+		for mint, err := range report.Errors {
+			fmt.Printf("Could not check proofs from mint '%v': %v\n", mint, err)
+		}
+		for _, discrepancy := range report.Discrepancies {
+			fmt.Printf("Proof of %v sats from mint '%v' is %v", discrepancy.Amount, discrepancy.Mint, discrepancy.State)
+			if discrepancy.Quarantined {
+				fmt.Print(" (quarantined)")
+			}
+			fmt.Println()
+		}
+		if len(report.Discrepancies) == 0 {
+			fmt.Println("No discrepancies found")
+		}
+	}
+
+	if options.Interval <= 0 {
+		report, err := nutw.Reconcile(options)
+		if err != nil {
+			printErr(err)
+		}
+		printReport(report)
+		return nil
+	}
+
+	reconcileCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := nutw.RunReconcile(reconcileCtx, options, printReport); err != nil {
+		printErr(err)
+	}
+	return nil
+}
+
+var refreshCmd = &cli.Command{
+	Name:      "refresh",
+	Usage:     "swap proofs for new ones so the mint can't link them to how they were received",
+	ArgsUsage: "[MINT URL]",
+	Before:    setupWallet,
+	Action:    refresh,
+}
+
+func refresh(ctx *cli.Context) error {
+	var refreshed uint64
+	var err error
+	if args := ctx.Args(); args.Len() > 0 {
+		refreshed, err = nutw.RefreshProofs(args.First())
+	} else {
+		refreshed, err = nutw.RefreshAllProofs()
+	}
+	fmt.Printf("%v sats refreshed\n", refreshed)
+	if err != nil {
+		printErr(err)
+	}
+	return nil
+}
+
+var evacuateCmd = &cli.Command{
+	Name:      "evacuate",
+	Usage:     "move the whole balance in a mint (i.e a mint that is retiring) to another trusted mint",
+	ArgsUsage: "[FROM MINT URL] [TO MINT URL]",
+	Before:    setupWallet,
+	Action:    evacuate,
+}
+
+func evacuate(ctx *cli.Context) error {
+	args := ctx.Args()
+	if args.Len() < 2 {
+		printErr(errors.New("specify the mint to move the balance from and the mint to move it to"))
+	}
+	from, to := args.Get(0), args.Get(1)
+
+	retirement, err := nutw.CheckMintRetirement(from)
+	if err == nil && !retirement.Retiring() {
+		fmt.Printf("mint '%v' does not show signs of retiring\n", from)
+	}
+
+	result, err := nutw.EvacuateMint(from, to)
+	fmt.Printf("%v sats moved to '%v' with fees of %v sats\n", result.Moved, to, result.Fees)
+	if result.Pending > 0 {
+		fmt.Printf("%v sats in pending payments. Check them with 'nutw pending' and mint them with 'nutw mint --invoice'\n", result.Pending)
+	}
+	if result.Remaining > 0 {
+		fmt.Printf("%v sats left in '%v'\n", result.Remaining, from)
+	}
+	if err != nil {
+		printErr(err)
+	}
+	return nil
+}
+
+const (
+	atFlag      = "at"
+	inFlag      = "in"
+	everyFlag   = "every"
+	addressFlag = "address"
+)
+
+var scheduleCmd = &cli.Command{
+	Name:   "schedule",
+	Usage:  "list, add and run payments scheduled for a future time",
+	Before: setupWallet,
+	Subcommands: []*cli.Command{
+		{
+			Name:      "add",
+			Usage:     "schedule a token or a payment to a lightning address",
+			ArgsUsage: "[AMOUNT]",
+			Flags: []cli.Flag{
+				&cli.TimestampFlag{
+					Name:   atFlag,
+					Usage:  "time to make the payment. i.e 2025-01-02T15:04:05Z",
+					Layout: time.RFC3339,
+				},
+				&cli.DurationFlag{
+					Name:  inFlag,
+					Usage: "make the payment after the duration. i.e 24h",
+				},
+				&cli.DurationFlag{
+					Name:  everyFlag,
+					Usage: "make the payment again every duration",
+				},
+				&cli.StringFlag{
+					Name:  addressFlag,
+					Usage: "lightning address to pay instead of creating a token",
+				},
+				&cli.StringFlag{
+					Name:  p2pklockFlag,
+					Usage: "lock the token to a public key",
+				},
+			},
+			Action: addScheduledPayment,
+		},
+		{
+			Name:      "cancel",
+			Usage:     "cancel a scheduled payment",
+			ArgsUsage: "[ID]",
+			Action:    cancelScheduledPayment,
+		},
+		{
+			Name:  "run",
+			Usage: "make the scheduled payments when they are due and print the tokens created",
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:  intervalFlag,
+					Usage: "how often to check for payments that are due",
+					Value: wallet.DefaultScheduleInterval,
+				},
+			},
+			Action: runScheduledPayments,
+		},
+	},
+	Action: listScheduledPayments,
+}
+
+func listScheduledPayments(ctx *cli.Context) error {
+	payments := nutw.ScheduledPayments()
+	if len(payments) == 0 {
+		fmt.Println("no scheduled payments")
+		return nil
+	}
+	for _, payment := range payments {
+		target := "token"
+		if payment.Kind == storage.ScheduledMelt {
+			target = payment.Target
+		} else if len(payment.Target) > 0 {
+			target = "token locked to " + payment.Target
+		}
+		fmt.Printf("%v: %v sats to %v from '%v' at %v",
+			payment.Id, payment.Amount, target, payment.Mint, time.Unix(payment.At, 0).Format(time.RFC3339))
+		if payment.Interval > 0 {
+			fmt.Printf(" every %v", time.Duration(payment.Interval)*time.Second)
+		}
+		fmt.Println()
+		if payment.Attempts > 0 {
+			fmt.Printf("    %v failed attempts. Last error: %v\n", payment.Attempts, payment.LastError)
+		}
+	}
+	return nil
+}
+
+func addScheduledPayment(ctx *cli.Context) error {
+	args := ctx.Args()
+	if args.Len() < 1 {
+		printErr(errors.New("specify an amount to schedule"))
+	}
+	amount, err := strconv.ParseUint(args.First(), 10, 64)
+	if err != nil {
+		printErr(err)
+	}
+
+	var at time.Time
+	switch {
+	case ctx.IsSet(atFlag) && ctx.IsSet(inFlag):
+		printErr(fmt.Errorf("specify only one of --%v or --%v", atFlag, inFlag))
+	case ctx.IsSet(atFlag):
+		at = *ctx.Timestamp(atFlag)
+	case ctx.IsSet(inFlag):
+		at = time.Now().Add(ctx.Duration(inFlag))
+	default:
+		printErr(fmt.Errorf("specify when to make the payment with --%v or --%v", atFlag, inFlag))
+	}
+
+	target := wallet.PaymentTarget{
+		Mint:             promptMintSelection("schedule payment"),
+		LightningAddress: ctx.String(addressFlag),
+	}
+	if ctx.IsSet(p2pklockFlag) {
+		lockbytes, err := hex.DecodeString(ctx.String(p2pklockFlag))
+		if err != nil {
+			printErr(err)
+		}
+		target.Pubkey, err = secp256k1.ParsePubKey(lockbytes)
+		if err != nil {
+			printErr(err)
+		}
+	}
+
+	var payment storage.ScheduledPayment
+	if ctx.IsSet(everyFlag) {
+		payment, err = nutw.ScheduleRecurringPayment(at, ctx.Duration(everyFlag), amount, target)
+	} else {
+		payment, err = nutw.SchedulePayment(at, amount, target)
+	}
+	if err != nil {
+		printErr(err)
+	}
+	fmt.Printf("scheduled payment '%v' at %v. Run 'nutw schedule run' to make it when it is due\n",
+		payment.Id, at.Format(time.RFC3339))
+	return nil
+}
+
+func cancelScheduledPayment(ctx *cli.Context) error {
+	args := ctx.Args()
+	if args.Len() < 1 {
+		printErr(errors.New("specify the id of the scheduled payment"))
+	}
+	if err := nutw.CancelScheduledPayment(args.First()); err != nil {
+		printErr(err)
+	}
+	fmt.Println("scheduled payment canceled")
+	return nil
+}
+
+func runScheduledPayments(ctx *cli.Context) error {
+	runCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Printf("Running %v scheduled payments\n", len(nutw.ScheduledPayments()))
+	handler := func(event wallet.Event) {
+		switch event.Kind {
+		case wallet.ScheduledPaymentMade:
+			if len(event.Token) > 0 {
+				fmt.Printf("Scheduled payment '%v' of %v sats. Token:\n%v\n", event.PaymentId, event.Amount, event.Token)
+			} else {
+				fmt.Printf("Scheduled payment '%v' of %v sats made with melt quote '%v'\n",
+					event.PaymentId, event.Amount, event.QuoteId)
+			}
+		case wallet.ScheduledPaymentFailed:
+			fmt.Printf("Scheduled payment '%v' of %v sats failed: %v\n", event.PaymentId, event.Amount, event.Err)
+		}
+	}
+
+	if err := nutw.RunScheduledPayments(runCtx, ctx.Duration(intervalFlag), handler); err != nil {
+		printErr(err)
+	}
+	return nil
+}
+
+const (
+	fromFlag   = "from"
+	toFlag     = "to"
+	formatFlag = "format"
+	outputFlag = "output"
+)
+
+var statementCmd = &cli.Command{
+	Name:      "statement",
+	Usage:     "export the transactions and balance of a mint in a period",
+	ArgsUsage: "[MINT URL]",
+	Before:    setupWallet,
+	Flags: []cli.Flag{
+		&cli.TimestampFlag{
+			Name:   fromFlag,
+			Usage:  "start date of the statement. i.e 2025-01-01. All transactions if not set",
+			Layout: time.DateOnly,
+		},
+		&cli.TimestampFlag{
+			Name:   toFlag,
+			Usage:  "end date of the statement (not included). Now if not set",
+			Layout: time.DateOnly,
+		},
+		&cli.StringFlag{
+			Name:  formatFlag,
+			Usage: "format of the statement: csv or json",
+			Value: "csv",
+		},
+		&cli.StringFlag{
+			Name:  outputFlag,
+			Usage: "file to write the statement to instead of printing it",
+		},
+	},
+	Action: exportStatement,
+}
+
+func exportStatement(ctx *cli.Context) error {
+	mint := nutw.CurrentMint()
+	if args := ctx.Args(); args.Len() > 0 {
+		mint = args.First()
+	}
+
+	from := time.Unix(0, 0)
+	if ctx.IsSet(fromFlag) {
+		from = *ctx.Timestamp(fromFlag)
+	}
+	var to time.Time
+	if ctx.IsSet(toFlag) {
+		to = *ctx.Timestamp(toFlag)
+	}
+
+	var format wallet.StatementFormat
+	switch ctx.String(formatFlag) {
+	case "csv":
+		format = wallet.StatementCSV
+	case "json":
+		format = wallet.StatementJSON
+	default:
+		printErr(fmt.Errorf("invalid format '%v'. Use csv or json", ctx.String(formatFlag)))
+	}
+
+	statement, err := nutw.ExportStatement(mint, from, to, format)
+	if err != nil {
+		printErr(err)
+	}
+	if output := ctx.String(outputFlag); len(output) > 0 {
+		if err := os.WriteFile(output, statement, 0600); err != nil {
+			printErr(err)
+		}
+		fmt.Printf("statement written to %v\n", output)
+		return nil
+	}
+	fmt.Print(string(statement))
+	return nil
+}
+
+const listenFlag = "listen"
+
+var serveCmd = &cli.Command{
+	Name:   "serve",
+	Usage:  "serve the wallet with an LNbits compatible API",
+	Before: setupWallet,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  listenFlag,
+			Usage: "address to listen on",
+			Value: "127.0.0.1:5000",
+		},
+	},
+	Action: serve,
+}
+
+func serve(ctx *cli.Context) error {
+	server, err := lnbits.NewServer(nutw, lnbits.Config{
+		AdminKey:   os.Getenv("API_ADMIN_KEY"),
+		InvoiceKey: os.Getenv("API_INVOICE_KEY"),
+	})
+	if err != nil {
+		printErr(fmt.Errorf("%v. Set API_ADMIN_KEY and API_INVOICE_KEY", err))
+	}
+
+	httpServer := &http.Server{
+		Addr:              ctx.String(listenFlag),
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		serveCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		<-serveCtx.Done()
+		httpServer.Shutdown(context.Background())
+	}()
+
+	fmt.Printf("Serving wallet API on %v\n", httpServer.Addr)
+	if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		printErr(err)
+	}
+	return nil
+}
+
 func promptMintSelection(action string) string {
 	balanceByMints := nutw.GetBalanceByMints()
 	mintsLen := len(balanceByMints)
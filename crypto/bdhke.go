@@ -13,6 +13,7 @@ import (
 	"reflect"
 
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
 )
 
 const DomainSeparator = "Secp256k1_HashToCurve_Cashu_"
@@ -51,6 +52,19 @@ func HashToCurve(message []byte) (*secp256k1.PublicKey, error) {
 	return nil, errors.New("No valid point found")
 }
 
+// ProofsYs returns the hex encoded Y = hash_to_curve(secret) of each proof
+func ProofsYs(proofs cashu.Proofs) ([]string, error) {
+	Ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		Y, err := HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			return nil, err
+		}
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+	}
+	return Ys, nil
+}
+
 // B_ = Y + rG
 func BlindMessage(secret string, r *secp256k1.PrivateKey) (*secp256k1.PublicKey,
 	*secp256k1.PrivateKey, error) {
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
 )
 
 func TestHashToCurve(t *testing.T) {
@@ -37,6 +38,31 @@ func TestHashToCurve(t *testing.T) {
 	}
 }
 
+func TestProofsYs(t *testing.T) {
+	proofs := cashu.Proofs{{Secret: "secret1"}, {Secret: "secret2"}}
+	Ys, err := ProofsYs(proofs)
+	if err != nil {
+		t.Fatalf("unexpected error computing Ys: %v", err)
+	}
+	if len(Ys) != len(proofs) {
+		t.Fatalf("expected %v Ys but got %v", len(proofs), len(Ys))
+	}
+	for i, proof := range proofs {
+		Y, err := HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := hex.EncodeToString(Y.SerializeCompressed()); Ys[i] != expected {
+			t.Errorf("expected Y '%v' but got '%v'", expected, Ys[i])
+		}
+	}
+
+	Ys, err = ProofsYs(nil)
+	if err != nil || len(Ys) != 0 {
+		t.Fatalf("expected no Ys but got %v and '%v'", Ys, err)
+	}
+}
+
 func TestBlindMessage(t *testing.T) {
 	tests := []struct {
 		secret         string
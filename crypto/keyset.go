@@ -2,10 +2,14 @@ package crypto
 
 import (
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"math"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
@@ -22,6 +26,9 @@ type MintKeyset struct {
 	DerivationPathIdx uint32
 	Keys              map[uint64]KeyPair
 	InputFeePpk       uint
+	// VerifyOnly keysets were imported from another mint. They are only
+	// used to verify proofs and never to sign new outputs.
+	VerifyOnly bool
 }
 
 type KeyPair struct {
@@ -30,19 +37,25 @@ type KeyPair struct {
 }
 
 func DeriveKeysetPath(key *hdkeychain.ExtendedKey, index uint32) (*hdkeychain.ExtendedKey, error) {
+	return DeriveUnitKeysetPath(key, cashu.Sat, index)
+}
+
+// DeriveUnitKeysetPath derives the path m/0'/unit'/index'
+// for the keyset of the unit (0 for sat, 1 for msat, 2 for usd, 3 for eur)
+func DeriveUnitKeysetPath(key *hdkeychain.ExtendedKey, unit cashu.Unit, index uint32) (*hdkeychain.ExtendedKey, error) {
 	// path m/0'
 	child, err := key.Derive(hdkeychain.HardenedKeyStart + 0)
 	if err != nil {
 		return nil, err
 	}
 
-	// path m/0'/0' for sat
-	unitPath, err := child.Derive(hdkeychain.HardenedKeyStart + 0)
+	// path m/0'/unit'
+	unitPath, err := child.Derive(hdkeychain.HardenedKeyStart + uint32(unit))
 	if err != nil {
 		return nil, err
 	}
 
-	// path m/0'/0'/index'
+	// path m/0'/unit'/index'
 	keysetPath, err := unitPath.Derive(hdkeychain.HardenedKeyStart + index)
 	if err != nil {
 		return nil, err
@@ -52,43 +65,131 @@ func DeriveKeysetPath(key *hdkeychain.ExtendedKey, index uint32) (*hdkeychain.Ex
 }
 
 func GenerateKeyset(master *hdkeychain.ExtendedKey, index uint32, inputFeePpk uint) (*MintKeyset, error) {
-	keys := make(map[uint64]KeyPair, MAX_ORDER)
+	return GenerateUnitKeyset(master, cashu.Sat, index, inputFeePpk)
+}
+
+// GenerateUnitKeyset generates the keyset for the unit at path m/0'/unit'/index'
+func GenerateUnitKeyset(
+	master *hdkeychain.ExtendedKey,
+	unit cashu.Unit,
+	index uint32,
+	inputFeePpk uint,
+) (*MintKeyset, error) {
+	keysetPath, err := DeriveUnitKeysetPath(master, unit, index)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, pks, err := deriveKeys(keysetPath, MAX_ORDER)
+	if err != nil {
+		return nil, err
+	}
+	keysetId := DeriveKeysetId(pks)
+
+	return &MintKeyset{
+		Id:                keysetId,
+		Unit:              unit.String(),
+		Active:            true,
+		DerivationPathIdx: index,
+		Keys:              keys,
+		InputFeePpk:       inputFeePpk,
+	}, nil
+}
+
+// GenerateKeysetFromPath derives a keyset from a custom BIP32 derivation path
+// such as m/0'/0'/0'. The key for amount 2^i is derived at path/i'.
+// This is used for keysets generated by other mint implementations.
+// The returned keyset is inactive.
+func GenerateKeysetFromPath(
+	master *hdkeychain.ExtendedKey,
+	derivationPath string,
+	maxOrder int,
+	inputFeePpk uint,
+) (*MintKeyset, error) {
+	if maxOrder <= 0 || maxOrder > 64 {
+		return nil, fmt.Errorf("invalid max order %v", maxOrder)
+	}
+
+	indexes, err := ParseDerivationPath(derivationPath)
+	if err != nil {
+		return nil, err
+	}
+
+	keysetPath := master
+	for _, index := range indexes {
+		keysetPath, err = keysetPath.Derive(index)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	keysetPath, err := DeriveKeysetPath(master, index)
+	keys, pks, err := deriveKeys(keysetPath, maxOrder)
 	if err != nil {
 		return nil, err
 	}
 
-	pks := make(map[uint64]*secp256k1.PublicKey)
-	for i := 0; i < MAX_ORDER; i++ {
+	return &MintKeyset{
+		Id:          DeriveKeysetId(pks),
+		Unit:        cashu.Sat.String(),
+		Keys:        keys,
+		InputFeePpk: inputFeePpk,
+	}, nil
+}
+
+// ParseDerivationPath parses a BIP32 path in the form m/0'/0'/0'.
+// Both ' and h can be used to mark hardened indexes.
+func ParseDerivationPath(path string) ([]uint32, error) {
+	parts := strings.Split(strings.TrimSpace(path), "/")
+	if len(parts) == 0 || parts[0] != "m" {
+		return nil, fmt.Errorf("invalid derivation path '%v'", path)
+	}
+
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, part := range parts[1:] {
+		hardened := strings.HasSuffix(part, "'") || strings.HasSuffix(part, "h")
+		if hardened {
+			part = part[:len(part)-1]
+		}
+		index, err := strconv.ParseUint(part, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid derivation path '%v': %v", path, err)
+		}
+		if hardened {
+			index += hdkeychain.HardenedKeyStart
+		}
+		indexes = append(indexes, uint32(index))
+	}
+	return indexes, nil
+}
+
+// deriveKeys derives the keys for amounts 2^0 to 2^(maxOrder-1)
+func deriveKeys(keysetPath *hdkeychain.ExtendedKey, maxOrder int) (
+	map[uint64]KeyPair,
+	map[uint64]*secp256k1.PublicKey,
+	error,
+) {
+	keys := make(map[uint64]KeyPair, maxOrder)
+	pks := make(map[uint64]*secp256k1.PublicKey, maxOrder)
+	for i := 0; i < maxOrder; i++ {
 		amount := uint64(math.Pow(2, float64(i)))
 		amountPath, err := keysetPath.Derive(hdkeychain.HardenedKeyStart + uint32(i))
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		privKey, err := amountPath.ECPrivKey()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		pubKey, err := amountPath.ECPubKey()
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		keys[amount] = KeyPair{PrivateKey: privKey, PublicKey: pubKey}
 		pks[amount] = pubKey
 	}
-	keysetId := DeriveKeysetId(pks)
-
-	return &MintKeyset{
-		Id:                keysetId,
-		Unit:              cashu.Sat.String(),
-		Active:            true,
-		DerivationPathIdx: index,
-		Keys:              keys,
-		InputFeePpk:       inputFeePpk,
-	}, nil
+	return keys, pks, nil
 }
 
 // DeriveKeysetId returns the string ID derived from the map keyset
@@ -123,6 +224,25 @@ func DeriveKeysetId(keyset map[uint64]*secp256k1.PublicKey) string {
 	return "00" + hex.EncodeToString(hash.Sum(nil))[:14]
 }
 
+// DeriveLegacyKeysetId returns the base64 keyset id used by mints before
+// versioned keyset ids. It is the first 12 characters of the base64 encoded
+// SHA256 of the concatenated hex public keys sorted by amount.
+func DeriveLegacyKeysetId(keyset map[uint64]*secp256k1.PublicKey) string {
+	amounts := make([]uint64, 0, len(keyset))
+	for amount := range keyset {
+		amounts = append(amounts, amount)
+	}
+	sort.Slice(amounts, func(i, j int) bool { return amounts[i] < amounts[j] })
+
+	var pubkeys strings.Builder
+	for _, amount := range amounts {
+		pubkeys.WriteString(hex.EncodeToString(keyset[amount].SerializeCompressed()))
+	}
+	hash := sha256.Sum256([]byte(pubkeys.String()))
+
+	return base64.StdEncoding.EncodeToString(hash[:])[:12]
+}
+
 // DerivePublic returns the keyset's public keys as
 // a map of amounts uint64 to strings that represents the public key
 func (ks *MintKeyset) DerivePublic() map[uint64]string {
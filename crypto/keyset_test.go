@@ -1,10 +1,15 @@
 package crypto
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"testing"
 
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
 )
 
 func TestDeriveKeysetId(t *testing.T) {
@@ -112,3 +117,145 @@ func TestDeriveKeysetId(t *testing.T) {
 
 	}
 }
+
+func TestGenerateKeysetFromPath(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("error creating master key: %v", err)
+	}
+
+	keyset, err := GenerateKeyset(master, 5, 100)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+
+	// same keyset as derived with index 5
+	fromPath, err := GenerateKeysetFromPath(master, "m/0'/0h/5'", MAX_ORDER, 100)
+	if err != nil {
+		t.Fatalf("error generating keyset from path: %v", err)
+	}
+	if fromPath.Id != keyset.Id {
+		t.Fatalf("expected keyset id '%v' but got '%v'", keyset.Id, fromPath.Id)
+	}
+	if fromPath.Active || fromPath.InputFeePpk != 100 || len(fromPath.Keys) != MAX_ORDER {
+		t.Fatalf("unexpected keyset from path: %+v", fromPath)
+	}
+
+	shorter, err := GenerateKeysetFromPath(master, "m/0'/0'/5'", 32, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset from path: %v", err)
+	}
+	if len(shorter.Keys) != 32 || shorter.Id == keyset.Id {
+		t.Fatalf("expected keyset with 32 keys and different id but got %v keys and id '%v'",
+			len(shorter.Keys), shorter.Id)
+	}
+
+	invalidPaths := []string{"", "0'/0'/0'", "m/a'", "m/0'/-1", "m/2147483648"}
+	for _, path := range invalidPaths {
+		if _, err := GenerateKeysetFromPath(master, path, MAX_ORDER, 0); err == nil {
+			t.Fatalf("expected error for path '%v' but got nil", path)
+		}
+	}
+	if _, err := GenerateKeysetFromPath(master, "m/0'", 65, 0); err == nil {
+		t.Fatal("expected error for max order over 64 but got nil")
+	}
+}
+
+func TestGenerateUnitKeyset(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("error creating master key: %v", err)
+	}
+
+	satKeyset, err := GenerateKeyset(master, 0, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+	msatKeyset, err := GenerateUnitKeyset(master, cashu.Msat, 0, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+	if msatKeyset.Unit != cashu.Msat.String() {
+		t.Fatalf("expected unit '%v' but got '%v'", cashu.Msat, msatKeyset.Unit)
+	}
+	if msatKeyset.Id == satKeyset.Id {
+		t.Fatal("expected keysets of different units to have different ids")
+	}
+
+	// msat keyset is derived at m/0'/1'/index'
+	fromPath, err := GenerateKeysetFromPath(master, "m/0'/1'/0'", MAX_ORDER, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset from path: %v", err)
+	}
+	if fromPath.Id != msatKeyset.Id {
+		t.Fatalf("expected keyset id '%v' but got '%v'", msatKeyset.Id, fromPath.Id)
+	}
+
+	// usd keyset is derived at m/0'/2'/index'
+	usdKeyset, err := GenerateUnitKeyset(master, cashu.Usd, 0, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+	if usdKeyset.Unit != cashu.Usd.String() {
+		t.Fatalf("expected unit '%v' but got '%v'", cashu.Usd, usdKeyset.Unit)
+	}
+	fromPath, err = GenerateKeysetFromPath(master, "m/0'/2'/0'", MAX_ORDER, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset from path: %v", err)
+	}
+	if fromPath.Id != usdKeyset.Id {
+		t.Fatalf("expected keyset id '%v' but got '%v'", usdKeyset.Id, fromPath.Id)
+	}
+}
+
+// the key for amount 1 is the one other implementations derive from the same
+// seed and path. The id pins the keys derived for the rest of the amounts
+func TestGenerateKeysetVector(t *testing.T) {
+	master, err := hdkeychain.NewMaster([]byte("TEST_PRIVATE_KEY"), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatalf("unexpected error creating master key: %v", err)
+	}
+	keyset, err := GenerateKeyset(master, 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error generating keyset: %v", err)
+	}
+
+	expectedKey := "02194603ffa36356f4a56b7df9371fc3192472351453ec7398b8da8117e7c3e104"
+	if key := hex.EncodeToString(keyset.Keys[1].PublicKey.SerializeCompressed()); key != expectedKey {
+		t.Fatalf("expected key for amount 1 '%v' but got '%v'", expectedKey, key)
+	}
+
+	expectedId := "0047beadb3649c76"
+	if keyset.Id != expectedId {
+		t.Fatalf("expected keyset id '%v' but got '%v'", expectedId, keyset.Id)
+	}
+	pks := make(map[uint64]*secp256k1.PublicKey, len(keyset.Keys))
+	for amount, key := range keyset.Keys {
+		pks[amount] = key.PublicKey
+	}
+	if id := DeriveKeysetId(pks); id != expectedId {
+		t.Fatalf("expected keyset id '%v' but got '%v'", expectedId, id)
+	}
+}
+
+func TestDeriveLegacyKeysetId(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	keyset, _ := GenerateKeyset(master, 0, 0)
+
+	pks := make(map[uint64]*secp256k1.PublicKey)
+	var concat string
+	for i := 0; i < MAX_ORDER; i++ {
+		amount := uint64(1) << i
+		pks[amount] = keyset.Keys[amount].PublicKey
+		concat += hex.EncodeToString(pks[amount].SerializeCompressed())
+	}
+	hash := sha256.Sum256([]byte(concat))
+	expected := base64.StdEncoding.EncodeToString(hash[:])[:12]
+
+	if id := DeriveLegacyKeysetId(pks); id != expected {
+		t.Fatalf("expected legacy keyset id '%v' but got '%v'", expected, id)
+	}
+}
@@ -0,0 +1,86 @@
+package mint
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/gorilla/mux"
+)
+
+// DefaultAdminAllowList is the allow list of the admin listener
+// if the AdminIPPolicy does not set one.
+var DefaultAdminAllowList = []string{"127.0.0.0/8", "::1"}
+
+// AdminMetrics are the counters of the mint server served
+// by the admin listener at /v1/admin/metrics.
+type AdminMetrics struct {
+	// requests to the public endpoints rejected by the IP policy
+	BlockedRequests map[string]uint64 `json:"blocked_requests"`
+	// requests to the admin listener rejected by the admin IP policy
+	AdminBlockedRequests map[string]uint64   `json:"admin_blocked_requests"`
+	DoubleSpends         DoubleSpendAttempts `json:"double_spends"`
+	MintQuoteLimits      QuoteLimiterStats   `json:"mint_quote_limits"`
+}
+
+// Metrics returns the counters of the mint server.
+func (ms *MintServer) Metrics() AdminMetrics {
+	metrics := AdminMetrics{
+		BlockedRequests:      ms.BlockedRequests(),
+		AdminBlockedRequests: map[string]uint64{},
+		DoubleSpends:         ms.DoubleSpendAttempts(),
+		MintQuoteLimits:      ms.MintQuoteLimits(),
+	}
+	if ms.adminFilter != nil {
+		metrics.AdminBlockedRequests = ms.adminFilter.blockedRequests()
+	}
+	return metrics
+}
+
+func (ms *MintServer) setupAdminServer(config Config) error {
+	policy := config.AdminIPPolicy
+	if len(policy.AllowList) == 0 {
+		policy.AllowList = DefaultAdminAllowList
+	}
+	adminFilter, err := newIPFilter(policy, ms.mint.logger)
+	if err != nil {
+		return fmt.Errorf("invalid admin IP policy: %v", err)
+	}
+	ms.adminFilter = adminFilter
+
+	r := mux.NewRouter()
+	r.HandleFunc("/v1/admin/config", ms.adminConfig).Methods(http.MethodGet)
+	r.HandleFunc("/v1/admin/metrics", ms.adminMetrics).Methods(http.MethodGet)
+	r.Use(ms.requestLogger)
+	r.Use(adminFilter.middleware)
+	r.Use(setupHeaders)
+
+	ms.adminServer = &http.Server{
+		Addr:    net.JoinHostPort(config.ListenAddress, strconv.Itoa(config.AdminPort)),
+		Handler: r,
+	}
+	return nil
+}
+
+func (ms *MintServer) adminConfig(rw http.ResponseWriter, req *http.Request) {
+	jsonRes, err := json.Marshal(ms.ConfigView())
+	if err != nil {
+		ms.writeErr(rw, req, cashu.StandardErr)
+		return
+	}
+	ms.logRequest(req, http.StatusOK, "returning config")
+	rw.Write(jsonRes)
+}
+
+func (ms *MintServer) adminMetrics(rw http.ResponseWriter, req *http.Request) {
+	jsonRes, err := json.Marshal(ms.Metrics())
+	if err != nil {
+		ms.writeErr(rw, req, cashu.StandardErr)
+		return
+	}
+	ms.logRequest(req, http.StatusOK, "returning metrics")
+	rw.Write(jsonRes)
+}
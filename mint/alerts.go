@@ -0,0 +1,290 @@
+package mint
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+const (
+	DefaultAlertCheckInterval  = time.Minute
+	DefaultAlertRepeatInterval = time.Hour
+)
+
+type AlertKind int
+
+const (
+	LightningUnreachableAlert AlertKind = iota + 1
+	PendingMeltAlert
+	DBErrorsAlert
+	BalanceMismatchAlert
+)
+
+func (kind AlertKind) String() string {
+	switch kind {
+	case LightningUnreachableAlert:
+		return "lightning backend unreachable"
+	case PendingMeltAlert:
+		return "melt pending too long"
+	case DBErrorsAlert:
+		return "database errors"
+	case BalanceMismatchAlert:
+		return "balance mismatch"
+	default:
+		return "unknown"
+	}
+}
+
+// Alert about a critical condition in the mint
+type Alert struct {
+	Kind    AlertKind
+	Message string
+	Time    time.Time
+}
+
+// Notifier sends alerts to the mint operator
+type Notifier interface {
+	Notify(alert Alert) error
+}
+
+// AlertConfig sets the conditions that trigger alerts. Alerts are
+// only checked if there is at least one notifier. The lightning backend
+// connection is always checked. The other conditions are opt-in.
+type AlertConfig struct {
+	Notifiers []Notifier
+	// how often conditions are checked. DefaultAlertCheckInterval if not set
+	CheckInterval time.Duration
+	// min time before an alert of the same kind is sent again.
+	// DefaultAlertRepeatInterval if not set
+	RepeatInterval time.Duration
+	// alert if a melt quote has been pending for longer than this
+	PendingMeltAge time.Duration
+	// alert if there are at least this many database errors
+	// returned in requests in a check interval
+	DBErrorThreshold int
+	// alert if the outstanding ecash (signatures issued minus proofs
+	// redeemed) is higher than the balance from paid quotes
+	ReconcileBalance bool
+}
+
+type alertMonitor struct {
+	mint   *Mint
+	config AlertConfig
+
+	dbErrors atomic.Int64
+
+	mu       sync.Mutex
+	lastSent map[AlertKind]time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newAlertMonitor(config AlertConfig, mint *Mint) *alertMonitor {
+	if len(config.Notifiers) == 0 {
+		return nil
+	}
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = DefaultAlertCheckInterval
+	}
+	if config.RepeatInterval <= 0 {
+		config.RepeatInterval = DefaultAlertRepeatInterval
+	}
+
+	return &alertMonitor{
+		mint:     mint,
+		config:   config,
+		lastSent: make(map[AlertKind]time.Time),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (am *alertMonitor) start() {
+	go func() {
+		defer close(am.done)
+		ticker := time.NewTicker(am.config.CheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				am.check()
+			case <-am.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (am *alertMonitor) shutdown() {
+	close(am.stop)
+	<-am.done
+}
+
+// recordError counts the errors returned in requests that came from the database
+func (am *alertMonitor) recordError(err error) {
+	var cashuErr cashu.Error
+	var cashuErrPtr *cashu.Error
+	switch {
+	case errors.As(err, &cashuErrPtr):
+		cashuErr = *cashuErrPtr
+	case errors.As(err, &cashuErr):
+	default:
+		return
+	}
+
+	if cashuErr.Code == cashu.DBErrCode {
+		am.dbErrors.Add(1)
+	}
+}
+
+// check runs the checks for each condition and sends the
+// alerts for the ones that were triggered
+func (am *alertMonitor) check() {
+	now := time.Now()
+	var alerts []Alert
+
+	if err := am.mint.lightningClient.ConnectionStatus(); err != nil {
+		alerts = append(alerts, Alert{
+			Kind:    LightningUnreachableAlert,
+			Message: fmt.Sprintf("could not connect to lightning backend: %v", err),
+		})
+	}
+
+	if am.config.PendingMeltAge > 0 {
+		if alert := am.checkPendingMelts(now); alert != nil {
+			alerts = append(alerts, *alert)
+		}
+	}
+
+	dbErrors := am.dbErrors.Swap(0)
+	if am.config.DBErrorThreshold > 0 && dbErrors >= int64(am.config.DBErrorThreshold) {
+		alerts = append(alerts, Alert{
+			Kind: DBErrorsAlert,
+			Message: fmt.Sprintf("%v database errors in requests in the last %v",
+				dbErrors, am.config.CheckInterval),
+		})
+	}
+
+	if am.config.ReconcileBalance {
+		if alert := am.checkBalance(); alert != nil {
+			alerts = append(alerts, *alert)
+		}
+	}
+
+	for _, alert := range alerts {
+		alert.Time = now
+		am.send(alert)
+	}
+}
+
+func (am *alertMonitor) checkPendingMelts(now time.Time) *Alert {
+	pendingQuotes, err := am.mint.db.GetMeltQuotesByState(nut05.Pending)
+	if err != nil {
+		am.mint.logErrorf("could not get pending melt quotes: %v", err)
+		return nil
+	}
+
+	var stale []string
+	for _, quote := range pendingQuotes {
+		// quotes do not have a creation time so it is derived from the expiry
+		createdAt := time.Unix(int64(quote.Expiry), 0).Add(-QuoteExpiryMins * time.Minute)
+		if now.Sub(createdAt) > am.config.PendingMeltAge {
+			stale = append(stale, quote.Id)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+
+	return &Alert{
+		Kind: PendingMeltAlert,
+		Message: fmt.Sprintf("%v melt quotes pending for more than %v: %v",
+			len(stale), am.config.PendingMeltAge, stale),
+	}
+}
+
+func (am *alertMonitor) checkBalance() *Alert {
+	balance, err := am.mint.db.GetBalance()
+	if err != nil {
+		am.mint.logErrorf("could not get mint balance: %v", err)
+		return nil
+	}
+
+	issued, err := am.mint.db.GetIssuedDenominations()
+	if err != nil {
+		am.mint.logErrorf("could not get issued denominations: %v", err)
+		return nil
+	}
+	redeemed, err := am.mint.db.GetRedeemedDenominations()
+	if err != nil {
+		am.mint.logErrorf("could not get redeemed denominations: %v", err)
+		return nil
+	}
+
+	// amounts are added in msat since the balance
+	// from quotes includes the ones for msat keysets.
+	// The ecash of fiat keysets does not have a fixed
+	// value in msat so it is not counted
+	keysets := am.mint.getKeysets()
+	msatAmount := func(denomination storage.DenominationCount) uint64 {
+		amount := denomination.Amount * denomination.Count
+		switch keysets[denomination.KeysetId].Unit {
+		case cashu.Msat.String():
+			return amount
+		case cashu.Usd.String(), cashu.Eur.String():
+			return 0
+		}
+		return amount * 1000
+	}
+	var issuedAmount, redeemedAmount uint64
+	for _, denomination := range issued {
+		issuedAmount += msatAmount(denomination)
+	}
+	for _, denomination := range redeemed {
+		redeemedAmount += msatAmount(denomination)
+	}
+	if redeemedAmount >= issuedAmount {
+		return nil
+	}
+
+	// outstanding ecash can be lower than the balance because of fees
+	// but it should never be higher
+	outstanding := (issuedAmount - redeemedAmount) / 1000
+	if outstanding <= balance {
+		return nil
+	}
+
+	return &Alert{
+		Kind: BalanceMismatchAlert,
+		Message: fmt.Sprintf("outstanding ecash of %v is higher than balance of %v from quotes",
+			outstanding, balance),
+	}
+}
+
+// send sends the alert to all the notifiers unless an
+// alert of the same kind was sent recently
+func (am *alertMonitor) send(alert Alert) {
+	am.mu.Lock()
+	lastSent, ok := am.lastSent[alert.Kind]
+	if ok && alert.Time.Sub(lastSent) < am.config.RepeatInterval {
+		am.mu.Unlock()
+		return
+	}
+	am.lastSent[alert.Kind] = alert.Time
+	am.mu.Unlock()
+
+	am.mint.logErrorf("alert: %v: %v", alert.Kind, alert.Message)
+	for _, notifier := range am.config.Notifiers {
+		if err := notifier.Notify(alert); err != nil {
+			am.mint.logErrorf("could not send alert: %v", err)
+		}
+	}
+}
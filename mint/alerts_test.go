@@ -0,0 +1,368 @@
+package mint
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/lightning"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// fakeAlertsDB returns the data read by the alert checks.
+// Every method returns err if it is set.
+type fakeAlertsDB struct {
+	storage.MintDB
+	pendingMelts []storage.MeltQuote
+	balance      uint64
+	issued       []storage.DenominationCount
+	redeemed     []storage.DenominationCount
+	err          error
+}
+
+func (db *fakeAlertsDB) GetMeltQuotesByState(state nut05.State) ([]storage.MeltQuote, error) {
+	if db.err != nil {
+		return nil, db.err
+	}
+	return db.pendingMelts, nil
+}
+
+func (db *fakeAlertsDB) GetBalance() (uint64, error) {
+	return db.balance, db.err
+}
+
+func (db *fakeAlertsDB) GetIssuedDenominations() ([]storage.DenominationCount, error) {
+	return db.issued, db.err
+}
+
+func (db *fakeAlertsDB) GetRedeemedDenominations() ([]storage.DenominationCount, error) {
+	return db.redeemed, db.err
+}
+
+type fakeAlertsBackend struct {
+	lightning.Client
+	err error
+}
+
+func (fb *fakeAlertsBackend) ConnectionStatus() error { return fb.err }
+
+// recordNotifier keeps the alerts sent to it
+type recordNotifier struct {
+	mu     sync.Mutex
+	alerts []Alert
+	err    error
+}
+
+func (rn *recordNotifier) Notify(alert Alert) error {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	rn.alerts = append(rn.alerts, alert)
+	return rn.err
+}
+
+func (rn *recordNotifier) kinds() []AlertKind {
+	rn.mu.Lock()
+	defer rn.mu.Unlock()
+	kinds := make([]AlertKind, len(rn.alerts))
+	for i, alert := range rn.alerts {
+		kinds[i] = alert.Kind
+	}
+	return kinds
+}
+
+func newTestAlertMonitor(config AlertConfig, db storage.MintDB, backend lightning.Client) *alertMonitor {
+	mint := &Mint{
+		db:              db,
+		lightningClient: backend,
+		logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		keysets: map[string]crypto.MintKeyset{
+			"satkeyset":  {Id: "satkeyset", Unit: cashu.Sat.String()},
+			"msatkeyset": {Id: "msatkeyset", Unit: cashu.Msat.String()},
+			"usdkeyset":  {Id: "usdkeyset", Unit: cashu.Usd.String()},
+		},
+	}
+	return newAlertMonitor(config, mint)
+}
+
+// pendingMeltQuote returns a quote that was created age ago
+func pendingMeltQuote(id string, age time.Duration) storage.MeltQuote {
+	createdAt := time.Now().Add(-age)
+	return storage.MeltQuote{
+		Id:     id,
+		State:  nut05.Pending,
+		Expiry: uint64(createdAt.Add(QuoteExpiryMins * time.Minute).Unix()),
+	}
+}
+
+func assertAlerts(t *testing.T, notifier *recordNotifier, expected ...AlertKind) {
+	t.Helper()
+	kinds := notifier.kinds()
+	if len(kinds) != len(expected) {
+		t.Fatalf("expected alerts %v but got %v", expected, kinds)
+	}
+	for i := range expected {
+		if kinds[i] != expected[i] {
+			t.Fatalf("expected alerts %v but got %v", expected, kinds)
+		}
+	}
+}
+
+func TestNewAlertMonitor(t *testing.T) {
+	if am := newTestAlertMonitor(AlertConfig{}, &fakeAlertsDB{}, &fakeAlertsBackend{}); am != nil {
+		t.Fatal("expected no alert monitor without notifiers")
+	}
+
+	config := AlertConfig{Notifiers: []Notifier{&recordNotifier{}}}
+	am := newTestAlertMonitor(config, &fakeAlertsDB{}, &fakeAlertsBackend{})
+	if am.config.CheckInterval != DefaultAlertCheckInterval {
+		t.Fatalf("expected check interval of %v but got %v", DefaultAlertCheckInterval, am.config.CheckInterval)
+	}
+	if am.config.RepeatInterval != DefaultAlertRepeatInterval {
+		t.Fatalf("expected repeat interval of %v but got %v", DefaultAlertRepeatInterval, am.config.RepeatInterval)
+	}
+}
+
+func TestLightningUnreachableAlert(t *testing.T) {
+	notifier := &recordNotifier{}
+	backend := &fakeAlertsBackend{}
+	am := newTestAlertMonitor(AlertConfig{Notifiers: []Notifier{notifier}}, &fakeAlertsDB{}, backend)
+
+	am.check()
+	assertAlerts(t, notifier)
+
+	backend.err = errors.New("connection refused")
+	am.check()
+	assertAlerts(t, notifier, LightningUnreachableAlert)
+	if !strings.Contains(notifier.alerts[0].Message, "connection refused") {
+		t.Fatalf("expected error of the backend in alert but got '%v'", notifier.alerts[0].Message)
+	}
+	if notifier.alerts[0].Time.IsZero() {
+		t.Fatal("expected time to be set in alert")
+	}
+}
+
+func TestPendingMeltAlert(t *testing.T) {
+	notifier := &recordNotifier{}
+	db := &fakeAlertsDB{
+		pendingMelts: []storage.MeltQuote{pendingMeltQuote("recentquote", time.Minute)},
+	}
+	config := AlertConfig{Notifiers: []Notifier{notifier}, PendingMeltAge: time.Hour}
+	am := newTestAlertMonitor(config, db, &fakeAlertsBackend{})
+
+	am.check()
+	assertAlerts(t, notifier)
+
+	db.pendingMelts = append(db.pendingMelts, pendingMeltQuote("stalequote", 2*time.Hour))
+	am.check()
+	assertAlerts(t, notifier, PendingMeltAlert)
+	message := notifier.alerts[0].Message
+	if !strings.Contains(message, "stalequote") || strings.Contains(message, "recentquote") {
+		t.Fatalf("expected only the stale quote in alert but got '%v'", message)
+	}
+
+	// not checked if the age is not set
+	notifier = &recordNotifier{}
+	am = newTestAlertMonitor(AlertConfig{Notifiers: []Notifier{notifier}}, db, &fakeAlertsBackend{})
+	am.check()
+	assertAlerts(t, notifier)
+}
+
+func TestAlertRepeatInterval(t *testing.T) {
+	notifier := &recordNotifier{}
+	db := &fakeAlertsDB{
+		pendingMelts: []storage.MeltQuote{pendingMeltQuote("stalequote", 2*time.Hour)},
+	}
+	config := AlertConfig{
+		Notifiers:      []Notifier{notifier},
+		PendingMeltAge: time.Hour,
+		RepeatInterval: time.Hour,
+	}
+	am := newTestAlertMonitor(config, db, &fakeAlertsBackend{})
+
+	am.check()
+	assertAlerts(t, notifier, PendingMeltAlert)
+
+	// same condition is not alerted again within the repeat interval
+	am.check()
+	am.check()
+	assertAlerts(t, notifier, PendingMeltAlert)
+
+	// other kinds are still sent
+	am.mint.lightningClient = &fakeAlertsBackend{err: errors.New("connection refused")}
+	am.check()
+	assertAlerts(t, notifier, PendingMeltAlert, LightningUnreachableAlert)
+
+	// sent again after the repeat interval
+	am.mu.Lock()
+	am.lastSent[PendingMeltAlert] = time.Now().Add(-2 * time.Hour)
+	am.mu.Unlock()
+	am.check()
+	assertAlerts(t, notifier, PendingMeltAlert, LightningUnreachableAlert, PendingMeltAlert)
+}
+
+func TestDBErrorsAlert(t *testing.T) {
+	notifier := &recordNotifier{}
+	config := AlertConfig{Notifiers: []Notifier{notifier}, DBErrorThreshold: 3}
+	am := newTestAlertMonitor(config, &fakeAlertsDB{}, &fakeAlertsBackend{})
+
+	dbErr := cashu.BuildCashuError("database is locked", cashu.DBErrCode)
+	am.recordError(dbErr)
+	am.recordError(*dbErr)
+	// errors that did not come from the database are not counted
+	am.recordError(cashu.QuoteNotExistErr)
+	am.recordError(errors.New("some error"))
+	am.check()
+	assertAlerts(t, notifier)
+
+	// the count is reset on each check
+	am.recordError(dbErr)
+	am.recordError(dbErr)
+	am.check()
+	assertAlerts(t, notifier)
+
+	for i := 0; i < 3; i++ {
+		am.recordError(dbErr)
+	}
+	am.check()
+	assertAlerts(t, notifier, DBErrorsAlert)
+	if !strings.Contains(notifier.alerts[0].Message, "3 database errors") {
+		t.Fatalf("expected number of errors in alert but got '%v'", notifier.alerts[0].Message)
+	}
+}
+
+func TestBalanceMismatchAlert(t *testing.T) {
+	tests := []struct {
+		name     string
+		balance  uint64
+		issued   []storage.DenominationCount
+		redeemed []storage.DenominationCount
+		alert    bool
+	}{
+		{
+			name:    "outstanding equal to balance",
+			balance: 100,
+			issued:  []storage.DenominationCount{{KeysetId: "satkeyset", Amount: 64, Count: 2}},
+			redeemed: []storage.DenominationCount{
+				{KeysetId: "satkeyset", Amount: 4, Count: 7},
+			},
+		},
+		{
+			name:    "outstanding lower than balance",
+			balance: 1000,
+			issued:  []storage.DenominationCount{{KeysetId: "satkeyset", Amount: 512, Count: 1}},
+		},
+		{
+			name:     "all redeemed",
+			issued:   []storage.DenominationCount{{KeysetId: "satkeyset", Amount: 8, Count: 1}},
+			redeemed: []storage.DenominationCount{{KeysetId: "satkeyset", Amount: 8, Count: 1}},
+		},
+		{
+			name:    "outstanding higher than balance",
+			balance: 100,
+			issued:  []storage.DenominationCount{{KeysetId: "satkeyset", Amount: 128, Count: 1}},
+			alert:   true,
+		},
+		{
+			name:    "msat keyset",
+			balance: 100,
+			issued: []storage.DenominationCount{
+				{KeysetId: "satkeyset", Amount: 64, Count: 1},
+				{KeysetId: "msatkeyset", Amount: 32000, Count: 1},
+			},
+		},
+		{
+			name:    "msat keyset higher than balance",
+			balance: 100,
+			issued: []storage.DenominationCount{
+				{KeysetId: "satkeyset", Amount: 64, Count: 1},
+				{KeysetId: "msatkeyset", Amount: 64000, Count: 1},
+			},
+			alert: true,
+		},
+		{
+			name:    "fiat keyset not counted",
+			balance: 100,
+			issued: []storage.DenominationCount{
+				{KeysetId: "satkeyset", Amount: 64, Count: 1},
+				{KeysetId: "usdkeyset", Amount: 1024, Count: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notifier := &recordNotifier{}
+			db := &fakeAlertsDB{balance: test.balance, issued: test.issued, redeemed: test.redeemed}
+			config := AlertConfig{Notifiers: []Notifier{notifier}, ReconcileBalance: true}
+			am := newTestAlertMonitor(config, db, &fakeAlertsBackend{})
+
+			am.check()
+			if test.alert {
+				assertAlerts(t, notifier, BalanceMismatchAlert)
+			} else {
+				assertAlerts(t, notifier)
+			}
+		})
+	}
+}
+
+func TestAlertChecksWithDBErrors(t *testing.T) {
+	notifier := &recordNotifier{}
+	db := &fakeAlertsDB{
+		pendingMelts: []storage.MeltQuote{pendingMeltQuote("stalequote", 2*time.Hour)},
+		issued:       []storage.DenominationCount{{KeysetId: "satkeyset", Amount: 128, Count: 1}},
+		err:          errors.New("database is locked"),
+	}
+	config := AlertConfig{
+		Notifiers:        []Notifier{notifier},
+		PendingMeltAge:   time.Hour,
+		ReconcileBalance: true,
+	}
+	am := newTestAlertMonitor(config, db, &fakeAlertsBackend{})
+
+	// conditions that could not be checked are not alerted
+	am.check()
+	assertAlerts(t, notifier)
+
+	db.err = nil
+	am.check()
+	assertAlerts(t, notifier, PendingMeltAlert, BalanceMismatchAlert)
+}
+
+func TestAlertSentToAllNotifiers(t *testing.T) {
+	failing := &recordNotifier{err: errors.New("notifier unavailable")}
+	notifier := &recordNotifier{}
+	backend := &fakeAlertsBackend{err: errors.New("connection refused")}
+	config := AlertConfig{Notifiers: []Notifier{failing, notifier}}
+	am := newTestAlertMonitor(config, &fakeAlertsDB{}, backend)
+
+	am.check()
+	assertAlerts(t, failing, LightningUnreachableAlert)
+	assertAlerts(t, notifier, LightningUnreachableAlert)
+
+	// a failed notification still counts for the repeat interval
+	am.check()
+	assertAlerts(t, failing, LightningUnreachableAlert)
+}
+
+func TestAlertMonitorStart(t *testing.T) {
+	notifier := &recordNotifier{}
+	backend := &fakeAlertsBackend{err: errors.New("connection refused")}
+	config := AlertConfig{Notifiers: []Notifier{notifier}, CheckInterval: 10 * time.Millisecond}
+	am := newTestAlertMonitor(config, &fakeAlertsDB{}, backend)
+
+	am.start()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(notifier.kinds()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	am.shutdown()
+	assertAlerts(t, notifier, LightningUnreachableAlert)
+}
@@ -0,0 +1,370 @@
+package mint
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut20"
+	"github.com/elnosh/gonuts/cashu/nuts/nut25"
+	"github.com/elnosh/gonuts/mint/lightning"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// default description of the offers since it is required by them
+const defaultOfferDescription = "gonuts mint quote"
+
+// RequestMintQuoteBolt12 creates a mint quote with a BOLT12 offer (NUT-25)
+// from the lightning backend. Unlike invoices, offers can be paid multiple
+// times and what was paid can be minted as the payments arrive.
+func (m *Mint) RequestMintQuoteBolt12(mintQuoteRequest nut25.PostMintQuoteBolt12Request) (storage.MintQuote, error) {
+	return m.requestMintQuoteBolt12(context.Background(), mintQuoteRequest)
+}
+
+func (m *Mint) requestMintQuoteBolt12(
+	ctx context.Context,
+	mintQuoteRequest nut25.PostMintQuoteBolt12Request,
+) (storage.MintQuote, error) {
+	bolt12Client, ok := m.lightningClient.(lightning.BOLT12Client)
+	if !ok || !m.bolt12Enabled {
+		return storage.MintQuote{}, cashu.PaymentMethodNotSupportedErr
+	}
+	// offers are only for sats since the amount paid to them
+	// could not be converted at the price of the quote
+	if mintQuoteRequest.Unit != cashu.Sat.String() {
+		errmsg := fmt.Sprintf("unit '%v' not supported for bolt12", mintQuoteRequest.Unit)
+		return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.UnitErrCode)
+	}
+	if m.RedeemOnly() {
+		return storage.MintQuote{}, cashu.MintingDisabled
+	}
+	if _, err := cashu.CheckedMul(mintQuoteRequest.Amount, 1000); err != nil {
+		return storage.MintQuote{}, cashu.MintAmountExceededErr
+	}
+
+	if err := m.checkBolt12MintLimits(mintQuoteRequest.Amount); err != nil {
+		return storage.MintQuote{}, err
+	}
+
+	// anyone that sees the offer could pay it so only
+	// the holder of the key can mint from the quote
+	if len(mintQuoteRequest.Pubkey) == 0 {
+		return storage.MintQuote{}, nut20.PubkeyRequiredErr
+	}
+	key, err := nut20.ParsePubkey(mintQuoteRequest.Pubkey)
+	if err != nil {
+		return storage.MintQuote{}, err
+	}
+
+	description, err := sanitizeDescription(mintQuoteRequest.Description)
+	if err != nil {
+		return storage.MintQuote{}, err
+	}
+	if len(description) == 0 {
+		description = defaultOfferDescription
+	}
+	m.logInfoContextf(ctx, "requesting offer from lightning backend for %v sats", mintQuoteRequest.Amount)
+	offer, err := bolt12Client.CreateOffer(mintQuoteRequest.Amount, description)
+	if err != nil {
+		errmsg := fmt.Sprintf("could not generate offer: %v", err)
+		return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.LightningBackendErrCode)
+	}
+
+	quoteId, err := cashu.GenerateRandomQuoteId()
+	if err != nil {
+		m.logErrorContextf(ctx, "error generating random quote id: %v", err)
+		return storage.MintQuote{}, cashu.StandardErr
+	}
+	mintQuote := storage.MintQuote{
+		Id:             quoteId,
+		Amount:         mintQuoteRequest.Amount,
+		PaymentRequest: offer.Request,
+		PaymentHash:    offer.OfferId,
+		State:          nut04.Unpaid,
+		Pubkey:         hex.EncodeToString(key.SerializeCompressed()),
+		Unit:           mintQuoteRequest.Unit,
+		AmountMsat:     mintQuoteRequest.Amount * 1000,
+		Method:         cashu.BOLT12_METHOD,
+	}
+	if err := m.db.SaveMintQuote(mintQuote); err != nil {
+		errmsg := fmt.Sprintf("error saving mint quote to db: %v", err)
+		return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+	}
+	if m.quoteWebhook != nil {
+		go m.notifyMintQuoteCreated(mintQuote)
+	}
+
+	return mintQuote, nil
+}
+
+// checkBolt12MintLimits checks the amount against the minting limits. It is
+// checked for the amount of the offer when the quote is requested and for each
+// amount minted from the quote since offers without an amount or paid more than
+// once would otherwise get around them.
+func (m *Mint) checkBolt12MintLimits(amount uint64) error {
+	limits := m.currentLimits()
+	if limits.MintingSettings.MaxAmount > 0 && amount > limits.MintingSettings.MaxAmount {
+		return cashu.MintAmountExceededErr
+	}
+	if limits.MaxBalance > 0 {
+		balance, err := m.db.GetBalance()
+		if err != nil {
+			errmsg := fmt.Sprintf("could not get mint balance from db: %v", err)
+			return cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+		}
+		newBalance, err := cashu.CheckedAdd(balance, amount)
+		if err != nil || newBalance > limits.MaxBalance {
+			return cashu.MintingDisabled
+		}
+	}
+	return nil
+}
+
+// GetMintQuoteBolt12State returns the mint quote with
+// the amount paid to its offer and the amount issued
+func (m *Mint) GetMintQuoteBolt12State(quoteId string) (storage.MintQuote, error) {
+	return m.getMintQuoteBolt12State(context.Background(), quoteId)
+}
+
+func (m *Mint) getMintQuoteBolt12State(ctx context.Context, quoteId string) (storage.MintQuote, error) {
+	mintQuote, err := m.db.GetMintQuote(quoteId)
+	if err != nil || mintQuote.Method != cashu.BOLT12_METHOD {
+		return storage.MintQuote{}, cashu.QuoteNotExistErr
+	}
+	bolt12Client, ok := m.lightningClient.(lightning.BOLT12Client)
+	if !ok {
+		return storage.MintQuote{}, cashu.PaymentMethodNotSupportedErr
+	}
+
+	m.logDebugContextf(ctx, "checking payments to offer with id '%v'", mintQuote.PaymentHash)
+	offer, err := bolt12Client.OfferStatus(mintQuote.PaymentHash)
+	if err != nil {
+		errmsg := fmt.Sprintf("error getting offer status: %v", err)
+		return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.LightningBackendErrCode)
+	}
+	if offer.AmountPaid <= mintQuote.AmountPaid {
+		return mintQuote, nil
+	}
+
+	m.logInfoContextf(ctx, "offer of mint quote '%v' was paid %v sats", mintQuote.Id, offer.AmountPaid-mintQuote.AmountPaid)
+	return m.setMintQuoteAmountPaid(mintQuote.Id, offer.AmountPaid)
+}
+
+// setMintQuoteAmountPaid updates the amount paid to the offer of the quote and
+// sets it as paid. The amount issued could have changed while checking the offer.
+func (m *Mint) setMintQuoteAmountPaid(quoteId string, amountPaid uint64) (storage.MintQuote, error) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	mintQuote, err := m.db.GetMintQuote(quoteId)
+	if err != nil {
+		return storage.MintQuote{}, cashu.QuoteNotExistErr
+	}
+	if amountPaid <= mintQuote.AmountPaid {
+		return mintQuote, nil
+	}
+
+	mintQuote.AmountPaid = amountPaid
+	if err := m.db.UpdateMintQuoteAmounts(mintQuote.Id, mintQuote.AmountPaid, mintQuote.AmountIssued); err != nil {
+		errmsg := fmt.Sprintf("error updating mint quote in db: %v", err)
+		return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+	}
+	if mintQuote.State == nut04.Unpaid {
+		mintQuote.State = nut04.Paid
+		if err := m.db.UpdateMintQuoteState(mintQuote.Id, mintQuote.State); err != nil {
+			errmsg := fmt.Sprintf("error updating mint quote in db: %v", err)
+			return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+		}
+	}
+
+	return mintQuote, nil
+}
+
+// MintTokensBolt12 signs the blinded messages for up to what was paid
+// to the offer of the quote and has not been issued yet. The request
+// has to be signed with the key of the pubkey in the quote.
+func (m *Mint) MintTokensBolt12(mintTokensRequest nut25.PostMintBolt12Request) (cashu.BlindedSignatures, error) {
+	return m.mintTokensBolt12(context.Background(), mintTokensRequest)
+}
+
+func (m *Mint) mintTokensBolt12(
+	ctx context.Context,
+	mintTokensRequest nut25.PostMintBolt12Request,
+) (cashu.BlindedSignatures, error) {
+	// check with the backend first for new payments to the offer
+	mintQuote, err := m.getMintQuoteBolt12State(ctx, mintTokensRequest.Quote)
+	if err != nil {
+		return nil, err
+	}
+
+	pubkey, err := nut20.ParsePubkey(mintQuote.Pubkey)
+	if err != nil {
+		return nil, err
+	}
+	if !nut20.VerifyMintRequest(mintQuote.Id, mintTokensRequest.Outputs, mintTokensRequest.Signature, pubkey) {
+		return nil, nut20.InvalidSignatureErr
+	}
+
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	// read quote again since it could have been
+	// minted by another request in the meantime
+	mintQuote, err = m.db.GetMintQuote(mintQuote.Id)
+	if err != nil {
+		return nil, cashu.QuoteNotExistErr
+	}
+	if mintQuote.AmountPaid <= mintQuote.AmountIssued {
+		return nil, cashu.MintQuoteRequestNotPaid
+	}
+
+	blindedMessages := mintTokensRequest.Outputs
+	blindedMessagesAmount, err := blindedMessages.CheckedAmount()
+	if err != nil {
+		return nil, cashu.InvalidBlindedMessageAmount
+	}
+	if blindedMessages.HasDuplicates() {
+		return nil, cashu.DuplicateOutputs
+	}
+	if err := m.verifyUnit(quoteUnit(mintQuote.Unit), nil, blindedMessages); err != nil {
+		return nil, err
+	}
+	if blindedMessagesAmount > mintQuote.AmountPaid-mintQuote.AmountIssued {
+		return nil, cashu.OutputsOverQuoteAmountErr
+	}
+	// checked again since offers can be paid any amount and multiple times
+	if err := m.checkBolt12MintLimits(blindedMessagesAmount); err != nil {
+		return nil, err
+	}
+
+	sigs, err := m.db.GetBlindSignatures(blindedMessages.B_s())
+	if err != nil {
+		errmsg := fmt.Sprintf("error getting blind signatures from db: %v", err)
+		return nil, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+	}
+	if len(sigs) > 0 {
+		return nil, cashu.BlindedMessageAlreadySigned
+	}
+
+	blindedSignatures, err := m.signBlindedMessages(blindedMessages)
+	if err != nil {
+		return nil, err
+	}
+
+	amountIssued := mintQuote.AmountIssued + blindedMessagesAmount
+	if err := m.db.UpdateMintQuoteAmounts(mintQuote.Id, mintQuote.AmountPaid, amountIssued); err != nil {
+		errmsg := fmt.Sprintf("error updating mint quote in db: %v", err)
+		return nil, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+	}
+	m.logInfoContextf(ctx, "issued %v sats from mint quote '%v'", blindedMessagesAmount, mintQuote.Id)
+
+	return blindedSignatures, nil
+}
+
+// RequestMeltQuoteBolt12 creates a melt quote to pay a BOLT12 offer. The invoice
+// to pay is fetched from the offer by the lightning backend when the quote is
+// requested, so the quote is then melted and checked like BOLT11 quotes. The amount
+// for offers for any amount is set with the amountless option of the request.
+// Offers of the mint quotes of the mint are not settled internally.
+func (m *Mint) RequestMeltQuoteBolt12(meltQuoteRequest nut25.PostMeltQuoteBolt12Request) (storage.MeltQuote, error) {
+	return m.requestMeltQuoteBolt12(context.Background(), meltQuoteRequest)
+}
+
+func (m *Mint) requestMeltQuoteBolt12(
+	ctx context.Context,
+	meltQuoteRequest nut25.PostMeltQuoteBolt12Request,
+) (storage.MeltQuote, error) {
+	bolt12Client, ok := m.lightningClient.(lightning.BOLT12Client)
+	if !ok || !m.bolt12Enabled {
+		return storage.MeltQuote{}, cashu.PaymentMethodNotSupportedErr
+	}
+	if meltQuoteRequest.Unit != cashu.Sat.String() {
+		errmsg := fmt.Sprintf("unit '%v' not supported for bolt12", meltQuoteRequest.Unit)
+		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.UnitErrCode)
+	}
+
+	offer := strings.ToLower(meltQuoteRequest.Request)
+	if !strings.HasPrefix(offer, "lno1") {
+		return storage.MeltQuote{}, cashu.BuildCashuError("invalid offer", cashu.MeltQuoteErrCode)
+	}
+
+	var amountMsat uint64
+	options := meltQuoteRequest.Options
+	if options != nil {
+		if options.Mpp != nil {
+			return storage.MeltQuote{},
+				cashu.BuildCashuError("MPP is not supported for bolt12", cashu.MeltQuoteErrCode)
+		}
+		if options.Amountless != nil {
+			if options.Amountless.AmountMsat == 0 {
+				return storage.MeltQuote{},
+					cashu.BuildCashuError("amountless amount has to be greater than 0", cashu.MeltQuoteErrCode)
+			}
+			amountMsat = options.Amountless.AmountMsat
+		}
+	}
+
+	// check melt limit before fetching the invoice if the amount is known
+	maxAmount := m.currentLimits().MeltingSettings.MaxAmount
+	if maxAmount > 0 && msatToSat(amountMsat) > maxAmount {
+		return storage.MeltQuote{}, cashu.MeltAmountExceededErr
+	}
+
+	m.logInfoContextf(ctx, "fetching invoice from offer for melt quote")
+	invoice, err := bolt12Client.FetchInvoice(offer, amountMsat)
+	if err != nil {
+		errmsg := fmt.Sprintf("could not fetch invoice from offer: %v", err)
+		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.LightningBackendErrCode)
+	}
+	if invoice.AmountMsat == 0 || (amountMsat > 0 && invoice.AmountMsat != amountMsat) {
+		errmsg := fmt.Sprintf("invoice from offer has amount of %v msat", invoice.AmountMsat)
+		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.MeltQuoteErrCode)
+	}
+	if maxAmount > 0 && msatToSat(invoice.AmountMsat) > maxAmount {
+		return storage.MeltQuote{}, cashu.MeltAmountExceededErr
+	}
+
+	// amounts that are not whole sats are rounded up
+	// so the inputs cover what the mint pays
+	quoteAmount, err := m.msatToUnit(meltQuoteRequest.Unit, invoice.AmountMsat)
+	if err != nil {
+		return storage.MeltQuote{}, err
+	}
+	feeMsat := m.lightningClient.FeeReserve(invoice.AmountMsat)
+	feeReserve, err := m.msatToUnit(meltQuoteRequest.Unit, feeMsat)
+	if err != nil {
+		return storage.MeltQuote{}, err
+	}
+
+	quoteId, err := cashu.GenerateRandomQuoteId()
+	if err != nil {
+		m.logErrorContextf(ctx, "error generating random quote id: %v", err)
+		return storage.MeltQuote{}, cashu.StandardErr
+	}
+	meltQuote := storage.MeltQuote{
+		Id:             quoteId,
+		InvoiceRequest: invoice.Request,
+		PaymentHash:    invoice.PaymentHash,
+		Amount:         quoteAmount,
+		FeeReserve:     feeReserve,
+		AmountMsat:     invoice.AmountMsat,
+		FeeReserveMsat: feeMsat,
+		State:          nut05.Unpaid,
+		Expiry:         uint64(time.Now().Add(time.Minute * QuoteExpiryMins).Unix()),
+		Unit:           meltQuoteRequest.Unit,
+	}
+	m.logInfoContextf(ctx, "got invoice from offer of amount '%v' msat. Setting fee reserve to %v msat",
+		invoice.AmountMsat, feeMsat)
+
+	if err := m.db.SaveMeltQuote(meltQuote); err != nil {
+		errmsg := fmt.Sprintf("error saving melt quote to db: %v", err)
+		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+	}
+
+	return meltQuote, nil
+}
@@ -0,0 +1,51 @@
+package mint
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/cashu/nuts/nut11"
+)
+
+// ConditionVerifier verifies the witness of proofs locked with a custom
+// NUT-10 kind registered with nut10.RegisterKind, i.e for escrow schemes
+// in private deployments. Proofs of registered kinds without a verifier are
+// rejected. Kinds that were not registered are spendable by anyone as before.
+type ConditionVerifier interface {
+	// VerifyProof returns an error if the witness does not satisfy the spending
+	// condition in the secret of the proof. The size of the witness is checked
+	// against the limits of the mint before calling it.
+	VerifyProof(proof cashu.Proof, secret nut10.WellKnownSecret, witness string) error
+}
+
+// checkConditionVerifiers checks that the verifiers are for custom kinds
+func checkConditionVerifiers(verifiers map[nut10.SecretKind]ConditionVerifier) error {
+	for kind, verifier := range verifiers {
+		if !nut10.IsCustomKind(kind) {
+			return fmt.Errorf("condition verifier for kind '%v' that was not registered with nut10.RegisterKind", kind)
+		}
+		if verifier == nil {
+			return fmt.Errorf("nil condition verifier for kind '%v'", kind)
+		}
+	}
+	return nil
+}
+
+// verifyCustomCondition verifies the proof with the verifier of its kind.
+// Registered kinds without a verifier are rejected.
+func (m *Mint) verifyCustomCondition(proof cashu.Proof, secret nut10.WellKnownSecret) error {
+	verifier, ok := m.conditionVerifiers[secret.Kind]
+	if !ok {
+		return nut11.InvalidKindErr
+	}
+	if err := verifier.VerifyProof(proof, secret, proof.Witness); err != nil {
+		var cashuErr cashu.Error
+		if errors.As(err, &cashuErr) {
+			return cashuErr
+		}
+		return cashu.BuildCashuError(err.Error(), nut11.NUT11ErrCode)
+	}
+	return nil
+}
@@ -3,8 +3,11 @@ package mint
 import (
 	"time"
 
+	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut06"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
 	"github.com/elnosh/gonuts/mint/lightning"
+	"github.com/elnosh/gonuts/mint/storage"
 )
 
 type LogLevel int
@@ -15,6 +18,18 @@ const (
 	Disable
 )
 
+func (l LogLevel) String() string {
+	switch l {
+	case Info:
+		return "info"
+	case Debug:
+		return "debug"
+	case Disable:
+		return "disable"
+	}
+	return "unknown"
+}
+
 type Config struct {
 	DerivationPathIdx uint32
 	Port              int
@@ -25,10 +40,131 @@ type Config struct {
 	LightningClient   lightning.Client
 	EnableMPP         bool
 	LogLevel          LogLevel
+	IPPolicy          IPPolicy
+	CORS              CORSPolicy
+	DoubleSpends      DoubleSpendPolicy
+	QuoteRateLimit    QuoteRateLimit
+	Alerts            AlertConfig
+	// expiry, route hints and fallback address of the invoices for mint
+	// quotes. The expiry is also the expiry of the mint quotes
+	InvoiceOptions lightning.InvoiceOptions
+	// create AMP invoices for mint quotes if the lightning backend supports
+	// them. A quote is paid once the payments to its invoice add up to its amount
+	EnableAMP bool
+	// mint with and melt to BOLT12 offers (bolt12 method) if the lightning
+	// backend supports them. Offers can be paid and minted multiple times
+	EnableBOLT12 bool
+	// experimental. Adds an active keyset for the msat unit so that
+	// ecash can be minted, swapped and melted with sub-sat amounts.
+	// Mint quotes in msat have to be for whole sats.
+	EnableMsatUnit bool
+	// fiat units (usd, eur) with an active keyset besides sat. Their amounts
+	// are in cents and converted with the ExchangeRates for the invoices
+	Units         []cashu.Unit
+	ExchangeRates ExchangeRates
+	// name of a backend registered with lightning.Register to set up if the
+	// LightningClient is not set. Its settings are read with the LightningConfig
+	// or from the env if it is nil.
+	LightningBackend string
+	LightningConfig  func(key string) string
+	// sign the responses to proof state checks (NUT-07) with the key of the
+	// pubkey in the mint info so they can be shown to others as proof
+	// of the state of the proofs at a point in time
+	SignProofStates bool
+	// serve the signed statement of the public keys and the amounts issued and
+	// redeemed by each keyset at /v1/audit/keyepoch for auditors (see KeyEpoch)
+	PublishKeyEpochs bool
+	// keep the fee reserve in melt quotes that can be settled internally so that
+	// wallets can't tell the invoice is from another user of the mint. The fee
+	// reserve is returned as change (NUT-08) since no routing fees are paid
+	HideInternalSettlement bool
+	// wind down the mint. New mint quotes are rejected and minting is
+	// advertised as disabled but swaps and melts continue to work
+	RedeemOnly bool
+	// dev only. Run the mint as a faucet without a lightning backend, i.e for
+	// developing wallets against a local mint. The invoices of mint quotes are
+	// settled by the mint after the FaucetSettleDelay and melt quotes are paid
+	// without a payment. It is refused if a LightningClient other than the
+	// FakeBackend or a LightningBackend is set, or if the Network is not
+	// regtest, testnet or signet
+	FaucetMode        bool
+	FaucetSettleDelay time.Duration
+	// bitcoin network of the mint (mainnet, testnet, signet or regtest).
+	// Only checked to enable the FaucetMode
+	Network string
+	// address the REST API listens on. All interfaces if not set
+	ListenAddress string
+	// path prefix for the REST API (i.e /cashu). Served at the root if not set
+	BasePath string
+	// serve the REST API over HTTPS if cert and key files are set
+	TLSCertFile string
+	TLSKeyFile  string
+	// if set with TLS, listen on this port and redirect HTTP requests to HTTPS
+	HTTPRedirectPort int
+	// if set, listen on this port for operators to get the config and metrics
+	// of the mint (see AdminMetrics). Requests are filtered by the AdminIPPolicy
+	// instead of the IPPolicy. Only loopback addresses are allowed if its
+	// allow list is not set
+	AdminPort     int
+	AdminIPPolicy IPPolicy
+	// max size in bytes of a request body and max number of inputs
+	// or outputs in a request. Defaults are used if not set.
+	MaxRequestSize  int64
+	MaxRequestItems int
+	// max size in bytes of the witness of a proof or blinded message and max
+	// number of signatures in it. DefaultMaxWitnessSize and
+	// DefaultMaxWitnessSignatures if not set.
+	MaxWitnessSize       int
+	MaxWitnessSignatures int
+	// verify the proofs locked with custom NUT-10 kinds registered with
+	// nut10.RegisterKind. Proofs of registered kinds without a verifier are
+	// rejected. Kinds that are not registered can be spent by anyone.
+	ConditionVerifiers map[nut10.SecretKind]ConditionVerifier
+	// derive the keys of all keysets on startup and check they match their
+	// ids. By default the keys of inactive keysets are derived on first use
+	// so that mints with many keysets start faster
+	DeriveKeysetsOnStartup bool
+	// bearer token for operators to open wildcard websocket subscriptions
+	// to the state of all quotes and proofs. Disabled if not set
+	WebsocketAdminToken string
+	// called when a mint quote is created. Disabled if the URL is not set
+	QuoteWebhook QuoteWebhook
+	// log a hash of the client IP with each request so that requests from
+	// the same client can be correlated without logging its IP
+	LogClientFingerprint bool
+	// DB is optional. If set, the mint uses it instead of the sqlite db in
+	// the MintPath and the MintPath can be empty (i.e memory.NewMemoryDB()
+	// for a mint that is not persisted).
+	DB storage.MintDB
 	// NOTE: using this value for testing
 	MeltTimeout *time.Duration
 }
 
+// requestLimits returns the max size of a request body and max
+// number of inputs or outputs, with the defaults if not set
+func (c Config) requestLimits() (int64, int) {
+	maxRequestSize, maxRequestItems := c.MaxRequestSize, c.MaxRequestItems
+	if maxRequestSize <= 0 {
+		maxRequestSize = DefaultMaxRequestSize
+	}
+	if maxRequestItems <= 0 {
+		maxRequestItems = cashu.DefaultMaxStreamItems
+	}
+	return maxRequestSize, maxRequestItems
+}
+
+// witnessLimits returns the limits on witnesses with the defaults if not set
+func (c Config) witnessLimits() witnessLimits {
+	limits := witnessLimits{maxSize: c.MaxWitnessSize, maxSignatures: c.MaxWitnessSignatures}
+	if limits.maxSize <= 0 {
+		limits.maxSize = DefaultMaxWitnessSize
+	}
+	if limits.maxSignatures <= 0 {
+		limits.maxSignatures = DefaultMaxWitnessSignatures
+	}
+	return limits
+}
+
 type MintInfo struct {
 	Name            string
 	Description     string
@@ -42,6 +178,9 @@ type MintInfo struct {
 type MintMethodSettings struct {
 	MinAmount uint64
 	MaxAmount uint64
+	// quotes for a greater amount need a NUT-20 pubkey so that only the
+	// holder of the key can mint them. Not required if 0.
+	PubkeyRequiredAbove uint64
 }
 
 type MeltMethodSettings struct {
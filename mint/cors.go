@@ -0,0 +1,132 @@
+package mint
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+	defaultCORSHeaders = []string{"Content-Type", "Content-Length", "Origin"}
+)
+
+// CORSPolicy sets which browser origins can call the mint. Requests to read
+// from the mint (GET) are allowed from any origin. Requests that change state
+// (POST) are only allowed from the AllowedOrigins so they have to be opted in.
+type CORSPolicy struct {
+	// AllowedOrigins (i.e https://wallet.example.com) that can make POST
+	// requests. "*" allows any origin. If empty, browsers can only make GET requests.
+	AllowedOrigins []string
+	// AllowedMethods for requests from the AllowedOrigins. GET, POST and OPTIONS if not set.
+	AllowedMethods []string
+	// AllowedHeaders in requests. Content-Type, Content-Length and Origin if not set.
+	AllowedHeaders []string
+	// MaxAge browsers can cache the response to a preflight request. Not sent if not set.
+	MaxAge time.Duration
+}
+
+type corsHandler struct {
+	origins      map[string]bool
+	anyOrigin    bool
+	methods      map[string]bool
+	allowMethods string
+	allowHeaders string
+	maxAge       string
+}
+
+func newCORSHandler(policy CORSPolicy) (*corsHandler, error) {
+	handler := &corsHandler{
+		origins: make(map[string]bool),
+		methods: make(map[string]bool),
+	}
+	for _, origin := range policy.AllowedOrigins {
+		if origin == "*" {
+			handler.anyOrigin = true
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 || strings.Trim(u.Path, "/") != "" {
+			return nil, fmt.Errorf("invalid origin '%v'", origin)
+		}
+		handler.origins[u.Scheme+"://"+u.Host] = true
+	}
+
+	methods := policy.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	allowMethods := make([]string, 0, len(methods))
+	for _, method := range methods {
+		method = strings.ToUpper(strings.TrimSpace(method))
+		if len(method) == 0 {
+			return nil, errors.New("empty method in allowed methods")
+		}
+		allowMethods = append(allowMethods, method)
+		handler.methods[method] = true
+	}
+	handler.allowMethods = strings.Join(allowMethods, ", ")
+
+	headers := policy.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	handler.allowHeaders = strings.Join(headers, ", ")
+
+	if policy.MaxAge > 0 {
+		handler.maxAge = strconv.Itoa(int(policy.MaxAge.Seconds()))
+	}
+	return handler, nil
+}
+
+// originAllowed reports whether the origin was opted in to all methods
+func (c *corsHandler) originAllowed(origin string) bool {
+	return c.anyOrigin || c.origins[origin]
+}
+
+func (c *corsHandler) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		method := req.Method
+		preflight := req.Method == http.MethodOptions && len(req.Header.Get("Access-Control-Request-Method")) > 0
+		if preflight {
+			method = strings.ToUpper(req.Header.Get("Access-Control-Request-Method"))
+		}
+
+		header := rw.Header()
+		header.Add("Vary", "Origin")
+		if len(origin) > 0 {
+			switch {
+			case c.originAllowed(origin) && c.methods[method]:
+				header.Set("Access-Control-Allow-Origin", origin)
+				if preflight {
+					header.Set("Access-Control-Allow-Methods", c.allowMethods)
+				}
+			case method == http.MethodGet:
+				header.Set("Access-Control-Allow-Origin", "*")
+				if preflight {
+					header.Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+				}
+			}
+			if len(header.Get("Access-Control-Allow-Origin")) > 0 {
+				header.Set("Access-Control-Expose-Headers", RequestIdHeader)
+				if preflight {
+					header.Set("Access-Control-Allow-Headers", c.allowHeaders)
+					if len(c.maxAge) > 0 {
+						header.Set("Access-Control-Max-Age", c.maxAge)
+					}
+				}
+			}
+		}
+
+		if req.Method == http.MethodOptions {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,210 @@
+package mint
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/gorilla/mux"
+)
+
+// max number of IPs and tokens for which attempts are counted.
+// Attempts from others after that are only added to the total.
+const maxTrackedDoubleSpends = 10000
+
+var throttledRequestErr = cashu.Error{Detail: "too many requests", Code: cashu.StandardErrCode}
+
+// DoubleSpendPolicy throttles clients that repeatedly
+// try to spend proofs that were already spent.
+type DoubleSpendPolicy struct {
+	// MaxAttempts from an IP within Window after which requests from
+	// it are rejected for BanDuration. Throttling is disabled if not set.
+	MaxAttempts int
+	Window      time.Duration
+	BanDuration time.Duration
+}
+
+// DoubleSpendAttempts has the number of requests with proofs that were
+// already spent by client IP and by token (fingerprint of the inputs).
+type DoubleSpendAttempts struct {
+	Total   uint64
+	ByIP    map[string]uint64
+	ByToken map[string]uint64
+	// IPs currently throttled and the time until which they are
+	Banned map[string]time.Time
+}
+
+type doubleSpendMonitor struct {
+	policy DoubleSpendPolicy
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	total   uint64
+	byIP    map[string]uint64
+	byToken map[string]uint64
+	// times of the attempts within the window for each IP
+	recent map[string][]time.Time
+	banned map[string]time.Time
+}
+
+func newDoubleSpendMonitor(policy DoubleSpendPolicy, logger *slog.Logger) *doubleSpendMonitor {
+	return &doubleSpendMonitor{
+		policy:  policy.withDefaults(),
+		logger:  logger,
+		byIP:    make(map[string]uint64),
+		byToken: make(map[string]uint64),
+		recent:  make(map[string][]time.Time),
+		banned:  make(map[string]time.Time),
+	}
+}
+
+func (policy DoubleSpendPolicy) withDefaults() DoubleSpendPolicy {
+	if policy.MaxAttempts > 0 {
+		if policy.Window <= 0 {
+			policy.Window = time.Hour
+		}
+		if policy.BanDuration <= 0 {
+			policy.BanDuration = time.Hour
+		}
+	}
+	return policy
+}
+
+// setPolicy changes the policy while running. IPs
+// currently throttled stay throttled until their ban ends.
+func (d *doubleSpendMonitor) setPolicy(policy DoubleSpendPolicy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.policy = policy.withDefaults()
+}
+
+func (d *doubleSpendMonitor) throttleEnabled() bool {
+	return d.policy.MaxAttempts > 0
+}
+
+// tokenFingerprint identifies the set of inputs regardless of their order
+func tokenFingerprint(proofs cashu.Proofs) string {
+	secrets := make([]string, len(proofs))
+	for i, proof := range proofs {
+		secrets[i] = proof.Secret
+	}
+	slices.Sort(secrets)
+
+	hash := sha256.New()
+	for _, secret := range secrets {
+		hash.Write([]byte(secret))
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
+
+// record counts an attempt to spend the proofs that were already spent
+// and bans the IP if it reached the max attempts in the window
+func (d *doubleSpendMonitor) record(ip net.IP, proofs cashu.Proofs) {
+	ipStr := ip.String()
+	fingerprint := tokenFingerprint(proofs)
+	now := time.Now()
+
+	d.mu.Lock()
+	d.total++
+	increment(d.byIP, ipStr)
+	increment(d.byToken, fingerprint)
+
+	var bannedUntil time.Time
+	if d.throttleEnabled() {
+		attempts := append(d.recent[ipStr], now)
+		// only keep attempts within the window
+		cutoff := now.Add(-d.policy.Window)
+		for len(attempts) > 0 && attempts[0].Before(cutoff) {
+			attempts = attempts[1:]
+		}
+		if len(attempts) >= d.policy.MaxAttempts {
+			bannedUntil = now.Add(d.policy.BanDuration)
+			d.banned[ipStr] = bannedUntil
+			delete(d.recent, ipStr)
+		} else if _, ok := d.recent[ipStr]; ok || len(d.recent) < maxTrackedDoubleSpends {
+			d.recent[ipStr] = attempts
+		}
+	}
+	attemptsFromIP := d.byIP[ipStr]
+	d.mu.Unlock()
+
+	r := slog.NewRecord(now, slog.LevelWarn, "attempt to spend proofs already spent", 0)
+	r.Add(slog.String("ip", ipStr), slog.String("token", fingerprint), slog.Uint64("attempts", attemptsFromIP))
+	_ = d.logger.Handler().Handle(context.Background(), r)
+
+	if !bannedUntil.IsZero() {
+		d.logger.Warn("throttling requests from IP after repeated double spend attempts",
+			slog.String("ip", ipStr), slog.Time("until", bannedUntil))
+	}
+}
+
+func increment(counts map[string]uint64, key string) {
+	if _, ok := counts[key]; ok || len(counts) < maxTrackedDoubleSpends {
+		counts[key]++
+	}
+}
+
+// isBanned returns whether requests from the IP are currently throttled
+func (d *doubleSpendMonitor) isBanned(ip net.IP) bool {
+	ipStr := ip.String()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	until, ok := d.banned[ipStr]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(d.banned, ipStr)
+		return false
+	}
+	return true
+}
+
+func (d *doubleSpendMonitor) middleware(clientIP func(*http.Request) net.IP) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if d.isBanned(clientIP(req)) {
+				rw.Header().Set("Content-Type", "application/json")
+				rw.WriteHeader(http.StatusTooManyRequests)
+				errRes, _ := json.Marshal(throttledRequestErr)
+				rw.Write(errRes)
+				return
+			}
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
+
+func (d *doubleSpendMonitor) attempts() DoubleSpendAttempts {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	attempts := DoubleSpendAttempts{
+		Total:   d.total,
+		ByIP:    make(map[string]uint64, len(d.byIP)),
+		ByToken: make(map[string]uint64, len(d.byToken)),
+		Banned:  make(map[string]time.Time),
+	}
+	for ip, count := range d.byIP {
+		attempts.ByIP[ip] = count
+	}
+	for token, count := range d.byToken {
+		attempts.ByToken[token] = count
+	}
+	now := time.Now()
+	for ip, until := range d.banned {
+		if until.After(now) {
+			attempts.Banned[ip] = until
+		}
+	}
+	return attempts
+}
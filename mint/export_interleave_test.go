@@ -0,0 +1,16 @@
+//go:build interleave
+
+package mint
+
+// exported for the interleave tests in package mint_test
+var (
+	SetSyncHook    = setSyncHook
+	ResetSyncHooks = resetSyncHooks
+)
+
+const (
+	SyncMintQuotePaid           = syncMintQuotePaid
+	SyncMintQuoteInvoiceSettled = syncMintQuoteInvoiceSettled
+	SyncSwapProofsVerified      = syncSwapProofsVerified
+	SyncMeltProofsVerified      = syncMeltProofsVerified
+)
@@ -0,0 +1,70 @@
+package mint
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/elnosh/gonuts/mint/lightning"
+)
+
+// DefaultFaucetMotd is the motd advertised in faucet mode
+// if the mint does not have one set.
+const DefaultFaucetMotd = "This mint is a faucet for development. Quotes are settled without lightning payments and its ecash is not backed by sats."
+
+// networks on which a mint can run in faucet mode
+var faucetNetworks = []string{"regtest", "testnet", "testnet4", "signet"}
+
+// checkFaucetConfig refuses faucet mode on networks with real funds and if
+// a lightning backend is set, since melts would succeed without paying
+func checkFaucetConfig(config Config) error {
+	if !slices.Contains(faucetNetworks, strings.ToLower(config.Network)) {
+		return fmt.Errorf("faucet mode is only allowed on regtest, testnet or signet but network is '%v'", config.Network)
+	}
+	if _, fake := config.LightningClient.(*lightning.FakeBackend); (config.LightningClient != nil && !fake) ||
+		len(config.LightningBackend) > 0 {
+		return errors.New("faucet mode can't be used with a lightning backend")
+	}
+	return nil
+}
+
+// faucetBackend is the lightning backend of mints in faucet mode. The invoices
+// of mint quotes are settled by the backend itself after the delay and
+// payments for melt quotes succeed right away, like with the FakeBackend.
+type faucetBackend struct {
+	*lightning.ExternalBackend
+	settleDelay time.Duration
+}
+
+func newFaucetBackend(settleDelay time.Duration) *faucetBackend {
+	fb := &faucetBackend{
+		ExternalBackend: &lightning.ExternalBackend{},
+		settleDelay:     settleDelay,
+	}
+	fb.OnPayment = func(payment lightning.ExternalPayment) {
+		fb.CompletePayment(payment.PaymentHash, lightning.FakePreimage, 0)
+	}
+	return fb
+}
+
+// CreateInvoice creates an invoice that is settled after the delay
+// or before returning it if there is no delay
+func (fb *faucetBackend) CreateInvoice(amount uint64, opts lightning.InvoiceOptions) (lightning.Invoice, error) {
+	invoice, err := fb.ExternalBackend.CreateInvoice(amount, opts)
+	if err != nil {
+		return lightning.Invoice{}, err
+	}
+	if fb.settleDelay <= 0 {
+		if err := fb.SettleInvoice(invoice.PaymentHash, ""); err != nil {
+			return lightning.Invoice{}, err
+		}
+		return fb.InvoiceStatus(invoice.PaymentHash)
+	}
+
+	time.AfterFunc(fb.settleDelay, func() {
+		fb.SettleInvoice(invoice.PaymentHash, "")
+	})
+	return invoice, nil
+}
@@ -0,0 +1,136 @@
+package mint
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/elnosh/gonuts/cashu"
+)
+
+// FeeChangeReport estimates the impact of changing the input fee of the
+// active keyset, or of rotating to a new keyset with a different fee.
+// Estimates assume every outstanding proof gets spent once and are a lower
+// bound since fees are rounded up per transaction.
+type FeeChangeReport struct {
+	CurrentInputFeePpk  uint
+	ProposedInputFeePpk uint
+	Rotate              bool
+
+	Keysets           []KeysetOutstanding
+	OutstandingProofs uint64
+	OutstandingAmount uint64
+
+	// fee income from spending the outstanding proofs
+	// at the current fees and after the change
+	CurrentFeeIncome  uint64
+	ProposedFeeIncome uint64
+
+	// proofs in the active keyset that wallets are expected to
+	// swap to the new keyset if the active keyset is rotated
+	SwapChurnProofs uint64
+	SwapChurnAmount uint64
+}
+
+// KeysetOutstanding has the proofs issued by a keyset
+// that have not been redeemed yet.
+type KeysetOutstanding struct {
+	Id                string
+	Active            bool
+	InputFeePpk       uint
+	OutstandingProofs uint64
+	OutstandingAmount uint64
+	// number of outstanding proofs by amount
+	Denominations map[uint64]uint64
+}
+
+// FeeChangeReport builds a report of the outstanding proofs in each keyset
+// and the estimated impact of the proposed fee. If rotate is true, the
+// proposed fee is for a new active keyset. Otherwise it is for the
+// current active keyset. It does not make any changes to the mint.
+func (m *Mint) FeeChangeReport(proposedInputFeePpk uint, rotate bool) (*FeeChangeReport, error) {
+	issued, err := m.db.GetIssuedDenominations()
+	if err != nil {
+		return nil, err
+	}
+	redeemed, err := m.db.GetRedeemedDenominations()
+	if err != nil {
+		return nil, err
+	}
+
+	activeKeyset := m.GetActiveKeyset()
+	report := &FeeChangeReport{
+		CurrentInputFeePpk:  activeKeyset.InputFeePpk,
+		ProposedInputFeePpk: proposedInputFeePpk,
+		Rotate:              rotate,
+	}
+
+	// amounts in the report are in sats so keysets of other units are not included
+	outstanding := make(map[string]*KeysetOutstanding)
+	for _, keyset := range m.getKeysets() {
+		if keyset.Unit != cashu.Sat.String() {
+			continue
+		}
+		outstanding[keyset.Id] = &KeysetOutstanding{
+			Id:            keyset.Id,
+			Active:        keyset.Active,
+			InputFeePpk:   keyset.InputFeePpk,
+			Denominations: make(map[uint64]uint64),
+		}
+	}
+
+	for _, denomination := range issued {
+		// ignore signatures from keysets the mint does not have
+		if keyset, ok := outstanding[denomination.KeysetId]; ok {
+			keyset.Denominations[denomination.Amount] += denomination.Count
+		}
+	}
+	for _, denomination := range redeemed {
+		if keyset, ok := outstanding[denomination.KeysetId]; ok {
+			count := keyset.Denominations[denomination.Amount]
+			// proofs could have been redeemed for signatures issued
+			// before blind signatures were stored
+			if denomination.Count >= count {
+				delete(keyset.Denominations, denomination.Amount)
+			} else {
+				keyset.Denominations[denomination.Amount] = count - denomination.Count
+			}
+		}
+	}
+
+	var currentFeesPpk, proposedFeesPpk uint64
+	for _, keyset := range outstanding {
+		for amount, count := range keyset.Denominations {
+			keyset.OutstandingProofs += count
+			keyset.OutstandingAmount += amount * count
+		}
+		report.OutstandingProofs += keyset.OutstandingProofs
+		report.OutstandingAmount += keyset.OutstandingAmount
+
+		keysetFeesPpk := keyset.OutstandingProofs * uint64(keyset.InputFeePpk)
+		currentFeesPpk += keysetFeesPpk
+
+		if keyset.Id == activeKeyset.Id {
+			if rotate {
+				// proofs are swapped once paying the current fee and
+				// the new proofs are later spent with the proposed fee
+				report.SwapChurnProofs = keyset.OutstandingProofs
+				report.SwapChurnAmount = keyset.OutstandingAmount
+				proposedFeesPpk += keysetFeesPpk + keyset.OutstandingProofs*uint64(proposedInputFeePpk)
+			} else {
+				proposedFeesPpk += keyset.OutstandingProofs * uint64(proposedInputFeePpk)
+			}
+		} else {
+			proposedFeesPpk += keysetFeesPpk
+		}
+
+		report.Keysets = append(report.Keysets, *keyset)
+	}
+	report.CurrentFeeIncome = (currentFeesPpk + 999) / 1000
+	report.ProposedFeeIncome = (proposedFeesPpk + 999) / 1000
+
+	slices.SortFunc(report.Keysets, func(a, b KeysetOutstanding) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+
+	return report, nil
+}
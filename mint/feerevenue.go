@@ -0,0 +1,95 @@
+package mint
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/elnosh/gonuts/cashu"
+)
+
+// KeysetRevenue is the total of input fees collected
+// from the proofs of a keyset spent in swaps and melts.
+type KeysetRevenue struct {
+	Id          string
+	Unit        string
+	Active      bool
+	InputFeePpk uint
+	Fees        uint64
+}
+
+// FeeRevenue returns the input fees collected by each keyset of the mint.
+// Keysets that have not collected fees are included with 0.
+func (m *Mint) FeeRevenue() ([]KeysetRevenue, error) {
+	keysetFees, err := m.db.GetKeysetFees()
+	if err != nil {
+		return nil, fmt.Errorf("error getting keyset fees from db: %v", err)
+	}
+	fees := make(map[string]uint64, len(keysetFees))
+	for _, keysetFee := range keysetFees {
+		fees[keysetFee.KeysetId] = keysetFee.Fees
+	}
+
+	keysets := m.getKeysets()
+	revenue := make([]KeysetRevenue, 0, len(keysets))
+	for _, keyset := range keysets {
+		revenue = append(revenue, KeysetRevenue{
+			Id:          keyset.Id,
+			Unit:        keyset.Unit,
+			Active:      keyset.Active,
+			InputFeePpk: keyset.InputFeePpk,
+			Fees:        fees[keyset.Id],
+		})
+	}
+	slices.SortFunc(revenue, func(a, b KeysetRevenue) int {
+		return cmp.Or(cmp.Compare(a.Unit, b.Unit), cmp.Compare(a.Id, b.Id))
+	})
+	return revenue, nil
+}
+
+// recordFees adds the fees paid by the inputs of a swap or melt that was
+// completed to the revenue of their keysets. The proofs are already spent
+// so errors are only logged.
+func (m *Mint) recordFees(ctx context.Context, inputs cashu.Proofs) {
+	fees := m.feesByKeyset(inputs)
+	if len(fees) == 0 {
+		return
+	}
+	if err := m.db.AddKeysetFees(fees); err != nil {
+		m.logErrorContextf(ctx, "could not record fees collected: %v", err)
+	}
+}
+
+// feesByKeyset splits the fees of the inputs (TransactionFees) by keyset.
+// The fee is rounded up once per transaction so the sats from rounding
+// go to the keyset with the largest share.
+func (m *Mint) feesByKeyset(inputs cashu.Proofs) map[string]uint64 {
+	ppkByKeyset := make(map[string]uint64)
+	var totalPpk uint64
+	keysets := m.getKeysets()
+	for _, proof := range inputs {
+		ppk := uint64(keysets[proof.Id].InputFeePpk)
+		if ppk == 0 {
+			continue
+		}
+		ppkByKeyset[proof.Id] += ppk
+		totalPpk += ppk
+	}
+	if totalPpk == 0 {
+		return nil
+	}
+
+	fees := make(map[string]uint64, len(ppkByKeyset))
+	var allocated uint64
+	var largest string
+	for keysetId, ppk := range ppkByKeyset {
+		fees[keysetId] = ppk / 1000
+		allocated += ppk / 1000
+		if len(largest) == 0 || ppk > ppkByKeyset[largest] || (ppk == ppkByKeyset[largest] && keysetId < largest) {
+			largest = keysetId
+		}
+	}
+	fees[largest] += (totalPpk+999)/1000 - allocated
+	return fees
+}
@@ -0,0 +1,218 @@
+package mint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+)
+
+const (
+	blockedNotAllowed = "not_allowed"
+	blockedDenied     = "denied"
+	blockedCountry    = "country"
+)
+
+var blockedRequestErr = cashu.Error{Detail: "requests from this location are not allowed", Code: cashu.StandardErrCode}
+
+// CountryResolver returns the ISO 3166-1 alpha-2 country code for an IP.
+// It can be implemented with a GeoIP database of the operator's choice.
+type CountryResolver interface {
+	Country(ip net.IP) (string, error)
+}
+
+// IPPolicy restricts which clients can make requests to the mint.
+type IPPolicy struct {
+	// AllowList of CIDR ranges. If not empty, only requests
+	// from IPs in one of these ranges are allowed.
+	AllowList []string
+	// DenyList of CIDR ranges from which requests are rejected.
+	DenyList []string
+	// BlockedCountries are country codes from which requests are rejected.
+	// Requires a CountryResolver.
+	BlockedCountries []string
+	CountryResolver  CountryResolver
+	// TrustedProxies are CIDR ranges of the proxies in front of the mint.
+	// For requests from these, the client IP is the rightmost address in the
+	// X-Forwarded-For header that is not of a trusted proxy. The header
+	// is ignored if not set.
+	TrustedProxies []string
+}
+
+type ipFilter struct {
+	allow            []*net.IPNet
+	deny             []*net.IPNet
+	blockedCountries map[string]bool
+	countryResolver  CountryResolver
+	trustedProxies   []*net.IPNet
+	logger           *slog.Logger
+
+	mu      sync.Mutex
+	blocked map[string]uint64
+}
+
+func newIPFilter(policy IPPolicy, logger *slog.Logger) (*ipFilter, error) {
+	filter := &ipFilter{
+		blockedCountries: make(map[string]bool),
+		countryResolver:  policy.CountryResolver,
+		logger:           logger,
+		blocked:          make(map[string]uint64),
+	}
+
+	var err error
+	filter.allow, err = parseCIDRs(policy.AllowList)
+	if err != nil {
+		return nil, fmt.Errorf("invalid allow list: %v", err)
+	}
+	filter.deny, err = parseCIDRs(policy.DenyList)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deny list: %v", err)
+	}
+	filter.trustedProxies, err = parseCIDRs(policy.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %v", err)
+	}
+
+	if len(policy.BlockedCountries) > 0 && policy.CountryResolver == nil {
+		return nil, errors.New("blocking countries requires a country resolver")
+	}
+	for _, country := range policy.BlockedCountries {
+		filter.blockedCountries[strings.ToUpper(country)] = true
+	}
+
+	return filter, nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		// allow single IPs
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, ipnet)
+	}
+	return nets, nil
+}
+
+func (f *ipFilter) enabled() bool {
+	return len(f.allow) > 0 || len(f.deny) > 0 || len(f.blockedCountries) > 0
+}
+
+// clientIP returns the IP the request comes from. If it comes from a trusted
+// proxy, the X-Forwarded-For header is read from the right since each proxy
+// appends the address it got the request from. The first address that is not
+// of a trusted proxy is the client. Addresses to the left of it are set by
+// the client and can't be trusted.
+func (f *ipFilter) clientIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(f.trustedProxies, ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, forwarded := range req.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(forwarded, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		// not appended by a trusted proxy, so use the last hop that was
+		if hop == nil {
+			return ip
+		}
+		ip = hop
+		if !containsIP(f.trustedProxies, ip) {
+			return ip
+		}
+	}
+	return ip
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipnet := range nets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the reason the ip is blocked or an empty string if it is allowed
+func (f *ipFilter) check(ip net.IP) string {
+	if ip == nil {
+		return blockedNotAllowed
+	}
+	if len(f.allow) > 0 && !containsIP(f.allow, ip) {
+		return blockedNotAllowed
+	}
+	if containsIP(f.deny, ip) {
+		return blockedDenied
+	}
+	if len(f.blockedCountries) > 0 {
+		country, err := f.countryResolver.Country(ip)
+		// if country can't be resolved, let request through
+		if err == nil && f.blockedCountries[strings.ToUpper(country)] {
+			return blockedCountry
+		}
+	}
+	return ""
+}
+
+func (f *ipFilter) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		ip := f.clientIP(req)
+		if reason := f.check(ip); len(reason) > 0 {
+			f.mu.Lock()
+			f.blocked[reason]++
+			f.mu.Unlock()
+
+			r := slog.NewRecord(time.Now(), slog.LevelWarn, "blocked request", 0)
+			r.Add(slog.String("ip", ip.String()), slog.String("reason", reason),
+				slog.Group("request",
+					slog.String("method", req.Method),
+					slog.String("url", req.URL.String())),
+			)
+			_ = f.logger.Handler().Handle(context.Background(), r)
+
+			rw.Header().Set("Content-Type", "application/json")
+			rw.WriteHeader(http.StatusForbidden)
+			errRes, _ := json.Marshal(blockedRequestErr)
+			rw.Write(errRes)
+			return
+		}
+
+		next.ServeHTTP(rw, req)
+	})
+}
+
+func (f *ipFilter) blockedRequests() map[string]uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	blocked := make(map[string]uint64, len(f.blocked))
+	for reason, count := range f.blocked {
+		blocked[reason] = count
+	}
+	return blocked
+}
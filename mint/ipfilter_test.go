@@ -0,0 +1,232 @@
+package mint
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	filter, err := newIPFilter(IPPolicy{
+		TrustedProxies: []string{"10.0.0.2", "10.1.0.0/16"},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		expected   string
+	}{
+		{
+			name:       "no proxy",
+			remoteAddr: "198.51.100.7:4000",
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "spoofed header from untrusted peer",
+			remoteAddr: "198.51.100.7:4000",
+			forwarded:  []string{"203.0.113.9"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.0.0.2:4000",
+			forwarded:  []string{"198.51.100.7"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "spoofed hop before the one appended by the proxy",
+			remoteAddr: "10.0.0.2:4000",
+			forwarded:  []string{"203.0.113.9, 198.51.100.7"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "spoofed trusted proxy hop",
+			remoteAddr: "10.0.0.2:4000",
+			forwarded:  []string{"10.1.0.5, 198.51.100.7"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "chain of trusted proxies",
+			remoteAddr: "10.0.0.2:4000",
+			forwarded:  []string{"203.0.113.9, 198.51.100.7, 10.1.0.5"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "multiple headers",
+			remoteAddr: "10.0.0.2:4000",
+			forwarded:  []string{"203.0.113.9", "198.51.100.7, 10.1.3.4"},
+			expected:   "198.51.100.7",
+		},
+		{
+			name:       "invalid hop",
+			remoteAddr: "10.0.0.2:4000",
+			forwarded:  []string{"198.51.100.7, not-an-ip, 10.1.0.5"},
+			expected:   "10.1.0.5",
+		},
+		{
+			name:       "trusted proxy without header",
+			remoteAddr: "10.0.0.2:4000",
+			expected:   "10.0.0.2",
+		},
+		{
+			name:       "only trusted proxies",
+			remoteAddr: "10.0.0.2:4000",
+			forwarded:  []string{"10.1.0.5, 10.1.0.6"},
+			expected:   "10.1.0.5",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/info", nil)
+			req.RemoteAddr = test.remoteAddr
+			for _, forwarded := range test.forwarded {
+				req.Header.Add("X-Forwarded-For", forwarded)
+			}
+
+			ip := filter.clientIP(req)
+			if ip.String() != test.expected {
+				t.Fatalf("expected client IP '%v' but got '%v'", test.expected, ip)
+			}
+		})
+	}
+}
+
+func TestIPFilterSpoofedHeader(t *testing.T) {
+	filter, err := newIPFilter(IPPolicy{
+		AllowList:      []string{"192.168.1.0/24"},
+		DenyList:       []string{"192.168.1.66"},
+		TrustedProxies: []string{"10.0.0.2"},
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	handler := filter.middleware(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		expected   int
+	}{
+		{
+			name:       "allowed client through proxy",
+			remoteAddr: "10.0.0.2:4000",
+			forwarded:  "192.168.1.20",
+			expected:   http.StatusOK,
+		},
+		{
+			name:       "allowed IP spoofed without proxy",
+			remoteAddr: "198.51.100.7:4000",
+			forwarded:  "192.168.1.20",
+			expected:   http.StatusForbidden,
+		},
+		{
+			name:       "allowed IP spoofed through proxy",
+			remoteAddr: "10.0.0.2:4000",
+			forwarded:  "192.168.1.20, 198.51.100.7",
+			expected:   http.StatusForbidden,
+		},
+		{
+			name:       "denied client spoofing allowed IP through proxy",
+			remoteAddr: "10.0.0.2:4000",
+			forwarded:  "192.168.1.20, 192.168.1.66",
+			expected:   http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/v1/info", nil)
+			req.RemoteAddr = test.remoteAddr
+			req.Header.Set("X-Forwarded-For", test.forwarded)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != test.expected {
+				t.Fatalf("expected status %v but got %v", test.expected, rec.Code)
+			}
+		})
+	}
+
+	blocked := filter.blockedRequests()
+	if blocked[blockedNotAllowed] != 2 || blocked[blockedDenied] != 1 {
+		t.Fatalf("unexpected blocked requests: %v", blocked)
+	}
+}
+
+func TestAdminIPPolicy(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ms := &MintServer{
+		mint:         &Mint{logger: logger},
+		quoteLimiter: newQuoteLimiter(QuoteRateLimit{}, logger),
+	}
+	var err error
+	ms.ipFilter, err = newIPFilter(IPPolicy{}, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	adminRequest := func(remoteAddr, forwarded string) int {
+		req := httptest.NewRequest(http.MethodGet, "/v1/admin/metrics", nil)
+		req.RemoteAddr = remoteAddr
+		if len(forwarded) > 0 {
+			req.Header.Set("X-Forwarded-For", forwarded)
+		}
+		rec := httptest.NewRecorder()
+		ms.adminServer.Handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// only loopback is allowed by default
+	if err := ms.setupAdminServer(Config{AdminPort: 3339}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code := adminRequest("127.0.0.1:4000", ""); code != http.StatusOK {
+		t.Fatalf("expected status %v but got %v", http.StatusOK, code)
+	}
+	if code := adminRequest("[::1]:4000", ""); code != http.StatusOK {
+		t.Fatalf("expected status %v but got %v", http.StatusOK, code)
+	}
+	if code := adminRequest("198.51.100.7:4000", ""); code != http.StatusForbidden {
+		t.Fatalf("expected status %v but got %v", http.StatusForbidden, code)
+	}
+	// header is ignored without trusted proxies
+	if code := adminRequest("198.51.100.7:4000", "127.0.0.1"); code != http.StatusForbidden {
+		t.Fatalf("expected status %v but got %v", http.StatusForbidden, code)
+	}
+	if blocked := ms.Metrics().AdminBlockedRequests; blocked[blockedNotAllowed] != 2 {
+		t.Fatalf("expected 2 blocked admin requests but got %v", blocked)
+	}
+
+	// loopback is no longer allowed if the allow list is set
+	config := Config{
+		AdminPort:     3339,
+		AdminIPPolicy: IPPolicy{AllowList: []string{"10.2.0.0/16"}, TrustedProxies: []string{"10.0.0.2"}},
+	}
+	if err := ms.setupAdminServer(config); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code := adminRequest("10.0.0.2:4000", "10.2.0.9"); code != http.StatusOK {
+		t.Fatalf("expected status %v but got %v", http.StatusOK, code)
+	}
+	if code := adminRequest("10.0.0.2:4000", "10.2.0.9, 198.51.100.7"); code != http.StatusForbidden {
+		t.Fatalf("expected status %v but got %v", http.StatusForbidden, code)
+	}
+	if code := adminRequest("127.0.0.1:4000", ""); code != http.StatusForbidden {
+		t.Fatalf("expected status %v but got %v", http.StatusForbidden, code)
+	}
+
+	config.AdminIPPolicy = IPPolicy{TrustedProxies: []string{"not-an-ip"}}
+	if err := ms.setupAdminServer(config); err == nil {
+		t.Fatal("expected error for invalid admin IP policy")
+	}
+}
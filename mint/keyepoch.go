@@ -0,0 +1,162 @@
+package mint
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// KeyEpoch is a statement signed by the mint with the public keys of its keysets
+// and the amounts issued and redeemed by each of them up to the timestamp. Auditors
+// can collect statements over time to check the outstanding amount of each keyset
+// (proof of liabilities) and that the mint did not change the keys of a keyset.
+type KeyEpoch struct {
+	Timestamp int64         `json:"timestamp"`
+	Keysets   []KeysetEpoch `json:"keysets"`
+	// pubkey in the mint info that signed the statement
+	Pubkey    string `json:"pubkey"`
+	Signature string `json:"signature"`
+}
+
+// KeysetEpoch has the public keys of a keyset and
+// the total amounts issued and redeemed in its unit.
+type KeysetEpoch struct {
+	Id          string            `json:"id"`
+	Unit        string            `json:"unit"`
+	Active      bool              `json:"active"`
+	InputFeePpk uint              `json:"input_fee_ppk"`
+	Keys        map[uint64]string `json:"keys"`
+	Issued      uint64            `json:"issued"`
+	Redeemed    uint64            `json:"redeemed"`
+}
+
+// KeyEpoch returns the statement of the keysets of the mint at the current
+// time signed with the key of the pubkey in the mint info.
+func (m *Mint) KeyEpoch() (*KeyEpoch, error) {
+	issued, err := m.db.GetIssuedDenominations()
+	if err != nil {
+		return nil, err
+	}
+	redeemed, err := m.db.GetRedeemedDenominations()
+	if err != nil {
+		return nil, err
+	}
+
+	keysets := m.getKeysets()
+	epochs := make(map[string]*KeysetEpoch, len(keysets))
+	for id := range keysets {
+		keyset, _, err := m.keysetWithKeys(id)
+		if err != nil {
+			return nil, fmt.Errorf("could not derive keys of keyset '%v': %v", id, err)
+		}
+		epochs[id] = &KeysetEpoch{
+			Id:          keyset.Id,
+			Unit:        keyset.Unit,
+			Active:      keyset.Active,
+			InputFeePpk: keyset.InputFeePpk,
+			Keys:        keyset.DerivePublic(),
+		}
+	}
+	for _, denomination := range issued {
+		// ignore signatures from keysets the mint does not have
+		if epoch, ok := epochs[denomination.KeysetId]; ok {
+			epoch.Issued += denomination.Amount * denomination.Count
+		}
+	}
+	for _, denomination := range redeemed {
+		if epoch, ok := epochs[denomination.KeysetId]; ok {
+			epoch.Redeemed += denomination.Amount * denomination.Count
+		}
+	}
+
+	keyEpoch := &KeyEpoch{Timestamp: time.Now().Unix()}
+	for _, epoch := range epochs {
+		keyEpoch.Keysets = append(keyEpoch.Keysets, *epoch)
+	}
+	slices.SortFunc(keyEpoch.Keysets, func(a, b KeysetEpoch) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+
+	seed, err := m.db.GetSeed()
+	if err != nil {
+		return nil, fmt.Errorf("error getting seed from db: %v", err)
+	}
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+	// same key as the pubkey in the mint info
+	key, err := master.ECPrivKey()
+	if err != nil {
+		return nil, err
+	}
+	keyEpoch.Pubkey = hex.EncodeToString(key.PubKey().SerializeCompressed())
+
+	hash := keyEpochHash(*keyEpoch)
+	signature, err := schnorr.Sign(key, hash[:])
+	if err != nil {
+		return nil, fmt.Errorf("could not sign key epoch: %v", err)
+	}
+	keyEpoch.Signature = hex.EncodeToString(signature.Serialize())
+	return keyEpoch, nil
+}
+
+// VerifyKeyEpoch checks that the statement was signed with the pubkey in it.
+// Auditors should also check that it is the pubkey in the info of the mint.
+func VerifyKeyEpoch(keyEpoch KeyEpoch) bool {
+	pubkeyBytes, err := hex.DecodeString(keyEpoch.Pubkey)
+	if err != nil {
+		return false
+	}
+	pubkey, err := btcec.ParsePubKey(pubkeyBytes)
+	if err != nil {
+		return false
+	}
+	sigBytes, err := hex.DecodeString(keyEpoch.Signature)
+	if err != nil {
+		return false
+	}
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return false
+	}
+	hash := keyEpochHash(keyEpoch)
+	return sig.Verify(hash[:], pubkey)
+}
+
+// keyEpochHash is the hash of the id, unit, active state, fee, totals and keys sorted by
+// amount of each keyset in the order of the statement followed by the pubkey and timestamp.
+// Fields are separated by '|' so that the amounts next to each other can't be moved around.
+func keyEpochHash(keyEpoch KeyEpoch) [32]byte {
+	var fields []string
+	for _, keyset := range keyEpoch.Keysets {
+		fields = append(fields,
+			keyset.Id,
+			keyset.Unit,
+			strconv.FormatBool(keyset.Active),
+			strconv.FormatUint(uint64(keyset.InputFeePpk), 10),
+			strconv.FormatUint(keyset.Issued, 10),
+			strconv.FormatUint(keyset.Redeemed, 10),
+		)
+
+		amounts := make([]uint64, 0, len(keyset.Keys))
+		for amount := range keyset.Keys {
+			amounts = append(amounts, amount)
+		}
+		slices.Sort(amounts)
+		for _, amount := range amounts {
+			fields = append(fields, strconv.FormatUint(amount, 10), keyset.Keys[amount])
+		}
+	}
+	fields = append(fields, keyEpoch.Pubkey, strconv.FormatInt(keyEpoch.Timestamp, 10))
+	return sha256.Sum256([]byte(strings.Join(fields, "|")))
+}
@@ -0,0 +1,116 @@
+package mint
+
+import (
+	"encoding/hex"
+	"fmt"
+	"maps"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// DefaultImportMaxOrder is the number of keys in keysets generated by
+// nutshell. Keysets from other implementations might have fewer.
+const DefaultImportMaxOrder = 64
+
+// KeysetImport has what is needed to derive a keyset
+// that was generated by another mint implementation.
+type KeysetImport struct {
+	// BIP32 seed used by the other mint
+	Seed []byte
+	// path of the keyset such as m/0'/0'/0'. The key
+	// for amount 2^i is derived at DerivationPath/i'
+	DerivationPath string
+	// number of keys in the keyset. DefaultImportMaxOrder if not set
+	MaxOrder    int
+	InputFeePpk uint
+	// Id of the keyset in the other mint. If set, the derived keyset must
+	// match it. Both versioned and legacy base64 ids are supported.
+	Id string
+	// unit of the keyset. Sat if not set
+	Unit string
+}
+
+// ImportKeyset derives the keyset and saves it as a verify-only keyset.
+// Proofs from verify-only keysets can be redeemed but the mint never
+// signs outputs with them. It should be called before the mint server starts.
+func (m *Mint) ImportKeyset(keysetImport KeysetImport) (*crypto.MintKeyset, error) {
+	if keysetImport.MaxOrder == 0 {
+		keysetImport.MaxOrder = DefaultImportMaxOrder
+	}
+	if len(keysetImport.Unit) == 0 {
+		keysetImport.Unit = cashu.Sat.String()
+	}
+
+	master, err := hdkeychain.NewMaster(keysetImport.Seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed: %v", err)
+	}
+
+	dbKeyset := storage.DBKeyset{
+		Id:             keysetImport.Id,
+		Seed:           hex.EncodeToString(keysetImport.Seed),
+		InputFeePpk:    keysetImport.InputFeePpk,
+		DerivationPath: keysetImport.DerivationPath,
+		MaxOrder:       keysetImport.MaxOrder,
+		Unit:           keysetImport.Unit,
+		VerifyOnly:     true,
+	}
+	keyset, err := deriveImportedKeyset(master, dbKeyset)
+	if err != nil {
+		return nil, err
+	}
+	m.keysetsMu.Lock()
+	defer m.keysetsMu.Unlock()
+	if _, ok := m.keysets[keyset.Id]; ok {
+		return nil, fmt.Errorf("keyset '%v' already exists", keyset.Id)
+	}
+
+	dbKeyset.Id = keyset.Id
+	if err := m.db.SaveKeyset(dbKeyset); err != nil {
+		return nil, fmt.Errorf("error saving imported keyset: %v", err)
+	}
+	keysets := maps.Clone(m.keysets)
+	keysets[keyset.Id] = *keyset
+	m.keysets = keysets
+	m.logInfof("imported verify-only keyset '%v'", keyset.Id)
+
+	return keyset, nil
+}
+
+// deriveImportedKeyset derives the keyset from the path saved in db.
+// If the keyset has an id, it needs to match the derived keys.
+func deriveImportedKeyset(master *hdkeychain.ExtendedKey, dbKeyset storage.DBKeyset) (*crypto.MintKeyset, error) {
+	keyset, err := crypto.GenerateKeysetFromPath(
+		master,
+		dbKeyset.DerivationPath,
+		dbKeyset.MaxOrder,
+		dbKeyset.InputFeePpk,
+	)
+	if err != nil {
+		return nil, err
+	}
+	keyset.VerifyOnly = true
+	if len(dbKeyset.Unit) > 0 {
+		keyset.Unit = dbKeyset.Unit
+	}
+
+	if len(dbKeyset.Id) == 0 || dbKeyset.Id == keyset.Id {
+		return keyset, nil
+	}
+
+	pks := make(map[uint64]*secp256k1.PublicKey, len(keyset.Keys))
+	for amount, key := range keyset.Keys {
+		pks[amount] = key.PublicKey
+	}
+	if dbKeyset.Id == crypto.DeriveLegacyKeysetId(pks) {
+		keyset.Id = dbKeyset.Id
+		return keyset, nil
+	}
+
+	return nil, fmt.Errorf("derived keyset '%v' does not match keyset id '%v'", keyset.Id, dbKeyset.Id)
+}
@@ -0,0 +1,144 @@
+package mint
+
+import (
+	"cmp"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/storage"
+	"github.com/elnosh/gonuts/mint/storage/sqlite"
+)
+
+// KeysetInspection has the public keys of a keyset in the db derived
+// from its seed and the keyset ids (NUT-02) recomputed from them.
+type KeysetInspection struct {
+	Id                string
+	Unit              string
+	Active            bool
+	VerifyOnly        bool
+	InputFeePpk       uint
+	DerivationPathIdx uint32
+	// only set for imported keysets
+	DerivationPath string
+
+	// hex encoded public keys by amount
+	PublicKeys map[uint64]string
+	DerivedId  string
+	// legacy base64 id. Keysets imported from older mints can have it
+	DerivedLegacyId string
+}
+
+// Match reports whether the id stored in the db is the
+// versioned or legacy id derived from the public keys.
+func (k KeysetInspection) Match() bool {
+	return k.Id == k.DerivedId || k.Id == k.DerivedLegacyId
+}
+
+// Amounts returns the amounts of the keys sorted in ascending order
+func (k KeysetInspection) Amounts() []uint64 {
+	amounts := make([]uint64, 0, len(k.PublicKeys))
+	for amount := range k.PublicKeys {
+		amounts = append(amounts, amount)
+	}
+	slices.Sort(amounts)
+	return amounts
+}
+
+// InspectKeysets derives the keys of the keysets in the db and recomputes their ids
+// so they can be verified against the stored ids. If id is set, only that keyset is
+// inspected. It only reads the db so it can be used when the mint fails to load
+// because a stored keyset does not match its seed.
+func InspectKeysets(config Config, id string) ([]KeysetInspection, error) {
+	db := config.DB
+	if db == nil {
+		// do not create a new mint if there is not one at the path
+		if _, err := os.Stat(config.MintPath); err != nil {
+			return nil, fmt.Errorf("could not find mint at path '%v': %v", config.MintPath, err)
+		}
+		sqliteDB, err := sqlite.InitSQLite(config.MintPath)
+		if err != nil {
+			return nil, fmt.Errorf("error setting up sqlite: %v", err)
+		}
+		defer sqliteDB.Close()
+		db = sqliteDB
+	}
+
+	dbKeysets, err := db.GetKeysets()
+	if err != nil {
+		return nil, fmt.Errorf("error reading keysets from db: %v", err)
+	}
+	slices.SortFunc(dbKeysets, func(a, b storage.DBKeyset) int {
+		if a.Unit != b.Unit {
+			return cmp.Compare(a.Unit, b.Unit)
+		}
+		return cmp.Compare(a.DerivationPathIdx, b.DerivationPathIdx)
+	})
+
+	var inspections []KeysetInspection
+	for _, dbKeyset := range dbKeysets {
+		if len(id) > 0 && dbKeyset.Id != id {
+			continue
+		}
+		inspection, err := inspectKeyset(dbKeyset)
+		if err != nil {
+			return nil, fmt.Errorf("could not derive keyset '%v': %v", dbKeyset.Id, err)
+		}
+		inspections = append(inspections, *inspection)
+	}
+	if len(id) > 0 && len(inspections) == 0 {
+		return nil, fmt.Errorf("keyset '%v' not found in the db", id)
+	}
+	return inspections, nil
+}
+
+func inspectKeyset(dbKeyset storage.DBKeyset) (*KeysetInspection, error) {
+	seed, err := hex.DecodeString(dbKeyset.Seed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed: %v", err)
+	}
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed: %v", err)
+	}
+
+	// keys are derived the same way as when the mint loads the keyset
+	// but without checking the id so mismatches can be reported
+	var keyset *crypto.MintKeyset
+	if dbKeyset.VerifyOnly {
+		keyset, err = crypto.GenerateKeysetFromPath(master, dbKeyset.DerivationPath, dbKeyset.MaxOrder, dbKeyset.InputFeePpk)
+	} else {
+		unit, unitErr := cashu.UnitFromString(dbKeyset.Unit)
+		if unitErr != nil {
+			return nil, fmt.Errorf("invalid unit '%v'", dbKeyset.Unit)
+		}
+		keyset, err = crypto.GenerateUnitKeyset(master, unit, dbKeyset.DerivationPathIdx, dbKeyset.InputFeePpk)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pks := make(map[uint64]*secp256k1.PublicKey, len(keyset.Keys))
+	for amount, key := range keyset.Keys {
+		pks[amount] = key.PublicKey
+	}
+
+	return &KeysetInspection{
+		Id:                dbKeyset.Id,
+		Unit:              dbKeyset.Unit,
+		Active:            dbKeyset.Active,
+		VerifyOnly:        dbKeyset.VerifyOnly,
+		InputFeePpk:       dbKeyset.InputFeePpk,
+		DerivationPathIdx: dbKeyset.DerivationPathIdx,
+		DerivationPath:    dbKeyset.DerivationPath,
+		PublicKeys:        keyset.DerivePublic(),
+		DerivedId:         crypto.DeriveKeysetId(pks),
+		DerivedLegacyId:   crypto.DeriveLegacyKeysetId(pks),
+	}, nil
+}
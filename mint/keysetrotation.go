@@ -0,0 +1,102 @@
+package mint
+
+import (
+	"encoding/hex"
+	"fmt"
+	"maps"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// RotateKeyset derives the next keyset for the unit from the seed of the mint
+// with the input fee and makes it the active keyset of the unit in place of the
+// current one. The change is saved in the db and the keysets of the mint are
+// swapped without a restart. Mint and swap requests in flight finish with the
+// previous keyset before it is rotated.
+//
+// The derivation path idx in the config has to be set to the idx of the new
+// keyset before restarting the mint since it refuses to start with an idx
+// lower than the one of the last keyset.
+func (m *Mint) RotateKeyset(unit cashu.Unit, inputFeePpk uint) (*crypto.MintKeyset, error) {
+	if inputFeePpk > MaxInputFeePpk {
+		return nil, fmt.Errorf("input fee of %v ppk is above the max of %v ppk", inputFeePpk, MaxInputFeePpk)
+	}
+
+	// wait for requests that are signing outputs with the current keyset
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	var current *crypto.MintKeyset
+	for _, keyset := range m.getActiveKeysets() {
+		if keyset.Unit == unit.String() {
+			current = &keyset
+			break
+		}
+	}
+	if current == nil {
+		return nil, fmt.Errorf("no active keyset for unit '%v'", unit)
+	}
+
+	// the next idx is after the last keyset of the unit in the db,
+	// which could be ahead of the active one after a restart
+	dbKeysets, err := m.db.GetKeysets()
+	if err != nil {
+		return nil, fmt.Errorf("error reading keysets from db: %v", err)
+	}
+	nextIdx := current.DerivationPathIdx + 1
+	for _, dbKeyset := range dbKeysets {
+		if !dbKeyset.VerifyOnly && dbKeyset.Unit == unit.String() && dbKeyset.DerivationPathIdx >= nextIdx {
+			nextIdx = dbKeyset.DerivationPathIdx + 1
+		}
+	}
+
+	seed, err := m.db.GetSeed()
+	if err != nil {
+		return nil, fmt.Errorf("error getting seed from db: %v", err)
+	}
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+	keyset, err := crypto.GenerateUnitKeyset(master, unit, nextIdx, inputFeePpk)
+	if err != nil {
+		return nil, err
+	}
+
+	m.keysetsMu.Lock()
+	defer m.keysetsMu.Unlock()
+	if _, ok := m.keysets[keyset.Id]; ok {
+		return nil, fmt.Errorf("keyset '%v' already exists", keyset.Id)
+	}
+
+	dbKeyset := storage.DBKeyset{
+		Id:                keyset.Id,
+		Unit:              keyset.Unit,
+		Active:            true,
+		Seed:              hex.EncodeToString(seed),
+		DerivationPathIdx: keyset.DerivationPathIdx,
+		InputFeePpk:       keyset.InputFeePpk,
+	}
+	if err := m.db.RotateKeyset(dbKeyset, current.Id); err != nil {
+		return nil, fmt.Errorf("error saving rotated keyset: %v", err)
+	}
+
+	// the maps are replaced so that readers holding the previous ones are not affected
+	activeKeysets := maps.Clone(m.activeKeysets)
+	delete(activeKeysets, current.Id)
+	activeKeysets[keyset.Id] = *keyset
+	keysets := maps.Clone(m.keysets)
+	current.Active = false
+	keysets[current.Id] = *current
+	keysets[keyset.Id] = *keyset
+	m.activeKeysets = activeKeysets
+	m.keysets = keysets
+
+	m.logInfof("rotated active keyset for unit %v from '%v' to '%v' (derivation path idx %v) with fee %v",
+		unit, current.Id, keyset.Id, keyset.DerivationPathIdx, keyset.InputFeePpk)
+	return keyset, nil
+}
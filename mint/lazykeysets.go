@@ -0,0 +1,114 @@
+package mint
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// lazyKeysets derives the keys of inactive keysets the first time they are
+// needed instead of on startup. Mints that rotated many times would otherwise
+// derive the keys of every keyset they ever had before starting.
+type lazyKeysets struct {
+	mu sync.Mutex
+	// keysets from the db that have not been derived yet
+	dbKeysets map[string]storage.DBKeyset
+	derived   map[string]crypto.MintKeyset
+}
+
+func newLazyKeysets() *lazyKeysets {
+	return &lazyKeysets{
+		dbKeysets: make(map[string]storage.DBKeyset),
+		derived:   make(map[string]crypto.MintKeyset),
+	}
+}
+
+// add saves the keyset to be derived on first use
+func (lk *lazyKeysets) add(dbKeyset storage.DBKeyset) {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+	lk.dbKeysets[dbKeyset.Id] = dbKeyset
+}
+
+// get returns the keyset with its keys, deriving them if not derived yet
+func (lk *lazyKeysets) get(id string) (crypto.MintKeyset, bool, error) {
+	lk.mu.Lock()
+	defer lk.mu.Unlock()
+
+	if keyset, ok := lk.derived[id]; ok {
+		return keyset, true, nil
+	}
+	dbKeyset, ok := lk.dbKeysets[id]
+	if !ok {
+		return crypto.MintKeyset{}, false, nil
+	}
+	keyset, err := deriveDBKeyset(dbKeyset)
+	if err != nil {
+		return crypto.MintKeyset{}, false, err
+	}
+	lk.derived[id] = *keyset
+	delete(lk.dbKeysets, id)
+	return *keyset, true, nil
+}
+
+// deriveDBKeyset derives the keys of a keyset from the seed and path saved in
+// the db and checks that they match its id
+func deriveDBKeyset(dbKeyset storage.DBKeyset) (*crypto.MintKeyset, error) {
+	seed, err := hex.DecodeString(dbKeyset.Seed)
+	if err != nil {
+		return nil, err
+	}
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		return nil, err
+	}
+
+	if dbKeyset.VerifyOnly {
+		keyset, err := deriveImportedKeyset(master, dbKeyset)
+		if err != nil {
+			return nil, fmt.Errorf("error loading imported keyset '%v': %v", dbKeyset.Id, err)
+		}
+		return keyset, nil
+	}
+
+	unit, err := cashu.UnitFromString(dbKeyset.Unit)
+	if err != nil {
+		return nil, fmt.Errorf("keyset '%v' has invalid unit '%v'", dbKeyset.Id, dbKeyset.Unit)
+	}
+	keyset, err := crypto.GenerateUnitKeyset(master, unit, dbKeyset.DerivationPathIdx, dbKeyset.InputFeePpk)
+	if err != nil {
+		return nil, err
+	}
+	if keyset.Id != dbKeyset.Id {
+		return nil, fmt.Errorf("keyset '%v' in the db does not match keyset '%v' derived from its seed and derivation path idx %v",
+			dbKeyset.Id, keyset.Id, dbKeyset.DerivationPathIdx)
+	}
+	keyset.Active = dbKeyset.Active
+	return keyset, nil
+}
+
+// keysetWithKeys returns the keyset with its keys. Inactive keysets
+// are loaded without them and are derived here on first use.
+func (m *Mint) keysetWithKeys(id string) (crypto.MintKeyset, bool, error) {
+	keyset, ok := m.getKeysets()[id]
+	if !ok {
+		return crypto.MintKeyset{}, false, nil
+	}
+	if keyset.Keys != nil {
+		return keyset, true, nil
+	}
+
+	derived, ok, err := m.lazyKeysets.get(id)
+	if err != nil || !ok {
+		return crypto.MintKeyset{}, ok, err
+	}
+	// active state could have changed on startup after it was read from the db
+	derived.Active = keyset.Active
+	return derived, true, nil
+}
@@ -0,0 +1,483 @@
+package lightning
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+// timeout for requests to CLN other than payments,
+// which are bound by the context passed to them
+const clnRequestTimeout = 30 * time.Second
+
+// CLN statuses of invoices and payments
+const (
+	clnInvoicePaid   = "paid"
+	clnPaymentDone   = "complete"
+	clnPaymentFailed = "failed"
+)
+
+type ClnConfig struct {
+	// URL of the clnrest plugin of the node, i.e https://127.0.0.1:3010
+	RestURL string
+	// rune with permission for the getinfo, invoice, listinvoices,
+	// pay and listpays methods. Also offer and listoffers for BOLT12 mint quotes
+	// and fetchinvoice and decode for BOLT12 melt quotes
+	Rune string
+	// CA cert (PEM) of the clnrest plugin if it uses a self-signed
+	// cert. The system roots are used if not set
+	CACert []byte
+}
+
+// ClnCACertFromFile reads the CA cert of the clnrest plugin from a file
+func ClnCACertFromFile(path string) ([]byte, error) {
+	cert, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cert: %v", err)
+	}
+	return cert, nil
+}
+
+// ClnClient is a lightning backend for Core Lightning
+// that makes requests to its REST API (clnrest)
+type ClnClient struct {
+	restURL    string
+	rune       string
+	httpClient *http.Client
+}
+
+func SetupClnClient(config ClnConfig) (*ClnClient, error) {
+	if len(config.RestURL) == 0 {
+		return nil, errors.New("CLN REST URL cannot be empty")
+	}
+	if len(config.Rune) == 0 {
+		return nil, errors.New("CLN rune cannot be empty")
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if len(config.CACert) > 0 {
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(config.CACert) {
+			return nil, errors.New("invalid CLN CA cert: could not parse PEM")
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: certPool}
+	}
+
+	return &ClnClient{
+		restURL:    strings.TrimSuffix(config.RestURL, "/"),
+		rune:       config.Rune,
+		httpClient: &http.Client{Transport: transport},
+	}, nil
+}
+
+// clnError is the error returned by CLN for a failed method
+type clnError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *clnError) Error() string {
+	return fmt.Sprintf("CLN error %v: %v", e.Code, e.Message)
+}
+
+// call makes a request to the method of the CLN REST API
+// with the params and decodes the response into result.
+func (cln *ClnClient) call(ctx context.Context, method string, params any, result any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cln.restURL+"/v1/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Rune", cln.rune)
+
+	resp, err := cln.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var certErr *tls.CertificateVerificationError
+		if errors.As(err, &certErr) {
+			return fmt.Errorf("%w: invalid TLS cert: %v", ErrAuthentication, err)
+		}
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return fmt.Errorf("%w: %s", ErrAuthentication, respBody)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		var clnErr clnError
+		if err := json.Unmarshal(respBody, &clnErr); err == nil && len(clnErr.Message) > 0 {
+			// CLN rejects invalid runes with a failed method
+			if strings.Contains(strings.ToLower(clnErr.Message), "rune") {
+				return fmt.Errorf("%w: %v", ErrAuthentication, clnErr.Message)
+			}
+			return &clnErr
+		}
+		return fmt.Errorf("CLN request failed with status %v: %s", resp.StatusCode, respBody)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, result)
+}
+
+// callWithTimeout makes a request that is not a payment with a timeout
+func (cln *ClnClient) callWithTimeout(method string, params any, result any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), clnRequestTimeout)
+	defer cancel()
+	return cln.call(ctx, method, params, result)
+}
+
+// ConnectionStatus checks the connection to CLN. The error wraps
+// ErrAuthentication or ErrUnreachable to distinguish invalid
+// credentials from connectivity failures.
+func (cln *ClnClient) ConnectionStatus() error {
+	return cln.callWithTimeout("getinfo", struct{}{}, nil)
+}
+
+type clnInvoiceRequest struct {
+	AmountMsat  uint64 `json:"amount_msat"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+	// seconds
+	Expiry                uint64   `json:"expiry"`
+	ExposePrivateChannels bool     `json:"exposeprivatechannels"`
+	Fallbacks             []string `json:"fallbacks,omitempty"`
+}
+
+type clnInvoiceResponse struct {
+	Bolt11      string `json:"bolt11"`
+	PaymentHash string `json:"payment_hash"`
+	ExpiresAt   uint64 `json:"expires_at"`
+}
+
+func (cln *ClnClient) CreateInvoice(amount uint64, opts InvoiceOptions) (Invoice, error) {
+	// labels of invoices need to be unique in the node
+	var random [16]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return Invoice{}, err
+	}
+
+	request := clnInvoiceRequest{
+		AmountMsat:            amount * 1000,
+		Label:                 "gonuts-" + hex.EncodeToString(random[:]),
+		Description:           opts.Description,
+		Expiry:                uint64(opts.InvoiceExpiry().Seconds()),
+		ExposePrivateChannels: opts.PrivateRouteHints,
+	}
+	if len(opts.FallbackAddress) > 0 {
+		request.Fallbacks = []string{opts.FallbackAddress}
+	}
+
+	var response clnInvoiceResponse
+	if err := cln.callWithTimeout("invoice", request, &response); err != nil {
+		return Invoice{}, err
+	}
+
+	return Invoice{
+		PaymentRequest: response.Bolt11,
+		PaymentHash:    response.PaymentHash,
+		Amount:         amount,
+		Expiry:         response.ExpiresAt,
+	}, nil
+}
+
+type clnListInvoicesResponse struct {
+	Invoices []struct {
+		Bolt11             string `json:"bolt11"`
+		PaymentHash        string `json:"payment_hash"`
+		Status             string `json:"status"`
+		AmountMsat         uint64 `json:"amount_msat"`
+		AmountReceivedMsat uint64 `json:"amount_received_msat"`
+		PaymentPreimage    string `json:"payment_preimage"`
+		ExpiresAt          uint64 `json:"expires_at"`
+	} `json:"invoices"`
+}
+
+func (cln *ClnClient) InvoiceStatus(hash string) (Invoice, error) {
+	if _, err := hex.DecodeString(hash); err != nil {
+		return Invoice{}, errors.New("invalid hash provided")
+	}
+
+	var response clnListInvoicesResponse
+	if err := cln.callWithTimeout("listinvoices", map[string]string{"payment_hash": hash}, &response); err != nil {
+		return Invoice{}, err
+	}
+	if len(response.Invoices) == 0 {
+		return Invoice{}, errors.New("invoice not found")
+	}
+
+	clnInvoice := response.Invoices[0]
+	invoice := Invoice{
+		PaymentRequest: clnInvoice.Bolt11,
+		PaymentHash:    clnInvoice.PaymentHash,
+		Settled:        clnInvoice.Status == clnInvoicePaid,
+		Amount:         clnInvoice.AmountMsat / 1000,
+		Expiry:         clnInvoice.ExpiresAt,
+	}
+	if invoice.Settled {
+		invoice.Preimage = clnInvoice.PaymentPreimage
+		invoice.AmountPaid = clnInvoice.AmountReceivedMsat / 1000
+	}
+	return invoice, nil
+}
+
+type clnOfferRequest struct {
+	// msat or "any"
+	Amount      string `json:"amount"`
+	Description string `json:"description"`
+	Label       string `json:"label"`
+}
+
+type clnOfferResponse struct {
+	OfferId string `json:"offer_id"`
+	Bolt12  string `json:"bolt12"`
+}
+
+// CreateOffer creates a BOLT12 offer that can be paid multiple times.
+// The node needs to have offers enabled.
+func (cln *ClnClient) CreateOffer(amount uint64, description string) (Offer, error) {
+	// labels of offers need to be unique in the node
+	var random [16]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return Offer{}, err
+	}
+
+	request := clnOfferRequest{
+		Amount:      "any",
+		Description: description,
+		Label:       "gonuts-" + hex.EncodeToString(random[:]),
+	}
+	if amount > 0 {
+		request.Amount = fmt.Sprintf("%vmsat", amount*1000)
+	}
+
+	var response clnOfferResponse
+	if err := cln.callWithTimeout("offer", request, &response); err != nil {
+		return Offer{}, err
+	}
+
+	return Offer{
+		OfferId: response.OfferId,
+		Request: response.Bolt12,
+		Amount:  amount,
+	}, nil
+}
+
+// OfferStatus returns the offer with the sum of the invoices paid for it
+func (cln *ClnClient) OfferStatus(offerId string) (Offer, error) {
+	if _, err := hex.DecodeString(offerId); err != nil {
+		return Offer{}, errors.New("invalid offer id provided")
+	}
+
+	var offers struct {
+		Offers []clnOfferResponse `json:"offers"`
+	}
+	if err := cln.callWithTimeout("listoffers", map[string]string{"offer_id": offerId}, &offers); err != nil {
+		return Offer{}, err
+	}
+	if len(offers.Offers) == 0 {
+		return Offer{}, errors.New("offer not found")
+	}
+
+	var response clnListInvoicesResponse
+	if err := cln.callWithTimeout("listinvoices", map[string]string{"offer_id": offerId}, &response); err != nil {
+		return Offer{}, err
+	}
+	offer := Offer{OfferId: offerId, Request: offers.Offers[0].Bolt12}
+	for _, invoice := range response.Invoices {
+		if invoice.Status == clnInvoicePaid {
+			offer.AmountPaid += invoice.AmountReceivedMsat / 1000
+		}
+	}
+	return offer, nil
+}
+
+type clnFetchInvoiceRequest struct {
+	Offer      string `json:"offer"`
+	AmountMsat uint64 `json:"amount_msat,omitempty"`
+}
+
+type clnDecodeResponse struct {
+	Type               string `json:"type"`
+	Valid              bool   `json:"valid"`
+	InvoicePaymentHash string `json:"invoice_payment_hash"`
+	InvoiceAmountMsat  uint64 `json:"invoice_amount_msat"`
+}
+
+// FetchInvoice gets an invoice for the offer from the node that created
+// it through onion messages and decodes it for its payment hash and amount
+func (cln *ClnClient) FetchInvoice(offer string, amountMsat uint64) (Bolt12Invoice, error) {
+	var response struct {
+		Invoice string `json:"invoice"`
+	}
+	request := clnFetchInvoiceRequest{Offer: offer, AmountMsat: amountMsat}
+	if err := cln.callWithTimeout("fetchinvoice", request, &response); err != nil {
+		return Bolt12Invoice{}, err
+	}
+
+	var decoded clnDecodeResponse
+	if err := cln.callWithTimeout("decode", map[string]string{"string": response.Invoice}, &decoded); err != nil {
+		return Bolt12Invoice{}, err
+	}
+	if !decoded.Valid || decoded.Type != "bolt12 invoice" {
+		return Bolt12Invoice{}, errors.New("offer returned an invalid invoice")
+	}
+
+	return Bolt12Invoice{
+		Request:     response.Invoice,
+		PaymentHash: decoded.InvoicePaymentHash,
+		AmountMsat:  decoded.InvoiceAmountMsat,
+	}, nil
+}
+
+type clnPayRequest struct {
+	Bolt11 string `json:"bolt11"`
+	// msat
+	MaxFee uint64 `json:"maxfee"`
+	// amount to pay of an invoice that is paid in parts (MPP)
+	PartialMsat uint64 `json:"partial_msat,omitempty"`
+	// seconds to keep retrying the payment
+	RetryFor uint64 `json:"retry_for,omitempty"`
+}
+
+type clnPayment struct {
+	PaymentHash     string `json:"payment_hash"`
+	Status          string `json:"status"`
+	PaymentPreimage string `json:"payment_preimage"`
+	// for pay responses
+	Preimage       string `json:"preimage"`
+	AmountMsat     uint64 `json:"amount_msat"`
+	AmountSentMsat uint64 `json:"amount_sent_msat"`
+}
+
+func (payment clnPayment) paymentStatus() PaymentStatus {
+	switch payment.Status {
+	case clnPaymentDone:
+		preimage := payment.PaymentPreimage
+		if len(preimage) == 0 {
+			preimage = payment.Preimage
+		}
+		status := PaymentStatus{Preimage: preimage, PaymentStatus: Succeeded}
+		if payment.AmountSentMsat > payment.AmountMsat {
+			status.FeeMsat = payment.AmountSentMsat - payment.AmountMsat
+		}
+		return status
+	case clnPaymentFailed:
+		return PaymentStatus{PaymentStatus: Failed, PaymentFailureReason: "payment failed"}
+	default:
+		return PaymentStatus{PaymentStatus: Pending}
+	}
+}
+
+func (cln *ClnClient) SendPayment(
+	ctx context.Context,
+	request string,
+	amountMsat uint64,
+	maxFeeMsat uint64,
+) (PaymentStatus, error) {
+	// pay also takes invoices fetched from offers, which are paid in full
+	payRequest := clnPayRequest{Bolt11: request, MaxFee: maxFeeMsat}
+
+	if !IsBolt12Invoice(request) {
+		// if amount is less than amount in invoice, pay partially
+		invoice, err := decodepay.Decodepay(request)
+		if err != nil {
+			return PaymentStatus{PaymentStatus: Failed}, fmt.Errorf("error decoding invoice: %v", err)
+		}
+		if amountMsat < uint64(invoice.MSatoshi) {
+			payRequest.PartialMsat = amountMsat
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if retryFor := time.Until(deadline).Seconds(); retryFor >= 1 {
+			payRequest.RetryFor = uint64(retryFor)
+		}
+	}
+
+	var payment clnPayment
+	if err := cln.call(ctx, "pay", payRequest, &payment); err != nil {
+		// the payment can still complete in the node if the request timed
+		// out so mark it as pending. If any other error, mark as failed
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return PaymentStatus{PaymentStatus: Pending}, nil
+		}
+		var clnErr *clnError
+		if errors.As(err, &clnErr) {
+			return PaymentStatus{PaymentStatus: Failed, PaymentFailureReason: clnErr.Message}, err
+		}
+		// not known if the request reached the node
+		return PaymentStatus{PaymentStatus: Pending}, nil
+	}
+
+	status := payment.paymentStatus()
+	if status.PaymentStatus == Failed {
+		return status, errors.New("payment failed")
+	}
+	return status, nil
+}
+
+type clnListPaysResponse struct {
+	Pays []clnPayment `json:"pays"`
+}
+
+func (cln *ClnClient) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
+	if _, err := hex.DecodeString(hash); err != nil {
+		return PaymentStatus{}, errors.New("invalid hash provided")
+	}
+
+	var response clnListPaysResponse
+	if err := cln.call(ctx, "listpays", map[string]string{"payment_hash": hash}, &response); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return PaymentStatus{PaymentStatus: Pending}, nil
+		}
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+	if len(response.Pays) == 0 {
+		return PaymentStatus{PaymentStatus: Failed, PaymentFailureReason: "payment not found"}, nil
+	}
+
+	// a payment that failed can be retried so the
+	// status is from the attempts that did not fail
+	for _, payment := range response.Pays {
+		if payment.Status != clnPaymentFailed {
+			return payment.paymentStatus(), nil
+		}
+	}
+	return response.Pays[0].paymentStatus(), nil
+}
+
+func (cln *ClnClient) FeeReserve(amountMsat uint64) uint64 {
+	fee := math.Ceil(float64(amountMsat) * FeePercent)
+	return uint64(fee)
+}
+
+// SupportsMPP is true since partial payments are made with partial_msat in pay
+func (cln *ClnClient) SupportsMPP() bool {
+	return true
+}
@@ -0,0 +1,242 @@
+package lightning
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 2000 sat invoice
+const clnTestInvoice = "lnbcrt20u1pnn00ztpp5h6frn7fk93jurxpygwnkck2u7dc05c2he7l7amgna7ngteeynk2qdqqcqzzsxqyz5vqsp5s6fw9g7twqcv5h9pv74vutwj7v3f4xy8jgtwww05mt0lp0sl8zsq9qyyssqt9khadm8v7mzc7z7rkuah4xqncrsjfxueqjfv2enze7vvha478asgztpfdw9c6redv2zr4xru7t6k6epfsw50tguzc08g88up0ct08gpalvp8d"
+
+const clnTestHash = "be9239f9362c65c19824475b6c595cf370fa6157cfbfeeed13efa685e7249d94"
+
+// fakeClnRest serves the methods of the clnrest plugin with the handlers passed.
+// Requests without the rune are rejected.
+func fakeClnRest(t *testing.T, handlers map[string]func(params map[string]any) (int, any)) *ClnClient {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Rune") != "rune" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler, ok := handlers[strings.TrimPrefix(r.URL.Path, "/v1/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var params map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		status, response := handler(params)
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := SetupClnClient(ClnConfig{RestURL: server.URL, Rune: "rune"})
+	if err != nil {
+		t.Fatalf("error setting up CLN client: %v", err)
+	}
+	return client
+}
+
+func TestClnConnectionStatus(t *testing.T) {
+	handlers := map[string]func(map[string]any) (int, any){
+		"getinfo": func(map[string]any) (int, any) {
+			return http.StatusCreated, map[string]any{"id": "02abcd"}
+		},
+	}
+	cln := fakeClnRest(t, handlers)
+	if err := cln.ConnectionStatus(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cln.rune = "invalid"
+	if err := cln.ConnectionStatus(); !errors.Is(err, ErrAuthentication) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrAuthentication, err)
+	}
+
+	cln.restURL = "http://127.0.0.1:1"
+	if err := cln.ConnectionStatus(); !errors.Is(err, ErrUnreachable) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrUnreachable, err)
+	}
+}
+
+func TestClnInvoice(t *testing.T) {
+	var invoiceParams map[string]any
+	handlers := map[string]func(map[string]any) (int, any){
+		"invoice": func(params map[string]any) (int, any) {
+			invoiceParams = params
+			return http.StatusCreated, map[string]any{
+				"bolt11":       clnTestInvoice,
+				"payment_hash": clnTestHash,
+				"expires_at":   1700000000,
+			}
+		},
+		"listinvoices": func(params map[string]any) (int, any) {
+			return http.StatusCreated, map[string]any{"invoices": []map[string]any{{
+				"bolt11":               clnTestInvoice,
+				"payment_hash":         params["payment_hash"],
+				"status":               "paid",
+				"amount_msat":          2000000,
+				"amount_received_msat": 2000000,
+				"payment_preimage":     "0000",
+				"expires_at":           1700000000,
+			}}}
+		},
+	}
+	cln := fakeClnRest(t, handlers)
+
+	opts := InvoiceOptions{PrivateRouteHints: true, FallbackAddress: "bcrt1q", Description: "coffee"}
+	invoice, err := cln.CreateInvoice(2000, opts)
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	if invoice.PaymentHash != clnTestHash || invoice.Expiry != 1700000000 || invoice.Amount != 2000 {
+		t.Fatalf("unexpected invoice: %+v", invoice)
+	}
+	if invoiceParams["amount_msat"] != float64(2000000) {
+		t.Fatalf("expected amount_msat of 2000000 but got %v", invoiceParams["amount_msat"])
+	}
+	if invoiceParams["expiry"] != DefaultInvoiceExpiry.Seconds() {
+		t.Fatalf("expected expiry of %v but got %v", DefaultInvoiceExpiry.Seconds(), invoiceParams["expiry"])
+	}
+	if invoiceParams["exposeprivatechannels"] != true {
+		t.Fatalf("expected exposeprivatechannels to be set")
+	}
+	if invoiceParams["description"] != "coffee" {
+		t.Fatalf("expected description 'coffee' but got %v", invoiceParams["description"])
+	}
+
+	invoice, err = cln.InvoiceStatus(clnTestHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting invoice status: %v", err)
+	}
+	if !invoice.Settled || invoice.Preimage != "0000" || invoice.AmountPaid != 2000 {
+		t.Fatalf("unexpected invoice: %+v", invoice)
+	}
+}
+
+func TestClnOffer(t *testing.T) {
+	var offerParams map[string]any
+	handlers := map[string]func(map[string]any) (int, any){
+		"offer": func(params map[string]any) (int, any) {
+			offerParams = params
+			return http.StatusCreated, map[string]any{"offer_id": clnTestHash, "bolt12": "lno1qgsq"}
+		},
+		"listoffers": func(params map[string]any) (int, any) {
+			return http.StatusCreated, map[string]any{"offers": []map[string]any{{
+				"offer_id": params["offer_id"],
+				"bolt12":   "lno1qgsq",
+			}}}
+		},
+		"listinvoices": func(params map[string]any) (int, any) {
+			if params["offer_id"] != clnTestHash {
+				return http.StatusCreated, map[string]any{"invoices": []any{}}
+			}
+			return http.StatusCreated, map[string]any{"invoices": []map[string]any{
+				{"status": "paid", "amount_received_msat": 2000000},
+				{"status": "unpaid", "amount_msat": 1000000},
+				{"status": "paid", "amount_received_msat": 500000},
+			}}
+		},
+	}
+	cln := fakeClnRest(t, handlers)
+
+	offer, err := cln.CreateOffer(0, "gonuts")
+	if err != nil {
+		t.Fatalf("unexpected error creating offer: %v", err)
+	}
+	if offer.OfferId != clnTestHash || offer.Request != "lno1qgsq" {
+		t.Fatalf("unexpected offer: %+v", offer)
+	}
+	if offerParams["amount"] != "any" || offerParams["description"] != "gonuts" {
+		t.Fatalf("unexpected offer params: %v", offerParams)
+	}
+	if _, err := cln.CreateOffer(2000, "gonuts"); err != nil {
+		t.Fatalf("unexpected error creating offer: %v", err)
+	}
+	if offerParams["amount"] != "2000000msat" {
+		t.Fatalf("expected amount of 2000000msat but got %v", offerParams["amount"])
+	}
+
+	offer, err = cln.OfferStatus(clnTestHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting offer status: %v", err)
+	}
+	if offer.AmountPaid != 2500 {
+		t.Fatalf("expected amount paid of 2500 but got %v", offer.AmountPaid)
+	}
+	if _, err := cln.OfferStatus("not-hex"); err == nil {
+		t.Fatal("expected error for invalid offer id")
+	}
+}
+
+func TestClnSendPayment(t *testing.T) {
+	var payParams map[string]any
+	payResponse := func(map[string]any) (int, any) {
+		return http.StatusCreated, map[string]any{
+			"payment_hash":     clnTestHash,
+			"status":           "complete",
+			"payment_preimage": "0000",
+			"amount_msat":      2000000,
+			"amount_sent_msat": 2000500,
+		}
+	}
+	handlers := map[string]func(map[string]any) (int, any){
+		"pay": func(params map[string]any) (int, any) {
+			payParams = params
+			return payResponse(params)
+		},
+		"listpays": func(params map[string]any) (int, any) {
+			return http.StatusCreated, map[string]any{"pays": []map[string]any{
+				{"payment_hash": clnTestHash, "status": "failed"},
+				{"payment_hash": clnTestHash, "status": "pending"},
+			}}
+		},
+	}
+	cln := fakeClnRest(t, handlers)
+
+	status, err := cln.SendPayment(context.Background(), clnTestInvoice, 2000000, 20000)
+	if err != nil {
+		t.Fatalf("unexpected error sending payment: %v", err)
+	}
+	if status.PaymentStatus != Succeeded || status.Preimage != "0000" || status.FeeMsat != 500 {
+		t.Fatalf("unexpected payment status: %+v", status)
+	}
+	if _, ok := payParams["partial_msat"]; ok {
+		t.Fatalf("expected payment of full amount but got partial_msat %v", payParams["partial_msat"])
+	}
+
+	// pay part of the invoice
+	if _, err := cln.SendPayment(context.Background(), clnTestInvoice, 1000000, 20000); err != nil {
+		t.Fatalf("unexpected error sending payment: %v", err)
+	}
+	if payParams["partial_msat"] != float64(1000000) {
+		t.Fatalf("expected partial_msat of 1000000 but got %v", payParams["partial_msat"])
+	}
+
+	payResponse = func(map[string]any) (int, any) {
+		return http.StatusInternalServerError, map[string]any{"code": 210, "message": "Ran out of routes to try"}
+	}
+	status, err = cln.SendPayment(context.Background(), clnTestInvoice, 2000000, 20000)
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if status.PaymentStatus != Failed || status.PaymentFailureReason != "Ran out of routes to try" {
+		t.Fatalf("unexpected payment status: %+v", status)
+	}
+
+	status, err = cln.OutgoingPaymentStatus(context.Background(), clnTestHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting payment status: %v", err)
+	}
+	if status.PaymentStatus != Pending {
+		t.Fatalf("expected pending payment but got %v", status.PaymentStatus)
+	}
+}
@@ -0,0 +1,222 @@
+package lightning
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+var (
+	// ErrInvoiceNotFound is returned for invoices the ExternalBackend did not create
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	// ErrPaymentFinished is returned when completing or failing a
+	// payment of the ExternalBackend that already succeeded or failed
+	ErrPaymentFinished = errors.New("payment already finished")
+)
+
+// ExternalBackend is a lightning backend driven by the program running the
+// mint instead of a node. The program pays the invoices of mint quotes with
+// SettleInvoice and makes the payments of melt quotes, which stay pending
+// until it reports their result with CompletePayment or FailPayment. The mint
+// updates the quotes the next time their state is checked.
+//
+// It does not need LND or grpc so it can be used to embed the mint
+// (i.e built with the nolnd tag for wasm) or to run faucets and regtest
+// mints. The zero value is ready to use and none of its fields are required.
+type ExternalBackend struct {
+	// NewInvoice creates the invoices for mint quotes, i.e with a node
+	// the program controls. If not set, the invoices are signed with the
+	// key of the FakeBackend and can only be paid with SettleInvoice.
+	NewInvoice func(amount uint64, opts InvoiceOptions) (Invoice, error)
+	// OnPayment is called when the mint attempts a payment so that the
+	// program can make it. It can report the result before returning.
+	OnPayment func(payment ExternalPayment)
+	// fee reserve in msat for every payment. 0 if not set
+	FeeReserveMsat uint64
+
+	mu       sync.Mutex
+	invoices map[string]Invoice
+	payments map[string]ExternalPayment
+}
+
+// ExternalPayment is a payment the mint attempted with the ExternalBackend
+type ExternalPayment struct {
+	PaymentHash string
+	Request     string
+	// amount to pay, which is less than the amount of the
+	// invoice for partial payments, and max routing fee
+	AmountMsat uint64
+	MaxFeeMsat uint64
+	Status     PaymentStatus
+}
+
+func (eb *ExternalBackend) ConnectionStatus() error { return nil }
+
+func (eb *ExternalBackend) CreateInvoice(amount uint64, opts InvoiceOptions) (Invoice, error) {
+	var invoice Invoice
+	if eb.NewInvoice != nil {
+		var err error
+		invoice, err = eb.NewInvoice(amount, opts)
+		if err != nil {
+			return Invoice{}, err
+		}
+	} else {
+		req, preimage, paymentHash, err := createFakeInvoice(amount*1000, opts.Description)
+		if err != nil {
+			return Invoice{}, err
+		}
+		invoice = Invoice{
+			PaymentRequest: req,
+			PaymentHash:    paymentHash,
+			Preimage:       preimage,
+			Amount:         amount,
+			Expiry:         uint64(time.Now().Add(opts.InvoiceExpiry()).Unix()),
+		}
+	}
+
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if eb.invoices == nil {
+		eb.invoices = make(map[string]Invoice)
+	}
+	eb.invoices[invoice.PaymentHash] = invoice
+	return invoice, nil
+}
+
+func (eb *ExternalBackend) InvoiceStatus(hash string) (Invoice, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	invoice, ok := eb.invoices[hash]
+	if !ok {
+		return Invoice{}, ErrInvoiceNotFound
+	}
+	return invoice, nil
+}
+
+// SettleInvoice marks the invoice as paid. The preimage is
+// only needed if the invoice was created by NewInvoice without it.
+func (eb *ExternalBackend) SettleInvoice(hash, preimage string) error {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	invoice, ok := eb.invoices[hash]
+	if !ok {
+		return ErrInvoiceNotFound
+	}
+	if len(preimage) > 0 {
+		invoice.Preimage = preimage
+	}
+	invoice.Settled = true
+	invoice.AmountPaid = invoice.Amount
+	eb.invoices[hash] = invoice
+	return nil
+}
+
+// SendPayment saves the payment as pending and passes it to OnPayment.
+// Attempting a payment that is pending or succeeded returns its status.
+func (eb *ExternalBackend) SendPayment(
+	ctx context.Context,
+	request string,
+	amountMsat uint64,
+	maxFeeMsat uint64,
+) (PaymentStatus, error) {
+	invoice, err := decodepay.Decodepay(request)
+	if err != nil {
+		return PaymentStatus{PaymentStatus: Failed}, fmt.Errorf("error decoding invoice: %v", err)
+	}
+
+	eb.mu.Lock()
+	if payment, ok := eb.payments[invoice.PaymentHash]; ok && payment.Status.PaymentStatus != Failed {
+		eb.mu.Unlock()
+		return payment.Status, nil
+	}
+	if eb.payments == nil {
+		eb.payments = make(map[string]ExternalPayment)
+	}
+	payment := ExternalPayment{
+		PaymentHash: invoice.PaymentHash,
+		Request:     request,
+		AmountMsat:  amountMsat,
+		MaxFeeMsat:  maxFeeMsat,
+		Status:      PaymentStatus{PaymentStatus: Pending},
+	}
+	eb.payments[payment.PaymentHash] = payment
+	eb.mu.Unlock()
+
+	if eb.OnPayment != nil {
+		eb.OnPayment(payment)
+	}
+
+	status, err := eb.OutgoingPaymentStatus(ctx, payment.PaymentHash)
+	if err != nil {
+		return PaymentStatus{PaymentStatus: Failed}, err
+	}
+	if status.PaymentStatus == Failed {
+		return status, errors.New(status.PaymentFailureReason)
+	}
+	return status, nil
+}
+
+func (eb *ExternalBackend) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	payment, ok := eb.payments[hash]
+	if !ok {
+		return PaymentStatus{PaymentStatus: Failed}, ErrPaymentNotFound
+	}
+	return payment.Status, nil
+}
+
+// PendingPayments returns the payments that have not been completed or failed
+func (eb *ExternalBackend) PendingPayments() []ExternalPayment {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	var payments []ExternalPayment
+	for _, payment := range eb.payments {
+		if payment.Status.PaymentStatus == Pending {
+			payments = append(payments, payment)
+		}
+	}
+	return payments
+}
+
+// CompletePayment reports that the pending payment succeeded
+func (eb *ExternalBackend) CompletePayment(hash, preimage string, feeMsat uint64) error {
+	return eb.finishPayment(hash, PaymentStatus{PaymentStatus: Succeeded, Preimage: preimage, FeeMsat: feeMsat})
+}
+
+// FailPayment reports that the pending payment failed. The
+// proofs of the melt quote can be used again after it fails.
+func (eb *ExternalBackend) FailPayment(hash, reason string) error {
+	return eb.finishPayment(hash, PaymentStatus{PaymentStatus: Failed, PaymentFailureReason: reason})
+}
+
+func (eb *ExternalBackend) finishPayment(hash string, status PaymentStatus) error {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	payment, ok := eb.payments[hash]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+	if payment.Status.PaymentStatus != Pending {
+		return ErrPaymentFinished
+	}
+	if status.FeeMsat > payment.MaxFeeMsat {
+		return fmt.Errorf("fee of %v msat is more than the max fee of %v msat", status.FeeMsat, payment.MaxFeeMsat)
+	}
+	payment.Status = status
+	eb.payments[hash] = payment
+	return nil
+}
+
+func (eb *ExternalBackend) FeeReserve(amountMsat uint64) uint64 {
+	return eb.FeeReserveMsat
+}
+
+// SupportsMPP is true since the amount of each part is passed to OnPayment
+func (eb *ExternalBackend) SupportsMPP() bool {
+	return true
+}
@@ -0,0 +1,119 @@
+package lightning
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestExternalBackendInvoice(t *testing.T) {
+	backend := &ExternalBackend{}
+
+	invoice, err := backend.CreateInvoice(2000, InvoiceOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error creating invoice: %v", err)
+	}
+	invoice, err = backend.InvoiceStatus(invoice.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting invoice status: %v", err)
+	}
+	if invoice.Settled {
+		t.Fatal("expected invoice to not be settled before SettleInvoice")
+	}
+
+	if err := backend.SettleInvoice(invoice.PaymentHash, ""); err != nil {
+		t.Fatalf("unexpected error settling invoice: %v", err)
+	}
+	invoice, err = backend.InvoiceStatus(invoice.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting invoice status: %v", err)
+	}
+	if !invoice.Settled || invoice.AmountPaid != 2000 || len(invoice.Preimage) == 0 {
+		t.Fatalf("unexpected invoice: %+v", invoice)
+	}
+
+	if _, err := backend.InvoiceStatus("unknown"); !errors.Is(err, ErrInvoiceNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvoiceNotFound, err)
+	}
+	if err := backend.SettleInvoice("unknown", ""); !errors.Is(err, ErrInvoiceNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrInvoiceNotFound, err)
+	}
+}
+
+func TestExternalBackendPayment(t *testing.T) {
+	ctx := context.Background()
+	backend := &ExternalBackend{}
+
+	request, _, hash, err := CreateFakeInvoice(2000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.OutgoingPaymentStatus(ctx, hash); !errors.Is(err, ErrPaymentNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrPaymentNotFound, err)
+	}
+
+	status, err := backend.SendPayment(ctx, request, 2000000, 20000)
+	if err != nil {
+		t.Fatalf("unexpected error sending payment: %v", err)
+	}
+	if status.PaymentStatus != Pending {
+		t.Fatalf("expected pending payment but got %v", status.PaymentStatus)
+	}
+	pending := backend.PendingPayments()
+	if len(pending) != 1 || pending[0].PaymentHash != hash || pending[0].AmountMsat != 2000000 {
+		t.Fatalf("unexpected pending payments: %+v", pending)
+	}
+
+	if err := backend.CompletePayment(hash, "0000", 30000); err == nil {
+		t.Fatal("expected error completing payment with fee over the max fee")
+	}
+	if err := backend.CompletePayment(hash, "0000", 500); err != nil {
+		t.Fatalf("unexpected error completing payment: %v", err)
+	}
+	status, err = backend.OutgoingPaymentStatus(ctx, hash)
+	if err != nil {
+		t.Fatalf("unexpected error getting payment status: %v", err)
+	}
+	if status.PaymentStatus != Succeeded || status.Preimage != "0000" || status.FeeMsat != 500 {
+		t.Fatalf("unexpected payment status: %+v", status)
+	}
+	if len(backend.PendingPayments()) > 0 {
+		t.Fatal("expected no pending payments")
+	}
+	if err := backend.FailPayment(hash, "failed"); !errors.Is(err, ErrPaymentFinished) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrPaymentFinished, err)
+	}
+	// attempting the payment again returns the result
+	status, err = backend.SendPayment(ctx, request, 2000000, 20000)
+	if err != nil || status.PaymentStatus != Succeeded {
+		t.Fatalf("expected succeeded payment but got %v with error %v", status.PaymentStatus, err)
+	}
+}
+
+func TestExternalBackendOnPayment(t *testing.T) {
+	backend := &ExternalBackend{}
+	backend.OnPayment = func(payment ExternalPayment) {
+		if err := backend.FailPayment(payment.PaymentHash, "no route"); err != nil {
+			t.Errorf("unexpected error failing payment: %v", err)
+		}
+	}
+
+	request, _, _, err := CreateFakeInvoice(2000, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := backend.SendPayment(context.Background(), request, 2000000, 20000)
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if status.PaymentStatus != Failed || status.PaymentFailureReason != "no route" {
+		t.Fatalf("unexpected payment status: %+v", status)
+	}
+
+	// failed payments can be attempted again
+	backend.OnPayment = nil
+	status, err = backend.SendPayment(context.Background(), request, 2000000, 20000)
+	if err != nil || status.PaymentStatus != Pending {
+		t.Fatalf("expected pending payment but got %v with error %v", status.PaymentStatus, err)
+	}
+}
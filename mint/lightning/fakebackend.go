@@ -29,27 +29,61 @@ type FakeBackendInvoice struct {
 	Preimage       string
 	Status         State
 	Amount         uint64
+	AMP            bool
+	// amounts of the payments made to an AMP invoice
+	AMPPayments []uint64
+	// routing fee paid for an outgoing payment
+	FeeMsat uint64
 }
 
 func (i *FakeBackendInvoice) ToInvoice() Invoice {
-	return Invoice{
+	invoice := Invoice{
 		PaymentRequest: i.PaymentRequest,
 		PaymentHash:    i.PaymentHash,
 		Preimage:       i.Preimage,
 		Settled:        i.Status == Succeeded,
 		Amount:         i.Amount,
 	}
+	if invoice.Settled {
+		invoice.AmountPaid = i.Amount
+	}
+	if i.AMP {
+		invoice.AMP = true
+		invoice.Settled = false
+		invoice.Preimage = ""
+		invoice.AmountPaid = 0
+		for _, amount := range i.AMPPayments {
+			invoice.AmountPaid += amount
+		}
+	}
+	return invoice
+}
+
+// FakeBackendOffer is a BOLT12 offer with the amounts of the payments made to it
+type FakeBackendOffer struct {
+	Offer
+	Payments []uint64
 }
 
 type FakeBackend struct {
 	Invoices     []FakeBackendInvoice
+	Offers       []FakeBackendOffer
 	PaymentDelay int64
+	// routing fee in msat that outgoing payments would need.
+	// Payments fail if it is more than the max fee allowed
+	RoutingFeeMsat uint64
+	// fee reserve in msat for every payment. 0 if not set
+	FeeReserveMsat uint64
+	// invoices fetched from offers to pay them
+	FetchedInvoices []Bolt12Invoice
 }
 
 func (fb *FakeBackend) ConnectionStatus() error { return nil }
 
-func (fb *FakeBackend) CreateInvoice(amount uint64) (Invoice, error) {
-	req, preimage, paymentHash, err := CreateFakeInvoice(amount, false)
+// CreateInvoice creates an invoice that is paid right away.
+// Only the description of the options is used.
+func (fb *FakeBackend) CreateInvoice(amount uint64, opts InvoiceOptions) (Invoice, error) {
+	req, preimage, paymentHash, err := createFakeInvoice(amount*1000, opts.Description)
 	if err != nil {
 		return Invoice{}, err
 	}
@@ -66,6 +100,109 @@ func (fb *FakeBackend) CreateInvoice(amount uint64) (Invoice, error) {
 	return fakeInvoice.ToInvoice(), nil
 }
 
+// CreateAMPInvoice creates an AMP invoice that is not paid
+// until payments are added to it with PayAMPInvoice
+func (fb *FakeBackend) CreateAMPInvoice(amount uint64, opts InvoiceOptions) (Invoice, error) {
+	req, _, paymentHash, err := createFakeInvoice(amount*1000, opts.Description)
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	fakeInvoice := FakeBackendInvoice{
+		PaymentRequest: req,
+		PaymentHash:    paymentHash,
+		Status:         Pending,
+		Amount:         amount,
+		AMP:            true,
+	}
+	fb.Invoices = append(fb.Invoices, fakeInvoice)
+
+	return fakeInvoice.ToInvoice(), nil
+}
+
+// PayAMPInvoice settles a payment of the amount to the AMP invoice
+func (fb *FakeBackend) PayAMPInvoice(hash string, amount uint64) {
+	invoiceIdx := slices.IndexFunc(fb.Invoices, func(i FakeBackendInvoice) bool {
+		return i.PaymentHash == hash && i.AMP
+	})
+	if invoiceIdx == -1 {
+		return
+	}
+	fb.Invoices[invoiceIdx].AMPPayments = append(fb.Invoices[invoiceIdx].AMPPayments, amount)
+}
+
+// CreateOffer creates an offer that is not paid until
+// payments are added to it with PayOffer
+func (fb *FakeBackend) CreateOffer(amount uint64, description string) (Offer, error) {
+	var random [32]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return Offer{}, err
+	}
+	offerId := sha256.Sum256(random[:])
+
+	offer := Offer{
+		OfferId: hex.EncodeToString(offerId[:]),
+		Request: "lno1" + hex.EncodeToString(random[:]),
+		Amount:  amount,
+	}
+	fb.Offers = append(fb.Offers, FakeBackendOffer{Offer: offer})
+	return offer, nil
+}
+
+// PayOffer settles a payment of the amount to the offer
+func (fb *FakeBackend) PayOffer(offerId string, amount uint64) {
+	offerIdx := slices.IndexFunc(fb.Offers, func(o FakeBackendOffer) bool {
+		return o.OfferId == offerId
+	})
+	if offerIdx == -1 {
+		return
+	}
+	fb.Offers[offerIdx].Payments = append(fb.Offers[offerIdx].Payments, amount)
+}
+
+func (fb *FakeBackend) OfferStatus(offerId string) (Offer, error) {
+	offerIdx := slices.IndexFunc(fb.Offers, func(o FakeBackendOffer) bool {
+		return o.OfferId == offerId
+	})
+	if offerIdx == -1 {
+		return Offer{}, errors.New("offer does not exist")
+	}
+
+	offer := fb.Offers[offerIdx].Offer
+	for _, amount := range fb.Offers[offerIdx].Payments {
+		offer.AmountPaid += amount
+	}
+	return offer, nil
+}
+
+// FetchInvoice returns an invoice for the offer. Offers not created by
+// the FakeBackend are taken to be for any amount so it needs to be set.
+func (fb *FakeBackend) FetchInvoice(offer string, amountMsat uint64) (Bolt12Invoice, error) {
+	if amountMsat == 0 {
+		offerIdx := slices.IndexFunc(fb.Offers, func(o FakeBackendOffer) bool {
+			return o.Request == offer
+		})
+		if offerIdx == -1 || fb.Offers[offerIdx].Amount == 0 {
+			return Bolt12Invoice{}, errors.New("amount is required for offer")
+		}
+		amountMsat = fb.Offers[offerIdx].Amount * 1000
+	}
+
+	var random [32]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return Bolt12Invoice{}, err
+	}
+	paymentHash := sha256.Sum256(random[:])
+
+	invoice := Bolt12Invoice{
+		Request:     "lni1" + hex.EncodeToString(random[:]),
+		PaymentHash: hex.EncodeToString(paymentHash[:]),
+		AmountMsat:  amountMsat,
+	}
+	fb.FetchedInvoices = append(fb.FetchedInvoices, invoice)
+	return invoice, nil
+}
+
 func (fb *FakeBackend) InvoiceStatus(hash string) (Invoice, error) {
 	invoiceIdx := slices.IndexFunc(fb.Invoices, func(i FakeBackendInvoice) bool {
 		return i.PaymentHash == hash
@@ -77,14 +214,23 @@ func (fb *FakeBackend) InvoiceStatus(hash string) (Invoice, error) {
 	return fb.Invoices[invoiceIdx].ToInvoice(), nil
 }
 
-func (fb *FakeBackend) SendPayment(ctx context.Context, request string, amount uint64) (PaymentStatus, error) {
+func (fb *FakeBackend) SendPayment(
+	ctx context.Context,
+	request string,
+	amountMsat uint64,
+	maxFeeMsat uint64,
+) (PaymentStatus, error) {
+	if IsBolt12Invoice(request) {
+		return fb.payBolt12Invoice(request, amountMsat, maxFeeMsat)
+	}
+
 	invoice, err := decodepay.Decodepay(request)
 	if err != nil {
 		return PaymentStatus{}, fmt.Errorf("error decoding invoice: %v", err)
 	}
 
 	status := Succeeded
-	if invoice.Description == FailPaymentDescription {
+	if invoice.Description == FailPaymentDescription || fb.RoutingFeeMsat > maxFeeMsat {
 		status = Failed
 	} else if fb.PaymentDelay > 0 {
 		if time.Now().Unix() < int64(invoice.CreatedAt)+fb.PaymentDelay {
@@ -96,14 +242,37 @@ func (fb *FakeBackend) SendPayment(ctx context.Context, request string, amount u
 		PaymentHash: invoice.PaymentHash,
 		Preimage:    FakePreimage,
 		Status:      status,
-		Amount:      uint64(invoice.MSatoshi) * 1000,
+		Amount:      amountMsat / 1000,
+		FeeMsat:     fb.RoutingFeeMsat,
+	}
+	fb.Invoices = append(fb.Invoices, outgoingPayment)
+
+	return outgoingPayment.paymentStatus(), nil
+}
+
+// payBolt12Invoice pays an invoice that was fetched with FetchInvoice
+func (fb *FakeBackend) payBolt12Invoice(request string, amountMsat, maxFeeMsat uint64) (PaymentStatus, error) {
+	invoiceIdx := slices.IndexFunc(fb.FetchedInvoices, func(i Bolt12Invoice) bool {
+		return i.Request == request
+	})
+	if invoiceIdx == -1 {
+		return PaymentStatus{}, errors.New("invoice was not fetched from an offer")
+	}
+
+	status := Succeeded
+	if fb.RoutingFeeMsat > maxFeeMsat {
+		status = Failed
+	}
+	outgoingPayment := FakeBackendInvoice{
+		PaymentHash: fb.FetchedInvoices[invoiceIdx].PaymentHash,
+		Preimage:    FakePreimage,
+		Status:      status,
+		Amount:      amountMsat / 1000,
+		FeeMsat:     fb.RoutingFeeMsat,
 	}
 	fb.Invoices = append(fb.Invoices, outgoingPayment)
 
-	return PaymentStatus{
-		Preimage:      FakePreimage,
-		PaymentStatus: status,
-	}, nil
+	return outgoingPayment.paymentStatus(), nil
 }
 
 func (fb *FakeBackend) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
@@ -114,14 +283,24 @@ func (fb *FakeBackend) OutgoingPaymentStatus(ctx context.Context, hash string) (
 		return PaymentStatus{}, errors.New("payment does not exist")
 	}
 
-	return PaymentStatus{
-		Preimage:      FakePreimage,
-		PaymentStatus: fb.Invoices[invoiceIdx].Status,
-	}, nil
+	return fb.Invoices[invoiceIdx].paymentStatus(), nil
 }
 
-func (fb *FakeBackend) FeeReserve(amount uint64) uint64 {
-	return 0
+func (i *FakeBackendInvoice) paymentStatus() PaymentStatus {
+	status := PaymentStatus{Preimage: FakePreimage, PaymentStatus: i.Status}
+	if i.Status == Succeeded {
+		status.FeeMsat = i.FeeMsat
+	}
+	return status
+}
+
+func (fb *FakeBackend) FeeReserve(amountMsat uint64) uint64 {
+	return fb.FeeReserveMsat
+}
+
+// SupportsMPP is true since partial payments succeed like any other payment
+func (fb *FakeBackend) SupportsMPP() bool {
+	return true
 }
 
 func (fb *FakeBackend) SetInvoiceStatus(hash string, status State) {
@@ -135,6 +314,21 @@ func (fb *FakeBackend) SetInvoiceStatus(hash string, status State) {
 }
 
 func CreateFakeInvoice(amount uint64, failPayment bool) (string, string, string, error) {
+	return CreateFakeInvoiceMsat(amount*1000, failPayment)
+}
+
+// CreateFakeInvoiceMsat creates an invoice for an amount in msat
+// that does not need to be a whole number of sats
+func CreateFakeInvoiceMsat(amountMsat uint64, failPayment bool) (string, string, string, error) {
+	description := ""
+	if failPayment {
+		description = FailPaymentDescription
+	}
+	return createFakeInvoice(amountMsat, description)
+}
+
+// createFakeInvoice creates an invoice with the description (or "test" if empty)
+func createFakeInvoice(amountMsat uint64, description string) (string, string, string, error) {
 	var random [32]byte
 	_, err := rand.Read(random[:])
 	if err != nil {
@@ -144,16 +338,15 @@ func CreateFakeInvoice(amount uint64, failPayment bool) (string, string, string,
 	paymentHash := sha256.Sum256(random[:])
 	hash := hex.EncodeToString(paymentHash[:])
 
-	description := "test"
-	if failPayment {
-		description = FailPaymentDescription
+	if len(description) == 0 {
+		description = "test"
 	}
 
 	invoice, err := zpay32.NewInvoice(
 		&chaincfg.SigNetParams,
 		paymentHash,
 		time.Now(),
-		zpay32.Amount(lnwire.MilliSatoshi(amount*1000)),
+		zpay32.Amount(lnwire.MilliSatoshi(amountMsat)),
 		zpay32.Description(description),
 	)
 	if err != nil {
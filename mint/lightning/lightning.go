@@ -1,24 +1,134 @@
 package lightning
 
-import "context"
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrAuthentication is returned when the backend rejects the credentials
+	ErrAuthentication = errors.New("lightning backend rejected credentials")
+	// ErrUnreachable is returned when the backend cannot be reached
+	ErrUnreachable = errors.New("lightning backend unreachable")
+	// ErrPaymentNotFound is returned by OutgoingPaymentStatus when the
+	// backend has no payment for the hash, i.e it was never attempted
+	ErrPaymentNotFound = errors.New("payment not found")
+)
+
+const (
+	InvoiceExpiryMins         = 10
+	FeePercent        float64 = 0.01
+)
 
 // Client interface to interact with a Lightning backend
 type Client interface {
 	ConnectionStatus() error
-	CreateInvoice(amount uint64) (Invoice, error)
+	CreateInvoice(amount uint64, opts InvoiceOptions) (Invoice, error)
 	InvoiceStatus(hash string) (Invoice, error)
-	SendPayment(ctx context.Context, request string, amount uint64) (PaymentStatus, error)
+	// SendPayment pays the invoice. The amount is in msat and
+	// is less than the invoice amount for partial payments.
+	// The payment must fail if it can't be made paying at most
+	// maxFeeMsat in routing fees.
+	SendPayment(ctx context.Context, request string, amountMsat, maxFeeMsat uint64) (PaymentStatus, error)
 	OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error)
-	FeeReserve(amount uint64) uint64
+	// FeeReserve returns the max fee in msat for paying the amount in msat
+	FeeReserve(amountMsat uint64) uint64
+}
+
+// AMPClient is implemented by backends that can create AMP invoices.
+// AMP invoices can be paid multiple times or in parts
+type AMPClient interface {
+	CreateAMPInvoice(amount uint64, opts InvoiceOptions) (Invoice, error)
+}
+
+// MPPClient is implemented by backends that can pay part of an invoice for
+// multi-path payments (NUT-15). For each part, SendPayment is called with an
+// amount lower than the amount of the invoice and the backend has to pay only
+// that amount, with the total of the invoice in the MPP record, so that the
+// payee settles the invoice once all the parts arrive. Mints with MPP
+// enabled do not start with backends that do not support it.
+type MPPClient interface {
+	SupportsMPP() bool
+}
+
+// BOLT12Client is implemented by backends that can create BOLT12 offers.
+// Offers can be paid multiple times so they do not settle like invoices.
+// What was paid to them is the sum of the payments in OfferStatus.
+type BOLT12Client interface {
+	// CreateOffer creates an offer for the amount in sats
+	// or for any amount if it is 0
+	CreateOffer(amount uint64, description string) (Offer, error)
+	OfferStatus(offerId string) (Offer, error)
+	// FetchInvoice requests an invoice from the node of the offer to pay it.
+	// The amount in msat is only needed for offers for any amount.
+	FetchInvoice(offer string, amountMsat uint64) (Bolt12Invoice, error)
+}
+
+type Offer struct {
+	OfferId string
+	// the encoded offer (lno1...)
+	Request string
+	// 0 for offers for any amount
+	Amount uint64
+	// sum of the payments made to the offer in sats
+	AmountPaid uint64
+}
+
+// Bolt12Invoice is an invoice fetched from an offer that
+// can be paid with SendPayment like BOLT11 invoices
+type Bolt12Invoice struct {
+	// the encoded invoice (lni1...)
+	Request     string
+	PaymentHash string
+	AmountMsat  uint64
+}
+
+// IsBolt12Invoice returns whether the request is
+// an invoice fetched from an offer (lni1...)
+func IsBolt12Invoice(request string) bool {
+	return strings.HasPrefix(strings.ToLower(request), "lni1")
+}
+
+// DefaultInvoiceExpiry is the expiry of invoices if not set in the InvoiceOptions
+const DefaultInvoiceExpiry = InvoiceExpiryMins * time.Minute
+
+// InvoiceOptions are the parameters of the invoices created for mint quotes.
+// The zero value uses the defaults.
+type InvoiceOptions struct {
+	// time until the invoice expires. DefaultInvoiceExpiry if not set
+	Expiry time.Duration
+	// include route hints for the private channels of the node
+	// so that the invoice can be paid through them
+	PrivateRouteHints bool
+	// on-chain fallback address included in the invoice. Omitted if empty
+	FallbackAddress string
+	// memo of the invoice, i.e from the description of a mint quote request
+	Description string
+}
+
+// InvoiceExpiry returns the expiry of the invoices, with the default if not set
+func (opts InvoiceOptions) InvoiceExpiry() time.Duration {
+	if opts.Expiry <= 0 {
+		return DefaultInvoiceExpiry
+	}
+	return opts.Expiry
 }
 
 type Invoice struct {
 	PaymentRequest string
 	PaymentHash    string
-	Preimage       string
-	Settled        bool
-	Amount         uint64
-	Expiry         uint64
+	// not set for AMP invoices since each payment has its own preimage
+	Preimage string
+	// AMP invoices are never settled as a whole. Whether they were
+	// paid has to be checked from the AmountPaid
+	Settled bool
+	Amount  uint64
+	Expiry  uint64
+	AMP     bool
+	// sum of the HTLC sets settled for the invoice
+	AmountPaid uint64
 }
 
 type State int
@@ -33,4 +143,6 @@ type PaymentStatus struct {
 	Preimage             string
 	PaymentStatus        State
 	PaymentFailureReason string
+	// routing fees paid if the payment succeeded
+	FeeMsat uint64
 }
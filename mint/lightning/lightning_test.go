@@ -0,0 +1,23 @@
+package lightning
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInvoiceExpiry(t *testing.T) {
+	tests := []struct {
+		opts     InvoiceOptions
+		expected time.Duration
+	}{
+		{opts: InvoiceOptions{}, expected: DefaultInvoiceExpiry},
+		{opts: InvoiceOptions{Expiry: -time.Second}, expected: DefaultInvoiceExpiry},
+		{opts: InvoiceOptions{Expiry: time.Hour, PrivateRouteHints: true}, expected: time.Hour},
+	}
+
+	for _, test := range tests {
+		if expiry := test.opts.InvoiceExpiry(); expiry != test.expected {
+			t.Fatalf("expected expiry of %v but got %v", test.expected, expiry)
+		}
+	}
+}
@@ -1,3 +1,5 @@
+//go:build !nolnd
+
 package lightning
 
 import (
@@ -7,18 +9,16 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/routerrpc"
 	"github.com/lightningnetwork/lnd/macaroons"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
-)
-
-const (
-	InvoiceExpiryMins         = 10
-	FeePercent        float64 = 0.01
+	"google.golang.org/grpc/status"
 )
 
 type LndConfig struct {
@@ -27,12 +27,31 @@ type LndConfig struct {
 	Macaroon macaroons.MacaroonCredential
 }
 
+// ReloadGracePeriod is how long the previous connection is kept open
+// after a reload so that in-flight payments on it can finish.
+const ReloadGracePeriod = 10 * time.Minute
+
 type LndClient struct {
+	mu           sync.RWMutex
+	conn         *grpc.ClientConn
 	grpcClient   lnrpc.LightningClient
 	routerClient routerrpc.RouterClient
 }
 
 func SetupLndClient(config LndConfig) (*LndClient, error) {
+	conn, err := dialLnd(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LndClient{
+		conn:         conn,
+		grpcClient:   lnrpc.NewLightningClient(conn),
+		routerClient: routerrpc.NewRouterClient(conn),
+	}, nil
+}
+
+func dialLnd(config LndConfig) (*grpc.ClientConn, error) {
 	opts := []grpc.DialOption{
 		grpc.WithTransportCredentials(config.Cert),
 		grpc.WithPerRPCCredentials(config.Macaroon),
@@ -42,29 +61,106 @@ func SetupLndClient(config LndConfig) (*LndClient, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error setting up grpc client: %v", err)
 	}
+	return conn, nil
+}
+
+// Reload replaces the connection to LND with one using the new config.
+// i.e when the macaroon or cert are rotated. The new connection is checked
+// first so the client keeps using the previous one if it does not work.
+func (lnd *LndClient) Reload(config LndConfig) error {
+	conn, err := dialLnd(config)
+	if err != nil {
+		return err
+	}
 
 	grpcClient := lnrpc.NewLightningClient(conn)
-	routerClient := routerrpc.NewRouterClient(conn)
-	return &LndClient{grpcClient: grpcClient, routerClient: routerClient}, nil
+	if err := checkConnection(grpcClient); err != nil {
+		conn.Close()
+		return err
+	}
+
+	lnd.mu.Lock()
+	prevConn := lnd.conn
+	lnd.conn = conn
+	lnd.grpcClient = grpcClient
+	lnd.routerClient = routerrpc.NewRouterClient(conn)
+	lnd.mu.Unlock()
+
+	if prevConn != nil {
+		time.AfterFunc(ReloadGracePeriod, func() { prevConn.Close() })
+	}
+	return nil
+}
+
+func (lnd *LndClient) clients() (lnrpc.LightningClient, routerrpc.RouterClient) {
+	lnd.mu.RLock()
+	defer lnd.mu.RUnlock()
+	return lnd.grpcClient, lnd.routerClient
 }
 
+// ConnectionStatus checks the connection to LND. The error wraps
+// ErrAuthentication or ErrUnreachable to distinguish invalid
+// credentials from connectivity failures.
 func (lnd *LndClient) ConnectionStatus() error {
-	// call to check connection is good
+	grpcClient, _ := lnd.clients()
+	return checkConnection(grpcClient)
+}
+
+func checkConnection(grpcClient lnrpc.LightningClient) error {
 	request := lnrpc.WalletBalanceRequest{}
-	_, err := lnd.grpcClient.WalletBalance(context.Background(), &request)
+	_, err := grpcClient.WalletBalance(context.Background(), &request)
 	if err != nil {
-		return err
+		return connectionError(err)
 	}
 	return nil
 }
 
-func (lnd *LndClient) CreateInvoice(amount uint64) (Invoice, error) {
+func connectionError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	msg := st.Message()
+	switch st.Code() {
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return fmt.Errorf("%w: %v", ErrAuthentication, msg)
+	case codes.Unavailable, codes.DeadlineExceeded:
+		// failed TLS handshakes are reported as unavailable
+		if strings.Contains(msg, "x509") || strings.Contains(msg, "handshake") {
+			return fmt.Errorf("%w: invalid TLS cert: %v", ErrAuthentication, msg)
+		}
+		return fmt.Errorf("%w: %v", ErrUnreachable, msg)
+	}
+
+	// LND reports invalid macaroons with an unknown code
+	if strings.Contains(msg, "macaroon") || strings.Contains(msg, "verification failed") {
+		return fmt.Errorf("%w: %v", ErrAuthentication, msg)
+	}
+	return err
+}
+
+func (lnd *LndClient) CreateInvoice(amount uint64, opts InvoiceOptions) (Invoice, error) {
+	return lnd.createInvoice(amount, opts, false)
+}
+
+func (lnd *LndClient) CreateAMPInvoice(amount uint64, opts InvoiceOptions) (Invoice, error) {
+	return lnd.createInvoice(amount, opts, true)
+}
+
+func (lnd *LndClient) createInvoice(amount uint64, opts InvoiceOptions, amp bool) (Invoice, error) {
+	grpcClient, _ := lnd.clients()
+	expiry := opts.InvoiceExpiry()
 	invoiceRequest := lnrpc.Invoice{
-		Value:  int64(amount),
-		Expiry: InvoiceExpiryMins * 60,
+		Value:        int64(amount),
+		Expiry:       int64(expiry.Seconds()),
+		Private:      opts.PrivateRouteHints,
+		FallbackAddr: opts.FallbackAddress,
+		IsAmp:        amp,
+		Memo:         opts.Description,
 	}
 
-	addInvoiceResponse, err := lnd.grpcClient.AddInvoice(context.Background(), &invoiceRequest)
+	addInvoiceResponse, err := grpcClient.AddInvoice(context.Background(), &invoiceRequest)
 	if err != nil {
 		return Invoice{}, err
 	}
@@ -74,19 +170,21 @@ func (lnd *LndClient) CreateInvoice(amount uint64) (Invoice, error) {
 		PaymentRequest: addInvoiceResponse.PaymentRequest,
 		PaymentHash:    hash,
 		Amount:         amount,
-		Expiry:         uint64(time.Now().Add(time.Minute * InvoiceExpiryMins).Unix()),
+		Expiry:         uint64(time.Now().Add(expiry).Unix()),
+		AMP:            amp,
 	}
 	return invoice, nil
 }
 
 func (lnd *LndClient) InvoiceStatus(hash string) (Invoice, error) {
+	grpcClient, _ := lnd.clients()
 	hashBytes, err := hex.DecodeString(hash)
 	if err != nil {
 		return Invoice{}, errors.New("invalid hash provided")
 	}
 
 	paymentHashRequest := lnrpc.PaymentHash{RHash: hashBytes}
-	lookupInvoiceResponse, err := lnd.grpcClient.LookupInvoice(context.Background(), &paymentHashRequest)
+	lookupInvoiceResponse, err := grpcClient.LookupInvoice(context.Background(), &paymentHashRequest)
 	if err != nil {
 		return Invoice{}, err
 	}
@@ -98,31 +196,52 @@ func (lnd *LndClient) InvoiceStatus(hash string) (Invoice, error) {
 		Preimage:       hex.EncodeToString(lookupInvoiceResponse.RPreimage),
 		Settled:        invoiceSettled,
 		Amount:         uint64(lookupInvoiceResponse.Value),
+		AmountPaid:     uint64(lookupInvoiceResponse.AmtPaidSat),
+	}
+
+	// AMP invoices stay open after each payment so
+	// add up the HTLCs of the sets that were settled
+	if lookupInvoiceResponse.IsAmp {
+		var amountPaidMsat uint64
+		for _, htlc := range lookupInvoiceResponse.Htlcs {
+			if htlc.State == lnrpc.InvoiceHTLCState_SETTLED {
+				amountPaidMsat += htlc.AmtMsat
+			}
+		}
+		invoice.AMP = true
+		invoice.Settled = false
+		invoice.Preimage = ""
+		invoice.AmountPaid = amountPaidMsat / 1000
 	}
 
 	return invoice, nil
 }
 
-func (lnd *LndClient) SendPayment(ctx context.Context, request string, amount uint64) (PaymentStatus, error) {
-	feeReserve := lnd.FeeReserve(amount)
-	feeLimit := lnrpc.FeeLimit{Limit: &lnrpc.FeeLimit_Fixed{Fixed: int64(feeReserve)}}
+func (lnd *LndClient) SendPayment(
+	ctx context.Context,
+	request string,
+	amountMsat uint64,
+	maxFeeMsat uint64,
+) (PaymentStatus, error) {
+	grpcClient, _ := lnd.clients()
+	feeLimit := lnrpc.FeeLimit{Limit: &lnrpc.FeeLimit_FixedMsat{FixedMsat: int64(maxFeeMsat)}}
 
 	// if amount is less than amount in invoice, pay partially if supported by backend.
 	// not checking err because invoice has already been validated by the mint
 	req := lnrpc.PayReqString{PayReq: request}
-	payReq, err := lnd.grpcClient.DecodePayReq(ctx, &req)
+	payReq, err := grpcClient.DecodePayReq(ctx, &req)
 	if err != nil {
 		return PaymentStatus{PaymentStatus: Failed}, err
 	}
-	if amount < uint64(payReq.NumMsat) {
-		return lnd.payPartialInvoice(ctx, payReq, amount, &feeLimit)
+	if amountMsat < uint64(payReq.NumMsat) {
+		return lnd.payPartialInvoice(ctx, payReq, amountMsat, &feeLimit)
 	}
 
 	sendPaymentRequest := lnrpc.SendRequest{
 		PaymentRequest: request,
 		FeeLimit:       &feeLimit,
 	}
-	sendPaymentResponse, err := lnd.grpcClient.SendPaymentSync(ctx, &sendPaymentRequest)
+	sendPaymentResponse, err := grpcClient.SendPaymentSync(ctx, &sendPaymentRequest)
 	if err != nil {
 		// if context deadline is exceeded (1 min), mark payment as pending
 		// if any other error, mark as failed
@@ -139,22 +258,26 @@ func (lnd *LndClient) SendPayment(ctx context.Context, request string, amount ui
 
 	preimage := hex.EncodeToString(sendPaymentResponse.PaymentPreimage)
 	paymentResponse := PaymentStatus{Preimage: preimage, PaymentStatus: Succeeded}
+	if sendPaymentResponse.PaymentRoute != nil {
+		paymentResponse.FeeMsat = uint64(sendPaymentResponse.PaymentRoute.TotalFeesMsat)
+	}
 	return paymentResponse, nil
 }
 
 func (lnd *LndClient) payPartialInvoice(
 	ctx context.Context,
 	req *lnrpc.PayReq,
-	partialAmountToPay uint64,
+	partialAmountMsat uint64,
 	feeLimit *lnrpc.FeeLimit,
 ) (PaymentStatus, error) {
+	grpcClient, routerClient := lnd.clients()
 	queryRoutesRequest := lnrpc.QueryRoutesRequest{
 		PubKey:   req.Destination,
-		Amt:      int64(partialAmountToPay),
+		AmtMsat:  int64(partialAmountMsat),
 		FeeLimit: feeLimit,
 	}
 
-	queryRoutesResponse, err := lnd.grpcClient.QueryRoutes(ctx, &queryRoutesRequest)
+	queryRoutesResponse, err := grpcClient.QueryRoutes(ctx, &queryRoutesRequest)
 	if err != nil {
 		return PaymentStatus{PaymentStatus: Failed}, err
 	}
@@ -176,7 +299,7 @@ func (lnd *LndClient) payPartialInvoice(
 		SkipTempErr: true,
 	}
 
-	htlcAttempt, err := lnd.routerClient.SendToRouteV2(ctx, &sendToRouteRequest)
+	htlcAttempt, err := routerClient.SendToRouteV2(ctx, &sendToRouteRequest)
 	if err != nil {
 		return PaymentStatus{PaymentStatus: Failed}, err
 	}
@@ -185,6 +308,9 @@ func (lnd *LndClient) payPartialInvoice(
 	case lnrpc.HTLCAttempt_SUCCEEDED:
 		preimage := hex.EncodeToString(htlcAttempt.Preimage)
 		paymentResponse := PaymentStatus{Preimage: preimage, PaymentStatus: Succeeded}
+		if htlcAttempt.Route != nil {
+			paymentResponse.FeeMsat = uint64(htlcAttempt.Route.TotalFeesMsat)
+		}
 		return paymentResponse, nil
 	case lnrpc.HTLCAttempt_FAILED:
 		err := "payment failed"
@@ -200,6 +326,7 @@ func (lnd *LndClient) payPartialInvoice(
 }
 
 func (lnd *LndClient) OutgoingPaymentStatus(ctx context.Context, hash string) (PaymentStatus, error) {
+	_, routerClient := lnd.clients()
 	hashBytes, err := hex.DecodeString(hash)
 	if err != nil {
 		return PaymentStatus{}, errors.New("invalid hash provided")
@@ -211,12 +338,15 @@ func (lnd *LndClient) OutgoingPaymentStatus(ctx context.Context, hash string) (P
 		NoInflightUpdates: true,
 	}
 
-	trackPaymentStream, err := lnd.routerClient.TrackPaymentV2(ctx, &trackPaymentRequest)
+	trackPaymentStream, err := routerClient.TrackPaymentV2(ctx, &trackPaymentRequest)
 	if err != nil {
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) ||
 			strings.Contains(err.Error(), "context deadline exceeded") {
 			return PaymentStatus{PaymentStatus: Pending}, nil
 		}
+		if status.Code(err) == codes.NotFound {
+			return PaymentStatus{PaymentStatus: Failed}, fmt.Errorf("%w: %v", ErrPaymentNotFound, err)
+		}
 		return PaymentStatus{PaymentStatus: Failed}, err
 	}
 
@@ -227,6 +357,9 @@ func (lnd *LndClient) OutgoingPaymentStatus(ctx context.Context, hash string) (P
 			strings.Contains(err.Error(), "context deadline exceeded") {
 			return PaymentStatus{PaymentStatus: Pending}, nil
 		}
+		if status.Code(err) == codes.NotFound {
+			return PaymentStatus{PaymentStatus: Failed}, fmt.Errorf("%w: %v", ErrPaymentNotFound, err)
+		}
 		return PaymentStatus{PaymentStatus: Failed}, err
 	}
 	if payment.Status == lnrpc.Payment_UNKNOWN || payment.Status == lnrpc.Payment_FAILED {
@@ -236,13 +369,22 @@ func (lnd *LndClient) OutgoingPaymentStatus(ctx context.Context, hash string) (P
 		return PaymentStatus{PaymentStatus: Pending}, nil
 	}
 	if payment.Status == lnrpc.Payment_SUCCEEDED {
-		return PaymentStatus{PaymentStatus: Succeeded, Preimage: payment.PaymentPreimage}, nil
+		return PaymentStatus{
+			PaymentStatus: Succeeded,
+			Preimage:      payment.PaymentPreimage,
+			FeeMsat:       uint64(payment.FeeMsat),
+		}, nil
 	}
 
 	return PaymentStatus{PaymentStatus: Failed}, errors.New("unknown")
 }
 
-func (lnd *LndClient) FeeReserve(amount uint64) uint64 {
-	fee := math.Ceil(float64(amount) * FeePercent)
+func (lnd *LndClient) FeeReserve(amountMsat uint64) uint64 {
+	fee := math.Ceil(float64(amountMsat) * FeePercent)
 	return uint64(fee)
 }
+
+// SupportsMPP is true since partial payments are sent to a route with an MPP record
+func (lnd *LndClient) SupportsMPP() bool {
+	return true
+}
@@ -0,0 +1,12 @@
+//go:build nolnd
+
+package lightning
+
+import "errors"
+
+// the LND backend is left out of builds with the nolnd tag
+func init() {
+	Register("Lnd", func(func(string) string) (Client, error) {
+		return nil, errors.New("mint was built without LND support (nolnd tag)")
+	})
+}
@@ -0,0 +1,156 @@
+//go:build !nolnd
+
+package lightning
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lightningnetwork/lnd/macaroons"
+	"google.golang.org/grpc/credentials"
+	"gopkg.in/macaroon.v2"
+)
+
+func init() {
+	Register("Lnd", func(config func(string) string) (Client, error) {
+		lndConfig, err := LndConfigFromEnv(config)
+		if err != nil {
+			return nil, err
+		}
+		return SetupLndClient(lndConfig)
+	})
+}
+
+// LndConfigFromEnv reads the values for setting up LND. The cert and macaroon
+// can be set as values (LND_CERT, LND_MACAROON) or as paths to the files.
+func LndConfigFromEnv(config func(key string) string) (LndConfig, error) {
+	host := config("LND_GRPC_HOST")
+	if host == "" {
+		return LndConfig{}, errors.New("LND_GRPC_HOST cannot be empty")
+	}
+
+	var creds credentials.TransportCredentials
+	var err error
+	if cert := config("LND_CERT"); cert != "" {
+		creds, err = LndCertFromValue(cert)
+	} else if certPath := config("LND_CERT_PATH"); certPath != "" {
+		creds, err = LndCertFromFile(certPath)
+	} else {
+		return LndConfig{}, errors.New("one of LND_CERT or LND_CERT_PATH needs to be set")
+	}
+	if err != nil {
+		return LndConfig{}, err
+	}
+
+	var macaroonCreds macaroons.MacaroonCredential
+	if macaroon := config("LND_MACAROON"); macaroon != "" {
+		macaroonCreds, err = LndMacaroonFromValue(macaroon)
+	} else if macaroonPath := config("LND_MACAROON_PATH"); macaroonPath != "" {
+		macaroonCreds, err = LndMacaroonFromFile(macaroonPath)
+	} else {
+		return LndConfig{}, errors.New("one of LND_MACAROON or LND_MACAROON_PATH needs to be set")
+	}
+	if err != nil {
+		return LndConfig{}, err
+	}
+
+	return LndConfig{
+		GRPCHost: host,
+		Cert:     creds,
+		Macaroon: macaroonCreds,
+	}, nil
+}
+
+// LndCertFromFile reads the TLS cert of the LND node from a file
+func LndCertFromFile(path string) (credentials.TransportCredentials, error) {
+	certBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading cert: %v", err)
+	}
+	return lndCert(certBytes)
+}
+
+// LndCertFromValue parses the TLS cert of the LND node from a string.
+// The value can be the PEM encoded cert or the PEM or DER
+// encoded cert in base64 or hex.
+func LndCertFromValue(value string) (credentials.TransportCredentials, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "-----BEGIN") {
+		return lndCert([]byte(value))
+	}
+
+	certBytes, err := decodeValue(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cert: %v", err)
+	}
+	return lndCert(certBytes)
+}
+
+func lndCert(certBytes []byte) (credentials.TransportCredentials, error) {
+	certPool := x509.NewCertPool()
+	if block, _ := pem.Decode(certBytes); block != nil {
+		if !certPool.AppendCertsFromPEM(certBytes) {
+			return nil, errors.New("invalid cert: could not parse PEM")
+		}
+	} else {
+		cert, err := x509.ParseCertificate(certBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cert: %v", err)
+		}
+		certPool.AddCert(cert)
+	}
+	return credentials.NewClientTLSFromCert(certPool, ""), nil
+}
+
+// LndMacaroonFromFile reads the macaroon for LND from a file
+func LndMacaroonFromFile(path string) (macaroons.MacaroonCredential, error) {
+	macaroonBytes, err := os.ReadFile(path)
+	if err != nil {
+		return macaroons.MacaroonCredential{}, fmt.Errorf("error reading macaroon: %v", err)
+	}
+	return lndMacaroon(macaroonBytes)
+}
+
+// LndMacaroonFromValue parses the macaroon for LND from a hex or base64 string
+func LndMacaroonFromValue(value string) (macaroons.MacaroonCredential, error) {
+	macaroonBytes, err := decodeValue(strings.TrimSpace(value))
+	if err != nil {
+		return macaroons.MacaroonCredential{}, fmt.Errorf("invalid macaroon: %v", err)
+	}
+	return lndMacaroon(macaroonBytes)
+}
+
+func lndMacaroon(macaroonBytes []byte) (macaroons.MacaroonCredential, error) {
+	mac := &macaroon.Macaroon{}
+	if err := mac.UnmarshalBinary(macaroonBytes); err != nil {
+		return macaroons.MacaroonCredential{}, fmt.Errorf("unable to decode macaroon: %v", err)
+	}
+	macaroonCreds, err := macaroons.NewMacaroonCredential(mac)
+	if err != nil {
+		return macaroons.MacaroonCredential{}, fmt.Errorf("error setting macaroon creds: %v", err)
+	}
+	return macaroonCreds, nil
+}
+
+// decodeValue decodes a hex or base64 string
+func decodeValue(value string) ([]byte, error) {
+	if len(value) == 0 {
+		return nil, errors.New("empty value")
+	}
+	if decoded, err := hex.DecodeString(value); err == nil {
+		return decoded, nil
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
+		return decoded, nil
+	}
+	if decoded, err := base64.URLEncoding.DecodeString(value); err == nil {
+		return decoded, nil
+	}
+	return nil, errors.New("value is not hex or base64 encoded")
+}
@@ -0,0 +1,101 @@
+//go:build !nolnd
+
+package lightning
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/macaroon.v2"
+)
+
+func TestLndCertFromValue(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Organization: []string{"lnd"}},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("error creating cert: %v", err)
+	}
+	pemCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	values := []string{
+		string(pemCert),
+		base64.StdEncoding.EncodeToString(pemCert),
+		hex.EncodeToString(pemCert),
+		hex.EncodeToString(der),
+	}
+	for _, value := range values {
+		if _, err := LndCertFromValue(value); err != nil {
+			t.Fatalf("unexpected error parsing cert '%v': %v", value, err)
+		}
+	}
+
+	if _, err := LndCertFromValue("not a cert"); err == nil {
+		t.Fatal("expected error for invalid cert")
+	}
+	if _, err := LndCertFromValue(hex.EncodeToString([]byte("not a cert"))); err == nil {
+		t.Fatal("expected error for invalid cert")
+	}
+}
+
+func TestLndMacaroonFromValue(t *testing.T) {
+	mac, err := macaroon.New([]byte("rootkey"), []byte("0"), "lnd", macaroon.LatestVersion)
+	if err != nil {
+		t.Fatalf("error creating macaroon: %v", err)
+	}
+	macBytes, _ := mac.MarshalBinary()
+
+	for _, value := range []string{hex.EncodeToString(macBytes), base64.StdEncoding.EncodeToString(macBytes)} {
+		if _, err := LndMacaroonFromValue(value); err != nil {
+			t.Fatalf("unexpected error parsing macaroon '%v': %v", value, err)
+		}
+	}
+
+	if _, err := LndMacaroonFromValue(""); err == nil {
+		t.Fatal("expected error for empty macaroon")
+	}
+	if _, err := LndMacaroonFromValue("abcd"); err == nil {
+		t.Fatal("expected error for invalid macaroon")
+	}
+}
+
+func TestConnectionError(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected error
+	}{
+		{status.Error(codes.Unauthenticated, "bad creds"), ErrAuthentication},
+		{status.Error(codes.Unknown, "verification failed: signature mismatch after caveat verification"), ErrAuthentication},
+		{status.Error(codes.Unavailable, "authentication handshake failed: x509: certificate signed by unknown authority"), ErrAuthentication},
+		{status.Error(codes.Unavailable, "connection refused"), ErrUnreachable},
+		{status.Error(codes.DeadlineExceeded, "context deadline exceeded"), ErrUnreachable},
+	}
+
+	for _, test := range tests {
+		if err := connectionError(test.err); !errors.Is(err, test.expected) {
+			t.Fatalf("expected error '%v' for '%v' but got '%v'", test.expected, test.err, err)
+		}
+	}
+
+	err := status.Error(codes.Internal, "something else")
+	if connErr := connectionError(err); errors.Is(connErr, ErrAuthentication) || errors.Is(connErr, ErrUnreachable) {
+		t.Fatalf("unexpected classification of error: %v", connErr)
+	}
+}
@@ -0,0 +1,113 @@
+package lightning
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+)
+
+// Factory creates a backend with its config. The config function returns the
+// value of a setting by name, i.e os.Getenv to read it from the env of the mint.
+type Factory func(config func(key string) string) (Client, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+func init() {
+	Register("Cln", newClnFromConfig)
+	Register("FakeBackend", func(func(string) string) (Client, error) {
+		return &FakeBackend{}, nil
+	})
+}
+
+// Register makes a backend available by name to New and to the LIGHTNING_BACKEND
+// of the mint. Backends from other packages register in their init function so
+// that importing the package is enough to use them. It panics if the name is
+// empty, the factory is nil or a backend with the name was already registered.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if len(name) == 0 {
+		panic("lightning: Register with empty name")
+	}
+	if factory == nil {
+		panic("lightning: Register factory is nil")
+	}
+	if _, ok := factories[name]; ok {
+		panic("lightning: Register called twice for backend " + name)
+	}
+	factories[name] = factory
+}
+
+// New creates the backend registered with the name. If config is
+// nil, the settings of the backend are read from the env.
+func New(name string, config func(key string) string) (Client, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown lightning backend '%v'", name)
+	}
+
+	if config == nil {
+		config = os.Getenv
+	}
+	client, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("error setting up %v backend: %w", name, err)
+	}
+	if client == nil {
+		return nil, fmt.Errorf("%v backend returned a nil client", name)
+	}
+	return client, nil
+}
+
+// Backends returns the sorted names of the registered backends
+func Backends() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// ClnConfigFromEnv reads the values for setting up CLN (CLN_REST_URL, CLN_RUNE
+// and CLN_CA_CERT_PATH). The CA cert is only needed if the clnrest plugin uses a
+// self-signed cert.
+func ClnConfigFromEnv(config func(key string) string) (ClnConfig, error) {
+	restURL := config("CLN_REST_URL")
+	if restURL == "" {
+		return ClnConfig{}, errors.New("CLN_REST_URL cannot be empty")
+	}
+	clnRune := config("CLN_RUNE")
+	if clnRune == "" {
+		return ClnConfig{}, errors.New("CLN_RUNE cannot be empty")
+	}
+
+	clnConfig := ClnConfig{RestURL: restURL, Rune: clnRune}
+	if certPath := config("CLN_CA_CERT_PATH"); certPath != "" {
+		cert, err := ClnCACertFromFile(certPath)
+		if err != nil {
+			return ClnConfig{}, err
+		}
+		clnConfig.CACert = cert
+	}
+	return clnConfig, nil
+}
+
+func newClnFromConfig(config func(key string) string) (Client, error) {
+	clnConfig, err := ClnConfigFromEnv(config)
+	if err != nil {
+		return nil, err
+	}
+	return SetupClnClient(clnConfig)
+}
@@ -0,0 +1,59 @@
+package lightning
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+type registryTestBackend struct {
+	*FakeBackend
+	url string
+}
+
+func TestRegister(t *testing.T) {
+	Register("RegistryTest", func(config func(string) string) (Client, error) {
+		url := config("REGISTRY_TEST_URL")
+		if len(url) == 0 {
+			return nil, errors.New("REGISTRY_TEST_URL cannot be empty")
+		}
+		return &registryTestBackend{FakeBackend: &FakeBackend{}, url: url}, nil
+	})
+
+	for _, name := range []string{"Cln", "FakeBackend", "Lnd", "RegistryTest"} {
+		if !slices.Contains(Backends(), name) {
+			t.Fatalf("expected backend '%v' in %v", name, Backends())
+		}
+	}
+
+	config := map[string]string{"REGISTRY_TEST_URL": "http://localhost:8080"}
+	client, err := New("RegistryTest", func(key string) string { return config[key] })
+	if err != nil {
+		t.Fatalf("unexpected error creating backend: %v", err)
+	}
+	backend, ok := client.(*registryTestBackend)
+	if !ok || backend.url != config["REGISTRY_TEST_URL"] {
+		t.Fatalf("unexpected backend created: %+v", client)
+	}
+	if mppClient, ok := client.(MPPClient); !ok || !mppClient.SupportsMPP() {
+		t.Fatal("expected backend embedding the FakeBackend to support MPP")
+	}
+
+	noConfig := func(string) string { return "" }
+	if _, err := New("RegistryTest", noConfig); err == nil {
+		t.Fatal("expected error creating backend without its config")
+	}
+	if _, err := New("Cln", noConfig); err == nil {
+		t.Fatal("expected error creating CLN backend without its config")
+	}
+	if _, err := New("Unknown", noConfig); err == nil {
+		t.Fatal("expected error creating unknown backend")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic registering backend twice")
+		}
+	}()
+	Register("RegistryTest", func(func(string) string) (Client, error) { return &FakeBackend{}, nil })
+}
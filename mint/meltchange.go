@@ -0,0 +1,127 @@
+package mint
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// saveMeltChangeOutputs saves the blank outputs (NUT-08) of a melt request
+// so the change can be signed if the payment settles after the request and
+// returned again to wallets that did not get the response.
+func (m *Mint) saveMeltChangeOutputs(quoteId string, outputs cashu.BlindedMessages) error {
+	if len(outputs) > 0 {
+		sigs, err := m.db.GetBlindSignatures(outputs.B_s())
+		if err != nil {
+			errmsg := fmt.Sprintf("error getting blind signatures from db: %v", err)
+			return cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+		}
+		if len(sigs) > 0 {
+			return cashu.BlindedMessageAlreadySigned
+		}
+	}
+
+	// outputs from a previous attempt are replaced even if there are none now
+	if err := m.db.SaveMeltChangeOutputs(quoteId, outputs); err != nil {
+		errmsg := fmt.Sprintf("error saving change outputs: %v", err)
+		return cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+	}
+	return nil
+}
+
+// signMeltChange signs the change outputs saved for the paid quote with the
+// amounts of the fees that were overpaid. The payment already succeeded
+// so errors are logged and the quote is returned without change.
+func (m *Mint) signMeltChange(
+	ctx context.Context,
+	meltQuote storage.MeltQuote,
+	inputs cashu.Proofs,
+	feePaidMsat uint64,
+) cashu.BlindedSignatures {
+	outputs, err := m.db.GetMeltChangeOutputs(meltQuote.Id)
+	if err != nil {
+		m.logErrorContextf(ctx, "could not get change outputs for melt quote '%v': %v", meltQuote.Id, err)
+		return nil
+	}
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	var feePaid uint64
+	switch quoteUnit(meltQuote.Unit) {
+	case cashu.Sat.String():
+		feePaid = msatToSat(feePaidMsat)
+	case cashu.Msat.String():
+		feePaid = feePaidMsat
+	default:
+		// fee paid at the price the reserve was quoted at, rounded up
+		if meltQuote.FeeReserveMsat > 0 {
+			fee, err := cashu.CheckedMul(feePaidMsat, meltQuote.FeeReserve)
+			if err != nil {
+				return nil
+			}
+			feePaid = (fee + meltQuote.FeeReserveMsat - 1) / meltQuote.FeeReserveMsat
+		}
+	}
+	spent, err := cashu.CheckedAdd(meltQuote.Amount, feePaid, uint64(m.TransactionFees(inputs)))
+	if err != nil {
+		return nil
+	}
+	inputsAmount, err := inputs.CheckedAmount()
+	if err != nil || inputsAmount <= spent {
+		return nil
+	}
+	overpaid := inputsAmount - spent
+
+	// if there are not enough outputs for the overpaid amount,
+	// the largest amounts are returned
+	amounts := cashu.AmountSplit(overpaid)
+	slices.Reverse(amounts)
+	amounts = amounts[:min(len(amounts), len(outputs))]
+	changeOutputs := make(cashu.BlindedMessages, len(amounts))
+	for i, amount := range amounts {
+		changeOutputs[i] = cashu.BlindedMessage{Amount: amount, B_: outputs[i].B_, Id: outputs[i].Id}
+	}
+
+	change, err := m.signBlindedMessages(changeOutputs)
+	if err != nil {
+		m.logErrorContextf(ctx, "could not sign change for melt quote '%v': %v", meltQuote.Id, err)
+		return nil
+	}
+	m.logInfoContextf(ctx, "returning change of %v for overpaid fees in melt quote '%v'", change.Amount(), meltQuote.Id)
+	return change
+}
+
+// meltChange returns the signatures for the change outputs of the quote
+func (m *Mint) meltChange(quoteId string) (cashu.BlindedSignatures, error) {
+	outputs, err := m.db.GetMeltChangeOutputs(quoteId)
+	if err != nil {
+		return nil, err
+	}
+
+	B_sByKeyset := make(map[string][]string)
+	for _, output := range outputs {
+		B_sByKeyset[output.Id] = append(B_sByKeyset[output.Id], output.B_)
+	}
+	signed := make(map[string]cashu.BlindedSignature, len(outputs))
+	for keysetId, B_s := range B_sByKeyset {
+		sigs, err := m.db.GetBlindSignaturesByKeyset(keysetId, B_s)
+		if err != nil {
+			return nil, err
+		}
+		for B_, sig := range sigs {
+			signed[B_] = sig
+		}
+	}
+
+	var change cashu.BlindedSignatures
+	for _, output := range outputs {
+		if sig, ok := signed[output.B_]; ok {
+			change = append(change, sig)
+		}
+	}
+	return change, nil
+}
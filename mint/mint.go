@@ -10,11 +10,14 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
@@ -29,13 +32,13 @@ import (
 	"github.com/elnosh/gonuts/cashu/nuts/nut10"
 	"github.com/elnosh/gonuts/cashu/nuts/nut11"
 	"github.com/elnosh/gonuts/cashu/nuts/nut14"
+	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+	"github.com/elnosh/gonuts/cashu/nuts/nut20"
 	"github.com/elnosh/gonuts/crypto"
 	"github.com/elnosh/gonuts/mint/lightning"
 	"github.com/elnosh/gonuts/mint/storage"
 	"github.com/elnosh/gonuts/mint/storage/sqlite"
 	decodepay "github.com/nbd-wtf/ln-decodepay"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 const (
@@ -45,33 +48,94 @@ const (
 type Mint struct {
 	db storage.MintDB
 
+	// guards the keyset maps. They are replaced instead of modified when
+	// keysets change so the maps returned by getActiveKeysets and
+	// getKeysets can be read without holding the lock
+	keysetsMu sync.RWMutex
 	// active keysets
 	activeKeysets map[string]crypto.MintKeyset
 
-	// map of all keysets (both active and inactive)
-	keysets map[string]crypto.MintKeyset
+	// map of all keysets (both active and inactive). Inactive
+	// keysets are loaded without their keys, see keysetWithKeys
+	keysets     map[string]crypto.MintKeyset
+	lazyKeysets *lazyKeysets
+
+	// notifications of changes to websocket subscribers (NUT-17)
+	pubsub *pubsub
+	// unpaid mint quotes being checked for their subscribers
+	watchedMintQuotes sync.Map
 
 	lightningClient lightning.Client
-	mintInfo        nut06.MintInfo
-	limits          MintLimits
-	logger          *slog.Logger
-	mppEnabled      bool
+	// guards the info and limits since they can be reloaded while running
+	settingsMu sync.RWMutex
+	mintInfo   nut06.MintInfo
+	limits     MintLimits
+	// winding down. New mint quotes are rejected
+	redeemOnly bool
+	logger     *slog.Logger
+	logLevel   *slog.LevelVar
+	mppEnabled bool
+	// create AMP invoices for mint quotes
+	ampEnabled bool
+	// mint quotes with BOLT12 offers
+	bolt12Enabled bool
+	// parameters of the invoices for mint quotes
+	invoiceOptions lightning.InvoiceOptions
+	// keep the fee reserve of melt quotes that are settled internally
+	hideInternalSettlement bool
+	// experimental msat keyset is active
+	msatEnabled bool
+	// fiat units with an active keyset and their prices
+	fiatUnits     []cashu.Unit
+	exchangeRates ExchangeRates
+	// quotes are settled by the mint without lightning payments
+	faucetMode bool
+	// key of the mint info pubkey to sign proof states. nil if not enabled
+	stateKey *secp256k1.PrivateKey
+	// limits on requests advertised in the info
+	maxRequestSize  int64
+	maxRequestItems int
+	// bounds on the witnesses verified
+	witnessLimits witnessLimits
+	// verifiers of proofs locked with custom NUT-10 kinds
+	conditionVerifiers map[nut10.SecretKind]ConditionVerifier
+	// nil if there is no webhook for mint quotes
+	quoteWebhook *QuoteWebhook
+
+	// serializes the checks and updates on the state of quotes and proofs
+	// to prevent double issuance and double spending from concurrent requests
+	stateMu sync.Mutex
 }
 
 func LoadMint(config Config) (*Mint, error) {
+	if config.FaucetMode {
+		if err := checkFaucetConfig(config); err != nil {
+			return nil, err
+		}
+	}
+
 	path := config.MintPath
-	if err := os.MkdirAll(path, 0700); err != nil {
-		return nil, err
+	// the path is only needed for the sqlite db and the log file,
+	// so it is optional if a db is passed in the config
+	if config.DB == nil || len(path) > 0 {
+		if err := os.MkdirAll(path, 0700); err != nil {
+			return nil, err
+		}
 	}
 
-	logger, err := setupLogger(path, config.LogLevel)
+	logLevel := new(slog.LevelVar)
+	logger, err := setupLogger(path, config.LogLevel, logLevel)
 	if err != nil {
 		return nil, err
 	}
 
-	db, err := sqlite.InitSQLite(path)
-	if err != nil {
-		return nil, fmt.Errorf("error setting up sqlite: %v", err)
+	db := config.DB
+	if db == nil {
+		sqliteDB, err := sqlite.InitSQLite(path)
+		if err != nil {
+			return nil, fmt.Errorf("error setting up sqlite: %v", err)
+		}
+		db = sqliteDB
 	}
 
 	seed, err := db.GetSeed()
@@ -104,54 +168,111 @@ func LoadMint(config Config) (*Mint, error) {
 	}
 	logger.Info(fmt.Sprintf("setting active keyset '%v' with fee %v", activeKeyset.Id, activeKeyset.InputFeePpk))
 
+	activeKeysets := map[string]crypto.MintKeyset{activeKeyset.Id: *activeKeyset}
+	if config.EnableMsatUnit {
+		// msat keyset is derived with the same index and fee as the sat keyset
+		msatKeyset, err := crypto.GenerateUnitKeyset(master, cashu.Msat, config.DerivationPathIdx, config.InputFeePpk)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("setting active msat keyset '%v' with fee %v", msatKeyset.Id, msatKeyset.InputFeePpk))
+		activeKeysets[msatKeyset.Id] = *msatKeyset
+	}
+
+	if len(config.Units) > 0 && config.ExchangeRates == nil {
+		return nil, errors.New("exchange rates are required for fiat units")
+	}
+	for _, unit := range config.Units {
+		if !unit.IsFiat() {
+			return nil, fmt.Errorf("unit '%v' is not a fiat unit", unit)
+		}
+		keyset, err := crypto.GenerateUnitKeyset(master, unit, config.DerivationPathIdx, config.InputFeePpk)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info(fmt.Sprintf("setting active %v keyset '%v' with fee %v", unit, keyset.Id, keyset.InputFeePpk))
+		activeKeysets[keyset.Id] = *keyset
+	}
+
 	mint := &Mint{
 		db:            db,
-		activeKeysets: map[string]crypto.MintKeyset{activeKeyset.Id: *activeKeyset},
+		pubsub:        newPubSub(),
+		activeKeysets: activeKeysets,
 		limits:        config.Limits,
+		redeemOnly:    config.RedeemOnly,
 		logger:        logger,
+		logLevel:      logLevel,
 		mppEnabled:    config.EnableMPP,
+		ampEnabled:    config.EnableAMP,
+		bolt12Enabled: config.EnableBOLT12,
+		msatEnabled:   config.EnableMsatUnit,
+		fiatUnits:     slices.Clone(config.Units),
+		exchangeRates: config.ExchangeRates,
+
+		invoiceOptions: config.InvoiceOptions,
+	}
+	if config.SignProofStates {
+		// same key as the pubkey in the mint info
+		mint.stateKey, err = master.ECPrivKey()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	dbKeysets, err := mint.db.GetKeysets()
 	if err != nil {
 		return nil, fmt.Errorf("error reading keysets from db: %v", err)
 	}
+	if err := checkKeysets(seed, activeKeysets, dbKeysets, logger); err != nil {
+		return nil, err
+	}
 
-	activeKeysetNew := true
+	newActiveKeysets := maps.Clone(activeKeysets)
 	mintKeysets := make(map[string]crypto.MintKeyset)
+	mint.lazyKeysets = newLazyKeysets()
 	for _, dbkeyset := range dbKeysets {
-		seed, err := hex.DecodeString(dbkeyset.Seed)
-		if err != nil {
-			return nil, err
+		if dbkeyset.VerifyOnly {
+			if _, ok := activeKeysets[dbkeyset.Id]; ok {
+				return nil, errors.New("active keyset cannot be an imported verify-only keyset")
+			}
+		} else if _, ok := activeKeysets[dbkeyset.Id]; ok {
+			// active keysets were already derived
+			delete(newActiveKeysets, dbkeyset.Id)
+			mint.db.UpdateKeysetActive(dbkeyset.Id, true)
+			continue
 		}
 
-		master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
-		if err != nil {
-			return nil, err
+		if config.DeriveKeysetsOnStartup {
+			keyset, err := deriveDBKeyset(dbkeyset)
+			if err != nil {
+				return nil, err
+			}
+			mintKeysets[keyset.Id] = *keyset
+			continue
 		}
 
-		if dbkeyset.Id == activeKeyset.Id {
-			activeKeysetNew = false
-			mint.db.UpdateKeysetActive(activeKeyset.Id, true)
-		}
-		keyset, err := crypto.GenerateKeyset(master, dbkeyset.DerivationPathIdx, dbkeyset.InputFeePpk)
-		if err != nil {
-			return nil, err
+		// keys of inactive keysets are derived on first use
+		mintKeysets[dbkeyset.Id] = crypto.MintKeyset{
+			Id:                dbkeyset.Id,
+			Unit:              dbkeyset.Unit,
+			Active:            dbkeyset.Active,
+			DerivationPathIdx: dbkeyset.DerivationPathIdx,
+			InputFeePpk:       dbkeyset.InputFeePpk,
+			VerifyOnly:        dbkeyset.VerifyOnly,
 		}
-		keyset.Active = dbkeyset.Active
-		mintKeysets[keyset.Id] = *keyset
+		mint.lazyKeysets.add(dbkeyset)
 	}
 
-	// save active keyset if new
-	if activeKeysetNew {
+	// save active keysets if new
+	for _, keyset := range newActiveKeysets {
 		hexseed := hex.EncodeToString(seed)
 		activeDbKeyset := storage.DBKeyset{
-			Id:                activeKeyset.Id,
-			Unit:              activeKeyset.Unit,
+			Id:                keyset.Id,
+			Unit:              keyset.Unit,
 			Active:            true,
 			Seed:              hexseed,
-			DerivationPathIdx: activeKeyset.DerivationPathIdx,
-			InputFeePpk:       activeKeyset.InputFeePpk,
+			DerivationPathIdx: keyset.DerivationPathIdx,
+			InputFeePpk:       keyset.InputFeePpk,
 		}
 		err := mint.db.SaveKeyset(activeDbKeyset)
 		if err != nil {
@@ -159,19 +280,54 @@ func LoadMint(config Config) (*Mint, error) {
 		}
 	}
 	mint.keysets = mintKeysets
-	mint.keysets[activeKeyset.Id] = *activeKeyset
+	for _, keyset := range activeKeysets {
+		mint.keysets[keyset.Id] = keyset
+	}
+	if config.FaucetMode {
+		logger.Warn("running in faucet mode. Quotes are settled without lightning payments")
+		config.LightningClient = newFaucetBackend(config.FaucetSettleDelay)
+		mint.faucetMode = true
+	}
+	if config.LightningClient == nil && len(config.LightningBackend) > 0 {
+		config.LightningClient, err = lightning.New(config.LightningBackend, config.LightningConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if config.LightningClient == nil {
 		return nil, errors.New("invalid lightning client")
 	}
 
 	if err := config.LightningClient.ConnectionStatus(); err != nil {
-		return nil, fmt.Errorf("can't connect to lightning backend: %v", err)
+		return nil, fmt.Errorf("can't connect to lightning backend: %w", err)
 	}
+	if _, ok := config.LightningClient.(lightning.AMPClient); config.EnableAMP && !ok {
+		return nil, errors.New("lightning backend does not support AMP invoices")
+	}
+	if _, ok := config.LightningClient.(lightning.BOLT12Client); config.EnableBOLT12 && !ok {
+		return nil, errors.New("lightning backend does not support BOLT12 offers")
+	}
+	if mppClient, ok := config.LightningClient.(lightning.MPPClient); config.EnableMPP && (!ok || !mppClient.SupportsMPP()) {
+		return nil, errors.New("lightning backend does not support MPP payments")
+	}
+	mint.hideInternalSettlement = config.HideInternalSettlement
 	mint.lightningClient = config.LightningClient
+	mint.maxRequestSize, mint.maxRequestItems = config.requestLimits()
+	mint.witnessLimits = config.witnessLimits()
+	if err := checkConditionVerifiers(config.ConditionVerifiers); err != nil {
+		return nil, err
+	}
+	mint.conditionVerifiers = maps.Clone(config.ConditionVerifiers)
+	if len(config.QuoteWebhook.URL) > 0 {
+		if _, err := url.ParseRequestURI(config.QuoteWebhook.URL); err != nil {
+			return nil, fmt.Errorf("invalid quote webhook url: %v", err)
+		}
+		mint.quoteWebhook = &config.QuoteWebhook
+	}
 	mint.SetMintInfo(config.MintInfo)
 
 	for _, keyset := range mint.keysets {
-		if keyset.Id != activeKeyset.Id && keyset.Active {
+		if _, ok := activeKeysets[keyset.Id]; !ok && keyset.Active {
 			mint.logger.Info(fmt.Sprintf("setting keyset '%v' to inactive", keyset.Id))
 			keyset.Active = false
 			mint.db.UpdateKeysetActive(keyset.Id, false)
@@ -182,7 +338,9 @@ func LoadMint(config Config) (*Mint, error) {
 	return mint, nil
 }
 
-func setupLogger(mintPath string, logLevel LogLevel) (*slog.Logger, error) {
+// setupLogger creates the logger for the mint. The level is set
+// in the level var so it can be changed while running.
+func setupLogger(mintPath string, logLevel LogLevel, level *slog.LevelVar) (*slog.Logger, error) {
 	replacer := func(groups []string, a slog.Attr) slog.Attr {
 		if a.Key == slog.SourceKey {
 			source := a.Value.Any().(*slog.Source)
@@ -194,53 +352,70 @@ func setupLogger(mintPath string, logLevel LogLevel) (*slog.Logger, error) {
 		return a
 	}
 
-	logFile, err := os.OpenFile(filepath.Join(mintPath, "mint.log"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
-	if err != nil {
-		return nil, fmt.Errorf("error opening log file: %v", err)
+	var logWriter io.Writer = os.Stdout
+	// only log to stdout if there is no path for the log file
+	if len(mintPath) > 0 {
+		logFile, err := os.OpenFile(filepath.Join(mintPath, "mint.log"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("error opening log file: %v", err)
+		}
+		logWriter = io.MultiWriter(os.Stdout, logFile)
 	}
-
-	logWriter := io.MultiWriter(os.Stdout, logFile)
-	level := slog.LevelInfo
+	level.Set(slog.LevelInfo)
 	switch logLevel {
 	case Debug:
-		level = slog.LevelDebug
+		level.Set(slog.LevelDebug)
 	case Disable:
 		logWriter = io.Discard
 	}
 
-	return slog.New(slog.NewTextHandler(logWriter, &slog.HandlerOptions{
+	handler := slog.NewTextHandler(logWriter, &slog.HandlerOptions{
 		AddSource:   true,
 		Level:       level,
 		ReplaceAttr: replacer,
-	})), nil
+	})
+	return slog.New(requestLogHandler{handler}), nil
 }
 
 // logInfof formats the strings with args and preserves the source position
 // from where this method is called for the log msg. Otherwise all messages would be logged with
 // source line of this log method and not the original caller
 func (m *Mint) logInfof(format string, args ...any) {
-	var pcs [1]uintptr
-	runtime.Callers(2, pcs[:])
-	r := slog.NewRecord(time.Now(), slog.LevelInfo, fmt.Sprintf(format, args...), pcs[0])
-	_ = m.logger.Handler().Handle(context.Background(), r)
+	m.logf(context.Background(), slog.LevelInfo, format, args...)
 }
 
 func (m *Mint) logErrorf(format string, args ...any) {
-	var pcs [1]uintptr
-	runtime.Callers(2, pcs[:])
-	r := slog.NewRecord(time.Now(), slog.LevelError, fmt.Sprintf(format, args...), pcs[0])
-	_ = m.logger.Handler().Handle(context.Background(), r)
+	m.logf(context.Background(), slog.LevelError, format, args...)
 }
 
 func (m *Mint) logDebugf(format string, args ...any) {
-	if !m.logger.Enabled(context.Background(), slog.LevelDebug) {
+	m.logf(context.Background(), slog.LevelDebug, format, args...)
+}
+
+// logInfoContextf logs with the attributes of the request in the
+// context (i.e request id) if it was called from the server
+func (m *Mint) logInfoContextf(ctx context.Context, format string, args ...any) {
+	m.logf(ctx, slog.LevelInfo, format, args...)
+}
+
+func (m *Mint) logErrorContextf(ctx context.Context, format string, args ...any) {
+	m.logf(ctx, slog.LevelError, format, args...)
+}
+
+func (m *Mint) logDebugContextf(ctx context.Context, format string, args ...any) {
+	m.logf(ctx, slog.LevelDebug, format, args...)
+}
+
+func (m *Mint) logf(ctx context.Context, level slog.Level, format string, args ...any) {
+	if !m.logger.Enabled(ctx, level) {
 		return
 	}
 
+	// skip this method and the log method that called it
 	var pcs [1]uintptr
-	runtime.Callers(2, pcs[:])
-	r := slog.NewRecord(time.Now(), slog.LevelDebug, fmt.Sprintf(format, args...), pcs[0])
-	_ = m.logger.Handler().Handle(context.Background(), r)
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level, fmt.Sprintf(format, args...), pcs[0])
+	_ = m.logger.Handler().Handle(ctx, r)
 }
 
 // RequestMintQuote will process a request to mint tokens
@@ -248,33 +423,81 @@ func (m *Mint) logDebugf(format string, args ...any) {
 // The request to mint a token is explained in
 // NUT-04 here: https://github.com/cashubtc/nuts/blob/main/04.md.
 func (m *Mint) RequestMintQuote(mintQuoteRequest nut04.PostMintQuoteBolt11Request) (storage.MintQuote, error) {
-	// only support sat unit
-	if mintQuoteRequest.Unit != cashu.Sat.String() {
+	return m.requestMintQuote(context.Background(), mintQuoteRequest)
+}
+
+func (m *Mint) requestMintQuote(ctx context.Context, mintQuoteRequest nut04.PostMintQuoteBolt11Request) (storage.MintQuote, error) {
+	if !m.unitSupported(mintQuoteRequest.Unit) {
 		errmsg := fmt.Sprintf("unit '%v' not supported", mintQuoteRequest.Unit)
 		return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.UnitErrCode)
 	}
+	if m.RedeemOnly() {
+		return storage.MintQuote{}, cashu.MintingDisabled
+	}
 
-	// check limits
+	// limits and the invoice are in sats
 	requestAmount := mintQuoteRequest.Amount
-	if m.limits.MintingSettings.MaxAmount > 0 {
-		if requestAmount > m.limits.MintingSettings.MaxAmount {
+	if mintQuoteRequest.Unit == cashu.Msat.String() {
+		if requestAmount%1000 != 0 {
+			return storage.MintQuote{}, cashu.BuildCashuError("msat amount has to be for whole sats", cashu.UnitErrCode)
+		}
+		requestAmount /= 1000
+	} else if mintQuoteRequest.Unit != cashu.Sat.String() {
+		// the invoice for amounts in fiat units is for
+		// the sats they are worth at the current price
+		amountMsat, err := m.unitToMsat(mintQuoteRequest.Unit, requestAmount)
+		if err != nil {
+			if errors.Is(err, cashu.ErrAmountOverflow) {
+				return storage.MintQuote{}, cashu.MintAmountExceededErr
+			}
+			return storage.MintQuote{}, err
+		}
+		requestAmount = msatToSat(amountMsat)
+	}
+	// the invoice is requested in msat from the lightning backend
+	if _, err := cashu.CheckedMul(requestAmount, 1000); err != nil {
+		return storage.MintQuote{}, cashu.MintAmountExceededErr
+	}
+
+	// check limits
+	limits := m.currentLimits()
+	if limits.MintingSettings.MaxAmount > 0 {
+		if requestAmount > limits.MintingSettings.MaxAmount {
 			return storage.MintQuote{}, cashu.MintAmountExceededErr
 		}
 	}
-	if m.limits.MaxBalance > 0 {
+	if limits.MaxBalance > 0 {
 		balance, err := m.db.GetBalance()
 		if err != nil {
 			errmsg := fmt.Sprintf("could not get mint balance from db: %v", err)
 			return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 		}
-		if balance+requestAmount > m.limits.MaxBalance {
+		newBalance, err := cashu.CheckedAdd(balance, requestAmount)
+		if err != nil || newBalance > limits.MaxBalance {
 			return storage.MintQuote{}, cashu.MintingDisabled
 		}
 	}
 
+	var pubkey string
+	if len(mintQuoteRequest.Pubkey) > 0 {
+		key, err := nut20.ParsePubkey(mintQuoteRequest.Pubkey)
+		if err != nil {
+			return storage.MintQuote{}, err
+		}
+		pubkey = hex.EncodeToString(key.SerializeCompressed())
+	} else if limits.MintingSettings.PubkeyRequiredAbove > 0 &&
+		requestAmount > limits.MintingSettings.PubkeyRequiredAbove {
+		return storage.MintQuote{}, nut20.PubkeyRequiredErr
+	}
+
+	description, err := sanitizeDescription(mintQuoteRequest.Description)
+	if err != nil {
+		return storage.MintQuote{}, err
+	}
+
 	// get an invoice from the lightning backend
-	m.logInfof("requesting invoice from lightning backend for %v sats", requestAmount)
-	invoice, err := m.requestInvoice(requestAmount)
+	m.logInfoContextf(ctx, "requesting invoice from lightning backend for %v sats", requestAmount)
+	invoice, err := m.requestInvoice(requestAmount, description)
 	if err != nil {
 		errmsg := fmt.Sprintf("could not generate invoice: %v", err)
 		return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.LightningBackendErrCode)
@@ -282,16 +505,20 @@ func (m *Mint) RequestMintQuote(mintQuoteRequest nut04.PostMintQuoteBolt11Reques
 
 	quoteId, err := cashu.GenerateRandomQuoteId()
 	if err != nil {
-		m.logErrorf("error generating random quote id: %v", err)
+		m.logErrorContextf(ctx, "error generating random quote id: %v", err)
 		return storage.MintQuote{}, cashu.StandardErr
 	}
 	mintQuote := storage.MintQuote{
 		Id:             quoteId,
-		Amount:         requestAmount,
+		Amount:         mintQuoteRequest.Amount,
 		PaymentRequest: invoice.PaymentRequest,
 		PaymentHash:    invoice.PaymentHash,
 		State:          nut04.Unpaid,
 		Expiry:         invoice.Expiry,
+		Pubkey:         pubkey,
+		Unit:           mintQuoteRequest.Unit,
+		AmountMsat:     requestAmount * 1000,
+		Method:         cashu.BOLT11_METHOD,
 	}
 
 	err = m.db.SaveMintQuote(mintQuote)
@@ -299,48 +526,127 @@ func (m *Mint) RequestMintQuote(mintQuoteRequest nut04.PostMintQuoteBolt11Reques
 		errmsg := fmt.Sprintf("error saving mint quote to db: %v", err)
 		return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 	}
+	if m.quoteWebhook != nil {
+		go m.notifyMintQuoteCreated(mintQuote)
+	}
 
 	return mintQuote, nil
 }
 
 // GetMintQuoteState returns the state of a mint quote.
 func (m *Mint) GetMintQuoteState(quoteId string) (storage.MintQuote, error) {
+	return m.getMintQuoteState(context.Background(), quoteId)
+}
+
+func (m *Mint) getMintQuoteState(ctx context.Context, quoteId string) (storage.MintQuote, error) {
 	mintQuote, err := m.db.GetMintQuote(quoteId)
-	if err != nil {
+	if err != nil || quoteMethod(mintQuote.Method) != cashu.BOLT11_METHOD {
 		return storage.MintQuote{}, cashu.QuoteNotExistErr
 	}
 
 	// if previously unpaid, check if invoice has been paid
 	if mintQuote.State == nut04.Unpaid {
-		m.logDebugf("checking status of invoice with hash '%v'", mintQuote.PaymentHash)
+		m.logDebugContextf(ctx, "checking status of invoice with hash '%v'", mintQuote.PaymentHash)
 		status, err := m.lightningClient.InvoiceStatus(mintQuote.PaymentHash)
 		if err != nil {
 			errmsg := fmt.Sprintf("error getting invoice status: %v", err)
 			return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.LightningBackendErrCode)
 		}
 
-		if status.Settled {
-			m.logInfof("mint quote '%v' with invoice payment hash '%v' was paid", mintQuote.Id, mintQuote.PaymentHash)
-			mintQuote.State = nut04.Paid
-			err := m.db.UpdateMintQuoteState(mintQuote.Id, mintQuote.State)
-			if err != nil {
-				errmsg := fmt.Sprintf("error updating mint quote in db: %v", err)
-				return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+		if amount := quoteSatAmount(mintQuote); status.AMP && status.AmountPaid < amount {
+			if status.AmountPaid > 0 {
+				m.logDebugContextf(ctx, "AMP invoice of mint quote '%v' paid %v of %v", mintQuote.Id, status.AmountPaid, amount)
 			}
+			return mintQuote, nil
+		}
+		if status.Settled || status.AMP {
+			syncPoint(syncMintQuoteInvoiceSettled)
+			m.logInfoContextf(ctx, "mint quote '%v' with invoice payment hash '%v' was paid", mintQuote.Id, mintQuote.PaymentHash)
+			return m.setMintQuotePaid(mintQuote.Id)
 		}
 	}
 
 	return mintQuote, nil
 }
 
+// GetMintQuoteByPaymentHash returns the state of the mint quote for the invoice
+// with the payment hash. Only the full payment hash is accepted. The payment
+// hash is known to the payer and the nodes routing the payment, so only quotes
+// locked to a pubkey (NUT-20) are returned since anyone with the id of a quote
+// without a pubkey could mint from it.
+func (m *Mint) GetMintQuoteByPaymentHash(paymentHash string) (storage.MintQuote, error) {
+	return m.getMintQuoteByPaymentHash(context.Background(), paymentHash)
+}
+
+func (m *Mint) getMintQuoteByPaymentHash(ctx context.Context, paymentHash string) (storage.MintQuote, error) {
+	if !validPaymentHash(paymentHash) {
+		return storage.MintQuote{}, cashu.InvalidPaymentHashErr
+	}
+	mintQuote, err := m.db.GetMintQuoteByPaymentHash(paymentHash)
+	if err != nil {
+		return storage.MintQuote{}, cashu.QuoteNotExistErr
+	}
+	if len(mintQuote.Pubkey) == 0 {
+		return storage.MintQuote{}, cashu.QuoteLookupPubkeyRequired
+	}
+	return m.getMintQuoteState(ctx, mintQuote.Id)
+}
+
+// setMintQuotePaid marks the quote as paid only if it is still unpaid.
+// The state could have changed while checking the invoice status
+// (i.e quote already issued) and it should not go back to paid.
+func (m *Mint) setMintQuotePaid(quoteId string) (storage.MintQuote, error) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	mintQuote, err := m.db.GetMintQuote(quoteId)
+	if err != nil {
+		return storage.MintQuote{}, cashu.QuoteNotExistErr
+	}
+
+	if mintQuote.State == nut04.Unpaid {
+		mintQuote.State = nut04.Paid
+		err := m.db.UpdateMintQuoteState(mintQuote.Id, mintQuote.State)
+		if err != nil {
+			errmsg := fmt.Sprintf("error updating mint quote in db: %v", err)
+			return storage.MintQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+		}
+		m.publishMintQuote(mintQuote)
+	}
+
+	return mintQuote, nil
+}
+
 // MintTokens verifies whether the mint quote with id has been paid and proceeds to
 // sign the blindedMessages and return the BlindedSignatures if it was paid.
 func (m *Mint) MintTokens(mintTokensRequest nut04.PostMintBolt11Request) (cashu.BlindedSignatures, error) {
+	// check with the backend first if quote has been paid
 	mintQuote, err := m.GetMintQuoteState(mintTokensRequest.Quote)
 	if err != nil {
 		return nil, err
 	}
 
+	// only the holder of the key in the quote can mint it
+	if len(mintQuote.Pubkey) > 0 {
+		pubkey, err := nut20.ParsePubkey(mintQuote.Pubkey)
+		if err != nil {
+			return nil, err
+		}
+		if !nut20.VerifyMintRequest(mintQuote.Id, mintTokensRequest.Outputs, mintTokensRequest.Signature, pubkey) {
+			return nil, nut20.InvalidSignatureErr
+		}
+	}
+
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	// read quote again since it could have been
+	// updated by another request in the meantime
+	mintQuote, err = m.db.GetMintQuote(mintQuote.Id)
+	if err != nil {
+		return nil, cashu.QuoteNotExistErr
+	}
+
 	var blindedSignatures cashu.BlindedSignatures
 
 	switch mintQuote.State {
@@ -351,6 +657,7 @@ func (m *Mint) MintTokens(mintTokensRequest nut04.PostMintBolt11Request) (cashu.
 	case nut04.Pending:
 		return nil, cashu.QuotePending
 	case nut04.Paid:
+		syncPoint(syncMintQuotePaid)
 		err := func() error {
 			// set quote as pending while validating blinded messages and signing
 			err = m.db.UpdateMintQuoteState(mintQuote.Id, nut04.Pending)
@@ -360,19 +667,16 @@ func (m *Mint) MintTokens(mintTokensRequest nut04.PostMintBolt11Request) (cashu.
 			}
 
 			blindedMessages := mintTokensRequest.Outputs
-			var blindedMessagesAmount uint64
-			B_s := make([]string, len(blindedMessages))
-			for i, bm := range blindedMessages {
-				blindedMessagesAmount += bm.Amount
-				B_s[i] = bm.B_
+			blindedMessagesAmount, err := blindedMessages.CheckedAmount()
+			if err != nil {
+				return cashu.InvalidBlindedMessageAmount
+			}
+			if blindedMessages.HasDuplicates() {
+				return cashu.DuplicateOutputs
 			}
 
-			if len(blindedMessages) > 0 {
-				for _, msg := range blindedMessages {
-					if blindedMessagesAmount < msg.Amount {
-						return cashu.InvalidBlindedMessageAmount
-					}
-				}
+			if err := m.verifyUnit(quoteUnit(mintQuote.Unit), nil, blindedMessages); err != nil {
+				return err
 			}
 
 			// verify that amount from blinded messages is less
@@ -381,7 +685,7 @@ func (m *Mint) MintTokens(mintTokensRequest nut04.PostMintBolt11Request) (cashu.
 				return cashu.OutputsOverQuoteAmountErr
 			}
 
-			sigs, err := m.db.GetBlindSignatures(B_s)
+			sigs, err := m.db.GetBlindSignatures(blindedMessages.B_s())
 			if err != nil {
 				errmsg := fmt.Sprintf("error getting blind signatures from db: %v", err)
 				return cashu.BuildCashuError(errmsg, cashu.DBErrCode)
@@ -412,6 +716,8 @@ func (m *Mint) MintTokens(mintTokensRequest nut04.PostMintBolt11Request) (cashu.
 			}
 			return nil, err
 		}
+		mintQuote.State = nut04.Issued
+		m.publishMintQuote(mintQuote)
 	}
 
 	return blindedSignatures, nil
@@ -423,45 +729,47 @@ func (m *Mint) MintTokens(mintTokensRequest nut04.PostMintBolt11Request) (cashu.
 // the proofs that were used as input.
 // It returns the BlindedSignatures.
 func (m *Mint) Swap(proofs cashu.Proofs, blindedMessages cashu.BlindedMessages) (cashu.BlindedSignatures, error) {
-	var proofsAmount uint64
-	Ys := make([]string, len(proofs))
-	for i, proof := range proofs {
-		proofsAmount += proof.Amount
+	return m.swap(context.Background(), proofs, blindedMessages)
+}
 
-		Y, err := crypto.HashToCurve([]byte(proof.Secret))
-		if err != nil {
-			return nil, cashu.InvalidProofErr
-		}
-		Yhex := hex.EncodeToString(Y.SerializeCompressed())
-		Ys[i] = Yhex
+func (m *Mint) swap(ctx context.Context, proofs cashu.Proofs, blindedMessages cashu.BlindedMessages) (cashu.BlindedSignatures, error) {
+	proofsAmount, err := proofs.CheckedAmount()
+	if err != nil {
+		return nil, cashu.InvalidProofErr
 	}
-
-	var blindedMessagesAmount uint64
-	B_s := make([]string, len(blindedMessages))
-	for i, bm := range blindedMessages {
-		blindedMessagesAmount += bm.Amount
-		B_s[i] = bm.B_
+	Ys, err := crypto.ProofsYs(proofs)
+	if err != nil {
+		return nil, cashu.InvalidProofErr
 	}
 
-	// check overflow
-	if len(blindedMessages) > 0 {
-		for _, msg := range blindedMessages {
-			if blindedMessagesAmount < msg.Amount {
-				return nil, cashu.InvalidBlindedMessageAmount
-			}
-		}
+	blindedMessagesAmount, err := blindedMessages.CheckedAmount()
+	if err != nil {
+		return nil, cashu.InvalidBlindedMessageAmount
+	}
+	if blindedMessages.HasDuplicates() {
+		return nil, cashu.DuplicateOutputs
 	}
+	if err := m.verifyUnit("", proofs, blindedMessages); err != nil {
+		return nil, err
+	}
+
 	fees := m.TransactionFees(proofs)
-	if proofsAmount-uint64(fees) < blindedMessagesAmount {
+	if !inputsCover(proofsAmount, blindedMessagesAmount, uint64(fees)) {
 		return nil, cashu.InsufficientProofsAmount
 	}
 
-	err := m.verifyProofs(proofs, Ys)
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	err = m.verifyProofs(ctx, proofs, Ys)
 	if err != nil {
 		return nil, err
 	}
+	syncPoint(syncSwapProofsVerified)
 
-	sigs, err := m.db.GetBlindSignatures(B_s)
+	// not looked up by keyset since a B_ can
+	// only be signed once across all keysets
+	sigs, err := m.db.GetBlindSignatures(blindedMessages.B_s())
 	if err != nil {
 		errmsg := fmt.Sprintf("error getting blind signatures from db: %v", err)
 		return nil, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
@@ -472,8 +780,8 @@ func (m *Mint) Swap(proofs cashu.Proofs, blindedMessages cashu.BlindedMessages)
 
 	// if sig all, verify signatures in blinded messages
 	if nut11.ProofsSigAll(proofs) {
-		m.logDebugf("locked proofs have SIG_ALL flag. Verifying blinded messages")
-		if err := verifyBlindedMessages(proofs, blindedMessages); err != nil {
+		m.logDebugContextf(ctx, "locked proofs have SIG_ALL flag. Verifying blinded messages")
+		if err := verifyBlindedMessages(proofs, blindedMessages, m.witnessLimits); err != nil {
 			return nil, err
 		}
 	}
@@ -490,6 +798,8 @@ func (m *Mint) Swap(proofs cashu.Proofs, blindedMessages cashu.BlindedMessages)
 		errmsg := fmt.Sprintf("error invalidating proofs. Could not save proofs to db: %v", err)
 		return nil, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 	}
+	m.recordFees(ctx, proofs)
+	m.publishProofStates(proofs, nut07.Spent)
 
 	return blindedSignatures, nil
 }
@@ -497,11 +807,21 @@ func (m *Mint) Swap(proofs cashu.Proofs, blindedMessages cashu.BlindedMessages)
 // RequestMeltQuote will process a request to melt tokens and return a MeltQuote.
 // A melt is requested by a wallet to request the mint to pay an invoice.
 func (m *Mint) RequestMeltQuote(meltQuoteRequest nut05.PostMeltQuoteBolt11Request) (storage.MeltQuote, error) {
-	if meltQuoteRequest.Unit != cashu.Sat.String() {
+	return m.requestMeltQuote(context.Background(), meltQuoteRequest)
+}
+
+func (m *Mint) requestMeltQuote(ctx context.Context, meltQuoteRequest nut05.PostMeltQuoteBolt11Request) (storage.MeltQuote, error) {
+	if !m.unitSupported(meltQuoteRequest.Unit) {
 		errmsg := fmt.Sprintf("unit '%v' not supported", meltQuoteRequest.Unit)
 		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.UnitErrCode)
 	}
 
+	options := meltQuoteRequest.Options
+	if options != nil && options.Amountless != nil {
+		return storage.MeltQuote{},
+			cashu.BuildCashuError("amountless invoices are not supported", cashu.MeltQuoteErrCode)
+	}
+
 	// check invoice passed is valid
 	request := meltQuoteRequest.Request
 	bolt11, err := decodepay.Decodepay(request)
@@ -512,33 +832,45 @@ func (m *Mint) RequestMeltQuote(meltQuoteRequest nut05.PostMeltQuoteBolt11Reques
 	if bolt11.MSatoshi == 0 {
 		return storage.MeltQuote{}, cashu.BuildCashuError("invoice has no amount", cashu.MeltQuoteErrCode)
 	}
-	invoiceSatAmount := uint64(bolt11.MSatoshi) / 1000
-	quoteAmount := invoiceSatAmount
+	invoiceAmountMsat := uint64(bolt11.MSatoshi)
+	quoteAmountMsat := invoiceAmountMsat
 
 	// check mpp option
-	if len(meltQuoteRequest.Options) > 0 {
-		mpp, ok := meltQuoteRequest.Options["mpp"]
-		if ok {
-			if m.mppEnabled {
-				// check mpp amount is less than invoice amount
-				if mpp.Amount >= invoiceSatAmount {
-					return storage.MeltQuote{},
-						cashu.BuildCashuError("mpp amount is not less than amount in invoice",
-							cashu.MeltQuoteErrCode)
-				}
-				quoteAmount = mpp.Amount
-				m.logInfof("got melt quote request to pay partial amount '%v' of invoice with amount '%v'",
-					quoteAmount, invoiceSatAmount)
-			} else {
+	if options != nil && options.Mpp != nil {
+		if !m.mppEnabled {
+			return storage.MeltQuote{},
+				cashu.BuildCashuError("MPP is not supported", cashu.MeltQuoteErrCode)
+		}
+		// mpp amount is in the unit of the quote
+		mppAmountMsat, err := m.unitToMsat(meltQuoteRequest.Unit, options.Mpp.Amount)
+		if err != nil {
+			if errors.Is(err, cashu.ErrAmountOverflow) {
 				return storage.MeltQuote{},
-					cashu.BuildCashuError("MPP is not supported", cashu.MeltQuoteErrCode)
+					cashu.BuildCashuError("mpp amount is not less than amount in invoice",
+						cashu.MeltQuoteErrCode)
 			}
+			return storage.MeltQuote{}, err
 		}
+		// check mpp amount is less than invoice amount
+		if mppAmountMsat >= invoiceAmountMsat {
+			return storage.MeltQuote{},
+				cashu.BuildCashuError("mpp amount is not less than amount in invoice",
+					cashu.MeltQuoteErrCode)
+		}
+		quoteAmountMsat = mppAmountMsat
+		m.logInfoContextf(ctx, "got melt quote request to pay partial amount '%v' msat of invoice with amount '%v' msat",
+			quoteAmountMsat, invoiceAmountMsat)
+	}
+	// amounts in the invoice that are not whole sats are rounded up
+	// so the inputs cover what the mint pays
+	quoteAmount, err := m.msatToUnit(meltQuoteRequest.Unit, quoteAmountMsat)
+	if err != nil {
+		return storage.MeltQuote{}, err
 	}
 
-	// check melt limit
-	if m.limits.MeltingSettings.MaxAmount > 0 {
-		if quoteAmount > m.limits.MeltingSettings.MaxAmount {
+	// check melt limit. The limit is in sats
+	if maxAmount := m.currentLimits().MeltingSettings.MaxAmount; maxAmount > 0 {
+		if msatToSat(quoteAmountMsat) > maxAmount {
 			return storage.MeltQuote{}, cashu.MeltAmountExceededErr
 		}
 	}
@@ -551,19 +883,26 @@ func (m *Mint) RequestMeltQuote(meltQuoteRequest nut05.PostMeltQuoteBolt11Reques
 
 	quoteId, err := cashu.GenerateRandomQuoteId()
 	if err != nil {
-		m.logErrorf("error generating random quote id: %v", err)
+		m.logErrorContextf(ctx, "error generating random quote id: %v", err)
 		return storage.MeltQuote{}, cashu.StandardErr
 	}
 	// Fee reserve that is required by the mint
-	fee := m.lightningClient.FeeReserve(quoteAmount)
+	feeMsat := m.lightningClient.FeeReserve(quoteAmountMsat)
+	feeReserve, err := m.msatToUnit(meltQuoteRequest.Unit, feeMsat)
+	if err != nil {
+		return storage.MeltQuote{}, err
+	}
 	meltQuote := storage.MeltQuote{
 		Id:             quoteId,
 		InvoiceRequest: request,
 		PaymentHash:    bolt11.PaymentHash,
 		Amount:         quoteAmount,
-		FeeReserve:     fee,
+		FeeReserve:     feeReserve,
+		AmountMsat:     quoteAmountMsat,
+		FeeReserveMsat: feeMsat,
 		State:          nut05.Unpaid,
 		Expiry:         uint64(time.Now().Add(time.Minute * QuoteExpiryMins).Unix()),
+		Unit:           meltQuoteRequest.Unit,
 	}
 
 	// check if a mint quote exists with the same invoice.
@@ -571,16 +910,19 @@ func (m *Mint) RequestMeltQuote(meltQuoteRequest nut05.PostMeltQuoteBolt11Reques
 	// settled internally so set the fee to 0
 	mintQuote, err := m.db.GetMintQuoteByPaymentHash(bolt11.PaymentHash)
 	if err == nil {
-		m.logDebugf(`in melt quote request found mint quote with same invoice. 
-		Setting fee reserve to 0 because quotes can be settled internally.`)
+		m.logDebugContextf(ctx, "in melt quote request found mint quote with same invoice. Quotes can be settled internally")
 
 		meltQuote.InvoiceRequest = mintQuote.PaymentRequest
 		meltQuote.PaymentHash = mintQuote.PaymentHash
-		meltQuote.FeeReserve = 0
+		// if hidden, the fee reserve is kept and returned as change
+		if !m.hideInternalSettlement {
+			meltQuote.FeeReserve = 0
+			meltQuote.FeeReserveMsat = 0
+		}
 	}
 
-	m.logInfof("got melt quote request for invoice of amount '%v'. Setting fee reserve to %v",
-		invoiceSatAmount, meltQuote.FeeReserve)
+	m.logInfoContextf(ctx, "got melt quote request for invoice of amount '%v' msat. Setting fee reserve to %v msat",
+		invoiceAmountMsat, meltQuote.FeeReserveMsat)
 
 	if err := m.db.SaveMeltQuote(meltQuote); err != nil {
 		errmsg := fmt.Sprintf("error saving melt quote to db: %v", err)
@@ -590,6 +932,88 @@ func (m *Mint) RequestMeltQuote(meltQuoteRequest nut05.PostMeltQuoteBolt11Reques
 	return meltQuote, nil
 }
 
+// RequoteMelt replaces an unpaid melt quote with a new quote for the same payment
+// with a higher fee reserve, i.e after the payment failed because the routing fees
+// were more than the reserve. The new reserve is the one from the backend but at
+// least double the previous one. The old quote is superseded by the new one in the
+// same db transaction and can't be melted anymore.
+func (m *Mint) RequoteMelt(ctx context.Context, quoteId string) (storage.MeltQuote, error) {
+	// hold the lock so the old quote can't be set as pending while it is replaced
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	oldQuote, err := m.db.GetMeltQuote(quoteId)
+	if err != nil {
+		return storage.MeltQuote{}, cashu.QuoteNotExistErr
+	}
+	if len(oldQuote.SupersededBy) > 0 {
+		return storage.MeltQuote{}, cashu.MeltQuoteSuperseded
+	}
+	if oldQuote.State == nut05.Paid {
+		return storage.MeltQuote{}, cashu.MeltQuoteAlreadyPaid
+	}
+	if oldQuote.State == nut05.Pending {
+		return storage.MeltQuote{}, cashu.QuotePending
+	}
+	if _, err := m.db.GetMintQuoteByPaymentHash(oldQuote.PaymentHash); err == nil {
+		return storage.MeltQuote{}, cashu.BuildCashuError(
+			"melt quote is settled internally without routing fees", cashu.MeltQuoteErrCode)
+	}
+
+	newQuoteId, err := cashu.GenerateRandomQuoteId()
+	if err != nil {
+		m.logErrorContextf(ctx, "error generating random quote id: %v", err)
+		return storage.MeltQuote{}, cashu.StandardErr
+	}
+	// the reserve is increased by at least 1 sat so that it
+	// also goes up if the previous one was 0
+	feeMsat := max(
+		m.lightningClient.FeeReserve(oldQuote.AmountMsat),
+		oldQuote.FeeReserveMsat*2,
+		oldQuote.FeeReserveMsat+1000,
+	)
+	// the amount keeps the price of the old quote and
+	// only the reserve is at the current price for fiat units
+	feeReserve, err := m.msatToUnit(oldQuote.Unit, feeMsat)
+	if err != nil {
+		return storage.MeltQuote{}, err
+	}
+	meltQuote := storage.MeltQuote{
+		Id:             newQuoteId,
+		InvoiceRequest: oldQuote.InvoiceRequest,
+		PaymentHash:    oldQuote.PaymentHash,
+		Amount:         oldQuote.Amount,
+		FeeReserve:     feeReserve,
+		AmountMsat:     oldQuote.AmountMsat,
+		FeeReserveMsat: feeMsat,
+		State:          nut05.Unpaid,
+		Expiry:         uint64(time.Now().Add(time.Minute * QuoteExpiryMins).Unix()),
+		Unit:           oldQuote.Unit,
+	}
+
+	if err := m.db.ReplaceMeltQuote(oldQuote.Id, meltQuote); err != nil {
+		errmsg := fmt.Sprintf("error replacing melt quote in db: %v", err)
+		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+	}
+	m.logInfoContextf(ctx, "melt quote '%v' superseded by quote '%v'. Fee reserve increased from %v msat to %v msat",
+		oldQuote.Id, meltQuote.Id, oldQuote.FeeReserveMsat, meltQuote.FeeReserveMsat)
+
+	return meltQuote, nil
+}
+
+// GetMeltQuoteByPaymentHash returns the state of the melt quote for the invoice
+// with the payment hash. Only the full payment hash is accepted.
+func (m *Mint) GetMeltQuoteByPaymentHash(ctx context.Context, paymentHash string) (storage.MeltQuote, error) {
+	if !validPaymentHash(paymentHash) {
+		return storage.MeltQuote{}, cashu.InvalidPaymentHashErr
+	}
+	meltQuote, err := m.db.GetMeltQuoteByPaymentHash(paymentHash)
+	if err != nil {
+		return storage.MeltQuote{}, cashu.QuoteNotExistErr
+	}
+	return m.GetMeltQuoteState(ctx, meltQuote.Id)
+}
+
 // GetMeltQuoteState returns the state of a melt quote.
 // Used to check whether a melt quote has been paid.
 func (m *Mint) GetMeltQuoteState(ctx context.Context, quoteId string) (storage.MeltQuote, error) {
@@ -599,13 +1023,14 @@ func (m *Mint) GetMeltQuoteState(ctx context.Context, quoteId string) (storage.M
 	}
 
 	// if quote is pending, check with backend if status of payment has changed
-	if meltQuote.State == nut05.Pending {
-		m.logDebugf("checking status of payment with hash '%v' for melt quote '%v'",
+	wasPending := meltQuote.State == nut05.Pending
+	if wasPending {
+		m.logDebugContextf(ctx, "checking status of payment with hash '%v' for melt quote '%v'",
 			meltQuote.PaymentHash, meltQuote.Id)
 
 		paymentStatus, err := m.lightningClient.OutgoingPaymentStatus(ctx, meltQuote.PaymentHash)
 		if err != nil {
-			m.logErrorf(`error checking outgoing payment status: %v. Leaving proofs for quote '%v' as pending`,
+			m.logErrorContextf(ctx, `error checking outgoing payment status: %v. Leaving proofs for quote '%v' as pending`,
 				err, meltQuote.Id)
 			return meltQuote, nil
 		}
@@ -614,7 +1039,7 @@ func (m *Mint) GetMeltQuoteState(ctx context.Context, quoteId string) (storage.M
 		// settle proofs (remove pending, and add to used)
 		// mark quote as paid and set preimage
 		case lightning.Succeeded:
-			m.logInfof("payment %v succeded. setting melt quote '%v' to paid and invalidating proofs",
+			m.logInfoContextf(ctx, "payment %v succeded. setting melt quote '%v' to paid and invalidating proofs",
 				meltQuote.PaymentHash, meltQuote.Id)
 
 			proofs, err := m.removePendingProofsForQuote(meltQuote.Id)
@@ -627,6 +1052,9 @@ func (m *Mint) GetMeltQuoteState(ctx context.Context, quoteId string) (storage.M
 				errmsg := fmt.Sprintf("error invalidating proofs. Could not save proofs to db: %v", err)
 				return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 			}
+			m.recordFees(ctx, proofs)
+			m.publishProofStates(proofs, nut07.Spent)
+			m.signMeltChange(ctx, meltQuote, proofs, paymentStatus.FeeMsat)
 
 			meltQuote.State = nut05.Paid
 			meltQuote.Preimage = paymentStatus.Preimage
@@ -637,7 +1065,7 @@ func (m *Mint) GetMeltQuoteState(ctx context.Context, quoteId string) (storage.M
 			}
 
 		case lightning.Failed:
-			m.logInfof("payment %v failed with error: %v. Setting melt quote '%v' to unpaid and removing proofs from pending",
+			m.logInfoContextf(ctx, "payment %v failed with error: %v. Setting melt quote '%v' to unpaid and removing proofs from pending",
 				meltQuote.PaymentHash, paymentStatus.PaymentFailureReason, meltQuote.Id)
 
 			meltQuote.State = nut05.Unpaid
@@ -647,14 +1075,28 @@ func (m *Mint) GetMeltQuoteState(ctx context.Context, quoteId string) (storage.M
 				return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 			}
 
-			_, err = m.removePendingProofsForQuote(meltQuote.Id)
+			proofs, err := m.removePendingProofsForQuote(meltQuote.Id)
 			if err != nil {
 				errmsg := fmt.Sprintf("error removing pending proofs for quote: %v", err)
 				return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 			}
+			m.publishProofStates(proofs, nut07.Unspent)
 		}
 	}
 
+	// change is returned for paid quotes so wallets that did not
+	// get the response to the melt request can still get it
+	if meltQuote.State == nut05.Paid {
+		meltQuote.Change, err = m.meltChange(meltQuote.Id)
+		if err != nil {
+			errmsg := fmt.Sprintf("error getting change for melt quote: %v", err)
+			return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+		}
+	}
+	if wasPending && meltQuote.State != nut05.Pending {
+		m.publishMeltQuote(meltQuote)
+	}
+
 	return meltQuote, nil
 }
 
@@ -692,64 +1134,43 @@ func (m *Mint) removePendingProofsForQuote(quoteId string) (cashu.Proofs, error)
 func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltBolt11Request) (storage.MeltQuote, error) {
 	proofs := meltTokensRequest.Inputs
 
-	var proofsAmount uint64
-	Ys := make([]string, len(proofs))
-	for i, proof := range proofs {
-		proofsAmount += proof.Amount
-
-		Y, err := crypto.HashToCurve([]byte(proof.Secret))
-		if err != nil {
-			return storage.MeltQuote{}, cashu.InvalidProofErr
-		}
-		Yhex := hex.EncodeToString(Y.SerializeCompressed())
-		Ys[i] = Yhex
-	}
-
-	meltQuote, err := m.db.GetMeltQuote(meltTokensRequest.Quote)
+	proofsAmount, err := proofs.CheckedAmount()
 	if err != nil {
-		return storage.MeltQuote{}, cashu.QuoteNotExistErr
+		return storage.MeltQuote{}, cashu.InvalidProofErr
 	}
-	if meltQuote.State == nut05.Paid {
-		return storage.MeltQuote{}, cashu.MeltQuoteAlreadyPaid
+	Ys, err := crypto.ProofsYs(proofs)
+	if err != nil {
+		return storage.MeltQuote{}, cashu.InvalidProofErr
 	}
-	if meltQuote.State == nut05.Pending {
-		return storage.MeltQuote{}, cashu.QuotePending
+	if meltTokensRequest.Outputs.HasDuplicates() {
+		return storage.MeltQuote{}, cashu.DuplicateOutputs
 	}
 
-	err = m.verifyProofs(proofs, Ys)
+	quote, err := m.db.GetMeltQuote(meltTokensRequest.Quote)
 	if err != nil {
-		return storage.MeltQuote{}, err
+		return storage.MeltQuote{}, cashu.QuoteNotExistErr
 	}
-
-	fees := m.TransactionFees(proofs)
-	// checks if amount in proofs is enough
-	if proofsAmount < meltQuote.Amount+meltQuote.FeeReserve+uint64(fees) {
-		return storage.MeltQuote{}, cashu.InsufficientProofsAmount
+	if err := m.verifyUnit(quoteUnit(quote.Unit), proofs, meltTokensRequest.Outputs); err != nil {
+		return storage.MeltQuote{}, err
 	}
-
-	if nut11.ProofsSigAll(proofs) {
-		return storage.MeltQuote{}, nut11.SigAllOnlySwap
+	// blank outputs for change can only be signed with an active keyset.
+	// Check before paying so the change could be returned for the payment
+	for _, output := range meltTokensRequest.Outputs {
+		if _, ok := m.getActiveKeysets()[output.Id]; !ok {
+			return storage.MeltQuote{}, cashu.InactiveKeysetSignatureRequest
+		}
 	}
 
-	m.logInfof("verified proofs in melt tokens request. Setting proofs as pending before attempting payment.")
-	// set proofs as pending before trying to make payment
-	err = m.db.AddPendingProofs(proofs, meltQuote.Id)
-	if err != nil {
-		errmsg := fmt.Sprintf("error setting proofs as pending in db: %v", err)
-		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
-	}
-	meltQuote.State = nut05.Pending
-	err = m.db.UpdateMeltQuote(meltQuote.Id, "", nut05.Pending)
+	meltQuote, err := m.setMeltPending(ctx, meltTokensRequest.Quote, proofs, proofsAmount, Ys, meltTokensRequest.Outputs)
 	if err != nil {
-		errmsg := fmt.Sprintf("error updating melt quote state: %v", err)
-		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+		return storage.MeltQuote{}, err
 	}
 
 	// before asking backend to send payment, check if quotes can be settled
 	// internally (i.e mint and melt quotes exist with the same invoice)
 	mintQuote, err := m.db.GetMintQuoteByPaymentHash(meltQuote.PaymentHash)
 	if err == nil {
-		m.logDebugf("quotes '%v' and '%v' have same invoice so settling them internally", meltQuote.Id, mintQuote.Id)
+		m.logDebugContextf(ctx, "quotes '%v' and '%v' have same invoice so settling them internally", meltQuote.Id, mintQuote.Id)
 		meltQuote, err = m.settleQuotesInternally(mintQuote, meltQuote)
 		if err != nil {
 			return storage.MeltQuote{}, err
@@ -764,45 +1185,58 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 			errmsg := fmt.Sprintf("error invalidating proofs. Could not save proofs to db: %v", err)
 			return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 		}
+		m.recordFees(ctx, proofs)
+		m.publishProofStates(proofs, nut07.Spent)
+		// no routing fees were paid when settling internally
+		meltQuote.Change = m.signMeltChange(ctx, meltQuote, proofs, 0)
+		m.publishMeltQuote(meltQuote)
 	} else {
-		m.logInfof("attempting to pay invoice: %v", meltQuote.InvoiceRequest)
-		// if quote can't be settled internally, ask backend to make payment
-		sendPaymentResponse, err := m.lightningClient.SendPayment(ctx, meltQuote.InvoiceRequest, meltQuote.Amount)
+		m.logInfoContextf(ctx, "attempting to pay invoice: %v", meltQuote.InvoiceRequest)
+		// if quote can't be settled internally, ask backend to make payment.
+		// Routing fees can't be more than the fee reserve the user paid for
+		sendPaymentResponse, err := m.lightningClient.SendPayment(
+			ctx,
+			meltQuote.InvoiceRequest,
+			meltQuote.AmountMsat,
+			meltQuote.FeeReserveMsat,
+		)
 		if err != nil {
 			// if SendPayment failed do not return yet, an extra check will be done
 			sendPaymentResponse.PaymentStatus = lightning.Failed
-			m.logDebugf("SendPayment failed with error: %v. Will do extra check", err)
+			m.logDebugContextf(ctx, "SendPayment failed with error: %v. Will do extra check", err)
 		}
 
 		switch sendPaymentResponse.PaymentStatus {
 		case lightning.Succeeded:
-			m.logInfof("succesfully paid invoice with hash '%v' for melt quote '%v'", meltQuote.PaymentHash, meltQuote.Id)
+			m.logInfoContextf(ctx, "succesfully paid invoice with hash '%v' for melt quote '%v'", meltQuote.PaymentHash, meltQuote.Id)
 			// if payment succeeded:
 			// - unset pending proofs and mark them as spent by adding them to the db
 			// - mark melt quote as paid
 			meltQuote.State = nut05.Paid
 			meltQuote.Preimage = sendPaymentResponse.Preimage
-			err = m.settleProofs(Ys, proofs)
+			err = m.settleProofs(ctx, Ys, proofs)
 			if err != nil {
 				return storage.MeltQuote{}, err
 			}
+			meltQuote.Change = m.signMeltChange(ctx, meltQuote, proofs, sendPaymentResponse.FeeMsat)
 			err = m.db.UpdateMeltQuote(meltQuote.Id, sendPaymentResponse.Preimage, nut05.Paid)
 			if err != nil {
 				errmsg := fmt.Sprintf("error updating melt quote state: %v", err)
 				return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 			}
+			m.publishMeltQuote(meltQuote)
 
 		case lightning.Pending:
 			// if payment is pending, leave quote and proofs as pending and return
-			m.logInfof("outgoing payment for quote '%v' is pending.", meltQuote.Id)
+			m.logInfoContextf(ctx, "outgoing payment for quote '%v' is pending.", meltQuote.Id)
 			return meltQuote, nil
 
 		case lightning.Failed:
 			// if got failed from SendPayment
 			// do additional check by calling to get outgoing payment status
 			paymentStatus, err := m.lightningClient.OutgoingPaymentStatus(ctx, meltQuote.PaymentHash)
-			if status.Code(err) == codes.NotFound {
-				m.logInfof("no outgoing payment found with hash: %v. Removing pending proofs and marking quote '%v' as unpaid",
+			if errors.Is(err, lightning.ErrPaymentNotFound) {
+				m.logInfoContextf(ctx, "no outgoing payment found with hash: %v. Removing pending proofs and marking quote '%v' as unpaid",
 					meltQuote.PaymentHash, meltQuote.Id)
 
 				meltQuote.State = nut05.Unpaid
@@ -816,10 +1250,12 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 					errmsg := fmt.Sprintf("error removing proofs from pending: %v", err)
 					return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 				}
+				m.publishYStates(Ys, nut07.Unspent)
+				m.publishMeltQuote(meltQuote)
 				return meltQuote, nil
 			}
 			if err != nil {
-				m.logErrorf(`error checking outgoing payment status: %v. Leaving proofs for quote '%v' as pending`, err, meltQuote.Id)
+				m.logErrorContextf(ctx, `error checking outgoing payment status: %v. Leaving proofs for quote '%v' as pending`, err, meltQuote.Id)
 				return meltQuote, nil
 			}
 
@@ -828,7 +1264,7 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 			// returned a nil err (meaning it was actually able to check the status)
 			// and payment status was failed
 			case lightning.Failed:
-				m.logInfof("payment failed with error: %v. Removing pending proofs and marking quote '%v' as unpaid",
+				m.logInfoContextf(ctx, "payment failed with error: %v. Removing pending proofs and marking quote '%v' as unpaid",
 					paymentStatus.PaymentFailureReason, meltQuote.Id)
 
 				meltQuote.State = nut05.Unpaid
@@ -842,13 +1278,16 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 					errmsg := fmt.Sprintf("error removing proofs from pending: %v", err)
 					return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 				}
+				m.publishYStates(Ys, nut07.Unspent)
+				m.publishMeltQuote(meltQuote)
 				return meltQuote, nil
 			case lightning.Succeeded:
-				m.logInfof("succesfully paid invoice with hash '%v' for melt quote '%v'", meltQuote.PaymentHash, meltQuote.Id)
-				err = m.settleProofs(Ys, proofs)
+				m.logInfoContextf(ctx, "succesfully paid invoice with hash '%v' for melt quote '%v'", meltQuote.PaymentHash, meltQuote.Id)
+				err = m.settleProofs(ctx, Ys, proofs)
 				if err != nil {
 					return storage.MeltQuote{}, err
 				}
+				meltQuote.Change = m.signMeltChange(ctx, meltQuote, proofs, paymentStatus.FeeMsat)
 				meltQuote.State = nut05.Paid
 				meltQuote.Preimage = paymentStatus.Preimage
 				err = m.db.UpdateMeltQuote(meltQuote.Id, paymentStatus.Preimage, nut05.Paid)
@@ -856,6 +1295,7 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 					errmsg := fmt.Sprintf("error updating melt quote state: %v", err)
 					return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 				}
+				m.publishMeltQuote(meltQuote)
 			}
 		}
 	}
@@ -863,6 +1303,71 @@ func (m *Mint) MeltTokens(ctx context.Context, meltTokensRequest nut05.PostMeltB
 	return meltQuote, nil
 }
 
+// setMeltPending verifies the proofs for the melt quote and sets
+// both the proofs and the quote as pending before attempting payment.
+func (m *Mint) setMeltPending(
+	ctx context.Context,
+	quoteId string,
+	proofs cashu.Proofs,
+	proofsAmount uint64,
+	Ys []string,
+	changeOutputs cashu.BlindedMessages,
+) (storage.MeltQuote, error) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	meltQuote, err := m.db.GetMeltQuote(quoteId)
+	if err != nil {
+		return storage.MeltQuote{}, cashu.QuoteNotExistErr
+	}
+	if meltQuote.State == nut05.Paid {
+		return storage.MeltQuote{}, cashu.MeltQuoteAlreadyPaid
+	}
+	if meltQuote.State == nut05.Pending {
+		return storage.MeltQuote{}, cashu.QuotePending
+	}
+	if len(meltQuote.SupersededBy) > 0 {
+		return storage.MeltQuote{}, cashu.MeltQuoteSuperseded
+	}
+
+	err = m.verifyProofs(ctx, proofs, Ys)
+	if err != nil {
+		return storage.MeltQuote{}, err
+	}
+	syncPoint(syncMeltProofsVerified)
+
+	fees := m.TransactionFees(proofs)
+	// checks if amount in proofs is enough
+	if !inputsCover(proofsAmount, meltQuote.Amount, meltQuote.FeeReserve, uint64(fees)) {
+		return storage.MeltQuote{}, cashu.InsufficientProofsAmount
+	}
+
+	if nut11.ProofsSigAll(proofs) {
+		return storage.MeltQuote{}, nut11.SigAllOnlySwap
+	}
+	if err := m.saveMeltChangeOutputs(meltQuote.Id, changeOutputs); err != nil {
+		return storage.MeltQuote{}, err
+	}
+
+	m.logInfoContextf(ctx, "verified proofs in melt tokens request. Setting proofs as pending before attempting payment.")
+	// set proofs as pending before trying to make payment
+	err = m.db.AddPendingProofs(proofs, meltQuote.Id)
+	if err != nil {
+		errmsg := fmt.Sprintf("error setting proofs as pending in db: %v", err)
+		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+	}
+	m.publishProofStates(proofs, nut07.Pending)
+	meltQuote.State = nut05.Pending
+	err = m.db.UpdateMeltQuote(meltQuote.Id, "", nut05.Pending)
+	if err != nil {
+		errmsg := fmt.Sprintf("error updating melt quote state: %v", err)
+		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
+	}
+	m.publishMeltQuote(meltQuote)
+
+	return meltQuote, nil
+}
+
 // if a pair of mint and melt quotes have the same invoice,
 // settle them internally and update in db
 func (m *Mint) settleQuotesInternally(
@@ -891,13 +1396,15 @@ func (m *Mint) settleQuotesInternally(
 		errmsg := fmt.Sprintf("error updating mint quote state: %v", err)
 		return storage.MeltQuote{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 	}
+	m.publishMintQuote(mintQuote)
 
 	return meltQuote, nil
 }
 
 // settleProofs will remove the proofs from the pending table
-// and mark them as spent by adding them to the used proofs table
-func (m *Mint) settleProofs(Ys []string, proofs cashu.Proofs) error {
+// and mark them as spent by adding them to the used proofs table.
+// It also records the fees paid by the proofs.
+func (m *Mint) settleProofs(ctx context.Context, Ys []string, proofs cashu.Proofs) error {
 	err := m.db.RemovePendingProofs(Ys)
 	if err != nil {
 		errmsg := fmt.Sprintf("error removing pending proofs: %v", err)
@@ -908,11 +1415,35 @@ func (m *Mint) settleProofs(Ys []string, proofs cashu.Proofs) error {
 		errmsg := fmt.Sprintf("error invalidating proofs. Could not save proofs to db: %v", err)
 		return cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 	}
+	m.recordFees(ctx, proofs)
+	m.publishProofStates(proofs, nut07.Spent)
 
 	return nil
 }
 
 func (m *Mint) ProofsStateCheck(Ys []string) ([]nut07.ProofState, error) {
+	return m.proofsStateCheck(context.Background(), Ys)
+}
+
+// CheckStateResponse returns the response for the proof states. If signing proof
+// states is enabled, the states are signed with the timestamp of the response.
+func (m *Mint) CheckStateResponse(states []nut07.ProofState) (nut07.PostCheckStateResponse, error) {
+	response := nut07.PostCheckStateResponse{States: states}
+	if m.stateKey == nil {
+		return response, nil
+	}
+
+	response.Timestamp = time.Now().Unix()
+	signature, err := nut07.SignStates(states, response.Timestamp, m.stateKey)
+	if err != nil {
+		errmsg := fmt.Sprintf("could not sign proof states: %v", err)
+		return nut07.PostCheckStateResponse{}, cashu.BuildCashuError(errmsg, cashu.StandardErrCode)
+	}
+	response.Signature = signature
+	return response, nil
+}
+
+func (m *Mint) proofsStateCheck(ctx context.Context, Ys []string) ([]nut07.ProofState, error) {
 	// status of proofs that are pending due to an in-flight lightning payment
 	// could have changed so need to check with the lightning backend the status
 	// of the payment
@@ -929,10 +1460,10 @@ func (m *Mint) ProofsStateCheck(Ys []string) ([]nut07.ProofState, error) {
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*2)
 	defer cancel()
 
-	m.logDebugf("checking if status of pending proofs has changed")
+	m.logDebugContextf(ctx, "checking if status of pending proofs has changed")
 	for quoteId := range pendingQuotes {
 		// GetMeltQuoteState will check the status of the quote
 		// and update the db tables (pending proofs, used proofs) appropriately
@@ -987,15 +1518,28 @@ func (m *Mint) RestoreSignatures(blindedMessages cashu.BlindedMessages) (cashu.B
 	outputs := make(cashu.BlindedMessages, 0, len(blindedMessages))
 	signatures := make(cashu.BlindedSignatures, 0, len(blindedMessages))
 
+	// lookup the signatures among the ones of the keyset of the outputs
+	B_sByKeyset := make(map[string][]string)
 	for _, bm := range blindedMessages {
-		sig, err := m.db.GetBlindSignature(bm.B_)
-		if errors.Is(err, sql.ErrNoRows) {
-			continue
-		} else if err != nil {
-			errmsg := fmt.Sprintf("could not get signature from db: %v", err)
+		B_sByKeyset[bm.Id] = append(B_sByKeyset[bm.Id], bm.B_)
+	}
+	signed := make(map[string]cashu.BlindedSignature, len(blindedMessages))
+	for keysetId, B_s := range B_sByKeyset {
+		sigs, err := m.db.GetBlindSignaturesByKeyset(keysetId, B_s)
+		if err != nil {
+			errmsg := fmt.Sprintf("could not get signatures from db: %v", err)
 			return nil, nil, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 		}
+		for B_, sig := range sigs {
+			signed[B_] = sig
+		}
+	}
 
+	for _, bm := range blindedMessages {
+		sig, ok := signed[bm.B_]
+		if !ok {
+			continue
+		}
 		outputs = append(outputs, bm)
 		signatures = append(signatures, sig)
 	}
@@ -1003,7 +1547,7 @@ func (m *Mint) RestoreSignatures(blindedMessages cashu.BlindedMessages) (cashu.B
 	return outputs, signatures, nil
 }
 
-func (m *Mint) verifyProofs(proofs cashu.Proofs, Ys []string) error {
+func (m *Mint) verifyProofs(ctx context.Context, proofs cashu.Proofs, Ys []string) error {
 	if len(proofs) == 0 {
 		return cashu.NoProofsProvided
 	}
@@ -1020,6 +1564,8 @@ func (m *Mint) verifyProofs(proofs cashu.Proofs, Ys []string) error {
 		return cashu.ProofPendingErr
 	}
 
+	// not looked up by keyset since a Y can only be spent once
+	// even if the secret was signed by more than one keyset
 	usedProofs, err := m.db.GetProofsUsed(Ys)
 	if err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
@@ -1032,7 +1578,7 @@ func (m *Mint) verifyProofs(proofs cashu.Proofs, Ys []string) error {
 	}
 
 	// check duplicte proofs
-	if cashu.CheckDuplicateProofs(proofs) {
+	if proofs.HasDuplicates() {
 		return cashu.DuplicateProofs
 	}
 
@@ -1040,8 +1586,11 @@ func (m *Mint) verifyProofs(proofs cashu.Proofs, Ys []string) error {
 		// check that id in the proof matches id of any
 		// of the mint's keyset
 		var k *secp256k1.PrivateKey
-		if keyset, ok := m.keysets[proof.Id]; !ok {
-			return cashu.UnknownKeysetErr
+		if keyset, ok, err := m.keysetWithKeys(proof.Id); err != nil {
+			m.logErrorf("could not derive keys of keyset '%v': %v", proof.Id, err)
+			return cashu.StandardErr
+		} else if !ok {
+			return m.unknownKeysetErr(proof.Id)
 		} else {
 			if key, ok := keyset.Keys[proof.Amount]; ok {
 				k = key.PrivateKey
@@ -1053,16 +1602,24 @@ func (m *Mint) verifyProofs(proofs cashu.Proofs, Ys []string) error {
 		// if P2PK locked proof, verify valid witness
 		nut10Secret, err := nut10.DeserializeSecret(proof.Secret)
 		if err == nil {
+			if err := m.witnessLimits.checkSize(proof.Witness); err != nil {
+				return err
+			}
 			if nut10Secret.Kind == nut10.P2PK {
-				if err := verifyP2PKLockedProof(proof, nut10Secret); err != nil {
+				if err := verifyP2PKLockedProof(proof, nut10Secret, m.witnessLimits); err != nil {
 					return err
 				}
-				m.logDebugf("verified P2PK locked proof")
+				m.logDebugContextf(ctx, "verified P2PK locked proof")
 			} else if nut10Secret.Kind == nut10.HTLC {
-				if err := verifyHTLCProof(proof, nut10Secret); err != nil {
+				if err := verifyHTLCProof(proof, nut10Secret, m.witnessLimits); err != nil {
+					return err
+				}
+				m.logDebugContextf(ctx, "verified HTLC proof")
+			} else if nut10.IsCustomKind(nut10Secret.Kind) {
+				if err := m.verifyCustomCondition(proof, nut10Secret); err != nil {
 					return err
 				}
-				m.logDebugf("verified HTLC proof")
+				m.logDebugContextf(ctx, "verified proof of kind '%v'", nut10Secret.Kind)
 			}
 		}
 
@@ -1084,9 +1641,12 @@ func (m *Mint) verifyProofs(proofs cashu.Proofs, Ys []string) error {
 	return nil
 }
 
-func verifyP2PKLockedProof(proof cashu.Proof, proofSecret nut10.WellKnownSecret) error {
+func verifyP2PKLockedProof(proof cashu.Proof, proofSecret nut10.WellKnownSecret, limits witnessLimits) error {
 	var p2pkWitness nut11.P2PKWitness
 	json.Unmarshal([]byte(proof.Witness), &p2pkWitness)
+	if err := limits.checkSignatures(p2pkWitness.Signatures); err != nil {
+		return err
+	}
 
 	p2pkTags, err := nut11.ParseP2PKTags(proofSecret.Data.Tags)
 	if err != nil {
@@ -1140,9 +1700,12 @@ func verifyP2PKLockedProof(proof cashu.Proof, proofSecret nut10.WellKnownSecret)
 	return nil
 }
 
-func verifyHTLCProof(proof cashu.Proof, proofSecret nut10.WellKnownSecret) error {
+func verifyHTLCProof(proof cashu.Proof, proofSecret nut10.WellKnownSecret, limits witnessLimits) error {
 	var htlcWitness nut14.HTLCWitness
 	json.Unmarshal([]byte(proof.Witness), &htlcWitness)
+	if err := limits.checkSignatures(htlcWitness.Signatures); err != nil {
+		return err
+	}
 
 	p2pkTags, err := nut11.ParseP2PKTags(proofSecret.Data.Tags)
 	if err != nil {
@@ -1203,7 +1766,7 @@ func verifyHTLCProof(proof cashu.Proof, proofSecret nut10.WellKnownSecret) error
 
 // verifyBlindedMessages used to verify blinded messages are signed when SIG_ALL flag
 // is present in either a P2PK or HTLC locked proofs
-func verifyBlindedMessages(proofs cashu.Proofs, blindedMessages cashu.BlindedMessages) error {
+func verifyBlindedMessages(proofs cashu.Proofs, blindedMessages cashu.BlindedMessages, limits witnessLimits) error {
 	secret, err := nut10.DeserializeSecret(proofs[0].Secret)
 	if err != nil {
 		return cashu.BuildCashuError(err.Error(), cashu.StandardErrCode)
@@ -1261,12 +1824,18 @@ func verifyBlindedMessages(proofs cashu.Proofs, blindedMessages cashu.BlindedMes
 		}
 	}
 
-	for _, bm := range blindedMessages {
+	// signatures of all the outputs are checked together at the end
+	hashes := make([][]byte, len(blindedMessages))
+	outputSignatures := make([][]string, len(blindedMessages))
+	for i, bm := range blindedMessages {
 		B_bytes, err := hex.DecodeString(bm.B_)
 		if err != nil {
 			return cashu.BuildCashuError(err.Error(), cashu.StandardErrCode)
 		}
 		hash := sha256.Sum256(B_bytes)
+		if err := limits.checkSize(bm.Witness); err != nil {
+			return err
+		}
 
 		var signatures []string
 		switch secret.Kind {
@@ -1301,28 +1870,79 @@ func verifyBlindedMessages(proofs cashu.Proofs, blindedMessages cashu.BlindedMes
 			return nut11.InvalidKindErr
 		}
 
+		if err := limits.checkSignatures(signatures); err != nil {
+			return err
+		}
 		if nut11.DuplicateSignatures(signatures) {
 			return nut11.DuplicateSignaturesErr
 		}
-		if !nut11.HasValidSignatures(hash[:], signatures, signaturesRequired, pubkeys) {
-			return nut11.NotEnoughSignaturesErr
-		}
+		hashes[i] = hash[:]
+		outputSignatures[i] = signatures
 	}
 
+	if !nut11.HasValidSignaturesForAll(hashes, outputSignatures, signaturesRequired, pubkeys) {
+		return nut11.NotEnoughSignaturesErr
+	}
 	return nil
 }
 
 // signBlindedMessages will sign the blindedMessages and
 // return the blindedSignatures
+// verifyUnit checks that the inputs and outputs are all from keysets of the same unit.
+// If unit is empty, they need to match the unit of the first input or output.
+func (m *Mint) verifyUnit(unit string, proofs cashu.Proofs, blindedMessages cashu.BlindedMessages) error {
+	keysetIds := make([]string, 0, len(proofs)+len(blindedMessages))
+	for _, proof := range proofs {
+		keysetIds = append(keysetIds, proof.Id)
+	}
+	for _, msg := range blindedMessages {
+		keysetIds = append(keysetIds, msg.Id)
+	}
+
+	for _, id := range keysetIds {
+		keyset, ok := m.getKeysets()[id]
+		if !ok {
+			return m.unknownKeysetErr(id)
+		}
+		if len(unit) == 0 {
+			unit = keyset.Unit
+		}
+		if keyset.Unit != unit {
+			return cashu.UnitMismatchErr
+		}
+	}
+	return nil
+}
+
+// unknownKeysetErr returns the error for a keyset that is not loaded in the mint.
+// A keyset rotated in by another instance sharing the db is saved there
+// but only loaded on restart, so it is reported as not active yet
+// instead of unknown to let wallets know they can retry later.
+func (m *Mint) unknownKeysetErr(id string) error {
+	dbKeysets, err := m.db.GetKeysets()
+	if err != nil {
+		m.logErrorf("could not get keysets from db: %v", err)
+		return cashu.UnknownKeysetErr
+	}
+	for _, keyset := range dbKeysets {
+		if keyset.Id == id {
+			m.logInfof("got request with keyset '%v' that is not active yet in this mint", id)
+			return cashu.KeysetNotActiveYetErr
+		}
+	}
+	return cashu.UnknownKeysetErr
+}
+
 func (m *Mint) signBlindedMessages(blindedMessages cashu.BlindedMessages) (cashu.BlindedSignatures, error) {
 	blindedSignatures := make(cashu.BlindedSignatures, len(blindedMessages))
 
+	keysets, activeKeysets := m.getKeysets(), m.getActiveKeysets()
 	for i, msg := range blindedMessages {
-		if _, ok := m.keysets[msg.Id]; !ok {
-			return nil, cashu.UnknownKeysetErr
+		if _, ok := keysets[msg.Id]; !ok {
+			return nil, m.unknownKeysetErr(msg.Id)
 		}
 		var k *secp256k1.PrivateKey
-		keyset, ok := m.activeKeysets[msg.Id]
+		keyset, ok := activeKeysets[msg.Id]
 		if !ok {
 			return nil, cashu.InactiveKeysetSignatureRequest
 		} else {
@@ -1372,8 +1992,18 @@ func (m *Mint) signBlindedMessages(blindedMessages cashu.BlindedMessages) (cashu
 
 // requestInvoice requests an invoice from the Lightning backend
 // for the given amount
-func (m *Mint) requestInvoice(amount uint64) (*lightning.Invoice, error) {
-	invoice, err := m.lightningClient.CreateInvoice(amount)
+func (m *Mint) requestInvoice(amount uint64, description string) (*lightning.Invoice, error) {
+	opts := m.invoiceOptions
+	opts.Description = description
+	if ampClient, ok := m.lightningClient.(lightning.AMPClient); ok && m.ampEnabled {
+		invoice, err := ampClient.CreateAMPInvoice(amount, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &invoice, nil
+	}
+
+	invoice, err := m.lightningClient.CreateInvoice(amount, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -1382,32 +2012,109 @@ func (m *Mint) requestInvoice(amount uint64) (*lightning.Invoice, error) {
 
 func (m *Mint) TransactionFees(inputs cashu.Proofs) uint {
 	var fees uint = 0
+	keysets := m.getKeysets()
 	for _, proof := range inputs {
 		// note: not checking that proof id is from valid keyset
 		// because already doing that in call to verifyProofs
-		fees += m.keysets[proof.Id].InputFeePpk
+		fees += keysets[proof.Id].InputFeePpk
 	}
 	return (fees + 999) / 1000
 }
 
+// unitSupported returns true if quotes can be requested in the unit
+func (m *Mint) unitSupported(unit string) bool {
+	if unit == cashu.Sat.String() || (m.msatEnabled && unit == cashu.Msat.String()) {
+		return true
+	}
+	return slices.ContainsFunc(m.fiatUnits, func(fiatUnit cashu.Unit) bool {
+		return fiatUnit.String() == unit
+	})
+}
+
+// quoteUnit returns the unit of a quote. Quotes without unit are in sat
+func quoteUnit(unit string) string {
+	if len(unit) == 0 {
+		return cashu.Sat.String()
+	}
+	return unit
+}
+
+// quoteMethod returns the payment method of a mint quote
+func quoteMethod(method string) string {
+	if len(method) == 0 {
+		return cashu.BOLT11_METHOD
+	}
+	return method
+}
+
+// quoteSatAmount returns the amount of a mint quote in sats
+func quoteSatAmount(mintQuote storage.MintQuote) uint64 {
+	switch quoteUnit(mintQuote.Unit) {
+	case cashu.Msat.String():
+		return mintQuote.Amount / 1000
+	case cashu.Sat.String():
+		return mintQuote.Amount
+	default:
+		// sats of the invoice at the price when the quote was created
+		return mintQuote.AmountMsat / 1000
+	}
+}
+
+// msatToSat converts the amount to sats rounding up
+func msatToSat(msat uint64) uint64 {
+	sats := msat / 1000
+	if msat%1000 != 0 {
+		sats++
+	}
+	return sats
+}
+
+// inputsCover returns whether the amount of the inputs is enough to pay
+// for the amounts required. It is false if the required amounts overflow.
+func inputsCover(inputsAmount uint64, required ...uint64) bool {
+	requiredAmount, err := cashu.CheckedAdd(required...)
+	return err == nil && inputsAmount >= requiredAmount
+}
+
+// getActiveKeysets returns the current active keysets. The map must not be modified
+func (m *Mint) getActiveKeysets() map[string]crypto.MintKeyset {
+	m.keysetsMu.RLock()
+	defer m.keysetsMu.RUnlock()
+	return m.activeKeysets
+}
+
+// getKeysets returns all the current keysets. The map must not be modified
+func (m *Mint) getKeysets() map[string]crypto.MintKeyset {
+	m.keysetsMu.RLock()
+	defer m.keysetsMu.RUnlock()
+	return m.keysets
+}
+
+// GetActiveKeyset returns the active keyset for the sat unit
 func (m *Mint) GetActiveKeyset() crypto.MintKeyset {
 	var keyset crypto.MintKeyset
-	for _, k := range m.activeKeysets {
-		keyset = k
-		break
+	for _, k := range m.getActiveKeysets() {
+		if k.Unit == cashu.Sat.String() {
+			keyset = k
+			break
+		}
 	}
 	return keyset
 }
 
 func (m *Mint) SetMintInfo(mintInfo MintInfo) {
+	limits := m.currentLimits()
+	// mint quote requests can have a description for all methods
+	mintOptions := &nut06.MethodOptions{Description: true}
 	nuts := nut06.NutsMap{
 		4: nut06.NutSetting{
 			Methods: []nut06.MethodSetting{
 				{
 					Method:    cashu.BOLT11_METHOD,
 					Unit:      cashu.Sat.String(),
-					MinAmount: m.limits.MintingSettings.MinAmount,
-					MaxAmount: m.limits.MintingSettings.MaxAmount,
+					MinAmount: limits.MintingSettings.MinAmount,
+					MaxAmount: limits.MintingSettings.MaxAmount,
+					Options:   mintOptions,
 				},
 			},
 			Disabled: false,
@@ -1417,27 +2124,100 @@ func (m *Mint) SetMintInfo(mintInfo MintInfo) {
 				{
 					Method:    cashu.BOLT11_METHOD,
 					Unit:      cashu.Sat.String(),
-					MinAmount: m.limits.MeltingSettings.MinAmount,
-					MaxAmount: m.limits.MeltingSettings.MaxAmount,
+					MinAmount: limits.MeltingSettings.MinAmount,
+					MaxAmount: limits.MeltingSettings.MaxAmount,
 				},
 			},
 			Disabled: false,
 		},
 		7:  map[string]bool{"supported": true},
-		8:  map[string]bool{"supported": false},
+		8:  map[string]bool{"supported": true},
 		9:  map[string]bool{"supported": true},
 		10: map[string]bool{"supported": true},
 		11: map[string]bool{"supported": true},
 		12: map[string]bool{"supported": true},
 		14: map[string]bool{"supported": true},
+		17: nut17.Settings{
+			Supported: []nut17.SupportedMethod{
+				{Method: cashu.BOLT11_METHOD, Unit: cashu.Sat.String(), Commands: supportedSubscriptions},
+			},
+		},
+		20: nut20.Settings{
+			Supported:           true,
+			PubkeyRequiredAbove: limits.MintingSettings.PubkeyRequiredAbove,
+		},
+	}
+
+	if m.stateKey != nil {
+		// responses to proof state checks are signed with the info pubkey
+		nuts[7] = map[string]bool{"supported": true, "signed": true}
+	}
+	if m.msatEnabled {
+		for _, nut := range []int{4, 5} {
+			setting := nuts[nut].(nut06.NutSetting)
+			msatMethod := setting.Methods[0]
+			msatMethod.Unit = cashu.Msat.String()
+			// limits are in sats
+			msatMethod.MinAmount *= 1000
+			msatMethod.MaxAmount *= 1000
+			setting.Methods = append(setting.Methods, msatMethod)
+			nuts[nut] = setting
+		}
+		setting := nuts[17].(nut17.Settings)
+		setting.Supported = append(setting.Supported, nut17.SupportedMethod{
+			Method: cashu.BOLT11_METHOD, Unit: cashu.Msat.String(), Commands: supportedSubscriptions,
+		})
+		nuts[17] = setting
+	}
+	// limits are in sats and the amount in fiat units
+	// changes with the price so they are not set for them
+	for _, unit := range m.fiatUnits {
+		for _, nut := range []int{4, 5} {
+			setting := nuts[nut].(nut06.NutSetting)
+			method := nut06.MethodSetting{Method: cashu.BOLT11_METHOD, Unit: unit.String()}
+			if nut == 4 {
+				method.Options = mintOptions
+			}
+			setting.Methods = append(setting.Methods, method)
+			nuts[nut] = setting
+		}
+		setting := nuts[17].(nut17.Settings)
+		setting.Supported = append(setting.Supported, nut17.SupportedMethod{
+			Method: cashu.BOLT11_METHOD, Unit: unit.String(), Commands: supportedSubscriptions,
+		})
+		nuts[17] = setting
+	}
+
+	if m.bolt12Enabled {
+		setting := nuts[4].(nut06.NutSetting)
+		setting.Methods = append(setting.Methods, nut06.MethodSetting{
+			Method:    cashu.BOLT12_METHOD,
+			Unit:      cashu.Sat.String(),
+			MinAmount: limits.MintingSettings.MinAmount,
+			MaxAmount: limits.MintingSettings.MaxAmount,
+			Options:   mintOptions,
+		})
+		nuts[4] = setting
+
+		setting = nuts[5].(nut06.NutSetting)
+		setting.Methods = append(setting.Methods, nut06.MethodSetting{
+			Method:    cashu.BOLT12_METHOD,
+			Unit:      cashu.Sat.String(),
+			MinAmount: limits.MeltingSettings.MinAmount,
+			MaxAmount: limits.MeltingSettings.MaxAmount,
+		})
+		nuts[5] = setting
 	}
 
 	if m.mppEnabled {
-		nuts[15] = map[string][]nut06.MethodSetting{
-			"methods": {
-				{Method: cashu.BOLT11_METHOD, Unit: cashu.Sat.String()},
-			},
+		methods := []nut06.MethodSetting{{Method: cashu.BOLT11_METHOD, Unit: cashu.Sat.String()}}
+		if m.msatEnabled {
+			methods = append(methods, nut06.MethodSetting{Method: cashu.BOLT11_METHOD, Unit: cashu.Msat.String()})
+		}
+		for _, unit := range m.fiatUnits {
+			methods = append(methods, nut06.MethodSetting{Method: cashu.BOLT11_METHOD, Unit: unit.String()})
 		}
+		nuts[15] = map[string][]nut06.MethodSetting{"methods": methods}
 	}
 
 	info := nut06.MintInfo{
@@ -1451,11 +2231,20 @@ func (m *Mint) SetMintInfo(mintInfo MintInfo) {
 		URLs:            mintInfo.URLs,
 		Time:            time.Now().Unix(),
 		Nuts:            nuts,
+		Limits: &nut06.OperationalLimits{
+			MaxInputs:      m.maxRequestItems,
+			MaxOutputs:     m.maxRequestItems,
+			MaxRequestSize: m.maxRequestSize,
+			MintQuoteTTL:   uint64(m.invoiceOptions.InvoiceExpiry().Seconds()),
+			MeltQuoteTTL:   QuoteExpiryMins * 60,
+		},
 	}
+	m.settingsMu.Lock()
 	m.mintInfo = info
+	m.settingsMu.Unlock()
 }
 
-func (m Mint) RetrieveMintInfo() (nut06.MintInfo, error) {
+func (m *Mint) RetrieveMintInfo() (nut06.MintInfo, error) {
 	seed, err := m.db.GetSeed()
 	if err != nil {
 		return nut06.MintInfo{}, err
@@ -1476,15 +2265,37 @@ func (m Mint) RetrieveMintInfo() (nut06.MintInfo, error) {
 		return nut06.MintInfo{}, cashu.BuildCashuError(errmsg, cashu.DBErrCode)
 	}
 
+	m.settingsMu.RLock()
+	defer m.settingsMu.RUnlock()
 	if m.limits.MaxBalance > 0 {
 		if mintBalance >= m.limits.MaxBalance {
 			mintingDisabled = true
 		}
 	}
-	nut04 := m.mintInfo.Nuts[4].(nut06.NutSetting)
-	nut04.Disabled = mintingDisabled
-	m.mintInfo.Nuts[4] = nut04
-	m.mintInfo.Pubkey = hex.EncodeToString(publicKey.SerializeCompressed())
 
-	return m.mintInfo, nil
+	// copy the nuts to not modify the info of the mint
+	info := m.mintInfo
+	info.Nuts = make(nut06.NutsMap, len(m.mintInfo.Nuts))
+	for nut, setting := range m.mintInfo.Nuts {
+		info.Nuts[nut] = setting
+	}
+	nut04 := info.Nuts[4].(nut06.NutSetting)
+	nut04.Disabled = mintingDisabled || m.redeemOnly
+	info.Nuts[4] = nut04
+	if m.redeemOnly && len(info.Motd) == 0 {
+		info.Motd = DefaultRedeemOnlyMotd
+	}
+	if m.faucetMode && len(info.Motd) == 0 {
+		info.Motd = DefaultFaucetMotd
+	}
+	info.Pubkey = hex.EncodeToString(publicKey.SerializeCompressed())
+
+	return info, nil
+}
+
+// validPaymentHash checks the payment hash is the full 32 bytes in hex
+// so quotes cannot be looked up by a prefix of the hash
+func validPaymentHash(paymentHash string) bool {
+	hashBytes, err := hex.DecodeString(paymentHash)
+	return err == nil && len(hashBytes) == 32
 }
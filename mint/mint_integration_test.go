@@ -6,32 +6,52 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
 	btcdocker "github.com/elnosh/btc-docker-test"
 	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut03"
 	"github.com/elnosh/gonuts/cashu/nuts/nut04"
 	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut06"
 	"github.com/elnosh/gonuts/cashu/nuts/nut07"
 	"github.com/elnosh/gonuts/cashu/nuts/nut10"
 	"github.com/elnosh/gonuts/cashu/nuts/nut11"
 	"github.com/elnosh/gonuts/cashu/nuts/nut12"
 	"github.com/elnosh/gonuts/cashu/nuts/nut14"
+	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+	"github.com/elnosh/gonuts/cashu/nuts/nut20"
+	"github.com/elnosh/gonuts/cashu/nuts/nut25"
 	"github.com/elnosh/gonuts/crypto"
 	"github.com/elnosh/gonuts/mint"
+	"github.com/elnosh/gonuts/mint/lightning"
 	"github.com/elnosh/gonuts/mint/storage"
+	"github.com/elnosh/gonuts/mint/storage/memory"
 	"github.com/elnosh/gonuts/testutils"
+	"github.com/elnosh/gonuts/wallet/client"
+	"github.com/gorilla/websocket"
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lnrpc/invoicesrpc"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
 )
 
 var (
@@ -120,6 +140,63 @@ func TestRequestMintQuote(t *testing.T) {
 	}
 }
 
+func TestQuoteWebhook(t *testing.T) {
+	type webhookRequest struct {
+		body      []byte
+		signature string
+	}
+	requests := make(chan webhookRequest, 1)
+	webhookServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		requests <- webhookRequest{body: body, signature: req.Header.Get(mint.QuoteWebhookSignatureHeader)}
+	}))
+	defer webhookServer.Close()
+
+	mintPath := filepath.Join(".", "quotewebhookmint")
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, 0, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mintPath)
+	config.QuoteWebhook = mint.QuoteWebhook{URL: webhookServer.URL, Secret: "webhooksecret"}
+	webhookMint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: 21, Unit: cashu.Sat.String()}
+	mintQuote, err := webhookMint.RequestMintQuote(mintQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in mint quote request: %v", err)
+	}
+
+	var webhookReq webhookRequest
+	select {
+	case webhookReq = <-requests:
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called for mint quote")
+	}
+
+	var quoteCreated mint.MintQuoteCreated
+	if err := json.Unmarshal(webhookReq.body, &quoteCreated); err != nil {
+		t.Fatalf("invalid webhook body: %v", err)
+	}
+	expected := mint.MintQuoteCreated{
+		Quote:       mintQuote.Id,
+		Amount:      21,
+		Unit:        cashu.Sat.String(),
+		Request:     mintQuote.PaymentRequest,
+		PaymentHash: mintQuote.PaymentHash,
+		Expiry:      mintQuote.Expiry,
+	}
+	if quoteCreated != expected {
+		t.Fatalf("expected webhook body '%+v' but got '%+v'", expected, quoteCreated)
+	}
+	if webhookReq.signature != mint.SignQuoteWebhook(webhookReq.body, "webhooksecret") {
+		t.Fatalf("invalid webhook signature '%v'", webhookReq.signature)
+	}
+}
+
 func TestMintQuoteState(t *testing.T) {
 	var mintAmount uint64 = 42000
 	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
@@ -163,6 +240,17 @@ func TestMintQuoteState(t *testing.T) {
 		t.Fatalf("expected quote state '%s' but got '%s' instead", nut04.Paid, quoteStateResponse.State)
 	}
 
+	// anyone that knows the payment hash could mint
+	// the quote if they could get its id from it
+	_, err = testMint.GetMintQuoteByPaymentHash(mintQuoteResponse.PaymentHash)
+	if !errors.Is(err, cashu.QuoteLookupPubkeyRequired) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.QuoteLookupPubkeyRequired, err)
+	}
+	_, err = testMint.GetMintQuoteByPaymentHash(mintQuoteResponse.PaymentHash[:32])
+	if !errors.Is(err, cashu.InvalidPaymentHashErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.InvalidPaymentHashErr, err)
+	}
+
 	blindedMessages, _, _, err := testutils.CreateBlindedMessages(mintAmount, keyset)
 
 	// mint tokens
@@ -183,6 +271,358 @@ func TestMintQuoteState(t *testing.T) {
 
 }
 
+func TestAMPMintQuote(t *testing.T) {
+	mintPath := filepath.Join(".", "ampmint")
+	defer os.RemoveAll(mintPath)
+
+	// backend without AMP support
+	config, err := testutils.MintConfig(struct{ lightning.Client }{&lightning.FakeBackend{}}, 0, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.EnableAMP = true
+	if _, err := mint.LoadMint(*config); err == nil {
+		t.Fatal("expected error loading mint with AMP enabled for backend that does not support it")
+	}
+
+	fakeBackend := &lightning.FakeBackend{}
+	config, err = testutils.MintConfig(fakeBackend, 0, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.EnableAMP = true
+	ampMint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mintAmount uint64 = 1000
+	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
+	mintQuote, err := ampMint.RequestMintQuote(mintQuoteRequest)
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+
+	// quote is not paid until payments add up to its amount
+	fakeBackend.PayAMPInvoice(mintQuote.PaymentHash, 400)
+	quoteState, err := ampMint.GetMintQuoteState(mintQuote.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting quote state: %v", err)
+	}
+	if quoteState.State != nut04.Unpaid {
+		t.Fatalf("expected quote state '%s' but got '%s' instead", nut04.Unpaid, quoteState.State)
+	}
+
+	fakeBackend.PayAMPInvoice(mintQuote.PaymentHash, 600)
+	quoteState, err = ampMint.GetMintQuoteState(mintQuote.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting quote state: %v", err)
+	}
+	if quoteState.State != nut04.Paid {
+		t.Fatalf("expected quote state '%s' but got '%s' instead", nut04.Paid, quoteState.State)
+	}
+
+	blindedMessages, _, _, err := testutils.CreateBlindedMessages(mintAmount, ampMint.GetActiveKeyset())
+	if err != nil {
+		t.Fatalf("error creating blinded messages: %v", err)
+	}
+	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages}
+	if _, err := ampMint.MintTokens(mintTokensRequest); err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+}
+
+func TestMintQuoteDescription(t *testing.T) {
+	mintPath := filepath.Join(".", "descriptionmint")
+	defer os.RemoveAll(mintPath)
+
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, 0, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptionMint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := descriptionMint.RetrieveMintInfo()
+	if err != nil {
+		t.Fatalf("unexpected error getting mint info: %v", err)
+	}
+	setting, ok := info.MethodSetting(4, cashu.BOLT11_METHOD, cashu.Sat.String())
+	if !ok || setting.Options == nil || !setting.Options.Description {
+		t.Fatalf("expected description option in mint info but got %+v", setting)
+	}
+
+	// control and formatting characters are removed
+	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{
+		Amount:      100,
+		Unit:        cashu.Sat.String(),
+		Description: " coffee\n\u202eand\tcake ",
+	}
+	mintQuote, err := descriptionMint.RequestMintQuote(mintQuoteRequest)
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	bolt11, err := decodepay.Decodepay(mintQuote.PaymentRequest)
+	if err != nil {
+		t.Fatalf("error decoding invoice: %v", err)
+	}
+	if bolt11.Description != "coffee and cake" {
+		t.Fatalf("expected invoice with description 'coffee and cake' but got '%v'", bolt11.Description)
+	}
+
+	mintQuoteRequest.Description = strings.Repeat("a", 640)
+	if _, err := descriptionMint.RequestMintQuote(mintQuoteRequest); err == nil {
+		t.Fatal("expected error requesting mint quote with description too long")
+	}
+	mintQuoteRequest.Description = "\xff"
+	if _, err := descriptionMint.RequestMintQuote(mintQuoteRequest); err == nil {
+		t.Fatal("expected error requesting mint quote with invalid description")
+	}
+}
+
+func TestBOLT12MintQuote(t *testing.T) {
+	mintPath := filepath.Join(".", "bolt12mint")
+	defer os.RemoveAll(mintPath)
+
+	// backend without BOLT12 support
+	config, err := testutils.MintConfig(struct{ lightning.Client }{&lightning.FakeBackend{}}, 0, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.EnableBOLT12 = true
+	if _, err := mint.LoadMint(*config); err == nil {
+		t.Fatal("expected error loading mint with BOLT12 enabled for backend that does not support it")
+	}
+
+	fakeBackend := &lightning.FakeBackend{}
+	config, err = testutils.MintConfig(fakeBackend, 0, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.EnableBOLT12 = true
+	bolt12Mint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, _ := btcec.NewPrivateKey()
+	pubkey := hex.EncodeToString(privateKey.PubKey().SerializeCompressed())
+	mintQuoteRequest := nut25.PostMintQuoteBolt12Request{Unit: cashu.Sat.String()}
+	if _, err := bolt12Mint.RequestMintQuoteBolt12(mintQuoteRequest); !errors.Is(err, nut20.PubkeyRequiredErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut20.PubkeyRequiredErr, err)
+	}
+
+	mintQuoteRequest.Pubkey = pubkey
+	mintQuote, err := bolt12Mint.RequestMintQuoteBolt12(mintQuoteRequest)
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	if _, err := bolt12Mint.GetMintQuoteState(mintQuote.Id); !errors.Is(err, cashu.QuoteNotExistErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.QuoteNotExistErr, err)
+	}
+
+	keyset := bolt12Mint.GetActiveKeyset()
+	signedRequest := func(amount uint64) nut25.PostMintBolt12Request {
+		blindedMessages, _, _, err := testutils.CreateBlindedMessages(amount, keyset)
+		if err != nil {
+			t.Fatalf("error creating blinded messages: %v", err)
+		}
+		signature, err := nut20.SignMintRequest(mintQuote.Id, blindedMessages, privateKey)
+		if err != nil {
+			t.Fatalf("error signing mint request: %v", err)
+		}
+		return nut25.PostMintBolt12Request{Quote: mintQuote.Id, Outputs: blindedMessages, Signature: signature}
+	}
+
+	if _, err := bolt12Mint.MintTokensBolt12(signedRequest(100)); !errors.Is(err, cashu.MintQuoteRequestNotPaid) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintQuoteRequestNotPaid, err)
+	}
+
+	fakeBackend.PayOffer(mintQuote.PaymentHash, 500)
+	quoteState, err := bolt12Mint.GetMintQuoteBolt12State(mintQuote.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting quote state: %v", err)
+	}
+	if quoteState.State != nut04.Paid || quoteState.AmountPaid != 500 {
+		t.Fatalf("expected quote paid for 500 but got '%s' for %v", quoteState.State, quoteState.AmountPaid)
+	}
+
+	// request signed with other key
+	otherKey, _ := btcec.NewPrivateKey()
+	mintTokensRequest := signedRequest(100)
+	mintTokensRequest.Signature, _ = nut20.SignMintRequest(mintQuote.Id, mintTokensRequest.Outputs, otherKey)
+	if _, err := bolt12Mint.MintTokensBolt12(mintTokensRequest); !errors.Is(err, nut20.InvalidSignatureErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut20.InvalidSignatureErr, err)
+	}
+
+	if _, err := bolt12Mint.MintTokensBolt12(signedRequest(600)); !errors.Is(err, cashu.OutputsOverQuoteAmountErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.OutputsOverQuoteAmountErr, err)
+	}
+	if _, err := bolt12Mint.MintTokensBolt12(signedRequest(300)); err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	if _, err := bolt12Mint.MintTokensBolt12(signedRequest(300)); !errors.Is(err, cashu.OutputsOverQuoteAmountErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.OutputsOverQuoteAmountErr, err)
+	}
+	if _, err := bolt12Mint.MintTokensBolt12(signedRequest(200)); err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	if _, err := bolt12Mint.MintTokensBolt12(signedRequest(100)); !errors.Is(err, cashu.MintQuoteRequestNotPaid) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintQuoteRequestNotPaid, err)
+	}
+
+	// offer can be paid again
+	fakeBackend.PayOffer(mintQuote.PaymentHash, 250)
+	if _, err := bolt12Mint.MintTokensBolt12(signedRequest(250)); err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	quoteState, err = bolt12Mint.GetMintQuoteBolt12State(mintQuote.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting quote state: %v", err)
+	}
+	if quoteState.AmountPaid != 750 || quoteState.AmountIssued != 750 {
+		t.Fatalf("expected 750 paid and issued but got %v and %v", quoteState.AmountPaid, quoteState.AmountIssued)
+	}
+
+	// limits apply to what is minted from offers without an amount
+	limitsMintPath := filepath.Join(".", "bolt12limitsmint")
+	defer os.RemoveAll(limitsMintPath)
+	limits := mint.MintLimits{MaxBalance: 600, MintingSettings: mint.MintMethodSettings{MaxAmount: 400}}
+	config, err = testutils.MintConfig(fakeBackend, 0, 0, limitsMintPath, 0, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.EnableBOLT12 = true
+	bolt12Mint, err = mint.LoadMint(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyset = bolt12Mint.GetActiveKeyset()
+	mintQuoteRequest.Amount = 500
+	if _, err := bolt12Mint.RequestMintQuoteBolt12(mintQuoteRequest); !errors.Is(err, cashu.MintAmountExceededErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintAmountExceededErr, err)
+	}
+	mintQuoteRequest.Amount = 0
+	mintQuote, err = bolt12Mint.RequestMintQuoteBolt12(mintQuoteRequest)
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	fakeBackend.PayOffer(mintQuote.PaymentHash, 1000)
+	if _, err := bolt12Mint.MintTokensBolt12(signedRequest(500)); !errors.Is(err, cashu.MintAmountExceededErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintAmountExceededErr, err)
+	}
+	if _, err := bolt12Mint.MintTokensBolt12(signedRequest(400)); err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	if _, err := bolt12Mint.MintTokensBolt12(signedRequest(300)); !errors.Is(err, cashu.MintingDisabled) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintingDisabled, err)
+	}
+	if _, err := bolt12Mint.MintTokensBolt12(signedRequest(200)); err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+}
+
+func TestBOLT12MeltQuote(t *testing.T) {
+	mintPath := filepath.Join(".", "bolt12melt")
+	defer os.RemoveAll(mintPath)
+
+	fakeBackend := &lightning.FakeBackend{}
+	config, err := testutils.MintConfig(fakeBackend, 0, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.EnableBOLT12 = true
+	bolt12Mint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// mint proofs from a paid offer to melt them
+	privateKey, _ := btcec.NewPrivateKey()
+	mintQuote, err := bolt12Mint.RequestMintQuoteBolt12(nut25.PostMintQuoteBolt12Request{
+		Unit:   cashu.Sat.String(),
+		Pubkey: hex.EncodeToString(privateKey.PubKey().SerializeCompressed()),
+	})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	fakeBackend.PayOffer(mintQuote.PaymentHash, 1000)
+	keyset := bolt12Mint.GetActiveKeyset()
+	blindedMessages, secrets, rs, err := testutils.CreateBlindedMessages(1000, keyset)
+	if err != nil {
+		t.Fatalf("error creating blinded messages: %v", err)
+	}
+	signature, _ := nut20.SignMintRequest(mintQuote.Id, blindedMessages, privateKey)
+	blindedSignatures, err := bolt12Mint.MintTokensBolt12(
+		nut25.PostMintBolt12Request{Quote: mintQuote.Id, Outputs: blindedMessages, Signature: signature},
+	)
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+
+	invoice, _, _, _ := lightning.CreateFakeInvoice(100, false)
+	if _, err := bolt12Mint.RequestMeltQuoteBolt12(nut25.PostMeltQuoteBolt12Request{
+		Request: invoice,
+		Unit:    cashu.Sat.String(),
+	}); err == nil {
+		t.Fatal("expected error requesting bolt12 melt quote for bolt11 invoice")
+	}
+
+	// offer for any amount from another node
+	otherNode := &lightning.FakeBackend{}
+	anyAmountOffer, _ := otherNode.CreateOffer(0, "any amount")
+	meltQuoteRequest := nut25.PostMeltQuoteBolt12Request{Request: anyAmountOffer.Request, Unit: cashu.Sat.String()}
+	if _, err := bolt12Mint.RequestMeltQuoteBolt12(meltQuoteRequest); err == nil {
+		t.Fatal("expected error requesting melt quote for offer without amount")
+	}
+	meltQuoteRequest.Options = &nut05.MeltOptions{Mpp: &nut05.MppOption{Amount: 100}}
+	if _, err := bolt12Mint.RequestMeltQuoteBolt12(meltQuoteRequest); err == nil {
+		t.Fatal("expected error requesting melt quote with mpp option")
+	}
+	meltQuoteRequest.Options = &nut05.MeltOptions{Amountless: &nut05.AmountlessOption{AmountMsat: 200_000}}
+	anyAmountQuote, err := bolt12Mint.RequestMeltQuoteBolt12(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+	if anyAmountQuote.Amount != 200 {
+		t.Fatalf("expected melt quote amount of 200 but got %v", anyAmountQuote.Amount)
+	}
+
+	offer, _ := fakeBackend.CreateOffer(300, "offer with amount")
+	meltQuote, err := bolt12Mint.RequestMeltQuoteBolt12(nut25.PostMeltQuoteBolt12Request{
+		Request: offer.Request,
+		Unit:    cashu.Sat.String(),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+	if meltQuote.Amount != 300 || meltQuote.PaymentHash == "" {
+		t.Fatalf("expected melt quote for 300 with payment hash but got %v", meltQuote.Amount)
+	}
+
+	// quotes for offers are melted like bolt11 quotes
+	melt, err := bolt12Mint.MeltTokens(ctx, nut25.PostMeltBolt12Request{Quote: meltQuote.Id, Inputs: proofs})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if melt.State != nut05.Paid {
+		t.Fatalf("expected paid melt quote but got '%s'", melt.State)
+	}
+	quoteState, err := bolt12Mint.GetMeltQuoteState(ctx, meltQuote.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting melt quote state: %v", err)
+	}
+	if quoteState.State != nut05.Paid {
+		t.Fatalf("expected paid melt quote but got '%s'", quoteState.State)
+	}
+}
+
 func TestMintTokens(t *testing.T) {
 	var mintAmount uint64 = 42000
 	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
@@ -296,6 +736,14 @@ func TestSwap(t *testing.T) {
 		t.Fatalf("expected error '%v' but got '%v' instead", cashu.DuplicateProofs, err)
 	}
 
+	// test with duplicates in blinded messages
+	duplicateBlindedMessages := slices.Clone(newBlindedMessages)
+	duplicateBlindedMessages[0].B_ = duplicateBlindedMessages[1].B_
+	_, err = testMint.Swap(proofs, duplicateBlindedMessages)
+	if !errors.Is(err, cashu.DuplicateOutputs) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.DuplicateOutputs, err)
+	}
+
 	// valid proofs
 	_, err = testMint.Swap(proofs, newBlindedMessages)
 	if err != nil {
@@ -352,1046 +800,3976 @@ func TestSwap(t *testing.T) {
 	}
 }
 
-func TestRequestMeltQuote(t *testing.T) {
-	invoice := lnrpc.Invoice{Value: 10000}
-	addInvoiceResponse, err := lnd2.Client.AddInvoice(ctx, &invoice)
+func TestUnitMismatch(t *testing.T) {
+	mintPath := filepath.Join(".", "mintunits")
+	unitsMint, err := testutils.CreateTestMint(lnd1, mintPath, 0, mint.MintLimits{})
 	if err != nil {
-		t.Fatalf("error creating invoice: %v", err)
+		t.Fatal(err)
 	}
-	paymentRequest := addInvoiceResponse.PaymentRequest
+	defer os.RemoveAll(mintPath)
 
-	// test invalid unit
-	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: "eth"}
-	_, err = testMint.RequestMeltQuote(meltQuoteRequest)
-	cashuErr, ok := err.(*cashu.Error)
-	if !ok {
-		t.Fatalf("got unexpected non-Cashu error: %v", err)
+	seed, err := testutils.GenerateRandomBytes()
+	if err != nil {
+		t.Fatal(err)
 	}
-	if cashuErr.Code != cashu.UnitErrCode {
-		t.Fatalf("expected cashu error code '%v' but got '%v' instead", cashu.UnitErrCode, cashuErr.Code)
+	usdKeyset, err := unitsMint.ImportKeyset(mint.KeysetImport{
+		Seed:           seed,
+		DerivationPath: "m/0'/2'/0'",
+		Unit:           "usd",
+	})
+	if err != nil {
+		t.Fatalf("error importing keyset: %v", err)
 	}
 
-	// test invalid invoice
-	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: "invoice1111", Unit: cashu.Sat.String()}
-	_, err = testMint.RequestMeltQuote(meltQuoteRequest)
-	if err == nil {
-		t.Fatal("expected error but got nil")
+	var amount uint64 = 2000
+	usdProofs, err := proofsFromKeyset(amount, usdKeyset)
+	if err != nil {
+		t.Fatalf("error generating usd proofs: %v", err)
 	}
-
-	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	_, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	satProofs, err := testutils.GetValidProofsForAmount(amount, unitsMint, lnd2)
 	if err != nil {
-		t.Fatalf("got unexpected error in melt request: %v", err)
+		t.Fatalf("error generating valid proofs: %v", err)
 	}
 
-	// trying to create another melt quote with same invoice should throw error
-	_, err = testMint.RequestMeltQuote(meltQuoteRequest)
-	if !errors.Is(err, cashu.MeltQuoteForRequestExists) {
-		//if !errors.Is(err, cashu.PaymentMethodNotSupportedErr) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltQuoteForRequestExists, err)
+	satKeyset := unitsMint.GetActiveKeyset()
+	satBlindedMessages, _, _, err := testutils.CreateBlindedMessages(amount, satKeyset)
+	usdBlindedMessages, _, _, err := testutils.CreateBlindedMessages(amount, *usdKeyset)
+
+	// usd inputs for sat outputs
+	_, err = unitsMint.Swap(usdProofs, satBlindedMessages)
+	if !errors.Is(err, cashu.UnitMismatchErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.UnitMismatchErr, err)
 	}
-}
 
-func TestMeltQuoteState(t *testing.T) {
-	invoice := lnrpc.Invoice{Value: 2000}
-	addInvoiceResponse, err := lnd2.Client.AddInvoice(ctx, &invoice)
-	if err != nil {
-		t.Fatalf("error creating invoice: %v", err)
+	// sat inputs for usd outputs
+	_, err = unitsMint.Swap(satProofs, usdBlindedMessages)
+	if !errors.Is(err, cashu.UnitMismatchErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.UnitMismatchErr, err)
 	}
-	paymentRequest := addInvoiceResponse.PaymentRequest
 
-	lookupInvoice, err := lnd2.Client.LookupInvoice(ctx, &lnrpc.PaymentHash{RHash: addInvoiceResponse.RHash})
-	if err != nil {
-		t.Fatalf("error finding invoice: %v", err)
+	// inputs of multiple units
+	mixedProofs := append(cashu.Proofs{usdProofs[0]}, satProofs...)
+	mixedBlindedMessages, _, _, err := testutils.CreateBlindedMessages(mixedProofs.Amount(), satKeyset)
+	_, err = unitsMint.Swap(mixedProofs, mixedBlindedMessages)
+	if !errors.Is(err, cashu.UnitMismatchErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.UnitMismatchErr, err)
 	}
 
-	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltRequest, err := testMint.RequestMeltQuote(meltQuoteRequest)
-	if err != nil {
-		t.Fatalf("got unexpected error in melt request: %v", err)
+	// outputs of multiple units
+	mixedBlindedMessages = append(satBlindedMessages[1:], usdBlindedMessages[0])
+	_, err = unitsMint.Swap(satProofs, mixedBlindedMessages)
+	if !errors.Is(err, cashu.UnitMismatchErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.UnitMismatchErr, err)
 	}
 
-	// test invalid quote id
-	_, err = testMint.GetMeltQuoteState(ctx, "quote1234")
-	if !errors.Is(err, cashu.QuoteNotExistErr) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.PaymentMethodNotSupportedErr, err)
-	}
-
-	// test before paying melt
-	meltQuote, err := testMint.GetMeltQuoteState(ctx, meltRequest.Id)
+	// usd outputs for sat mint quote
+	mintQuote, err := unitsMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
 	if err != nil {
-		t.Fatalf("unexpected error getting melt quote state: %v", err)
+		t.Fatalf("error requesting mint quote: %v", err)
 	}
-	if meltQuote.State != nut05.Unpaid {
-		t.Fatalf("expected quote state '%s' but got '%s' instead", nut05.Unpaid, meltQuote.State)
+	sendPaymentRequest := lnrpc.SendRequest{PaymentRequest: mintQuote.PaymentRequest}
+	response, _ := lnd2.Client.SendPaymentSync(ctx, &sendPaymentRequest)
+	if len(response.PaymentError) > 0 {
+		t.Fatalf("error paying invoice: %v", response.PaymentError)
 	}
-
-	// test state after melting
-	validProofs, err := testutils.GetValidProofsForAmount(6500, testMint, lnd2)
-	if err != nil {
-		t.Fatalf("error generating valid proofs: %v", err)
+	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: usdBlindedMessages}
+	_, err = unitsMint.MintTokens(mintTokensRequest)
+	if !errors.Is(err, cashu.UnitMismatchErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.UnitMismatchErr, err)
 	}
 
-	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
-	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
-	if err != nil {
-		t.Fatalf("got unexpected error in melt: %v", err)
+	// quote can still be minted with sat outputs after failed attempt
+	mintTokensRequest = nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: satBlindedMessages}
+	if _, err := unitsMint.MintTokens(mintTokensRequest); err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
 	}
 
-	meltQuote, err = testMint.GetMeltQuoteState(ctx, meltRequest.Id)
+	// usd inputs for sat melt quote
+	invoice := lnrpc.Invoice{Value: 1000}
+	addInvoiceResponse, err := lnd2.Client.AddInvoice(ctx, &invoice)
 	if err != nil {
-		t.Fatalf("unexpected error getting melt quote state: %v", err)
+		t.Fatalf("error creating invoice: %v", err)
 	}
-	if meltQuote.State != nut05.Paid {
-		t.Fatalf("expected quote state '%s' but got '%s' instead", nut05.Paid, meltQuote.State)
+	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: addInvoiceResponse.PaymentRequest, Unit: cashu.Sat.String()}
+	meltQuote, err := unitsMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
-	preimageString := hex.EncodeToString(lookupInvoice.RPreimage)
-	if meltQuote.Preimage != preimageString {
-		t.Fatalf("expected quote preimage '%v' but got '%v' instead", preimageString, meltQuote.Preimage)
+	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: usdProofs}
+	_, err = unitsMint.MeltTokens(ctx, meltTokensRequest)
+	if !errors.Is(err, cashu.UnitMismatchErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.UnitMismatchErr, err)
 	}
 
-}
-
-func TestMelt(t *testing.T) {
-	var amount uint64 = 1000
-	underProofs, err := testutils.GetValidProofsForAmount(amount, testMint, lnd2)
+	// melt quote was not affected by failed attempt
+	meltQuote, err = unitsMint.GetMeltQuoteState(ctx, meltQuote.Id)
 	if err != nil {
-		t.Fatalf("error generating valid proofs: %v", err)
+		t.Fatalf("unexpected error getting melt quote state: %v", err)
 	}
+	if meltQuote.State != nut05.Unpaid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Unpaid, meltQuote.State)
+	}
+}
 
-	invoice := lnrpc.Invoice{Value: 6000}
+func TestRequestMeltQuote(t *testing.T) {
+	invoice := lnrpc.Invoice{Value: 10000}
 	addInvoiceResponse, err := lnd2.Client.AddInvoice(ctx, &invoice)
 	if err != nil {
 		t.Fatalf("error creating invoice: %v", err)
 	}
 	paymentRequest := addInvoiceResponse.PaymentRequest
 
-	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
-	if err != nil {
-		t.Fatalf("got unexpected error in melt request: %v", err)
+	// test invalid unit
+	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: "eth"}
+	_, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	cashuErr, ok := err.(*cashu.Error)
+	if !ok {
+		t.Fatalf("got unexpected non-Cashu error: %v", err)
 	}
-
-	// test proofs amount under melt amount
-	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: underProofs}
-	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
-	if !errors.Is(err, cashu.InsufficientProofsAmount) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.PaymentMethodNotSupportedErr, err)
+	if cashuErr.Code != cashu.UnitErrCode {
+		t.Fatalf("expected cashu error code '%v' but got '%v' instead", cashu.UnitErrCode, cashuErr.Code)
 	}
 
-	validProofs, err := testutils.GetValidProofsForAmount(6500, testMint, lnd2)
-	if err != nil {
-		t.Fatalf("error generating valid proofs: %v", err)
+	// test invalid invoice
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: "invoice1111", Unit: cashu.Sat.String()}
+	_, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	if err == nil {
+		t.Fatal("expected error but got nil")
 	}
-	validSecret := validProofs[0].Secret
 
-	// test invalid proofs
-	validProofs[0].Secret = "some invalid secret"
-	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
-	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
-	if !errors.Is(err, cashu.InvalidProofErr) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.InvalidProofErr, err)
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
+	_, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
 
-	validProofs[0].Secret = validSecret
-
-	// test with duplicates in proofs list passed
-	proofsLen := len(validProofs)
-	duplicateProofs := make(cashu.Proofs, proofsLen)
-	copy(duplicateProofs, validProofs)
-	duplicateProofs[proofsLen-2] = duplicateProofs[proofsLen-1]
-	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: duplicateProofs}
-	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
-	if !errors.Is(err, cashu.DuplicateProofs) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.DuplicateProofs, err)
+	// trying to create another melt quote with same invoice should throw error
+	_, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	if !errors.Is(err, cashu.MeltQuoteForRequestExists) {
+		//if !errors.Is(err, cashu.PaymentMethodNotSupportedErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltQuoteForRequestExists, err)
 	}
+}
 
-	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
-	melt, err := testMint.MeltTokens(ctx, meltTokensRequest)
+func TestMeltQuoteMsatAmount(t *testing.T) {
+	mintPath := filepath.Join(".", "msatmeltmint")
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, 0, 0, mintPath, 0, mint.MintLimits{})
 	if err != nil {
-		t.Fatalf("got unexpected error in melt: %v", err)
-	}
-	if melt.State != nut05.Paid {
-		t.Fatal("got unexpected unpaid melt quote")
+		t.Fatal(err)
 	}
-
-	// test quote already paid
-	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
-	if !errors.Is(err, cashu.MeltQuoteAlreadyPaid) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltQuoteAlreadyPaid, err)
+	defer os.RemoveAll(mintPath)
+	msatMint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	invoice = lnrpc.Invoice{Value: 6000}
-	addInvoiceResponse, err = lnd2.Client.AddInvoice(ctx, &invoice)
+	invoice, _, _, err := lightning.CreateFakeInvoiceMsat(10500, false)
 	if err != nil {
 		t.Fatalf("error creating invoice: %v", err)
 	}
-	paymentRequest = addInvoiceResponse.PaymentRequest
-
-	// test already used proofs
-	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	newQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()}
+	meltQuote, err := msatMint.RequestMeltQuote(meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
-
-	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: newQuote.Id, Inputs: validProofs}
-	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
-	if !errors.Is(err, cashu.ProofAlreadyUsedErr) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.ProofAlreadyUsedErr, err)
+	// amount to pay is kept in msat and rounded up for the quote
+	if meltQuote.AmountMsat != 10500 {
+		t.Fatalf("expected quote amount of %v msat but got %v", 10500, meltQuote.AmountMsat)
 	}
-
-	// mint with fees
-	mintFeesPath := filepath.Join(".", "mintfeesmelt")
-	mintFees, err := testutils.CreateTestMint(lnd1, mintFeesPath, 100, mint.MintLimits{})
-	if err != nil {
-		t.Fatal(err)
+	if meltQuote.Amount != 11 {
+		t.Fatalf("expected quote amount of %v but got %v", 11, meltQuote.Amount)
 	}
-	defer os.RemoveAll(mintFeesPath)
-
-	amount = 6000
-	underProofs, err = testutils.GetValidProofsForAmount(amount, mintFees, lnd2)
+	savedQuote, err := msatMint.GetMeltQuoteState(ctx, meltQuote.Id)
 	if err != nil {
-		t.Fatalf("error generating valid proofs: %v", err)
+		t.Fatalf("unexpected error getting melt quote: %v", err)
 	}
-
-	amount = 6500
-	validProofsWithFees, err := testutils.GetValidProofsForAmount(amount, mintFees, lnd2)
-	if err != nil {
-		t.Fatalf("error generating valid proofs: %v", err)
+	if savedQuote.AmountMsat != meltQuote.AmountMsat || savedQuote.Amount != meltQuote.Amount {
+		t.Fatalf("expected saved quote '%+v' but got '%+v'", meltQuote, savedQuote)
 	}
 
-	addInvoiceResponse, err = lnd2.Client.AddInvoice(ctx, &invoice)
+	// partial amounts are compared with the invoice amount in msat
+	mppInvoice, _, _, err := lightning.CreateFakeInvoiceMsat(10500, false)
 	if err != nil {
 		t.Fatalf("error creating invoice: %v", err)
 	}
-	paymentRequest = addInvoiceResponse.PaymentRequest
-
-	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err = mintFees.RequestMeltQuote(meltQuoteRequest)
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
+		Request: mppInvoice,
+		Unit:    cashu.Sat.String(),
+		Options: &nut05.MeltOptions{Mpp: &nut05.MppOption{Amount: 11}},
+	}
+	_, err = msatMint.RequestMeltQuote(meltQuoteRequest)
+	if err == nil {
+		t.Fatal("expected error for mpp amount over invoice amount")
+	}
+	meltQuoteRequest.Options.Mpp.Amount = 10
+	mppQuote, err := msatMint.RequestMeltQuote(meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
-
-	// test proofs below needed amount with fees
-	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: underProofs}
-	_, err = mintFees.MeltTokens(ctx, meltTokensRequest)
-	if !errors.Is(err, cashu.InsufficientProofsAmount) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.InsufficientProofsAmount, err)
+	if mppQuote.AmountMsat != 10000 || mppQuote.Amount != 10 {
+		t.Fatalf("expected quote amount of 10000 msat but got '%+v'", mppQuote)
 	}
+}
 
-	// test valid proofs accounting for fees
-	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofsWithFees}
-	melt, err = mintFees.MeltTokens(ctx, meltTokensRequest)
+func TestMeltFeeCap(t *testing.T) {
+	mintPath := filepath.Join(".", "meltfeecapmint")
+	// payments need more routing fees than the fake backend reserves (0)
+	fakeBackend := &lightning.FakeBackend{RoutingFeeMsat: 2000}
+	config, err := testutils.MintConfig(fakeBackend, 0, 0, mintPath, 0, mint.MintLimits{})
 	if err != nil {
-		t.Fatalf("got unexpected error in melt: %v", err)
-	}
-	if melt.State != nut05.Paid {
-		t.Fatal("got unexpected unpaid melt quote")
+		t.Fatal(err)
 	}
-
-	// test failed lightning payment
-	lnd3, err := btcdocker.NewLnd(ctx, bitcoind)
+	defer os.RemoveAll(mintPath)
+	feeCapMint, err := mint.LoadMint(*config)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer lnd3.Terminate(ctx)
 
-	// create invoice from node for which there is no route so payment fails
-	noRoute := lnrpc.Invoice{Value: 2000}
-	noRouteInvoice, err := lnd3.Client.AddInvoice(ctx, &noRoute)
+	var amount uint64 = 100
+	mintQuote, err := feeCapMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
 	if err != nil {
-		t.Fatalf("error creating invoice: %v", err)
+		t.Fatalf("error requesting mint quote: %v", err)
 	}
-	paymentRequest = noRouteInvoice.PaymentRequest
-
-	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	keyset := feeCapMint.GetActiveKeyset()
+	blindedMessages, secrets, rs, err := testutils.CreateBlindedMessages(amount, keyset)
 	if err != nil {
-		t.Fatalf("got unexpected error in melt request: %v", err)
+		t.Fatalf("error creating blinded messages: %v", err)
 	}
-
-	validProofs, err = testutils.GetValidProofsForAmount(6500, testMint, lnd2)
+	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages}
+	blindedSignatures, err := feeCapMint.MintTokens(mintTokensRequest)
 	if err != nil {
-		t.Fatalf("error generating valid proofs: %v", err)
+		t.Fatalf("got unexpected error minting tokens: %v", err)
 	}
-
-	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
-	meltResponse, err := testMint.MeltTokens(ctx, meltTokensRequest)
-	if meltResponse.State != nut05.Unpaid {
-		// expecting unpaid since payment should have failed
-		t.Fatalf("expected melt quote with state of '%s' but got '%s' instead", nut05.Unpaid, meltResponse.State)
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
 	}
 
-	// test internal quotes (mint and melt quotes with same invoice)
-	var mintAmount uint64 = 42000
-	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err := testMint.RequestMintQuote(mintQuoteRequest)
+	invoice, _, _, err := lightning.CreateFakeInvoice(amount, false)
 	if err != nil {
-		t.Fatalf("error requesting mint quote: %v", err)
+		t.Fatalf("error creating invoice: %v", err)
 	}
-	keyset := testMint.GetActiveKeyset()
-	blindedMessages, _, _, err := testutils.CreateBlindedMessages(mintAmount, keyset)
-
-	proofs, err := testutils.GetValidProofsForAmount(mintAmount, testMint, lnd2)
+	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()}
+	meltQuote, err := feeCapMint.RequestMeltQuote(meltQuoteRequest)
 	if err != nil {
-		t.Fatalf("error generating valid proofs: %v", err)
+		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
 
-	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
-		Request: mintQuoteResponse.PaymentRequest,
-		Unit:    cashu.Sat.String(),
-	}
-	meltQuote, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: proofs}
+	meltQuote, err = feeCapMint.MeltTokens(ctx, meltTokensRequest)
 	if err != nil {
-		t.Fatalf("got unexpected error in melt request: %v", err)
+		t.Fatalf("got unexpected error in melt: %v", err)
 	}
-	if meltQuote.FeeReserve != 0 {
-		t.Fatal("RequestMeltQuote did not return fee reserve of 0 for internal quote")
+	if meltQuote.State != nut05.Unpaid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Unpaid, meltQuote.State)
 	}
 
-	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: proofs}
-	melt, err = testMint.MeltTokens(ctx, meltTokensRequest)
+	// proofs can be used again since payment failed
+	Ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		Y, _ := crypto.HashToCurve([]byte(proof.Secret))
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+	}
+	states, err := feeCapMint.ProofsStateCheck(Ys)
 	if err != nil {
-		t.Fatalf("got unexpected error in melt: %v", err)
+		t.Fatalf("unexpected error checking states of proofs: %v", err)
 	}
-	if len(melt.Preimage) == 0 {
-		t.Fatal("melt returned empty preimage")
+	for _, proofState := range states {
+		if proofState.State != nut07.Unspent {
+			t.Fatalf("expected proof state '%s' but got '%s'", nut07.Unspent, proofState.State)
+		}
 	}
 
-	// now mint should work because quote was settled internally
-	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
-	_, err = testMint.MintTokens(mintTokensRequest)
+	// payment goes through if it can be paid within the fee reserve
+	fakeBackend.RoutingFeeMsat = 0
+	meltQuote, err = feeCapMint.MeltTokens(ctx, meltTokensRequest)
 	if err != nil {
-		t.Fatalf("got unexpected error in mint: %v", err)
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if meltQuote.State != nut05.Paid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Paid, meltQuote.State)
 	}
 }
 
-func TestMPPMelt(t *testing.T) {
-	lnd3, err := btcdocker.NewLnd(ctx, bitcoind)
+func TestRequoteMelt(t *testing.T) {
+	mintPath := filepath.Join(".", "requotemint")
+	// payments need more routing fees than the fake backend reserves (0)
+	fakeBackend := &lightning.FakeBackend{RoutingFeeMsat: 2000}
+	config, err := testutils.MintConfig(fakeBackend, 0, 0, mintPath, 0, mint.MintLimits{})
 	if err != nil {
 		t.Fatal(err)
 	}
-	lnd4, err := btcdocker.NewLnd(ctx, bitcoind)
+	defer os.RemoveAll(mintPath)
+	requoteMint, err := mint.LoadMint(*config)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer func() {
-		lnd3.Terminate(ctx)
-		lnd4.Terminate(ctx)
-	}()
-	if err := testutils.FundLndNode(ctx, bitcoind, lnd2); err != nil {
-		t.Fatal(err)
+
+	var amount uint64 = 110
+	mintQuote, err := requoteMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
 	}
-	if err := testutils.OpenChannel(ctx, bitcoind, lnd1, lnd3, 1500000); err != nil {
-		t.Fatal(err)
+	keyset := requoteMint.GetActiveKeyset()
+	blindedMessages, secrets, rs, err := testutils.CreateBlindedMessages(amount, keyset)
+	if err != nil {
+		t.Fatalf("error creating blinded messages: %v", err)
 	}
-	if err := testutils.OpenChannel(ctx, bitcoind, lnd2, lnd3, 1500000); err != nil {
-		t.Fatal(err)
+	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages}
+	blindedSignatures, err := requoteMint.MintTokens(mintTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
 	}
-
-	testMppMintPath := filepath.Join(".", "testmppmint2")
-	testMppMint, err := testutils.CreateTestMint(lnd2, testMppMintPath, 0, mint.MintLimits{})
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
 	if err != nil {
-		t.Fatal(err)
+		t.Fatalf("error constructing proofs: %v", err)
 	}
-	defer os.RemoveAll(testMppMintPath)
 
-	invoice := lnrpc.Invoice{Value: 10000}
-	addInvoiceResponse, err := lnd3.Client.AddInvoice(ctx, &invoice)
+	invoice, _, paymentHash, err := lightning.CreateFakeInvoice(100, false)
 	if err != nil {
 		t.Fatalf("error creating invoice: %v", err)
 	}
-
-	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{
-		Request: addInvoiceResponse.PaymentRequest,
-		Unit:    cashu.Sat.String(),
-		Options: map[string]nut05.MppOption{"mpp": {Amount: 6000}},
-	}
-	meltQuote1, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()}
+	firstQuote, err := requoteMint.RequestMeltQuote(meltQuoteRequest)
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
+	meltQuote, err := requoteMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: firstQuote.Id, Inputs: proofs})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if meltQuote.State != nut05.Unpaid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Unpaid, meltQuote.State)
+	}
 
-	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
-		Request: addInvoiceResponse.PaymentRequest,
-		Unit:    cashu.Sat.String(),
-		Options: map[string]nut05.MppOption{"mpp": {Amount: 4000}},
+	// requote is allowed even though a quote for the invoice exists
+	_, err = requoteMint.RequestMeltQuote(meltQuoteRequest)
+	if !errors.Is(err, cashu.MeltQuoteForRequestExists) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltQuoteForRequestExists, err)
 	}
-	meltQuote2, err := testMppMint.RequestMeltQuote(meltQuoteRequest)
+	secondQuote, err := requoteMint.RequoteMelt(ctx, firstQuote.Id)
 	if err != nil {
-		t.Fatalf("got unexpected error in melt request: %v", err)
+		t.Fatalf("got unexpected error in requote: %v", err)
 	}
-
-	// get valid proofs to use in melts
-	validProofsFromMint1, _ := testutils.GetValidProofsForAmount(6100, testMint, lnd3)
-	validProofsFromMint2, _ := testutils.GetValidProofsForAmount(4100, testMppMint, lnd3)
-
-	// do melt tokens request concurrently
-	type result struct {
-		meltResult storage.MeltQuote
-		err        error
+	if secondQuote.Id == firstQuote.Id || secondQuote.Amount != firstQuote.Amount {
+		t.Fatalf("unexpected quote from requote: %+v", secondQuote)
+	}
+	if secondQuote.FeeReserve != 1 {
+		t.Fatalf("expected fee reserve of 1 but got %v", secondQuote.FeeReserve)
 	}
-	meltResults := make([]result, 2)
-
-	var wg sync.WaitGroup
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote1.Id, Inputs: validProofsFromMint1}
-		melt, err := testMint.MeltTokens(ctx, meltTokensRequest)
-		meltResults[0] = result{meltResult: melt, err: err}
-	}()
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote2.Id, Inputs: validProofsFromMint2}
-		melt, err := testMppMint.MeltTokens(ctx, meltTokensRequest)
-		meltResults[1] = result{meltResult: melt, err: err}
-	}()
-	wg.Wait()
 
-	for i, result := range meltResults {
-		if result.err != nil {
-			t.Fatalf("got unexpected error in melt '%v': %v", i, err)
-		}
-		if result.meltResult.State != nut05.Paid {
-			t.Fatalf("got unexpected UNPAID state in melt quote '%v'", i)
-		}
+	// superseded quote can't be melted or requoted again
+	_, err = requoteMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: firstQuote.Id, Inputs: proofs})
+	if !errors.Is(err, cashu.MeltQuoteSuperseded) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltQuoteSuperseded, err)
+	}
+	_, err = requoteMint.RequoteMelt(ctx, firstQuote.Id)
+	if !errors.Is(err, cashu.MeltQuoteSuperseded) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltQuoteSuperseded, err)
 	}
 
-	// MPP will fail because there is no route
-	invoice = lnrpc.Invoice{Value: 10000}
-	addInvoiceResponse, err = lnd4.Client.AddInvoice(ctx, &invoice)
+	// reserve is still not enough so requote again
+	meltQuote, err = requoteMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: secondQuote.Id, Inputs: proofs})
 	if err != nil {
-		t.Fatalf("error creating invoice: %v", err)
+		t.Fatalf("got unexpected error in melt: %v", err)
 	}
-
-	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
-		Request: addInvoiceResponse.PaymentRequest,
-		Unit:    cashu.Sat.String(),
-		Options: map[string]nut05.MppOption{"mpp": {Amount: 6000}},
+	if meltQuote.State != nut05.Unpaid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Unpaid, meltQuote.State)
 	}
-	meltQuote1, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	thirdQuote, err := requoteMint.RequoteMelt(ctx, secondQuote.Id)
 	if err != nil {
-		t.Fatalf("got unexpected error in melt request: %v", err)
+		t.Fatalf("got unexpected error in requote: %v", err)
 	}
-
-	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
-		Request: addInvoiceResponse.PaymentRequest,
-		Unit:    cashu.Sat.String(),
-		Options: map[string]nut05.MppOption{"mpp": {Amount: 4000}},
+	if thirdQuote.FeeReserve != 2 {
+		t.Fatalf("expected fee reserve of 2 but got %v", thirdQuote.FeeReserve)
 	}
-	meltQuote2, err = testMppMint.RequestMeltQuote(meltQuoteRequest)
+
+	meltQuote, err = requoteMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: thirdQuote.Id, Inputs: proofs})
 	if err != nil {
-		t.Fatalf("got unexpected error in melt request: %v", err)
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if meltQuote.State != nut05.Paid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Paid, meltQuote.State)
+	}
+	if _, err := requoteMint.RequoteMelt(ctx, thirdQuote.Id); !errors.Is(err, cashu.MeltQuoteAlreadyPaid) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltQuoteAlreadyPaid, err)
 	}
 
-	// get valid proofs to use in melts
-	validProofsFromMint1, _ = testutils.GetValidProofsForAmount(6100, testMint, lnd3)
-	validProofsFromMint2, _ = testutils.GetValidProofsForAmount(4100, testMppMint, lnd3)
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote1.Id, Inputs: validProofsFromMint1}
-		melt, err := testMint.MeltTokens(ctx, meltTokensRequest)
-		meltResults[0] = result{meltResult: melt, err: err}
-	}()
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote2.Id, Inputs: validProofsFromMint2}
-		melt, err := testMppMint.MeltTokens(ctx, meltTokensRequest)
-		meltResults[1] = result{meltResult: melt, err: err}
-	}()
-	wg.Wait()
-
-	for i, result := range meltResults {
-		if result.err != nil {
-			t.Fatalf("got unexpected error in melt '%v': %v", i, err)
-		}
-		if result.meltResult.State != nut05.Unpaid {
-			t.Fatalf("expected melt in UNPAID state but got it in '%s' state", result.meltResult.State)
-		}
+	// quote for the payment is the one that superseded the others
+	meltQuote, err = requoteMint.GetMeltQuoteByPaymentHash(ctx, paymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting quote by payment hash: %v", err)
+	}
+	if meltQuote.Id != thirdQuote.Id {
+		t.Fatalf("expected quote '%v' but got '%v'", thirdQuote.Id, meltQuote.Id)
 	}
+}
 
-	// test err on mpp amount over invoice amount
-	invoice = lnrpc.Invoice{Value: 10000}
-	addInvoiceResponse, err = lnd4.Client.AddInvoice(ctx, &invoice)
+func TestExternalBackend(t *testing.T) {
+	mintPath := filepath.Join(".", "externalbackendmint")
+	backend := &lightning.ExternalBackend{}
+	config, err := testutils.MintConfig(backend, 0, 0, mintPath, 0, mint.MintLimits{})
 	if err != nil {
-		t.Fatalf("error creating invoice: %v", err)
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mintPath)
+	externalMint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
-		Request: addInvoiceResponse.PaymentRequest,
-		Unit:    cashu.Sat.String(),
-		Options: map[string]nut05.MppOption{"mpp": {Amount: 10100}},
+	var amount uint64 = 100
+	mintQuote, err := externalMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
 	}
-	meltQuote1, err = testMint.RequestMeltQuote(meltQuoteRequest)
-	if err == nil {
-		t.Fatal("expected error but got nil")
+	keyset := externalMint.GetActiveKeyset()
+	blindedMessages, secrets, rs, err := testutils.CreateBlindedMessages(amount, keyset)
+	if err != nil {
+		t.Fatalf("error creating blinded messages: %v", err)
 	}
-	expectedErrMsg := "mpp amount is not less than amount in invoice"
-	if err.Error() != expectedErrMsg {
-		t.Fatalf("expected error '%v' but got '%v'", expectedErrMsg, err.Error())
+	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages}
+	if _, err := externalMint.MintTokens(mintTokensRequest); !errors.Is(err, cashu.MintQuoteRequestNotPaid) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.MintQuoteRequestNotPaid, err)
 	}
 
-	// test pending in-flight payments
-	preimage, _ := testutils.GenerateRandomBytes()
-	hash := sha256.Sum256(preimage)
-	hodlInvoice := invoicesrpc.AddHoldInvoiceRequest{Hash: hash[:], Value: 2100}
-	addHodlInvoiceRes, err := lnd2.InvoicesClient.AddHoldInvoice(ctx, &hodlInvoice)
+	// invoice is paid by the program running the mint
+	if err := backend.SettleInvoice(mintQuote.PaymentHash, ""); err != nil {
+		t.Fatalf("unexpected error settling invoice: %v", err)
+	}
+	blindedSignatures, err := externalMint.MintTokens(mintTokensRequest)
 	if err != nil {
-		t.Fatalf("error creating hodl invoice: %v", err)
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
 	}
 
-	meltContext, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-
-	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
-		Request: addHodlInvoiceRes.PaymentRequest,
-		Unit:    cashu.Sat.String(),
-		Options: map[string]nut05.MppOption{"mpp": {Amount: 2000}},
+	invoice, _, paymentHash, err := lightning.CreateFakeInvoice(amount, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
 	}
-	meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	meltQuote, err := externalMint.RequestMeltQuote(nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()})
 	if err != nil {
 		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
-	validProofsFromMint, _ := testutils.GetValidProofsForAmount(2100, testMint, lnd3)
-	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofsFromMint}
-	melt, err := testMint.MeltTokens(meltContext, meltTokensRequest)
+	meltQuote, err = externalMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: proofs})
 	if err != nil {
 		t.Fatalf("got unexpected error in melt: %v", err)
 	}
-	if melt.State != nut05.Pending {
-		t.Fatalf("expected melt quote with state of '%s' but got '%s' instead", nut05.Pending, melt.State)
-	}
-
-	meltQuote, err = testMint.GetMeltQuoteState(meltContext, meltQuote.Id)
-	if err != nil {
-		t.Fatalf("unexpected error getting melt quote state: %v", err)
-	}
+	// payment stays pending until the program reports it
 	if meltQuote.State != nut05.Pending {
-		t.Fatalf("expected melt quote with state of '%s' but got '%s' instead", nut05.Pending, melt.State)
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Pending, meltQuote.State)
 	}
-
-	Ys := make([]string, len(validProofsFromMint))
-	for i, proof := range validProofsFromMint {
-		Y, _ := crypto.HashToCurve([]byte(proof.Secret))
-		Yhex := hex.EncodeToString(Y.SerializeCompressed())
-		Ys[i] = Yhex
+	payments := backend.PendingPayments()
+	if len(payments) != 1 || payments[0].PaymentHash != paymentHash {
+		t.Fatalf("expected pending payment for invoice but got %+v", payments)
 	}
 
-	states, err := testMint.ProofsStateCheck(Ys)
+	if err := backend.CompletePayment(paymentHash, "0000", 0); err != nil {
+		t.Fatalf("unexpected error completing payment: %v", err)
+	}
+	meltQuote, err = externalMint.GetMeltQuoteState(ctx, meltQuote.Id)
 	if err != nil {
-		t.Fatalf("unexpected error checking states of proofs: %v", err)
+		t.Fatalf("unexpected error getting melt quote state: %v", err)
 	}
-	for _, proofState := range states {
-		if proofState.State != nut07.Pending {
-			t.Fatalf("expected pending proof but got '%s' instead", proofState.State)
-		}
+	if meltQuote.State != nut05.Paid || meltQuote.Preimage != "0000" {
+		t.Fatalf("expected paid quote with preimage but got state '%v' and preimage '%v'", meltQuote.State, meltQuote.Preimage)
 	}
 }
 
-func TestPendingProofs(t *testing.T) {
-	// use hodl invoice to cause payment to stuck and put quote and proofs in state of pending
-	preimage, _ := testutils.GenerateRandomBytes()
-	hash := sha256.Sum256(preimage)
-	hodlInvoice := invoicesrpc.AddHoldInvoiceRequest{Hash: hash[:], Value: 2100}
-	addHodlInvoiceRes, err := lnd2.InvoicesClient.AddHoldInvoice(ctx, &hodlInvoice)
+func TestMeltChange(t *testing.T) {
+	fakeBackend := &lightning.FakeBackend{}
+	config := mint.Config{
+		DB:              memory.NewMemoryDB(),
+		LightningClient: fakeBackend,
+		LogLevel:        mint.Disable,
+	}
+	changeMint, err := mint.LoadMint(config)
 	if err != nil {
-		t.Fatalf("error creating hodl invoice: %v", err)
+		t.Fatalf("unexpected error loading mint: %v", err)
 	}
-	paymentRequest := addHodlInvoiceRes.PaymentRequest
+	keyset := changeMint.GetActiveKeyset()
 
-	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	info, err := changeMint.RetrieveMintInfo()
 	if err != nil {
-		t.Fatalf("got unexpected error in melt request: %v", err)
+		t.Fatal(err)
+	}
+	if nut08 := info.Nuts[8].(map[string]bool); !nut08["supported"] {
+		t.Fatal("expected NUT-08 to be supported in mint info")
 	}
 
-	validProofs, err := testutils.GetValidProofsForAmount(2200, testMint, lnd2)
-	if err != nil {
-		t.Fatalf("error generating valid proofs: %v", err)
+	mintProofs := func(amount uint64) (cashu.Proofs, cashu.BlindedMessages) {
+		mintQuote, err := changeMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+		if err != nil {
+			t.Fatalf("error requesting mint quote: %v", err)
+		}
+		blindedMessages, secrets, rs, _ := testutils.CreateBlindedMessages(amount, keyset)
+		blindedSignatures, err := changeMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages})
+		if err != nil {
+			t.Fatalf("got unexpected error minting tokens: %v", err)
+		}
+		proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+		if err != nil {
+			t.Fatalf("error constructing proofs: %v", err)
+		}
+		return proofs, blindedMessages
+	}
+	// outputs with amount 0 for the mint to set
+	blankOutputs := func(count int) cashu.BlindedMessages {
+		outputs, _, _, _ := testutils.CreateBlindedMessages(1<<count-1, keyset)
+		for i := range outputs {
+			outputs[i].Amount = 0
+		}
+		return outputs
+	}
+	meltQuote := func() storage.MeltQuote {
+		invoice, _, _, err := lightning.CreateFakeInvoice(100, false)
+		if err != nil {
+			t.Fatalf("error creating invoice: %v", err)
+		}
+		quote, err := changeMint.RequestMeltQuote(nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()})
+		if err != nil {
+			t.Fatalf("got unexpected error in melt quote request: %v", err)
+		}
+		return quote
 	}
 
-	// custom context just for this melt call to timeout after 5s and return pending
-	// for the stuck hodl invoice
-	meltContext, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
+	// outputs that were already signed can't be used for change
+	proofs, signedOutputs := mintProofs(128)
+	quote := meltQuote()
+	_, err = changeMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: quote.Id, Inputs: proofs, Outputs: signedOutputs})
+	if !errors.Is(err, cashu.BlindedMessageAlreadySigned) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.BlindedMessageAlreadySigned, err)
+	}
 
-	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
-	melt, err := testMint.MeltTokens(meltContext, meltTokensRequest)
+	// overpaid 28 but only outputs for the 2 largest amounts
+	outputs := blankOutputs(2)
+	paidQuote, err := changeMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: quote.Id, Inputs: proofs, Outputs: outputs})
 	if err != nil {
 		t.Fatalf("got unexpected error in melt: %v", err)
 	}
-	if melt.State != nut05.Pending {
-		t.Fatalf("expected melt quote with state of '%s' but got '%s' instead", nut05.Pending, melt.State)
+	if paidQuote.State != nut05.Paid || len(paidQuote.Change) != 2 || paidQuote.Change.Amount() != 24 {
+		t.Fatalf("expected paid quote with change of 24 but got '%+v'", paidQuote)
 	}
 
-	meltQuote, err = testMint.GetMeltQuoteState(meltContext, meltQuote.Id)
+	// change of a payment that settles after the melt request
+	fakeBackend.PaymentDelay = 3600
+	proofs, _ = mintProofs(128)
+	quote = meltQuote()
+	outputs = blankOutputs(4)
+	pendingQuote, err := changeMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: quote.Id, Inputs: proofs, Outputs: outputs})
 	if err != nil {
-		t.Fatalf("unexpected error getting melt quote state: %v", err)
+		t.Fatalf("got unexpected error in melt: %v", err)
 	}
-	if meltQuote.State != nut05.Pending {
-		t.Fatalf("expected melt quote with state of '%s' but got '%s' instead", nut05.Pending, melt.State)
+	if pendingQuote.State != nut05.Pending || len(pendingQuote.Change) != 0 {
+		t.Fatalf("expected pending quote without change but got '%+v'", pendingQuote)
 	}
 
-	Ys := make([]string, len(validProofs))
-	for i, proof := range validProofs {
-		Y, _ := crypto.HashToCurve([]byte(proof.Secret))
-		Yhex := hex.EncodeToString(Y.SerializeCompressed())
-		Ys[i] = Yhex
-	}
+	paymentIdx := slices.IndexFunc(fakeBackend.Invoices, func(i lightning.FakeBackendInvoice) bool {
+		return i.PaymentHash == quote.PaymentHash
+	})
+	fakeBackend.Invoices[paymentIdx].Status = lightning.Succeeded
+	fakeBackend.Invoices[paymentIdx].FeeMsat = 2500
 
-	states, err := testMint.ProofsStateCheck(Ys)
-	if err != nil {
-		t.Fatalf("unexpected error checking states of proofs: %v", err)
-	}
-	for _, proofState := range states {
-		if proofState.State != nut07.Pending {
-			t.Fatalf("expected pending proof but got '%s' instead", proofState.State)
+	// 3 sats of routing fees so overpaid is 25
+	for range 2 {
+		quoteState, err := changeMint.GetMeltQuoteState(ctx, quote.Id)
+		if err != nil {
+			t.Fatalf("unexpected error getting quote state: %v", err)
+		}
+		if quoteState.State != nut05.Paid || len(quoteState.Change) != 3 || quoteState.Change.Amount() != 25 {
+			t.Fatalf("expected paid quote with change of 25 but got '%+v'", quoteState)
 		}
 	}
 
-	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
-	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
-	if !errors.Is(err, cashu.QuotePending) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.QuotePending, err)
+	// change can also be restored
+	_, signatures, err := changeMint.RestoreSignatures(outputs)
+	if err != nil {
+		t.Fatalf("unexpected error restoring signatures: %v", err)
 	}
-
-	// try to use currently pending proofs in another op.
-	// swap should return err saying proofs are pending
-	blindedMessages, _, _, _ := testutils.CreateBlindedMessages(validProofs.Amount(), testMint.GetActiveKeyset())
-	_, err = testMint.Swap(validProofs, blindedMessages)
-	if !errors.Is(err, cashu.ProofPendingErr) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.ProofPendingErr, err)
+	if signatures.Amount() != 25 {
+		t.Fatalf("expected restored change of 25 but got %v", signatures.Amount())
 	}
+}
 
-	settleHodlInvoice := invoicesrpc.SettleInvoiceMsg{Preimage: preimage}
-	_, err = lnd2.InvoicesClient.SettleInvoice(ctx, &settleHodlInvoice)
+func TestMeltChangeOutputsKeyset(t *testing.T) {
+	db := memory.NewMemoryDB()
+	config := mint.Config{DB: db, LightningClient: &lightning.FakeBackend{}, LogLevel: mint.Disable}
+	oldMint, err := mint.LoadMint(config)
 	if err != nil {
-		t.Fatalf("error settling hodl invoice: %v", err)
+		t.Fatalf("unexpected error loading mint: %v", err)
 	}
+	oldKeyset := oldMint.GetActiveKeyset()
 
-	meltQuote, err = testMint.GetMeltQuoteState(ctx, melt.Id)
+	var amount uint64 = 100
+	mintQuote, err := oldMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
 	if err != nil {
-		t.Fatalf("unexpected error getting melt quote state: %v", err)
+		t.Fatalf("error requesting mint quote: %v", err)
 	}
-	if meltQuote.State != nut05.Paid {
-		t.Fatalf("expected melt quote with state of '%s' but got '%s' instead", nut05.Paid, meltQuote.State)
+	blindedMessages, secrets, rs, _ := testutils.CreateBlindedMessages(amount, oldKeyset)
+	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages}
+	blindedSignatures, err := oldMint.MintTokens(mintTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &oldKeyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
 	}
 
-	expectedPreimage := hex.EncodeToString(preimage)
-	if meltQuote.Preimage != expectedPreimage {
-		t.Fatalf("expected melt quote with preimage of '%v' but got '%v' instead", preimage, meltQuote.Preimage)
+	// rotate keyset
+	config.DerivationPathIdx = 1
+	rotatedMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
 	}
+	newKeyset := rotatedMint.GetActiveKeyset()
 
-	states, err = testMint.ProofsStateCheck(Ys)
+	invoice, _, _, err := lightning.CreateFakeInvoice(50, false)
 	if err != nil {
-		t.Fatalf("unexpected error checking states of proofs: %v", err)
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	meltQuote, err := rotatedMint.RequestMeltQuote(nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
 
-	for _, proofState := range states {
-		if proofState.State != nut07.Spent {
-			t.Fatalf("expected spent proof but got '%s' instead", proofState.State)
+	blankOutputs := func(keyset crypto.MintKeyset) cashu.BlindedMessages {
+		outputs, _, _, _ := testutils.CreateBlindedMessages(1, keyset)
+		outputs[0].Amount = 0
+		return outputs
+	}
+	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: proofs, Outputs: blankOutputs(oldKeyset)}
+	_, err = rotatedMint.MeltTokens(ctx, meltTokensRequest)
+	if !errors.Is(err, cashu.InactiveKeysetSignatureRequest) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.InactiveKeysetSignatureRequest, err)
+	}
+
+	meltTokensRequest.Outputs = blankOutputs(newKeyset)
+	meltQuote, err = rotatedMint.MeltTokens(ctx, meltTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if meltQuote.State != nut05.Paid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Paid, meltQuote.State)
+	}
+}
+
+func TestInternalSettlement(t *testing.T) {
+	fakeBackend := &lightning.FakeBackend{FeeReserveMsat: 2000}
+	loadMint := func(hideInternalSettlement bool) *mint.Mint {
+		config := mint.Config{
+			DB:                     memory.NewMemoryDB(),
+			LightningClient:        fakeBackend,
+			LogLevel:               mint.Disable,
+			HideInternalSettlement: hideInternalSettlement,
+		}
+		testMint, err := mint.LoadMint(config)
+		if err != nil {
+			t.Fatalf("unexpected error loading mint: %v", err)
+		}
+		return testMint
+	}
+	mintProofs := func(testMint *mint.Mint, amount uint64) cashu.Proofs {
+		keyset := testMint.GetActiveKeyset()
+		mintQuote, err := testMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+		if err != nil {
+			t.Fatalf("error requesting mint quote: %v", err)
+		}
+		blindedMessages, secrets, rs, _ := testutils.CreateBlindedMessages(amount, keyset)
+		blindedSignatures, err := testMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages})
+		if err != nil {
+			t.Fatalf("got unexpected error minting tokens: %v", err)
+		}
+		proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+		if err != nil {
+			t.Fatalf("error constructing proofs: %v", err)
+		}
+		return proofs
+	}
+	internalMeltQuote := func(testMint *mint.Mint) storage.MeltQuote {
+		mintQuote, err := testMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: 100, Unit: cashu.Sat.String()})
+		if err != nil {
+			t.Fatalf("error requesting mint quote: %v", err)
+		}
+		meltQuote, err := testMint.RequestMeltQuote(nut05.PostMeltQuoteBolt11Request{
+			Request: mintQuote.PaymentRequest,
+			Unit:    cashu.Sat.String(),
+		})
+		if err != nil {
+			t.Fatalf("got unexpected error in melt quote request: %v", err)
 		}
+		return meltQuote
+	}
+
+	// fee is 0 for quotes settled internally
+	testMint := loadMint(false)
+	meltQuote := internalMeltQuote(testMint)
+	if meltQuote.FeeReserve != 0 {
+		t.Fatalf("expected fee reserve of 0 but got %v", meltQuote.FeeReserve)
+	}
+
+	// fee reserve is kept and returned as change
+	testMint = loadMint(true)
+	meltQuote = internalMeltQuote(testMint)
+	if meltQuote.FeeReserve != 2 {
+		t.Fatalf("expected fee reserve of 2 but got %v", meltQuote.FeeReserve)
+	}
+	proofs := mintProofs(testMint, 102)
+	outputs, _, _, _ := testutils.CreateBlindedMessages(3, testMint.GetActiveKeyset())
+	for i := range outputs {
+		outputs[i].Amount = 0
+	}
+	paidQuote, err := testMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: proofs, Outputs: outputs})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if paidQuote.State != nut05.Paid || paidQuote.Change.Amount() != 2 {
+		t.Fatalf("expected paid quote with change of 2 but got '%+v'", paidQuote)
 	}
 }
 
-func TestConcurrentMint(t *testing.T) {
-	var mintAmount uint64 = 2100
-	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, _ := testMint.RequestMintQuote(mintQuoteRequest)
+func TestMeltQuoteState(t *testing.T) {
+	invoice := lnrpc.Invoice{Value: 2000}
+	addInvoiceResponse, err := lnd2.Client.AddInvoice(ctx, &invoice)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	paymentRequest := addInvoiceResponse.PaymentRequest
 
-	keyset := testMint.GetActiveKeyset()
-	blindedMessages, _, _, _ := testutils.CreateBlindedMessages(mintAmount, keyset)
+	lookupInvoice, err := lnd2.Client.LookupInvoice(ctx, &lnrpc.PaymentHash{RHash: addInvoiceResponse.RHash})
+	if err != nil {
+		t.Fatalf("error finding invoice: %v", err)
+	}
 
-	//pay invoice
-	sendPaymentRequest := lnrpc.SendRequest{
-		PaymentRequest: mintQuoteResponse.PaymentRequest,
+	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
+	meltRequest, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
 	}
-	response, _ := lnd2.Client.SendPaymentSync(ctx, &sendPaymentRequest)
-	if len(response.PaymentError) > 0 {
-		t.Fatalf("error paying invoice: %v", response.PaymentError)
+
+	// test invalid quote id
+	_, err = testMint.GetMeltQuoteState(ctx, "quote1234")
+	if !errors.Is(err, cashu.QuoteNotExistErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.PaymentMethodNotSupportedErr, err)
 	}
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	// test 100 concurrent requests to mint tokens for same quote id
-	errCount := 0
-	numRequests := 100
-	for i := 0; i < numRequests; i++ {
-		wg.Add(1)
-		go func() {
-			mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
-			_, err := testMint.MintTokens(mintTokensRequest)
-			if err != nil {
-				mu.Lock()
-				errCount++
-				mu.Unlock()
-			}
-			wg.Done()
-		}()
+	// test before paying melt
+	meltQuote, err := testMint.GetMeltQuoteState(ctx, meltRequest.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting melt quote state: %v", err)
+	}
+	if meltQuote.State != nut05.Unpaid {
+		t.Fatalf("expected quote state '%s' but got '%s' instead", nut05.Unpaid, meltQuote.State)
 	}
-	wg.Wait()
 
-	// out of the 100 requests only 1 should have succeeded.
-	// there should be 99 errors
-	if errCount != 99 {
-		t.Fatalf("expected 99 errors but got %v", errCount)
+	// test state after melting
+	validProofs, err := testutils.GetValidProofsForAmount(6500, testMint, lnd2)
+	if err != nil {
+		t.Fatalf("error generating valid proofs: %v", err)
+	}
+
+	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
+	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+
+	meltQuote, err = testMint.GetMeltQuoteState(ctx, meltRequest.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting melt quote state: %v", err)
+	}
+	if meltQuote.State != nut05.Paid {
+		t.Fatalf("expected quote state '%s' but got '%s' instead", nut05.Paid, meltQuote.State)
+	}
+	preimageString := hex.EncodeToString(lookupInvoice.RPreimage)
+	if meltQuote.Preimage != preimageString {
+		t.Fatalf("expected quote preimage '%v' but got '%v' instead", preimageString, meltQuote.Preimage)
 	}
 
 }
 
-func TestConcurrentSwap(t *testing.T) {
-	var amount uint64 = 2100
-	proofs, err := testutils.GetValidProofsForAmount(amount, testMint, lnd2)
+func TestMelt(t *testing.T) {
+	var amount uint64 = 1000
+	underProofs, err := testutils.GetValidProofsForAmount(amount, testMint, lnd2)
 	if err != nil {
 		t.Fatalf("error generating valid proofs: %v", err)
 	}
 
-	keyset := testMint.GetActiveKeyset()
+	invoice := lnrpc.Invoice{Value: 6000}
+	addInvoiceResponse, err := lnd2.Client.AddInvoice(ctx, &invoice)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	paymentRequest := addInvoiceResponse.PaymentRequest
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex
-	// test 100 concurrent swap requests using same proofs
-	errCount := 0
-	numRequests := 100
-	for i := 0; i < numRequests; i++ {
-		wg.Add(1)
-		go func() {
-			blindedMessages, _, _, _ := testutils.CreateBlindedMessages(amount, keyset)
-			_, err := testMint.Swap(proofs, blindedMessages)
-			if err != nil {
-				mu.Lock()
-				errCount++
-				mu.Unlock()
-			}
-			wg.Done()
-		}()
+	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
+	meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+
+	// test proofs amount under melt amount
+	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: underProofs}
+	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
+	if !errors.Is(err, cashu.InsufficientProofsAmount) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.PaymentMethodNotSupportedErr, err)
+	}
+
+	validProofs, err := testutils.GetValidProofsForAmount(6500, testMint, lnd2)
+	if err != nil {
+		t.Fatalf("error generating valid proofs: %v", err)
+	}
+	validSecret := validProofs[0].Secret
+
+	// test invalid proofs
+	validProofs[0].Secret = "some invalid secret"
+	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
+	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
+	if !errors.Is(err, cashu.InvalidProofErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.InvalidProofErr, err)
+	}
+
+	validProofs[0].Secret = validSecret
+
+	// test with duplicates in proofs list passed
+	proofsLen := len(validProofs)
+	duplicateProofs := make(cashu.Proofs, proofsLen)
+	copy(duplicateProofs, validProofs)
+	duplicateProofs[proofsLen-2] = duplicateProofs[proofsLen-1]
+	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: duplicateProofs}
+	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
+	if !errors.Is(err, cashu.DuplicateProofs) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.DuplicateProofs, err)
+	}
+
+	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
+	melt, err := testMint.MeltTokens(ctx, meltTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if melt.State != nut05.Paid {
+		t.Fatal("got unexpected unpaid melt quote")
+	}
+
+	// test quote already paid
+	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
+	if !errors.Is(err, cashu.MeltQuoteAlreadyPaid) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltQuoteAlreadyPaid, err)
+	}
+
+	invoice = lnrpc.Invoice{Value: 6000}
+	addInvoiceResponse, err = lnd2.Client.AddInvoice(ctx, &invoice)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	paymentRequest = addInvoiceResponse.PaymentRequest
+
+	// test already used proofs
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
+	newQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+
+	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: newQuote.Id, Inputs: validProofs}
+	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
+	if !errors.Is(err, cashu.ProofAlreadyUsedErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.ProofAlreadyUsedErr, err)
+	}
+
+	// mint with fees
+	mintFeesPath := filepath.Join(".", "mintfeesmelt")
+	mintFees, err := testutils.CreateTestMint(lnd1, mintFeesPath, 100, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mintFeesPath)
+
+	amount = 6000
+	underProofs, err = testutils.GetValidProofsForAmount(amount, mintFees, lnd2)
+	if err != nil {
+		t.Fatalf("error generating valid proofs: %v", err)
+	}
+
+	amount = 6500
+	validProofsWithFees, err := testutils.GetValidProofsForAmount(amount, mintFees, lnd2)
+	if err != nil {
+		t.Fatalf("error generating valid proofs: %v", err)
+	}
+
+	addInvoiceResponse, err = lnd2.Client.AddInvoice(ctx, &invoice)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	paymentRequest = addInvoiceResponse.PaymentRequest
+
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
+	meltQuote, err = mintFees.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+
+	// test proofs below needed amount with fees
+	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: underProofs}
+	_, err = mintFees.MeltTokens(ctx, meltTokensRequest)
+	if !errors.Is(err, cashu.InsufficientProofsAmount) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.InsufficientProofsAmount, err)
+	}
+
+	// test valid proofs accounting for fees
+	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofsWithFees}
+	melt, err = mintFees.MeltTokens(ctx, meltTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if melt.State != nut05.Paid {
+		t.Fatal("got unexpected unpaid melt quote")
+	}
+
+	// test failed lightning payment
+	lnd3, err := btcdocker.NewLnd(ctx, bitcoind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lnd3.Terminate(ctx)
+
+	// create invoice from node for which there is no route so payment fails
+	noRoute := lnrpc.Invoice{Value: 2000}
+	noRouteInvoice, err := lnd3.Client.AddInvoice(ctx, &noRoute)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	paymentRequest = noRouteInvoice.PaymentRequest
+
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
+	meltQuote, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+
+	validProofs, err = testutils.GetValidProofsForAmount(6500, testMint, lnd2)
+	if err != nil {
+		t.Fatalf("error generating valid proofs: %v", err)
+	}
+
+	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
+	meltResponse, err := testMint.MeltTokens(ctx, meltTokensRequest)
+	if meltResponse.State != nut05.Unpaid {
+		// expecting unpaid since payment should have failed
+		t.Fatalf("expected melt quote with state of '%s' but got '%s' instead", nut05.Unpaid, meltResponse.State)
+	}
+
+	// test internal quotes (mint and melt quotes with same invoice)
+	var mintAmount uint64 = 42000
+	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
+	mintQuoteResponse, err := testMint.RequestMintQuote(mintQuoteRequest)
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	keyset := testMint.GetActiveKeyset()
+	blindedMessages, _, _, err := testutils.CreateBlindedMessages(mintAmount, keyset)
+
+	proofs, err := testutils.GetValidProofsForAmount(mintAmount, testMint, lnd2)
+	if err != nil {
+		t.Fatalf("error generating valid proofs: %v", err)
+	}
+
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
+		Request: mintQuoteResponse.PaymentRequest,
+		Unit:    cashu.Sat.String(),
+	}
+	meltQuote, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+	if meltQuote.FeeReserve != 0 {
+		t.Fatal("RequestMeltQuote did not return fee reserve of 0 for internal quote")
+	}
+
+	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: proofs}
+	melt, err = testMint.MeltTokens(ctx, meltTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if len(melt.Preimage) == 0 {
+		t.Fatal("melt returned empty preimage")
+	}
+
+	// now mint should work because quote was settled internally
+	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
+	_, err = testMint.MintTokens(mintTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in mint: %v", err)
+	}
+}
+
+func TestMPPMelt(t *testing.T) {
+	lnd3, err := btcdocker.NewLnd(ctx, bitcoind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lnd4, err := btcdocker.NewLnd(ctx, bitcoind)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		lnd3.Terminate(ctx)
+		lnd4.Terminate(ctx)
+	}()
+	if err := testutils.FundLndNode(ctx, bitcoind, lnd2); err != nil {
+		t.Fatal(err)
+	}
+	if err := testutils.OpenChannel(ctx, bitcoind, lnd1, lnd3, 1500000); err != nil {
+		t.Fatal(err)
+	}
+	if err := testutils.OpenChannel(ctx, bitcoind, lnd2, lnd3, 1500000); err != nil {
+		t.Fatal(err)
+	}
+
+	testMppMintPath := filepath.Join(".", "testmppmint2")
+	testMppMint, err := testutils.CreateTestMint(lnd2, testMppMintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testMppMintPath)
+
+	invoice := lnrpc.Invoice{Value: 10000}
+	addInvoiceResponse, err := lnd3.Client.AddInvoice(ctx, &invoice)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+
+	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{
+		Request: addInvoiceResponse.PaymentRequest,
+		Unit:    cashu.Sat.String(),
+		Options: &nut05.MeltOptions{Mpp: &nut05.MppOption{Amount: 6000}},
+	}
+	meltQuote1, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
+		Request: addInvoiceResponse.PaymentRequest,
+		Unit:    cashu.Sat.String(),
+		Options: &nut05.MeltOptions{Mpp: &nut05.MppOption{Amount: 4000}},
+	}
+	meltQuote2, err := testMppMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+
+	// get valid proofs to use in melts
+	validProofsFromMint1, _ := testutils.GetValidProofsForAmount(6100, testMint, lnd3)
+	validProofsFromMint2, _ := testutils.GetValidProofsForAmount(4100, testMppMint, lnd3)
+
+	// do melt tokens request concurrently
+	type result struct {
+		meltResult storage.MeltQuote
+		err        error
+	}
+	meltResults := make([]result, 2)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote1.Id, Inputs: validProofsFromMint1}
+		melt, err := testMint.MeltTokens(ctx, meltTokensRequest)
+		meltResults[0] = result{meltResult: melt, err: err}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote2.Id, Inputs: validProofsFromMint2}
+		melt, err := testMppMint.MeltTokens(ctx, meltTokensRequest)
+		meltResults[1] = result{meltResult: melt, err: err}
+	}()
+	wg.Wait()
+
+	for i, result := range meltResults {
+		if result.err != nil {
+			t.Fatalf("got unexpected error in melt '%v': %v", i, err)
+		}
+		if result.meltResult.State != nut05.Paid {
+			t.Fatalf("got unexpected UNPAID state in melt quote '%v'", i)
+		}
+	}
+
+	// MPP will fail because there is no route
+	invoice = lnrpc.Invoice{Value: 10000}
+	addInvoiceResponse, err = lnd4.Client.AddInvoice(ctx, &invoice)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
+		Request: addInvoiceResponse.PaymentRequest,
+		Unit:    cashu.Sat.String(),
+		Options: &nut05.MeltOptions{Mpp: &nut05.MppOption{Amount: 6000}},
+	}
+	meltQuote1, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
+		Request: addInvoiceResponse.PaymentRequest,
+		Unit:    cashu.Sat.String(),
+		Options: &nut05.MeltOptions{Mpp: &nut05.MppOption{Amount: 4000}},
+	}
+	meltQuote2, err = testMppMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+
+	// get valid proofs to use in melts
+	validProofsFromMint1, _ = testutils.GetValidProofsForAmount(6100, testMint, lnd3)
+	validProofsFromMint2, _ = testutils.GetValidProofsForAmount(4100, testMppMint, lnd3)
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote1.Id, Inputs: validProofsFromMint1}
+		melt, err := testMint.MeltTokens(ctx, meltTokensRequest)
+		meltResults[0] = result{meltResult: melt, err: err}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote2.Id, Inputs: validProofsFromMint2}
+		melt, err := testMppMint.MeltTokens(ctx, meltTokensRequest)
+		meltResults[1] = result{meltResult: melt, err: err}
+	}()
+	wg.Wait()
+
+	for i, result := range meltResults {
+		if result.err != nil {
+			t.Fatalf("got unexpected error in melt '%v': %v", i, err)
+		}
+		if result.meltResult.State != nut05.Unpaid {
+			t.Fatalf("expected melt in UNPAID state but got it in '%s' state", result.meltResult.State)
+		}
+	}
+
+	// test err on mpp amount over invoice amount
+	invoice = lnrpc.Invoice{Value: 10000}
+	addInvoiceResponse, err = lnd4.Client.AddInvoice(ctx, &invoice)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
+		Request: addInvoiceResponse.PaymentRequest,
+		Unit:    cashu.Sat.String(),
+		Options: &nut05.MeltOptions{Mpp: &nut05.MppOption{Amount: 10100}},
+	}
+	meltQuote1, err = testMint.RequestMeltQuote(meltQuoteRequest)
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	expectedErrMsg := "mpp amount is not less than amount in invoice"
+	if err.Error() != expectedErrMsg {
+		t.Fatalf("expected error '%v' but got '%v'", expectedErrMsg, err.Error())
+	}
+
+	// test pending in-flight payments
+	preimage, _ := testutils.GenerateRandomBytes()
+	hash := sha256.Sum256(preimage)
+	hodlInvoice := invoicesrpc.AddHoldInvoiceRequest{Hash: hash[:], Value: 2100}
+	addHodlInvoiceRes, err := lnd2.InvoicesClient.AddHoldInvoice(ctx, &hodlInvoice)
+	if err != nil {
+		t.Fatalf("error creating hodl invoice: %v", err)
+	}
+
+	meltContext, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{
+		Request: addHodlInvoiceRes.PaymentRequest,
+		Unit:    cashu.Sat.String(),
+		Options: &nut05.MeltOptions{Mpp: &nut05.MppOption{Amount: 2000}},
+	}
+	meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+	validProofsFromMint, _ := testutils.GetValidProofsForAmount(2100, testMint, lnd3)
+	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofsFromMint}
+	melt, err := testMint.MeltTokens(meltContext, meltTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if melt.State != nut05.Pending {
+		t.Fatalf("expected melt quote with state of '%s' but got '%s' instead", nut05.Pending, melt.State)
+	}
+
+	meltQuote, err = testMint.GetMeltQuoteState(meltContext, meltQuote.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting melt quote state: %v", err)
+	}
+	if meltQuote.State != nut05.Pending {
+		t.Fatalf("expected melt quote with state of '%s' but got '%s' instead", nut05.Pending, melt.State)
+	}
+
+	Ys := make([]string, len(validProofsFromMint))
+	for i, proof := range validProofsFromMint {
+		Y, _ := crypto.HashToCurve([]byte(proof.Secret))
+		Yhex := hex.EncodeToString(Y.SerializeCompressed())
+		Ys[i] = Yhex
+	}
+
+	states, err := testMint.ProofsStateCheck(Ys)
+	if err != nil {
+		t.Fatalf("unexpected error checking states of proofs: %v", err)
+	}
+	for _, proofState := range states {
+		if proofState.State != nut07.Pending {
+			t.Fatalf("expected pending proof but got '%s' instead", proofState.State)
+		}
+	}
+}
+
+func TestPendingProofs(t *testing.T) {
+	// use hodl invoice to cause payment to stuck and put quote and proofs in state of pending
+	preimage, _ := testutils.GenerateRandomBytes()
+	hash := sha256.Sum256(preimage)
+	hodlInvoice := invoicesrpc.AddHoldInvoiceRequest{Hash: hash[:], Value: 2100}
+	addHodlInvoiceRes, err := lnd2.InvoicesClient.AddHoldInvoice(ctx, &hodlInvoice)
+	if err != nil {
+		t.Fatalf("error creating hodl invoice: %v", err)
+	}
+	paymentRequest := addHodlInvoiceRes.PaymentRequest
+
+	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
+	meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+
+	validProofs, err := testutils.GetValidProofsForAmount(2200, testMint, lnd2)
+	if err != nil {
+		t.Fatalf("error generating valid proofs: %v", err)
+	}
+
+	// custom context just for this melt call to timeout after 5s and return pending
+	// for the stuck hodl invoice
+	meltContext, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
+	melt, err := testMint.MeltTokens(meltContext, meltTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if melt.State != nut05.Pending {
+		t.Fatalf("expected melt quote with state of '%s' but got '%s' instead", nut05.Pending, melt.State)
+	}
+
+	meltQuote, err = testMint.GetMeltQuoteState(meltContext, meltQuote.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting melt quote state: %v", err)
+	}
+	if meltQuote.State != nut05.Pending {
+		t.Fatalf("expected melt quote with state of '%s' but got '%s' instead", nut05.Pending, melt.State)
+	}
+
+	Ys := make([]string, len(validProofs))
+	for i, proof := range validProofs {
+		Y, _ := crypto.HashToCurve([]byte(proof.Secret))
+		Yhex := hex.EncodeToString(Y.SerializeCompressed())
+		Ys[i] = Yhex
+	}
+
+	states, err := testMint.ProofsStateCheck(Ys)
+	if err != nil {
+		t.Fatalf("unexpected error checking states of proofs: %v", err)
+	}
+	for _, proofState := range states {
+		if proofState.State != nut07.Pending {
+			t.Fatalf("expected pending proof but got '%s' instead", proofState.State)
+		}
+	}
+
+	meltTokensRequest = nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
+	_, err = testMint.MeltTokens(ctx, meltTokensRequest)
+	if !errors.Is(err, cashu.QuotePending) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.QuotePending, err)
+	}
+
+	// try to use currently pending proofs in another op.
+	// swap should return err saying proofs are pending
+	blindedMessages, _, _, _ := testutils.CreateBlindedMessages(validProofs.Amount(), testMint.GetActiveKeyset())
+	_, err = testMint.Swap(validProofs, blindedMessages)
+	if !errors.Is(err, cashu.ProofPendingErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.ProofPendingErr, err)
+	}
+
+	settleHodlInvoice := invoicesrpc.SettleInvoiceMsg{Preimage: preimage}
+	_, err = lnd2.InvoicesClient.SettleInvoice(ctx, &settleHodlInvoice)
+	if err != nil {
+		t.Fatalf("error settling hodl invoice: %v", err)
+	}
+
+	meltQuote, err = testMint.GetMeltQuoteState(ctx, melt.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting melt quote state: %v", err)
+	}
+	if meltQuote.State != nut05.Paid {
+		t.Fatalf("expected melt quote with state of '%s' but got '%s' instead", nut05.Paid, meltQuote.State)
+	}
+
+	expectedPreimage := hex.EncodeToString(preimage)
+	if meltQuote.Preimage != expectedPreimage {
+		t.Fatalf("expected melt quote with preimage of '%v' but got '%v' instead", preimage, meltQuote.Preimage)
+	}
+
+	states, err = testMint.ProofsStateCheck(Ys)
+	if err != nil {
+		t.Fatalf("unexpected error checking states of proofs: %v", err)
+	}
+
+	for _, proofState := range states {
+		if proofState.State != nut07.Spent {
+			t.Fatalf("expected spent proof but got '%s' instead", proofState.State)
+		}
+	}
+}
+
+func TestConcurrentMint(t *testing.T) {
+	var mintAmount uint64 = 2100
+	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
+	mintQuoteResponse, _ := testMint.RequestMintQuote(mintQuoteRequest)
+
+	keyset := testMint.GetActiveKeyset()
+	blindedMessages, _, _, _ := testutils.CreateBlindedMessages(mintAmount, keyset)
+
+	//pay invoice
+	sendPaymentRequest := lnrpc.SendRequest{
+		PaymentRequest: mintQuoteResponse.PaymentRequest,
+	}
+	response, _ := lnd2.Client.SendPaymentSync(ctx, &sendPaymentRequest)
+	if len(response.PaymentError) > 0 {
+		t.Fatalf("error paying invoice: %v", response.PaymentError)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	// test 100 concurrent requests to mint tokens for same quote id
+	errCount := 0
+	numRequests := 100
+	for i := 0; i < numRequests; i++ {
+		wg.Add(1)
+		go func() {
+			mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
+			_, err := testMint.MintTokens(mintTokensRequest)
+			if err != nil {
+				mu.Lock()
+				errCount++
+				mu.Unlock()
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	// out of the 100 requests only 1 should have succeeded.
+	// there should be 99 errors
+	if errCount != 99 {
+		t.Fatalf("expected 99 errors but got %v", errCount)
+	}
+
+}
+
+func TestConcurrentSwap(t *testing.T) {
+	var amount uint64 = 2100
+	proofs, err := testutils.GetValidProofsForAmount(amount, testMint, lnd2)
+	if err != nil {
+		t.Fatalf("error generating valid proofs: %v", err)
+	}
+
+	keyset := testMint.GetActiveKeyset()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	// test 100 concurrent swap requests using same proofs
+	errCount := 0
+	numRequests := 100
+	for i := 0; i < numRequests; i++ {
+		wg.Add(1)
+		go func() {
+			blindedMessages, _, _, _ := testutils.CreateBlindedMessages(amount, keyset)
+			_, err := testMint.Swap(proofs, blindedMessages)
+			if err != nil {
+				mu.Lock()
+				errCount++
+				mu.Unlock()
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	// out of the 100 requests only 1 should have succeeded.
+	// there should be 99 errors
+	if errCount != 99 {
+		t.Fatalf("expected 99 errors but got %v", errCount)
+	}
+}
+
+func TestConcurrentMelt(t *testing.T) {
+	var amount uint64 = 210
+	numRequests := 100
+	meltQuotes := make([]string, numRequests)
+
+	var feeReserve uint64 = 0
+	// create 100 melt quotes
+	for i := 0; i < numRequests; i++ {
+		invoice := lnrpc.Invoice{Value: int64(amount)}
+		addInvoiceResponse, err := lnd2.Client.AddInvoice(ctx, &invoice)
+		if err != nil {
+			t.Fatalf("error creating invoice: %v", err)
+		}
+		paymentRequest := addInvoiceResponse.PaymentRequest
+
+		meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
+		meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+		if err != nil {
+			t.Fatalf("got unexpected error in melt request: %v", err)
+		}
+		meltQuotes[i] = meltQuote.Id
+		feeReserve = meltQuote.FeeReserve
+	}
+
+	proofs, err := testutils.GetValidProofsForAmount(amount+feeReserve, testMint, lnd2)
+	if err != nil {
+		t.Fatalf("error generating valid proofs: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	// for the created melt quotes, do concurrent requests for each one using the same set of proofs
+	// only 1 should succeed
+	errCount := 0
+	for i := 0; i < numRequests; i++ {
+		wg.Add(1)
+		go func() {
+			meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuotes[i], Inputs: proofs}
+			_, err := testMint.MeltTokens(ctx, meltTokensRequest)
+			if err != nil {
+				mu.Lock()
+				errCount++
+				mu.Unlock()
+			}
+			wg.Done()
+		}()
+	}
+	wg.Wait()
+
+	// out of the 100 requests only 1 should have succeeded.
+	// there should be 99 errors
+	if errCount != 99 {
+		t.Fatalf("expected 99 errors but got %v", errCount)
+	}
+
+}
+
+func TestProofsStateCheck(t *testing.T) {
+	proofs, err := testutils.GetValidProofsForAmount(5000, testMint, lnd2)
+	if err != nil {
+		t.Fatalf("error generating valid proofs: %v", err)
+	}
+
+	// proofs with P2PK witness
+	lock, _ := btcec.NewPrivateKey()
+	p2pkSpendingCondition := nut10.SpendingCondition{
+		Kind: nut10.P2PK,
+		Data: hex.EncodeToString(lock.PubKey().SerializeCompressed()),
+	}
+	p2pkProofs, err := testutils.GetProofsWithSpendingCondition(2100, p2pkSpendingCondition, testMint, lnd2)
+	if err != nil {
+		t.Fatalf("error getting locked proofs: %v", err)
+	}
+	p2pkProofs, _ = testutils.AddP2PKWitnessToInputs(p2pkProofs, []*btcec.PrivateKey{lock})
+
+	// proofs with HTLC witness
+	preimage := "111111"
+	preimageBytes, _ := hex.DecodeString(preimage)
+	hashBytes := sha256.Sum256(preimageBytes)
+	htlcSpendingCondition := nut10.SpendingCondition{
+		Kind: nut10.HTLC,
+		Data: hex.EncodeToString(hashBytes[:]),
+	}
+	htlcProofs, err := testutils.GetProofsWithSpendingCondition(2100, htlcSpendingCondition, testMint, lnd2)
+	if err != nil {
+		t.Fatalf("error getting locked proofs: %v", err)
+	}
+	htlcProofs, _ = testutils.AddHTLCWitnessToInputs(htlcProofs, preimage, nil)
+
+	tests := []struct {
+		proofs cashu.Proofs
+	}{
+		{proofs},
+		{p2pkProofs},
+		{htlcProofs},
+	}
+
+	for _, test := range tests {
+		Ys := make([]string, len(test.proofs))
+		for i, proof := range test.proofs {
+			Y, _ := crypto.HashToCurve([]byte(proof.Secret))
+			Yhex := hex.EncodeToString(Y.SerializeCompressed())
+			Ys[i] = Yhex
+		}
+
+		proofStates, err := testMint.ProofsStateCheck(Ys)
+		if err != nil {
+			t.Fatalf("unexpected error checking proof states: %v", err)
+		}
+
+		// proofs should be unspent here
+		for _, proofState := range proofStates {
+			if proofState.State != nut07.Unspent {
+				t.Fatalf("expected proof state '%s' but got '%s'", nut07.Unspent, proofState.State)
+			}
+		}
+
+		// spend proofs and check spent state in response from mint
+		proofsToSpend := cashu.Proofs{}
+		numProofs := len(test.proofs) / 2
+		Ys = make([]string, numProofs)
+		for i := 0; i < numProofs; i++ {
+			proofsToSpend = append(proofsToSpend, test.proofs[i])
+			Y, _ := crypto.HashToCurve([]byte(test.proofs[i].Secret))
+			Yhex := hex.EncodeToString(Y.SerializeCompressed())
+			Ys[i] = Yhex
+		}
+
+		blindedMessages, _, _, _ := testutils.CreateBlindedMessages(proofsToSpend.Amount(), testMint.GetActiveKeyset())
+		_, err = testMint.Swap(proofsToSpend, blindedMessages)
+		if err != nil {
+			t.Fatalf("unexpected error in swap: %v", err)
+		}
+
+		proofStates, err = testMint.ProofsStateCheck(Ys)
+		if err != nil {
+			t.Fatalf("unexpected error checking proof states: %v", err)
+		}
+
+		for i, proofState := range proofStates {
+			if proofState.State != nut07.Spent {
+				t.Fatalf("expected proof state '%s' but got '%s'", nut07.Spent, proofState.State)
+			}
+
+			if len(proofsToSpend[i].Witness) > 0 {
+				if proofState.Witness != proofsToSpend[i].Witness {
+					t.Fatalf("expected state witness '%s' but got '%s'", proofsToSpend[i].Witness, proofState.Witness)
+				}
+			}
+		}
+	}
+}
+
+func TestSignedProofStates(t *testing.T) {
+	config := mint.Config{
+		DB:              memory.NewMemoryDB(),
+		LightningClient: &lightning.FakeBackend{},
+		LogLevel:        mint.Disable,
+	}
+	Ys := make([]string, 3)
+	for i := range Ys {
+		Y, _ := crypto.HashToCurve([]byte(fmt.Sprintf("secret%v", i)))
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+	}
+
+	// responses are not signed if it is not enabled
+	unsignedMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	states, err := unsignedMint.ProofsStateCheck(Ys)
+	if err != nil {
+		t.Fatalf("unexpected error checking proof states: %v", err)
+	}
+	response, err := unsignedMint.CheckStateResponse(states)
+	if err != nil {
+		t.Fatalf("unexpected error getting check state response: %v", err)
+	}
+	if len(response.Signature) > 0 || response.Timestamp != 0 {
+		t.Fatalf("expected response without signature but got '%+v'", response)
+	}
+
+	config.SignProofStates = true
+	signingMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	info, err := signingMint.RetrieveMintInfo()
+	if err != nil {
+		t.Fatalf("unexpected error getting mint info: %v", err)
+	}
+	if nut07Setting, ok := info.Nuts[7].(map[string]bool); !ok || !nut07Setting["signed"] {
+		t.Fatalf("expected signed proof states in mint info but got '%v'", info.Nuts[7])
+	}
+	pubkeyBytes, _ := hex.DecodeString(info.Pubkey)
+	pubkey, err := btcec.ParsePubKey(pubkeyBytes)
+	if err != nil {
+		t.Fatalf("invalid pubkey in mint info: %v", err)
+	}
+
+	states, err = signingMint.ProofsStateCheck(Ys)
+	if err != nil {
+		t.Fatalf("unexpected error checking proof states: %v", err)
+	}
+	response, err = signingMint.CheckStateResponse(states)
+	if err != nil {
+		t.Fatalf("unexpected error getting check state response: %v", err)
+	}
+	if response.Timestamp == 0 {
+		t.Fatal("expected timestamp in signed response")
+	}
+	if !nut07.VerifyStates(response, pubkey) {
+		t.Fatal("expected valid signature of proof states with mint info pubkey")
+	}
+
+	response.States[0].State = nut07.Spent
+	if nut07.VerifyStates(response, pubkey) {
+		t.Fatal("expected invalid signature after changing proof state")
+	}
+}
+
+func TestRestoreSignatures(t *testing.T) {
+	// create blinded messages
+	blindedMessages, _, _, blindedSignatures, err := testutils.GetBlindedSignatures(5000, testMint, lnd2)
+	if err != nil {
+		t.Fatalf("error generating blinded signatures: %v", err)
+	}
+
+	outputs, signatures, err := testMint.RestoreSignatures(blindedMessages)
+	if err != nil {
+		t.Fatalf("unexpected error restoring signatures: %v\n", err)
+	}
+
+	if len(outputs) != len(signatures) {
+		t.Fatalf("length of ouputs '%v' does not match length of signatures '%v'\n", len(outputs), len(signatures))
+	}
+	if !reflect.DeepEqual(blindedMessages, outputs) {
+		t.Fatal("outputs in request do not match outputs from mint response")
+	}
+	if !reflect.DeepEqual(blindedSignatures, signatures) {
+		t.Fatal("blinded signatures do not match signatures from mint response")
+	}
+
+	// test with blinded messages that have not been previously signed
+	unsigned, _, _, _ := testutils.CreateBlindedMessages(4200, testMint.GetActiveKeyset())
+	outputs, signatures, err = testMint.RestoreSignatures(unsigned)
+	if err != nil {
+		t.Fatalf("unexpected error restoring signatures: %v\n", err)
+	}
+
+	// response should be empty
+	if len(outputs) != 0 && len(signatures) != 0 {
+		t.Fatalf("expected empty outputs and signatures but got %v and %v\n", len(outputs), len(signatures))
+	}
+
+	// test with only a portion of blinded messages signed
+	partial := append(blindedMessages, unsigned...)
+	outputs, signatures, err = testMint.RestoreSignatures(partial)
+	if err != nil {
+		t.Fatalf("unexpected error restoring signatures: %v\n", err)
+	}
+
+	if len(outputs) != len(signatures) {
+		t.Fatalf("length of ouputs '%v' does not match length of signatures '%v'\n", len(outputs), len(signatures))
+	}
+	if !reflect.DeepEqual(blindedMessages, outputs) {
+		t.Fatal("outputs in request do not match outputs from mint response")
+	}
+	if !reflect.DeepEqual(blindedSignatures, signatures) {
+		t.Fatal("blinded signatures do not match signatures from mint response")
+	}
+}
+
+func TestSpentAcrossKeysets(t *testing.T) {
+	mintPath := filepath.Join(".", "spentkeysetsmint")
+	defer os.RemoveAll(mintPath)
+
+	mintProofs := func(spentMint *mint.Mint, blindedMessages cashu.BlindedMessages,
+		secrets []string, rs []*btcec.PrivateKey) cashu.Proofs {
+		mintQuote, err := spentMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{
+			Amount: blindedMessages.Amount(),
+			Unit:   cashu.Sat.String(),
+		})
+		if err != nil {
+			t.Fatalf("error requesting mint quote: %v", err)
+		}
+		blindedSignatures, err := spentMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages})
+		if err != nil {
+			t.Fatalf("got unexpected error minting tokens: %v", err)
+		}
+		keyset := spentMint.GetActiveKeyset()
+		proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+		if err != nil {
+			t.Fatalf("error constructing proofs: %v", err)
+		}
+		return proofs
+	}
+
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, 0, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousMint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	var amount uint64 = 64
+	blindedMessages, secrets, rs, _ := testutils.CreateBlindedMessages(amount, previousMint.GetActiveKeyset())
+	previousProofs := mintProofs(previousMint, blindedMessages, secrets, rs)
+
+	// same secrets signed by a new keyset with other blinding factors
+	config.DerivationPathIdx = 1
+	spentMint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	keyset := spentMint.GetActiveKeyset()
+	newRs := make([]*btcec.PrivateKey, len(secrets))
+	newBlindedMessages := make(cashu.BlindedMessages, len(secrets))
+	for i, secret := range secrets {
+		r, err := btcec.NewPrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		B_, _, err := crypto.BlindMessage(secret, r)
+		if err != nil {
+			t.Fatalf("error blinding message: %v", err)
+		}
+		newRs[i] = r
+		newBlindedMessages[i] = cashu.NewBlindedMessage(keyset.Id, blindedMessages[i].Amount, B_)
+	}
+	proofs := mintProofs(spentMint, newBlindedMessages, secrets, newRs)
+
+	outputs, _, _, _ := testutils.CreateBlindedMessages(amount, keyset)
+	if _, err := spentMint.Swap(previousProofs, outputs); err != nil {
+		t.Fatalf("unexpected error in swap: %v", err)
+	}
+
+	outputs, _, _, _ = testutils.CreateBlindedMessages(amount, keyset)
+	if _, err := spentMint.Swap(proofs, outputs); !errors.Is(err, cashu.ProofAlreadyUsedErr) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.ProofAlreadyUsedErr, err)
+	}
+}
+
+func TestMintLimits(t *testing.T) {
+	// setup mint with limits
+	limitsMintPath := filepath.Join(".", "limitsMint")
+	mintLimits := mint.MintLimits{
+		MaxBalance:      15000,
+		MintingSettings: mint.MintMethodSettings{MaxAmount: 10000},
+		MeltingSettings: mint.MeltMethodSettings{MaxAmount: 10000},
+	}
+
+	limitsMint, err := testutils.CreateTestMint(
+		lnd1,
+		limitsMintPath,
+		100,
+		mintLimits,
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(limitsMintPath)
+
+	keyset := limitsMint.GetActiveKeyset()
+
+	// test above mint max amount
+	var mintAmount uint64 = 20000
+	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
+	mintQuoteResponse, err := limitsMint.RequestMintQuote(mintQuoteRequest)
+	if !errors.Is(err, cashu.MintAmountExceededErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintAmountExceededErr, err)
+	}
+
+	// amount below max limit
+	mintAmount = 9500
+	mintQuoteRequest = nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
+	mintQuoteResponse, err = limitsMint.RequestMintQuote(mintQuoteRequest)
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+
+	blindedMessages, secrets, rs, _ := testutils.CreateBlindedMessages(mintAmount, keyset)
+
+	//pay invoice
+	sendPaymentRequest := lnrpc.SendRequest{
+		PaymentRequest: mintQuoteResponse.PaymentRequest,
+	}
+	response, _ := lnd2.Client.SendPaymentSync(ctx, &sendPaymentRequest)
+	if len(response.PaymentError) > 0 {
+		t.Fatalf("error paying invoice: %v", response.PaymentError)
+	}
+
+	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
+	blindedSignatures, err := limitsMint.MintTokens(mintTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+
+	// test request mint that will make it go above max balance
+	mintQuoteRequest = nut04.PostMintQuoteBolt11Request{Amount: 9000, Unit: cashu.Sat.String()}
+	mintQuoteResponse, err = limitsMint.RequestMintQuote(mintQuoteRequest)
+	if !errors.Is(err, cashu.MintingDisabled) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintingDisabled, err)
+	}
+
+	// test melt with invoice over max melt amount
+	invoice := lnrpc.Invoice{Value: 15000}
+	addInvoiceResponse, err := lnd2.Client.AddInvoice(ctx, &invoice)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	paymentRequest := addInvoiceResponse.PaymentRequest
+
+	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
+	_, err = limitsMint.RequestMeltQuote(meltQuoteRequest)
+	if !errors.Is(err, cashu.MeltAmountExceededErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltAmountExceededErr, err)
+	}
+
+	// test melt with invoice within limit
+	validProofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	invoice = lnrpc.Invoice{Value: 8000}
+	addInvoiceResponse, err = lnd2.Client.AddInvoice(ctx, &invoice)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	paymentRequest = addInvoiceResponse.PaymentRequest
+
+	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
+	meltQuote, err := limitsMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+
+	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
+	_, err = limitsMint.MeltTokens(ctx, meltTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+
+	// this should be within max balance now
+	mintQuoteRequest = nut04.PostMintQuoteBolt11Request{Amount: 9000, Unit: cashu.Sat.String()}
+	mintQuoteResponse, err = limitsMint.RequestMintQuote(mintQuoteRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error requesting mint quote: %v", err)
+	}
+}
+
+func TestMintInfoLimits(t *testing.T) {
+	mintPath := filepath.Join(".", "infolimitsmint")
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, 0, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mintPath)
+	config.MaxRequestItems = 50
+
+	limitsMint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := limitsMint.RetrieveMintInfo()
+	if err != nil {
+		t.Fatalf("unexpected error getting mint info: %v", err)
+	}
+
+	expectedLimits := nut06.OperationalLimits{
+		MaxInputs:      50,
+		MaxOutputs:     50,
+		MaxRequestSize: mint.DefaultMaxRequestSize,
+		MintQuoteTTL:   uint64(lightning.DefaultInvoiceExpiry.Seconds()),
+		MeltQuoteTTL:   mint.QuoteExpiryMins * 60,
+	}
+	if info.Limits == nil || *info.Limits != expectedLimits {
+		t.Fatalf("expected limits '%+v' but got '%+v'", expectedLimits, info.Limits)
+	}
+}
+
+func TestMintQuotePubkey(t *testing.T) {
+	limits := mint.MintLimits{MintingSettings: mint.MintMethodSettings{PubkeyRequiredAbove: 1000}}
+	config := mint.Config{
+		DB:              memory.NewMemoryDB(),
+		LightningClient: &lightning.FakeBackend{},
+		Limits:          limits,
+		LogLevel:        mint.Disable,
+	}
+	pubkeyMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+
+	info, err := pubkeyMint.RetrieveMintInfo()
+	if err != nil {
+		t.Fatalf("unexpected error getting mint info: %v", err)
+	}
+	expectedSettings := nut20.Settings{Supported: true, PubkeyRequiredAbove: 1000}
+	if info.Nuts[20] != expectedSettings {
+		t.Fatalf("expected NUT-20 settings '%+v' but got '%+v'", expectedSettings, info.Nuts[20])
+	}
+
+	// quotes above the amount need a pubkey
+	_, err = pubkeyMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: 2000, Unit: cashu.Sat.String()})
+	if !errors.Is(err, nut20.PubkeyRequiredErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut20.PubkeyRequiredErr, err)
+	}
+	_, err = pubkeyMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{
+		Amount: 2000,
+		Unit:   cashu.Sat.String(),
+		Pubkey: "02abcd",
+	})
+	if !errors.Is(err, nut20.InvalidPubkeyErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut20.InvalidPubkeyErr, err)
+	}
+
+	// quote up to the amount does not need a pubkey
+	var amount uint64 = 1000
+	keyset := pubkeyMint.GetActiveKeyset()
+	mintQuote, err := pubkeyMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	_, err = pubkeyMint.GetMintQuoteByPaymentHash(mintQuote.PaymentHash)
+	if !errors.Is(err, cashu.QuoteLookupPubkeyRequired) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.QuoteLookupPubkeyRequired, err)
+	}
+	blindedMessages, _, _, _ := testutils.CreateBlindedMessages(amount, keyset)
+	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages}
+	if _, err := pubkeyMint.MintTokens(mintTokensRequest); err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+
+	amount = 2000
+	key, _ := btcec.NewPrivateKey()
+	pubkey := hex.EncodeToString(key.PubKey().SerializeCompressed())
+	mintQuote, err = pubkeyMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{
+		Amount: amount,
+		Unit:   cashu.Sat.String(),
+		Pubkey: pubkey,
+	})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	if mintQuote.Pubkey != pubkey {
+		t.Fatalf("expected pubkey '%v' in quote but got '%v'", pubkey, mintQuote.Pubkey)
+	}
+
+	// quotes locked to a pubkey can be looked up by payment hash
+	quoteByHash, err := pubkeyMint.GetMintQuoteByPaymentHash(mintQuote.PaymentHash)
+	if err != nil {
+		t.Fatalf("unexpected error getting quote by payment hash: %v", err)
+	}
+	if quoteByHash.Id != mintQuote.Id {
+		t.Fatalf("expected quote '%v' but got '%v'", mintQuote.Id, quoteByHash.Id)
+	}
+
+	blindedMessages, _, _, _ = testutils.CreateBlindedMessages(amount, keyset)
+	mintTokensRequest = nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages}
+	if _, err := pubkeyMint.MintTokens(mintTokensRequest); !errors.Is(err, nut20.InvalidSignatureErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut20.InvalidSignatureErr, err)
+	}
+
+	otherKey, _ := btcec.NewPrivateKey()
+	mintTokensRequest.Signature, _ = nut20.SignMintRequest(mintQuote.Id, blindedMessages, otherKey)
+	if _, err := pubkeyMint.MintTokens(mintTokensRequest); !errors.Is(err, nut20.InvalidSignatureErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut20.InvalidSignatureErr, err)
+	}
+
+	mintTokensRequest.Signature, _ = nut20.SignMintRequest(mintQuote.Id, blindedMessages, key)
+	if _, err := pubkeyMint.MintTokens(mintTokensRequest); err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+}
+
+func TestKeysetRotationRace(t *testing.T) {
+	mintPath := filepath.Join(".", "keysetrotationmint")
+	defer os.RemoveAll(mintPath)
+
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, 0, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldMint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another instance sharing the db rotates to a new keyset
+	// while the first instance is still running
+	config.DerivationPathIdx = 1
+	rotatedMint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKeyset := oldMint.GetActiveKeyset()
+	newKeyset := rotatedMint.GetActiveKeyset()
+	if oldKeyset.Id == newKeyset.Id {
+		t.Fatal("expected keyset to be rotated")
+	}
+
+	mintProofs := func(m *mint.Mint, amount uint64) cashu.Proofs {
+		mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()}
+		mintQuote, err := m.RequestMintQuote(mintQuoteRequest)
+		if err != nil {
+			t.Fatalf("error requesting mint quote: %v", err)
+		}
+		keyset := m.GetActiveKeyset()
+		blindedMessages, secrets, rs, err := testutils.CreateBlindedMessages(amount, keyset)
+		if err != nil {
+			t.Fatalf("error creating blinded messages: %v", err)
+		}
+		mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages}
+		blindedSignatures, err := m.MintTokens(mintTokensRequest)
+		if err != nil {
+			t.Fatalf("got unexpected error minting tokens: %v", err)
+		}
+		proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+		if err != nil {
+			t.Fatalf("error constructing proofs: %v", err)
+		}
+		return proofs
+	}
+
+	// proofs and outputs from the rotated in keyset are not active yet in the old instance
+	newProofs := mintProofs(rotatedMint, 64)
+	outputs, _, _, _ := testutils.CreateBlindedMessages(64, oldKeyset)
+	_, err = oldMint.Swap(newProofs, outputs)
+	if !errors.Is(err, cashu.KeysetNotActiveYetErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.KeysetNotActiveYetErr, err)
+	}
+	oldProofs := mintProofs(oldMint, 64)
+	newKeysetOutputs, _, _, _ := testutils.CreateBlindedMessages(64, newKeyset)
+	_, err = oldMint.Swap(oldProofs, newKeysetOutputs)
+	if !errors.Is(err, cashu.KeysetNotActiveYetErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.KeysetNotActiveYetErr, err)
+	}
+
+	// rotated out keyset can still be redeemed but not used for outputs
+	_, err = rotatedMint.Swap(oldProofs, outputs)
+	if !errors.Is(err, cashu.InactiveKeysetSignatureRequest) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.InactiveKeysetSignatureRequest, err)
+	}
+	if _, err := rotatedMint.Swap(oldProofs, newKeysetOutputs); err != nil {
+		t.Fatalf("unexpected error redeeming proofs from rotated out keyset: %v", err)
+	}
+
+	// keyset not generated by any instance is unknown
+	unknownKeysetOutputs, _, _, _ := testutils.CreateBlindedMessages(64, crypto.MintKeyset{Id: "00aabbccddeeff11"})
+	_, err = rotatedMint.Swap(newProofs, unknownKeysetOutputs)
+	if !errors.Is(err, cashu.UnknownKeysetErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.UnknownKeysetErr, err)
+	}
+}
+
+func TestStartupKeysetChecks(t *testing.T) {
+	db := memory.NewMemoryDB()
+	config := mint.Config{
+		DB:              db,
+		LightningClient: &lightning.FakeBackend{},
+		LogLevel:        mint.Disable,
+	}
+	testMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	keyset := testMint.GetActiveKeyset()
+
+	// rotate to a new keyset
+	config.DerivationPathIdx = 2
+	rotatedMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	if rotatedMint.GetActiveKeyset().Id == keyset.Id {
+		t.Fatal("expected keyset to be rotated")
+	}
+
+	// going back to an older derivation path idx is rejected
+	for _, idx := range []uint32{0, 1} {
+		config.DerivationPathIdx = idx
+		_, err = mint.LoadMint(config)
+		if err == nil || !strings.Contains(err.Error(), "derivation path idx") {
+			t.Fatalf("expected error loading mint with derivation path idx %v but got '%v'", idx, err)
+		}
+	}
+
+	config.DerivationPathIdx = 2
+	config.InputFeePpk = mint.MaxInputFeePpk + 1
+	if _, err := mint.LoadMint(config); err == nil {
+		t.Fatal("expected error loading mint with input fee above max")
+	}
+	config.InputFeePpk = 100
+	if _, err := mint.LoadMint(config); err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+
+	// keyset in the db that does not match its derivation
+	seed, err := db.GetSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatchedKeyset := storage.DBKeyset{
+		Id:                "00aaaaaaaaaaaaaa",
+		Unit:              cashu.Sat.String(),
+		Seed:              hex.EncodeToString(seed),
+		DerivationPathIdx: 1,
+	}
+	if err := db.SaveKeyset(mismatchedKeyset); err != nil {
+		t.Fatal(err)
+	}
+	// inactive keysets are only derived on first use by default
+	if _, err := mint.LoadMint(config); err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	config.DeriveKeysetsOnStartup = true
+	_, err = mint.LoadMint(config)
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("expected error from keyset not matching its derivation but got '%v'", err)
+	}
+	config.DeriveKeysetsOnStartup = false
+
+	// keyset in the db from a different seed
+	config.DB = memory.NewMemoryDB()
+	if _, err := mint.LoadMint(config); err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	mismatchedKeyset.Seed = strings.Repeat("ab", 32)
+	if err := config.DB.SaveKeyset(mismatchedKeyset); err != nil {
+		t.Fatal(err)
+	}
+	_, err = mint.LoadMint(config)
+	if err == nil || !strings.Contains(err.Error(), "seed of the mint") {
+		t.Fatalf("expected error from keyset with different seed but got '%v'", err)
+	}
+}
+
+func TestLazyKeysets(t *testing.T) {
+	config := mint.Config{
+		DB:              memory.NewMemoryDB(),
+		LightningClient: &lightning.FakeBackend{},
+		LogLevel:        mint.Disable,
+	}
+	testMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	keyset := testMint.GetActiveKeyset()
+
+	var amount uint64 = 64
+	mintProofs := func() cashu.Proofs {
+		mintQuote, err := testMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+		if err != nil {
+			t.Fatalf("error requesting mint quote: %v", err)
+		}
+		blindedMessages, secrets, rs, err := testutils.CreateBlindedMessages(amount, keyset)
+		if err != nil {
+			t.Fatalf("error creating blinded messages: %v", err)
+		}
+		mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages}
+		blindedSignatures, err := testMint.MintTokens(mintTokensRequest)
+		if err != nil {
+			t.Fatalf("got unexpected error minting tokens: %v", err)
+		}
+		proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+		if err != nil {
+			t.Fatalf("error constructing proofs: %v", err)
+		}
+		return proofs
+	}
+	proofs := mintProofs()
+	moreProofs := mintProofs()
+
+	// rotate so that the keyset of the proofs is inactive
+	// and its keys are derived when the proofs are redeemed
+	config.DerivationPathIdx = 1
+	rotatedMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	rotatedKeyset := rotatedMint.GetActiveKeyset()
+	if rotatedKeyset.Id == keyset.Id {
+		t.Fatal("expected keyset to be rotated")
+	}
+
+	outputs, _, _, _ := testutils.CreateBlindedMessages(amount, rotatedKeyset)
+	if _, err := rotatedMint.Swap(proofs, outputs); err != nil {
+		t.Fatalf("got unexpected error in swap: %v", err)
+	}
+
+	// same with the keys derived on startup
+	config.DeriveKeysetsOnStartup = true
+	rotatedMint, err = mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	outputs, _, _, _ = testutils.CreateBlindedMessages(amount, rotatedKeyset)
+	if _, err := rotatedMint.Swap(moreProofs, outputs); err != nil {
+		t.Fatalf("got unexpected error in swap: %v", err)
+	}
+}
+
+func TestInspectKeysets(t *testing.T) {
+	db := memory.NewMemoryDB()
+	config := mint.Config{
+		DB:              db,
+		LightningClient: &lightning.FakeBackend{},
+		LogLevel:        mint.Disable,
+	}
+	testMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	activeKeyset := testMint.GetActiveKeyset()
+
+	keysets, err := mint.InspectKeysets(config, activeKeyset.Id)
+	if err != nil {
+		t.Fatalf("unexpected error inspecting keysets: %v", err)
+	}
+	if len(keysets) != 1 {
+		t.Fatalf("expected 1 keyset but got %v", len(keysets))
+	}
+	inspection := keysets[0]
+	if !inspection.Match() || inspection.DerivedId != activeKeyset.Id {
+		t.Fatalf("expected derived id '%v' to match but got '%v'", activeKeyset.Id, inspection.DerivedId)
+	}
+	publicKeys := activeKeyset.DerivePublic()
+	if len(inspection.PublicKeys) != len(publicKeys) {
+		t.Fatalf("expected %v keys but got %v", len(publicKeys), len(inspection.PublicKeys))
+	}
+	for amount, pubkey := range publicKeys {
+		if inspection.PublicKeys[amount] != pubkey {
+			t.Fatalf("expected key '%v' for amount %v but got '%v'", pubkey, amount, inspection.PublicKeys[amount])
+		}
+	}
+
+	// keyset in the db that does not match its derivation
+	seed, err := db.GetSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mismatchedKeyset := storage.DBKeyset{
+		Id:                "00aaaaaaaaaaaaaa",
+		Unit:              cashu.Sat.String(),
+		Seed:              hex.EncodeToString(seed),
+		DerivationPathIdx: 1,
+	}
+	if err := db.SaveKeyset(mismatchedKeyset); err != nil {
+		t.Fatal(err)
+	}
+	keysets, err = mint.InspectKeysets(config, "")
+	if err != nil {
+		t.Fatalf("unexpected error inspecting keysets: %v", err)
+	}
+	if len(keysets) != 2 {
+		t.Fatalf("expected 2 keysets but got %v", len(keysets))
+	}
+	for _, keyset := range keysets {
+		if keyset.Id == mismatchedKeyset.Id && keyset.Match() {
+			t.Fatal("expected mismatched keyset to not match derived id")
+		}
+		if keyset.Id == activeKeyset.Id && !keyset.Match() {
+			t.Fatal("expected active keyset to match derived id")
+		}
+	}
+
+	if _, err := mint.InspectKeysets(config, "00bbbbbbbbbbbbbb"); err == nil {
+		t.Fatal("expected error inspecting keyset not in the db")
+	}
+}
+
+func TestMemoryDBMint(t *testing.T) {
+	// no path needed for the mint since nothing is written to disk
+	config := mint.Config{
+		DB:              memory.NewMemoryDB(),
+		LightningClient: &lightning.FakeBackend{},
+		LogLevel:        mint.Disable,
+	}
+	memoryMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+
+	var amount uint64 = 64
+	mintQuote, err := memoryMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	keyset := memoryMint.GetActiveKeyset()
+	blindedMessages, secrets, rs, err := testutils.CreateBlindedMessages(amount, keyset)
+	if err != nil {
+		t.Fatalf("error creating blinded messages: %v", err)
+	}
+	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages}
+	blindedSignatures, err := memoryMint.MintTokens(mintTokensRequest)
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	if _, err := memoryMint.MintTokens(mintTokensRequest); !errors.Is(err, cashu.MintQuoteAlreadyIssued) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintQuoteAlreadyIssued, err)
+	}
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+
+	outputs, _, _, _ := testutils.CreateBlindedMessages(amount, keyset)
+	if _, err := memoryMint.Swap(proofs, outputs); err != nil {
+		t.Fatalf("got unexpected error in swap: %v", err)
+	}
+	newOutputs, _, _, _ := testutils.CreateBlindedMessages(amount, keyset)
+	if _, err := memoryMint.Swap(proofs, newOutputs); !errors.Is(err, cashu.ProofAlreadyUsedErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.ProofAlreadyUsedErr, err)
+	}
+}
+
+func TestFeeRevenue(t *testing.T) {
+	config := mint.Config{
+		DB:              memory.NewMemoryDB(),
+		LightningClient: &lightning.FakeBackend{},
+		InputFeePpk:     100,
+		LogLevel:        mint.Disable,
+	}
+	feeMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	keyset := feeMint.GetActiveKeyset()
+
+	expectFees := func(expected uint64) {
+		t.Helper()
+		revenue, err := feeMint.FeeRevenue()
+		if err != nil {
+			t.Fatalf("unexpected error getting fee revenue: %v", err)
+		}
+		if len(revenue) != 1 || revenue[0].Id != keyset.Id || !revenue[0].Active || revenue[0].InputFeePpk != 100 {
+			t.Fatalf("unexpected fee revenue: %+v", revenue)
+		}
+		if revenue[0].Fees != expected {
+			t.Fatalf("expected fees of %v but got %v", expected, revenue[0].Fees)
+		}
+	}
+
+	// 6 proofs with fees of 600 ppk rounded up to 1
+	var amount uint64 = 63
+	mintQuote, err := feeMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	blindedMessages, secrets, rs, err := testutils.CreateBlindedMessages(amount, keyset)
+	if err != nil {
+		t.Fatalf("error creating blinded messages: %v", err)
+	}
+	blindedSignatures, err := feeMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages})
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+	expectFees(0)
+
+	// swap that does not pay the fees is not recorded
+	outputs, _, _, _ := testutils.CreateBlindedMessages(amount, keyset)
+	if _, err := feeMint.Swap(proofs, outputs); !errors.Is(err, cashu.InsufficientProofsAmount) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.InsufficientProofsAmount, err)
+	}
+	expectFees(0)
+
+	outputs, secrets, rs, _ = testutils.CreateBlindedMessages(amount-1, keyset)
+	blindedSignatures, err = feeMint.Swap(proofs, outputs)
+	if err != nil {
+		t.Fatalf("got unexpected error in swap: %v", err)
+	}
+	expectFees(1)
+
+	proofs, err = testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+	invoice, _, _, err := lightning.CreateFakeInvoice(amount-2, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	meltQuote, err := feeMint.RequestMeltQuote(nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+	meltQuote, err = feeMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: proofs})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if meltQuote.State != nut05.Paid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Paid, meltQuote.State)
+	}
+	expectFees(2)
+}
+
+func TestPendingReport(t *testing.T) {
+	db := memory.NewMemoryDB()
+	config := mint.Config{
+		DB:              db,
+		LightningClient: &lightning.FakeBackend{},
+		LogLevel:        mint.Disable,
+	}
+	pendingMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	keyset := pendingMint.GetActiveKeyset()
+
+	unpaidQuote, err := pendingMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: 100, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	paidQuote, err := pendingMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: 21, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	if err := db.UpdateMintQuoteState(paidQuote.Id, nut04.Paid); err != nil {
+		t.Fatal(err)
+	}
+
+	proofs := cashu.Proofs{
+		{Amount: 8, Id: keyset.Id, Secret: "secret1", C: "02aa"},
+		{Amount: 2, Id: keyset.Id, Secret: "secret2", C: "02aa"},
+		{Amount: 1, Id: keyset.Id, Secret: "secret3", C: "02aa"},
+	}
+	if err := db.AddPendingProofs(proofs[:2], "melt1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddPendingProofs(proofs[2:], "melt2"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := pendingMint.PendingReport()
+	if err != nil {
+		t.Fatalf("unexpected error building pending report: %v", err)
+	}
+	if report.PendingProofs != 3 || report.PendingAmounts[cashu.Sat.String()] != 11 {
+		t.Fatalf("expected 3 pending proofs of 11 sats but got %v and %v", report.PendingProofs, report.PendingAmounts)
+	}
+	if len(report.MeltQuotes) != 2 {
+		t.Fatalf("expected 2 melt quotes but got %v", len(report.MeltQuotes))
+	}
+	for _, quote := range report.MeltQuotes {
+		if quote.PendingSince.IsZero() || len(quote.State) != 0 {
+			t.Fatalf("unexpected pending melt quote %+v", quote)
+		}
+		if quote.QuoteId == "melt1" && (quote.Proofs != 2 || quote.Amount != 10) {
+			t.Fatalf("expected 2 proofs of 10 sats for quote 'melt1' but got %+v", quote)
+		}
+	}
+	if len(report.UnpaidMintQuotes) != 1 || report.UnpaidMintQuotes[0].QuoteId != unpaidQuote.Id ||
+		report.UnpaidMintQuotes[0].Expired {
+		t.Fatalf("unexpected unpaid mint quotes %+v", report.UnpaidMintQuotes)
+	}
+	if len(report.PaidMintQuotes) != 1 || report.PaidMintQuotes[0].Amount != 21 {
+		t.Fatalf("unexpected paid mint quotes %+v", report.PaidMintQuotes)
+	}
+}
+
+func TestMsatUnit(t *testing.T) {
+	db := memory.NewMemoryDB()
+	config := mint.Config{
+		DB:              db,
+		LightningClient: &lightning.FakeBackend{},
+		LogLevel:        mint.Disable,
+		EnableMsatUnit:  true,
+	}
+	msatMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+
+	seed, err := db.GetSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msatKeyset, err := crypto.GenerateUnitKeyset(master, cashu.Msat, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	satKeyset := msatMint.GetActiveKeyset()
+	if satKeyset.Unit != cashu.Sat.String() {
+		t.Fatalf("expected active keyset of unit '%v' but got '%v'", cashu.Sat, satKeyset.Unit)
+	}
+
+	// invoices for mint quotes are for whole sats
+	_, err = msatMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: 1500, Unit: cashu.Msat.String()})
+	var cashuErr *cashu.Error
+	if !errors.As(err, &cashuErr) || cashuErr.Code != cashu.UnitErrCode {
+		t.Fatalf("expected unit error but got '%v'", err)
+	}
+
+	var amount uint64 = 64000
+	mintQuote, err := msatMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Msat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	if mintQuote.Amount != amount || mintQuote.Unit != cashu.Msat.String() {
+		t.Fatalf("unexpected mint quote '%+v'", mintQuote)
+	}
+
+	// outputs have to be from the msat keyset
+	satOutputs, _, _, _ := testutils.CreateBlindedMessages(64, satKeyset)
+	_, err = msatMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: satOutputs})
+	if !errors.Is(err, cashu.UnitMismatchErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.UnitMismatchErr, err)
+	}
+	blindedMessages, secrets, rs, _ := testutils.CreateBlindedMessages(amount, *msatKeyset)
+	blindedSignatures, err := msatMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages})
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, msatKeyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+
+	// swap to sub-sat amounts
+	var meltAmount uint64 = 10500
+	outputs, meltSecrets, meltRs, _ := testutils.CreateBlindedMessages(meltAmount, *msatKeyset)
+	changeOutputs, _, _, _ := testutils.CreateBlindedMessages(amount-meltAmount, *msatKeyset)
+	swapSignatures, err := msatMint.Swap(proofs, append(outputs, changeOutputs...))
+	if err != nil {
+		t.Fatalf("got unexpected error in swap: %v", err)
+	}
+	meltProofs, err := testutils.ConstructProofs(swapSignatures[:len(outputs)], meltSecrets, meltRs, msatKeyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+
+	invoice, _, _, err := lightning.CreateFakeInvoiceMsat(meltAmount, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	meltQuote, err := msatMint.RequestMeltQuote(nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Msat.String()})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt quote request: %v", err)
+	}
+	// amount of msat quotes is not rounded up
+	if meltQuote.Amount != meltAmount || meltQuote.AmountMsat != meltAmount {
+		t.Fatalf("expected quote amount of %v but got '%+v'", meltAmount, meltQuote)
+	}
+	melt, err := msatMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: meltProofs})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if melt.State != nut05.Paid {
+		t.Fatalf("expected melt quote with state '%v' but got '%v'", nut05.Paid, melt.State)
+	}
+
+	// balance is in sats and melted msat amounts are rounded up
+	balance, err := db.GetBalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 53 {
+		t.Fatalf("expected balance of 53 but got %v", balance)
+	}
+
+	// msat quotes are rejected if not enabled
+	config.DB = memory.NewMemoryDB()
+	config.EnableMsatUnit = false
+	satMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	_, err = satMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Msat.String()})
+	if !errors.As(err, &cashuErr) || cashuErr.Code != cashu.UnitErrCode {
+		t.Fatalf("expected unit error but got '%v'", err)
+	}
+}
+
+func TestFiatUnit(t *testing.T) {
+	db := memory.NewMemoryDB()
+	config := mint.Config{
+		DB:              db,
+		LightningClient: &lightning.FakeBackend{},
+		LogLevel:        mint.Disable,
+		Units:           []cashu.Unit{cashu.Usd},
+		// 1 cent is 10 sats
+		ExchangeRates: mint.FixedExchangeRates{cashu.Usd: 10000},
+	}
+	usdMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+
+	seed, err := db.GetSeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usdKeyset, err := crypto.GenerateUnitKeyset(master, cashu.Usd, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	satKeyset := usdMint.GetActiveKeyset()
+	dbKeysets, err := db.GetKeysets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(dbKeysets, func(keyset storage.DBKeyset) bool {
+		return keyset.Id == usdKeyset.Id && keyset.Unit == cashu.Usd.String() && keyset.Active
+	}) {
+		t.Fatalf("expected active usd keyset '%v' in keysets", usdKeyset.Id)
+	}
+	info, err := usdMint.RetrieveMintInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mintSetting := info.Nuts[4].(nut06.NutSetting)
+	if !slices.ContainsFunc(mintSetting.Methods, func(method nut06.MethodSetting) bool {
+		return method.Unit == cashu.Usd.String()
+	}) {
+		t.Fatalf("expected usd method in mint info but got %+v", mintSetting.Methods)
+	}
+
+	// the invoice is for the sats of the amount at the exchange rate
+	var amount uint64 = 500
+	mintQuote, err := usdMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Usd.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	if mintQuote.Amount != amount || mintQuote.AmountMsat != 5_000_000 {
+		t.Fatalf("unexpected mint quote '%+v'", mintQuote)
+	}
+
+	blindedMessages, secrets, rs, _ := testutils.CreateBlindedMessages(amount, *usdKeyset)
+	blindedSignatures, err := usdMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages})
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, usdKeyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+
+	// usd proofs can't be swapped for sat outputs
+	satOutputs, _, _, _ := testutils.CreateBlindedMessages(amount, satKeyset)
+	_, err = usdMint.Swap(proofs, satOutputs)
+	if !errors.Is(err, cashu.UnitMismatchErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.UnitMismatchErr, err)
+	}
+
+	invoice, _, _, err := lightning.CreateFakeInvoice(1000, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	meltQuote, err := usdMint.RequestMeltQuote(nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Usd.String()})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt quote request: %v", err)
+	}
+	if meltQuote.Amount != 100 || meltQuote.AmountMsat != 1_000_000 {
+		t.Fatalf("expected quote amount of 100 but got '%+v'", meltQuote)
+	}
+	melt, err := usdMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: proofs})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if melt.State != nut05.Paid {
+		t.Fatalf("expected melt quote with state '%v' but got '%v'", nut05.Paid, melt.State)
+	}
+
+	// balance is in sats of the invoices
+	balance, err := db.GetBalance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance != 4000 {
+		t.Fatalf("expected balance of 4000 but got %v", balance)
+	}
+
+	// fiat units need exchange rates
+	config.DB = memory.NewMemoryDB()
+	config.ExchangeRates = nil
+	if _, err := mint.LoadMint(config); err == nil {
+		t.Fatal("expected error loading mint with fiat units and no exchange rates")
+	}
+}
+
+func TestCoinbaseExchangeRates(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"data":{"currency":"BTC","rates":{"USD":"100000.00","EUR":"80000"}}}`))
+	}))
+	defer server.Close()
+
+	rates := &mint.CoinbaseExchangeRates{URL: server.URL}
+	tests := []struct {
+		unit     cashu.Unit
+		expected uint64
+	}{
+		{unit: cashu.Usd, expected: 10000},
+		{unit: cashu.Eur, expected: 12500},
+	}
+	for _, test := range tests {
+		rate, err := rates.MsatPerUnit(test.unit)
+		if err != nil {
+			t.Fatalf("unexpected error getting rate: %v", err)
+		}
+		if rate != test.expected {
+			t.Fatalf("expected rate of %v for %v but got %v", test.expected, test.unit, rate)
+		}
+	}
+	// rates are cached
+	if requests != 1 {
+		t.Fatalf("expected 1 request for rates but got %v", requests)
+	}
+
+	if _, err := rates.MsatPerUnit(cashu.Sat); err == nil {
+		t.Fatal("expected error getting rate for sat")
+	}
+}
+
+func TestFaucetMode(t *testing.T) {
+	invalidConfigs := map[string]mint.Config{
+		"no network":        {},
+		"mainnet":           {Network: "mainnet"},
+		"lightning client":  {Network: "regtest", LightningClient: &lightning.ExternalBackend{}},
+		"lightning backend": {Network: "regtest", LightningBackend: "Lnd"},
+	}
+	for name, config := range invalidConfigs {
+		config.DB = memory.NewMemoryDB()
+		config.LogLevel = mint.Disable
+		config.FaucetMode = true
+		if _, err := mint.LoadMint(config); err == nil {
+			t.Fatalf("expected error loading mint in faucet mode with %v", name)
+		}
+	}
+
+	config := mint.Config{
+		DB:                memory.NewMemoryDB(),
+		LogLevel:          mint.Disable,
+		FaucetMode:        true,
+		FaucetSettleDelay: 200 * time.Millisecond,
+		Network:           "regtest",
+	}
+	faucetMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	info, err := faucetMint.RetrieveMintInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Motd != mint.DefaultFaucetMotd {
+		t.Fatalf("expected faucet motd but got '%v'", info.Motd)
+	}
+
+	var amount uint64 = 2100
+	mintQuote, err := faucetMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	if mintQuote.State != nut04.Unpaid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut04.Unpaid, mintQuote.State)
+	}
+
+	// quote is paid after the delay
+	time.Sleep(300 * time.Millisecond)
+	mintQuote, err = faucetMint.GetMintQuoteState(mintQuote.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting mint quote state: %v", err)
+	}
+	if mintQuote.State != nut04.Paid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut04.Paid, mintQuote.State)
+	}
+
+	keyset := faucetMint.GetActiveKeyset()
+	blindedMessages, secrets, rs, _ := testutils.CreateBlindedMessages(amount, keyset)
+	blindedSignatures, err := faucetMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages})
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+
+	// payments for melt quotes succeed without lightning
+	invoice, _, _, err := lightning.CreateFakeInvoice(amount, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	meltQuote, err := faucetMint.RequestMeltQuote(nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt quote request: %v", err)
+	}
+	melt, err := faucetMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: proofs})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if melt.State != nut05.Paid {
+		t.Fatalf("expected melt quote with state '%v' but got '%v'", nut05.Paid, melt.State)
+	}
+
+	// without delay quotes are paid right away
+	config.DB = memory.NewMemoryDB()
+	config.FaucetSettleDelay = 0
+	faucetMint, err = mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	mintQuote, err = faucetMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	mintQuote, err = faucetMint.GetMintQuoteState(mintQuote.Id)
+	if err != nil {
+		t.Fatalf("unexpected error getting mint quote state: %v", err)
+	}
+	if mintQuote.State != nut04.Paid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut04.Paid, mintQuote.State)
+	}
+}
+
+func TestRotateKeyset(t *testing.T) {
+	db := memory.NewMemoryDB()
+	config := mint.Config{
+		DB:              db,
+		LightningClient: &lightning.FakeBackend{},
+		LogLevel:        mint.Disable,
+	}
+	rotateMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	previousKeyset := rotateMint.GetActiveKeyset()
+
+	var amount uint64 = 2100
+	mintQuote, err := rotateMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	blindedMessages, secrets, rs, _ := testutils.CreateBlindedMessages(amount, previousKeyset)
+	blindedSignatures, err := rotateMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages})
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &previousKeyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+
+	if _, err := rotateMint.RotateKeyset(cashu.Msat, 0); err == nil {
+		t.Fatal("expected error rotating keyset of unit without active keyset")
+	}
+	if _, err := rotateMint.RotateKeyset(cashu.Sat, mint.MaxInputFeePpk+1); err == nil {
+		t.Fatal("expected error rotating keyset with fee above the max")
+	}
+
+	keyset, err := rotateMint.RotateKeyset(cashu.Sat, 100)
+	if err != nil {
+		t.Fatalf("unexpected error rotating keyset: %v", err)
+	}
+	if keyset.DerivationPathIdx != 1 || keyset.InputFeePpk != 100 {
+		t.Fatalf("expected keyset with derivation path idx 1 and fee 100 but got %v and %v",
+			keyset.DerivationPathIdx, keyset.InputFeePpk)
+	}
+	if activeKeyset := rotateMint.GetActiveKeyset(); activeKeyset.Id != keyset.Id {
+		t.Fatalf("expected active keyset '%v' but got '%v'", keyset.Id, activeKeyset.Id)
+	}
+	dbKeysets, err := db.GetKeysets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dbKeyset := range dbKeysets {
+		if dbKeyset.Active != (dbKeyset.Id == keyset.Id) {
+			t.Fatalf("unexpected active state of keyset '%v' in db: %v", dbKeyset.Id, dbKeyset.Active)
+		}
+	}
+
+	// proofs of the previous keyset can be swapped for outputs of the new one
+	previousOutputs, _, _, _ := testutils.CreateBlindedMessages(amount, previousKeyset)
+	if _, err := rotateMint.Swap(proofs, previousOutputs); !errors.Is(err, cashu.InactiveKeysetSignatureRequest) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.InactiveKeysetSignatureRequest, err)
+	}
+	fees := uint64(rotateMint.TransactionFees(proofs))
+	outputs, _, _, _ := testutils.CreateBlindedMessages(amount-fees, *keyset)
+	if _, err := rotateMint.Swap(proofs, outputs); err != nil {
+		t.Fatalf("unexpected error in swap: %v", err)
+	}
+
+	// the mint does not start until the idx is set to the new keyset
+	if _, err := mint.LoadMint(config); err == nil {
+		t.Fatal("expected error loading mint with derivation path idx of the previous keyset")
+	}
+	config.DerivationPathIdx = 1
+	config.InputFeePpk = 100
+	reloadedMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	if activeKeyset := reloadedMint.GetActiveKeyset(); activeKeyset.Id != keyset.Id {
+		t.Fatalf("expected active keyset '%v' but got '%v'", keyset.Id, activeKeyset.Id)
+	}
+}
+
+func TestKeyEpoch(t *testing.T) {
+	config := mint.Config{
+		DB:              memory.NewMemoryDB(),
+		LightningClient: &lightning.FakeBackend{},
+		LogLevel:        mint.Disable,
+	}
+	epochMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	keyset := epochMint.GetActiveKeyset()
+
+	var amount uint64 = 2100
+	mintQuote, err := epochMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	blindedMessages, secrets, rs, _ := testutils.CreateBlindedMessages(amount, keyset)
+	blindedSignatures, err := epochMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages})
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+
+	swapProofs := proofs[:1]
+	swapAmount := swapProofs.Amount()
+	outputs, _, _, _ := testutils.CreateBlindedMessages(swapAmount, keyset)
+	if _, err := epochMint.Swap(swapProofs, outputs); err != nil {
+		t.Fatalf("unexpected error in swap: %v", err)
+	}
+
+	keyEpoch, err := epochMint.KeyEpoch()
+	if err != nil {
+		t.Fatalf("unexpected error building key epoch: %v", err)
+	}
+	if !mint.VerifyKeyEpoch(*keyEpoch) {
+		t.Fatal("expected valid signature")
+	}
+	mintInfo, err := epochMint.RetrieveMintInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyEpoch.Pubkey != mintInfo.Pubkey {
+		t.Fatalf("expected statement signed by '%v' but got '%v'", mintInfo.Pubkey, keyEpoch.Pubkey)
+	}
+	if len(keyEpoch.Keysets) != 1 {
+		t.Fatalf("expected 1 keyset but got %v", len(keyEpoch.Keysets))
+	}
+	keysetEpoch := keyEpoch.Keysets[0]
+	if keysetEpoch.Id != keyset.Id || !keysetEpoch.Active || len(keysetEpoch.Keys) != len(keyset.Keys) {
+		t.Fatalf("unexpected keyset in statement: %+v", keysetEpoch)
+	}
+	if keysetEpoch.Issued != amount+swapAmount || keysetEpoch.Redeemed != swapAmount {
+		t.Fatalf("expected issued '%v' and redeemed '%v' but got '%v' and '%v'",
+			amount+swapAmount, swapAmount, keysetEpoch.Issued, keysetEpoch.Redeemed)
+	}
+
+	// signature is kept after encoding the statement
+	jsonEpoch, err := json.Marshal(keyEpoch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded mint.KeyEpoch
+	if err := json.Unmarshal(jsonEpoch, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !mint.VerifyKeyEpoch(decoded) {
+		t.Fatal("expected valid signature after decoding statement")
+	}
+
+	decoded.Keysets[0].Issued--
+	if mint.VerifyKeyEpoch(decoded) {
+		t.Fatal("expected invalid signature for statement with other issued amount")
+	}
+	decoded.Keysets[0].Issued++
+	decoded.Timestamp++
+	if mint.VerifyKeyEpoch(decoded) {
+		t.Fatal("expected invalid signature for statement with other timestamp")
+	}
+}
+
+func TestLightningBackendConfig(t *testing.T) {
+	config := mint.Config{
+		DB:               memory.NewMemoryDB(),
+		LightningBackend: "FakeBackend",
+		EnableMPP:        true,
+		LogLevel:         mint.Disable,
+	}
+	if _, err := mint.LoadMint(config); err != nil {
+		t.Fatalf("unexpected error loading mint with registered backend: %v", err)
+	}
+
+	config.LightningBackend = "Unknown"
+	if _, err := mint.LoadMint(config); err == nil {
+		t.Fatal("expected error loading mint with unknown backend")
+	}
+
+	// only the methods of the Client are promoted so it does not support MPP
+	config.LightningClient = struct{ lightning.Client }{&lightning.FakeBackend{}}
+	if _, err := mint.LoadMint(config); err == nil {
+		t.Fatal("expected error loading mint with MPP enabled and a backend without MPP support")
+	}
+	config.EnableMPP = false
+	if _, err := mint.LoadMint(config); err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	port, _ := testutils.GetAvailablePort()
+	mintURL := "http://127.0.0.1:" + strconv.Itoa(port)
+
+	mintPath := filepath.Join(".", "reloadconfigmint")
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, port, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mintPath)
+	mintServer, err := mint.SetupMintServer(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if err := mintServer.Start(); err != nil {
+			log.Printf("error running mint server: %v", err)
+		}
+	}()
+	defer mintServer.Shutdown()
+
+	reloaded := *config
+	reloaded.Limits = mint.MintLimits{MintingSettings: mint.MintMethodSettings{MaxAmount: 1000}}
+	reloaded.MintInfo.Motd = "new motd"
+	reloaded.DoubleSpends = mint.DoubleSpendPolicy{MaxAttempts: 3}
+	reloaded.RedeemOnly = true
+	// not reloaded while running
+	reloaded.InputFeePpk = 100
+	changes, err := mintServer.ReloadConfig(reloaded)
+	if err != nil {
+		t.Fatalf("unexpected error reloading config: %v", err)
+	}
+	if len(changes) != 4 {
+		t.Fatalf("expected 4 changes but got %v: %v", len(changes), changes)
+	}
+
+	view := mintServer.ConfigView()
+	if view.Motd != "new motd" || view.Limits != reloaded.Limits || view.DoubleSpends.MaxAttempts != 3 || !view.RedeemOnly {
+		t.Fatalf("config view does not have reloaded values: %+v", view)
+	}
+	if view.InputFeePpk != 0 {
+		t.Fatalf("expected input fee to not be reloaded but got %v", view.InputFeePpk)
+	}
+
+	mintInfo, err := client.GetMintInfo(mintURL)
+	if err != nil {
+		t.Fatalf("unexpected error getting mint info: %v", err)
+	}
+	if mintInfo.Motd != "new motd" {
+		t.Fatalf("expected motd '%v' but got '%v'", "new motd", mintInfo.Motd)
+	}
+	if nut04Settings, _ := mintInfo.Nuts[4].(map[string]any); nut04Settings["disabled"] != true {
+		t.Fatalf("expected minting to be disabled in redeem-only mode but got %v", mintInfo.Nuts[4])
+	}
+	_, err = client.PostMintQuoteBolt11(mintURL, nut04.PostMintQuoteBolt11Request{Amount: 100, Unit: cashu.Sat.String()})
+	if err == nil || !strings.Contains(err.Error(), cashu.MintingDisabled.Detail) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.MintingDisabled, err)
+	}
+
+	reloaded.RedeemOnly = false
+	if _, err := mintServer.ReloadConfig(reloaded); err != nil {
+		t.Fatalf("unexpected error reloading config: %v", err)
+	}
+	_, err = client.PostMintQuoteBolt11(mintURL, nut04.PostMintQuoteBolt11Request{Amount: 2000, Unit: cashu.Sat.String()})
+	if err == nil || !strings.Contains(err.Error(), cashu.MintAmountExceededErr.Detail) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.MintAmountExceededErr, err)
+	}
+
+	// nothing to apply if reloaded again
+	changes, err = mintServer.ReloadConfig(reloaded)
+	if err != nil {
+		t.Fatalf("unexpected error reloading config: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("expected no changes but got %v", changes)
+	}
+
+	reloaded.LogLevel = mint.Debug
+	if _, err := mintServer.ReloadConfig(reloaded); err == nil {
+		t.Fatal("expected error enabling logs disabled at startup")
+	}
+}
+
+func TestRedeemOnly(t *testing.T) {
+	config := mint.Config{
+		DB:              memory.NewMemoryDB(),
+		LightningClient: &lightning.FakeBackend{},
+		LogLevel:        mint.Disable,
+	}
+	redeemOnlyMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	keyset := redeemOnlyMint.GetActiveKeyset()
+
+	var amount uint64 = 100
+	// quote paid before winding down
+	mintQuote, err := redeemOnlyMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+
+	redeemOnlyMint.SetRedeemOnly(true)
+	if !redeemOnlyMint.RedeemOnly() {
+		t.Fatal("expected mint to be redeem-only")
+	}
+	_, err = redeemOnlyMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if !errors.Is(err, cashu.MintingDisabled) {
+		t.Fatalf("expected error '%v' but got '%v'", cashu.MintingDisabled, err)
+	}
+
+	mintInfo, err := redeemOnlyMint.RetrieveMintInfo()
+	if err != nil {
+		t.Fatalf("unexpected error getting mint info: %v", err)
+	}
+	if !mintInfo.Nuts[4].(nut06.NutSetting).Disabled {
+		t.Fatal("expected minting to be advertised as disabled")
+	}
+	if mintInfo.Nuts[5].(nut06.NutSetting).Disabled {
+		t.Fatal("expected melting to not be disabled")
+	}
+	if mintInfo.Motd != mint.DefaultRedeemOnlyMotd {
+		t.Fatalf("expected motd '%v' but got '%v'", mint.DefaultRedeemOnlyMotd, mintInfo.Motd)
+	}
+
+	// paid quote can still be minted and the ecash swapped and melted
+	blindedMessages, secrets, rs, err := testutils.CreateBlindedMessages(amount, keyset)
+	if err != nil {
+		t.Fatalf("error creating blinded messages: %v", err)
+	}
+	blindedSignatures, err := redeemOnlyMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: blindedMessages})
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+	outputs, secrets, rs, _ := testutils.CreateBlindedMessages(amount, keyset)
+	blindedSignatures, err = redeemOnlyMint.Swap(proofs, outputs)
+	if err != nil {
+		t.Fatalf("got unexpected error in swap: %v", err)
+	}
+	proofs, err = testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+	invoice, _, _, err := lightning.CreateFakeInvoice(amount, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	meltQuote, err := redeemOnlyMint.RequestMeltQuote(nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt request: %v", err)
+	}
+	meltQuote, err = redeemOnlyMint.MeltTokens(ctx, nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: proofs})
+	if err != nil {
+		t.Fatalf("got unexpected error in melt: %v", err)
+	}
+	if meltQuote.State != nut05.Paid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Paid, meltQuote.State)
+	}
+
+	redeemOnlyMint.SetRedeemOnly(false)
+	if _, err := redeemOnlyMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()}); err != nil {
+		t.Fatalf("unexpected error requesting mint quote: %v", err)
+	}
+	mintInfo, err = redeemOnlyMint.RetrieveMintInfo()
+	if err != nil {
+		t.Fatalf("unexpected error getting mint info: %v", err)
+	}
+	if mintInfo.Nuts[4].(nut06.NutSetting).Disabled || len(mintInfo.Motd) > 0 {
+		t.Fatalf("expected minting to be enabled without motd but got %+v", mintInfo)
+	}
+}
+
+func TestDoubleSpendThrottling(t *testing.T) {
+	port, _ := testutils.GetAvailablePort()
+	mintURL := "http://127.0.0.1:" + strconv.Itoa(port)
+
+	mintPath := filepath.Join(".", "doublespendmint")
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, port, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mintPath)
+	config.DoubleSpends = mint.DoubleSpendPolicy{MaxAttempts: 2, Window: time.Minute, BanDuration: time.Minute}
+	mintServer, err := mint.SetupMintServer(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if err := mintServer.Start(); err != nil {
+			log.Printf("error running mint server: %v", err)
+		}
+	}()
+	defer mintServer.Shutdown()
+
+	walletPath := filepath.Join(".", "doublespendwallet")
+	testWallet, err := testutils.CreateTestWallet(walletPath, mintURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(walletPath)
+	if err := testutils.FundCashuWallet(ctx, testWallet, nil, 1000); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+
+	proofs, err := testWallet.Send(100, mintURL, false)
+	if err != nil {
+		t.Fatalf("unexpected error sending: %v", err)
+	}
+	swap := func() error {
+		keyset := crypto.MintKeyset{Id: proofs[0].Id}
+		outputs, _, _, err := testutils.CreateBlindedMessages(proofs.Amount(), keyset)
+		if err != nil {
+			t.Fatalf("error creating blinded messages: %v", err)
+		}
+		_, err = client.PostSwap(mintURL, nut03.PostSwapRequest{Inputs: proofs, Outputs: outputs})
+		return err
+	}
+
+	if err := swap(); err != nil {
+		t.Fatalf("unexpected error in swap: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := swap(); !errors.Is(err, cashu.ProofAlreadyUsedErr) {
+			t.Fatalf("expected error '%v' but got '%v' instead", cashu.ProofAlreadyUsedErr, err)
+		}
+	}
+
+	// IP is throttled after max attempts
+	if err := swap(); err == nil || !strings.Contains(err.Error(), "too many requests") {
+		t.Fatalf("expected throttled request but got '%v'", err)
+	}
+	if _, err := client.GetActiveKeysets(mintURL); err == nil {
+		t.Fatal("expected all requests from IP to be throttled")
 	}
-	wg.Wait()
 
-	// out of the 100 requests only 1 should have succeeded.
-	// there should be 99 errors
-	if errCount != 99 {
-		t.Fatalf("expected 99 errors but got %v", errCount)
+	attempts := mintServer.DoubleSpendAttempts()
+	if attempts.Total != 2 {
+		t.Fatalf("expected 2 double spend attempts but got %v", attempts.Total)
+	}
+	if attempts.ByIP["127.0.0.1"] != 2 {
+		t.Fatalf("expected 2 attempts from IP but got '%v'", attempts.ByIP)
+	}
+	if len(attempts.ByToken) != 1 {
+		t.Fatalf("expected attempts with 1 token but got '%v'", attempts.ByToken)
+	}
+	if _, ok := attempts.Banned["127.0.0.1"]; !ok {
+		t.Fatalf("expected IP to be throttled but got '%v'", attempts.Banned)
 	}
 }
 
-func TestConcurrentMelt(t *testing.T) {
-	var amount uint64 = 210
-	numRequests := 100
-	meltQuotes := make([]string, numRequests)
+func TestProofStateSubscription(t *testing.T) {
+	port, _ := testutils.GetAvailablePort()
+	mintURL := "http://127.0.0.1:" + strconv.Itoa(port)
 
-	var feeReserve uint64 = 0
-	// create 100 melt quotes
-	for i := 0; i < numRequests; i++ {
-		invoice := lnrpc.Invoice{Value: int64(amount)}
-		addInvoiceResponse, err := lnd2.Client.AddInvoice(ctx, &invoice)
-		if err != nil {
-			t.Fatalf("error creating invoice: %v", err)
+	mintPath := filepath.Join(".", "subscriptionmint")
+	mintServer, err := testutils.CreateTestMintServer(&lightning.FakeBackend{}, port, 0, mintPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mintPath)
+	go func() {
+		if err := mintServer.Start(); err != nil {
+			log.Printf("error running mint server: %v", err)
 		}
-		paymentRequest := addInvoiceResponse.PaymentRequest
+	}()
+	defer mintServer.Shutdown()
+	time.Sleep(time.Millisecond * 100)
 
-		meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-		meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
-		if err != nil {
-			t.Fatalf("got unexpected error in melt request: %v", err)
-		}
-		meltQuotes[i] = meltQuote.Id
-		feeReserve = meltQuote.FeeReserve
+	mintInfo, err := client.GetMintInfo(mintURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := nut17.SupportedKinds(*mintInfo, cashu.BOLT11_METHOD, cashu.Sat.String())
+	if !slices.Contains(kinds, nut17.ProofState) {
+		t.Fatalf("expected proof_state subscriptions in mint info but got %v", kinds)
 	}
 
-	proofs, err := testutils.GetValidProofsForAmount(amount+feeReserve, testMint, lnd2)
+	walletPath := filepath.Join(".", "subscriptionwallet")
+	testWallet, err := testutils.CreateTestWallet(walletPath, mintURL)
 	if err != nil {
-		t.Fatalf("error generating valid proofs: %v", err)
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(walletPath)
+	if err := testutils.FundCashuWallet(context.Background(), testWallet, nil, 1000); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+	proofs, err := testWallet.Send(100, mintURL, false)
+	if err != nil {
+		t.Fatalf("unexpected error sending: %v", err)
+	}
+	Ys, err := crypto.ProofsYs(proofs)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	var wg sync.WaitGroup
-	var mu sync.Mutex
+	subscription, err := client.Subscribe(mintURL, nut17.ProofState, Ys)
+	if err != nil {
+		t.Fatalf("unexpected error subscribing: %v", err)
+	}
+	defer subscription.Close()
 
-	// for the created melt quotes, do concurrent requests for each one using the same set of proofs
-	// only 1 should succeed
-	errCount := 0
-	for i := 0; i < numRequests; i++ {
-		wg.Add(1)
-		go func() {
-			meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuotes[i], Inputs: proofs}
-			_, err := testMint.MeltTokens(ctx, meltTokensRequest)
+	readStates := func(expected nut07.State) {
+		notified := make(map[string]bool)
+		for len(notified) < len(Ys) {
+			notification, err := subscription.Read()
 			if err != nil {
-				mu.Lock()
-				errCount++
-				mu.Unlock()
+				t.Fatalf("unexpected error reading notification: %v", err)
 			}
-			wg.Done()
-		}()
+			var state nut07.ProofState
+			if err := json.Unmarshal(notification.Params.Payload, &state); err != nil {
+				t.Fatalf("invalid proof state in notification: %v", err)
+			}
+			if state.State != expected {
+				t.Fatalf("expected proof state '%v' but got '%v'", expected, state.State)
+			}
+			notified[state.Y] = true
+		}
 	}
-	wg.Wait()
+	// current state is sent when subscribing
+	readStates(nut07.Unspent)
 
-	// out of the 100 requests only 1 should have succeeded.
-	// there should be 99 errors
-	if errCount != 99 {
-		t.Fatalf("expected 99 errors but got %v", errCount)
+	keyset := crypto.MintKeyset{Id: proofs[0].Id}
+	outputs, _, _, err := testutils.CreateBlindedMessages(proofs.Amount(), keyset)
+	if err != nil {
+		t.Fatalf("error creating blinded messages: %v", err)
 	}
-
+	if _, err := client.PostSwap(mintURL, nut03.PostSwapRequest{Inputs: proofs, Outputs: outputs}); err != nil {
+		t.Fatalf("unexpected error in swap: %v", err)
+	}
+	readStates(nut07.Spent)
 }
 
-func TestProofsStateCheck(t *testing.T) {
-	proofs, err := testutils.GetValidProofsForAmount(5000, testMint, lnd2)
+func TestMeltQuoteSubscription(t *testing.T) {
+	port, _ := testutils.GetAvailablePort()
+	mintURL := "http://127.0.0.1:" + strconv.Itoa(port)
+
+	mintPath := filepath.Join(".", "meltsubscriptionmint")
+	mintServer, err := testutils.CreateTestMintServer(&lightning.FakeBackend{}, port, 0, mintPath, 0)
 	if err != nil {
-		t.Fatalf("error generating valid proofs: %v", err)
+		t.Fatal(err)
 	}
+	defer os.RemoveAll(mintPath)
+	go func() {
+		if err := mintServer.Start(); err != nil {
+			log.Printf("error running mint server: %v", err)
+		}
+	}()
+	defer mintServer.Shutdown()
+	time.Sleep(time.Millisecond * 100)
 
-	// proofs with P2PK witness
-	lock, _ := btcec.NewPrivateKey()
-	p2pkSpendingCondition := nut10.SpendingCondition{
-		Kind: nut10.P2PK,
-		Data: hex.EncodeToString(lock.PubKey().SerializeCompressed()),
-	}
-	p2pkProofs, err := testutils.GetProofsWithSpendingCondition(2100, p2pkSpendingCondition, testMint, lnd2)
+	mintInfo, err := client.GetMintInfo(mintURL)
 	if err != nil {
-		t.Fatalf("error getting locked proofs: %v", err)
+		t.Fatal(err)
 	}
-	p2pkProofs, _ = testutils.AddP2PKWitnessToInputs(p2pkProofs, []*btcec.PrivateKey{lock})
-
-	// proofs with HTLC witness
-	preimage := "111111"
-	preimageBytes, _ := hex.DecodeString(preimage)
-	hashBytes := sha256.Sum256(preimageBytes)
-	htlcSpendingCondition := nut10.SpendingCondition{
-		Kind: nut10.HTLC,
-		Data: hex.EncodeToString(hashBytes[:]),
+	kinds := nut17.SupportedKinds(*mintInfo, cashu.BOLT11_METHOD, cashu.Sat.String())
+	if !slices.Contains(kinds, nut17.Bolt11MeltQuote) {
+		t.Fatalf("expected bolt11_melt_quote subscriptions in mint info but got %v", kinds)
 	}
-	htlcProofs, err := testutils.GetProofsWithSpendingCondition(2100, htlcSpendingCondition, testMint, lnd2)
+
+	walletPath := filepath.Join(".", "meltsubscriptionwallet")
+	testWallet, err := testutils.CreateTestWallet(walletPath, mintURL)
 	if err != nil {
-		t.Fatalf("error getting locked proofs: %v", err)
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(walletPath)
+	if err := testutils.FundCashuWallet(context.Background(), testWallet, nil, 5000); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
 	}
-	htlcProofs, _ = testutils.AddHTLCWitnessToInputs(htlcProofs, preimage, nil)
 
 	tests := []struct {
-		proofs cashu.Proofs
+		name        string
+		failPayment bool
+		// states notified after the initial unpaid state
+		states []nut05.State
 	}{
-		{proofs},
-		{p2pkProofs},
-		{htlcProofs},
+		{name: "paid", states: []nut05.State{nut05.Pending, nut05.Paid}},
+		{name: "failed", failPayment: true, states: []nut05.State{nut05.Pending, nut05.Unpaid}},
 	}
 
 	for _, test := range tests {
-		Ys := make([]string, len(test.proofs))
-		for i, proof := range test.proofs {
-			Y, _ := crypto.HashToCurve([]byte(proof.Secret))
-			Yhex := hex.EncodeToString(Y.SerializeCompressed())
-			Ys[i] = Yhex
-		}
+		t.Run(test.name, func(t *testing.T) {
+			invoice, _, _, err := lightning.CreateFakeInvoice(1000, test.failPayment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			meltQuote, err := testWallet.RequestMeltQuote(invoice, mintURL)
+			if err != nil {
+				t.Fatalf("unexpected error requesting melt quote: %v", err)
+			}
 
-		proofStates, err := testMint.ProofsStateCheck(Ys)
-		if err != nil {
-			t.Fatalf("unexpected error checking proof states: %v", err)
-		}
+			subscription, err := client.Subscribe(mintURL, nut17.Bolt11MeltQuote, []string{meltQuote.Quote})
+			if err != nil {
+				t.Fatalf("unexpected error subscribing: %v", err)
+			}
+			defer subscription.Close()
 
-		// proofs should be unspent here
-		for _, proofState := range proofStates {
-			if proofState.State != nut07.Unspent {
-				t.Fatalf("expected proof state '%s' but got '%s'", nut07.Unspent, proofState.State)
+			readState := func(expected nut05.State) nut05.PostMeltQuoteBolt11Response {
+				notification, err := subscription.Read()
+				if err != nil {
+					t.Fatalf("unexpected error reading notification: %v", err)
+				}
+				var quote nut05.PostMeltQuoteBolt11Response
+				if err := json.Unmarshal(notification.Params.Payload, &quote); err != nil {
+					t.Fatalf("invalid melt quote in notification: %v", err)
+				}
+				if quote.Quote != meltQuote.Quote {
+					t.Fatalf("expected notification for quote '%v' but got '%v'", meltQuote.Quote, quote.Quote)
+				}
+				if quote.State != expected {
+					t.Fatalf("expected melt quote state '%v' but got '%v'", expected, quote.State)
+				}
+				return quote
 			}
-		}
+			// current state is sent when subscribing
+			readState(nut05.Unpaid)
 
-		// spend proofs and check spent state in response from mint
-		proofsToSpend := cashu.Proofs{}
-		numProofs := len(test.proofs) / 2
-		Ys = make([]string, numProofs)
-		for i := 0; i < numProofs; i++ {
-			proofsToSpend = append(proofsToSpend, test.proofs[i])
-			Y, _ := crypto.HashToCurve([]byte(test.proofs[i].Secret))
-			Yhex := hex.EncodeToString(Y.SerializeCompressed())
-			Ys[i] = Yhex
-		}
+			testWallet.Melt(meltQuote.Quote)
+			var quote nut05.PostMeltQuoteBolt11Response
+			for _, state := range test.states {
+				quote = readState(state)
+			}
+			if quote.State == nut05.Paid && len(quote.Preimage) == 0 {
+				t.Fatal("expected preimage in notification of paid quote")
+			}
+		})
+	}
+}
 
-		blindedMessages, _, _, _ := testutils.CreateBlindedMessages(proofsToSpend.Amount(), testMint.GetActiveKeyset())
-		_, err = testMint.Swap(proofsToSpend, blindedMessages)
-		if err != nil {
-			t.Fatalf("unexpected error in swap: %v", err)
+func TestMintQuoteRateLimit(t *testing.T) {
+	port, _ := testutils.GetAvailablePort()
+	mintURL := "http://127.0.0.1:" + strconv.Itoa(port)
+
+	mintPath := filepath.Join(".", "quoteratelimitmint")
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, port, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mintPath)
+	config.QuoteRateLimit = mint.QuoteRateLimit{PerClient: 2, Refill: time.Hour, MaxUnpaid: 3}
+	mintServer, err := mint.SetupMintServer(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if err := mintServer.Start(); err != nil {
+			log.Printf("error running mint server: %v", err)
 		}
+	}()
+	defer mintServer.Shutdown()
+	time.Sleep(time.Millisecond * 100)
 
-		proofStates, err = testMint.ProofsStateCheck(Ys)
+	requestQuote := func() (*http.Response, cashu.Error) {
+		resp, err := http.Post(mintURL+"/v1/mint/quote/bolt11", "application/json",
+			strings.NewReader(`{"amount": 100, "unit": "sat"}`))
 		if err != nil {
-			t.Fatalf("unexpected error checking proof states: %v", err)
+			t.Fatal(err)
 		}
-
-		for i, proofState := range proofStates {
-			if proofState.State != nut07.Spent {
-				t.Fatalf("expected proof state '%s' but got '%s'", nut07.Spent, proofState.State)
-			}
-
-			if len(proofsToSpend[i].Witness) > 0 {
-				if proofState.Witness != proofsToSpend[i].Witness {
-					t.Fatalf("expected state witness '%s' but got '%s'", proofsToSpend[i].Witness, proofState.Witness)
-				}
+		defer resp.Body.Close()
+		var errResponse cashu.Error
+		if resp.StatusCode != http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&errResponse); err != nil {
+				t.Fatalf("error decoding error response: %v", err)
 			}
 		}
-	}
-}
-
-func TestRestoreSignatures(t *testing.T) {
-	// create blinded messages
-	blindedMessages, _, _, blindedSignatures, err := testutils.GetBlindedSignatures(5000, testMint, lnd2)
-	if err != nil {
-		t.Fatalf("error generating blinded signatures: %v", err)
+		return resp, errResponse
 	}
 
-	outputs, signatures, err := testMint.RestoreSignatures(blindedMessages)
-	if err != nil {
-		t.Fatalf("unexpected error restoring signatures: %v\n", err)
+	for i := 0; i < 2; i++ {
+		resp, _ := requestQuote()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected status 200 but got %v", resp.StatusCode)
+		}
 	}
 
-	if len(outputs) != len(signatures) {
-		t.Fatalf("length of ouputs '%v' does not match length of signatures '%v'\n", len(outputs), len(signatures))
+	// client is throttled after using its quotes
+	resp, errResponse := requestQuote()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 but got %v", resp.StatusCode)
 	}
-	if !reflect.DeepEqual(blindedMessages, outputs) {
-		t.Fatal("outputs in request do not match outputs from mint response")
+	if !strings.Contains(errResponse.Detail, "too many mint quotes: limit is 2 every 1h0m0s") {
+		t.Fatalf("expected limit in error detail but got '%v'", errResponse.Detail)
 	}
-	if !reflect.DeepEqual(blindedSignatures, signatures) {
-		t.Fatal("blinded signatures do not match signatures from mint response")
+	if retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After")); retryAfter <= 0 {
+		t.Fatalf("expected Retry-After header but got '%v'", resp.Header.Get("Retry-After"))
 	}
 
-	// test with blinded messages that have not been previously signed
-	unsigned, _, _, _ := testutils.CreateBlindedMessages(4200, testMint.GetActiveKeyset())
-	outputs, signatures, err = testMint.RestoreSignatures(unsigned)
-	if err != nil {
-		t.Fatalf("unexpected error restoring signatures: %v\n", err)
+	stats := mintServer.MintQuoteLimits()
+	if stats.Throttled != 1 || stats.ThrottledByIP["127.0.0.1"] != 1 {
+		t.Fatalf("expected 1 throttled request from IP but got '%+v'", stats)
 	}
-
-	// response should be empty
-	if len(outputs) != 0 && len(signatures) != 0 {
-		t.Fatalf("expected empty outputs and signatures but got %v and %v\n", len(outputs), len(signatures))
+	if stats.Unpaid != 2 {
+		t.Fatalf("expected 2 unpaid quotes but got %v", stats.Unpaid)
 	}
 
-	// test with only a portion of blinded messages signed
-	partial := append(blindedMessages, unsigned...)
-	outputs, signatures, err = testMint.RestoreSignatures(partial)
+	// only the max of unpaid quotes applies without the limit per client
+	config.QuoteRateLimit = mint.QuoteRateLimit{MaxUnpaid: 3}
+	if _, err := mintServer.ReloadConfig(*config); err != nil {
+		t.Fatalf("unexpected error reloading config: %v", err)
+	}
+	mintQuote, err := client.PostMintQuoteBolt11(mintURL, nut04.PostMintQuoteBolt11Request{Amount: 100, Unit: "sat"})
 	if err != nil {
-		t.Fatalf("unexpected error restoring signatures: %v\n", err)
+		t.Fatalf("unexpected error requesting mint quote: %v", err)
+	}
+	resp, errResponse = requestQuote()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 but got %v", resp.StatusCode)
+	}
+	if !strings.Contains(errResponse.Detail, "too many unpaid mint quotes: limit is 3") {
+		t.Fatalf("expected limit in error detail but got '%v'", errResponse.Detail)
+	}
+	if stats := mintServer.MintQuoteLimits(); stats.UnpaidRejected != 1 || stats.Unpaid != 3 {
+		t.Fatalf("expected 1 request rejected with 3 unpaid quotes but got '%+v'", stats)
 	}
 
-	if len(outputs) != len(signatures) {
-		t.Fatalf("length of ouputs '%v' does not match length of signatures '%v'\n", len(outputs), len(signatures))
+	// quotes that are paid are not counted
+	if _, err := client.GetMintQuoteState(mintURL, mintQuote.Quote); err != nil {
+		t.Fatalf("unexpected error getting mint quote state: %v", err)
 	}
-	if !reflect.DeepEqual(blindedMessages, outputs) {
-		t.Fatal("outputs in request do not match outputs from mint response")
+	if stats := mintServer.MintQuoteLimits(); stats.Unpaid != 2 {
+		t.Fatalf("expected 2 unpaid quotes but got %v", stats.Unpaid)
 	}
-	if !reflect.DeepEqual(blindedSignatures, signatures) {
-		t.Fatal("blinded signatures do not match signatures from mint response")
+	if resp, _ := requestQuote(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status 200 but got %v", resp.StatusCode)
 	}
 }
 
-func TestMintLimits(t *testing.T) {
-	// setup mint with limits
-	limitsMintPath := filepath.Join(".", "limitsMint")
-	mintLimits := mint.MintLimits{
-		MaxBalance:      15000,
-		MintingSettings: mint.MintMethodSettings{MaxAmount: 10000},
-		MeltingSettings: mint.MeltMethodSettings{MaxAmount: 10000},
-	}
+func TestRequestLogging(t *testing.T) {
+	port, _ := testutils.GetAvailablePort()
+	mintURL := "http://127.0.0.1:" + strconv.Itoa(port)
 
-	limitsMint, err := testutils.CreateTestMint(
-		lnd1,
-		limitsMintPath,
-		100,
-		mintLimits,
-	)
+	mintPath := filepath.Join(".", "requestlogmint")
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, port, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mintPath)
+	config.LogLevel = mint.Info
+	config.LogClientFingerprint = true
+	mintServer, err := mint.SetupMintServer(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		if err := mintServer.Start(); err != nil {
+			log.Printf("error running mint server: %v", err)
+		}
+	}()
+	defer mintServer.Shutdown()
+	time.Sleep(time.Millisecond * 100)
 
+	resp, err := http.Post(mintURL+"/v1/mint/quote/bolt11", "application/json",
+		strings.NewReader(`{"amount": 100, "unit": "sat"}`))
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer os.RemoveAll(limitsMintPath)
+	resp.Body.Close()
+	quoteRequestId := resp.Header.Get(mint.RequestIdHeader)
+	if len(quoteRequestId) == 0 {
+		t.Fatal("expected request id in response header")
+	}
 
-	keyset := limitsMint.GetActiveKeyset()
+	resp, err = http.Get(mintURL + "/v1/mint/quote/bolt11/notexist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	errRequestId := resp.Header.Get(mint.RequestIdHeader)
+	if len(errRequestId) == 0 || errRequestId == quoteRequestId {
+		t.Fatalf("expected new request id but got '%v'", errRequestId)
+	}
 
-	// test above mint max amount
-	var mintAmount uint64 = 20000
-	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err := limitsMint.RequestMintQuote(mintQuoteRequest)
-	if !errors.Is(err, cashu.MintAmountExceededErr) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintAmountExceededErr, err)
+	logs, err := os.ReadFile(filepath.Join(mintPath, "mint.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	linesWith := func(requestId string) []string {
+		var lines []string
+		for _, line := range strings.Split(string(logs), "\n") {
+			if strings.Contains(line, "request_id="+requestId) {
+				lines = append(lines, line)
+			}
+		}
+		return lines
 	}
 
-	// amount below max limit
-	mintAmount = 9500
-	mintQuoteRequest = nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err = limitsMint.RequestMintQuote(mintQuoteRequest)
-	if err != nil {
-		t.Fatalf("error requesting mint quote: %v", err)
+	// logs from the mint for the request have its id
+	quoteLines := linesWith(quoteRequestId)
+	if !slices.ContainsFunc(quoteLines, func(line string) bool {
+		return strings.Contains(line, "requesting invoice from lightning backend")
+	}) {
+		t.Fatalf("expected mint logs for the request but got '%v'", quoteLines)
+	}
+	handled := quoteLines[len(quoteLines)-1]
+	for _, attr := range []string{"handled request", "method=POST", "path=/v1/mint/quote/bolt11", "status=200", "duration=", "client="} {
+		if !strings.Contains(handled, attr) {
+			t.Fatalf("expected '%v' in request log '%v'", attr, handled)
+		}
+	}
+	if strings.Contains(handled, "127.0.0.1") {
+		t.Fatalf("client IP should not be logged: '%v'", handled)
 	}
 
-	blindedMessages, secrets, rs, _ := testutils.CreateBlindedMessages(mintAmount, keyset)
+	errLines := linesWith(errRequestId)
+	handled = errLines[len(errLines)-1]
+	errCode := "error_code=" + strconv.Itoa(int(cashu.QuoteNotExistErr.Code))
+	if !strings.Contains(handled, "status=400") || !strings.Contains(handled, errCode) {
+		t.Fatalf("expected status and error code in request log '%v'", handled)
+	}
+}
 
-	//pay invoice
-	sendPaymentRequest := lnrpc.SendRequest{
-		PaymentRequest: mintQuoteResponse.PaymentRequest,
+func TestCORSPolicy(t *testing.T) {
+	port, _ := testutils.GetAvailablePort()
+	mintURL := "http://127.0.0.1:" + strconv.Itoa(port)
+
+	mintPath := filepath.Join(".", "corsmint")
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, port, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
 	}
-	response, _ := lnd2.Client.SendPaymentSync(ctx, &sendPaymentRequest)
-	if len(response.PaymentError) > 0 {
-		t.Fatalf("error paying invoice: %v", response.PaymentError)
+	defer os.RemoveAll(mintPath)
+
+	config.CORS = mint.CORSPolicy{AllowedOrigins: []string{"wallet.example.com"}}
+	if _, err := mint.SetupMintServer(*config); err == nil {
+		t.Fatal("expected error setting up mint with invalid origin")
 	}
 
-	mintTokensRequest := nut04.PostMintBolt11Request{Quote: mintQuoteResponse.Id, Outputs: blindedMessages}
-	blindedSignatures, err := limitsMint.MintTokens(mintTokensRequest)
+	walletOrigin := "https://wallet.example.com"
+	config.CORS = mint.CORSPolicy{AllowedOrigins: []string{walletOrigin + "/"}, MaxAge: 10 * time.Minute}
+	mintServer, err := mint.SetupMintServer(*config)
 	if err != nil {
-		t.Fatalf("got unexpected error minting tokens: %v", err)
+		t.Fatal(err)
 	}
+	go func() {
+		if err := mintServer.Start(); err != nil {
+			log.Printf("error running mint server: %v", err)
+		}
+	}()
+	defer mintServer.Shutdown()
+	time.Sleep(time.Millisecond * 100)
 
-	// test request mint that will make it go above max balance
-	mintQuoteRequest = nut04.PostMintQuoteBolt11Request{Amount: 9000, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err = limitsMint.RequestMintQuote(mintQuoteRequest)
-	if !errors.Is(err, cashu.MintingDisabled) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintingDisabled, err)
+	do := func(method, path, origin, requestMethod string, body io.Reader) *http.Response {
+		req, err := http.NewRequest(method, mintURL+path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Content-Type", "application/json")
+		if len(requestMethod) > 0 {
+			req.Header.Set("Access-Control-Request-Method", requestMethod)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
 	}
 
-	// test melt with invoice over max melt amount
-	invoice := lnrpc.Invoice{Value: 15000}
-	addInvoiceResponse, err := lnd2.Client.AddInvoice(ctx, &invoice)
-	if err != nil {
-		t.Fatalf("error creating invoice: %v", err)
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		origin        string
+		requestMethod string
+		body          string
+		allowOrigin   string
+		allowMethods  string
+		maxAge        string
+	}{
+		{
+			name:          "preflight GET from any origin",
+			method:        http.MethodOptions,
+			path:          "/v1/info",
+			origin:        "https://other.example.com",
+			requestMethod: http.MethodGet,
+			allowOrigin:   "*",
+			allowMethods:  "GET, OPTIONS",
+			maxAge:        "600",
+		},
+		{
+			name:        "GET from any origin",
+			method:      http.MethodGet,
+			path:        "/v1/keys",
+			origin:      "https://other.example.com",
+			allowOrigin: "*",
+		},
+		{
+			name:          "preflight POST from origin not allowed",
+			method:        http.MethodOptions,
+			path:          "/v1/swap",
+			origin:        "https://other.example.com",
+			requestMethod: http.MethodPost,
+		},
+		{
+			name:   "POST from origin not allowed",
+			method: http.MethodPost,
+			path:   "/v1/mint/quote/bolt11",
+			origin: "https://other.example.com",
+			body:   `{"amount": 100, "unit": "sat"}`,
+		},
+		{
+			name:          "preflight POST from allowed origin",
+			method:        http.MethodOptions,
+			path:          "/v1/swap",
+			origin:        walletOrigin,
+			requestMethod: http.MethodPost,
+			allowOrigin:   walletOrigin,
+			allowMethods:  "GET, POST, OPTIONS",
+			maxAge:        "600",
+		},
+		{
+			name:        "POST from allowed origin",
+			method:      http.MethodPost,
+			path:        "/v1/mint/quote/bolt11",
+			origin:      walletOrigin,
+			body:        `{"amount": 100, "unit": "sat"}`,
+			allowOrigin: walletOrigin,
+		},
 	}
-	paymentRequest := addInvoiceResponse.PaymentRequest
 
-	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	_, err = limitsMint.RequestMeltQuote(meltQuoteRequest)
-	if !errors.Is(err, cashu.MeltAmountExceededErr) {
-		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MeltAmountExceededErr, err)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := do(test.method, test.path, test.origin, test.requestMethod, strings.NewReader(test.body))
+			if test.method == http.MethodOptions && resp.StatusCode != http.StatusNoContent {
+				t.Fatalf("expected status %v but got %v", http.StatusNoContent, resp.StatusCode)
+			}
+			if test.method != http.MethodOptions && resp.StatusCode != http.StatusOK {
+				t.Fatalf("expected status %v but got %v", http.StatusOK, resp.StatusCode)
+			}
+			if allowOrigin := resp.Header.Get("Access-Control-Allow-Origin"); allowOrigin != test.allowOrigin {
+				t.Fatalf("expected allowed origin '%v' but got '%v'", test.allowOrigin, allowOrigin)
+			}
+			if allowMethods := resp.Header.Get("Access-Control-Allow-Methods"); allowMethods != test.allowMethods {
+				t.Fatalf("expected allowed methods '%v' but got '%v'", test.allowMethods, allowMethods)
+			}
+			if maxAge := resp.Header.Get("Access-Control-Max-Age"); maxAge != test.maxAge {
+				t.Fatalf("expected max age '%v' but got '%v'", test.maxAge, maxAge)
+			}
+		})
 	}
+}
 
-	// test melt with invoice within limit
-	validProofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
-	invoice = lnrpc.Invoice{Value: 8000}
-	addInvoiceResponse, err = lnd2.Client.AddInvoice(ctx, &invoice)
+func TestRequestValidation(t *testing.T) {
+	port, _ := testutils.GetAvailablePort()
+	mintURL := "http://127.0.0.1:" + strconv.Itoa(port)
+
+	mintPath := filepath.Join(".", "requestvalidationmint")
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, port, 0, mintPath, 0, mint.MintLimits{})
 	if err != nil {
-		t.Fatalf("error creating invoice: %v", err)
+		t.Fatal(err)
 	}
-	paymentRequest = addInvoiceResponse.PaymentRequest
-
-	meltQuoteRequest = nut05.PostMeltQuoteBolt11Request{Request: paymentRequest, Unit: cashu.Sat.String()}
-	meltQuote, err := limitsMint.RequestMeltQuote(meltQuoteRequest)
+	defer os.RemoveAll(mintPath)
+	config.MaxRequestSize = 1 << 16
+	config.MaxWitnessSize = 2 * mint.DefaultMaxWitnessSize
+	mintServer, err := mint.SetupMintServer(*config)
 	if err != nil {
-		t.Fatalf("got unexpected error in melt request: %v", err)
+		t.Fatal(err)
 	}
+	go func() {
+		if err := mintServer.Start(); err != nil {
+			log.Printf("error running mint server: %v", err)
+		}
+	}()
+	defer mintServer.Shutdown()
+	time.Sleep(time.Millisecond * 100)
 
-	meltTokensRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.Id, Inputs: validProofs}
-	_, err = limitsMint.MeltTokens(ctx, meltTokensRequest)
-	if err != nil {
-		t.Fatalf("got unexpected error in melt: %v", err)
+	const (
+		keysetId = "00a1b2c3d4e5f6a7"
+		point    = "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	)
+	output := func(amount uint64, id, B_ string) string {
+		return fmt.Sprintf(`{"amount": %v, "id": "%v", "B_": "%v"}`, amount, id, B_)
+	}
+	proof := func(secret, C, witness string) string {
+		return fmt.Sprintf(`{"amount": 8, "id": "%v", "secret": "%v", "C": "%v", "witness": %q}`,
+			keysetId, secret, C, witness)
 	}
 
-	// this should be within max balance now
-	mintQuoteRequest = nut04.PostMintQuoteBolt11Request{Amount: 9000, Unit: cashu.Sat.String()}
-	mintQuoteResponse, err = limitsMint.RequestMintQuote(mintQuoteRequest)
-	if err != nil {
-		t.Fatalf("got unexpected error requesting mint quote: %v", err)
+	// valid json larger than the default max witness size
+	largeWitness := `{"signatures": ["` + strings.Repeat("a", mint.DefaultMaxWitnessSize) + `"]}`
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "mint quote amount",
+			method:   http.MethodPost,
+			path:     "/v1/mint/quote/bolt11",
+			body:     `{"amount": 0, "unit": "sat"}`,
+			expected: "invalid amount",
+		},
+		{
+			name:     "mint quote pubkey",
+			method:   http.MethodPost,
+			path:     "/v1/mint/quote/bolt11",
+			body:     `{"amount": 100, "unit": "sat", "pubkey": "notapubkey"}`,
+			expected: "invalid pubkey",
+		},
+		{
+			name:     "mint quote wrong type",
+			method:   http.MethodPost,
+			path:     "/v1/mint/quote/bolt11",
+			body:     `{"amount": "100", "unit": "sat"}`,
+			expected: `for field "amount"`,
+		},
+		{
+			name:     "mint quote state id",
+			method:   http.MethodGet,
+			path:     "/v1/mint/quote/bolt11/" + strings.Repeat("a", 200),
+			expected: "invalid quote",
+		},
+		{
+			name:     "mint output amount",
+			method:   http.MethodPost,
+			path:     "/v1/mint/bolt11",
+			body:     `{"quote": "quoteid", "outputs": [` + output(3, keysetId, point) + `]}`,
+			expected: "invalid amount",
+		},
+		{
+			name:     "mint output B_",
+			method:   http.MethodPost,
+			path:     "/v1/mint/bolt11",
+			body:     `{"quote": "quoteid", "outputs": [` + output(8, keysetId, "zz") + `]}`,
+			expected: "invalid B_",
+		},
+		{
+			name:     "swap output keyset id",
+			method:   http.MethodPost,
+			path:     "/v1/swap",
+			body:     `{"inputs": [` + proof("secret", point, "") + `], "outputs": [` + output(8, "id!", point) + `]}`,
+			expected: "invalid keyset id",
+		},
+		{
+			name:   "swap input secret",
+			method: http.MethodPost,
+			path:   "/v1/swap",
+			body: `{"inputs": [` + proof(strings.Repeat("s", 5000), point, "") + `], "outputs": [` +
+				output(8, keysetId, point) + `]}`,
+			expected: "invalid secret",
+		},
+		{
+			name:   "swap input witness",
+			method: http.MethodPost,
+			path:   "/v1/swap",
+			body: `{"inputs": [` + proof("secret", point, "{notjson") + `], "outputs": [` +
+				output(8, keysetId, point) + `]}`,
+			expected: "invalid witness",
+		},
+		{
+			// only bound by the configured max witness size
+			name:   "swap input witness larger than default max",
+			method: http.MethodPost,
+			path:   "/v1/swap",
+			body: `{"inputs": [` + proof("secret", point, largeWitness) + `], "outputs": [` +
+				output(8, keysetId, point) + `]}`,
+			expected: "unknown keyset",
+		},
+		{
+			name:     "melt quote request",
+			method:   http.MethodPost,
+			path:     "/v1/melt/quote/bolt11",
+			body:     `{"request": "", "unit": "sat"}`,
+			expected: "invalid request",
+		},
+		{
+			name:     "melt input C",
+			method:   http.MethodPost,
+			path:     "/v1/melt/bolt11",
+			body:     `{"quote": "quoteid", "inputs": [` + proof("secret", "04"+point[2:], "") + `]}`,
+			expected: "invalid C",
+		},
+		{
+			name:     "check state Y",
+			method:   http.MethodPost,
+			path:     "/v1/checkstate",
+			body:     `{"Ys": ["` + point[:10] + `"]}`,
+			expected: "invalid Y",
+		},
+		{
+			name:     "restore output B_",
+			method:   http.MethodPost,
+			path:     "/v1/restore",
+			body:     `{"outputs": [` + output(0, keysetId, point+"00") + `]}`,
+			expected: "invalid B_",
+		},
+		{
+			name:     "body too large",
+			method:   http.MethodPost,
+			path:     "/v1/checkstate",
+			body:     `{"Ys": ["` + strings.Repeat("0", 1<<17) + `"]}`,
+			expected: "request body larger than",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest(test.method, mintURL+test.path, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("expected status 400 but got %v", resp.StatusCode)
+			}
+			var errResponse cashu.Error
+			if err := json.NewDecoder(resp.Body).Decode(&errResponse); err != nil {
+				t.Fatalf("error decoding error response: %v", err)
+			}
+			if !strings.Contains(errResponse.Detail, test.expected) {
+				t.Fatalf("expected error with '%v' but got '%v'", test.expected, errResponse.Detail)
+			}
+		})
 	}
 }
 
@@ -1645,6 +5023,176 @@ func TestDLEQProofs(t *testing.T) {
 	}
 }
 
+func TestWitnessLimits(t *testing.T) {
+	mintPath := filepath.Join(".", "witnesslimitsmint")
+	lndClient, err := testutils.LndClient(lnd1, mintPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mintPath)
+	config, err := testutils.MintConfig(lndClient, 0, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MaxWitnessSize = 2048
+	config.MaxWitnessSignatures = 3
+	limitsMint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyset := limitsMint.GetActiveKeyset()
+
+	lock, _ := btcec.NewPrivateKey()
+	p2pkSpendingCondition := nut10.SpendingCondition{
+		Kind: nut10.P2PK,
+		Data: hex.EncodeToString(lock.PubKey().SerializeCompressed()),
+	}
+	var mintAmount uint64 = 2
+	lockedProofs, err := testutils.GetProofsWithSpendingCondition(mintAmount, p2pkSpendingCondition, limitsMint, lnd2)
+	if err != nil {
+		t.Fatalf("error getting locked proofs: %v", err)
+	}
+	blindedMessages, _, _, _ := testutils.CreateBlindedMessages(mintAmount, keyset)
+
+	// more signatures than the max
+	keys := make([]*btcec.PrivateKey, 4)
+	for i := range keys {
+		keys[i], _ = btcec.NewPrivateKey()
+	}
+	keys[0] = lock
+	proofs, _ := testutils.AddP2PKWitnessToInputs(slices.Clone(lockedProofs), keys)
+	_, err = limitsMint.Swap(proofs, blindedMessages)
+	if !errors.Is(err, nut11.TooManySignaturesErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut11.TooManySignaturesErr, err)
+	}
+
+	// witness larger than the max
+	proofs = slices.Clone(lockedProofs)
+	for i := range proofs {
+		proofs[i].Witness = `{"signatures":["` + strings.Repeat("a", 4096) + `"]}`
+	}
+	_, err = limitsMint.Swap(proofs, blindedMessages)
+	if !errors.Is(err, nut11.WitnessTooLargeErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut11.WitnessTooLargeErr, err)
+	}
+
+	// within the limits
+	proofs, _ = testutils.AddP2PKWitnessToInputs(slices.Clone(lockedProofs), keys[:3])
+	if _, err := limitsMint.Swap(proofs, blindedMessages); err != nil {
+		t.Fatalf("unexpected error in swap: %v", err)
+	}
+}
+
+// escrowVerifier accepts the witness with the data of the secret
+type escrowVerifier struct{}
+
+func (escrowVerifier) VerifyProof(proof cashu.Proof, secret nut10.WellKnownSecret, witness string) error {
+	if witness != "escrow-witness:"+secret.Data.Data {
+		return nut11.InvalidWitness
+	}
+	return nil
+}
+
+func TestConditionVerifiers(t *testing.T) {
+	escrowKind, otherKind := nut10.MinCustomKind, nut10.MinCustomKind+1
+	if err := nut10.RegisterKind(escrowKind, "ESCROW"); err != nil {
+		t.Fatal(err)
+	}
+	if err := nut10.RegisterKind(otherKind, "OTHER"); err != nil {
+		t.Fatal(err)
+	}
+
+	config := mint.Config{
+		DB:                 memory.NewMemoryDB(),
+		LightningClient:    &lightning.FakeBackend{},
+		LogLevel:           mint.Disable,
+		ConditionVerifiers: map[nut10.SecretKind]mint.ConditionVerifier{nut10.P2PK: escrowVerifier{}},
+	}
+	if _, err := mint.LoadMint(config); err == nil {
+		t.Fatal("expected error loading mint with verifier for built-in kind")
+	}
+
+	config.ConditionVerifiers = map[nut10.SecretKind]mint.ConditionVerifier{escrowKind: escrowVerifier{}}
+	verifierMint, err := mint.LoadMint(config)
+	if err != nil {
+		t.Fatalf("unexpected error loading mint: %v", err)
+	}
+	keyset := verifierMint.GetActiveKeyset()
+
+	var mintAmount uint64 = 2
+	mintQuote, err := verifierMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	condition := nut10.SpendingCondition{Kind: escrowKind, Data: "buyer-key"}
+	lockedMessages, secrets, rs, err := testutils.BlindedMessagesFromSpendingCondition([]uint64{mintAmount}, keyset.Id, condition)
+	if err != nil {
+		t.Fatalf("error creating locked outputs: %v", err)
+	}
+	blindedSignatures, err := verifierMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: lockedMessages})
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	lockedProofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+	blindedMessages, _, _, _ := testutils.CreateBlindedMessages(mintAmount, keyset)
+
+	// invalid witness
+	proofs := slices.Clone(lockedProofs)
+	for i := range proofs {
+		proofs[i].Witness = "escrow-witness:seller-key"
+	}
+	_, err = verifierMint.Swap(proofs, blindedMessages)
+	if !errors.Is(err, nut11.InvalidWitness) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut11.InvalidWitness, err)
+	}
+
+	// registered kinds without a verifier are rejected
+	proofs = slices.Clone(lockedProofs)
+	for i := range proofs {
+		proofs[i].Secret = strings.Replace(proofs[i].Secret, escrowKind.String(), otherKind.String(), 1)
+	}
+	_, err = verifierMint.Swap(proofs, blindedMessages)
+	if !errors.Is(err, nut11.InvalidKindErr) {
+		t.Fatalf("expected error '%v' but got '%v' instead", nut11.InvalidKindErr, err)
+	}
+
+	// kinds that were not registered can be spent by anyone
+	mintQuote, err = verifierMint.RequestMintQuote(nut04.PostMintQuoteBolt11Request{Amount: mintAmount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	unregisteredSecret := `["UNREGISTERED",{"data":"buyer-key","nonce":"da62796403af76c80cd6ce9153ed3746","tags":[]}]`
+	r, _ := btcec.NewPrivateKey()
+	B_, r, err := crypto.BlindMessage(unregisteredSecret, r)
+	if err != nil {
+		t.Fatalf("error blinding message: %v", err)
+	}
+	unregisteredMessages := cashu.BlindedMessages{cashu.NewBlindedMessage(keyset.Id, mintAmount, B_)}
+	blindedSignatures, err = verifierMint.MintTokens(nut04.PostMintBolt11Request{Quote: mintQuote.Id, Outputs: unregisteredMessages})
+	if err != nil {
+		t.Fatalf("got unexpected error minting tokens: %v", err)
+	}
+	unregisteredProofs, err := testutils.ConstructProofs(blindedSignatures, []string{unregisteredSecret}, []*btcec.PrivateKey{r}, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+	unregisteredOutputs, _, _, _ := testutils.CreateBlindedMessages(mintAmount, keyset)
+	if _, err := verifierMint.Swap(unregisteredProofs, unregisteredOutputs); err != nil {
+		t.Fatalf("unexpected error in swap of proofs with unregistered kind: %v", err)
+	}
+
+	proofs = slices.Clone(lockedProofs)
+	for i := range proofs {
+		proofs[i].Witness = "escrow-witness:buyer-key"
+	}
+	if _, err := verifierMint.Swap(proofs, blindedMessages); err != nil {
+		t.Fatalf("unexpected error in swap: %v", err)
+	}
+}
+
 func TestHTLC(t *testing.T) {
 	var mintAmount uint64 = 1500
 	preimage := "111111"
@@ -1896,3 +5444,203 @@ func TestHTLC(t *testing.T) {
 		t.Fatalf("expected error '%v' but got '%v' instead", nut11.SigAllOnlySwap, err)
 	}
 }
+
+func TestMintQuoteSubscription(t *testing.T) {
+	port, _ := testutils.GetAvailablePort()
+	mintURL := "http://127.0.0.1:" + strconv.Itoa(port)
+	wsURL := "ws://127.0.0.1:" + strconv.Itoa(port) + "/v1/ws"
+
+	mintPath := filepath.Join(".", "subscriptionmint")
+	fakeBackend := &lightning.FakeBackend{}
+	config, err := testutils.MintConfig(fakeBackend, port, 0, mintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminToken := "admintoken"
+	config.WebsocketAdminToken = adminToken
+	mintServer, err := mint.SetupMintServer(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(mintPath)
+	go func() {
+		if err := mintServer.Start(); err != nil {
+			log.Printf("error running mint server: %v", err)
+		}
+	}()
+	defer mintServer.Shutdown()
+	time.Sleep(time.Millisecond * 100)
+
+	mintInfo, err := client.GetMintInfo(mintURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonSettings, _ := json.Marshal(mintInfo.Nuts[17])
+	var settings nut17.Settings
+	if err := json.Unmarshal(jsonSettings, &settings); err != nil {
+		t.Fatalf("invalid NUT-17 settings in mint info: %v", err)
+	}
+	if len(settings.Supported) != 1 || !slices.Contains(settings.Supported[0].Commands, nut17.Bolt11MintQuote) {
+		t.Fatalf("expected bolt11_mint_quote subscriptions in mint info but got %+v", settings)
+	}
+	keysets, err := client.GetActiveKeysets(mintURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyset := crypto.MintKeyset{Id: keysets.Keysets[0].Id}
+
+	dial := func(header http.Header) (*websocket.Conn, error) {
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+		return conn, err
+	}
+	subscribe := func(conn *websocket.Conn, id int, kind nut17.SubscriptionKind, filters []string) nut17.WsResponse {
+		request := nut17.WsRequest{
+			JSONRPC: nut17.JSONRPC,
+			Method:  nut17.Subscribe,
+			Params:  nut17.RequestParams{Kind: kind, SubId: strconv.Itoa(id), Filters: filters},
+			Id:      id,
+		}
+		if err := conn.WriteJSON(request); err != nil {
+			t.Fatalf("error writing subscribe request: %v", err)
+		}
+		var response nut17.WsResponse
+		if err := conn.ReadJSON(&response); err != nil {
+			t.Fatalf("error reading subscribe response: %v", err)
+		}
+		return response
+	}
+	readState := func(conn *websocket.Conn, quoteId string, expected nut04.State) {
+		conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+		var notification nut17.WsNotification
+		if err := conn.ReadJSON(&notification); err != nil {
+			t.Fatalf("unexpected error reading notification: %v", err)
+		}
+		var quote nut04.PostMintQuoteBolt11Response
+		if err := json.Unmarshal(notification.Params.Payload, &quote); err != nil {
+			t.Fatalf("invalid mint quote in notification: %v", err)
+		}
+		if quote.Quote != quoteId || quote.State != expected {
+			t.Fatalf("expected quote '%v' with state '%v' but got '%+v'", quoteId, expected, quote)
+		}
+	}
+
+	var amount uint64 = 2100
+	mintQuote, err := client.PostMintQuoteBolt11(mintURL, nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	// invoice of the quote is not paid until the status is set to succeeded
+	paymentHash := fakeBackend.Invoices[len(fakeBackend.Invoices)-1].PaymentHash
+	fakeBackend.SetInvoiceStatus(paymentHash, lightning.Pending)
+
+	conn, err := dial(nil)
+	if err != nil {
+		t.Fatalf("unexpected error connecting: %v", err)
+	}
+	defer conn.Close()
+
+	invalidFilters := []struct {
+		kind    nut17.SubscriptionKind
+		filters []string
+		err     string
+	}{
+		{nut17.SubscriptionKind("bolt12_mint_quote"), []string{mintQuote.Quote}, "subscription kind 'bolt12_mint_quote' not supported"},
+		{nut17.Bolt11MeltQuote, []string{"quote1234"}, "invalid filter 'quote1234' at index 0"},
+		{nut17.ProofState, []string{"Y"}, "invalid filter 'Y' at index 0: Y is not a hex string"},
+		{nut17.ProofState, []string{mintQuote.Quote}, "Y is not a valid public key"},
+		{nut17.Bolt11MintQuote, []string{mintQuote.Quote, "quote1234"}, "invalid filter 'quote1234' at index 1"},
+		{nut17.Bolt11MintQuote, []string{mintQuote.Quote, mintQuote.Quote}, "duplicate filter"},
+		{nut17.Bolt11MintQuote, []string{mint.WILDCARD_FILTER}, "only allowed for operators"},
+	}
+	for i, test := range invalidFilters {
+		response := subscribe(conn, i, test.kind, test.filters)
+		if response.Error == nil || !strings.Contains(response.Error.Message, test.err) {
+			t.Fatalf("expected error '%v' subscribing to %v but got '%+v'", test.err, test.filters, response)
+		}
+	}
+
+	response := subscribe(conn, len(invalidFilters), nut17.Bolt11MintQuote, []string{mintQuote.Quote})
+	if response.Error != nil {
+		t.Fatalf("unexpected error subscribing: %v", response.Error)
+	}
+	// current state is sent when subscribing
+	readState(conn, mintQuote.Quote, nut04.Unpaid)
+
+	fakeBackend.SetInvoiceStatus(paymentHash, lightning.Succeeded)
+	readState(conn, mintQuote.Quote, nut04.Paid)
+
+	outputs, _, _, err := testutils.CreateBlindedMessages(amount, keyset)
+	if err != nil {
+		t.Fatalf("error creating blinded messages: %v", err)
+	}
+	mintRequest := nut04.PostMintBolt11Request{Quote: mintQuote.Quote, Outputs: outputs}
+	if _, err := client.PostMintBolt11(mintURL, mintRequest); err != nil {
+		t.Fatalf("unexpected error minting tokens: %v", err)
+	}
+	readState(conn, mintQuote.Quote, nut04.Issued)
+
+	// operators are notified of all the quotes
+	if _, err := dial(http.Header{"Authorization": []string{"Bearer wrongtoken"}}); err == nil {
+		t.Fatal("expected error connecting with invalid admin token")
+	}
+	adminConn, err := dial(http.Header{"Authorization": []string{"Bearer " + adminToken}})
+	if err != nil {
+		t.Fatalf("unexpected error connecting with admin token: %v", err)
+	}
+	defer adminConn.Close()
+
+	response = subscribe(adminConn, 1, nut17.Bolt11MintQuote, []string{mint.WILDCARD_FILTER, mintQuote.Quote})
+	if response.Error == nil || !strings.Contains(response.Error.Message, "cannot be combined") {
+		t.Fatalf("expected error combining wildcard with other filters but got '%+v'", response)
+	}
+	response = subscribe(adminConn, 2, nut17.Bolt11MintQuote, []string{mint.WILDCARD_FILTER})
+	if response.Error != nil {
+		t.Fatalf("unexpected error in wildcard subscription: %v", response.Error)
+	}
+
+	mintQuote, err = client.PostMintQuoteBolt11(mintURL, nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()})
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	outputs, _, _, _ = testutils.CreateBlindedMessages(amount, keyset)
+	mintRequest = nut04.PostMintBolt11Request{Quote: mintQuote.Quote, Outputs: outputs}
+	if _, err := client.PostMintBolt11(mintURL, mintRequest); err != nil {
+		t.Fatalf("unexpected error minting tokens: %v", err)
+	}
+	readState(adminConn, mintQuote.Quote, nut04.Paid)
+	readState(adminConn, mintQuote.Quote, nut04.Issued)
+}
+
+// proofsFromKeyset creates valid proofs signed with the keys of the keyset
+func proofsFromKeyset(amount uint64, keyset *crypto.MintKeyset) (cashu.Proofs, error) {
+	blindedMessages, secrets, rs, err := testutils.CreateBlindedMessages(amount, *keyset)
+	if err != nil {
+		return nil, err
+	}
+
+	blindedSignatures := make(cashu.BlindedSignatures, len(blindedMessages))
+	for i, msg := range blindedMessages {
+		k := keyset.Keys[msg.Amount].PrivateKey
+		B_bytes, err := hex.DecodeString(msg.B_)
+		if err != nil {
+			return nil, err
+		}
+		B_, err := btcec.ParsePubKey(B_bytes)
+		if err != nil {
+			return nil, err
+		}
+		C_ := crypto.SignBlindedMessage(B_, k)
+		e, s := crypto.GenerateDLEQ(k, B_, C_)
+		blindedSignatures[i] = cashu.BlindedSignature{
+			Amount: msg.Amount,
+			C_:     hex.EncodeToString(C_.SerializeCompressed()),
+			Id:     keyset.Id,
+			DLEQ: &cashu.DLEQProof{
+				E: hex.EncodeToString(e.Serialize()),
+				S: hex.EncodeToString(s.Serialize()),
+			},
+		}
+	}
+
+	return testutils.ConstructProofs(blindedSignatures, secrets, rs, keyset)
+}
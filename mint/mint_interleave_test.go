@@ -0,0 +1,385 @@
+//go:build interleave
+
+package mint_test
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint"
+	"github.com/elnosh/gonuts/mint/lightning"
+	"github.com/elnosh/gonuts/testutils"
+)
+
+// time given to the second request to run while the first one is paused.
+// If the second request has not returned by then, it is assumed to be
+// blocked waiting on the first one.
+const gracePeriod = time.Millisecond * 200
+
+// interleave runs first until it reaches the sync point and, while it is
+// paused there, runs second. first is resumed once second returns or
+// after the grace period if second is blocked behind first.
+func interleave(t *testing.T, syncPoint string, first, second func() error) (error, error) {
+	t.Helper()
+
+	reached := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	mint.SetSyncHook(syncPoint, func() {
+		// only pause the first request that reaches the sync point
+		pause := false
+		once.Do(func() { pause = true })
+		if pause {
+			close(reached)
+			<-release
+		}
+	})
+	defer mint.ResetSyncHooks()
+
+	firstErr := make(chan error, 1)
+	go func() { firstErr <- first() }()
+
+	select {
+	case <-reached:
+	case err := <-firstErr:
+		t.Fatalf("first request returned before reaching sync point '%v': %v", syncPoint, err)
+	case <-time.After(time.Second * 10):
+		t.Fatalf("timed out waiting for first request to reach sync point '%v'", syncPoint)
+	}
+
+	secondErr := make(chan error, 1)
+	go func() { secondErr <- second() }()
+
+	var err2 error
+	secondDone := false
+	select {
+	case err2 = <-secondErr:
+		secondDone = true
+	case <-time.After(gracePeriod):
+	}
+
+	close(release)
+	err1 := <-firstErr
+	if !secondDone {
+		err2 = <-secondErr
+	}
+
+	return err1, err2
+}
+
+func expectOneSuccess(t *testing.T, err1, err2 error) {
+	t.Helper()
+	if err1 == nil && err2 == nil {
+		t.Fatal("expected only one of the requests to succeed but both did")
+	}
+	if err1 != nil && err2 != nil {
+		t.Fatalf("expected one of the requests to succeed but both failed: '%v', '%v'", err1, err2)
+	}
+}
+
+func createInterleaveMint(t testing.TB) *mint.Mint {
+	config, err := testutils.MintConfig(&lightning.FakeBackend{}, 0, 0, t.TempDir(), 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatalf("error creating mint config: %v", err)
+	}
+	testMint, err := mint.LoadMint(*config)
+	if err != nil {
+		t.Fatalf("error loading mint: %v", err)
+	}
+	return testMint
+}
+
+func mintQuote(t testing.TB, testMint *mint.Mint, amount uint64) string {
+	mintQuoteRequest := nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: cashu.Sat.String()}
+	mintQuote, err := testMint.RequestMintQuote(mintQuoteRequest)
+	if err != nil {
+		t.Fatalf("error requesting mint quote: %v", err)
+	}
+	return mintQuote.Id
+}
+
+func blindedMessages(t testing.TB, testMint *mint.Mint, amount uint64) cashu.BlindedMessages {
+	blindedMessages, _, _, err := testutils.CreateBlindedMessages(amount, testMint.GetActiveKeyset())
+	if err != nil {
+		t.Fatalf("error creating blinded messages: %v", err)
+	}
+	return blindedMessages
+}
+
+func validProofs(t testing.TB, testMint *mint.Mint, amount uint64) cashu.Proofs {
+	quoteId := mintQuote(t, testMint, amount)
+
+	keyset := testMint.GetActiveKeyset()
+	blindedMessages, secrets, rs, err := testutils.CreateBlindedMessages(amount, keyset)
+	if err != nil {
+		t.Fatalf("error creating blinded messages: %v", err)
+	}
+	mintTokensRequest := nut04.PostMintBolt11Request{Quote: quoteId, Outputs: blindedMessages}
+	blindedSignatures, err := testMint.MintTokens(mintTokensRequest)
+	if err != nil {
+		t.Fatalf("error minting tokens: %v", err)
+	}
+
+	proofs, err := testutils.ConstructProofs(blindedSignatures, secrets, rs, &keyset)
+	if err != nil {
+		t.Fatalf("error constructing proofs: %v", err)
+	}
+	return proofs
+}
+
+func meltQuote(t *testing.T, testMint *mint.Mint, amount uint64) string {
+	invoice, _, _, err := lightning.CreateFakeInvoice(amount, false)
+	if err != nil {
+		t.Fatalf("error creating invoice: %v", err)
+	}
+	meltQuoteRequest := nut05.PostMeltQuoteBolt11Request{Request: invoice, Unit: cashu.Sat.String()}
+	meltQuote, err := testMint.RequestMeltQuote(meltQuoteRequest)
+	if err != nil {
+		t.Fatalf("error requesting melt quote: %v", err)
+	}
+	return meltQuote.Id
+}
+
+func melt(testMint *mint.Mint, quoteId string, proofs cashu.Proofs) func() error {
+	return func() error {
+		meltTokensRequest := nut05.PostMeltBolt11Request{Quote: quoteId, Inputs: proofs}
+		meltQuote, err := testMint.MeltTokens(context.Background(), meltTokensRequest)
+		if err != nil {
+			return err
+		}
+		if meltQuote.State != nut05.Paid {
+			return errors.New("melt quote was not paid")
+		}
+		return nil
+	}
+}
+
+func expectSpent(t *testing.T, testMint *mint.Mint, proofs cashu.Proofs) {
+	t.Helper()
+	Ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			t.Fatalf("error computing Y: %v", err)
+		}
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+	}
+
+	proofStates, err := testMint.ProofsStateCheck(Ys)
+	if err != nil {
+		t.Fatalf("unexpected error checking proof states: %v", err)
+	}
+	for _, proofState := range proofStates {
+		if proofState.State != nut07.Spent {
+			t.Fatalf("expected proof to be spent but got '%v'", proofState.State)
+		}
+	}
+}
+
+// two concurrent requests with different outputs for the same paid quote.
+// Only one of them should get signatures.
+func TestInterleaveMintTokens(t *testing.T) {
+	testMint := createInterleaveMint(t)
+
+	var amount uint64 = 2100
+	quoteId := mintQuote(t, testMint, amount)
+	outputs1 := blindedMessages(t, testMint, amount)
+	outputs2 := blindedMessages(t, testMint, amount)
+
+	mintTokens := func(outputs cashu.BlindedMessages) func() error {
+		return func() error {
+			_, err := testMint.MintTokens(nut04.PostMintBolt11Request{Quote: quoteId, Outputs: outputs})
+			return err
+		}
+	}
+
+	err1, err2 := interleave(t, mint.SyncMintQuotePaid, mintTokens(outputs1), mintTokens(outputs2))
+	expectOneSuccess(t, err1, err2)
+	if err1 != nil && !errors.Is(err1, cashu.MintQuoteAlreadyIssued) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintQuoteAlreadyIssued, err1)
+	}
+	if err2 != nil && !errors.Is(err2, cashu.MintQuoteAlreadyIssued) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintQuoteAlreadyIssued, err2)
+	}
+
+	quote, err := testMint.GetMintQuoteState(quoteId)
+	if err != nil {
+		t.Fatalf("unexpected error getting mint quote: %v", err)
+	}
+	if quote.State != nut04.Issued {
+		t.Fatalf("expected quote state '%v' but got '%v' instead", nut04.Issued, quote.State)
+	}
+}
+
+// two concurrent requests with the same outputs for the same paid quote.
+// The one that fails must not set the already issued quote back to paid.
+func TestInterleaveMintTokensSameOutputs(t *testing.T) {
+	testMint := createInterleaveMint(t)
+
+	var amount uint64 = 2100
+	quoteId := mintQuote(t, testMint, amount)
+	outputs := blindedMessages(t, testMint, amount)
+
+	mintTokens := func() error {
+		_, err := testMint.MintTokens(nut04.PostMintBolt11Request{Quote: quoteId, Outputs: outputs})
+		return err
+	}
+
+	err1, err2 := interleave(t, mint.SyncMintQuotePaid, mintTokens, mintTokens)
+	expectOneSuccess(t, err1, err2)
+
+	// quote should not be usable again with new outputs
+	newOutputs := blindedMessages(t, testMint, amount)
+	_, err := testMint.MintTokens(nut04.PostMintBolt11Request{Quote: quoteId, Outputs: newOutputs})
+	if !errors.Is(err, cashu.MintQuoteAlreadyIssued) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintQuoteAlreadyIssued, err)
+	}
+}
+
+// checking the state of a quote while it gets issued should not
+// set the quote back to paid.
+func TestInterleaveMintQuoteState(t *testing.T) {
+	testMint := createInterleaveMint(t)
+
+	var amount uint64 = 2100
+	quoteId := mintQuote(t, testMint, amount)
+	outputs := blindedMessages(t, testMint, amount)
+
+	var quoteState nut04.State
+	checkState := func() error {
+		quote, err := testMint.GetMintQuoteState(quoteId)
+		quoteState = quote.State
+		return err
+	}
+	mintTokens := func() error {
+		_, err := testMint.MintTokens(nut04.PostMintBolt11Request{Quote: quoteId, Outputs: outputs})
+		return err
+	}
+
+	err1, err2 := interleave(t, mint.SyncMintQuoteInvoiceSettled, checkState, mintTokens)
+	if err1 != nil {
+		t.Fatalf("unexpected error getting mint quote state: %v", err1)
+	}
+	if err2 != nil {
+		t.Fatalf("unexpected error minting tokens: %v", err2)
+	}
+	if quoteState != nut04.Issued {
+		t.Fatalf("expected quote state '%v' but got '%v' instead", nut04.Issued, quoteState)
+	}
+
+	newOutputs := blindedMessages(t, testMint, amount)
+	_, err := testMint.MintTokens(nut04.PostMintBolt11Request{Quote: quoteId, Outputs: newOutputs})
+	if !errors.Is(err, cashu.MintQuoteAlreadyIssued) {
+		t.Fatalf("expected error '%v' but got '%v' instead", cashu.MintQuoteAlreadyIssued, err)
+	}
+}
+
+func TestInterleaveSwap(t *testing.T) {
+	testMint := createInterleaveMint(t)
+
+	var amount uint64 = 2100
+	proofs := validProofs(t, testMint, amount)
+	outputs1 := blindedMessages(t, testMint, amount)
+	outputs2 := blindedMessages(t, testMint, amount)
+
+	swap := func(outputs cashu.BlindedMessages) func() error {
+		return func() error {
+			_, err := testMint.Swap(proofs, outputs)
+			return err
+		}
+	}
+
+	err1, err2 := interleave(t, mint.SyncSwapProofsVerified, swap(outputs1), swap(outputs2))
+	expectOneSuccess(t, err1, err2)
+	expectSpent(t, testMint, proofs)
+}
+
+// same proofs used in a melt and a swap. Whichever goes second
+// should fail regardless of where the first one is paused.
+func TestInterleaveSwapAndMelt(t *testing.T) {
+	var amount uint64 = 2100
+
+	t.Run("melt paused", func(t *testing.T) {
+		testMint := createInterleaveMint(t)
+		proofs := validProofs(t, testMint, amount)
+		quoteId := meltQuote(t, testMint, amount)
+		outputs := blindedMessages(t, testMint, amount)
+
+		swap := func() error {
+			_, err := testMint.Swap(proofs, outputs)
+			return err
+		}
+
+		err1, err2 := interleave(t, mint.SyncMeltProofsVerified, melt(testMint, quoteId, proofs), swap)
+		expectOneSuccess(t, err1, err2)
+		expectSpent(t, testMint, proofs)
+	})
+
+	t.Run("swap paused", func(t *testing.T) {
+		testMint := createInterleaveMint(t)
+		proofs := validProofs(t, testMint, amount)
+		quoteId := meltQuote(t, testMint, amount)
+		outputs := blindedMessages(t, testMint, amount)
+
+		swap := func() error {
+			_, err := testMint.Swap(proofs, outputs)
+			return err
+		}
+
+		err1, err2 := interleave(t, mint.SyncSwapProofsVerified, swap, melt(testMint, quoteId, proofs))
+		expectOneSuccess(t, err1, err2)
+		expectSpent(t, testMint, proofs)
+	})
+}
+
+// two melt requests for the same quote with different proofs.
+// The invoice should only be paid once.
+func TestInterleaveMeltSameQuote(t *testing.T) {
+	testMint := createInterleaveMint(t)
+
+	var amount uint64 = 2100
+	proofs1 := validProofs(t, testMint, amount)
+	proofs2 := validProofs(t, testMint, amount)
+	quoteId := meltQuote(t, testMint, amount)
+
+	err1, err2 := interleave(t, mint.SyncMeltProofsVerified,
+		melt(testMint, quoteId, proofs1), melt(testMint, quoteId, proofs2))
+	expectOneSuccess(t, err1, err2)
+}
+
+// concurrent swaps of unrelated proofs. Run with and without the lock
+// on the state of the mint to measure its effect on throughput with:
+// go test -tags interleave -run ^$ -bench . ./mint
+func BenchmarkParallelSwap(b *testing.B) {
+	testMint := createInterleaveMint(b)
+
+	var amount uint64 = 64
+	proofs := make([]cashu.Proofs, b.N)
+	outputs := make([]cashu.BlindedMessages, b.N)
+	for i := 0; i < b.N; i++ {
+		proofs[i] = validProofs(b, testMint, amount)
+		outputs[i] = blindedMessages(b, testMint, amount)
+	}
+
+	var next atomic.Int64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := next.Add(1) - 1
+			if _, err := testMint.Swap(proofs[i], outputs[i]); err != nil {
+				b.Errorf("unexpected error in swap: %v", err)
+				return
+			}
+		}
+	})
+}
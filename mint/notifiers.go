@@ -0,0 +1,99 @@
+package mint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+var notifierClient = &http.Client{Timeout: 30 * time.Second}
+
+// WebhookNotifier posts the alerts as JSON to the URL
+type WebhookNotifier struct {
+	URL string
+}
+
+type webhookAlert struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	Time    int64  `json:"time"`
+}
+
+func (wn *WebhookNotifier) Notify(alert Alert) error {
+	body, err := json.Marshal(webhookAlert{
+		Kind:    alert.Kind.String(),
+		Message: alert.Message,
+		Time:    alert.Time.Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	return postNotification(wn.URL, body)
+}
+
+// TelegramNotifier sends the alerts as messages from a bot to a chat
+type TelegramNotifier struct {
+	BotToken string
+	ChatId   string
+	// defaults to https://api.telegram.org
+	APIURL string
+}
+
+func (tn *TelegramNotifier) Notify(alert Alert) error {
+	apiURL := tn.APIURL
+	if len(apiURL) == 0 {
+		apiURL = "https://api.telegram.org"
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"chat_id": tn.ChatId,
+		"text":    fmt.Sprintf("mint alert - %v: %v", alert.Kind, alert.Message),
+	})
+	if err != nil {
+		return err
+	}
+	return postNotification(apiURL+"/bot"+tn.BotToken+"/sendMessage", body)
+}
+
+func postNotification(url string, body []byte) error {
+	resp, err := notifierClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification got response with status code %v", resp.StatusCode)
+	}
+	return nil
+}
+
+// EmailNotifier sends the alerts by email through an SMTP server
+type EmailNotifier struct {
+	// address of the SMTP server in host:port format
+	SMTPAddress string
+	Username    string
+	Password    string
+	From        string
+	To          []string
+}
+
+func (en *EmailNotifier) Notify(alert Alert) error {
+	var auth smtp.Auth
+	if len(en.Username) > 0 {
+		host, _, err := net.SplitHostPort(en.SMTPAddress)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address: %v", err)
+		}
+		auth = smtp.PlainAuth("", en.Username, en.Password, host)
+	}
+
+	msg := fmt.Sprintf("From: %v\r\nTo: %v\r\nSubject: mint alert - %v\r\n\r\n%v\r\n",
+		en.From, strings.Join(en.To, ", "), alert.Kind, alert.Message)
+	return smtp.SendMail(en.SMTPAddress, auth, en.From, en.To, []byte(msg))
+}
@@ -0,0 +1,181 @@
+package mint
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testAlert = Alert{
+	Kind:    PendingMeltAlert,
+	Message: "1 melt quotes pending for more than 1h0m0s: [quote1234]",
+	Time:    time.Unix(1700000000, 0),
+}
+
+// fakeWebhook serves the requests with the status and sends their path and body
+func fakeWebhook(t *testing.T, status int) (*httptest.Server, chan [2]string) {
+	received := make(chan [2]string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected request: %v %v", r.Method, r.Header.Get("Content-Type"))
+		}
+		var body json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		received <- [2]string{r.URL.Path, string(body)}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	server, received := fakeWebhook(t, http.StatusOK)
+	notifier := &WebhookNotifier{URL: server.URL + "/alerts"}
+	if err := notifier.Notify(testAlert); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	request := <-received
+	if request[0] != "/alerts" {
+		t.Fatalf("expected request to '/alerts' but got '%v'", request[0])
+	}
+	var alert webhookAlert
+	if err := json.Unmarshal([]byte(request[1]), &alert); err != nil {
+		t.Fatalf("invalid alert in webhook: %v", err)
+	}
+	expected := webhookAlert{Kind: "melt pending too long", Message: testAlert.Message, Time: 1700000000}
+	if alert != expected {
+		t.Fatalf("expected alert %+v but got %+v", expected, alert)
+	}
+
+	server, _ = fakeWebhook(t, http.StatusInternalServerError)
+	notifier = &WebhookNotifier{URL: server.URL}
+	err := notifier.Notify(testAlert)
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Fatalf("expected error with status code but got '%v'", err)
+	}
+}
+
+func TestTelegramNotifier(t *testing.T) {
+	server, received := fakeWebhook(t, http.StatusOK)
+	notifier := &TelegramNotifier{BotToken: "123:token", ChatId: "42", APIURL: server.URL}
+	if err := notifier.Notify(testAlert); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	request := <-received
+	if request[0] != "/bot123:token/sendMessage" {
+		t.Fatalf("expected request to '/bot123:token/sendMessage' but got '%v'", request[0])
+	}
+	var message map[string]string
+	if err := json.Unmarshal([]byte(request[1]), &message); err != nil {
+		t.Fatalf("invalid message: %v", err)
+	}
+	if message["chat_id"] != "42" {
+		t.Fatalf("expected chat id '42' but got '%v'", message["chat_id"])
+	}
+	expectedText := "mint alert - melt pending too long: " + testAlert.Message
+	if message["text"] != expectedText {
+		t.Fatalf("expected text '%v' but got '%v'", expectedText, message["text"])
+	}
+
+	server, _ = fakeWebhook(t, http.StatusUnauthorized)
+	notifier = &TelegramNotifier{BotToken: "123:token", ChatId: "42", APIURL: server.URL}
+	if err := notifier.Notify(testAlert); err == nil {
+		t.Fatal("expected error from unauthorized bot")
+	}
+}
+
+// fakeSMTPServer accepts a single message without authentication and sends its data
+func fakeSMTPServer(t *testing.T) (string, chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("could not listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case command == "DATA":
+				reply("354 send message")
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 ok")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestEmailNotifier(t *testing.T) {
+	address, received := fakeSMTPServer(t)
+	notifier := &EmailNotifier{
+		SMTPAddress: address,
+		From:        "mint@example.com",
+		To:          []string{"operator@example.com", "backup@example.com"},
+	}
+	if err := notifier.Notify(testAlert); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	msg := <-received
+	expectedHeaders := []string{
+		"From: mint@example.com\r\n",
+		"To: operator@example.com, backup@example.com\r\n",
+		"Subject: mint alert - melt pending too long\r\n",
+	}
+	for _, header := range expectedHeaders {
+		if !strings.Contains(msg, header) {
+			t.Fatalf("expected '%v' in email but got '%v'", header, msg)
+		}
+	}
+	if !strings.Contains(msg, testAlert.Message) {
+		t.Fatalf("expected alert message in email but got '%v'", msg)
+	}
+
+	notifier = &EmailNotifier{SMTPAddress: "localhost", Username: "user", From: "mint@example.com"}
+	err := notifier.Notify(testAlert)
+	if err == nil || !strings.Contains(err.Error(), "invalid SMTP address") {
+		t.Fatalf("expected invalid SMTP address error but got '%v'", err)
+	}
+}
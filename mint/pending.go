@@ -0,0 +1,122 @@
+package mint
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+)
+
+// PendingReport has the funds the mint has in flight: proofs pending
+// while a melt is being paid and mint quotes that have not been issued.
+type PendingReport struct {
+	// pending proofs and their amount by unit
+	PendingProofs  int
+	PendingAmounts map[string]uint64
+	// pending proofs grouped by the melt quote they are paying
+	MeltQuotes []PendingMeltQuote
+
+	// quotes waiting for their invoice to be paid and
+	// quotes that were paid but not issued yet
+	UnpaidMintQuotes []PendingMintQuote
+	PaidMintQuotes   []PendingMintQuote
+}
+
+// PendingMeltQuote has the proofs that are pending for a melt quote
+type PendingMeltQuote struct {
+	QuoteId string
+	// state of the quote. Empty if the quote is not found
+	State  string
+	Unit   string
+	Proofs int
+	Amount uint64
+	// time the oldest of the proofs was set as pending.
+	// Zero if it was not recorded.
+	PendingSince time.Time
+}
+
+// PendingMintQuote is a mint quote that has not been issued
+type PendingMintQuote struct {
+	QuoteId string
+	Unit    string
+	Amount  uint64
+	Expiry  time.Time
+	Expired bool
+}
+
+// PendingReport builds a report of the pending proofs and mint quotes.
+// Melt quotes are sorted by how long their proofs have been pending
+// and mint quotes by expiry. Expired unpaid mint quotes are included
+// and marked as expired.
+func (m *Mint) PendingReport() (*PendingReport, error) {
+	pendingProofs, err := m.db.GetAllPendingProofs()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PendingReport{
+		PendingProofs:  len(pendingProofs),
+		PendingAmounts: make(map[string]uint64),
+	}
+	meltQuotes := make(map[string]*PendingMeltQuote)
+	keysets := m.getKeysets()
+	for _, proof := range pendingProofs {
+		unit := keysets[proof.Id].Unit
+		report.PendingAmounts[unit] += proof.Amount
+
+		quote, ok := meltQuotes[proof.MeltQuoteId]
+		if !ok {
+			quote = &PendingMeltQuote{QuoteId: proof.MeltQuoteId, Unit: unit}
+			if meltQuote, err := m.db.GetMeltQuote(proof.MeltQuoteId); err == nil {
+				quote.State = meltQuote.State.String()
+				quote.Unit = quoteUnit(meltQuote.Unit)
+			}
+			meltQuotes[proof.MeltQuoteId] = quote
+		}
+		quote.Proofs++
+		quote.Amount += proof.Amount
+		if proof.PendingSince > 0 {
+			since := time.Unix(proof.PendingSince, 0)
+			if quote.PendingSince.IsZero() || since.Before(quote.PendingSince) {
+				quote.PendingSince = since
+			}
+		}
+	}
+	for _, quote := range meltQuotes {
+		report.MeltQuotes = append(report.MeltQuotes, *quote)
+	}
+	slices.SortFunc(report.MeltQuotes, func(a, b PendingMeltQuote) int {
+		return cmp.Or(a.PendingSince.Compare(b.PendingSince), cmp.Compare(a.QuoteId, b.QuoteId))
+	})
+
+	now := time.Now()
+	for _, state := range []nut04.State{nut04.Unpaid, nut04.Paid} {
+		quotes, err := m.db.GetMintQuotesByState(state)
+		if err != nil {
+			return nil, err
+		}
+		pendingQuotes := make([]PendingMintQuote, len(quotes))
+		for i, quote := range quotes {
+			expiry := time.Unix(int64(quote.Expiry), 0)
+			pendingQuotes[i] = PendingMintQuote{
+				QuoteId: quote.Id,
+				Unit:    quoteUnit(quote.Unit),
+				Amount:  quote.Amount,
+				Expiry:  expiry,
+				// offers of bolt12 quotes do not expire
+				Expired: state == nut04.Unpaid && quote.Expiry > 0 && expiry.Before(now),
+			}
+		}
+		slices.SortFunc(pendingQuotes, func(a, b PendingMintQuote) int {
+			return a.Expiry.Compare(b.Expiry)
+		})
+		if state == nut04.Unpaid {
+			report.UnpaidMintQuotes = pendingQuotes
+		} else {
+			report.PaidMintQuotes = pendingQuotes
+		}
+	}
+
+	return report, nil
+}
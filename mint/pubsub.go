@@ -0,0 +1,225 @@
+package mint
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// topics of the notifications published by the mint. The topic
+// of a notification is the prefix followed by the id it is for.
+const (
+	// changes in the state of a proof by its Y
+	PROOF_STATE_TOPIC = "proof_state:"
+	// changes in the state of a bolt11 mint quote by its id
+	MINT_QUOTE_TOPIC = "bolt11_mint_quote:"
+	// changes in the state of a bolt11 melt quote by its id
+	MELT_QUOTE_TOPIC = "bolt11_melt_quote:"
+
+	// filter of the subscriptions to all the notifications of a kind
+	WILDCARD_FILTER = "*"
+)
+
+// unpaid mint quotes with subscribers are checked with the
+// lightning backend at this interval to notify when they are paid
+const mintQuoteCheckInterval = 2 * time.Second
+
+// pubsub delivers the notifications published to a topic to its subscribers
+type pubsub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[*subscriber]struct{}
+}
+
+// subscriber gets the payload of the notifications published to its topics.
+// notify is called while publishing so it should not block.
+type subscriber struct {
+	topics []string
+	notify func(payload []byte)
+}
+
+func newPubSub() *pubsub {
+	return &pubsub{subscribers: make(map[string]map[*subscriber]struct{})}
+}
+
+func (ps *pubsub) subscribe(topics []string, notify func(payload []byte)) *subscriber {
+	sub := &subscriber{topics: topics, notify: notify}
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, topic := range topics {
+		subscribers, ok := ps.subscribers[topic]
+		if !ok {
+			subscribers = make(map[*subscriber]struct{})
+			ps.subscribers[topic] = subscribers
+		}
+		subscribers[sub] = struct{}{}
+	}
+	return sub
+}
+
+func (ps *pubsub) unsubscribe(sub *subscriber) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, topic := range sub.topics {
+		delete(ps.subscribers[topic], sub)
+		if len(ps.subscribers[topic]) == 0 {
+			delete(ps.subscribers, topic)
+		}
+	}
+}
+
+func (ps *pubsub) publish(topic string, payload []byte) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	for sub := range ps.subscribers[topic] {
+		sub.notify(payload)
+	}
+}
+
+func (ps *pubsub) hasSubscribers(topic string) bool {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return len(ps.subscribers[topic]) > 0
+}
+
+// hasTopicSubscribers returns whether there are subscribers to the id
+// or to all the notifications of the topic prefix
+func (ps *pubsub) hasTopicSubscribers(prefix, id string) bool {
+	return ps.hasSubscribers(prefix+id) || ps.hasSubscribers(prefix+WILDCARD_FILTER)
+}
+
+// publishTopic publishes to the subscribers of the id and to the
+// subscribers to all the notifications of the topic prefix
+func (ps *pubsub) publishTopic(prefix, id string, payload []byte) {
+	ps.publish(prefix+id, payload)
+	ps.publish(prefix+WILDCARD_FILTER, payload)
+}
+
+func (ps *pubsub) empty() bool {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return len(ps.subscribers) == 0
+}
+
+// publishProofStates notifies the subscribers to the proofs of their new state
+func (m *Mint) publishProofStates(proofs cashu.Proofs, state nut07.State) {
+	// skip hashing the secrets if nobody is listening
+	if m.pubsub.empty() {
+		return
+	}
+	Ys, err := crypto.ProofsYs(proofs)
+	if err != nil {
+		return
+	}
+	for i, proof := range proofs {
+		proofState := nut07.ProofState{Y: Ys[i], State: state}
+		if state == nut07.Spent {
+			proofState.Witness = proof.Witness
+		}
+		m.publishProofState(proofState)
+	}
+}
+
+// publishYStates is publishProofStates for proofs that are only known by their Y
+func (m *Mint) publishYStates(Ys []string, state nut07.State) {
+	for _, Y := range Ys {
+		m.publishProofState(nut07.ProofState{Y: Y, State: state})
+	}
+}
+
+func (m *Mint) publishProofState(proofState nut07.ProofState) {
+	// skip encoding the state if nobody is listening
+	if !m.pubsub.hasTopicSubscribers(PROOF_STATE_TOPIC, proofState.Y) {
+		return
+	}
+	payload, err := json.Marshal(&proofState)
+	if err != nil {
+		m.logErrorf("could not encode proof state notification: %v", err)
+		return
+	}
+	m.pubsub.publishTopic(PROOF_STATE_TOPIC, proofState.Y, payload)
+}
+
+// publishMintQuote notifies the subscribers to the mint quote of its new state
+func (m *Mint) publishMintQuote(mintQuote storage.MintQuote) {
+	if !m.pubsub.hasTopicSubscribers(MINT_QUOTE_TOPIC, mintQuote.Id) {
+		return
+	}
+	payload, err := json.Marshal(mintQuoteNotification(mintQuote))
+	if err != nil {
+		m.logErrorf("could not encode mint quote notification: %v", err)
+		return
+	}
+	m.pubsub.publishTopic(MINT_QUOTE_TOPIC, mintQuote.Id, payload)
+}
+
+// mintQuoteNotification is the payload of the notifications of a mint quote,
+// which is the same as the response to checking the state of the quote
+func mintQuoteNotification(mintQuote storage.MintQuote) *nut04.PostMintQuoteBolt11Response {
+	return &nut04.PostMintQuoteBolt11Response{
+		Quote:   mintQuote.Id,
+		Request: mintQuote.PaymentRequest,
+		State:   mintQuote.State,
+		Expiry:  mintQuote.Expiry,
+	}
+}
+
+// publishMeltQuote notifies the subscribers to the melt quote of its new state
+func (m *Mint) publishMeltQuote(meltQuote storage.MeltQuote) {
+	if !m.pubsub.hasTopicSubscribers(MELT_QUOTE_TOPIC, meltQuote.Id) {
+		return
+	}
+	payload, err := json.Marshal(meltQuoteNotification(meltQuote))
+	if err != nil {
+		m.logErrorf("could not encode melt quote notification: %v", err)
+		return
+	}
+	m.pubsub.publishTopic(MELT_QUOTE_TOPIC, meltQuote.Id, payload)
+}
+
+// meltQuoteNotification is the payload of the notifications of a melt quote,
+// which is the same as the response to checking the state of the quote
+func meltQuoteNotification(meltQuote storage.MeltQuote) *nut05.PostMeltQuoteBolt11Response {
+	return &nut05.PostMeltQuoteBolt11Response{
+		Quote:      meltQuote.Id,
+		Amount:     meltQuote.Amount,
+		FeeReserve: meltQuote.FeeReserve,
+		State:      meltQuote.State,
+		Expiry:     meltQuote.Expiry,
+		Preimage:   meltQuote.Preimage,
+		Change:     meltQuote.Change,
+	}
+}
+
+// watchMintQuote checks the invoice of the unpaid mint quote with the lightning
+// backend until it is paid, the quote expires or nobody is subscribed to it anymore.
+// The subscribers are notified by GetMintQuoteState once it is paid.
+func (m *Mint) watchMintQuote(quoteId string) {
+	if _, watching := m.watchedMintQuotes.LoadOrStore(quoteId, struct{}{}); watching {
+		return
+	}
+	defer m.watchedMintQuotes.Delete(quoteId)
+
+	ticker := time.NewTicker(mintQuoteCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !m.pubsub.hasSubscribers(MINT_QUOTE_TOPIC + quoteId) {
+			return
+		}
+		mintQuote, err := m.GetMintQuoteState(quoteId)
+		if err != nil {
+			m.logDebugf("could not check state of mint quote '%v' for subscription: %v", quoteId, err)
+			return
+		}
+		if mintQuote.State != nut04.Unpaid || time.Now().Unix() > int64(mintQuote.Expiry) {
+			return
+		}
+	}
+}
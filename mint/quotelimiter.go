@@ -0,0 +1,228 @@
+package mint
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+)
+
+// max number of IPs for which a bucket is kept.
+// Buckets that are full are dropped to make room for new ones.
+const maxTrackedQuoteClients = 10000
+
+// QuoteRateLimit limits the mint quotes that can be created. Each mint quote
+// adds an invoice to the lightning node so it protects the node from clients
+// filling its invoice table.
+type QuoteRateLimit struct {
+	// PerClient is the number of mint quotes an IP can create at once.
+	// After that, it can create one more every Refill (1 minute if not set).
+	// Disabled if not set.
+	PerClient int
+	Refill    time.Duration
+	// MaxUnpaid is the max number of mint quotes that are unpaid and not
+	// expired. Only quotes created since the mint started are counted.
+	// Disabled if not set.
+	MaxUnpaid int
+}
+
+// QuoteLimiterStats has the number of mint quote requests rejected
+// by the QuoteRateLimit and the unpaid quotes being counted.
+type QuoteLimiterStats struct {
+	Throttled uint64
+	// requests over the limit by client IP
+	ThrottledByIP map[string]uint64
+	// requests rejected because there were too many unpaid quotes
+	UnpaidRejected uint64
+	Unpaid         int
+}
+
+// quoteLimitErr is returned when a mint quote is not allowed.
+// The detail has the limit and when to retry.
+type quoteLimitErr struct {
+	err        *cashu.Error
+	retryAfter time.Duration
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type quoteLimiter struct {
+	logger *slog.Logger
+
+	mu      sync.Mutex
+	limit   QuoteRateLimit
+	buckets map[string]*tokenBucket
+	// expiry of unpaid quotes by id and the number of
+	// quotes allowed that are still being created
+	unpaid   map[string]time.Time
+	reserved int
+
+	throttled      uint64
+	throttledByIP  map[string]uint64
+	unpaidRejected uint64
+}
+
+func newQuoteLimiter(limit QuoteRateLimit, logger *slog.Logger) *quoteLimiter {
+	return &quoteLimiter{
+		logger:        logger,
+		limit:         limit.withDefaults(),
+		buckets:       make(map[string]*tokenBucket),
+		unpaid:        make(map[string]time.Time),
+		throttledByIP: make(map[string]uint64),
+	}
+}
+
+func (limit QuoteRateLimit) withDefaults() QuoteRateLimit {
+	if limit.PerClient > 0 && limit.Refill <= 0 {
+		limit.Refill = time.Minute
+	}
+	return limit
+}
+
+// setLimit changes the limit while running
+func (l *quoteLimiter) setLimit(limit QuoteRateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limit = limit.withDefaults()
+	l.buckets = make(map[string]*tokenBucket)
+}
+
+// allow checks whether the IP can create a mint quote. If it is allowed, a slot
+// for an unpaid quote is reserved and done has to be called after creating it.
+func (l *quoteLimiter) allow(ip net.IP) *quoteLimitErr {
+	ipStr := ip.String()
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var bucket *tokenBucket
+	if l.limit.PerClient > 0 {
+		bucket = l.bucket(ipStr, now)
+		if bucket != nil && bucket.tokens < 1 {
+			l.throttled++
+			increment(l.throttledByIP, ipStr)
+			l.logger.Warn("throttling mint quotes from IP", slog.String("ip", ipStr))
+
+			retryAfter := time.Duration((1 - bucket.tokens) * float64(l.limit.Refill))
+			msg := fmt.Sprintf("too many mint quotes: limit is %v every %v. Retry after %v",
+				l.limit.PerClient, l.limit.Refill, retryAfter.Round(time.Second))
+			return &quoteLimitErr{cashu.BuildCashuError(msg, cashu.StandardErrCode), retryAfter}
+		}
+	}
+
+	if l.limit.MaxUnpaid > 0 {
+		earliest := l.removeExpired(now)
+		if len(l.unpaid)+l.reserved >= l.limit.MaxUnpaid {
+			l.unpaidRejected++
+			l.logger.Warn("rejecting mint quote: max unpaid quotes reached",
+				slog.Int("max_unpaid", l.limit.MaxUnpaid))
+
+			retryAfter := time.Minute
+			if !earliest.IsZero() {
+				retryAfter = earliest.Sub(now)
+			}
+			msg := fmt.Sprintf("too many unpaid mint quotes: limit is %v. Retry after %v",
+				l.limit.MaxUnpaid, retryAfter.Round(time.Second))
+			return &quoteLimitErr{cashu.BuildCashuError(msg, cashu.StandardErrCode), retryAfter}
+		}
+	}
+
+	if bucket != nil {
+		bucket.tokens--
+	}
+	l.reserved++
+	return nil
+}
+
+// bucket returns the bucket for the IP refilled up to now.
+// It returns nil if there are too many IPs to track another one.
+func (l *quoteLimiter) bucket(ip string, now time.Time) *tokenBucket {
+	capacity := float64(l.limit.PerClient)
+	bucket, ok := l.buckets[ip]
+	if !ok {
+		if len(l.buckets) >= maxTrackedQuoteClients {
+			l.removeFullBuckets(now)
+			if len(l.buckets) >= maxTrackedQuoteClients {
+				return nil
+			}
+		}
+		bucket = &tokenBucket{tokens: capacity, last: now}
+		l.buckets[ip] = bucket
+		return bucket
+	}
+
+	refilled := float64(now.Sub(bucket.last)) / float64(l.limit.Refill)
+	bucket.tokens = math.Min(capacity, bucket.tokens+refilled)
+	bucket.last = now
+	return bucket
+}
+
+func (l *quoteLimiter) removeFullBuckets(now time.Time) {
+	capacity := float64(l.limit.PerClient)
+	for ip, bucket := range l.buckets {
+		if bucket.tokens+float64(now.Sub(bucket.last))/float64(l.limit.Refill) >= capacity {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// removeExpired removes the unpaid quotes that expired
+// and returns the earliest expiry of the rest
+func (l *quoteLimiter) removeExpired(now time.Time) time.Time {
+	var earliest time.Time
+	for id, expiry := range l.unpaid {
+		if !expiry.After(now) {
+			delete(l.unpaid, id)
+		} else if earliest.IsZero() || expiry.Before(earliest) {
+			earliest = expiry
+		}
+	}
+	return earliest
+}
+
+// done releases the slot reserved by allow and counts the quote
+// as unpaid until it expires or is paid if it was created
+func (l *quoteLimiter) done(quoteId string, expiry uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reserved--
+	if len(quoteId) > 0 && l.limit.MaxUnpaid > 0 {
+		expiresAt := time.Unix(int64(expiry), 0)
+		if expiry == 0 {
+			expiresAt = time.Now().Add(time.Hour)
+		}
+		l.unpaid[quoteId] = expiresAt
+	}
+}
+
+// paid stops counting the quote as unpaid
+func (l *quoteLimiter) paid(quoteId string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.unpaid, quoteId)
+}
+
+func (l *quoteLimiter) stats() QuoteLimiterStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.removeExpired(time.Now())
+
+	stats := QuoteLimiterStats{
+		Throttled:      l.throttled,
+		ThrottledByIP:  make(map[string]uint64, len(l.throttledByIP)),
+		UnpaidRejected: l.unpaidRejected,
+		Unpaid:         len(l.unpaid),
+	}
+	for ip, count := range l.throttledByIP {
+		stats.ThrottledByIP[ip] = count
+	}
+	return stats
+}
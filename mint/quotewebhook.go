@@ -0,0 +1,100 @@
+package mint
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// QuoteWebhookSignatureHeader has the hex HMAC-SHA256 of the body
+// with the webhook secret if one is set
+const QuoteWebhookSignatureHeader = "X-Gonuts-Signature"
+
+// max attempts to post a quote to the webhook
+const quoteWebhookAttempts = 3
+
+// QuoteWebhook is called when a mint quote is created so external
+// systems can monitor or pay the invoices (i.e a custodial bridge
+// funding the mint quotes of its users).
+type QuoteWebhook struct {
+	URL string
+	// if set, requests are signed with it so the receiver can check they come from the mint
+	Secret string
+}
+
+// MintQuoteCreated is the body posted to the quote webhook
+type MintQuoteCreated struct {
+	Quote       string `json:"quote"`
+	Amount      uint64 `json:"amount"`
+	Unit        string `json:"unit"`
+	Request     string `json:"request"`
+	PaymentHash string `json:"payment_hash"`
+	Expiry      uint64 `json:"expiry"`
+}
+
+// notifyMintQuoteCreated posts the quote to the webhook. It is retried
+// a few times if it fails and errors are only logged since the quote
+// is already created.
+func (m *Mint) notifyMintQuoteCreated(quote storage.MintQuote) {
+	body, err := json.Marshal(MintQuoteCreated{
+		Quote:       quote.Id,
+		Amount:      quote.Amount,
+		Unit:        quoteUnit(quote.Unit),
+		Request:     quote.PaymentRequest,
+		PaymentHash: quote.PaymentHash,
+		Expiry:      quote.Expiry,
+	})
+	if err != nil {
+		m.logErrorf("could not encode mint quote '%v' for webhook: %v", quote.Id, err)
+		return
+	}
+
+	for attempt := 1; attempt <= quoteWebhookAttempts; attempt++ {
+		err = m.quoteWebhook.post(body)
+		if err == nil {
+			m.logDebugf("posted mint quote '%v' to webhook", quote.Id)
+			return
+		}
+		if attempt < quoteWebhookAttempts {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+	m.logErrorf("could not post mint quote '%v' to webhook: %v", quote.Id, err)
+}
+
+func (qw *QuoteWebhook) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, qw.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(qw.Secret) > 0 {
+		req.Header.Set(QuoteWebhookSignatureHeader, SignQuoteWebhook(body, qw.Secret))
+	}
+
+	resp, err := notifierClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook got response with status code %v", resp.StatusCode)
+	}
+	return nil
+}
+
+// SignQuoteWebhook returns the signature of the body with the secret that
+// is sent in the QuoteWebhookSignatureHeader. Receivers can use it to check it.
+func SignQuoteWebhook(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
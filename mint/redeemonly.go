@@ -0,0 +1,31 @@
+package mint
+
+// DefaultRedeemOnlyMotd is the motd advertised while the mint
+// is in redeem-only mode if the mint does not have one set.
+const DefaultRedeemOnlyMotd = "This mint is winding down. Minting is disabled but ecash can still be swapped and melted."
+
+// SetRedeemOnly toggles the redeem-only mode used to wind down the mint.
+// While enabled, new mint quotes are rejected and minting is advertised as
+// disabled (NUT-04) with a motd. Swaps, melts and mint quotes that were
+// already paid continue to work so users can move their funds out.
+func (m *Mint) SetRedeemOnly(redeemOnly bool) {
+	m.settingsMu.Lock()
+	changed := m.redeemOnly != redeemOnly
+	m.redeemOnly = redeemOnly
+	m.settingsMu.Unlock()
+
+	if changed {
+		if redeemOnly {
+			m.logInfof("mint is now redeem-only. New mint quotes will be rejected")
+		} else {
+			m.logInfof("mint is no longer redeem-only")
+		}
+	}
+}
+
+// RedeemOnly reports whether the mint is winding down and not issuing new ecash.
+func (m *Mint) RedeemOnly() bool {
+	m.settingsMu.RLock()
+	defer m.settingsMu.RUnlock()
+	return m.redeemOnly
+}
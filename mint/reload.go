@@ -0,0 +1,169 @@
+package mint
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// ConfigView is the running config of the mint without secrets such as
+// the credentials for the lightning backend or the alert notifiers.
+type ConfigView struct {
+	DerivationPathIdx uint32            `json:"derivation_path_idx"`
+	ListenAddress     string            `json:"listen_address"`
+	Port              int               `json:"port"`
+	AdminPort         int               `json:"admin_port"`
+	BasePath          string            `json:"base_path"`
+	TLS               bool              `json:"tls"`
+	InputFeePpk       uint              `json:"input_fee_ppk"`
+	Name              string            `json:"name"`
+	Motd              string            `json:"motd"`
+	Limits            MintLimits        `json:"limits"`
+	EnableMPP         bool              `json:"enable_mpp"`
+	EnableAMP         bool              `json:"enable_amp"`
+	EnableBOLT12      bool              `json:"enable_bolt12"`
+	LogLevel          string            `json:"log_level"`
+	AllowList         []string          `json:"ip_allow_list"`
+	DenyList          []string          `json:"ip_deny_list"`
+	TrustedProxies    []string          `json:"trusted_proxies"`
+	DoubleSpends      DoubleSpendPolicy `json:"double_spends"`
+	QuoteRateLimit    QuoteRateLimit    `json:"quote_rate_limit"`
+	// kinds of the notifiers for alerts (i.e webhook, telegram)
+	AlertNotifiers  []string `json:"alert_notifiers"`
+	MaxRequestSize  int64    `json:"max_request_size"`
+	MaxRequestItems int      `json:"max_request_items"`
+	// whether mint quotes are posted to a webhook
+	QuoteWebhook bool `json:"quote_webhook"`
+	RedeemOnly   bool `json:"redeem_only"`
+}
+
+// runningConfig is the config the server was set up with
+// and the updates from reloads
+type runningConfig struct {
+	mu     sync.Mutex
+	config Config
+}
+
+// ConfigView returns the config the mint is running with.
+func (ms *MintServer) ConfigView() ConfigView {
+	ms.running.mu.Lock()
+	config := ms.running.config
+	ms.running.mu.Unlock()
+
+	notifiers := make([]string, len(config.Alerts.Notifiers))
+	for i, notifier := range config.Alerts.Notifiers {
+		notifiers[i] = notifierKind(notifier)
+	}
+	maxRequestSize, maxRequestItems := config.requestLimits()
+
+	return ConfigView{
+		DerivationPathIdx: config.DerivationPathIdx,
+		ListenAddress:     config.ListenAddress,
+		Port:              config.Port,
+		AdminPort:         config.AdminPort,
+		BasePath:          config.BasePath,
+		TLS:               len(config.TLSCertFile) > 0,
+		InputFeePpk:       config.InputFeePpk,
+		Name:              config.MintInfo.Name,
+		Motd:              config.MintInfo.Motd,
+		Limits:            config.Limits,
+		EnableMPP:         config.EnableMPP,
+		EnableAMP:         config.EnableAMP,
+		EnableBOLT12:      config.EnableBOLT12,
+		LogLevel:          config.LogLevel.String(),
+		AllowList:         config.IPPolicy.AllowList,
+		DenyList:          config.IPPolicy.DenyList,
+		TrustedProxies:    config.IPPolicy.TrustedProxies,
+		DoubleSpends:      config.DoubleSpends,
+		QuoteRateLimit:    config.QuoteRateLimit,
+		AlertNotifiers:    notifiers,
+		MaxRequestSize:    maxRequestSize,
+		MaxRequestItems:   maxRequestItems,
+		QuoteWebhook:      len(config.QuoteWebhook.URL) > 0,
+		RedeemOnly:        config.RedeemOnly,
+	}
+}
+
+func notifierKind(notifier Notifier) string {
+	switch notifier.(type) {
+	case *WebhookNotifier:
+		return "webhook"
+	case *TelegramNotifier:
+		return "telegram"
+	case *EmailNotifier:
+		return "email"
+	default:
+		return fmt.Sprintf("%T", notifier)
+	}
+}
+
+// ReloadConfig applies the settings that can be changed while the mint is running
+// from the config: the limits, log level, motd, redeem-only mode, double spend policy
+// and mint quote rate limit. Changes to other settings are ignored and need a restart.
+// It returns the changes applied.
+func (ms *MintServer) ReloadConfig(config Config) ([]string, error) {
+	ms.running.mu.Lock()
+	defer ms.running.mu.Unlock()
+	current := ms.running.config
+
+	// output is discarded if logging is disabled so it can't be toggled
+	if config.LogLevel != current.LogLevel && (config.LogLevel == Disable || current.LogLevel == Disable) {
+		return nil, errors.New("log level cannot be changed to or from disabled while running")
+	}
+
+	var changes []string
+	if config.Limits != current.Limits {
+		changes = append(changes, fmt.Sprintf("limits: %+v -> %+v", current.Limits, config.Limits))
+		ms.mint.settingsMu.Lock()
+		ms.mint.limits = config.Limits
+		ms.mint.settingsMu.Unlock()
+		current.Limits = config.Limits
+	}
+	if config.MintInfo.Motd != current.MintInfo.Motd {
+		changes = append(changes, fmt.Sprintf("motd: '%v' -> '%v'", current.MintInfo.Motd, config.MintInfo.Motd))
+		current.MintInfo.Motd = config.MintInfo.Motd
+	}
+	if len(changes) > 0 {
+		// info has the limits and the motd
+		ms.mint.SetMintInfo(current.MintInfo)
+	}
+	if config.RedeemOnly != current.RedeemOnly {
+		changes = append(changes, fmt.Sprintf("redeem only: %v -> %v", current.RedeemOnly, config.RedeemOnly))
+		ms.mint.SetRedeemOnly(config.RedeemOnly)
+		current.RedeemOnly = config.RedeemOnly
+	}
+	if config.LogLevel != current.LogLevel {
+		changes = append(changes, fmt.Sprintf("log level: %v -> %v", current.LogLevel, config.LogLevel))
+		level := slog.LevelInfo
+		if config.LogLevel == Debug {
+			level = slog.LevelDebug
+		}
+		ms.mint.logLevel.Set(level)
+		current.LogLevel = config.LogLevel
+	}
+	if config.DoubleSpends != current.DoubleSpends {
+		changes = append(changes, fmt.Sprintf("double spend policy: %+v -> %+v",
+			current.DoubleSpends, config.DoubleSpends))
+		ms.doubleSpends.setPolicy(config.DoubleSpends)
+		current.DoubleSpends = config.DoubleSpends
+	}
+	if config.QuoteRateLimit != current.QuoteRateLimit {
+		changes = append(changes, fmt.Sprintf("mint quote rate limit: %+v -> %+v",
+			current.QuoteRateLimit, config.QuoteRateLimit))
+		ms.quoteLimiter.setLimit(config.QuoteRateLimit)
+		current.QuoteRateLimit = config.QuoteRateLimit
+	}
+	ms.running.config = current
+
+	for _, change := range changes {
+		ms.mint.logInfof("reloaded config %v", change)
+	}
+	return changes, nil
+}
+
+func (m *Mint) currentLimits() MintLimits {
+	m.settingsMu.RLock()
+	defer m.settingsMu.RUnlock()
+	return m.limits
+}
@@ -0,0 +1,147 @@
+package mint
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+)
+
+// RequestIdHeader is the response header with the id
+// of the request that is also in the mint logs for it
+const RequestIdHeader = "X-Request-Id"
+
+// max bytes of an error response body kept to log its error code
+const maxLoggedErrBody = 1024
+
+type requestAttrsKey struct{}
+
+// withRequestAttrs returns a context with the attributes that
+// are added to the logs of the request made with it
+func withRequestAttrs(ctx context.Context, attrs ...slog.Attr) context.Context {
+	return context.WithValue(ctx, requestAttrsKey{}, attrs)
+}
+
+// requestLogHandler adds the attributes of the request in
+// the context to the records so that the logs of the mint
+// for a request can be correlated by its id
+type requestLogHandler struct {
+	slog.Handler
+}
+
+func (h requestLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if attrs, ok := ctx.Value(requestAttrsKey{}).([]slog.Attr); ok {
+		r.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h requestLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestLogHandler) WithGroup(name string) slog.Handler {
+	return requestLogHandler{h.Handler.WithGroup(name)}
+}
+
+// clientFingerprinter hashes client IPs with a random key generated on
+// start so that requests from the same client can be correlated in the
+// logs without storing the IP. Fingerprints change when the mint restarts.
+type clientFingerprinter struct {
+	key []byte
+}
+
+func newClientFingerprinter() (*clientFingerprinter, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &clientFingerprinter{key: key}, nil
+}
+
+func (f *clientFingerprinter) fingerprint(ip net.IP) string {
+	mac := hmac.New(sha256.New, f.key)
+	mac.Write(ip)
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// responseRecorder keeps the status code and the
+// start of the body of error responses to log them
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	errBody bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status >= http.StatusBadRequest {
+		rec.errBody.Write(b[:min(len(b), maxLoggedErrBody-rec.errBody.Len())])
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Hijack lets websocket connections take over the connection
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking the connection")
+	}
+	rec.status = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+// requestLogger sets an id to each request and logs its method, path,
+// status, duration and the cashu error code if the request failed.
+// Logs from the mint while handling the request include the request id
+// and the client fingerprint if enabled.
+func (ms *MintServer) requestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		idBytes := make([]byte, 8)
+		rand.Read(idBytes)
+		requestId := hex.EncodeToString(idBytes)
+
+		attrs := []slog.Attr{slog.String("request_id", requestId)}
+		if ms.fingerprints != nil {
+			attrs = append(attrs, slog.String("client", ms.fingerprints.fingerprint(ms.ipFilter.clientIP(req))))
+		}
+		ctx := withRequestAttrs(req.Context(), attrs...)
+
+		rw.Header().Set(RequestIdHeader, requestId)
+		rec := &responseRecorder{ResponseWriter: rw, status: http.StatusOK}
+		next.ServeHTTP(rec, req.WithContext(ctx))
+
+		var pcs [1]uintptr
+		runtime.Callers(1, pcs[:])
+		r := slog.NewRecord(time.Now(), slog.LevelInfo, "handled request", pcs[0])
+		r.AddAttrs(
+			slog.Group("request",
+				slog.String("method", req.Method),
+				slog.String("path", req.URL.Path)),
+			slog.Int("status", rec.status),
+			slog.Duration("duration", time.Since(start)),
+		)
+		var cashuErr cashu.Error
+		if rec.errBody.Len() > 0 && json.Unmarshal(rec.errBody.Bytes(), &cashuErr) == nil && cashuErr.Code > 0 {
+			r.AddAttrs(slog.Int("error_code", int(cashuErr.Code)))
+		}
+		_ = ms.mint.logger.Handler().Handle(ctx, r)
+	})
+}
@@ -2,12 +2,16 @@ package mint
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
 	"runtime"
 	"strconv"
 	"strings"
@@ -21,20 +25,77 @@ import (
 	"github.com/elnosh/gonuts/cashu/nuts/nut05"
 	"github.com/elnosh/gonuts/cashu/nuts/nut07"
 	"github.com/elnosh/gonuts/cashu/nuts/nut09"
+	"github.com/elnosh/gonuts/cashu/nuts/nut25"
 	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/storage"
 	"github.com/gorilla/mux"
 )
 
+// DefaultMaxRequestSize is the default max size in bytes of a request body
+const DefaultMaxRequestSize = 16 << 20
+
 type MintServer struct {
 	httpServer *http.Server
 	mint       *Mint
+	ipFilter   *ipFilter
+	cors       *corsHandler
+	alerts     *alertMonitor
+	// attempts to spend proofs that were already spent
+	doubleSpends *doubleSpendMonitor
+	// limits the creation of mint quotes
+	quoteLimiter *quoteLimiter
+	// hashes client IPs for the request logs. nil if disabled
+	fingerprints *clientFingerprinter
+
+	tlsCertFile string
+	tlsKeyFile  string
+	// redirects HTTP requests to HTTPS if TLS is enabled
+	redirectServer *http.Server
+	// serves the config and metrics to operators if the AdminPort is set
+	adminServer *http.Server
+	adminFilter *ipFilter
+
+	maxRequestSize  int64
+	maxRequestItems int
+	// token to open wildcard websocket subscriptions. Empty if disabled
+	wsAdminToken string
 	// NOTE: using this value for testing
 	meltTimeout *time.Duration
+
+	running runningConfig
 }
 
 func (ms *MintServer) Start() error {
+	if ms.alerts != nil {
+		ms.alerts.start()
+	}
+	if ms.redirectServer != nil {
+		go func() {
+			ms.mint.logger.Info("redirecting HTTP requests to HTTPS from: " + ms.redirectServer.Addr)
+			err := ms.redirectServer.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				ms.mint.logErrorf("error running HTTP redirect server: %v", err)
+			}
+		}()
+	}
+
+	if ms.adminServer != nil {
+		go func() {
+			ms.mint.logger.Info("admin server listening on: " + ms.adminServer.Addr)
+			err := ms.adminServer.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				ms.mint.logErrorf("error running admin server: %v", err)
+			}
+		}()
+	}
+
 	ms.mint.logger.Info("mint server listening on: " + ms.httpServer.Addr)
-	err := ms.httpServer.ListenAndServe()
+	var err error
+	if len(ms.tlsCertFile) > 0 {
+		err = ms.httpServer.ListenAndServeTLS(ms.tlsCertFile, ms.tlsKeyFile)
+	} else {
+		err = ms.httpServer.ListenAndServe()
+	}
 	if err != nil && err != http.ErrServerClosed {
 		return err
 	} else if err == http.ErrServerClosed {
@@ -44,65 +105,195 @@ func (ms *MintServer) Start() error {
 }
 
 func SetupMintServer(config Config) (*MintServer, error) {
+	if (len(config.TLSCertFile) > 0) != (len(config.TLSKeyFile) > 0) {
+		return nil, errors.New("both TLS cert and key files need to be set to enable TLS")
+	}
+	if len(config.TLSCertFile) > 0 {
+		if _, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile); err != nil {
+			return nil, fmt.Errorf("invalid TLS cert or key: %v", err)
+		}
+	} else if config.HTTPRedirectPort > 0 {
+		return nil, errors.New("redirect to HTTPS needs TLS cert and key files")
+	}
+
 	mint, err := LoadMint(config)
 	if err != nil {
 		return nil, err
 	}
 
-	mintServer := &MintServer{mint: mint, meltTimeout: config.MeltTimeout}
-	err = mintServer.setupHttpServer(config.Port)
+	ipFilter, err := newIPFilter(config.IPPolicy, mint.logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP policy: %v", err)
+	}
+
+	cors, err := newCORSHandler(config.CORS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CORS policy: %v", err)
+	}
+
+	var fingerprints *clientFingerprinter
+	if config.LogClientFingerprint {
+		fingerprints, err = newClientFingerprinter()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	maxRequestSize, maxRequestItems := config.requestLimits()
+	mintServer := &MintServer{
+		mint:            mint,
+		ipFilter:        ipFilter,
+		cors:            cors,
+		alerts:          newAlertMonitor(config.Alerts, mint),
+		doubleSpends:    newDoubleSpendMonitor(config.DoubleSpends, mint.logger),
+		quoteLimiter:    newQuoteLimiter(config.QuoteRateLimit, mint.logger),
+		fingerprints:    fingerprints,
+		tlsCertFile:     config.TLSCertFile,
+		tlsKeyFile:      config.TLSKeyFile,
+		maxRequestSize:  maxRequestSize,
+		maxRequestItems: maxRequestItems,
+		wsAdminToken:    config.WebsocketAdminToken,
+		meltTimeout:     config.MeltTimeout,
+		running:         runningConfig{config: config},
+	}
+	err = mintServer.setupHttpServer(config)
 	if err != nil {
 		return nil, err
 	}
+	if config.AdminPort > 0 {
+		if err := mintServer.setupAdminServer(config); err != nil {
+			return nil, err
+		}
+	}
 	return mintServer, nil
 }
 
 func (ms *MintServer) Shutdown() {
 	ms.mint.logger.Info("starting shutdown")
+	if ms.alerts != nil {
+		ms.alerts.shutdown()
+	}
 	ms.mint.db.Close()
+	if ms.redirectServer != nil {
+		ms.redirectServer.Shutdown(context.Background())
+	}
+	if ms.adminServer != nil {
+		ms.adminServer.Shutdown(context.Background())
+	}
 	ms.httpServer.Shutdown(context.Background())
 }
 
-func (ms *MintServer) setupHttpServer(port int) error {
+func (ms *MintServer) setupHttpServer(config Config) error {
 	r := mux.NewRouter()
 
-	r.HandleFunc("/v1/keys", ms.getActiveKeysets).Methods(http.MethodGet, http.MethodOptions)
-	r.HandleFunc("/v1/keysets", ms.getKeysetsList).Methods(http.MethodGet, http.MethodOptions)
-	r.HandleFunc("/v1/keys/{id}", ms.getKeysetById).Methods(http.MethodGet, http.MethodOptions)
-	r.HandleFunc("/v1/mint/quote/{method}", ms.mintRequest).Methods(http.MethodGet, http.MethodPost, http.MethodOptions)
-	r.HandleFunc("/v1/mint/quote/{method}/{quote_id}", ms.mintQuoteState).Methods(http.MethodGet, http.MethodPost, http.MethodOptions)
-	r.HandleFunc("/v1/mint/{method}", ms.mintTokensRequest).Methods(http.MethodPost, http.MethodOptions)
-	r.HandleFunc("/v1/swap", ms.swapRequest).Methods(http.MethodPost, http.MethodOptions)
-	r.HandleFunc("/v1/melt/quote/{method}", ms.meltQuoteRequest).Methods(http.MethodPost, http.MethodOptions)
-	r.HandleFunc("/v1/melt/quote/{method}/{quote_id}", ms.meltQuoteState).Methods(http.MethodGet, http.MethodOptions)
-	r.HandleFunc("/v1/melt/{method}", ms.meltTokens).Methods(http.MethodPost, http.MethodOptions)
-	r.HandleFunc("/v1/checkstate", ms.tokenStateCheck).Methods(http.MethodPost, http.MethodOptions)
-	r.HandleFunc("/v1/restore", ms.restoreSignatures).Methods(http.MethodPost, http.MethodOptions)
-	r.HandleFunc("/v1/info", ms.mintInfo).Methods(http.MethodGet, http.MethodOptions)
+	// routes are added to a subrouter if there is a path prefix
+	api := r
+	basePath := strings.Trim(config.BasePath, "/")
+	if len(basePath) > 0 {
+		api = r.PathPrefix("/" + basePath).Subrouter()
+	}
 
+	api.HandleFunc("/v1/keys", ms.getActiveKeysets).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/v1/keysets", ms.getKeysetsList).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/v1/keys/{id}", ms.getKeysetById).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/v1/mint/quote/{method}", ms.mintRequest).Methods(http.MethodGet, http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/v1/mint/quote/{method}/{quote_id}", ms.mintQuoteState).Methods(http.MethodGet, http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/v1/mint/quote/{method}/hash/{payment_hash}", ms.mintQuoteByPaymentHash).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/v1/mint/{method}", ms.mintTokensRequest).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/v1/swap", ms.swapRequest).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/v1/melt/quote/{method}", ms.meltQuoteRequest).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/v1/melt/quote/{method}/{quote_id}", ms.meltQuoteState).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/v1/melt/quote/{method}/hash/{payment_hash}", ms.meltQuoteByPaymentHash).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/v1/melt/quote/{method}/{quote_id}/requote", ms.meltRequote).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/v1/melt/{method}", ms.meltTokens).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/v1/checkstate", ms.tokenStateCheck).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/v1/restore", ms.restoreSignatures).Methods(http.MethodPost, http.MethodOptions)
+	api.HandleFunc("/v1/info", ms.mintInfo).Methods(http.MethodGet, http.MethodOptions)
+	api.HandleFunc("/v1/ws", ms.websocketHandler).Methods(http.MethodGet)
+	if config.PublishKeyEpochs {
+		api.HandleFunc("/v1/audit/keyepoch", ms.keyEpoch).Methods(http.MethodGet, http.MethodOptions)
+	}
+
+	// first so that requests rejected by the other middlewares are also logged
+	r.Use(ms.requestLogger)
+	// before the filters so that browsers can read the errors of rejected requests
+	r.Use(ms.cors.middleware)
+	if ms.ipFilter != nil && ms.ipFilter.enabled() {
+		r.Use(ms.ipFilter.middleware)
+	}
+	// added even if throttling is disabled since the policy can be reloaded
+	if ms.doubleSpends != nil {
+		r.Use(ms.doubleSpends.middleware(ms.ipFilter.clientIP))
+	}
 	r.Use(setupHeaders)
 
 	server := &http.Server{
-		Addr:    ":" + strconv.Itoa(port),
+		Addr:    net.JoinHostPort(config.ListenAddress, strconv.Itoa(config.Port)),
 		Handler: r,
 	}
-
 	ms.httpServer = server
+
+	if len(ms.tlsCertFile) > 0 && config.HTTPRedirectPort > 0 {
+		ms.redirectServer = &http.Server{
+			Addr:    net.JoinHostPort(config.ListenAddress, strconv.Itoa(config.HTTPRedirectPort)),
+			Handler: httpsRedirect(config.Port),
+		}
+	}
 	return nil
 }
 
-func setupHeaders(next http.Handler) http.Handler {
+// httpsRedirect redirects requests to the same host and path over HTTPS
+func httpsRedirect(httpsPort int) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		rw.Header().Set("Content-Type", "application/json")
-		rw.Header().Set("Access-Control-Allow-Origin", "*")
-		rw.Header().Set("Access-Control-Allow-Credentials", "true")
-		rw.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		rw.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, origin")
-
-		if req.Method == http.MethodOptions {
-			return
+		host, _, err := net.SplitHostPort(req.Host)
+		if err != nil {
+			// no port in host
+			host = req.Host
 		}
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		}
+		target := url.URL{Scheme: "https", Host: host, Path: req.URL.Path, RawQuery: req.URL.RawQuery}
+		http.Redirect(rw, req, target.String(), http.StatusPermanentRedirect)
+	})
+}
+
+// BlockedRequests returns the number of requests
+// rejected by the IP policy grouped by reason.
+func (ms *MintServer) BlockedRequests() map[string]uint64 {
+	if ms.ipFilter == nil {
+		return map[string]uint64{}
+	}
+	return ms.ipFilter.blockedRequests()
+}
+
+// DoubleSpendAttempts returns the number of requests with proofs
+// that were already spent and the IPs currently throttled for it.
+func (ms *MintServer) DoubleSpendAttempts() DoubleSpendAttempts {
+	if ms.doubleSpends == nil {
+		return DoubleSpendAttempts{}
+	}
+	return ms.doubleSpends.attempts()
+}
+
+// MintQuoteLimits returns the number of mint quote requests rejected
+// by the QuoteRateLimit and the unpaid quotes being counted.
+func (ms *MintServer) MintQuoteLimits() QuoteLimiterStats {
+	return ms.quoteLimiter.stats()
+}
+
+// recordDoubleSpend counts the request if it was rejected
+// because the inputs were already spent
+func (ms *MintServer) recordDoubleSpend(req *http.Request, inputs cashu.Proofs, err error) {
+	if ms.doubleSpends == nil || !errors.Is(err, cashu.ProofAlreadyUsedErr) {
+		return
+	}
+	ms.doubleSpends.record(ms.ipFilter.clientIP(req), inputs)
+}
 
+func setupHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
 		next.ServeHTTP(rw, req)
 	})
 }
@@ -123,13 +314,28 @@ func (ms *MintServer) logRequest(req *http.Request, statusCode int, format strin
 	if statusCode >= 100 {
 		r.Add(slog.Int("code", statusCode))
 	}
-	_ = ms.mint.logger.Handler().Handle(context.Background(), r)
+	_ = ms.mint.logger.Handler().Handle(req.Context(), r)
+}
+
+// writeThrottled rejects a request over the limits
+// and tells the client when it can retry
+func (ms *MintServer) writeThrottled(rw http.ResponseWriter, req *http.Request, err *quoteLimitErr) {
+	retryAfter := int(math.Ceil(err.retryAfter.Seconds()))
+	rw.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	ms.logRequest(req, http.StatusTooManyRequests, err.err.Error())
+
+	rw.WriteHeader(http.StatusTooManyRequests)
+	errRes, _ := json.Marshal(err.err)
+	rw.Write(errRes)
 }
 
 // errResponse is the error that will be written in the response
 // errLogMsg is the error to log
 func (ms *MintServer) writeErr(rw http.ResponseWriter, req *http.Request, errResponse error, errLogMsg ...string) {
 	code := http.StatusBadRequest
+	if ms.alerts != nil {
+		ms.alerts.recordError(errResponse)
+	}
 
 	log := errResponse.Error()
 	// if errLogMsg passed, then log msg different than err response
@@ -145,7 +351,7 @@ func (ms *MintServer) writeErr(rw http.ResponseWriter, req *http.Request, errRes
 		slog.String("url", req.URL.String())),
 		slog.Int("code", code),
 	)
-	_ = ms.mint.logger.Handler().Handle(context.Background(), r)
+	_ = ms.mint.logger.Handler().Handle(req.Context(), r)
 
 	rw.WriteHeader(code)
 	errRes, _ := json.Marshal(errResponse)
@@ -153,7 +359,7 @@ func (ms *MintServer) writeErr(rw http.ResponseWriter, req *http.Request, errRes
 }
 
 func (ms *MintServer) getActiveKeysets(rw http.ResponseWriter, req *http.Request) {
-	getKeysResponse := buildKeysResponse(ms.mint.activeKeysets)
+	getKeysResponse := buildKeysResponse(ms.mint.getActiveKeysets())
 	jsonRes, err := json.Marshal(getKeysResponse)
 	if err != nil {
 		ms.writeErr(rw, req, cashu.StandardErr)
@@ -174,11 +380,32 @@ func (ms *MintServer) getKeysetsList(rw http.ResponseWriter, req *http.Request)
 	rw.Write(jsonRes)
 }
 
+func (ms *MintServer) keyEpoch(rw http.ResponseWriter, req *http.Request) {
+	keyEpoch, err := ms.mint.KeyEpoch()
+	if err != nil {
+		ms.mint.logErrorf("could not build key epoch: %v", err)
+		ms.writeErr(rw, req, cashu.StandardErr)
+		return
+	}
+	jsonRes, err := json.Marshal(keyEpoch)
+	if err != nil {
+		ms.writeErr(rw, req, cashu.StandardErr)
+		return
+	}
+	ms.logRequest(req, http.StatusOK, "returning key epoch at %v", keyEpoch.Timestamp)
+	rw.Write(jsonRes)
+}
+
 func (ms *MintServer) getKeysetById(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	id := vars["id"]
 
-	ks, ok := ms.mint.keysets[id]
+	ks, ok, err := ms.mint.keysetWithKeys(id)
+	if err != nil {
+		ms.mint.logErrorf("could not derive keys of keyset '%v': %v", id, err)
+		ms.writeErr(rw, req, cashu.StandardErr)
+		return
+	}
 	if !ok {
 		ms.writeErr(rw, req, cashu.UnknownKeysetErr)
 		return
@@ -198,20 +425,34 @@ func (ms *MintServer) getKeysetById(rw http.ResponseWriter, req *http.Request) {
 func (ms *MintServer) mintRequest(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	method := vars["method"]
+	if method == cashu.BOLT12_METHOD {
+		ms.mintRequestBolt12(rw, req)
+		return
+	}
 	if method != cashu.BOLT11_METHOD {
 		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
 		return
 	}
 
 	var mintReq nut04.PostMintQuoteBolt11Request
-	err := decodeJsonReqBody(req, &mintReq)
+	err := ms.decodeJsonReqBody(rw, req, &mintReq)
 	if err != nil {
 		ms.writeErr(rw, req, err)
 		return
 	}
+	if err := validateMintQuoteRequest(mintReq); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
+
+	if err := ms.quoteLimiter.allow(ms.ipFilter.clientIP(req)); err != nil {
+		ms.writeThrottled(rw, req, err)
+		return
+	}
 
 	ms.logRequest(req, 0, "mint request for %v %v", mintReq.Amount, mintReq.Unit)
-	mintQuote, err := ms.mint.RequestMintQuote(mintReq)
+	mintQuote, err := ms.mint.requestMintQuote(req.Context(), mintReq)
+	ms.quoteLimiter.done(mintQuote.Id, mintQuote.Expiry)
 	if err != nil {
 		cashuErr, ok := err.(*cashu.Error)
 		// note: if there was internal error from lightning backend generating invoice
@@ -231,6 +472,7 @@ func (ms *MintServer) mintRequest(rw http.ResponseWriter, req *http.Request) {
 		Request: mintQuote.PaymentRequest,
 		State:   mintQuote.State,
 		Expiry:  mintQuote.Expiry,
+		Pubkey:  mintQuote.Pubkey,
 	}
 	jsonRes, err := json.Marshal(&mintQuoteResponse)
 	if err != nil {
@@ -245,13 +487,44 @@ func (ms *MintServer) mintRequest(rw http.ResponseWriter, req *http.Request) {
 func (ms *MintServer) mintQuoteState(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	method := vars["method"]
+	if method == cashu.BOLT12_METHOD {
+		ms.mintQuoteStateBolt12(rw, req)
+		return
+	}
 	if method != cashu.BOLT11_METHOD {
 		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
 		return
 	}
 
 	quoteId := vars["quote_id"]
-	mintQuote, err := ms.mint.GetMintQuoteState(quoteId)
+	if err := validateQuoteId(quoteId); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
+	mintQuote, err := ms.mint.getMintQuoteState(req.Context(), quoteId)
+	ms.writeMintQuoteState(rw, req, mintQuote, err)
+}
+
+// mintQuoteByPaymentHash returns the mint quote for the invoice
+// with the payment hash for wallets that lost the quote id
+func (ms *MintServer) mintQuoteByPaymentHash(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	method := vars["method"]
+	if method != cashu.BOLT11_METHOD {
+		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
+		return
+	}
+
+	mintQuote, err := ms.mint.getMintQuoteByPaymentHash(req.Context(), vars["payment_hash"])
+	ms.writeMintQuoteState(rw, req, mintQuote, err)
+}
+
+func (ms *MintServer) writeMintQuoteState(
+	rw http.ResponseWriter,
+	req *http.Request,
+	mintQuote storage.MintQuote,
+	err error,
+) {
 	if err != nil {
 		cashuErr, ok := err.(*cashu.Error)
 		// note: if there was internal error from lightning backend
@@ -267,11 +540,16 @@ func (ms *MintServer) mintQuoteState(rw http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	if mintQuote.State != nut04.Unpaid {
+		ms.quoteLimiter.paid(mintQuote.Id)
+	}
+
 	mintQuoteStateResponse := nut04.PostMintQuoteBolt11Response{
 		Quote:   mintQuote.Id,
 		Request: mintQuote.PaymentRequest,
 		State:   mintQuote.State,
 		Expiry:  mintQuote.Expiry,
+		Pubkey:  mintQuote.Pubkey,
 	}
 	jsonRes, err := json.Marshal(&mintQuoteStateResponse)
 	if err != nil {
@@ -286,17 +564,27 @@ func (ms *MintServer) mintQuoteState(rw http.ResponseWriter, req *http.Request)
 func (ms *MintServer) mintTokensRequest(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	method := vars["method"]
+	if method == cashu.BOLT12_METHOD {
+		ms.mintTokensRequestBolt12(rw, req)
+		return
+	}
 	if method != cashu.BOLT11_METHOD {
 		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
 		return
 	}
 
 	var mintReq nut04.PostMintBolt11Request
-	err := decodeJsonReqBody(req, &mintReq)
+	err := ms.decodeStreamReqBody(rw, req, func(body io.Reader) error {
+		return mintReq.DecodeStream(body, ms.maxRequestItems)
+	})
 	if err != nil {
 		ms.writeErr(rw, req, err)
 		return
 	}
+	if err := validateMintRequest(mintReq); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
 
 	blindedSignatures, err := ms.mint.MintTokens(mintReq)
 	if err != nil {
@@ -314,27 +602,165 @@ func (ms *MintServer) mintTokensRequest(rw http.ResponseWriter, req *http.Reques
 		return
 	}
 
+	ms.quoteLimiter.paid(mintReq.Quote)
+
 	signatures := nut04.PostMintBolt11Response{Signatures: blindedSignatures}
-	jsonRes, err := json.Marshal(&signatures)
+	ms.logRequest(req, http.StatusOK, "returning signatures on mint tokens request")
+	if err := signatures.EncodeStream(rw); err != nil {
+		ms.mint.logErrorf("error writing mint tokens response: %v", err)
+	}
+}
+
+func (ms *MintServer) mintRequestBolt12(rw http.ResponseWriter, req *http.Request) {
+	var mintReq nut25.PostMintQuoteBolt12Request
+	err := ms.decodeJsonReqBody(rw, req, &mintReq)
+	if err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
+	if err := validateMintQuoteBolt12Request(mintReq); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
+
+	if err := ms.quoteLimiter.allow(ms.ipFilter.clientIP(req)); err != nil {
+		ms.writeThrottled(rw, req, err)
+		return
+	}
+
+	ms.logRequest(req, 0, "bolt12 mint request for %v %v", mintReq.Amount, mintReq.Unit)
+	mintQuote, err := ms.mint.requestMintQuoteBolt12(req.Context(), mintReq)
+	ms.quoteLimiter.done(mintQuote.Id, mintQuote.Expiry)
+	if err != nil {
+		cashuErr, ok := err.(*cashu.Error)
+		// note: if there was internal error from lightning backend generating offer
+		// or error from db, log that error but return generic response
+		if ok {
+			if cashuErr.Code == cashu.LightningBackendErrCode || cashuErr.Code == cashu.DBErrCode {
+				ms.writeErr(rw, req, cashu.StandardErr, cashuErr.Error())
+				return
+			}
+		}
+		ms.writeErr(rw, req, err)
+		return
+	}
+
+	jsonRes, err := json.Marshal(buildMintQuoteBolt12Response(mintQuote))
 	if err != nil {
 		ms.writeErr(rw, req, cashu.StandardErr)
 		return
 	}
 
-	ms.logRequest(req, http.StatusOK, "returning signatures on mint tokens request")
+	ms.logRequest(req, http.StatusOK, "created bolt12 mint quote %v", mintQuote.Id)
 	rw.Write(jsonRes)
 }
 
+func (ms *MintServer) mintQuoteStateBolt12(rw http.ResponseWriter, req *http.Request) {
+	quoteId := mux.Vars(req)["quote_id"]
+	if err := validateQuoteId(quoteId); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
+
+	mintQuote, err := ms.mint.getMintQuoteBolt12State(req.Context(), quoteId)
+	if err != nil {
+		cashuErr, ok := err.(*cashu.Error)
+		// note: if there was internal error from lightning backend
+		// or error from db, log that error but return generic response
+		if ok {
+			if cashuErr.Code == cashu.LightningBackendErrCode || cashuErr.Code == cashu.DBErrCode {
+				ms.writeErr(rw, req, cashu.StandardErr, cashuErr.Error())
+				return
+			}
+		}
+		ms.writeErr(rw, req, err)
+		return
+	}
+
+	if mintQuote.State != nut04.Unpaid {
+		ms.quoteLimiter.paid(mintQuote.Id)
+	}
+
+	jsonRes, err := json.Marshal(buildMintQuoteBolt12Response(mintQuote))
+	if err != nil {
+		ms.writeErr(rw, req, cashu.StandardErr)
+		return
+	}
+
+	ms.logRequest(req, http.StatusOK, "returning bolt12 mint quote with %v sats paid and %v issued",
+		mintQuote.AmountPaid, mintQuote.AmountIssued)
+	rw.Write(jsonRes)
+}
+
+func (ms *MintServer) mintTokensRequestBolt12(rw http.ResponseWriter, req *http.Request) {
+	var mintReq nut25.PostMintBolt12Request
+	err := ms.decodeStreamReqBody(rw, req, func(body io.Reader) error {
+		return mintReq.DecodeStream(body, ms.maxRequestItems)
+	})
+	if err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
+	if err := validateMintBolt12Request(mintReq); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
+
+	blindedSignatures, err := ms.mint.mintTokensBolt12(req.Context(), mintReq)
+	if err != nil {
+		cashuErr, ok := err.(*cashu.Error)
+		// note: if there was internal error from lightning backend
+		// or error from db, log that error but return generic response
+		if ok {
+			if cashuErr.Code == cashu.LightningBackendErrCode || cashuErr.Code == cashu.DBErrCode {
+				ms.writeErr(rw, req, cashu.StandardErr, cashuErr.Error())
+				return
+			}
+		}
+
+		ms.writeErr(rw, req, err)
+		return
+	}
+
+	ms.quoteLimiter.paid(mintReq.Quote)
+
+	signatures := nut25.PostMintBolt12Response{Signatures: blindedSignatures}
+	ms.logRequest(req, http.StatusOK, "returning signatures on bolt12 mint tokens request")
+	if err := signatures.EncodeStream(rw); err != nil {
+		ms.mint.logErrorf("error writing mint tokens response: %v", err)
+	}
+}
+
+func buildMintQuoteBolt12Response(mintQuote storage.MintQuote) nut25.PostMintQuoteBolt12Response {
+	return nut25.PostMintQuoteBolt12Response{
+		Quote:        mintQuote.Id,
+		Request:      mintQuote.PaymentRequest,
+		Amount:       mintQuote.Amount,
+		Unit:         mintQuote.Unit,
+		Expiry:       mintQuote.Expiry,
+		Pubkey:       mintQuote.Pubkey,
+		AmountPaid:   mintQuote.AmountPaid,
+		AmountIssued: mintQuote.AmountIssued,
+	}
+}
+
 func (ms *MintServer) swapRequest(rw http.ResponseWriter, req *http.Request) {
 	var swapReq nut03.PostSwapRequest
-	err := decodeJsonReqBody(req, &swapReq)
+	err := ms.decodeStreamReqBody(rw, req, func(body io.Reader) error {
+		return swapReq.DecodeStream(body, ms.maxRequestItems)
+	})
 	if err != nil {
 		ms.writeErr(rw, req, err)
 		return
 	}
+	if err := validateSwapRequest(swapReq.Inputs, swapReq.Outputs); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
 
-	blindedSignatures, err := ms.mint.Swap(swapReq.Inputs, swapReq.Outputs)
+	blindedSignatures, err := ms.mint.swap(req.Context(), swapReq.Inputs, swapReq.Outputs)
 	if err != nil {
+		ms.recordDoubleSpend(req, swapReq.Inputs, err)
 		cashuErr, ok := err.(*cashu.Error)
 		// note: if there was internal error from db
 		// log that error but return generic response
@@ -348,32 +774,36 @@ func (ms *MintServer) swapRequest(rw http.ResponseWriter, req *http.Request) {
 	}
 
 	signatures := nut03.PostSwapResponse{Signatures: blindedSignatures}
-	jsonRes, err := json.Marshal(&signatures)
-	if err != nil {
-		ms.writeErr(rw, req, cashu.StandardErr)
-		return
-	}
-
 	ms.logRequest(req, http.StatusOK, "returning signatures on swap request")
-	rw.Write(jsonRes)
+	if err := signatures.EncodeStream(rw); err != nil {
+		ms.mint.logErrorf("error writing swap response: %v", err)
+	}
 }
 
 func (ms *MintServer) meltQuoteRequest(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	method := vars["method"]
+	if method == cashu.BOLT12_METHOD {
+		ms.meltQuoteRequestBolt12(rw, req)
+		return
+	}
 	if method != cashu.BOLT11_METHOD {
 		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
 		return
 	}
 
 	var meltRequest nut05.PostMeltQuoteBolt11Request
-	err := decodeJsonReqBody(req, &meltRequest)
+	err := ms.decodeJsonReqBody(rw, req, &meltRequest)
 	if err != nil {
 		ms.writeErr(rw, req, err)
 		return
 	}
+	if err := validateMeltQuoteRequest(meltRequest); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
 
-	meltQuote, err := ms.mint.RequestMeltQuote(meltRequest)
+	meltQuote, err := ms.mint.requestMeltQuote(req.Context(), meltRequest)
 	if err != nil {
 		cashuErr, ok := err.(*cashu.Error)
 		// note: if there was internal error from db
@@ -406,19 +836,155 @@ func (ms *MintServer) meltQuoteRequest(rw http.ResponseWriter, req *http.Request
 	rw.Write(jsonRes)
 }
 
+// meltQuoteRequestBolt12 creates a melt quote for an invoice fetched from the offer
+func (ms *MintServer) meltQuoteRequestBolt12(rw http.ResponseWriter, req *http.Request) {
+	var meltRequest nut25.PostMeltQuoteBolt12Request
+	err := ms.decodeJsonReqBody(rw, req, &meltRequest)
+	if err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
+	if err := validateMeltQuoteRequest(meltRequest); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
+
+	meltQuote, err := ms.mint.requestMeltQuoteBolt12(req.Context(), meltRequest)
+	if err != nil {
+		cashuErr, ok := err.(*cashu.Error)
+		// note: if there was internal error from lightning backend fetching
+		// the invoice or error from db, log that error but return generic response
+		if ok {
+			if cashuErr.Code == cashu.LightningBackendErrCode {
+				responseError := cashu.BuildCashuError("could not fetch invoice from offer", cashu.MeltQuoteErrCode)
+				ms.writeErr(rw, req, responseError, cashuErr.Error())
+				return
+			} else if cashuErr.Code == cashu.DBErrCode {
+				ms.writeErr(rw, req, cashu.StandardErr, cashuErr.Error())
+				return
+			}
+		}
+		ms.writeErr(rw, req, err)
+		return
+	}
+
+	meltQuoteResponse := &nut25.PostMeltQuoteBolt12Response{
+		Quote:      meltQuote.Id,
+		Amount:     meltQuote.Amount,
+		FeeReserve: meltQuote.FeeReserve,
+		State:      meltQuote.State,
+		Expiry:     meltQuote.Expiry,
+	}
+
+	jsonRes, err := json.Marshal(&meltQuoteResponse)
+	if err != nil {
+		ms.writeErr(rw, req, cashu.StandardErr)
+		return
+	}
+
+	ms.logRequest(req, http.StatusOK,
+		"returning bolt12 melt quote '%v' for invoice with payment hash: %v", meltQuote.Id, meltQuote.PaymentHash)
+	rw.Write(jsonRes)
+}
+
+// meltMethodSupported returns whether melt quotes can be checked and melted with
+// the method. Invoices fetched from offers are paid like BOLT11 invoices so
+// both use the same handlers once the quote is created.
+func meltMethodSupported(method string) bool {
+	return method == cashu.BOLT11_METHOD || method == cashu.BOLT12_METHOD
+}
+
 func (ms *MintServer) meltQuoteState(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	method := vars["method"]
-	if method != cashu.BOLT11_METHOD {
+	if !meltMethodSupported(method) {
 		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	// keeps the attributes of the request for logs but is not canceled if the client disconnects
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), time.Second*5)
 	defer cancel()
 
 	quoteId := vars["quote_id"]
+	if err := validateQuoteId(quoteId); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
 	meltQuote, err := ms.mint.GetMeltQuoteState(ctx, quoteId)
+	ms.writeMeltQuoteState(rw, req, meltQuote, err)
+}
+
+// meltQuoteByPaymentHash returns the melt quote for the invoice
+// with the payment hash for wallets that lost the quote id
+func (ms *MintServer) meltQuoteByPaymentHash(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	method := vars["method"]
+	if !meltMethodSupported(method) {
+		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
+		return
+	}
+
+	// keeps the attributes of the request for logs but is not canceled if the client disconnects
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), time.Second*5)
+	defer cancel()
+
+	meltQuote, err := ms.mint.GetMeltQuoteByPaymentHash(ctx, vars["payment_hash"])
+	ms.writeMeltQuoteState(rw, req, meltQuote, err)
+}
+
+// meltRequote replaces the unpaid melt quote with a new one for the
+// same invoice with a higher fee reserve. It returns the new quote
+func (ms *MintServer) meltRequote(rw http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	method := vars["method"]
+	if !meltMethodSupported(method) {
+		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
+		return
+	}
+
+	quoteId := vars["quote_id"]
+	if err := validateQuoteId(quoteId); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
+	meltQuote, err := ms.mint.RequoteMelt(req.Context(), quoteId)
+	if err != nil {
+		cashuErr, ok := err.(*cashu.Error)
+		// note: if there was internal error from db
+		// log that error but return generic response
+		if ok && cashuErr.Code == cashu.DBErrCode {
+			ms.writeErr(rw, req, cashu.StandardErr, cashuErr.Error())
+			return
+		}
+		ms.writeErr(rw, req, err)
+		return
+	}
+
+	meltQuoteResponse := &nut05.PostMeltQuoteBolt11Response{
+		Quote:      meltQuote.Id,
+		Amount:     meltQuote.Amount,
+		FeeReserve: meltQuote.FeeReserve,
+		State:      meltQuote.State,
+		Expiry:     meltQuote.Expiry,
+	}
+
+	jsonRes, err := json.Marshal(&meltQuoteResponse)
+	if err != nil {
+		ms.writeErr(rw, req, cashu.StandardErr)
+		return
+	}
+
+	ms.logRequest(req, http.StatusOK, "returning melt quote '%v' that supersedes quote '%v'", meltQuote.Id, quoteId)
+	rw.Write(jsonRes)
+}
+
+func (ms *MintServer) writeMeltQuoteState(
+	rw http.ResponseWriter,
+	req *http.Request,
+	meltQuote storage.MeltQuote,
+	err error,
+) {
 	if err != nil {
 		cashuErr, ok := err.(*cashu.Error)
 		// note: if there was internal error from lightning backend
@@ -440,6 +1006,7 @@ func (ms *MintServer) meltQuoteState(rw http.ResponseWriter, req *http.Request)
 		State:      meltQuote.State,
 		Expiry:     meltQuote.Expiry,
 		Preimage:   meltQuote.Preimage,
+		Change:     meltQuote.Change,
 	}
 
 	jsonRes, err := json.Marshal(&quoteState)
@@ -455,27 +1022,33 @@ func (ms *MintServer) meltQuoteState(rw http.ResponseWriter, req *http.Request)
 func (ms *MintServer) meltTokens(rw http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	method := vars["method"]
-	if method != cashu.BOLT11_METHOD {
+	if !meltMethodSupported(method) {
 		ms.writeErr(rw, req, cashu.PaymentMethodNotSupportedErr)
 		return
 	}
 
 	var meltTokensRequest nut05.PostMeltBolt11Request
-	err := decodeJsonReqBody(req, &meltTokensRequest)
+	err := ms.decodeJsonReqBody(rw, req, &meltTokensRequest)
 	if err != nil {
 		ms.writeErr(rw, req, err)
 		return
 	}
+	if err := ms.validateMeltRequest(meltTokensRequest); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
 
 	timeout := time.Minute * 1
 	if ms.meltTimeout != nil {
 		timeout = *ms.meltTimeout
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	// the payment should not be interrupted if the client disconnects
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), timeout)
 	defer cancel()
 
 	meltQuote, err := ms.mint.MeltTokens(ctx, meltTokensRequest)
 	if err != nil {
+		ms.recordDoubleSpend(req, meltTokensRequest.Inputs, err)
 		cashuErr, ok := err.(*cashu.Error)
 		// note: if there was internal error from lightning backend
 		// or error from db, log that error but return generic response
@@ -500,6 +1073,7 @@ func (ms *MintServer) meltTokens(rw http.ResponseWriter, req *http.Request) {
 		State:      meltQuote.State,
 		Expiry:     meltQuote.Expiry,
 		Preimage:   meltQuote.Preimage,
+		Change:     meltQuote.Change,
 	}
 
 	jsonRes, err := json.Marshal(&meltQuoteResponse)
@@ -516,13 +1090,17 @@ func (ms *MintServer) meltTokens(rw http.ResponseWriter, req *http.Request) {
 
 func (ms *MintServer) tokenStateCheck(rw http.ResponseWriter, req *http.Request) {
 	var stateRequest nut07.PostCheckStateRequest
-	err := decodeJsonReqBody(req, &stateRequest)
+	err := ms.decodeJsonReqBody(rw, req, &stateRequest)
 	if err != nil {
 		ms.writeErr(rw, req, err)
 		return
 	}
+	if err := ms.validateCheckStateRequest(stateRequest); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
 
-	proofStates, err := ms.mint.ProofsStateCheck(stateRequest.Ys)
+	proofStates, err := ms.mint.proofsStateCheck(req.Context(), stateRequest.Ys)
 	if err != nil {
 		cashuErr, ok := err.(*cashu.Error)
 		// note: if there was internal error from lightning backend
@@ -537,7 +1115,11 @@ func (ms *MintServer) tokenStateCheck(rw http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	checkStateResponse := nut07.PostCheckStateResponse{States: proofStates}
+	checkStateResponse, err := ms.mint.CheckStateResponse(proofStates)
+	if err != nil {
+		ms.writeErr(rw, req, cashu.StandardErr, err.Error())
+		return
+	}
 	jsonRes, err := json.Marshal(&checkStateResponse)
 	if err != nil {
 		ms.writeErr(rw, req, cashu.StandardErr)
@@ -550,11 +1132,15 @@ func (ms *MintServer) tokenStateCheck(rw http.ResponseWriter, req *http.Request)
 
 func (ms *MintServer) restoreSignatures(rw http.ResponseWriter, req *http.Request) {
 	var restoreRequest nut09.PostRestoreRequest
-	err := decodeJsonReqBody(req, &restoreRequest)
+	err := ms.decodeJsonReqBody(rw, req, &restoreRequest)
 	if err != nil {
 		ms.writeErr(rw, req, err)
 		return
 	}
+	if err := ms.validateRestoreRequest(restoreRequest); err != nil {
+		ms.writeErr(rw, req, err)
+		return
+	}
 
 	blindedMessages, blindedSignatures, err := ms.mint.RestoreSignatures(restoreRequest.Outputs)
 	if err != nil {
@@ -608,7 +1194,7 @@ func buildKeysResponse(keysets map[string]crypto.MintKeyset) nut01.GetKeysRespon
 func (ms *MintServer) buildAllKeysetsResponse() nut02.GetKeysetsResponse {
 	keysetsResponse := nut02.GetKeysetsResponse{}
 
-	for _, keyset := range ms.mint.keysets {
+	for _, keyset := range ms.mint.getKeysets() {
 		keysetRes := nut02.Keyset{
 			Id:          keyset.Id,
 			Unit:        keyset.Unit,
@@ -621,7 +1207,7 @@ func (ms *MintServer) buildAllKeysetsResponse() nut02.GetKeysetsResponse {
 	return keysetsResponse
 }
 
-func decodeJsonReqBody(req *http.Request, dst any) error {
+func checkJsonContentType(req *http.Request) error {
 	ct := req.Header.Get("Content-Type")
 	if ct != "" {
 		mediaType := strings.ToLower(strings.Split(ct, ";")[0])
@@ -630,32 +1216,66 @@ func decodeJsonReqBody(req *http.Request, dst any) error {
 			return ctError
 		}
 	}
+	return nil
+}
+
+func (ms *MintServer) decodeJsonReqBody(rw http.ResponseWriter, req *http.Request, dst any) error {
+	if err := checkJsonContentType(req); err != nil {
+		return err
+	}
 
-	dec := json.NewDecoder(req.Body)
+	dec := json.NewDecoder(http.MaxBytesReader(rw, req.Body, ms.maxRequestSize))
 
 	err := dec.Decode(&dst)
 	if err != nil {
-		var syntaxErr *json.SyntaxError
-		var typeErr *json.UnmarshalTypeError
-		var cashuErr *cashu.Error
-
-		switch {
-		case errors.As(err, &syntaxErr):
-			msg := fmt.Sprintf("bad json at %d", syntaxErr.Offset)
-			cashuErr = cashu.BuildCashuError(msg, cashu.StandardErrCode)
-
-		case errors.As(err, &typeErr):
-			msg := fmt.Sprintf("invalid %v for field %q", typeErr.Value, typeErr.Field)
-			cashuErr = cashu.BuildCashuError(msg, cashu.StandardErrCode)
+		return jsonDecodeErr(err)
+	}
 
-		case errors.Is(err, io.EOF):
-			return cashu.EmptyBodyErr
+	return nil
+}
 
-		default:
-			cashuErr = cashu.BuildCashuError(err.Error(), cashu.StandardErrCode)
-		}
-		return cashuErr
+// decodeStreamReqBody limits the size of the request body and
+// passes it to decode for requests that can have many inputs or outputs
+func (ms *MintServer) decodeStreamReqBody(
+	rw http.ResponseWriter,
+	req *http.Request,
+	decode func(io.Reader) error,
+) error {
+	if err := checkJsonContentType(req); err != nil {
+		return err
 	}
 
+	body := http.MaxBytesReader(rw, req.Body, ms.maxRequestSize)
+	if err := decode(body); err != nil {
+		return jsonDecodeErr(err)
+	}
 	return nil
 }
+
+func jsonDecodeErr(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+	var cashuErr *cashu.Error
+
+	switch {
+	case errors.As(err, &syntaxErr):
+		msg := fmt.Sprintf("bad json at %d", syntaxErr.Offset)
+		cashuErr = cashu.BuildCashuError(msg, cashu.StandardErrCode)
+
+	case errors.As(err, &typeErr):
+		msg := fmt.Sprintf("invalid %v for field %q", typeErr.Value, typeErr.Field)
+		cashuErr = cashu.BuildCashuError(msg, cashu.StandardErrCode)
+
+	case errors.As(err, &maxBytesErr):
+		msg := fmt.Sprintf("request body larger than %v bytes", maxBytesErr.Limit)
+		cashuErr = cashu.BuildCashuError(msg, cashu.StandardErrCode)
+
+	case errors.Is(err, io.EOF):
+		return cashu.EmptyBodyErr
+
+	default:
+		cashuErr = cashu.BuildCashuError(err.Error(), cashu.StandardErrCode)
+	}
+	return cashuErr
+}
@@ -0,0 +1,98 @@
+package mint
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// MaxInputFeePpk is the highest input fee that can be set for the active keyset.
+// Each input would cost 10 sats so it is most likely a mistake in the config.
+const MaxInputFeePpk = 10000
+
+// checkKeysets checks the keysets from the config against the keysets in the db
+// before loading them. Changes that are likely not intended are logged and
+// mismatches the mint can't recover from return an error so it does not start.
+func checkKeysets(
+	seed []byte,
+	activeKeysets map[string]crypto.MintKeyset,
+	dbKeysets []storage.DBKeyset,
+	logger *slog.Logger,
+) error {
+	hexSeed := hex.EncodeToString(seed)
+	activeByUnit := make(map[string][]string)
+	lastByUnit := make(map[string]storage.DBKeyset)
+	for _, dbKeyset := range dbKeysets {
+		// imported keysets have their own seed and are never active
+		if dbKeyset.VerifyOnly {
+			continue
+		}
+		if dbKeyset.Seed != hexSeed {
+			return fmt.Errorf("keyset '%v' in the db was not derived from the seed of the mint. "+
+				"The db could have been mixed with the db of another mint", dbKeyset.Id)
+		}
+
+		if dbKeyset.Active {
+			activeByUnit[dbKeyset.Unit] = append(activeByUnit[dbKeyset.Unit], dbKeyset.Id)
+		}
+		if last, ok := lastByUnit[dbKeyset.Unit]; !ok || dbKeyset.DerivationPathIdx > last.DerivationPathIdx {
+			lastByUnit[dbKeyset.Unit] = dbKeyset
+		}
+
+		active, ok := activeKeysets[dbKeyset.Id]
+		if !ok {
+			continue
+		}
+		if active.Unit != dbKeyset.Unit || active.DerivationPathIdx != dbKeyset.DerivationPathIdx {
+			return fmt.Errorf("keyset id collision: active keyset '%v' (unit %v, derivation path idx %v) "+
+				"has the id of keyset in the db with unit %v and derivation path idx %v",
+				active.Id, active.Unit, active.DerivationPathIdx, dbKeyset.Unit, dbKeyset.DerivationPathIdx)
+		}
+		if active.InputFeePpk != dbKeyset.InputFeePpk {
+			logger.Warn(fmt.Sprintf("input fee of active keyset '%v' changed from %v to %v ppk. "+
+				"Increase the derivation path idx to rotate to a new keyset with the new fee instead",
+				active.Id, dbKeyset.InputFeePpk, active.InputFeePpk))
+		}
+	}
+
+	for unit, ids := range activeByUnit {
+		if len(ids) > 1 {
+			slices.Sort(ids)
+			logger.Warn(fmt.Sprintf("found %v active keysets for unit %v in the db: %v. "+
+				"Only the keyset from the config will be active", len(ids), unit, ids))
+		}
+	}
+
+	for _, active := range activeKeysets {
+		if active.InputFeePpk > MaxInputFeePpk {
+			return fmt.Errorf("input fee of %v ppk is above the max of %v ppk", active.InputFeePpk, MaxInputFeePpk)
+		}
+		if active.InputFeePpk >= 1000 {
+			logger.Warn(fmt.Sprintf("input fee of %v ppk for keyset '%v' takes the full amount of inputs of 1 %v",
+				active.InputFeePpk, active.Id, active.Unit))
+		}
+
+		last, ok := lastByUnit[active.Unit]
+		if !ok {
+			continue
+		}
+		switch {
+		case active.DerivationPathIdx < last.DerivationPathIdx:
+			// most likely the derivation path idx was not set
+			// after rotating and it would go back to an old keyset
+			return fmt.Errorf("derivation path idx %v is lower than the idx %v of keyset '%v' for unit %v. "+
+				"Set the derivation path idx to %v to keep the current keyset or higher to rotate to a new keyset",
+				active.DerivationPathIdx, last.DerivationPathIdx, last.Id, active.Unit, last.DerivationPathIdx)
+		case active.DerivationPathIdx > last.DerivationPathIdx:
+			logger.Warn(fmt.Sprintf("rotating active keyset for unit %v from '%v' (derivation path idx %v) "+
+				"to new keyset '%v' (derivation path idx %v)",
+				active.Unit, last.Id, last.DerivationPathIdx, active.Id, active.DerivationPathIdx))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,599 @@
+// Package memory has a storage.MintDB that keeps everything in memory.
+// Nothing is persisted, so it is meant for tests or for mints that
+// only need to live as long as the process.
+package memory
+
+import (
+	"cmp"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/storage"
+)
+
+// MemoryDB behaves like the sqlite db. Lookups that find nothing return
+// sql.ErrNoRows and saving an entry that already exists is an error,
+// which is what prevents proofs from being spent twice.
+type MemoryDB struct {
+	mu sync.RWMutex
+
+	seed          []byte
+	keysets       []storage.DBKeyset
+	proofs        proofsTable
+	pendingProofs proofsTable
+	// time each pending proof was added by Y
+	pendingSince map[string]int64
+	// quotes in the order they were saved with index by id
+	mintQuotes      []storage.MintQuote
+	mintQuotesIdx   map[string]int
+	meltQuotes      []storage.MeltQuote
+	meltQuotesIdx   map[string]int
+	blindSignatures map[string]cashu.BlindedSignature
+	// change outputs of melt quotes by quote id
+	meltChangeOutputs map[string]cashu.BlindedMessages
+	keysetFees        map[string]uint64
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		proofs:            newProofsTable(),
+		pendingProofs:     newProofsTable(),
+		pendingSince:      make(map[string]int64),
+		mintQuotesIdx:     make(map[string]int),
+		meltQuotesIdx:     make(map[string]int),
+		blindSignatures:   make(map[string]cashu.BlindedSignature),
+		meltChangeOutputs: make(map[string]cashu.BlindedMessages),
+		keysetFees:        make(map[string]uint64),
+	}
+}
+
+func (db *MemoryDB) Close() {}
+
+func (db *MemoryDB) GetBalance() (uint64, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	var balance uint64
+	for _, quote := range db.mintQuotes {
+		if quote.Method == cashu.BOLT12_METHOD {
+			balance += quote.AmountIssued
+		} else if quote.State == nut04.Issued {
+			switch quote.Unit {
+			case cashu.Msat.String():
+				balance += quote.Amount / 1000
+			case cashu.Usd.String(), cashu.Eur.String():
+				balance += quote.AmountMsat / 1000
+			default:
+				balance += quote.Amount
+			}
+		}
+	}
+	for _, quote := range db.meltQuotes {
+		if quote.State == nut05.Paid {
+			switch quote.Unit {
+			case cashu.Msat.String():
+				balance -= (quote.Amount + 999) / 1000
+			case cashu.Usd.String(), cashu.Eur.String():
+				balance -= (quote.AmountMsat + 999) / 1000
+			default:
+				balance -= quote.Amount
+			}
+		}
+	}
+	return balance, nil
+}
+
+func (db *MemoryDB) SaveSeed(seed []byte) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.seed != nil {
+		return errors.New("seed already exists")
+	}
+	db.seed = slices.Clone(seed)
+	return nil
+}
+
+func (db *MemoryDB) GetSeed() ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.seed == nil {
+		return nil, sql.ErrNoRows
+	}
+	return slices.Clone(db.seed), nil
+}
+
+func (db *MemoryDB) SaveKeyset(keyset storage.DBKeyset) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if slices.ContainsFunc(db.keysets, func(k storage.DBKeyset) bool { return k.Id == keyset.Id }) {
+		return fmt.Errorf("keyset '%v' already exists", keyset.Id)
+	}
+	db.keysets = append(db.keysets, keyset)
+	return nil
+}
+
+func (db *MemoryDB) GetKeysets() ([]storage.DBKeyset, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	keysets := make([]storage.DBKeyset, len(db.keysets))
+	copy(keysets, db.keysets)
+	return keysets, nil
+}
+
+func (db *MemoryDB) UpdateKeysetActive(keysetId string, active bool) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	idx := slices.IndexFunc(db.keysets, func(k storage.DBKeyset) bool { return k.Id == keysetId })
+	if idx == -1 {
+		return errors.New("keyset was not updated")
+	}
+	db.keysets[idx].Active = active
+	return nil
+}
+
+func (db *MemoryDB) RotateKeyset(newKeyset storage.DBKeyset, previousKeysetId string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	idx := slices.IndexFunc(db.keysets, func(k storage.DBKeyset) bool { return k.Id == previousKeysetId })
+	if idx == -1 || !db.keysets[idx].Active {
+		return errors.New("previous keyset is not active")
+	}
+	if slices.ContainsFunc(db.keysets, func(k storage.DBKeyset) bool { return k.Id == newKeyset.Id }) {
+		return fmt.Errorf("keyset '%v' already exists", newKeyset.Id)
+	}
+	db.keysets[idx].Active = false
+	db.keysets = append(db.keysets, newKeyset)
+	return nil
+}
+
+// proofsTable has the proofs by Y. Like the tables in sqlite,
+// the Y and the secret of each proof have to be unique
+type proofsTable struct {
+	proofs  map[string]storage.DBProof
+	secrets map[string]bool
+}
+
+func newProofsTable() proofsTable {
+	return proofsTable{
+		proofs:  make(map[string]storage.DBProof),
+		secrets: make(map[string]bool),
+	}
+}
+
+// add saves all the proofs or none if any of them already exists
+func (table proofsTable) add(proofs cashu.Proofs, quoteId string) error {
+	dbProofs := make([]storage.DBProof, len(proofs))
+	Ys := make(map[string]bool, len(proofs))
+	secrets := make(map[string]bool, len(proofs))
+	for i, proof := range proofs {
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			return err
+		}
+		Yhex := hex.EncodeToString(Y.SerializeCompressed())
+
+		_, exists := table.proofs[Yhex]
+		if exists || Ys[Yhex] || table.secrets[proof.Secret] || secrets[proof.Secret] {
+			return fmt.Errorf("proof with Y '%v' already exists", Yhex)
+		}
+		Ys[Yhex] = true
+		secrets[proof.Secret] = true
+
+		dbProofs[i] = storage.DBProof{
+			Amount:      proof.Amount,
+			Id:          proof.Id,
+			Secret:      proof.Secret,
+			Y:           Yhex,
+			C:           proof.C,
+			Witness:     proof.Witness,
+			MeltQuoteId: quoteId,
+		}
+	}
+
+	for _, proof := range dbProofs {
+		table.proofs[proof.Y] = proof
+		table.secrets[proof.Secret] = true
+	}
+	return nil
+}
+
+// find returns the proofs for the Ys, in the order of the Ys
+func (table proofsTable) find(Ys []string) []storage.DBProof {
+	found := []storage.DBProof{}
+	seen := make(map[string]bool, len(Ys))
+	for _, Y := range Ys {
+		proof, ok := table.proofs[Y]
+		if !ok || seen[Y] {
+			continue
+		}
+		seen[Y] = true
+		found = append(found, proof)
+	}
+	return found
+}
+
+func (table proofsTable) remove(Y string) {
+	if proof, ok := table.proofs[Y]; ok {
+		delete(table.secrets, proof.Secret)
+		delete(table.proofs, Y)
+	}
+}
+
+func (db *MemoryDB) SaveProofs(proofs cashu.Proofs) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return db.proofs.add(proofs, "")
+}
+
+func (db *MemoryDB) GetProofsUsed(Ys []string) ([]storage.DBProof, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.proofs.find(Ys), nil
+}
+
+func (db *MemoryDB) AddPendingProofs(proofs cashu.Proofs, quoteId string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.pendingProofs.add(proofs, quoteId); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	for _, proof := range db.pendingProofs.proofs {
+		if proof.MeltQuoteId == quoteId {
+			if _, ok := db.pendingSince[proof.Y]; !ok {
+				db.pendingSince[proof.Y] = now
+			}
+		}
+	}
+	return nil
+}
+
+func (db *MemoryDB) GetPendingProofs(Ys []string) ([]storage.DBProof, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.pendingProofs.find(Ys), nil
+}
+
+func (db *MemoryDB) GetPendingProofsByQuote(quoteId string) ([]storage.DBProof, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	proofs := []storage.DBProof{}
+	for _, proof := range db.pendingProofs.proofs {
+		if proof.MeltQuoteId == quoteId {
+			proofs = append(proofs, proof)
+		}
+	}
+	slices.SortFunc(proofs, func(a, b storage.DBProof) int { return cmp.Compare(a.Y, b.Y) })
+	return proofs, nil
+}
+
+func (db *MemoryDB) GetAllPendingProofs() ([]storage.PendingProof, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	proofs := []storage.PendingProof{}
+	for _, proof := range db.pendingProofs.proofs {
+		proofs = append(proofs, storage.PendingProof{DBProof: proof, PendingSince: db.pendingSince[proof.Y]})
+	}
+	slices.SortFunc(proofs, func(a, b storage.PendingProof) int { return cmp.Compare(a.Y, b.Y) })
+	return proofs, nil
+}
+
+func (db *MemoryDB) RemovePendingProofs(Ys []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, Y := range Ys {
+		db.pendingProofs.remove(Y)
+		delete(db.pendingSince, Y)
+	}
+	return nil
+}
+
+func (db *MemoryDB) SaveMintQuote(quote storage.MintQuote) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.mintQuotesIdx[quote.Id]; ok {
+		return fmt.Errorf("mint quote '%v' already exists", quote.Id)
+	}
+	db.mintQuotesIdx[quote.Id] = len(db.mintQuotes)
+	db.mintQuotes = append(db.mintQuotes, quote)
+	return nil
+}
+
+func (db *MemoryDB) GetMintQuote(quoteId string) (storage.MintQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	idx, ok := db.mintQuotesIdx[quoteId]
+	if !ok {
+		return storage.MintQuote{}, sql.ErrNoRows
+	}
+	return db.mintQuotes[idx], nil
+}
+
+func (db *MemoryDB) GetMintQuoteByPaymentHash(paymentHash string) (storage.MintQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	idx := slices.IndexFunc(db.mintQuotes, func(q storage.MintQuote) bool { return q.PaymentHash == paymentHash })
+	if idx == -1 {
+		return storage.MintQuote{}, sql.ErrNoRows
+	}
+	return db.mintQuotes[idx], nil
+}
+
+func (db *MemoryDB) UpdateMintQuoteState(quoteId string, state nut04.State) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	idx, ok := db.mintQuotesIdx[quoteId]
+	if !ok {
+		return errors.New("mint quote was not updated")
+	}
+	db.mintQuotes[idx].State = state
+	return nil
+}
+
+func (db *MemoryDB) UpdateMintQuoteAmounts(quoteId string, amountPaid, amountIssued uint64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	idx, ok := db.mintQuotesIdx[quoteId]
+	if !ok {
+		return errors.New("mint quote was not updated")
+	}
+	db.mintQuotes[idx].AmountPaid = amountPaid
+	db.mintQuotes[idx].AmountIssued = amountIssued
+	return nil
+}
+
+func (db *MemoryDB) SaveMeltQuote(quote storage.MeltQuote) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.meltQuotesIdx[quote.Id]; ok {
+		return fmt.Errorf("melt quote '%v' already exists", quote.Id)
+	}
+	db.meltQuotesIdx[quote.Id] = len(db.meltQuotes)
+	db.meltQuotes = append(db.meltQuotes, quote)
+	return nil
+}
+
+func (db *MemoryDB) GetMeltQuote(quoteId string) (storage.MeltQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	idx, ok := db.meltQuotesIdx[quoteId]
+	if !ok {
+		return storage.MeltQuote{}, sql.ErrNoRows
+	}
+	return db.meltQuotes[idx], nil
+}
+
+func (db *MemoryDB) GetMeltQuoteByPaymentRequest(request string) (*storage.MeltQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	idx := db.meltQuoteIdx(func(q storage.MeltQuote) bool { return q.InvoiceRequest == request })
+	if idx == -1 {
+		return nil, sql.ErrNoRows
+	}
+	quote := db.meltQuotes[idx]
+	return &quote, nil
+}
+
+func (db *MemoryDB) GetMeltQuoteByPaymentHash(paymentHash string) (storage.MeltQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	idx := db.meltQuoteIdx(func(q storage.MeltQuote) bool { return q.PaymentHash == paymentHash })
+	if idx == -1 {
+		return storage.MeltQuote{}, sql.ErrNoRows
+	}
+	return db.meltQuotes[idx], nil
+}
+
+// meltQuoteIdx returns the index of a quote that matches. Quotes that
+// were not superseded are returned before the ones that were
+func (db *MemoryDB) meltQuoteIdx(match func(storage.MeltQuote) bool) int {
+	idx := slices.IndexFunc(db.meltQuotes, func(q storage.MeltQuote) bool {
+		return match(q) && len(q.SupersededBy) == 0
+	})
+	if idx == -1 {
+		idx = slices.IndexFunc(db.meltQuotes, match)
+	}
+	return idx
+}
+
+func (db *MemoryDB) ReplaceMeltQuote(oldQuoteId string, newQuote storage.MeltQuote) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	idx, ok := db.meltQuotesIdx[oldQuoteId]
+	if !ok || db.meltQuotes[idx].State != nut05.Unpaid || len(db.meltQuotes[idx].SupersededBy) > 0 {
+		return errors.New("melt quote was not replaced")
+	}
+	if _, ok := db.meltQuotesIdx[newQuote.Id]; ok {
+		return fmt.Errorf("melt quote '%v' already exists", newQuote.Id)
+	}
+	db.meltQuotes[idx].SupersededBy = newQuote.Id
+	db.meltQuotesIdx[newQuote.Id] = len(db.meltQuotes)
+	db.meltQuotes = append(db.meltQuotes, newQuote)
+	return nil
+}
+
+func (db *MemoryDB) UpdateMeltQuote(quoteId, preimage string, state nut05.State) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	idx, ok := db.meltQuotesIdx[quoteId]
+	if !ok {
+		return errors.New("melt quote was not updated")
+	}
+	db.meltQuotes[idx].Preimage = preimage
+	db.meltQuotes[idx].State = state
+	return nil
+}
+
+func (db *MemoryDB) GetMintQuotesByState(state nut04.State) ([]storage.MintQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var quotes []storage.MintQuote
+	for _, quote := range db.mintQuotes {
+		if quote.State == state {
+			quotes = append(quotes, quote)
+		}
+	}
+	return quotes, nil
+}
+
+func (db *MemoryDB) GetMeltQuotesByState(state nut05.State) ([]storage.MeltQuote, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	var quotes []storage.MeltQuote
+	for _, quote := range db.meltQuotes {
+		if quote.State == state {
+			quotes = append(quotes, quote)
+		}
+	}
+	return quotes, nil
+}
+
+func (db *MemoryDB) SaveMeltChangeOutputs(quoteId string, outputs cashu.BlindedMessages) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if len(outputs) == 0 {
+		delete(db.meltChangeOutputs, quoteId)
+		return nil
+	}
+	saved := make(cashu.BlindedMessages, len(outputs))
+	for i, output := range outputs {
+		saved[i] = cashu.BlindedMessage{B_: output.B_, Id: output.Id}
+	}
+	db.meltChangeOutputs[quoteId] = saved
+	return nil
+}
+
+func (db *MemoryDB) GetMeltChangeOutputs(quoteId string) (cashu.BlindedMessages, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	outputs := cashu.BlindedMessages{}
+	return append(outputs, db.meltChangeOutputs[quoteId]...), nil
+}
+
+func (db *MemoryDB) SaveBlindSignature(B_ string, blindSignature cashu.BlindedSignature) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.blindSignatures[B_]; ok {
+		return fmt.Errorf("blind signature for '%v' already exists", B_)
+	}
+	db.blindSignatures[B_] = copySignature(blindSignature)
+	return nil
+}
+
+func (db *MemoryDB) GetBlindSignature(B_ string) (cashu.BlindedSignature, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	signature, ok := db.blindSignatures[B_]
+	if !ok {
+		return cashu.BlindedSignature{}, sql.ErrNoRows
+	}
+	return copySignature(signature), nil
+}
+
+func (db *MemoryDB) GetBlindSignatures(B_s []string) (cashu.BlindedSignatures, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	_, signatures := db.findBlindSignatures(B_s)
+	return signatures, nil
+}
+
+func (db *MemoryDB) GetBlindSignaturesByKeyset(keysetId string, B_s []string) (map[string]cashu.BlindedSignature, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	signedB_s, signatures := db.findBlindSignatures(B_s)
+	signed := make(map[string]cashu.BlindedSignature, len(signatures))
+	for i, signature := range signatures {
+		if signature.Id == keysetId {
+			signed[signedB_s[i]] = signature
+		}
+	}
+	return signed, nil
+}
+
+// findBlindSignatures returns the signatures for the B_s that were
+// signed and the B_ of each of them, in the order of the B_s
+func (db *MemoryDB) findBlindSignatures(B_s []string) ([]string, cashu.BlindedSignatures) {
+	signedB_s := []string{}
+	signatures := cashu.BlindedSignatures{}
+	for _, B_ := range B_s {
+		signature, ok := db.blindSignatures[B_]
+		if !ok || slices.Contains(signedB_s, B_) {
+			continue
+		}
+		signedB_s = append(signedB_s, B_)
+		signatures = append(signatures, copySignature(signature))
+	}
+	return signedB_s, signatures
+}
+
+func copySignature(signature cashu.BlindedSignature) cashu.BlindedSignature {
+	if signature.DLEQ != nil {
+		dleq := *signature.DLEQ
+		signature.DLEQ = &dleq
+	}
+	return signature
+}
+
+func (db *MemoryDB) GetIssuedDenominations() ([]storage.DenominationCount, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	counts := make(map[storage.DenominationCount]uint64)
+	for _, signature := range db.blindSignatures {
+		counts[storage.DenominationCount{KeysetId: signature.Id, Amount: signature.Amount}]++
+	}
+	return denominations(counts), nil
+}
+
+func (db *MemoryDB) GetRedeemedDenominations() ([]storage.DenominationCount, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	counts := make(map[storage.DenominationCount]uint64)
+	for _, proof := range db.proofs.proofs {
+		counts[storage.DenominationCount{KeysetId: proof.Id, Amount: proof.Amount}]++
+	}
+	return denominations(counts), nil
+}
+
+func (db *MemoryDB) AddKeysetFees(fees map[string]uint64) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for keysetId, keysetFees := range fees {
+		db.keysetFees[keysetId] += keysetFees
+	}
+	return nil
+}
+
+func (db *MemoryDB) GetKeysetFees() ([]storage.KeysetFees, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	keysetFees := make([]storage.KeysetFees, 0, len(db.keysetFees))
+	for keysetId, fees := range db.keysetFees {
+		keysetFees = append(keysetFees, storage.KeysetFees{KeysetId: keysetId, Fees: fees})
+	}
+	slices.SortFunc(keysetFees, func(a, b storage.KeysetFees) int {
+		return cmp.Compare(a.KeysetId, b.KeysetId)
+	})
+	return keysetFees, nil
+}
+
+// denominations returns the counts sorted by keyset and amount
+func denominations(counts map[storage.DenominationCount]uint64) []storage.DenominationCount {
+	denominations := make([]storage.DenominationCount, 0, len(counts))
+	for denomination, count := range counts {
+		denomination.Count = count
+		denominations = append(denominations, denomination)
+	}
+	slices.SortFunc(denominations, func(a, b storage.DenominationCount) int {
+		return cmp.Or(cmp.Compare(a.KeysetId, b.KeysetId), cmp.Compare(a.Amount, b.Amount))
+	})
+	return denominations
+}
@@ -0,0 +1,275 @@
+package memory
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/storage"
+	"github.com/elnosh/gonuts/mint/storage/sqlite"
+)
+
+// MemoryDB should give the same results as the sqlite db after the same changes
+func TestMemoryDB(t *testing.T) {
+	sqliteDB, err := sqlite.InitSQLite(t.TempDir())
+	if err != nil {
+		t.Fatalf("error setting up sqlite: %v", err)
+	}
+	defer sqliteDB.Close()
+	memDB := NewMemoryDB()
+	dbs := []storage.MintDB{sqliteDB, memDB}
+
+	proofs := make(cashu.Proofs, 20)
+	for i := range proofs {
+		proofs[i] = cashu.Proof{
+			Amount:  uint64(1 << (i % 4)),
+			Id:      fmt.Sprintf("keyset%v", i%2),
+			Secret:  fmt.Sprintf("secret%v", i),
+			C:       "02aa",
+			Witness: "witness",
+		}
+	}
+	Ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		Y, _ := crypto.HashToCurve([]byte(proof.Secret))
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+	}
+	mintQuotes := []storage.MintQuote{
+		{Id: "mint1", Amount: 100, PaymentRequest: "lnbc1", PaymentHash: "hash1", State: nut04.Unpaid},
+		{Id: "mint2", Amount: 50, PaymentRequest: "lnbc2", PaymentHash: "hash2", State: nut04.Unpaid, Pubkey: "02cc"},
+		{Id: "mint3", Amount: 3000, PaymentRequest: "lnbc5", PaymentHash: "hash5", State: nut04.Unpaid, Unit: "msat"},
+		{Id: "mint4", PaymentRequest: "lno1", PaymentHash: "offer1", State: nut04.Paid, Method: cashu.BOLT12_METHOD},
+	}
+	meltQuotes := []storage.MeltQuote{
+		{Id: "melt1", InvoiceRequest: "lnbc3", PaymentHash: "hash3", Amount: 21, AmountMsat: 21000, State: nut05.Unpaid},
+		{Id: "melt2", InvoiceRequest: "lnbc4", PaymentHash: "hash4", Amount: 10, AmountMsat: 10000, State: nut05.Pending},
+		{Id: "melt3", InvoiceRequest: "lnbc6", PaymentHash: "hash6", Amount: 1500, AmountMsat: 1500, State: nut05.Unpaid, Unit: "msat"},
+		{Id: "melt4", InvoiceRequest: "lnbc7", PaymentHash: "hash7", Amount: 5, AmountMsat: 5000, FeeReserve: 1, FeeReserveMsat: 1000, State: nut05.Unpaid},
+	}
+	requote := storage.MeltQuote{
+		Id: "melt5", InvoiceRequest: "lnbc7", PaymentHash: "hash7", Amount: 5, AmountMsat: 5000, FeeReserve: 2, FeeReserveMsat: 2000, State: nut05.Unpaid,
+	}
+	signature := cashu.BlindedSignature{Amount: 8, C_: "02bb", Id: "keyset0", DLEQ: &cashu.DLEQProof{E: "e", S: "s"}}
+
+	for _, db := range dbs {
+		if _, err := db.GetSeed(); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected error '%v' but got '%v'", sql.ErrNoRows, err)
+		}
+		if err := db.SaveSeed([]byte("seed")); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SaveKeyset(storage.DBKeyset{Id: "keyset0", Unit: "sat", Active: true, Seed: "aa"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SaveKeyset(storage.DBKeyset{Id: "keyset0", Unit: "sat"}); err == nil {
+			t.Fatal("expected error saving keyset that already exists")
+		}
+		if err := db.SaveKeyset(storage.DBKeyset{Id: "keyset1", Unit: "sat", Seed: "bb"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdateKeysetActive("keyset0", false); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdateKeysetActive("notfound", false); err == nil {
+			t.Fatal("expected error updating keyset that does not exist")
+		}
+		rotated := storage.DBKeyset{Id: "keyset2", Unit: "sat", Active: true, Seed: "aa", DerivationPathIdx: 1}
+		if err := db.RotateKeyset(rotated, "keyset0"); err == nil {
+			t.Fatal("expected error rotating from keyset that is not active")
+		}
+		if err := db.UpdateKeysetActive("keyset0", true); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.RotateKeyset(rotated, "keyset0"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.SaveProofs(proofs[:10]); err != nil {
+			t.Fatal(err)
+		}
+		// no proofs are saved if one of them was already spent
+		if err := db.SaveProofs(proofs[9:12]); err == nil {
+			t.Fatal("expected error saving proofs already spent")
+		}
+		if err := db.AddPendingProofs(proofs[12:16], "melt2"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AddPendingProofs(proofs[15:18], "melt1"); err == nil {
+			t.Fatal("expected error adding proofs already pending")
+		}
+		if err := db.RemovePendingProofs(Ys[12:13]); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, quote := range mintQuotes {
+			if err := db.SaveMintQuote(quote); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.UpdateMintQuoteState("mint1", nut04.Issued); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdateMintQuoteState("mint3", nut04.Issued); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdateMintQuoteAmounts("mint4", 300, 200); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdateMintQuoteAmounts("notfound", 300, 200); err == nil {
+			t.Fatal("expected error updating mint quote that does not exist")
+		}
+		if err := db.UpdateMintQuoteState("notfound", nut04.Issued); err == nil {
+			t.Fatal("expected error updating mint quote that does not exist")
+		}
+		for _, quote := range meltQuotes {
+			if err := db.SaveMeltQuote(quote); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.SaveMeltQuote(meltQuotes[0]); err == nil {
+			t.Fatal("expected error saving melt quote that already exists")
+		}
+		if err := db.UpdateMeltQuote("melt1", "preimage", nut05.Paid); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.UpdateMeltQuote("melt3", "preimage", nut05.Paid); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.ReplaceMeltQuote("melt4", requote); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.ReplaceMeltQuote("melt4", storage.MeltQuote{Id: "melt6"}); err == nil {
+			t.Fatal("expected error replacing melt quote that was already superseded")
+		}
+		if err := db.ReplaceMeltQuote("melt2", storage.MeltQuote{Id: "melt6"}); err == nil {
+			t.Fatal("expected error replacing melt quote that is pending")
+		}
+		// outputs from a later attempt replace the previous ones
+		changeOutputs := cashu.BlindedMessages{{B_: "B_3", Id: "keyset0"}, {B_: "B_4", Id: "keyset0"}}
+		if err := db.SaveMeltChangeOutputs("melt1", changeOutputs); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SaveMeltChangeOutputs("melt1", changeOutputs[1:]); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SaveMeltChangeOutputs("melt2", changeOutputs); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SaveMeltChangeOutputs("melt2", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.AddKeysetFees(map[string]uint64{"keyset0": 2, "keyset1": 1}); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AddKeysetFees(map[string]uint64{"keyset0": 3}); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := db.SaveBlindSignature("B_1", signature); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SaveBlindSignature("B_1", signature); err == nil {
+			t.Fatal("expected error saving signature for B_ already signed")
+		}
+	}
+
+	results := func(db storage.MintDB) []any {
+		balance, err := db.GetBalance()
+		seed, _ := db.GetSeed()
+		keysets, _ := db.GetKeysets()
+		used, _ := db.GetProofsUsed(Ys)
+		pending, _ := db.GetPendingProofs(Ys)
+		mintQuote, _ := db.GetMintQuote("mint1")
+		mintQuoteByHash, _ := db.GetMintQuoteByPaymentHash("hash2")
+		msatMintQuote, _ := db.GetMintQuote("mint3")
+		bolt12MintQuote, _ := db.GetMintQuote("mint4")
+		_, mintQuoteErr := db.GetMintQuote("notfound")
+		meltQuote, _ := db.GetMeltQuote("melt1")
+		meltQuoteByHash, _ := db.GetMeltQuoteByPaymentHash("hash4")
+		meltQuoteByRequest, _ := db.GetMeltQuoteByPaymentRequest("lnbc4")
+		msatMeltQuote, _ := db.GetMeltQuote("melt3")
+		_, meltQuoteErr := db.GetMeltQuoteByPaymentRequest("notfound")
+		supersededQuote, _ := db.GetMeltQuote("melt4")
+		requoteByHash, _ := db.GetMeltQuoteByPaymentHash("hash7")
+		requoteByRequest, _ := db.GetMeltQuoteByPaymentRequest("lnbc7")
+		_, replacedErr := db.GetMeltQuote("melt6")
+		pendingQuotes, _ := db.GetMeltQuotesByState(nut05.Pending)
+		unpaidQuotes, _ := db.GetMeltQuotesByState(nut05.Unpaid)
+		changeOutputs, _ := db.GetMeltChangeOutputs("melt1")
+		noChangeOutputs, _ := db.GetMeltChangeOutputs("melt2")
+		blindSignature, _ := db.GetBlindSignature("B_1")
+		_, blindSignatureErr := db.GetBlindSignature("notfound")
+		blindSignatures, _ := db.GetBlindSignatures([]string{"B_1", "B_2"})
+		byKeyset, _ := db.GetBlindSignaturesByKeyset("keyset0", []string{"B_1"})
+		otherKeyset, _ := db.GetBlindSignaturesByKeyset("keyset1", []string{"B_1"})
+		issued, _ := db.GetIssuedDenominations()
+		redeemed, _ := db.GetRedeemedDenominations()
+		keysetFees, _ := db.GetKeysetFees()
+		unpaidMintQuotes, _ := db.GetMintQuotesByState(nut04.Unpaid)
+		allPending, _ := db.GetAllPendingProofs()
+		for i := range allPending {
+			if allPending[i].PendingSince == 0 {
+				t.Fatalf("expected time pending proof was added to be set")
+			}
+			// times of each db could be in a different second
+			allPending[i].PendingSince = 0
+		}
+		slices.SortFunc(allPending, func(a, b storage.PendingProof) int { return strings.Compare(a.Y, b.Y) })
+
+		// order of proofs is not defined
+		for _, proofs := range [][]storage.DBProof{used, pending} {
+			slices.SortFunc(proofs, func(a, b storage.DBProof) int { return strings.Compare(a.Y, b.Y) })
+		}
+
+		return []any{
+			balance, err, seed, keysets, used, pending,
+			mintQuote, mintQuoteByHash, msatMintQuote, bolt12MintQuote, mintQuoteErr,
+			meltQuote, meltQuoteByHash, meltQuoteByRequest, msatMeltQuote, meltQuoteErr, pendingQuotes, unpaidQuotes,
+			supersededQuote, requoteByHash, requoteByRequest, replacedErr,
+			changeOutputs, noChangeOutputs,
+			blindSignature, blindSignatureErr, blindSignatures, byKeyset, otherKeyset,
+			issued, redeemed, keysetFees, unpaidMintQuotes, allPending,
+		}
+	}
+	sqliteResults := results(sqliteDB)
+	memResults := results(memDB)
+	for i := range sqliteResults {
+		if !reflect.DeepEqual(sqliteResults[i], memResults[i]) {
+			t.Fatalf("result %v from memory db does not match sqlite.\nexpected: %+v\n\ngot: %+v",
+				i, sqliteResults[i], memResults[i])
+		}
+	}
+
+	// msat quotes are added to the balance in sats and
+	// bolt12 quotes with the amount issued from them
+	if balance := sqliteResults[0].(uint64); balance != 280 {
+		t.Fatalf("expected balance of 280 but got %v", balance)
+	}
+
+	// the quote that superseded the other is returned for the payment
+	if quote, _ := sqliteDB.GetMeltQuoteByPaymentHash("hash7"); quote.Id != "melt5" {
+		t.Fatalf("expected quote 'melt5' for payment but got '%v'", quote.Id)
+	}
+	if quote, _ := sqliteDB.GetMeltQuote("melt4"); quote.SupersededBy != "melt5" {
+		t.Fatalf("expected quote to be superseded by 'melt5' but got '%v'", quote.SupersededBy)
+	}
+
+	if outputs, _ := sqliteDB.GetMeltChangeOutputs("melt1"); len(outputs) != 1 || outputs[0].B_ != "B_4" {
+		t.Fatalf("expected change outputs to be replaced but got %+v", outputs)
+	}
+
+	pendingByQuote, _ := memDB.GetPendingProofsByQuote("melt2")
+	if len(pendingByQuote) != 3 {
+		t.Fatalf("expected 3 pending proofs for quote but got %v", len(pendingByQuote))
+	}
+}
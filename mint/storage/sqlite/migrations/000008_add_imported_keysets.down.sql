@@ -0,0 +1,3 @@
+ALTER TABLE keysets DROP COLUMN derivation_path;
+ALTER TABLE keysets DROP COLUMN max_order;
+ALTER TABLE keysets DROP COLUMN verify_only;
@@ -0,0 +1,3 @@
+ALTER TABLE keysets ADD COLUMN derivation_path TEXT NOT NULL DEFAULT '';
+ALTER TABLE keysets ADD COLUMN max_order INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE keysets ADD COLUMN verify_only BOOLEAN NOT NULL DEFAULT FALSE;
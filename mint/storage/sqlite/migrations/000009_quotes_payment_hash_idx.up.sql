@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_mint_quotes_payment_hash ON mint_quotes(payment_hash);
+CREATE INDEX IF NOT EXISTS idx_melt_quotes_payment_hash ON melt_quotes(payment_hash);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_proofs_keyset;
+DROP INDEX IF EXISTS idx_blind_signatures_keyset;
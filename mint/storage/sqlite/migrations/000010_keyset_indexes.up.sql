@@ -0,0 +1,6 @@
+-- entries of a keyset are next to each other in these indexes so lookups and
+-- counts for one keyset do not go through the entries of all the keysets.
+-- Spent proofs are still looked up by y since a Y can only be spent once
+-- across all the keysets
+CREATE INDEX IF NOT EXISTS idx_proofs_keyset ON proofs(keyset_id, amount);
+CREATE INDEX IF NOT EXISTS idx_blind_signatures_keyset ON blind_signatures(keyset_id, b_);
@@ -0,0 +1,2 @@
+ALTER TABLE melt_quotes DROP COLUMN amount_msat;
+ALTER TABLE melt_quotes DROP COLUMN fee_reserve_msat;
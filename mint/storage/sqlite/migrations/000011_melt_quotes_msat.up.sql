@@ -0,0 +1,3 @@
+ALTER TABLE melt_quotes ADD COLUMN amount_msat INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE melt_quotes ADD COLUMN fee_reserve_msat INTEGER NOT NULL DEFAULT 0;
+UPDATE melt_quotes SET amount_msat = amount * 1000, fee_reserve_msat = fee_reserve * 1000;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS melt_change_outputs;
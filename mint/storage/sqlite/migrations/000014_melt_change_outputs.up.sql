@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS melt_change_outputs (
+	melt_quote_id TEXT NOT NULL,
+	b_ TEXT NOT NULL,
+	keyset_id TEXT NOT NULL,
+	idx INTEGER NOT NULL,
+	PRIMARY KEY (melt_quote_id, b_)
+);
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS keyset_fees (
+	keyset_id TEXT PRIMARY KEY,
+	fees INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1 @@
+ALTER TABLE pending_proofs DROP COLUMN pending_since;
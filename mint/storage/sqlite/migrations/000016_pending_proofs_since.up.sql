@@ -0,0 +1 @@
+ALTER TABLE pending_proofs ADD COLUMN pending_since INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1 @@
+ALTER TABLE melt_quotes ADD COLUMN superseded_by TEXT NOT NULL DEFAULT '';
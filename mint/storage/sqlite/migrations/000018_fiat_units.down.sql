@@ -0,0 +1,8 @@
+DROP VIEW IF EXISTS balance;
+DROP VIEW IF EXISTS minted_ecash;
+DROP VIEW IF EXISTS melted_ecash;
+CREATE VIEW IF NOT EXISTS minted_ecash (amount) AS SELECT COALESCE((SELECT SUM(CASE WHEN unit = 'msat' THEN amount / 1000 ELSE amount END) FROM mint_quotes WHERE state = 'ISSUED'), 0);
+CREATE VIEW IF NOT EXISTS melted_ecash (amount) AS SELECT COALESCE((SELECT SUM(CASE WHEN unit = 'msat' THEN (amount + 999) / 1000 ELSE amount END) FROM melt_quotes WHERE state = 'PAID'), 0);
+CREATE VIEW IF NOT EXISTS balance (balance) AS SELECT (SELECT amount FROM minted_ecash) - (SELECT amount FROM melted_ecash);
+
+ALTER TABLE mint_quotes DROP COLUMN amount_msat;
@@ -0,0 +1,10 @@
+ALTER TABLE mint_quotes ADD COLUMN method TEXT NOT NULL DEFAULT 'bolt11';
+ALTER TABLE mint_quotes ADD COLUMN amount_paid INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE mint_quotes ADD COLUMN amount_issued INTEGER NOT NULL DEFAULT 0;
+
+-- offers of bolt12 quotes can be paid and minted multiple
+-- times so what was minted from them is the amount issued
+DROP VIEW IF EXISTS balance;
+DROP VIEW IF EXISTS minted_ecash;
+CREATE VIEW IF NOT EXISTS minted_ecash (amount) AS SELECT COALESCE((SELECT SUM(CASE WHEN method = 'bolt12' THEN amount_issued WHEN state != 'ISSUED' THEN 0 WHEN unit = 'msat' THEN amount / 1000 WHEN unit IN ('usd', 'eur') THEN amount_msat / 1000 ELSE amount END) FROM mint_quotes), 0);
+CREATE VIEW IF NOT EXISTS balance (balance) AS SELECT (SELECT amount FROM minted_ecash) - (SELECT amount FROM melted_ecash);
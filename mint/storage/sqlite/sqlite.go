@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut04"
@@ -141,8 +142,10 @@ func (sqlite *SQLiteDB) GetSeed() ([]byte, error) {
 
 func (sqlite *SQLiteDB) SaveKeyset(keyset storage.DBKeyset) error {
 	_, err := sqlite.db.Exec(`
-		INSERT INTO keysets (id, unit, active, seed, derivation_path_idx, input_fee_ppk) VALUES (?, ?, ?, ?, ?, ?)
-	`, keyset.Id, keyset.Unit, keyset.Active, keyset.Seed, keyset.DerivationPathIdx, keyset.InputFeePpk)
+		INSERT INTO keysets (id, unit, active, seed, derivation_path_idx, input_fee_ppk, derivation_path, max_order, verify_only)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, keyset.Id, keyset.Unit, keyset.Active, keyset.Seed, keyset.DerivationPathIdx, keyset.InputFeePpk,
+		keyset.DerivationPath, keyset.MaxOrder, keyset.VerifyOnly)
 
 	return err
 }
@@ -150,7 +153,10 @@ func (sqlite *SQLiteDB) SaveKeyset(keyset storage.DBKeyset) error {
 func (sqlite *SQLiteDB) GetKeysets() ([]storage.DBKeyset, error) {
 	keysets := []storage.DBKeyset{}
 
-	rows, err := sqlite.db.Query("SELECT * FROM keysets")
+	rows, err := sqlite.db.Query(`
+		SELECT id, unit, active, seed, derivation_path_idx, input_fee_ppk, derivation_path, max_order, verify_only
+		FROM keysets
+	`)
 	if err != nil {
 		return nil, err
 	}
@@ -165,6 +171,9 @@ func (sqlite *SQLiteDB) GetKeysets() ([]storage.DBKeyset, error) {
 			&keyset.Seed,
 			&keyset.DerivationPathIdx,
 			&keyset.InputFeePpk,
+			&keyset.DerivationPath,
+			&keyset.MaxOrder,
+			&keyset.VerifyOnly,
 		)
 		if err != nil {
 			return nil, err
@@ -191,6 +200,39 @@ func (sqlite *SQLiteDB) UpdateKeysetActive(id string, active bool) error {
 	return nil
 }
 
+func (sqlite *SQLiteDB) RotateKeyset(newKeyset storage.DBKeyset, previousKeysetId string) error {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE keysets SET active = false WHERE id = ? AND active = true", previousKeysetId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count != 1 {
+		tx.Rollback()
+		return errors.New("previous keyset is not active")
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO keysets (id, unit, active, seed, derivation_path_idx, input_fee_ppk, derivation_path, max_order, verify_only)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, newKeyset.Id, newKeyset.Unit, newKeyset.Active, newKeyset.Seed, newKeyset.DerivationPathIdx,
+		newKeyset.InputFeePpk, newKeyset.DerivationPath, newKeyset.MaxOrder, newKeyset.VerifyOnly)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 func (sqlite *SQLiteDB) SaveProofs(proofs cashu.Proofs) error {
 	tx, err := sqlite.db.Begin()
 	if err != nil {
@@ -269,12 +311,14 @@ func (sqlite *SQLiteDB) AddPendingProofs(proofs cashu.Proofs, quoteId string) er
 		return err
 	}
 
-	stmt, err := tx.Prepare("INSERT INTO pending_proofs (y, amount, keyset_id, secret, c, witness, melt_quote_id) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	stmt, err := tx.Prepare(`INSERT INTO pending_proofs
+		(y, amount, keyset_id, secret, c, witness, melt_quote_id, pending_since) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
+	now := time.Now().Unix()
 	for _, proof := range proofs {
 		Y, err := crypto.HashToCurve([]byte(proof.Secret))
 		if err != nil {
@@ -282,7 +326,7 @@ func (sqlite *SQLiteDB) AddPendingProofs(proofs cashu.Proofs, quoteId string) er
 		}
 		Yhex := hex.EncodeToString(Y.SerializeCompressed())
 
-		if _, err := stmt.Exec(Yhex, proof.Amount, proof.Id, proof.Secret, proof.C, proof.Witness, quoteId); err != nil {
+		if _, err := stmt.Exec(Yhex, proof.Amount, proof.Id, proof.Secret, proof.C, proof.Witness, quoteId, now); err != nil {
 			tx.Rollback()
 			return err
 		}
@@ -297,7 +341,8 @@ func (sqlite *SQLiteDB) AddPendingProofs(proofs cashu.Proofs, quoteId string) er
 
 func (sqlite *SQLiteDB) GetPendingProofs(Ys []string) ([]storage.DBProof, error) {
 	proofs := []storage.DBProof{}
-	query := `SELECT * FROM pending_proofs WHERE y in (?` + strings.Repeat(",?", len(Ys)-1) + `)`
+	query := `SELECT y, amount, keyset_id, secret, c, melt_quote_id, witness FROM pending_proofs WHERE y in (?` +
+		strings.Repeat(",?", len(Ys)-1) + `)`
 
 	args := make([]any, len(Ys))
 	for i, y := range Ys {
@@ -373,6 +418,44 @@ func (sqlite *SQLiteDB) GetPendingProofsByQuote(quoteId string) ([]storage.DBPro
 	return proofs, nil
 }
 
+func (sqlite *SQLiteDB) GetAllPendingProofs() ([]storage.PendingProof, error) {
+	proofs := []storage.PendingProof{}
+	query := `SELECT y, amount, keyset_id, secret, c, melt_quote_id, witness, pending_since FROM pending_proofs`
+
+	rows, err := sqlite.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var proof storage.PendingProof
+		var witness sql.NullString
+
+		err := rows.Scan(
+			&proof.Y,
+			&proof.Amount,
+			&proof.Id,
+			&proof.Secret,
+			&proof.C,
+			&proof.MeltQuoteId,
+			&witness,
+			&proof.PendingSince,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if witness.Valid {
+			proof.Witness = witness.String
+		}
+
+		proofs = append(proofs, proof)
+	}
+
+	return proofs, rows.Err()
+}
+
 func (sqlite *SQLiteDB) RemovePendingProofs(Ys []string) error {
 	tx, err := sqlite.db.Begin()
 	if err != nil {
@@ -401,14 +484,21 @@ func (sqlite *SQLiteDB) RemovePendingProofs(Ys []string) error {
 
 func (sqlite *SQLiteDB) SaveMintQuote(mintQuote storage.MintQuote) error {
 	_, err := sqlite.db.Exec(
-		`INSERT INTO mint_quotes (id, payment_request, payment_hash, amount, state, expiry) 
-		VALUES (?, ?, ?, ?, ?, ?)`,
+		`INSERT INTO mint_quotes 
+		(id, payment_request, payment_hash, amount, state, expiry, pubkey, unit, amount_msat, method, amount_paid, amount_issued) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		mintQuote.Id,
 		mintQuote.PaymentRequest,
 		mintQuote.PaymentHash,
 		mintQuote.Amount,
 		mintQuote.State.String(),
 		mintQuote.Expiry,
+		mintQuote.Pubkey,
+		mintQuote.Unit,
+		mintQuote.AmountMsat,
+		mintQuote.Method,
+		mintQuote.AmountPaid,
+		mintQuote.AmountIssued,
 	)
 
 	return err
@@ -427,6 +517,12 @@ func (sqlite *SQLiteDB) GetMintQuote(quoteId string) (storage.MintQuote, error)
 		&mintQuote.Amount,
 		&state,
 		&mintQuote.Expiry,
+		&mintQuote.Pubkey,
+		&mintQuote.Unit,
+		&mintQuote.AmountMsat,
+		&mintQuote.Method,
+		&mintQuote.AmountPaid,
+		&mintQuote.AmountIssued,
 	)
 	if err != nil {
 		return storage.MintQuote{}, err
@@ -449,6 +545,12 @@ func (sqlite *SQLiteDB) GetMintQuoteByPaymentHash(paymentHash string) (storage.M
 		&mintQuote.Amount,
 		&state,
 		&mintQuote.Expiry,
+		&mintQuote.Pubkey,
+		&mintQuote.Unit,
+		&mintQuote.AmountMsat,
+		&mintQuote.Method,
+		&mintQuote.AmountPaid,
+		&mintQuote.AmountIssued,
 	)
 	if err != nil {
 		return storage.MintQuote{}, err
@@ -475,11 +577,66 @@ func (sqlite *SQLiteDB) UpdateMintQuoteState(quoteId string, state nut04.State)
 	return nil
 }
 
+func (sqlite *SQLiteDB) UpdateMintQuoteAmounts(quoteId string, amountPaid, amountIssued uint64) error {
+	result, err := sqlite.db.Exec(
+		"UPDATE mint_quotes SET amount_paid = ?, amount_issued = ? WHERE id = ?",
+		amountPaid, amountIssued, quoteId,
+	)
+	if err != nil {
+		return err
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if count != 1 {
+		return errors.New("mint quote was not updated")
+	}
+	return nil
+}
+
+func (sqlite *SQLiteDB) GetMintQuotesByState(state nut04.State) ([]storage.MintQuote, error) {
+	rows, err := sqlite.db.Query("SELECT * FROM mint_quotes WHERE state = ?", state.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mintQuotes []storage.MintQuote
+	for rows.Next() {
+		var mintQuote storage.MintQuote
+		var state string
+
+		err := rows.Scan(
+			&mintQuote.Id,
+			&mintQuote.PaymentRequest,
+			&mintQuote.PaymentHash,
+			&mintQuote.Amount,
+			&state,
+			&mintQuote.Expiry,
+			&mintQuote.Pubkey,
+			&mintQuote.Unit,
+			&mintQuote.AmountMsat,
+			&mintQuote.Method,
+			&mintQuote.AmountPaid,
+			&mintQuote.AmountIssued,
+		)
+		if err != nil {
+			return nil, err
+		}
+		mintQuote.State = nut04.StringToState(state)
+		mintQuotes = append(mintQuotes, mintQuote)
+	}
+
+	return mintQuotes, rows.Err()
+}
+
 func (sqlite *SQLiteDB) SaveMeltQuote(meltQuote storage.MeltQuote) error {
 	_, err := sqlite.db.Exec(`
 		INSERT INTO melt_quotes 
-		(id, request, payment_hash, amount, fee_reserve, state, expiry, preimage) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		(id, request, payment_hash, amount, fee_reserve, state, expiry, preimage, amount_msat, fee_reserve_msat, unit) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		meltQuote.Id,
 		meltQuote.InvoiceRequest,
 		meltQuote.PaymentHash,
@@ -488,6 +645,9 @@ func (sqlite *SQLiteDB) SaveMeltQuote(meltQuote storage.MeltQuote) error {
 		meltQuote.State.String(),
 		meltQuote.Expiry,
 		meltQuote.Preimage,
+		meltQuote.AmountMsat,
+		meltQuote.FeeReserveMsat,
+		meltQuote.Unit,
 	)
 
 	return err
@@ -508,6 +668,42 @@ func (sqlite *SQLiteDB) GetMeltQuote(quoteId string) (storage.MeltQuote, error)
 		&state,
 		&meltQuote.Expiry,
 		&meltQuote.Preimage,
+		&meltQuote.AmountMsat,
+		&meltQuote.FeeReserveMsat,
+		&meltQuote.Unit,
+		&meltQuote.SupersededBy,
+	)
+	if err != nil {
+		return storage.MeltQuote{}, err
+	}
+	meltQuote.State = nut05.StringToState(state)
+
+	return meltQuote, nil
+}
+
+func (sqlite *SQLiteDB) GetMeltQuoteByPaymentHash(paymentHash string) (storage.MeltQuote, error) {
+	// quotes that were superseded have the same payment hash as the one that replaced them
+	row := sqlite.db.QueryRow(
+		"SELECT * FROM melt_quotes WHERE payment_hash = ? ORDER BY superseded_by != '' LIMIT 1",
+		paymentHash,
+	)
+
+	var meltQuote storage.MeltQuote
+	var state string
+
+	err := row.Scan(
+		&meltQuote.Id,
+		&meltQuote.InvoiceRequest,
+		&meltQuote.PaymentHash,
+		&meltQuote.Amount,
+		&meltQuote.FeeReserve,
+		&state,
+		&meltQuote.Expiry,
+		&meltQuote.Preimage,
+		&meltQuote.AmountMsat,
+		&meltQuote.FeeReserveMsat,
+		&meltQuote.Unit,
+		&meltQuote.SupersededBy,
 	)
 	if err != nil {
 		return storage.MeltQuote{}, err
@@ -518,7 +714,10 @@ func (sqlite *SQLiteDB) GetMeltQuote(quoteId string) (storage.MeltQuote, error)
 }
 
 func (sqlite *SQLiteDB) GetMeltQuoteByPaymentRequest(invoice string) (*storage.MeltQuote, error) {
-	row := sqlite.db.QueryRow("SELECT * FROM melt_quotes WHERE request = ?", invoice)
+	row := sqlite.db.QueryRow(
+		"SELECT * FROM melt_quotes WHERE request = ? ORDER BY superseded_by != '' LIMIT 1",
+		invoice,
+	)
 
 	var meltQuote storage.MeltQuote
 	var state string
@@ -532,6 +731,10 @@ func (sqlite *SQLiteDB) GetMeltQuoteByPaymentRequest(invoice string) (*storage.M
 		&state,
 		&meltQuote.Expiry,
 		&meltQuote.Preimage,
+		&meltQuote.AmountMsat,
+		&meltQuote.FeeReserveMsat,
+		&meltQuote.Unit,
+		&meltQuote.SupersededBy,
 	)
 	if err != nil {
 		return nil, err
@@ -541,6 +744,42 @@ func (sqlite *SQLiteDB) GetMeltQuoteByPaymentRequest(invoice string) (*storage.M
 	return &meltQuote, nil
 }
 
+func (sqlite *SQLiteDB) GetMeltQuotesByState(state nut05.State) ([]storage.MeltQuote, error) {
+	rows, err := sqlite.db.Query("SELECT * FROM melt_quotes WHERE state = ?", state.String())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var meltQuotes []storage.MeltQuote
+	for rows.Next() {
+		var meltQuote storage.MeltQuote
+		var state string
+
+		err := rows.Scan(
+			&meltQuote.Id,
+			&meltQuote.InvoiceRequest,
+			&meltQuote.PaymentHash,
+			&meltQuote.Amount,
+			&meltQuote.FeeReserve,
+			&state,
+			&meltQuote.Expiry,
+			&meltQuote.Preimage,
+			&meltQuote.AmountMsat,
+			&meltQuote.FeeReserveMsat,
+			&meltQuote.Unit,
+			&meltQuote.SupersededBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		meltQuote.State = nut05.StringToState(state)
+		meltQuotes = append(meltQuotes, meltQuote)
+	}
+
+	return meltQuotes, rows.Err()
+}
+
 func (sqlite *SQLiteDB) UpdateMeltQuote(quoteId, preimage string, state nut05.State) error {
 	updatedState := state.String()
 	result, err := sqlite.db.Exec(
@@ -561,6 +800,103 @@ func (sqlite *SQLiteDB) UpdateMeltQuote(quoteId, preimage string, state nut05.St
 	return nil
 }
 
+func (sqlite *SQLiteDB) ReplaceMeltQuote(oldQuoteId string, newQuote storage.MeltQuote) error {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(
+		"UPDATE melt_quotes SET superseded_by = ? WHERE id = ? AND state = ? AND superseded_by = ''",
+		newQuote.Id, oldQuoteId, nut05.Unpaid.String(),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count != 1 {
+		tx.Rollback()
+		return errors.New("melt quote was not replaced")
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO melt_quotes 
+		(id, request, payment_hash, amount, fee_reserve, state, expiry, preimage, amount_msat, fee_reserve_msat, unit) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		newQuote.Id,
+		newQuote.InvoiceRequest,
+		newQuote.PaymentHash,
+		newQuote.Amount,
+		newQuote.FeeReserve,
+		newQuote.State.String(),
+		newQuote.Expiry,
+		newQuote.Preimage,
+		newQuote.AmountMsat,
+		newQuote.FeeReserveMsat,
+		newQuote.Unit,
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (sqlite *SQLiteDB) SaveMeltChangeOutputs(quoteId string, outputs cashu.BlindedMessages) error {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM melt_change_outputs WHERE melt_quote_id = ?", quoteId); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	stmt, err := tx.Prepare("INSERT INTO melt_change_outputs (melt_quote_id, b_, keyset_id, idx) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for i, output := range outputs {
+		if _, err := stmt.Exec(quoteId, output.B_, output.Id, i); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (sqlite *SQLiteDB) GetMeltChangeOutputs(quoteId string) (cashu.BlindedMessages, error) {
+	rows, err := sqlite.db.Query(
+		"SELECT b_, keyset_id FROM melt_change_outputs WHERE melt_quote_id = ? ORDER BY idx",
+		quoteId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	outputs := cashu.BlindedMessages{}
+	for rows.Next() {
+		var output cashu.BlindedMessage
+		if err := rows.Scan(&output.B_, &output.Id); err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, rows.Err()
+}
+
 func (sqlite *SQLiteDB) SaveBlindSignature(B_ string, blindSignature cashu.BlindedSignature) error {
 	_, err := sqlite.db.Exec(`
 		INSERT INTO blind_signatures (b_, c_, keyset_id, amount, e, s) VALUES (?, ?, ?, ?, ?, ?)`,
@@ -605,8 +941,31 @@ func (sqlite *SQLiteDB) GetBlindSignature(B_ string) (cashu.BlindedSignature, er
 }
 
 func (sqlite *SQLiteDB) GetBlindSignatures(B_s []string) (cashu.BlindedSignatures, error) {
+	query := `SELECT b_, amount, c_, keyset_id, e, s FROM blind_signatures WHERE b_ in (?` + strings.Repeat(",?", len(B_s)-1) + `)`
+	_, signatures, err := sqlite.queryBlindSignatures(query, B_s)
+	return signatures, err
+}
+
+func (sqlite *SQLiteDB) GetBlindSignaturesByKeyset(keysetId string, B_s []string) (map[string]cashu.BlindedSignature, error) {
+	// keyset_id goes first so the lookup uses the index over the keyset's signatures
+	query := `SELECT b_, amount, c_, keyset_id, e, s FROM blind_signatures WHERE keyset_id = ? AND b_ in (?` +
+		strings.Repeat(",?", len(B_s)-1) + `)`
+	signedB_s, signatures, err := sqlite.queryBlindSignatures(query, append([]string{keysetId}, B_s...))
+	if err != nil {
+		return nil, err
+	}
+
+	signed := make(map[string]cashu.BlindedSignature, len(signatures))
+	for i, signature := range signatures {
+		signed[signedB_s[i]] = signature
+	}
+	return signed, nil
+}
+
+// queryBlindSignatures returns the signatures and the B_ of each of them
+func (sqlite *SQLiteDB) queryBlindSignatures(query string, B_s []string) ([]string, cashu.BlindedSignatures, error) {
+	signedB_s := []string{}
 	signatures := cashu.BlindedSignatures{}
-	query := `SELECT amount, c_, keyset_id, e, s FROM blind_signatures WHERE b_ in (?` + strings.Repeat(",?", len(B_s)-1) + `)`
 
 	args := make([]any, len(B_s))
 	for i, B_ := range B_s {
@@ -615,16 +974,18 @@ func (sqlite *SQLiteDB) GetBlindSignatures(B_s []string) (cashu.BlindedSignature
 
 	rows, err := sqlite.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
+		var B_ string
 		var signature cashu.BlindedSignature
 		var e sql.NullString
 		var s sql.NullString
 
 		err := rows.Scan(
+			&B_,
 			&signature.Amount,
 			&signature.C_,
 			&signature.Id,
@@ -632,7 +993,7 @@ func (sqlite *SQLiteDB) GetBlindSignatures(B_s []string) (cashu.BlindedSignature
 			&s,
 		)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		if !e.Valid || !s.Valid {
@@ -644,8 +1005,80 @@ func (sqlite *SQLiteDB) GetBlindSignatures(B_s []string) (cashu.BlindedSignature
 			}
 		}
 
+		signedB_s = append(signedB_s, B_)
 		signatures = append(signatures, signature)
 	}
 
-	return signatures, nil
+	return signedB_s, signatures, nil
+}
+
+func (sqlite *SQLiteDB) GetIssuedDenominations() ([]storage.DenominationCount, error) {
+	return sqlite.getDenominations("blind_signatures")
+}
+
+func (sqlite *SQLiteDB) GetRedeemedDenominations() ([]storage.DenominationCount, error) {
+	return sqlite.getDenominations("proofs")
+}
+
+func (sqlite *SQLiteDB) AddKeysetFees(fees map[string]uint64) error {
+	tx, err := sqlite.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO keyset_fees (keyset_id, fees) VALUES (?, ?)
+		ON CONFLICT(keyset_id) DO UPDATE SET fees = fees + excluded.fees`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	for keysetId, keysetFees := range fees {
+		if _, err := stmt.Exec(keysetId, keysetFees); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (sqlite *SQLiteDB) GetKeysetFees() ([]storage.KeysetFees, error) {
+	rows, err := sqlite.db.Query("SELECT keyset_id, fees FROM keyset_fees ORDER BY keyset_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keysetFees := []storage.KeysetFees{}
+	for rows.Next() {
+		var fees storage.KeysetFees
+		if err := rows.Scan(&fees.KeysetId, &fees.Fees); err != nil {
+			return nil, err
+		}
+		keysetFees = append(keysetFees, fees)
+	}
+	return keysetFees, rows.Err()
+}
+
+func (sqlite *SQLiteDB) getDenominations(table string) ([]storage.DenominationCount, error) {
+	query := `SELECT keyset_id, amount, COUNT(*) FROM ` + table + ` GROUP BY keyset_id, amount`
+	rows, err := sqlite.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	denominations := []storage.DenominationCount{}
+	for rows.Next() {
+		var denomination storage.DenominationCount
+		if err := rows.Scan(&denomination.KeysetId, &denomination.Amount, &denomination.Count); err != nil {
+			return nil, err
+		}
+		denominations = append(denominations, denomination)
+	}
+
+	return denominations, rows.Err()
 }
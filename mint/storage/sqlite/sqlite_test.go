@@ -142,6 +142,19 @@ func TestPendingProofs(t *testing.T) {
 		t.Fatal("pending proofs from db do not match generated ones saved to db")
 	}
 
+	allPending, err := db.GetAllPendingProofs()
+	if err != nil {
+		t.Fatalf("error getting all pending proofs: %v", err)
+	}
+	if len(allPending) != 150 {
+		t.Fatalf("expected 150 pending proofs but got %v", len(allPending))
+	}
+	for _, proof := range allPending {
+		if proof.PendingSince == 0 {
+			t.Fatalf("expected time proof was set as pending for proof with Y '%v'", proof.Y)
+		}
+	}
+
 	if err := db.RemovePendingProofs(Ys); err != nil {
 		t.Fatalf("error deleting pending proofs: %v", err)
 	}
@@ -157,6 +170,46 @@ func TestPendingProofs(t *testing.T) {
 
 }
 
+func TestKeysets(t *testing.T) {
+	keyset := storage.DBKeyset{
+		Id:                "00" + generateRandomString(14),
+		Unit:              cashu.Sat.String(),
+		Active:            true,
+		Seed:              hex.EncodeToString([]byte(generateRandomString(32))),
+		DerivationPathIdx: 1,
+		InputFeePpk:       100,
+	}
+	importedKeyset := storage.DBKeyset{
+		Id:             generateRandomString(12),
+		Unit:           cashu.Sat.String(),
+		Seed:           hex.EncodeToString([]byte(generateRandomString(32))),
+		DerivationPath: "m/0'/0'/0'",
+		MaxOrder:       64,
+		VerifyOnly:     true,
+	}
+
+	if err := db.SaveKeyset(keyset); err != nil {
+		t.Fatalf("error saving keyset: %v", err)
+	}
+	if err := db.SaveKeyset(importedKeyset); err != nil {
+		t.Fatalf("error saving keyset: %v", err)
+	}
+
+	keysets, err := db.GetKeysets()
+	if err != nil {
+		t.Fatalf("error getting keysets: %v", err)
+	}
+	for _, expected := range []storage.DBKeyset{keyset, importedKeyset} {
+		idx := slices.IndexFunc(keysets, func(k storage.DBKeyset) bool { return k.Id == expected.Id })
+		if idx == -1 {
+			t.Fatalf("keyset '%v' not found in db", expected.Id)
+		}
+		if !reflect.DeepEqual(expected, keysets[idx]) {
+			t.Fatalf("expected keyset '%+v' but got '%+v'", expected, keysets[idx])
+		}
+	}
+}
+
 func TestMintQuotes(t *testing.T) {
 	mintQuotes := generateRandomMintQuotes(150)
 
@@ -274,6 +327,14 @@ func TestMeltQuote(t *testing.T) {
 		t.Fatal("quote from db does not match generated one")
 	}
 
+	quote, err = db.GetMeltQuoteByPaymentHash(expectedQuote.PaymentHash)
+	if err != nil {
+		t.Fatalf("error getting melt quote by payment hash: %v", err)
+	}
+	if !reflect.DeepEqual(expectedQuote, quote) {
+		t.Fatal("quote from db does not match generated one")
+	}
+
 	if err := db.UpdateMeltQuote(quote.Id, "", nut05.Pending); err != nil {
 		t.Fatalf("error updating melt quote: %v", err)
 	}
@@ -287,6 +348,14 @@ func TestMeltQuote(t *testing.T) {
 		t.Fatal("quote from db does not match generated one")
 	}
 
+	pendingQuotes, err := db.GetMeltQuotesByState(nut05.Pending)
+	if err != nil {
+		t.Fatalf("error getting pending melt quotes: %v", err)
+	}
+	if !slices.ContainsFunc(pendingQuotes, func(q storage.MeltQuote) bool { return q.Id == quote.Id }) {
+		t.Fatalf("expected quote '%v' in pending melt quotes", quote.Id)
+	}
+
 	if err := db.UpdateMeltQuote(quote.Id, "fakepreimage", nut05.Paid); err != nil {
 		t.Fatalf("error updating melt quote: %v", err)
 	}
@@ -352,6 +421,143 @@ func TestBlindSignatures(t *testing.T) {
 
 }
 
+func TestKeysetIndexes(t *testing.T) {
+	keysetIds := []string{"00" + generateRandomString(14), "00" + generateRandomString(14)}
+	for _, index := range []string{"idx_proofs_keyset", "idx_blind_signatures_keyset", "idx_proofs_y", "idx_blind_signatures_b"} {
+		var name string
+		row := db.db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'index' AND name = ?", index)
+		if err := row.Scan(&name); err != nil {
+			t.Fatalf("expected index '%v': %v", index, err)
+		}
+	}
+
+	// a Y is spent across all the keysets even if
+	// the same secret was signed by another keyset
+	proofs := generateRandomProofs(1)
+	proofs[0].Id = keysetIds[0]
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+	Y, _ := crypto.HashToCurve([]byte(proofs[0].Secret))
+	usedProofs, err := db.GetProofsUsed([]string{hex.EncodeToString(Y.SerializeCompressed())})
+	if err != nil {
+		t.Fatalf("error getting used proofs: %v", err)
+	}
+	if len(usedProofs) != 1 || usedProofs[0].Id != keysetIds[0] {
+		t.Fatalf("expected proof spent in keyset '%v' but got %+v", keysetIds[0], usedProofs)
+	}
+	proofs[0].Id = keysetIds[1]
+	if err := db.SaveProofs(proofs); err == nil {
+		t.Fatal("expected error saving proof already spent in another keyset")
+	}
+
+	B_s := generateRandomB_s(10)
+	blindSignatures := generateBlindSignatures(10)
+	for i := range B_s {
+		blindSignatures[i].Id = keysetIds[i%2]
+		if err := db.SaveBlindSignature(B_s[i], blindSignatures[i]); err != nil {
+			t.Fatalf("error saving blind signature: %v", err)
+		}
+	}
+	signed, err := db.GetBlindSignaturesByKeyset(keysetIds[1], B_s)
+	if err != nil {
+		t.Fatalf("error getting blind signatures: %v", err)
+	}
+	if len(signed) != 5 {
+		t.Fatalf("expected 5 signatures for keyset but got %v", len(signed))
+	}
+	for i := 1; i < len(B_s); i += 2 {
+		if !reflect.DeepEqual(signed[B_s[i]], blindSignatures[i]) {
+			t.Fatalf("expected signature '%+v' but got '%+v'", blindSignatures[i], signed[B_s[i]])
+		}
+	}
+}
+
+func TestDenominations(t *testing.T) {
+	keysetId := generateRandomString(16)
+	amounts := []uint64{1, 2, 2, 8, 8, 8}
+	for _, amount := range amounts {
+		sig := cashu.BlindedSignature{
+			Amount: amount,
+			Id:     keysetId,
+			C_:     generateRandomString(33),
+			DLEQ:   &cashu.DLEQProof{E: generateRandomString(33), S: generateRandomString(33)},
+		}
+		if err := db.SaveBlindSignature(generateRandomString(33), sig); err != nil {
+			t.Fatalf("error saving blind signature: %v", err)
+		}
+	}
+
+	proofs := cashu.Proofs{
+		{Amount: 2, Id: keysetId, Secret: generateRandomString(64), C: generateRandomString(64)},
+		{Amount: 8, Id: keysetId, Secret: generateRandomString(64), C: generateRandomString(64)},
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	issued, err := db.GetIssuedDenominations()
+	if err != nil {
+		t.Fatalf("error getting issued denominations: %v", err)
+	}
+	expectedIssued := []storage.DenominationCount{
+		{KeysetId: keysetId, Amount: 1, Count: 1},
+		{KeysetId: keysetId, Amount: 2, Count: 2},
+		{KeysetId: keysetId, Amount: 8, Count: 3},
+	}
+	if got := denominationsForKeyset(issued, keysetId); !reflect.DeepEqual(expectedIssued, got) {
+		t.Fatalf("expected issued denominations '%v' but got '%v'", expectedIssued, got)
+	}
+
+	redeemed, err := db.GetRedeemedDenominations()
+	if err != nil {
+		t.Fatalf("error getting redeemed denominations: %v", err)
+	}
+	expectedRedeemed := []storage.DenominationCount{
+		{KeysetId: keysetId, Amount: 2, Count: 1},
+		{KeysetId: keysetId, Amount: 8, Count: 1},
+	}
+	if got := denominationsForKeyset(redeemed, keysetId); !reflect.DeepEqual(expectedRedeemed, got) {
+		t.Fatalf("expected redeemed denominations '%v' but got '%v'", expectedRedeemed, got)
+	}
+}
+
+func TestKeysetFees(t *testing.T) {
+	keyset1 := generateRandomString(16)
+	keyset2 := generateRandomString(16)
+	if err := db.AddKeysetFees(map[string]uint64{keyset1: 1, keyset2: 4}); err != nil {
+		t.Fatalf("error adding keyset fees: %v", err)
+	}
+	if err := db.AddKeysetFees(map[string]uint64{keyset1: 2}); err != nil {
+		t.Fatalf("error adding keyset fees: %v", err)
+	}
+
+	keysetFees, err := db.GetKeysetFees()
+	if err != nil {
+		t.Fatalf("error getting keyset fees: %v", err)
+	}
+	fees := make(map[string]uint64)
+	for _, keysetFee := range keysetFees {
+		fees[keysetFee.KeysetId] = keysetFee.Fees
+	}
+	if fees[keyset1] != 3 || fees[keyset2] != 4 {
+		t.Fatalf("expected fees of 3 and 4 but got %v and %v", fees[keyset1], fees[keyset2])
+	}
+}
+
+func denominationsForKeyset(denominations []storage.DenominationCount, keysetId string) []storage.DenominationCount {
+	keysetDenominations := []storage.DenominationCount{}
+	for _, denomination := range denominations {
+		if denomination.KeysetId == keysetId {
+			keysetDenominations = append(keysetDenominations, denomination)
+		}
+	}
+	slices.SortFunc(keysetDenominations, func(a, b storage.DenominationCount) int {
+		return int(a.Amount) - int(b.Amount)
+	})
+	return keysetDenominations
+}
+
 func generateRandomString(length int) string {
 	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 	b := make([]byte, length)
@@ -404,6 +610,9 @@ func generateRandomMintQuotes(num int) []storage.MintQuote {
 			PaymentHash:    generateRandomString(50),
 			State:          nut04.Unpaid,
 		}
+		if i%2 == 1 {
+			quote.Pubkey = generateRandomString(66)
+		}
 		quotes[i] = quote
 	}
 	return quotes
@@ -418,6 +627,8 @@ func generateRandomMeltQuotes(num int) []storage.MeltQuote {
 			PaymentHash:    generateRandomString(50),
 			Amount:         21,
 			FeeReserve:     1,
+			AmountMsat:     20500,
+			FeeReserveMsat: 205,
 			State:          nut05.Unpaid,
 		}
 		quotes[i] = quote
@@ -15,28 +15,55 @@ type MintDB interface {
 	SaveKeyset(DBKeyset) error
 	GetKeysets() ([]DBKeyset, error)
 	UpdateKeysetActive(keysetId string, active bool) error
+	// saves the new active keyset and sets the previous one as inactive in
+	// the same transaction. It fails if the previous one is not active
+	RotateKeyset(newKeyset DBKeyset, previousKeysetId string) error
 
 	SaveProofs(cashu.Proofs) error
 	GetProofsUsed(Ys []string) ([]DBProof, error)
 	AddPendingProofs(proofs cashu.Proofs, quoteId string) error
 	GetPendingProofs(Ys []string) ([]DBProof, error)
 	GetPendingProofsByQuote(quoteId string) ([]DBProof, error)
+	// all the pending proofs with the time they were set as pending
+	GetAllPendingProofs() ([]PendingProof, error)
 	RemovePendingProofs(Ys []string) error
 
 	SaveMintQuote(MintQuote) error
 	GetMintQuote(string) (MintQuote, error)
 	GetMintQuoteByPaymentHash(string) (MintQuote, error)
 	UpdateMintQuoteState(quoteId string, state nut04.State) error
+	// updates what was paid to and minted from a bolt12 quote
+	UpdateMintQuoteAmounts(quoteId string, amountPaid, amountIssued uint64) error
+	GetMintQuotesByState(nut04.State) ([]MintQuote, error)
 
 	SaveMeltQuote(MeltQuote) error
 	GetMeltQuote(string) (MeltQuote, error)
 	// used to check if a melt quote already exists for the passed invoice
 	GetMeltQuoteByPaymentRequest(string) (*MeltQuote, error)
+	GetMeltQuoteByPaymentHash(string) (MeltQuote, error)
 	UpdateMeltQuote(quoteId string, preimage string, state nut05.State) error
+	GetMeltQuotesByState(nut05.State) ([]MeltQuote, error)
+	// saves the new quote and sets the old one as superseded by it in the same
+	// transaction. It fails if the old quote is not unpaid or already superseded
+	ReplaceMeltQuote(oldQuoteId string, newQuote MeltQuote) error
+	// outputs (NUT-08) sent to melt the quote to get the overpaid fees back.
+	// Saving replaces the outputs of a previous attempt to melt the quote
+	SaveMeltChangeOutputs(quoteId string, outputs cashu.BlindedMessages) error
+	GetMeltChangeOutputs(quoteId string) (cashu.BlindedMessages, error)
 
 	SaveBlindSignature(B_ string, blindSignature cashu.BlindedSignature) error
 	GetBlindSignature(B_ string) (cashu.BlindedSignature, error)
 	GetBlindSignatures(B_s []string) (cashu.BlindedSignatures, error)
+	// signatures of the keyset for the B_s that were signed, keyed by B_
+	GetBlindSignaturesByKeyset(keysetId string, B_s []string) (map[string]cashu.BlindedSignature, error)
+
+	// number of blind signatures issued and proofs redeemed by keyset and amount
+	GetIssuedDenominations() ([]DenominationCount, error)
+	GetRedeemedDenominations() ([]DenominationCount, error)
+
+	// adds the input fees collected in a transaction to the total of each keyset
+	AddKeysetFees(fees map[string]uint64) error
+	GetKeysetFees() ([]KeysetFees, error)
 
 	Close()
 }
@@ -48,6 +75,23 @@ type DBKeyset struct {
 	Seed              string
 	DerivationPathIdx uint32
 	InputFeePpk       uint
+	// set for keysets imported from other mint implementations
+	DerivationPath string
+	MaxOrder       int
+	VerifyOnly     bool
+}
+
+// DenominationCount is the number of proofs of an amount in a keyset
+type DenominationCount struct {
+	KeysetId string
+	Amount   uint64
+	Count    uint64
+}
+
+// KeysetFees is the total of input fees collected from proofs of the keyset
+type KeysetFees struct {
+	KeysetId string
+	Fees     uint64
 }
 
 type DBProof struct {
@@ -61,22 +105,58 @@ type DBProof struct {
 	MeltQuoteId string
 }
 
+// PendingProof is a proof in the pending table
+type PendingProof struct {
+	DBProof
+	// unix time the proof was set as pending. 0 for
+	// proofs that were pending before it was recorded
+	PendingSince int64
+}
+
 type MintQuote struct {
-	Id             string
-	Amount         uint64
+	Id     string
+	Amount uint64
+	// invoice or offer for bolt12 quotes
 	PaymentRequest string
-	PaymentHash    string
-	State          nut04.State
-	Expiry         uint64
+	// id of the offer for bolt12 quotes
+	PaymentHash string
+	State       nut04.State
+	Expiry      uint64
+	// NUT-20 pubkey (hex) that has to sign the mint request if set
+	Pubkey string
+	// unit of the amount. Empty is sat
+	Unit string
+	// amount of the invoice. Used for the balance of quotes in fiat units.
+	// It is 0 for quotes saved before it was recorded
+	AmountMsat uint64
+	// payment method of the quote. Empty is bolt11
+	Method string
+	// sum of the payments to the offer and of the amounts minted from
+	// it for bolt12 quotes, since offers can be paid multiple times
+	AmountPaid   uint64
+	AmountIssued uint64
 }
 
 type MeltQuote struct {
 	Id             string
 	InvoiceRequest string
 	PaymentHash    string
-	Amount         uint64
-	FeeReserve     uint64
+	// amount and fee reserve in the unit of the quote to show to wallets.
+	// For sat they are the msat amounts rounded up.
+	Amount     uint64
+	FeeReserve uint64
+	// amount to pay in the invoice and max fee for it
+	AmountMsat     uint64
+	FeeReserveMsat uint64
 	State          nut05.State
 	Expiry         uint64
 	Preimage       string
+	// unit of the amount. Empty is sat
+	Unit string
+	// id of the quote that replaced this one with a new fee reserve
+	// for the same payment. Superseded quotes can't be melted
+	SupersededBy string
+	// signatures for the change outputs of a paid quote. These are
+	// kept with the blind signatures and not saved with the quote
+	Change cashu.BlindedSignatures
 }
@@ -0,0 +1,23 @@
+package mint
+
+// Names of the sync points placed in the mint's critical sections.
+// In regular builds reaching a sync point is a no-op. When building with
+// the 'interleave' tag, tests can register hooks on them to pause a request
+// at that point and deterministically run other requests in between.
+const (
+	// reached in MintTokens after the quote has been read as paid
+	// and before the blinded messages are signed
+	syncMintQuotePaid = "mint_tokens:quote_paid"
+
+	// reached in GetMintQuoteState after the invoice was found settled
+	// and before the quote is updated to paid
+	syncMintQuoteInvoiceSettled = "mint_quote_state:invoice_settled"
+
+	// reached in Swap after the proofs have been verified
+	// and before they are invalidated
+	syncSwapProofsVerified = "swap:proofs_verified"
+
+	// reached in MeltTokens after the proofs have been verified
+	// and before they are set as pending
+	syncMeltProofsVerified = "melt_tokens:proofs_verified"
+)
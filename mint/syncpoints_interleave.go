@@ -0,0 +1,39 @@
+//go:build interleave
+
+package mint
+
+import "sync"
+
+var (
+	syncHooksMu sync.Mutex
+	syncHooks   = make(map[string]func())
+)
+
+// setSyncHook registers a hook that will be called every time
+// execution reaches the sync point with the given name.
+// Passing a nil hook removes it.
+func setSyncHook(name string, hook func()) {
+	syncHooksMu.Lock()
+	defer syncHooksMu.Unlock()
+	if hook == nil {
+		delete(syncHooks, name)
+		return
+	}
+	syncHooks[name] = hook
+}
+
+func resetSyncHooks() {
+	syncHooksMu.Lock()
+	defer syncHooksMu.Unlock()
+	syncHooks = make(map[string]func())
+}
+
+func syncPoint(name string) {
+	syncHooksMu.Lock()
+	hook := syncHooks[name]
+	syncHooksMu.Unlock()
+
+	if hook != nil {
+		hook()
+	}
+}
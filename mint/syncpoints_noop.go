@@ -0,0 +1,5 @@
+//go:build !interleave
+
+package mint
+
+func syncPoint(name string) {}
@@ -0,0 +1,157 @@
+package mint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+)
+
+// ExchangeRates gives the price of the fiat units of the mint to convert
+// the amounts of their quotes to and from the msat of the invoices.
+type ExchangeRates interface {
+	// MsatPerUnit returns the price in msat of 1 of the unit (i.e a cent for usd)
+	MsatPerUnit(unit cashu.Unit) (uint64, error)
+}
+
+// FixedExchangeRates are prices in msat per cent that do not change, i.e for tests
+type FixedExchangeRates map[cashu.Unit]uint64
+
+func (rates FixedExchangeRates) MsatPerUnit(unit cashu.Unit) (uint64, error) {
+	rate, ok := rates[unit]
+	if !ok || rate == 0 {
+		return 0, fmt.Errorf("no exchange rate for unit '%v'", unit)
+	}
+	return rate, nil
+}
+
+const coinbaseRatesURL = "https://api.coinbase.com/v2/exchange-rates?currency=BTC"
+
+// CoinbaseExchangeRates gets the price of bitcoin from the Coinbase API.
+// Prices are cached for a minute so quotes do not wait on a request each time.
+type CoinbaseExchangeRates struct {
+	// URL of the API. Defaults to the Coinbase exchange rates for BTC
+	URL    string
+	Client *http.Client
+
+	mu        sync.Mutex
+	rates     map[cashu.Unit]uint64
+	fetchedAt time.Time
+}
+
+func (cb *CoinbaseExchangeRates) MsatPerUnit(unit cashu.Unit) (uint64, error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if time.Since(cb.fetchedAt) > time.Minute {
+		rates, err := cb.fetchRates()
+		if err != nil {
+			return 0, err
+		}
+		cb.rates = rates
+		cb.fetchedAt = time.Now()
+	}
+	rate, ok := cb.rates[unit]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for unit '%v'", unit)
+	}
+	return rate, nil
+}
+
+func (cb *CoinbaseExchangeRates) fetchRates() (map[cashu.Unit]uint64, error) {
+	url := cb.URL
+	if len(url) == 0 {
+		url = coinbaseRatesURL
+	}
+	client := cb.Client
+	if client == nil {
+		client = &http.Client{Timeout: time.Second * 10}
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("exchange rates request failed with status %v", resp.StatusCode)
+	}
+
+	var ratesResponse struct {
+		Data struct {
+			Rates map[string]string `json:"rates"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ratesResponse); err != nil {
+		return nil, fmt.Errorf("invalid exchange rates response: %v", err)
+	}
+
+	rates := make(map[cashu.Unit]uint64)
+	for _, unit := range []cashu.Unit{cashu.Usd, cashu.Eur} {
+		price, err := strconv.ParseFloat(ratesResponse.Data.Rates[strings.ToUpper(unit.String())], 64)
+		if err != nil || price <= 0 {
+			continue
+		}
+		// price is per bitcoin (1e11 msat) in whole units (100 cents)
+		rates[unit] = uint64(math.Round(1e9 / price))
+	}
+	if len(rates) == 0 {
+		return nil, errors.New("no exchange rates in response")
+	}
+	return rates, nil
+}
+
+// unitToMsat converts the amount in the unit to msat
+func (m *Mint) unitToMsat(unit string, amount uint64) (uint64, error) {
+	switch quoteUnit(unit) {
+	case cashu.Sat.String():
+		return cashu.CheckedMul(amount, 1000)
+	case cashu.Msat.String():
+		return amount, nil
+	}
+	rate, err := m.msatPerUnit(unit)
+	if err != nil {
+		return 0, err
+	}
+	return cashu.CheckedMul(amount, rate)
+}
+
+// msatToUnit converts the msat amount to the unit rounding
+// up so that the amount in the unit covers what the mint pays
+func (m *Mint) msatToUnit(unit string, msat uint64) (uint64, error) {
+	switch quoteUnit(unit) {
+	case cashu.Sat.String():
+		return msatToSat(msat), nil
+	case cashu.Msat.String():
+		return msat, nil
+	}
+	rate, err := m.msatPerUnit(unit)
+	if err != nil {
+		return 0, err
+	}
+	amount := msat / rate
+	if msat%rate != 0 {
+		amount++
+	}
+	return amount, nil
+}
+
+func (m *Mint) msatPerUnit(unit string) (uint64, error) {
+	fiatUnit, err := cashu.UnitFromString(unit)
+	if err != nil || m.exchangeRates == nil {
+		return 0, cashu.ExchangeRateUnavailableErr
+	}
+	rate, err := m.exchangeRates.MsatPerUnit(fiatUnit)
+	if err != nil || rate == 0 {
+		m.logErrorf("could not get exchange rate for unit '%v': %v", unit, err)
+		return 0, cashu.ExchangeRateUnavailableErr
+	}
+	return rate, nil
+}
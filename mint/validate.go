@@ -0,0 +1,311 @@
+package mint
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut09"
+	"github.com/elnosh/gonuts/cashu/nuts/nut25"
+)
+
+// Limits on the fields of requests. They are well above what valid
+// requests need so that they only reject garbage before it reaches
+// the mint, i.e a secret with many pubkeys in its tags. Witnesses are
+// checked against the witness limits in the config of the mint.
+const (
+	maxSecretLength  = 4096
+	maxQuoteIdLength = 128
+	maxUnitLength    = 16
+	// bolt11 invoices with route hints can be long
+	maxPaymentRequestLength = 8192
+	// v2 keyset ids are 33 bytes in hex
+	maxKeysetIdLength = 66
+	// descriptions in invoices and offers are short memos
+	maxDescriptionLength = 639
+)
+
+var keysetIdRegex = regexp.MustCompile(`^[A-Za-z0-9+/=]+$`)
+
+func invalidFieldErr(field, format string, args ...any) *cashu.Error {
+	msg := fmt.Sprintf("invalid %v: %v", field, fmt.Sprintf(format, args...))
+	return cashu.BuildCashuError(msg, cashu.StandardErrCode)
+}
+
+func validateMintQuoteRequest(request nut04.PostMintQuoteBolt11Request) error {
+	if request.Amount == 0 {
+		return invalidFieldErr("amount", "has to be greater than 0")
+	}
+	if err := validateUnit(request.Unit); err != nil {
+		return err
+	}
+	if len(request.Description) > maxDescriptionLength {
+		return invalidFieldErr("description", "longer than %v characters", maxDescriptionLength)
+	}
+	if len(request.Pubkey) > 0 {
+		return validatePoint("pubkey", request.Pubkey)
+	}
+	return nil
+}
+
+func validateMintRequest(request nut04.PostMintBolt11Request) error {
+	if err := validateQuoteId(request.Quote); err != nil {
+		return err
+	}
+	if len(request.Signature) > 0 {
+		if err := validateHex("signature", request.Signature, 64); err != nil {
+			return err
+		}
+	}
+	return validateBlindedMessages(request.Outputs, true)
+}
+
+func validateMintQuoteBolt12Request(request nut25.PostMintQuoteBolt12Request) error {
+	if err := validateUnit(request.Unit); err != nil {
+		return err
+	}
+	if len(request.Description) > maxDescriptionLength {
+		return invalidFieldErr("description", "longer than %v characters", maxDescriptionLength)
+	}
+	if len(request.Pubkey) == 0 {
+		return invalidFieldErr("pubkey", "pubkey is required")
+	}
+	return validatePoint("pubkey", request.Pubkey)
+}
+
+func validateMintBolt12Request(request nut25.PostMintBolt12Request) error {
+	if err := validateQuoteId(request.Quote); err != nil {
+		return err
+	}
+	if err := validateHex("signature", request.Signature, 64); err != nil {
+		return err
+	}
+	return validateBlindedMessages(request.Outputs, true)
+}
+
+func validateSwapRequest(inputs cashu.Proofs, outputs cashu.BlindedMessages) error {
+	if err := validateProofs(inputs); err != nil {
+		return err
+	}
+	return validateBlindedMessages(outputs, true)
+}
+
+func validateMeltQuoteRequest(request nut05.PostMeltQuoteBolt11Request) error {
+	if len(request.Request) == 0 {
+		return invalidFieldErr("request", "payment request is required")
+	}
+	if len(request.Request) > maxPaymentRequestLength {
+		return invalidFieldErr("request", "longer than %v characters", maxPaymentRequestLength)
+	}
+	if err := validateUnit(request.Unit); err != nil {
+		return err
+	}
+	if request.Options != nil && request.Options.Mpp != nil && request.Options.Mpp.Amount == 0 {
+		return invalidFieldErr("mpp amount", "has to be greater than 0")
+	}
+	return nil
+}
+
+func (ms *MintServer) validateMeltRequest(request nut05.PostMeltBolt11Request) error {
+	if err := validateQuoteId(request.Quote); err != nil {
+		return err
+	}
+	if err := ms.validateItems("inputs", len(request.Inputs)); err != nil {
+		return err
+	}
+	if err := ms.validateItems("outputs", len(request.Outputs)); err != nil {
+		return err
+	}
+	if err := validateProofs(request.Inputs); err != nil {
+		return err
+	}
+	// amounts of blank outputs (NUT-08) are set by the mint
+	return validateBlindedMessages(request.Outputs, false)
+}
+
+func (ms *MintServer) validateCheckStateRequest(request nut07.PostCheckStateRequest) error {
+	if err := ms.validateItems("Ys", len(request.Ys)); err != nil {
+		return err
+	}
+	for _, Y := range request.Ys {
+		if err := validatePoint("Y", Y); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *MintServer) validateRestoreRequest(request nut09.PostRestoreRequest) error {
+	if err := ms.validateItems("outputs", len(request.Outputs)); err != nil {
+		return err
+	}
+	// outputs to restore do not need an amount
+	return validateBlindedMessages(request.Outputs, false)
+}
+
+// validateItems checks the number of items in requests that are not decoded
+// as a stream. Those are limited when decoding.
+func (ms *MintServer) validateItems(field string, count int) error {
+	if ms.maxRequestItems > 0 && count > ms.maxRequestItems {
+		return invalidFieldErr(field, "more than %v items", ms.maxRequestItems)
+	}
+	return nil
+}
+
+func validateProofs(proofs cashu.Proofs) error {
+	for _, proof := range proofs {
+		if err := validateAmount(proof.Amount); err != nil {
+			return err
+		}
+		if err := validateKeysetId(proof.Id); err != nil {
+			return err
+		}
+		if len(proof.Secret) == 0 {
+			return invalidFieldErr("secret", "secret is required")
+		}
+		if len(proof.Secret) > maxSecretLength {
+			return invalidFieldErr("secret", "longer than %v characters", maxSecretLength)
+		}
+		if err := validatePoint("C", proof.C); err != nil {
+			return err
+		}
+		if err := validateWitness(proof.Witness); err != nil {
+			return err
+		}
+		if proof.DLEQ != nil {
+			if err := validateHex("dleq e", proof.DLEQ.E, 32); err != nil {
+				return err
+			}
+			if err := validateHex("dleq s", proof.DLEQ.S, 32); err != nil {
+				return err
+			}
+			if len(proof.DLEQ.R) > 0 {
+				if err := validateHex("dleq r", proof.DLEQ.R, 32); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateBlindedMessages checks the blinded messages. If checkAmount is
+// false, amounts are not checked since they are not needed.
+func validateBlindedMessages(blindedMessages cashu.BlindedMessages, checkAmount bool) error {
+	for _, bm := range blindedMessages {
+		if checkAmount {
+			if err := validateAmount(bm.Amount); err != nil {
+				return err
+			}
+		}
+		if err := validateKeysetId(bm.Id); err != nil {
+			return err
+		}
+		if err := validatePoint("B_", bm.B_); err != nil {
+			return err
+		}
+		if err := validateWitness(bm.Witness); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateAmount checks that the amount can be signed by a keyset
+func validateAmount(amount uint64) error {
+	if amount == 0 || amount&(amount-1) != 0 {
+		return invalidFieldErr("amount", "%v is not a power of 2", amount)
+	}
+	return nil
+}
+
+func validateKeysetId(id string) error {
+	if len(id) == 0 || len(id) > maxKeysetIdLength || !keysetIdRegex.MatchString(id) {
+		return invalidFieldErr("keyset id", "'%.66v' is not a keyset id", id)
+	}
+	return nil
+}
+
+func validateWitness(witness string) error {
+	if len(witness) == 0 {
+		return nil
+	}
+	if !json.Valid([]byte(witness)) {
+		return invalidFieldErr("witness", "not valid json")
+	}
+	return nil
+}
+
+func validateQuoteId(quoteId string) error {
+	if len(quoteId) == 0 {
+		return invalidFieldErr("quote", "quote id is required")
+	}
+	if len(quoteId) > maxQuoteIdLength {
+		return invalidFieldErr("quote", "longer than %v characters", maxQuoteIdLength)
+	}
+	return nil
+}
+
+func validateUnit(unit string) error {
+	if len(unit) == 0 {
+		return invalidFieldErr("unit", "unit is required")
+	}
+	if len(unit) > maxUnitLength {
+		return invalidFieldErr("unit", "longer than %v characters", maxUnitLength)
+	}
+	return nil
+}
+
+// validatePoint checks that the field is a compressed public key in hex
+func validatePoint(field, point string) error {
+	if err := validateHex(field, point, 33); err != nil {
+		return err
+	}
+	if point[:2] != "02" && point[:2] != "03" {
+		return invalidFieldErr(field, "not a compressed public key")
+	}
+	return nil
+}
+
+// validateHex checks that the field is hex for the number of bytes
+func validateHex(field, value string, size int) error {
+	if len(value) != size*2 {
+		return invalidFieldErr(field, "expected %v hex characters but got %v", size*2, len(value))
+	}
+	if _, err := hex.DecodeString(value); err != nil {
+		return invalidFieldErr(field, "not hex")
+	}
+	return nil
+}
+
+// sanitizeDescription removes the control and formatting characters (i.e
+// bidi overrides) from the description of a quote request and collapses the
+// whitespace so that it is shown as a single line by the wallet paying the
+// invoice. The description has to fit in the invoice after sanitizing it.
+func sanitizeDescription(description string) (string, error) {
+	if !utf8.ValidString(description) {
+		return "", invalidFieldErr("description", "not valid UTF-8")
+	}
+	description = strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Cf, r) {
+			return -1
+		}
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, description)
+	description = strings.Join(strings.Fields(description), " ")
+	if len(description) > maxDescriptionLength {
+		return "", invalidFieldErr("description", "longer than %v characters", maxDescriptionLength)
+	}
+	return description, nil
+}
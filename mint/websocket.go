@@ -0,0 +1,376 @@
+package mint
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+	"github.com/gorilla/websocket"
+)
+
+// JSON-RPC error codes of the responses to websocket requests
+const (
+	wsParseErr          = -32700
+	wsInvalidRequestErr = -32600
+	wsMethodNotFoundErr = -32601
+	wsInvalidParamsErr  = -32602
+)
+
+const (
+	// max number of subscriptions open in a websocket connection
+	maxWsSubscriptions = 100
+	// notifications waiting to be written to a connection. The
+	// connection is closed if the client does not read them
+	wsSendBuffer = 256
+	wsWriteWait  = 10 * time.Second
+)
+
+// subscription kinds the mint can notify of
+var supportedSubscriptions = []nut17.SubscriptionKind{nut17.Bolt11MintQuote, nut17.Bolt11MeltQuote, nut17.ProofState}
+
+// topic prefixes of the notifications for each subscription kind
+var subscriptionTopics = map[nut17.SubscriptionKind]string{
+	nut17.Bolt11MintQuote: MINT_QUOTE_TOPIC,
+	nut17.Bolt11MeltQuote: MELT_QUOTE_TOPIC,
+	nut17.ProofState:      PROOF_STATE_TOPIC,
+}
+
+var wsUpgrader = websocket.Upgrader{
+	// subscriptions only read state, which can be read from any origin
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// wsConn is a websocket connection of a client with its subscriptions.
+// Subscriptions are only changed by the goroutine reading the requests.
+type wsConn struct {
+	ms            *MintServer
+	conn          *websocket.Conn
+	subscriptions map[string]*subscriber
+	// opened with the admin token so it can subscribe with wildcards
+	admin bool
+
+	// guards the send channel, which is closed with the connection
+	mu     sync.Mutex
+	send   chan []byte
+	closed bool
+}
+
+// websocketHandler serves the subscriptions to changes
+// in the state of mint quotes, melt quotes and proofs (NUT-17)
+func (ms *MintServer) websocketHandler(rw http.ResponseWriter, req *http.Request) {
+	admin := false
+	if authorization := req.Header.Get("Authorization"); len(authorization) > 0 {
+		if !ms.isWsAdmin(authorization) {
+			ms.writeErr(rw, req, cashu.BuildCashuError("invalid admin token", cashu.StandardErrCode))
+			return
+		}
+		admin = true
+	}
+
+	conn, err := wsUpgrader.Upgrade(rw, req, nil)
+	if err != nil {
+		// upgrader already wrote the error response
+		ms.mint.logDebugf("could not upgrade websocket connection: %v", err)
+		return
+	}
+
+	wc := &wsConn{
+		ms:            ms,
+		conn:          conn,
+		send:          make(chan []byte, wsSendBuffer),
+		subscriptions: make(map[string]*subscriber),
+		admin:         admin,
+	}
+	go wc.writeLoop()
+	wc.readLoop()
+}
+
+// isWsAdmin returns whether the Authorization header
+// has the admin token to subscribe with wildcards
+func (ms *MintServer) isWsAdmin(authorization string) bool {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	return ok && len(ms.wsAdminToken) > 0 &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(ms.wsAdminToken)) == 1
+}
+
+func (wc *wsConn) readLoop() {
+	defer wc.close()
+	wc.conn.SetReadLimit(wc.ms.maxRequestSize)
+
+	for {
+		_, message, err := wc.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var request nut17.WsRequest
+		if err := json.Unmarshal(message, &request); err != nil {
+			wc.writeError(0, wsParseErr, "invalid request")
+			continue
+		}
+		if request.JSONRPC != nut17.JSONRPC {
+			wc.writeError(request.Id, wsInvalidRequestErr, "invalid jsonrpc version")
+			continue
+		}
+
+		switch request.Method {
+		case nut17.Subscribe:
+			wc.subscribe(request)
+		case nut17.Unsubscribe:
+			wc.unsubscribe(request)
+		default:
+			wc.writeError(request.Id, wsMethodNotFoundErr, fmt.Sprintf("method '%v' not found", request.Method))
+		}
+	}
+}
+
+// writeLoop writes the responses and notifications to the connection
+// so that they are never written concurrently
+func (wc *wsConn) writeLoop() {
+	for message := range wc.send {
+		wc.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := wc.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			wc.conn.Close()
+			return
+		}
+	}
+	wc.conn.WriteControl(websocket.CloseMessage, []byte{}, time.Now().Add(wsWriteWait))
+	wc.conn.Close()
+}
+
+func (wc *wsConn) subscribe(request nut17.WsRequest) {
+	params := request.Params
+	if !slices.Contains(supportedSubscriptions, params.Kind) {
+		wc.writeError(request.Id, wsInvalidParamsErr, fmt.Sprintf("subscription kind '%v' not supported", params.Kind))
+		return
+	}
+	if len(params.SubId) == 0 {
+		wc.writeError(request.Id, wsInvalidParamsErr, "subId cannot be empty")
+		return
+	}
+	if len(params.Filters) == 0 || len(params.Filters) > wc.ms.maxRequestItems {
+		wc.writeError(request.Id, wsInvalidParamsErr,
+			fmt.Sprintf("number of filters must be between 1 and %v", wc.ms.maxRequestItems))
+		return
+	}
+	wildcard := slices.Contains(params.Filters, WILDCARD_FILTER)
+	if wildcard {
+		if !wc.admin {
+			wc.writeError(request.Id, wsInvalidParamsErr, "wildcard subscriptions are only allowed for operators")
+			return
+		}
+		if len(params.Filters) > 1 {
+			wc.writeError(request.Id, wsInvalidParamsErr, "wildcard filter cannot be combined with other filters")
+			return
+		}
+	} else if err := validateFilters(params.Kind, params.Filters); err != nil {
+		wc.writeError(request.Id, wsInvalidParamsErr, err.Error())
+		return
+	}
+
+	topics := make([]string, len(params.Filters))
+	for i, filter := range params.Filters {
+		topics[i] = subscriptionTopics[params.Kind] + filter
+	}
+
+	if _, ok := wc.subscriptions[params.SubId]; ok {
+		wc.writeError(request.Id, wsInvalidParamsErr, fmt.Sprintf("subId '%v' already exists", params.SubId))
+		return
+	}
+	if len(wc.subscriptions) >= maxWsSubscriptions {
+		wc.writeError(request.Id, wsInvalidParamsErr, "too many subscriptions")
+		return
+	}
+	wc.subscriptions[params.SubId] = wc.ms.mint.pubsub.subscribe(topics, func(payload []byte) {
+		wc.notify(params.SubId, payload)
+	})
+
+	wc.writeResult(request.Id, params.SubId)
+	if wildcard {
+		return
+	}
+
+	// send the current state so that changes before
+	// the subscription was open are not missed
+	switch params.Kind {
+	case nut17.Bolt11MintQuote:
+		wc.notifyMintQuotes(params.SubId, params.Filters)
+	case nut17.Bolt11MeltQuote:
+		wc.notifyMeltQuotes(params.SubId, params.Filters)
+	case nut17.ProofState:
+		wc.notifyProofStates(params.SubId, params.Filters)
+	}
+}
+
+// validateFilters checks that the filters are valid Ys of proofs
+// or quote ids depending on the kind of the subscription
+func validateFilters(kind nut17.SubscriptionKind, filters []string) error {
+	seen := make(map[string]struct{}, len(filters))
+	for i, filter := range filters {
+		if _, ok := seen[filter]; ok {
+			return fmt.Errorf("duplicate filter '%v' at index %v", filter, i)
+		}
+		seen[filter] = struct{}{}
+
+		switch kind {
+		case nut17.ProofState:
+			Y, err := hex.DecodeString(filter)
+			if err != nil {
+				return fmt.Errorf("invalid filter '%v' at index %v: Y is not a hex string", filter, i)
+			}
+			if _, err := secp256k1.ParsePubKey(Y); err != nil {
+				return fmt.Errorf("invalid filter '%v' at index %v: Y is not a valid public key", filter, i)
+			}
+		case nut17.Bolt11MintQuote, nut17.Bolt11MeltQuote:
+			quoteId, err := hex.DecodeString(filter)
+			if err != nil || len(quoteId) != 32 {
+				return fmt.Errorf("invalid filter '%v' at index %v: not a valid quote id", filter, i)
+			}
+		}
+	}
+	return nil
+}
+
+func (wc *wsConn) notifyProofStates(subId string, Ys []string) {
+	states, err := wc.ms.mint.ProofsStateCheck(Ys)
+	if err != nil {
+		wc.ms.mint.logErrorf("could not get state of proofs for subscription: %v", err)
+		return
+	}
+	for _, state := range states {
+		payload, err := json.Marshal(&state)
+		if err != nil {
+			continue
+		}
+		wc.notify(subId, payload)
+	}
+}
+
+// notifyMintQuotes sends the state of the mint quotes saved in the db
+// and starts checking the invoices of the unpaid ones so that
+// the subscribers are notified when they are paid
+func (wc *wsConn) notifyMintQuotes(subId string, quoteIds []string) {
+	for _, quoteId := range quoteIds {
+		mintQuote, err := wc.ms.mint.db.GetMintQuote(quoteId)
+		if err != nil {
+			// quotes that do not exist are not notified
+			continue
+		}
+		if mintQuote.State == nut04.Unpaid {
+			go wc.ms.mint.watchMintQuote(mintQuote.Id)
+		}
+		payload, err := json.Marshal(mintQuoteNotification(mintQuote))
+		if err != nil {
+			continue
+		}
+		wc.notify(subId, payload)
+	}
+}
+
+// notifyMeltQuotes sends the state of the melt quotes saved in the db.
+// Pending payments are not checked with the lightning backend here,
+// the subscribers are notified when they are checked.
+func (wc *wsConn) notifyMeltQuotes(subId string, quoteIds []string) {
+	for _, quoteId := range quoteIds {
+		meltQuote, err := wc.ms.mint.db.GetMeltQuote(quoteId)
+		if err != nil {
+			// quotes that do not exist are not notified
+			continue
+		}
+		if meltQuote.State == nut05.Paid {
+			meltQuote.Change, err = wc.ms.mint.meltChange(meltQuote.Id)
+			if err != nil {
+				wc.ms.mint.logErrorf("could not get change of melt quote for subscription: %v", err)
+			}
+		}
+		payload, err := json.Marshal(meltQuoteNotification(meltQuote))
+		if err != nil {
+			continue
+		}
+		wc.notify(subId, payload)
+	}
+}
+
+func (wc *wsConn) unsubscribe(request nut17.WsRequest) {
+	subId := request.Params.SubId
+	sub, ok := wc.subscriptions[subId]
+	if !ok {
+		wc.writeError(request.Id, wsInvalidParamsErr, fmt.Sprintf("subscription '%v' not found", subId))
+		return
+	}
+	wc.ms.mint.pubsub.unsubscribe(sub)
+	delete(wc.subscriptions, subId)
+	wc.writeResult(request.Id, subId)
+}
+
+func (wc *wsConn) notify(subId string, payload []byte) {
+	notification := nut17.WsNotification{
+		JSONRPC: nut17.JSONRPC,
+		Method:  nut17.Subscribe,
+		Params:  nut17.NotificationParams{SubId: subId, Payload: payload},
+	}
+	wc.write(notification)
+}
+
+func (wc *wsConn) writeResult(id int, subId string) {
+	wc.write(nut17.WsResponse{
+		JSONRPC: nut17.JSONRPC,
+		Result:  &nut17.Result{Status: "OK", SubId: subId},
+		Id:      id,
+	})
+}
+
+func (wc *wsConn) writeError(id int, code int, message string) {
+	wc.write(nut17.WsResponse{
+		JSONRPC: nut17.JSONRPC,
+		Error:   &nut17.ResponseError{Code: code, Message: message},
+		Id:      id,
+	})
+}
+
+// write queues the message to be written to the connection. If the
+// client is not reading its messages, the connection is closed
+// instead of blocking the mint while publishing. The subscriptions
+// are removed once the read loop returns from the closed connection.
+func (wc *wsConn) write(message any) {
+	jsonMessage, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	if wc.closed {
+		return
+	}
+	select {
+	case wc.send <- jsonMessage:
+	default:
+		wc.ms.mint.logDebugf("closing websocket connection that is not reading its notifications")
+		wc.conn.Close()
+	}
+}
+
+// close removes the subscriptions and stops the write loop
+func (wc *wsConn) close() {
+	for _, sub := range wc.subscriptions {
+		wc.ms.mint.pubsub.unsubscribe(sub)
+	}
+	wc.subscriptions = nil
+
+	wc.mu.Lock()
+	defer wc.mu.Unlock()
+	wc.closed = true
+	close(wc.send)
+}
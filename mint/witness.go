@@ -0,0 +1,36 @@
+package mint
+
+import "github.com/elnosh/gonuts/cashu/nuts/nut11"
+
+const (
+	// DefaultMaxWitnessSize is the default max size in bytes of the
+	// witness of a proof or of a blinded message
+	DefaultMaxWitnessSize = 8 * 1024
+	// DefaultMaxWitnessSignatures is the default max number of
+	// signatures in the witness of a proof or of a blinded message
+	DefaultMaxWitnessSignatures = 32
+)
+
+// witnessLimits bound the witnesses checked so that a request with
+// huge witnesses or thousands of signatures can't use up the CPU
+// of the mint verifying them
+type witnessLimits struct {
+	maxSize       int
+	maxSignatures int
+}
+
+// checkSize is done before parsing the witness
+func (limits witnessLimits) checkSize(witness string) error {
+	if len(witness) > limits.maxSize {
+		return nut11.WitnessTooLargeErr
+	}
+	return nil
+}
+
+// checkSignatures is done before verifying any of the signatures
+func (limits witnessLimits) checkSignatures(signatures []string) error {
+	if len(signatures) > limits.maxSignatures {
+		return nut11.TooManySignaturesErr
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+//go:build !nolnd
+
+package testutils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	btcdocker "github.com/elnosh/btc-docker-test"
+	"github.com/elnosh/gonuts/mint/lightning"
+	"github.com/lightningnetwork/lnd/macaroons"
+	"google.golang.org/grpc/credentials"
+	"gopkg.in/macaroon.v2"
+)
+
+func LndClient(lnd *btcdocker.Lnd, dbpath string) (*lightning.LndClient, error) {
+	if err := os.MkdirAll(dbpath, 0750); err != nil {
+		return nil, err
+	}
+	nodeDir := lnd.LndDir
+
+	creds, err := credentials.NewClientTLSFromFile(filepath.Join(nodeDir, "/tls.cert"), "")
+	if err != nil {
+		return nil, err
+	}
+
+	macaroonPath := filepath.Join(dbpath, "/admin.macaroon")
+	file, err := os.Create(macaroonPath)
+	if err != nil {
+		return nil, fmt.Errorf("error creating macaroon file: %v", err)
+	}
+
+	_, err = file.Write(lnd.AdminMacaroon)
+	if err != nil {
+		return nil, fmt.Errorf("error writing to macaroon file: %v", err)
+	}
+	macaroonBytes, err := os.ReadFile(macaroonPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading macaroon: os.ReadFile %v", err)
+	}
+
+	macaroon := &macaroon.Macaroon{}
+	if err = macaroon.UnmarshalBinary(macaroonBytes); err != nil {
+		return nil, fmt.Errorf("unable to decode macaroon: %v", err)
+	}
+	macarooncreds, err := macaroons.NewMacaroonCredential(macaroon)
+	if err != nil {
+		return nil, fmt.Errorf("error setting macaroon creds: %v", err)
+	}
+	lndConfig := lightning.LndConfig{
+		GRPCHost: lnd.Host + ":" + lnd.GrpcPort,
+		Cert:     creds,
+		Macaroon: macarooncreds,
+	}
+	lndClient, err := lightning.SetupLndClient(lndConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error setting LND client: %v", err)
+	}
+
+	return lndClient, nil
+}
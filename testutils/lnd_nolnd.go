@@ -0,0 +1,15 @@
+//go:build nolnd
+
+package testutils
+
+import (
+	"errors"
+
+	btcdocker "github.com/elnosh/btc-docker-test"
+	"github.com/elnosh/gonuts/mint/lightning"
+)
+
+// the LND backend is left out of builds with the nolnd tag
+func LndClient(lnd *btcdocker.Lnd, dbpath string) (lightning.Client, error) {
+	return nil, errors.New("built without LND support (nolnd tag)")
+}
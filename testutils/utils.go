@@ -32,11 +32,8 @@ import (
 	"github.com/elnosh/gonuts/wallet"
 	"github.com/elnosh/gonuts/wallet/client"
 	"github.com/lightningnetwork/lnd/lnrpc"
-	"github.com/lightningnetwork/lnd/macaroons"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
-	"google.golang.org/grpc/credentials"
-	"gopkg.in/macaroon.v2"
 )
 
 const (
@@ -220,53 +217,6 @@ func MintConfig(
 	return mintConfig, nil
 }
 
-func LndClient(lnd *btcdocker.Lnd, dbpath string) (*lightning.LndClient, error) {
-	if err := os.MkdirAll(dbpath, 0750); err != nil {
-		return nil, err
-	}
-	nodeDir := lnd.LndDir
-
-	creds, err := credentials.NewClientTLSFromFile(filepath.Join(nodeDir, "/tls.cert"), "")
-	if err != nil {
-		return nil, err
-	}
-
-	macaroonPath := filepath.Join(dbpath, "/admin.macaroon")
-	file, err := os.Create(macaroonPath)
-	if err != nil {
-		return nil, fmt.Errorf("error creating macaroon file: %v", err)
-	}
-
-	_, err = file.Write(lnd.AdminMacaroon)
-	if err != nil {
-		return nil, fmt.Errorf("error writing to macaroon file: %v", err)
-	}
-	macaroonBytes, err := os.ReadFile(macaroonPath)
-	if err != nil {
-		return nil, fmt.Errorf("error reading macaroon: os.ReadFile %v", err)
-	}
-
-	macaroon := &macaroon.Macaroon{}
-	if err = macaroon.UnmarshalBinary(macaroonBytes); err != nil {
-		return nil, fmt.Errorf("unable to decode macaroon: %v", err)
-	}
-	macarooncreds, err := macaroons.NewMacaroonCredential(macaroon)
-	if err != nil {
-		return nil, fmt.Errorf("error setting macaroon creds: %v", err)
-	}
-	lndConfig := lightning.LndConfig{
-		GRPCHost: lnd.Host + ":" + lnd.GrpcPort,
-		Cert:     creds,
-		Macaroon: macarooncreds,
-	}
-	lndClient, err := lightning.SetupLndClient(lndConfig)
-	if err != nil {
-		return nil, fmt.Errorf("error setting LND client: %v", err)
-	}
-
-	return lndClient, nil
-}
-
 func CreateTestMint(
 	lnd *btcdocker.Lnd,
 	dbpath string,
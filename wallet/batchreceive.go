@@ -0,0 +1,130 @@
+package wallet
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+)
+
+type BatchReceiveStatus int
+
+const (
+	BatchReceiveAccepted BatchReceiveStatus = iota
+	// all the proofs in the token were already spent
+	BatchReceiveAlreadySpent
+	BatchReceiveFailed
+)
+
+func (status BatchReceiveStatus) String() string {
+	switch status {
+	case BatchReceiveAccepted:
+		return "accepted"
+	case BatchReceiveAlreadySpent:
+		return "already spent"
+	case BatchReceiveFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+type BatchReceiveOptions struct {
+	// max number of tokens checked against their mints at the same time.
+	// Defaults to 1 if not set.
+	Concurrency int
+	// swap the proofs from mints that are not trusted to the default mint
+	// instead of adding their mints to the wallet
+	SwapToTrusted bool
+	// receive tokens even if the fees exceed the ReceiveFeePolicy
+	IgnoreFeePolicy bool
+}
+
+// BatchReceipt is the result of receiving one of the tokens in a batch
+type BatchReceipt struct {
+	// index of the token in the batch
+	Index    int
+	Mint     string
+	Amount   uint64
+	Received uint64
+	Fees     uint64
+	Status   BatchReceiveStatus
+	Err      error
+}
+
+// ReceiveBatch receives the serialized tokens (i.e the tokens collected by a
+// merchant during the day) and returns a receipt for each one in the same order.
+// The proofs of the tokens are checked against their mints concurrently up to
+// the Concurrency in the options, while the swaps are done one at a time since
+// they use the same counters of the wallet. A token that fails does not stop
+// the rest from being received.
+func (w *Wallet) ReceiveBatch(tokens []string, opts BatchReceiveOptions) []BatchReceipt {
+	concurrency := max(opts.Concurrency, 1)
+	receipts := make([]BatchReceipt, len(tokens))
+
+	var swapMu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, serializedToken := range tokens {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, serializedToken string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			receipts[i] = w.receiveBatchToken(serializedToken, opts, &swapMu)
+			receipts[i].Index = i
+		}(i, serializedToken)
+	}
+	wg.Wait()
+
+	return receipts
+}
+
+func (w *Wallet) receiveBatchToken(serializedToken string, opts BatchReceiveOptions, swapMu *sync.Mutex) BatchReceipt {
+	token, err := cashu.DecodeToken(strings.TrimSpace(serializedToken))
+	if err != nil {
+		return BatchReceipt{Status: BatchReceiveFailed, Err: err}
+	}
+	receipt := BatchReceipt{Mint: token.Mint(), Amount: token.Amount()}
+
+	validation, err := ValidateToken(token)
+	if err != nil {
+		receipt.Status, receipt.Err = BatchReceiveFailed, err
+		return receipt
+	}
+	if allProofsSpent(validation.Proofs) {
+		receipt.Status = BatchReceiveAlreadySpent
+		return receipt
+	}
+
+	swapMu.Lock()
+	result, err := w.receive(token, opts.SwapToTrusted, !opts.IgnoreFeePolicy)
+	swapMu.Unlock()
+	receipt.Received, receipt.Fees = result.Received, result.Fees
+	if err != nil {
+		receipt.Status, receipt.Err = BatchReceiveFailed, err
+		var cashuErr cashu.Error
+		// the proofs could have been spent after checking their state
+		if errors.As(err, &cashuErr) && cashuErr.Code == cashu.ProofAlreadyUsedErrCode &&
+			cashuErr.Detail != cashu.ProofPendingErr.Detail {
+			receipt.Status = BatchReceiveAlreadySpent
+		}
+		return receipt
+	}
+	receipt.Status = BatchReceiveAccepted
+
+	return receipt
+}
+
+func allProofsSpent(proofs []ProofValidation) bool {
+	for _, proof := range proofs {
+		if proof.State != nut07.Spent {
+			return false
+		}
+	}
+	return len(proofs) > 0
+}
@@ -0,0 +1,252 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut20"
+	"github.com/elnosh/gonuts/cashu/nuts/nut25"
+	"github.com/elnosh/gonuts/wallet/client"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+var (
+	ErrNothingToMint      = errors.New("nothing to mint from quote")
+	ErrBolt12NotSupported = errors.New("mint does not support paying BOLT12 offers")
+)
+
+// IsOffer returns whether the request is a BOLT12 offer (lno1...)
+func IsOffer(request string) bool {
+	return strings.HasPrefix(strings.ToLower(request), "lno1")
+}
+
+// RequestMintBolt12 requests a mint quote with a BOLT12 offer (NUT-25)
+// to the mint. The offer is for any amount if the amount is 0. Offers can
+// be paid more than once so the quote can be minted from with MintBolt12Tokens
+// each time the offer is paid. The mint requests are signed with the key of
+// the wallet.
+func (w *Wallet) RequestMintBolt12(amount uint64, mint string) (*nut25.PostMintQuoteBolt12Response, error) {
+	// offers are only for sats
+	selectedMint, err := w.mintForUnit(mint, cashu.Sat)
+	if err != nil {
+		return nil, err
+	}
+
+	mintRequest := nut25.PostMintQuoteBolt12Request{
+		Amount: amount,
+		Unit:   cashu.Sat.String(),
+		Pubkey: hex.EncodeToString(w.privateKey.PubKey().SerializeCompressed()),
+	}
+	w.logDebugf("requesting bolt12 mint quote for amount %v from mint '%v'", amount, selectedMint.mintURL)
+	mintResponse, err := client.PostMintQuoteBolt12(selectedMint.mintURL, mintRequest)
+	if err != nil {
+		w.logErrorf("bolt12 mint quote request to '%v' failed: %v", selectedMint.mintURL, err)
+		return nil, err
+	}
+	if mintResponse.Pubkey != mintRequest.Pubkey {
+		return nil, errors.New("mint quote does not have the pubkey of the wallet")
+	}
+
+	quote := storage.MintQuote{
+		QuoteId:        mintResponse.Quote,
+		Mint:           selectedMint.mintURL,
+		Method:         cashu.BOLT12_METHOD,
+		State:          nut04.Unpaid,
+		Unit:           cashu.Sat.String(),
+		Amount:         amount,
+		PaymentRequest: mintResponse.Request,
+		CreatedAt:      time.Now().Unix(),
+		QuoteExpiry:    mintResponse.Expiry,
+	}
+	if err := w.db.SaveMintQuote(quote); err != nil {
+		return nil, fmt.Errorf("error saving mint quote: %v", err)
+	}
+	w.logInfof("got bolt12 mint quote '%v' from mint '%v'", quote.QuoteId, quote.Mint)
+
+	return mintResponse, nil
+}
+
+// MintQuoteBolt12State returns the amount paid to the offer of
+// the quote and the amount that has been issued from it
+func (w *Wallet) MintQuoteBolt12State(quoteId string) (*nut25.PostMintQuoteBolt12Response, error) {
+	quote := w.db.GetMintQuoteById(quoteId)
+	if quote == nil || quote.Method != cashu.BOLT12_METHOD {
+		return nil, ErrQuoteNotFound
+	}
+
+	mintQuote, err := client.GetMintQuoteBolt12State(quote.Mint, quoteId)
+	if err != nil {
+		w.logErrorf("could not get state of bolt12 mint quote '%v' from '%v': %v", quoteId, quote.Mint, err)
+		return nil, err
+	}
+	// quotes for offers are never issued since they can be paid again
+	if quote.State == nut04.Unpaid && mintQuote.AmountPaid > 0 {
+		w.logInfof("offer of mint quote '%v' was paid", quoteId)
+		quote.State = nut04.Paid
+		if err := w.db.SaveMintQuote(*quote); err != nil {
+			return nil, fmt.Errorf("error saving mint quote: %v", err)
+		}
+	}
+
+	return mintQuote, nil
+}
+
+// MintBolt12Tokens mints what was paid to the offer of the quote
+// and has not been minted yet. It returns the amount minted.
+func (w *Wallet) MintBolt12Tokens(quoteId string) (uint64, error) {
+	quote := w.db.GetMintQuoteById(quoteId)
+	if quote == nil || quote.Method != cashu.BOLT12_METHOD {
+		return 0, ErrQuoteNotFound
+	}
+	return retryOnSignedOutputs(w, quote.Mint, cashu.Sat, func() (uint64, error) {
+		return w.mintBolt12Tokens(quoteId)
+	})
+}
+
+func (w *Wallet) mintBolt12Tokens(quoteId string) (uint64, error) {
+	quote := w.db.GetMintQuoteById(quoteId)
+	if quote == nil {
+		return 0, ErrQuoteNotFound
+	}
+	mintQuote, err := w.MintQuoteBolt12State(quoteId)
+	if err != nil {
+		return 0, err
+	}
+	amount := mintQuote.Mintable()
+	if amount == 0 {
+		return 0, ErrNothingToMint
+	}
+
+	activeKeyset, err := w.getUnitActiveKeyset(quote.Mint, cashu.Sat)
+	if err != nil {
+		return 0, fmt.Errorf("error getting active sat keyset: %v", err)
+	}
+	counter := w.counterForKeyset(activeKeyset.Id)
+
+	selectedMint, _ := w.getMint(quote.Mint, cashu.Sat)
+	split := w.splitWalletTarget(amount, &selectedMint)
+	blindedMessages, secrets, rs, err := w.createBlindedMessages(split, activeKeyset.Id, &counter)
+	if err != nil {
+		return 0, fmt.Errorf("error creating blinded messages: %v", err)
+	}
+	signature, err := nut20.SignMintRequest(quoteId, blindedMessages, w.privateKey)
+	if err != nil {
+		return 0, fmt.Errorf("error signing mint request: %v", err)
+	}
+
+	postMintRequest := nut25.PostMintBolt12Request{Quote: quoteId, Outputs: blindedMessages, Signature: signature}
+	w.logDebugf("requesting signatures for %v outputs for bolt12 mint quote '%v'", len(blindedMessages), quoteId)
+	mintResponse, err := client.PostMintBolt12(quote.Mint, postMintRequest)
+	if err != nil {
+		w.logErrorf("minting for bolt12 quote '%v' at '%v' failed: %v", quoteId, quote.Mint, err)
+		return 0, err
+	}
+
+	proofs, err := constructProofs(mintResponse.Signatures, blindedMessages, secrets, rs, activeKeyset)
+	if err != nil {
+		return 0, fmt.Errorf("error constructing proofs: %v", err)
+	}
+	if err := w.db.SaveProofs(proofs); err != nil {
+		return 0, fmt.Errorf("error storing proofs: %v", err)
+	}
+	if err := w.db.IncrementKeysetCounter(activeKeyset.Id, uint32(len(blindedMessages))); err != nil {
+		return 0, fmt.Errorf("error incrementing keyset counter: %v", err)
+	}
+
+	quote.SettledAt = time.Now().Unix()
+	if err := w.db.SaveMintQuote(*quote); err != nil {
+		return 0, err
+	}
+	if w.unit == cashu.Sat {
+		w.recordTransaction(storage.MintTransaction, quote.Mint, proofs.Amount(), 0, quoteId)
+	}
+	w.logInfof("minted %v from bolt12 quote '%v' at mint '%v'", proofs.Amount(), quoteId, quote.Mint)
+
+	return proofs.Amount(), nil
+}
+
+// RequestMeltQuoteBolt12 requests a melt quote to pay the BOLT12 offer
+// with proofs in sats. The amount (in sats) is only needed for offers
+// for any amount and is 0 otherwise. The mint fetches the invoice from
+// the offer and has to advertise support for the bolt12 method (NUT-05)
+// or ErrBolt12NotSupported is returned.
+func (w *Wallet) RequestMeltQuoteBolt12(
+	offer string,
+	amount uint64,
+	mint string,
+) (*nut25.PostMeltQuoteBolt12Response, error) {
+	if !IsOffer(offer) {
+		return nil, errors.New("invalid offer")
+	}
+	selectedMint, err := w.mintForUnit(mint, cashu.Sat)
+	if err != nil {
+		return nil, err
+	}
+	amountMsat, err := cashu.CheckedMul(amount, 1000)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := client.GetMintInfo(selectedMint.mintURL)
+	if err != nil {
+		return nil, fmt.Errorf("error getting info from mint: %v", err)
+	}
+	if _, ok := info.MethodSetting(5, cashu.BOLT12_METHOD, cashu.Sat.String()); !ok {
+		return nil, ErrBolt12NotSupported
+	}
+
+	meltRequest := nut25.PostMeltQuoteBolt12Request{Request: offer, Unit: cashu.Sat.String()}
+	if amountMsat > 0 {
+		meltRequest.Options = &nut05.MeltOptions{Amountless: &nut05.AmountlessOption{AmountMsat: amountMsat}}
+	}
+	w.logDebugf("requesting bolt12 melt quote from mint '%v'", selectedMint.mintURL)
+	meltQuoteResponse, err := client.PostMeltQuoteBolt12(selectedMint.mintURL, meltRequest)
+	if err != nil {
+		w.logErrorf("bolt12 melt quote request to '%v' failed: %v", selectedMint.mintURL, err)
+		return nil, err
+	}
+
+	// offers can be paid more than once so quotes for them are not reused
+	quote := storage.MeltQuote{
+		QuoteId:        meltQuoteResponse.Quote,
+		Mint:           selectedMint.mintURL,
+		Method:         cashu.BOLT12_METHOD,
+		Unit:           cashu.Sat.String(),
+		State:          meltQuoteResponse.State,
+		PaymentRequest: offer,
+		Amount:         meltQuoteResponse.Amount,
+		FeeReserve:     meltQuoteResponse.FeeReserve,
+		CreatedAt:      time.Now().Unix(),
+		QuoteExpiry:    meltQuoteResponse.Expiry,
+	}
+	if err := w.db.SaveMeltQuote(quote); err != nil {
+		return nil, fmt.Errorf("error saving melt quote: %v", err)
+	}
+	w.logInfof("got bolt12 melt quote '%v' for amount %v with fee reserve %v from mint '%v'",
+		quote.QuoteId, quote.Amount, quote.FeeReserve, quote.Mint)
+
+	return meltQuoteResponse, nil
+}
+
+// getMeltQuoteState gets the state of the quote from the endpoint of its method
+func getMeltQuoteState(quote *storage.MeltQuote) (*nut05.PostMeltQuoteBolt11Response, error) {
+	if quote.Method == cashu.BOLT12_METHOD {
+		return client.GetMeltQuoteBolt12State(quote.Mint, quote.QuoteId)
+	}
+	return client.GetMeltQuoteState(quote.Mint, quote.QuoteId)
+}
+
+// postMelt sends the melt request to the endpoint of the method of the quote
+func postMelt(quote *storage.MeltQuote, meltRequest nut05.PostMeltBolt11Request) (
+	*nut05.PostMeltQuoteBolt11Response, error) {
+	if quote.Method == cashu.BOLT12_METHOD {
+		return client.PostMeltBolt12(quote.Mint, meltRequest)
+	}
+	return client.PostMeltBolt11(quote.Mint, meltRequest)
+}
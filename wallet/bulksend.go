@@ -0,0 +1,122 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/wallet/client"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+type BulkSendOptions struct {
+	// include in each token the fees the receiver will pay to swap it
+	IncludeFees bool
+	// max number of outputs in each swap. If not set, the max outputs
+	// advertised by the mint are used or all tokens are made in one swap.
+	MaxOutputsPerSwap int
+}
+
+// BulkSend creates count tokens of the amount from the mint (i.e for vouchers).
+// Instead of a swap for each token, the proofs for all of them are made in as
+// few swaps as the max outputs per swap allow and then split into the tokens.
+// Swaps are made one after the other. If one fails, the tokens from the
+// previous swaps are returned with the error since they were already made.
+func (w *Wallet) BulkSend(count int, amount uint64, mintURL string, opts BulkSendOptions) ([]cashu.Proofs, error) {
+	if count <= 0 || amount == 0 {
+		return nil, errors.New("count and amount must be greater than zero")
+	}
+	selectedMint, ok := w.mints[mintURL]
+	if !ok {
+		return nil, ErrMintNotExist
+	}
+	if err := w.checkSpendingPolicy(mintURL, uint64(count)*amount); err != nil {
+		return nil, err
+	}
+	activeSatKeyset, err := w.getActiveKeyset(mintURL)
+	if err != nil {
+		return nil, fmt.Errorf("error getting active sat keyset: %v", err)
+	}
+
+	tokenSplit := sendSplit(amount, activeSatKeyset, opts.IncludeFees)
+	maxOutputs := opts.MaxOutputsPerSwap
+	if maxOutputs <= 0 {
+		mintInfo, err := client.GetMintInfo(mintURL)
+		if err == nil && mintInfo.Limits != nil {
+			maxOutputs = mintInfo.Limits.MaxOutputs
+		}
+	}
+	if maxOutputs > 0 && len(tokenSplit) > maxOutputs {
+		return nil, fmt.Errorf("token of %v needs more than the max of %v outputs in a swap", amount, maxOutputs)
+	}
+
+	balance := w.GetBalanceByMints()[mintURL]
+	tokens := make([]cashu.Proofs, 0, count)
+	// tokens already made are recorded even if a later swap fails
+	defer func() {
+		if len(tokens) > 0 {
+			w.recordSpent(storage.SendTransaction, mintURL, uint64(len(tokens))*amount, balance,
+				fmt.Sprintf("%v tokens of %v", len(tokens), amount))
+		}
+	}()
+	for len(tokens) < count {
+		tokensInSwap := count - len(tokens)
+		if maxOutputs > 0 {
+			tokensInSwap = min(tokensInSwap, maxOutputs/len(tokenSplit))
+		}
+
+		var req swapToSendRequest
+		for {
+			split := make([]uint64, 0, tokensInSwap*len(tokenSplit))
+			for range tokensInSwap {
+				split = append(split, tokenSplit...)
+			}
+			slices.Sort(split)
+
+			req, err = w.createSwapToSendSplitRequest(split, &selectedMint, activeSatKeyset, nil)
+			if err != nil {
+				return tokens, err
+			}
+			if maxOutputs <= 0 || len(req.outputs) <= maxOutputs || tokensInSwap == 1 {
+				break
+			}
+			// leave room for the change outputs
+			excessTokens := (len(req.outputs) - maxOutputs + len(tokenSplit) - 1) / len(tokenSplit)
+			tokensInSwap = max(tokensInSwap-excessTokens, 1)
+		}
+
+		proofs, err := w.executeSwapToSend(req, &selectedMint)
+		if err != nil {
+			return tokens, err
+		}
+		if err := w.db.AddPendingProofs(proofs); err != nil {
+			return tokens, fmt.Errorf("could not save proofs to pending: %v", err)
+		}
+		tokens = append(tokens, splitIntoTokens(proofs, tokenSplit)...)
+		w.logDebugf("made %v of %v tokens of %v at mint '%v'", len(tokens), count, amount, mintURL)
+	}
+
+	w.logInfof("sent %v tokens of %v from mint '%v'", len(tokens), amount, mintURL)
+	return tokens, nil
+}
+
+// splitIntoTokens takes from the proofs one for each amount
+// in the token split until all proofs are taken
+func splitIntoTokens(proofs cashu.Proofs, tokenSplit []uint64) []cashu.Proofs {
+	byAmount := make(map[uint64]cashu.Proofs)
+	for _, proof := range proofs {
+		byAmount[proof.Amount] = append(byAmount[proof.Amount], proof)
+	}
+
+	tokens := make([]cashu.Proofs, 0, len(proofs)/len(tokenSplit))
+	for range len(proofs) / len(tokenSplit) {
+		token := make(cashu.Proofs, len(tokenSplit))
+		for i, amount := range tokenSplit {
+			token[i] = byAmount[amount][0]
+			byAmount[amount] = byAmount[amount][1:]
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
@@ -0,0 +1,37 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/elnosh/gonuts/cashu"
+)
+
+func TestSplitIntoTokens(t *testing.T) {
+	tokenSplit := []uint64{1, 4, 8}
+	var proofs cashu.Proofs
+	for i := 0; i < 3; i++ {
+		for _, amount := range []uint64{8, 1, 4} {
+			proofs = append(proofs, cashu.Proof{Amount: amount, Secret: fmt.Sprintf("secret%v_%v", i, amount)})
+		}
+	}
+
+	tokens := splitIntoTokens(proofs, tokenSplit)
+	if len(tokens) != 3 {
+		t.Fatalf("expected 3 tokens but got %v", len(tokens))
+	}
+	seen := make(map[string]bool)
+	for _, token := range tokens {
+		if token.Amount() != 13 {
+			t.Fatalf("expected token of 13 but got %v", token.Amount())
+		}
+		for _, proof := range token {
+			if seen[proof.Secret] {
+				t.Fatalf("proof '%v' in more than one token", proof.Secret)
+			}
+			seen[proof.Secret] = true
+		}
+	}
+}
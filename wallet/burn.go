@@ -0,0 +1,128 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/cashu/nuts/nut11"
+	"github.com/elnosh/gonuts/cashu/nuts/nut12"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+const burnKeyMessage = "gonuts_burn"
+
+// BurnKey returns the public key that burned proofs are locked to.
+// It is derived with hash to curve so nobody knows its private key
+// and proofs locked to it can never be spent.
+func BurnKey() *secp256k1.PublicKey {
+	key, _ := crypto.HashToCurve([]byte(burnKeyMessage))
+	return key
+}
+
+// BurnReceipt has the proofs that were locked to the burn key.
+// It can be checked by anyone with VerifyBurnReceipt.
+type BurnReceipt struct {
+	Mint   string `json:"mint"`
+	Amount uint64 `json:"amount"`
+	// proofs locked to the burn key with the DLEQ proofs from the mint
+	Proofs   cashu.Proofs `json:"proofs"`
+	BurnedAt int64        `json:"burned_at"`
+}
+
+// Burn destroys the amount from the mint by swapping proofs from the wallet
+// for proofs locked to the burn key. It returns a receipt with the burned proofs
+// that proves the amount can no longer be spent.
+func (w *Wallet) Burn(amount uint64, mintURL string) (*BurnReceipt, error) {
+	selectedMint, ok := w.mints[mintURL]
+	if !ok {
+		return nil, ErrMintNotExist
+	}
+	if err := w.checkSpendingPolicy(mintURL, amount); err != nil {
+		return nil, err
+	}
+
+	burnCondition := nut10.SpendingCondition{
+		Kind: nut10.P2PK,
+		Data: hex.EncodeToString(BurnKey().SerializeCompressed()),
+		Tags: [][]string{},
+	}
+	balance := w.GetBalanceByMints()[mintURL]
+	burnedProofs, err := w.swapToSend(amount, &selectedMint, &burnCondition, false)
+	if err != nil {
+		return nil, err
+	}
+	w.recordSpent(storage.SendTransaction, mintURL, burnedProofs.Amount(), balance, "burn")
+	w.logInfof("burned %v from mint '%v'", burnedProofs.Amount(), mintURL)
+
+	return &BurnReceipt{
+		Mint:     mintURL,
+		Amount:   burnedProofs.Amount(),
+		Proofs:   burnedProofs,
+		BurnedAt: time.Now().Unix(),
+	}, nil
+}
+
+// VerifyBurnReceipt checks that the proofs in the receipt add up to its amount,
+// can only be spent with the burn key and were signed by the mint.
+// The keys of the mint are fetched to verify the DLEQ proofs.
+func VerifyBurnReceipt(receipt BurnReceipt) error {
+	keys := make(map[string]map[uint64]*secp256k1.PublicKey)
+	for _, proof := range receipt.Proofs {
+		if _, ok := keys[proof.Id]; ok {
+			continue
+		}
+		keysetKeys, err := GetKeysetKeys(receipt.Mint, proof.Id)
+		if err != nil {
+			return err
+		}
+		keys[proof.Id] = keysetKeys
+	}
+	return verifyBurnedProofs(receipt, keys)
+}
+
+func verifyBurnedProofs(receipt BurnReceipt, keys map[string]map[uint64]*secp256k1.PublicKey) error {
+	if len(receipt.Proofs) == 0 {
+		return errors.New("receipt has no proofs")
+	}
+	if receipt.Proofs.Amount() != receipt.Amount {
+		return fmt.Errorf("proofs add up to %v but receipt amount is %v", receipt.Proofs.Amount(), receipt.Amount)
+	}
+
+	burnKey := hex.EncodeToString(BurnKey().SerializeCompressed())
+	for _, proof := range receipt.Proofs {
+		secret, err := nut10.DeserializeSecret(proof.Secret)
+		if err != nil {
+			return fmt.Errorf("invalid secret: %v", err)
+		}
+		if secret.Kind != nut10.P2PK || secret.Data.Data != burnKey {
+			return errors.New("proof is not locked to the burn key")
+		}
+		// any other key or a locktime would allow spending the proof
+		tags, err := nut11.ParseP2PKTags(secret.Data.Tags)
+		if err != nil {
+			return fmt.Errorf("invalid tags: %v", err)
+		}
+		if len(tags.Pubkeys) > 0 || len(tags.Refund) > 0 || tags.Locktime > 0 {
+			return errors.New("proof can be spent with keys other than the burn key")
+		}
+
+		if proof.DLEQ == nil {
+			return errors.New("proof does not have a DLEQ proof")
+		}
+		pubkey, ok := keys[proof.Id][proof.Amount]
+		if !ok {
+			return fmt.Errorf("key for amount %v not found in keyset '%v'", proof.Amount, proof.Id)
+		}
+		if !nut12.VerifyProofDLEQ(proof, pubkey) {
+			return errors.New("invalid DLEQ proof")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/cashu/nuts/nut11"
+	"github.com/elnosh/gonuts/crypto"
+)
+
+func TestVerifyBurnReceipt(t *testing.T) {
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	keyset, err := crypto.GenerateKeyset(master, 0, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+	keys := map[string]map[uint64]*secp256k1.PublicKey{keyset.Id: {}}
+	for amount, key := range keyset.Keys {
+		keys[keyset.Id][amount] = key.PublicKey
+	}
+
+	lockedProof := func(amount uint64, pubkey *secp256k1.PublicKey, tags [][]string, withDLEQ bool) cashu.Proof {
+		secret, err := nut10.NewSecretFromSpendingCondition(nut10.SpendingCondition{
+			Kind: nut10.P2PK,
+			Data: hex.EncodeToString(pubkey.SerializeCompressed()),
+			Tags: tags,
+		})
+		if err != nil {
+			t.Fatalf("error creating secret: %v", err)
+		}
+		return signProof(t, keyset, amount, secret, withDLEQ)
+	}
+
+	otherKey, _ := secp256k1.GeneratePrivateKey()
+	refundTags := nut11.SerializeP2PKTags(nut11.P2PKTags{
+		Locktime: time.Now().Add(time.Hour).Unix(),
+		Refund:   []*secp256k1.PublicKey{otherKey.PubKey()},
+	})
+	burnedProofs := cashu.Proofs{
+		lockedProof(8, BurnKey(), [][]string{}, true),
+		lockedProof(2, BurnKey(), [][]string{}, true),
+	}
+
+	tests := []struct {
+		name    string
+		receipt BurnReceipt
+		valid   bool
+	}{
+		{"valid", BurnReceipt{Amount: 10, Proofs: burnedProofs}, true},
+		{"amount does not match", BurnReceipt{Amount: 12, Proofs: burnedProofs}, false},
+		{
+			"locked to other key",
+			BurnReceipt{Amount: 4, Proofs: cashu.Proofs{lockedProof(4, otherKey.PubKey(), [][]string{}, true)}},
+			false,
+		},
+		{
+			"refund key",
+			BurnReceipt{Amount: 4, Proofs: cashu.Proofs{lockedProof(4, BurnKey(), refundTags, true)}},
+			false,
+		},
+		{
+			"no DLEQ",
+			BurnReceipt{Amount: 4, Proofs: cashu.Proofs{lockedProof(4, BurnKey(), [][]string{}, false)}},
+			false,
+		},
+		{"no proofs", BurnReceipt{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verifyBurnedProofs(test.receipt, keys)
+			if test.valid && err != nil {
+				t.Fatalf("expected valid receipt but got error: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("expected error verifying receipt")
+			}
+		})
+	}
+}
@@ -16,8 +16,13 @@ import (
 	"github.com/elnosh/gonuts/cashu/nuts/nut06"
 	"github.com/elnosh/gonuts/cashu/nuts/nut07"
 	"github.com/elnosh/gonuts/cashu/nuts/nut09"
+	"github.com/elnosh/gonuts/cashu/nuts/nut25"
 )
 
+// MaxStreamResponseSize is the max size in bytes read
+// from responses that can have many signatures.
+const MaxStreamResponseSize = 64 << 20
+
 func GetMintInfo(mintURL string) (*nut06.MintInfo, error) {
 	resp, err := get(mintURL + "/v1/info")
 	if err != nil {
@@ -144,14 +149,54 @@ func GetMintQuoteState(mintURL, quoteId string) (*nut04.PostMintQuoteBolt11Respo
 	return &mintQuoteResponse, nil
 }
 
+// GetMintQuoteByPaymentHash gets the mint quote for the invoice with the payment hash.
+// Useful to recover the state of a quote if the quote id was lost. Mints only
+// return quotes that are locked to a pubkey.
+func GetMintQuoteByPaymentHash(mintURL, paymentHash string) (*nut04.PostMintQuoteBolt11Response, error) {
+	resp, err := get(mintURL + "/v1/mint/quote/bolt11/hash/" + paymentHash)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var mintQuoteResponse nut04.PostMintQuoteBolt11Response
+	if err := json.Unmarshal(body, &mintQuoteResponse); err != nil {
+		return nil, fmt.Errorf("error reading response from mint: %v", err)
+	}
+
+	return &mintQuoteResponse, nil
+}
+
 func PostMintBolt11(mintURL string, mintRequest nut04.PostMintBolt11Request) (
 	*nut04.PostMintBolt11Response, error) {
-	requestBody, err := json.Marshal(mintRequest)
+	resp, err := httpPost(mintURL+"/v1/mint/bolt11", "application/json", streamBody(mintRequest.EncodeStream))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var reqMintResponse nut04.PostMintBolt11Response
+	body := io.LimitReader(resp.Body, MaxStreamResponseSize)
+	if err := reqMintResponse.DecodeStream(body, cashu.DefaultMaxStreamItems); err != nil {
+		return nil, fmt.Errorf("error reading response from mint: %v", err)
+	}
+
+	return &reqMintResponse, nil
+}
+
+func PostMintQuoteBolt12(mintURL string, mintQuoteRequest nut25.PostMintQuoteBolt12Request) (
+	*nut25.PostMintQuoteBolt12Response, error) {
+	requestBody, err := json.Marshal(mintQuoteRequest)
 	if err != nil {
 		return nil, fmt.Errorf("json.Marshal: %v", err)
 	}
 
-	resp, err := httpPost(mintURL+"/v1/mint/bolt11", "application/json", bytes.NewBuffer(requestBody))
+	resp, err := httpPost(mintURL+"/v1/mint/quote/bolt12", "application/json", bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, err
 	}
@@ -162,7 +207,7 @@ func PostMintBolt11(mintURL string, mintRequest nut04.PostMintBolt11Request) (
 		return nil, err
 	}
 
-	var reqMintResponse nut04.PostMintBolt11Response
+	var reqMintResponse nut25.PostMintQuoteBolt12Response
 	if err := json.Unmarshal(body, &reqMintResponse); err != nil {
 		return nil, fmt.Errorf("error reading response from mint: %v", err)
 	}
@@ -170,25 +215,53 @@ func PostMintBolt11(mintURL string, mintRequest nut04.PostMintBolt11Request) (
 	return &reqMintResponse, nil
 }
 
-func PostSwap(mintURL string, swapRequest nut03.PostSwapRequest) (*nut03.PostSwapResponse, error) {
-	requestBody, err := json.Marshal(swapRequest)
+func GetMintQuoteBolt12State(mintURL, quoteId string) (*nut25.PostMintQuoteBolt12Response, error) {
+	resp, err := get(mintURL + "/v1/mint/quote/bolt12/" + quoteId)
 	if err != nil {
-		return nil, fmt.Errorf("json.Marshal: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var mintQuoteResponse nut25.PostMintQuoteBolt12Response
+	if err := json.Unmarshal(body, &mintQuoteResponse); err != nil {
+		return nil, fmt.Errorf("error reading response from mint: %v", err)
 	}
 
-	resp, err := httpPost(mintURL+"/v1/swap", "application/json", bytes.NewBuffer(requestBody))
+	return &mintQuoteResponse, nil
+}
+
+func PostMintBolt12(mintURL string, mintRequest nut25.PostMintBolt12Request) (
+	*nut25.PostMintBolt12Response, error) {
+	resp, err := httpPost(mintURL+"/v1/mint/bolt12", "application/json", streamBody(mintRequest.EncodeStream))
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	var reqMintResponse nut25.PostMintBolt12Response
+	body := io.LimitReader(resp.Body, MaxStreamResponseSize)
+	if err := reqMintResponse.DecodeStream(body, cashu.DefaultMaxStreamItems); err != nil {
+		return nil, fmt.Errorf("error reading response from mint: %v", err)
+	}
+
+	return &reqMintResponse, nil
+}
+
+func PostSwap(mintURL string, swapRequest nut03.PostSwapRequest) (*nut03.PostSwapResponse, error) {
+	resp, err := httpPost(mintURL+"/v1/swap", "application/json", streamBody(swapRequest.EncodeStream))
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
 	var swapResponse nut03.PostSwapResponse
-	if err := json.Unmarshal(body, &swapResponse); err != nil {
+	body := io.LimitReader(resp.Body, MaxStreamResponseSize)
+	if err := swapResponse.DecodeStream(body, cashu.DefaultMaxStreamItems); err != nil {
 		return nil, fmt.Errorf("error reading response from mint: %v", err)
 	}
 
@@ -242,6 +315,50 @@ func GetMeltQuoteState(mintURL, quoteId string) (*nut05.PostMeltQuoteBolt11Respo
 	return &meltQuoteResponse, nil
 }
 
+// GetMeltQuoteByPaymentHash gets the melt quote for the invoice with the payment hash.
+// Useful to recover the state of a quote if the quote id was lost.
+func GetMeltQuoteByPaymentHash(mintURL, paymentHash string) (*nut05.PostMeltQuoteBolt11Response, error) {
+	resp, err := get(mintURL + "/v1/melt/quote/bolt11/hash/" + paymentHash)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var meltQuoteResponse nut05.PostMeltQuoteBolt11Response
+	if err := json.Unmarshal(body, &meltQuoteResponse); err != nil {
+		return nil, fmt.Errorf("error reading response from mint: %v", err)
+	}
+
+	return &meltQuoteResponse, nil
+}
+
+// PostMeltRequoteBolt11 requests a new quote with a higher fee reserve that
+// supersedes the unpaid melt quote. It returns the new quote.
+func PostMeltRequoteBolt11(mintURL, quoteId string) (*nut05.PostMeltQuoteBolt11Response, error) {
+	resp, err := httpPost(mintURL+"/v1/melt/quote/bolt11/"+quoteId+"/requote", "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var meltQuoteResponse nut05.PostMeltQuoteBolt11Response
+	if err := json.Unmarshal(body, &meltQuoteResponse); err != nil {
+		return nil, fmt.Errorf("error reading response from mint: %v", err)
+	}
+
+	return &meltQuoteResponse, nil
+}
+
 func PostMeltBolt11(mintURL string, meltRequest nut05.PostMeltBolt11Request) (
 	*nut05.PostMeltQuoteBolt11Response, error) {
 
@@ -269,6 +386,80 @@ func PostMeltBolt11(mintURL string, meltRequest nut05.PostMeltBolt11Request) (
 	return &meltResponse, nil
 }
 
+func PostMeltQuoteBolt12(mintURL string, meltQuoteRequest nut25.PostMeltQuoteBolt12Request) (
+	*nut25.PostMeltQuoteBolt12Response, error) {
+
+	requestBody, err := json.Marshal(meltQuoteRequest)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	resp, err := httpPost(mintURL+"/v1/melt/quote/bolt12", "application/json", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var meltQuoteResponse nut25.PostMeltQuoteBolt12Response
+	if err := json.Unmarshal(body, &meltQuoteResponse); err != nil {
+		return nil, fmt.Errorf("error reading response from mint: %v", err)
+	}
+
+	return &meltQuoteResponse, nil
+}
+
+func GetMeltQuoteBolt12State(mintURL, quoteId string) (*nut25.PostMeltQuoteBolt12Response, error) {
+	resp, err := get(mintURL + "/v1/melt/quote/bolt12/" + quoteId)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var meltQuoteResponse nut25.PostMeltQuoteBolt12Response
+	if err := json.Unmarshal(body, &meltQuoteResponse); err != nil {
+		return nil, fmt.Errorf("error reading response from mint: %v", err)
+	}
+
+	return &meltQuoteResponse, nil
+}
+
+func PostMeltBolt12(mintURL string, meltRequest nut25.PostMeltBolt12Request) (
+	*nut25.PostMeltQuoteBolt12Response, error) {
+
+	requestBody, err := json.Marshal(meltRequest)
+	if err != nil {
+		return nil, fmt.Errorf("json.Marshal: %v", err)
+	}
+
+	resp, err := httpPost(mintURL+"/v1/melt/bolt12", "application/json", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var meltResponse nut25.PostMeltQuoteBolt12Response
+	if err := json.Unmarshal(body, &meltResponse); err != nil {
+		return nil, fmt.Errorf("error reading response from mint: %v", err)
+	}
+
+	return &meltResponse, nil
+}
+
 func PostCheckProofState(mintURL string, stateRequest nut07.PostCheckStateRequest) (
 	*nut07.PostCheckStateResponse, error) {
 
@@ -323,6 +514,16 @@ func PostRestore(mintURL string, restoreRequest nut09.PostRestoreRequest) (
 	return &restoreResponse, nil
 }
 
+// streamBody returns a reader for a request body that is
+// encoded as it is read instead of being built in memory first
+func streamBody(encode func(io.Writer) error) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(encode(pw))
+	}()
+	return pr
+}
+
 func get(url string) (*http.Response, error) {
 	resp, err := http.Get(url)
 	if err != nil {
@@ -0,0 +1,100 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+	"github.com/gorilla/websocket"
+)
+
+// Subscription to notifications from a mint over its websocket (NUT-17)
+type Subscription struct {
+	conn  *websocket.Conn
+	subId string
+}
+
+// Subscribe opens a websocket to the mint and subscribes to changes in the
+// state of the filters, which are quote ids or the Ys of proofs depending on the kind.
+func Subscribe(mintURL string, kind nut17.SubscriptionKind, filters []string) (*Subscription, error) {
+	wsURL, err := websocketURL(mintURL)
+	if err != nil {
+		return nil, err
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to mint websocket: %v", err)
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	subId := hex.EncodeToString(idBytes)
+
+	request := nut17.WsRequest{
+		JSONRPC: nut17.JSONRPC,
+		Method:  nut17.Subscribe,
+		Params:  nut17.RequestParams{Kind: kind, SubId: subId, Filters: filters},
+	}
+	if err := conn.WriteJSON(request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var response nut17.WsResponse
+	if err := conn.ReadJSON(&response); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("could not read subscribe response: %v", err)
+	}
+	if response.Error != nil {
+		conn.Close()
+		return nil, response.Error
+	}
+
+	return &Subscription{conn: conn, subId: subId}, nil
+}
+
+// Read blocks until the next notification for the subscription.
+// It returns an error if the connection is closed.
+func (s *Subscription) Read() (nut17.WsNotification, error) {
+	for {
+		var notification nut17.WsNotification
+		if err := s.conn.ReadJSON(&notification); err != nil {
+			return nut17.WsNotification{}, err
+		}
+		if notification.Method == nut17.Subscribe && notification.Params.SubId == s.subId {
+			return notification, nil
+		}
+	}
+}
+
+// Close unsubscribes and closes the connection
+func (s *Subscription) Close() error {
+	// connection is closed after so no need to wait for the response
+	s.conn.WriteJSON(nut17.WsRequest{
+		JSONRPC: nut17.JSONRPC,
+		Method:  nut17.Unsubscribe,
+		Params:  nut17.RequestParams{SubId: s.subId},
+		Id:      1,
+	})
+	return s.conn.Close()
+}
+
+func websocketURL(mintURL string) (string, error) {
+	u, err := url.Parse(mintURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid mint url: %v", err)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/v1/ws"
+	return u.String(), nil
+}
@@ -0,0 +1,108 @@
+package wallet
+
+import (
+	"fmt"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// ConditionHandler creates the secrets and witnesses for proofs locked with a
+// custom NUT-10 kind registered with nut10.RegisterKind, i.e for escrow schemes
+// in private deployments. The mint has to know how to verify the witness.
+type ConditionHandler interface {
+	// NewSecret returns the secret for an output locked with the spending
+	// condition. Handlers without extra data in the secret can use
+	// nut10.NewSecretFromSpendingCondition.
+	NewSecret(condition nut10.SpendingCondition) (string, error)
+	// AddWitness adds the witness to spend the proofs locked with the secret.
+	// It is called before swapping proofs of the kind that were received.
+	AddWitness(proofs cashu.Proofs, secret nut10.WellKnownSecret) (cashu.Proofs, error)
+}
+
+// checkConditionHandlers checks that the handlers are for custom kinds
+func checkConditionHandlers(handlers map[nut10.SecretKind]ConditionHandler) error {
+	for kind, handler := range handlers {
+		if !nut10.IsCustomKind(kind) {
+			return fmt.Errorf("condition handler for kind '%v' that was not registered with nut10.RegisterKind", kind)
+		}
+		if handler == nil {
+			return fmt.Errorf("nil condition handler for kind '%v'", kind)
+		}
+	}
+	return nil
+}
+
+func (w *Wallet) conditionHandler(kind nut10.SecretKind) (ConditionHandler, error) {
+	handler, ok := w.conditionHandlers[kind]
+	if !ok {
+		return nil, fmt.Errorf("no condition handler for NUT-10 kind '%v'", kind)
+	}
+	return handler, nil
+}
+
+// newLockedSecret returns the secret for an output locked with the
+// spending condition from the handler of its kind if it is a custom one
+func (w *Wallet) newLockedSecret(condition nut10.SpendingCondition) (string, error) {
+	if !nut10.IsCustomKind(condition.Kind) {
+		return nut10.NewSecretFromSpendingCondition(condition)
+	}
+	handler, err := w.conditionHandler(condition.Kind)
+	if err != nil {
+		return "", err
+	}
+	secret, err := handler.NewSecret(condition)
+	if err != nil {
+		return "", fmt.Errorf("could not create secret for kind '%v': %v", condition.Kind, err)
+	}
+	return secret, nil
+}
+
+// addConditionWitness adds the witness to the proofs
+// locked with a custom kind from the handler of the kind
+func (w *Wallet) addConditionWitness(proofs cashu.Proofs, secret nut10.WellKnownSecret) (cashu.Proofs, error) {
+	handler, err := w.conditionHandler(secret.Kind)
+	if err != nil {
+		return nil, err
+	}
+	w.logDebugf("adding witness for kind '%v' to %v", secret.Kind, w.proofsLog(proofs))
+	witnessProofs, err := handler.AddWitness(proofs, secret)
+	if err != nil {
+		return nil, fmt.Errorf("could not add witness for kind '%v': %v", secret.Kind, err)
+	}
+	return witnessProofs, nil
+}
+
+// SendLocked returns proofs that are locked with the spending condition
+// of a custom NUT-10 kind. The secrets of the proofs are created by
+// the ConditionHandler of the kind in the config of the wallet.
+func (w *Wallet) SendLocked(
+	amount uint64,
+	mintURL string,
+	condition nut10.SpendingCondition,
+	includeFees bool,
+) (cashu.Proofs, error) {
+	if !nut10.IsCustomKind(condition.Kind) {
+		return nil, fmt.Errorf("kind '%v' is not a custom kind. Use SendToPubkey or HTLCLockedProofs", condition.Kind)
+	}
+	if _, err := w.conditionHandler(condition.Kind); err != nil {
+		return nil, err
+	}
+	selectedMint, ok := w.mints[mintURL]
+	if !ok {
+		return nil, ErrMintNotExist
+	}
+	if err := w.checkSpendingPolicy(mintURL, amount); err != nil {
+		return nil, err
+	}
+
+	balance := w.GetBalanceByMints()[mintURL]
+	lockedProofs, err := w.swapToSend(amount, &selectedMint, &condition, includeFees)
+	if err != nil {
+		return nil, err
+	}
+	w.recordSpent(storage.SendTransaction, mintURL, lockedProofs.Amount(), balance, condition.Data)
+
+	return lockedProofs, nil
+}
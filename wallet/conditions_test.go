@@ -0,0 +1,98 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"testing"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/crypto"
+)
+
+// escrowHandler adds the arbiter to the secrets and signs with a fixed witness
+type escrowHandler struct {
+	secrets int
+}
+
+func (eh *escrowHandler) NewSecret(condition nut10.SpendingCondition) (string, error) {
+	eh.secrets++
+	condition.Tags = append(condition.Tags, []string{"arbiter", "arbiter-key"})
+	return nut10.NewSecretFromSpendingCondition(condition)
+}
+
+func (eh *escrowHandler) AddWitness(proofs cashu.Proofs, secret nut10.WellKnownSecret) (cashu.Proofs, error) {
+	for i := range proofs {
+		proofs[i].Witness = "escrow-witness:" + secret.Data.Data
+	}
+	return proofs, nil
+}
+
+func TestConditionHandlers(t *testing.T) {
+	kind := nut10.MinCustomKind
+	if err := nut10.RegisterKind(kind, "ESCROW"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkConditionHandlers(map[nut10.SecretKind]ConditionHandler{nut10.P2PK: &escrowHandler{}}); err == nil {
+		t.Fatal("expected error for handler of built-in kind")
+	}
+	if err := checkConditionHandlers(map[nut10.SecretKind]ConditionHandler{kind: nil}); err == nil {
+		t.Fatal("expected error for nil handler")
+	}
+
+	handler := &escrowHandler{}
+	w := &Wallet{conditionHandlers: map[nut10.SecretKind]ConditionHandler{kind: handler}}
+	if err := checkConditionHandlers(w.conditionHandlers); err != nil {
+		t.Fatalf("unexpected error checking handlers: %v", err)
+	}
+
+	condition := nut10.SpendingCondition{Kind: kind, Data: "buyer-key"}
+	outputs, secrets, _, err := w.blindedMessagesFromSpendingCondition([]uint64{8, 2}, "009a1f293253e41e", condition)
+	if err != nil {
+		t.Fatalf("unexpected error creating outputs: %v", err)
+	}
+	if len(outputs) != 2 || handler.secrets != 2 {
+		t.Fatalf("expected 2 outputs with secrets from the handler but got %v and %v", len(outputs), handler.secrets)
+	}
+
+	proofs := make(cashu.Proofs, len(secrets))
+	for i, secret := range secrets {
+		nut10Secret, err := nut10.DeserializeSecret(secret)
+		if err != nil {
+			t.Fatalf("unexpected error deserializing secret: %v", err)
+		}
+		if nut10Secret.Kind != kind || len(nut10Secret.Data.Tags) != 1 {
+			t.Fatalf("unexpected secret from handler: %v", secret)
+		}
+		proofs[i] = cashu.Proof{Amount: outputs[i].Amount, Id: outputs[i].Id, Secret: secret}
+	}
+
+	keyset := &crypto.WalletKeyset{Id: "009a1f293253e41e"}
+	witnessProofs, _, err := w.receiveInputs(proofs, keyset)
+	if err != nil {
+		t.Fatalf("unexpected error adding witness: %v", err)
+	}
+	for _, proof := range witnessProofs {
+		if proof.Witness != "escrow-witness:buyer-key" {
+			t.Fatalf("expected witness from handler but got '%v'", proof.Witness)
+		}
+	}
+
+	// kinds without a handler can't be created or spent
+	otherKind := nut10.MinCustomKind + 1
+	if err := nut10.RegisterKind(otherKind, "OTHER"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := w.blindedMessagesFromSpendingCondition([]uint64{8}, keyset.Id,
+		nut10.SpendingCondition{Kind: otherKind}); err == nil {
+		t.Fatal("expected error creating outputs for kind without handler")
+	}
+	secret, _ := nut10.NewSecretFromSpendingCondition(nut10.SpendingCondition{Kind: otherKind})
+	if _, _, err := w.receiveInputs(cashu.Proofs{{Amount: 8, Id: keyset.Id, Secret: secret}}, keyset); err == nil {
+		t.Fatal("expected error receiving proofs of kind without handler")
+	}
+	if _, err := w.SendLocked(8, "http://127.0.0.1:3338", nut10.SpendingCondition{Kind: otherKind}, false); err == nil {
+		t.Fatal("expected error sending proofs of kind without handler")
+	}
+}
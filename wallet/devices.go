@@ -0,0 +1,195 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut09"
+	"github.com/elnosh/gonuts/cashu/nuts/nut13"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/client"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// CounterLeaseSize is the number of counters of a keyset checked with the
+// mint at once. The counters are checked again when fewer than half of them
+// are left so that the outputs of an operation are within checked counters.
+const CounterLeaseSize = 100
+
+// CounterConflict is found when the mint had signed outputs for counters the
+// wallet had not used yet. Another device is using the same seed and outputs
+// from those counters would be rejected by the mint as already signed.
+type CounterConflict struct {
+	Mint     string
+	KeysetId string
+	// counter of the keyset in the wallet and the counter
+	// after the outputs the other device had signed
+	Counter     uint32
+	NextCounter uint32
+}
+
+// Fingerprint returns an id for the seed of the wallet. It is the same on
+// every device that uses the seed so it can be compared to tell if two
+// wallets share it. It is the BIP32 fingerprint of the master key.
+func (w *Wallet) Fingerprint() string {
+	pubkey, err := w.masterKey.ECPubKey()
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(btcutil.Hash160(pubkey.SerializeCompressed())[:4])
+}
+
+// CounterConflicts returns the conflicts with other devices found
+// since the wallet was loaded. Counters were already moved past them.
+func (w *Wallet) CounterConflicts() []CounterConflict {
+	return w.counterConflicts
+}
+
+// CheckCounters asks the mint whether it has signed outputs from the next
+// counters of the active keyset of the mint. If it has, another device is
+// using the same seed and the counter is moved past its outputs.
+func (w *Wallet) CheckCounters(mint string) (*CounterConflict, error) {
+	walletMint, ok := w.mints[mint]
+	if !ok {
+		return nil, ErrMintNotExist
+	}
+	return w.checkCounter(walletMint.activeKeyset)
+}
+
+// checkCounter scans the counters of the keyset from the current one and
+// saves a new lease from the counter after the last output signed
+func (w *Wallet) checkCounter(keyset crypto.WalletKeyset) (*CounterConflict, error) {
+	return w.scanCounter(keyset, nil)
+}
+
+// scanCounter is checkCounter with onBatch called with
+// the proofs restored from the outputs that were signed
+func (w *Wallet) scanCounter(
+	keyset crypto.WalletKeyset,
+	onBatch func([]nut13.RestoredProof) error,
+) (*CounterConflict, error) {
+	counter := w.db.GetKeysetCounter(keyset.Id)
+	restore := func(outputs cashu.BlindedMessages) (cashu.BlindedMessages, cashu.BlindedSignatures, error) {
+		restoreResponse, err := client.PostRestore(keyset.MintURL, nut09.PostRestoreRequest{Outputs: outputs})
+		if err != nil {
+			return nil, nil, fmt.Errorf("error restoring signatures from mint '%v': %v", keyset.MintURL, err)
+		}
+		return restoreResponse.Outputs, restoreResponse.Signatures, nil
+	}
+	scanResult, err := nut13.Scan(w.masterKey, keyset.Id, keyset.PublicKeys, restore, nut13.ScanConfig{
+		StartCounter: counter,
+		BatchSize:    CounterLeaseSize,
+		GapLimit:     1,
+		OnBatch:      onBatch,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var conflict *CounterConflict
+	if scanResult.NextCounter > counter {
+		if err := w.db.IncrementKeysetCounter(keyset.Id, scanResult.NextCounter-counter); err != nil {
+			return nil, fmt.Errorf("error incrementing keyset counter: %v", err)
+		}
+		// outputs of operations of this wallet that did not complete
+		// are from these counters too and are not a conflict
+		if scanResult.NextCounter > w.pendingCounterEnd(keyset.Id, counter) {
+			conflict = &CounterConflict{
+				Mint:        keyset.MintURL,
+				KeysetId:    keyset.Id,
+				Counter:     counter,
+				NextCounter: scanResult.NextCounter,
+			}
+			w.counterConflicts = append(w.counterConflicts, *conflict)
+			w.logErrorf("mint '%v' had signed outputs for counters %v to %v of keyset '%v'. "+
+				"Another device is using the same seed. Moved counter to %v",
+				keyset.MintURL, counter, scanResult.NextCounter-1, keyset.Id, scanResult.NextCounter)
+		}
+	}
+
+	lease := storage.CounterLease{
+		KeysetId:  keyset.Id,
+		Mint:      keyset.MintURL,
+		Start:     scanResult.NextCounter,
+		End:       scanResult.NextCounter + CounterLeaseSize,
+		CheckedAt: time.Now().Unix(),
+	}
+	if err := w.db.SaveCounterLease(lease); err != nil {
+		return nil, err
+	}
+	return conflict, nil
+}
+
+// pendingCounterEnd returns the counter of the keyset after the outputs of
+// the operations in the journal, or the counter if there are none
+func (w *Wallet) pendingCounterEnd(keysetId string, counter uint32) uint32 {
+	for _, operation := range w.db.GetOperations() {
+		if operation.KeysetId == keysetId && operation.CounterEnd > counter {
+			counter = operation.CounterEnd
+		}
+	}
+	return counter
+}
+
+// leaseCounter checks the counters of the keyset with the mint if they
+// were not checked or the lease is running out. Errors are only logged
+// so that the wallet can still be used if the mint can't be reached.
+func (w *Wallet) leaseCounter(keysetId string) {
+	if !w.checkCounters {
+		return
+	}
+	counter := w.db.GetKeysetCounter(keysetId)
+	lease := w.db.GetCounterLease(keysetId)
+	if lease != nil && lease.Start <= counter && counter+CounterLeaseSize/2 <= lease.End {
+		return
+	}
+
+	keyset := w.db.GetKeyset(keysetId)
+	if keyset == nil {
+		return
+	}
+	if _, err := w.checkCounter(*keyset); err != nil {
+		w.logErrorf("could not check counters of keyset '%v' with mint '%v': %v", keysetId, keyset.MintURL, err)
+	}
+}
+
+// recoverSignedOutputs restores (NUT-09) the outputs of the keyset that the mint
+// signed from the counter of the wallet, i.e after the mint rejected outputs as
+// already signed. The proofs from them that are unspent are saved and the counter
+// is moved past them so that the next outputs are not rejected again.
+func (w *Wallet) recoverSignedOutputs(keyset crypto.WalletKeyset) (*CounterConflict, error) {
+	saveUnspent := func(restored []nut13.RestoredProof) error {
+		return saveUnspentProofs(w.db, keyset.MintURL, restored)
+	}
+	return w.scanCounter(keyset, saveUnspent)
+}
+
+// retryOnSignedOutputs runs the operation and if the mint rejected its outputs
+// as already signed, it recovers the outputs signed from the counter of the
+// active keyset of the mint in the unit and runs the operation once more. The
+// operation has to create its outputs from the counter in the db when it runs.
+func retryOnSignedOutputs[T any](w *Wallet, mint string, unit cashu.Unit, operation func() (T, error)) (T, error) {
+	result, err := operation()
+	var cashuErr cashu.Error
+	if !errors.As(err, &cashuErr) || cashuErr.Code != cashu.BlindedMessageAlreadySignedErrCode {
+		return result, err
+	}
+	walletMint, ok := w.getMint(mint, unit)
+	if !ok {
+		return result, err
+	}
+
+	keyset := walletMint.activeKeyset
+	w.logInfof("mint '%v' rejected outputs of keyset '%v' as already signed. Recovering signed outputs",
+		mint, keyset.Id)
+	if _, recoverErr := w.recoverSignedOutputs(keyset); recoverErr != nil {
+		w.logErrorf("could not recover outputs of keyset '%v' signed by mint '%v': %v", keyset.Id, mint, recoverErr)
+		return result, err
+	}
+	w.logInfof("moved counter of keyset '%v' to %v. Retrying", keyset.Id, w.db.GetKeysetCounter(keyset.Id))
+	return operation()
+}
@@ -0,0 +1,280 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut09"
+	"github.com/elnosh/gonuts/cashu/nuts/nut13"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestFingerprint(t *testing.T) {
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	sameSeed, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	otherSeed, _ := hdkeychain.GenerateSeed(32)
+	other, _ := hdkeychain.NewMaster(otherSeed, &chaincfg.MainNetParams)
+
+	fingerprint := (&Wallet{masterKey: master}).Fingerprint()
+	if len(fingerprint) != 8 {
+		t.Fatalf("expected fingerprint of 8 hex characters but got '%v'", fingerprint)
+	}
+	if (&Wallet{masterKey: sameSeed}).Fingerprint() != fingerprint {
+		t.Fatal("expected same fingerprint for wallets with the same seed")
+	}
+	if (&Wallet{masterKey: other}).Fingerprint() == fingerprint {
+		t.Fatal("expected different fingerprint for wallets with different seeds")
+	}
+}
+
+// newTestKeyset generates a keyset of the unit and the keyset of the wallet for it.
+// The mint URL of the wallet keyset has to be set by the caller.
+func newTestKeyset(
+	t *testing.T,
+	master *hdkeychain.ExtendedKey,
+	unit cashu.Unit,
+	inputFeePpk uint,
+) (*crypto.MintKeyset, crypto.WalletKeyset) {
+	keyset, err := crypto.GenerateUnitKeyset(master, unit, 0, inputFeePpk)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+	walletKeyset := crypto.WalletKeyset{
+		Id:          keyset.Id,
+		Unit:        keyset.Unit,
+		Active:      true,
+		PublicKeys:  make(map[uint64]*secp256k1.PublicKey),
+		InputFeePpk: keyset.InputFeePpk,
+	}
+	for amount, key := range keyset.Keys {
+		walletKeyset.PublicKeys[amount] = key.PublicKey
+	}
+	return keyset, walletKeyset
+}
+
+// newTestWallet returns a sat wallet with an in-memory db
+// that has the keysets as the active keysets of their mints
+func newTestWallet(t *testing.T, master *hdkeychain.ExtendedKey, keysets ...crypto.WalletKeyset) *Wallet {
+	w := &Wallet{
+		db:        storage.NewMemoryDB(),
+		masterKey: master,
+		unit:      cashu.Sat,
+		mints:     make(map[string]walletMint),
+	}
+	for _, keyset := range keysets {
+		if err := w.db.SaveKeyset(&keyset); err != nil {
+			t.Fatalf("error saving keyset: %v", err)
+		}
+		unit, err := cashu.UnitFromString(keyset.Unit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.mints[keyset.MintURL] = walletMint{mintURL: keyset.MintURL, activeKeyset: keyset, unit: unit}
+	}
+	return w
+}
+
+// restoreMint is a fake mint with a sat keyset derived from the same seed
+// as the wallet. It restores (NUT-09) the outputs of the first signedCounters
+// counters of the keyset as already signed and serves the other paths with
+// the handlers passed.
+type restoreMint struct {
+	*httptest.Server
+	master          *hdkeychain.ExtendedKey
+	keyset          *crypto.MintKeyset
+	walletKeyset    crypto.WalletKeyset
+	restoreRequests int
+}
+
+func newRestoreMint(t *testing.T, signedCounters int, handlers map[string]http.HandlerFunc) *restoreMint {
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	keyset, walletKeyset := newTestKeyset(t, master, cashu.Sat, 0)
+
+	keysetPath, err := nut13.DeriveKeysetPath(master, keyset.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedOutputs, err := nut13.DeriveOutputs(keysetPath, keyset.Id, 0, signedCounters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := make(map[string]bool)
+	for _, output := range signedOutputs {
+		signed[output.Output.B_] = true
+	}
+
+	rm := &restoreMint{master: master, keyset: keyset}
+	rm.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handler, ok := handlers[r.URL.Path]; ok {
+			handler(w, r)
+			return
+		}
+		if r.URL.Path != "/v1/restore" {
+			http.NotFound(w, r)
+			return
+		}
+		rm.restoreRequests++
+		var req nut09.PostRestoreRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		var res nut09.PostRestoreResponse
+		for _, output := range req.Outputs {
+			if !signed[output.B_] {
+				continue
+			}
+			B_bytes, _ := hex.DecodeString(output.B_)
+			B_, _ := secp256k1.ParsePubKey(B_bytes)
+			C_ := crypto.SignBlindedMessage(B_, keyset.Keys[1].PrivateKey)
+			res.Outputs = append(res.Outputs, output)
+			res.Signatures = append(res.Signatures, cashu.BlindedSignature{
+				Amount: 1,
+				Id:     keyset.Id,
+				C_:     hex.EncodeToString(C_.SerializeCompressed()),
+			})
+		}
+		json.NewEncoder(w).Encode(&res)
+	}))
+	t.Cleanup(rm.Close)
+
+	walletKeyset.MintURL = rm.URL
+	rm.walletKeyset = walletKeyset
+	return rm
+}
+
+func TestCounterConflicts(t *testing.T) {
+	// another device with the same seed used the first 30 counters
+	mint := newRestoreMint(t, 30, nil)
+	keyset := mint.walletKeyset
+	w := newTestWallet(t, mint.master, keyset)
+	w.checkCounters = true
+	db := w.db
+
+	if counter := w.counterForKeyset(keyset.Id); counter != 30 {
+		t.Fatalf("expected counter to be moved to 30 but got %v", counter)
+	}
+	conflicts := w.CounterConflicts()
+	expectedConflict := CounterConflict{Mint: mint.URL, KeysetId: keyset.Id, Counter: 0, NextCounter: 30}
+	if len(conflicts) != 1 || conflicts[0] != expectedConflict {
+		t.Fatalf("expected conflict '%+v' but got '%+v'", expectedConflict, conflicts)
+	}
+	lease := db.GetCounterLease(keyset.Id)
+	if lease == nil || lease.Start != 30 || lease.End != 30+CounterLeaseSize {
+		t.Fatalf("unexpected counter lease '%+v'", lease)
+	}
+
+	// counters within the lease are not checked again
+	requests := mint.restoreRequests
+	if err := db.IncrementKeysetCounter(keyset.Id, 10); err != nil {
+		t.Fatal(err)
+	}
+	if counter := w.counterForKeyset(keyset.Id); counter != 40 || mint.restoreRequests != requests {
+		t.Fatalf("expected counter of 40 without checking the mint but got %v", counter)
+	}
+
+	// checked again when the lease is running out
+	if err := db.IncrementKeysetCounter(keyset.Id, CounterLeaseSize/2); err != nil {
+		t.Fatal(err)
+	}
+	w.counterForKeyset(keyset.Id)
+	if mint.restoreRequests == requests {
+		t.Fatal("expected counters to be checked again")
+	}
+	if len(w.CounterConflicts()) != 1 {
+		t.Fatalf("expected no new conflicts but got '%+v'", w.CounterConflicts())
+	}
+
+	// counters used by operations of the wallet that did not complete are not a conflict
+	w2 := &Wallet{db: storage.NewMemoryDB(), masterKey: mint.master, checkCounters: true}
+	if err := w2.db.SaveKeyset(&keyset); err != nil {
+		t.Fatal(err)
+	}
+	if err := w2.db.SaveOperation(storage.Operation{Id: "op1", KeysetId: keyset.Id, CounterEnd: 30}); err != nil {
+		t.Fatal(err)
+	}
+	if counter := w2.counterForKeyset(keyset.Id); counter != 30 || len(w2.CounterConflicts()) != 0 {
+		t.Fatalf("expected counter of 30 without conflicts but got %v, '%+v'", counter, w2.CounterConflicts())
+	}
+}
+
+func TestRetryOnSignedOutputs(t *testing.T) {
+	var stateChecks int
+	handlers := map[string]http.HandlerFunc{
+		"/v1/checkstate": func(w http.ResponseWriter, r *http.Request) {
+			stateChecks++
+			var req nut07.PostCheckStateRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			// half of the proofs restored were already spent
+			var res nut07.PostCheckStateResponse
+			for i, Y := range req.Ys {
+				state := nut07.Unspent
+				if i%2 == 1 {
+					state = nut07.Spent
+				}
+				res.States = append(res.States, nut07.ProofState{Y: Y, State: state})
+			}
+			json.NewEncoder(w).Encode(&res)
+		},
+	}
+	// the counter of the wallet was lost after it used the first 20 counters
+	mint := newRestoreMint(t, 20, handlers)
+	keyset := mint.walletKeyset
+	w := newTestWallet(t, mint.master, keyset)
+	db := w.db
+
+	// errors other than outputs already signed are not retried
+	var attempts int
+	_, err := retryOnSignedOutputs(w, mint.URL, cashu.Sat, func() (uint32, error) {
+		attempts++
+		return 0, cashu.InsufficientProofsAmount
+	})
+	if !errors.Is(err, cashu.InsufficientProofsAmount) || attempts != 1 || stateChecks != 0 {
+		t.Fatalf("expected error '%v' after 1 attempt but got '%v' after %v", cashu.InsufficientProofsAmount, err, attempts)
+	}
+
+	attempts = 0
+	counter, err := retryOnSignedOutputs(w, mint.URL, cashu.Sat, func() (uint32, error) {
+		attempts++
+		counter := w.db.GetKeysetCounter(keyset.Id)
+		if counter < 20 {
+			return 0, fmt.Errorf("could not swap proofs: %w", cashu.BlindedMessageAlreadySigned)
+		}
+		return counter, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if attempts != 2 || counter != 20 {
+		t.Fatalf("expected retry with counter of 20 but got counter %v after %v attempts", counter, attempts)
+	}
+	if balance := db.GetProofsByKeysetId(keyset.Id).Amount(); balance != 10 {
+		t.Fatalf("expected the 10 unspent proofs recovered to be saved but got %v", balance)
+	}
+	if len(w.CounterConflicts()) != 1 {
+		t.Fatalf("expected counter conflict but got '%+v'", w.CounterConflicts())
+	}
+
+	// the operation is retried only once
+	attempts = 0
+	_, err = retryOnSignedOutputs(w, mint.URL, cashu.Sat, func() (uint32, error) {
+		attempts++
+		return 0, cashu.BlindedMessageAlreadySigned
+	})
+	if !errors.Is(err, cashu.BlindedMessageAlreadySigned) || attempts != 2 {
+		t.Fatalf("expected error '%v' after 2 attempts but got '%v' after %v",
+			cashu.BlindedMessageAlreadySigned, err, attempts)
+	}
+}
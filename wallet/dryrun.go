@@ -0,0 +1,207 @@
+package wallet
+
+import (
+	"errors"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut03"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+)
+
+// DryRun has the requests the wallet would make to the mint for an operation.
+// It is computed from the current state of the wallet without making
+// the requests or saving anything so it can be used to check the
+// selection of proofs, the split of outputs and fees of an operation.
+type DryRun struct {
+	Mint string
+	// proofs that would be used. These are the inputs of the swap
+	// if one is needed or the proofs sent or melted otherwise
+	Inputs cashu.Proofs
+	// swap to get proofs for the amount. Nil if the proofs
+	// in the wallet already add up to the amount
+	Swap *nut03.PostSwapRequest
+	// amounts of the outputs in the swap that would be sent or melted.
+	// The rest of the outputs are change kept in the wallet
+	SendAmounts []uint64
+	// melt request of a melt. If a swap is needed first, its inputs
+	// will be the proofs for SendAmounts from the swap and are not set.
+	// When receiving to the trusted mint, it melts the proofs received
+	// and its quote is not set since it would be requested when receiving
+	Melt *nut05.PostMeltBolt11Request
+	// mint the proofs received would be moved to with swapToTrusted. The
+	// lightning fees of the move are not included in Fees since they are
+	// only known after requesting the quotes
+	TrustedMint string
+	// input fees paid to the mint for the requests
+	Fees uint64
+	// keyset of the outputs and range of its counter that would be used
+	KeysetId     string
+	CounterStart uint32
+	CounterEnd   uint32
+}
+
+// SendDryRun returns the requests that Send would make
+// for the amount without making them
+func (w *Wallet) SendDryRun(amount uint64, mintURL string, includeFees bool) (*DryRun, error) {
+	selectedMint, ok := w.mints[mintURL]
+	if !ok {
+		return nil, ErrMintNotExist
+	}
+
+	dryRun := w.newDryRun(&selectedMint)
+	if err := w.dryRunProofsForAmount(dryRun, amount, &selectedMint, includeFees); err != nil {
+		return nil, err
+	}
+	return dryRun, nil
+}
+
+// MeltDryRun returns the requests that Melt would make
+// for the quote without making them
+func (w *Wallet) MeltDryRun(quoteId string) (*DryRun, error) {
+	quote := w.db.GetMeltQuoteById(quoteId)
+	if quote == nil {
+		return nil, ErrQuoteNotFound
+	}
+	if quote.State == nut05.Paid {
+		return nil, errors.New("request is already paid")
+	}
+	if quote.State == nut05.Pending {
+		return nil, errors.New("quote is pending")
+	}
+
+	mint, ok := w.mints[quote.Mint]
+	if !ok {
+		return nil, ErrMintNotExist
+	}
+	dryRun := w.newDryRun(&mint)
+	if err := w.dryRunProofsForAmount(dryRun, quote.Amount+quote.FeeReserve, &mint, true); err != nil {
+		return nil, err
+	}
+
+	counter := dryRun.CounterEnd
+	outputs, _, _, err := w.createMeltChangeOutputs(quote.FeeReserve, dryRun.KeysetId, &counter)
+	if err != nil {
+		return nil, err
+	}
+	dryRun.CounterEnd = counter
+
+	dryRun.Melt = &nut05.PostMeltBolt11Request{Quote: quote.QuoteId, Outputs: outputs}
+	if dryRun.Swap == nil {
+		dryRun.Melt.Inputs = dryRun.Inputs
+	} else {
+		// proofs from the swap are from the active keyset
+		dryRun.Fees += uint64(feesForCount(len(dryRun.SendAmounts), &mint.activeKeyset))
+	}
+
+	return dryRun, nil
+}
+
+// ReceiveDryRun returns the swap that Receive would make at the mint
+// of the token without making it. If the mint is not in the wallet,
+// its keysets are fetched but the mint is not added. With swapToTrusted,
+// it returns the melt of the proofs to move them to the trusted mint
+// and the outputs that would be minted there are at most the amount
+// of the proofs minus input fees.
+func (w *Wallet) ReceiveDryRun(token cashu.Token, swapToTrusted bool) (*DryRun, error) {
+	tokenMint := token.Mint()
+	mint, ok := w.mints[tokenMint]
+	if !ok {
+		activeKeyset, err := GetMintActiveKeyset(tokenMint, w.unit)
+		if err != nil {
+			return nil, err
+		}
+		inactiveKeysets, err := GetMintInactiveKeysets(tokenMint, w.unit)
+		if err != nil {
+			return nil, err
+		}
+		mint = walletMint{mintURL: tokenMint, activeKeyset: *activeKeyset, inactiveKeysets: inactiveKeysets}
+	}
+
+	proofs, nut10Secret, err := w.receiveInputs(token.Proofs(), &mint.activeKeyset)
+	if err != nil {
+		return nil, err
+	}
+
+	// if mint in token is already the default mint, do not swap to trusted
+	if _, ok := w.mints[tokenMint]; ok && tokenMint == w.defaultMint {
+		swapToTrusted = false
+	}
+	if swapToTrusted {
+		trustedMint, ok := w.mints[w.defaultMint]
+		if !ok {
+			return nil, ErrMintNotExist
+		}
+		fees := uint64(feesForProofs(proofs, &mint))
+		if proofs.Amount() <= fees {
+			return nil, errors.New("amount is not enough to pay fees")
+		}
+
+		dryRun := w.newDryRun(&trustedMint)
+		dryRun.Mint = tokenMint
+		dryRun.TrustedMint = trustedMint.mintURL
+		dryRun.Inputs = proofs
+		dryRun.Melt = &nut05.PostMeltBolt11Request{Inputs: proofs}
+		dryRun.Fees = fees
+		dryRun.CounterEnd += uint32(len(cashu.AmountSplit(proofs.Amount() - fees)))
+		return dryRun, nil
+	}
+
+	req, err := w.createReceiveSwapRequest(proofs, nut10Secret, &mint)
+	if err != nil {
+		return nil, err
+	}
+
+	dryRun := w.newDryRun(&mint)
+	dryRun.Inputs = proofs
+	dryRun.Swap = &nut03.PostSwapRequest{Inputs: req.inputs, Outputs: req.outputs}
+	dryRun.Fees = uint64(feesForProofs(proofs, &mint))
+	dryRun.CounterEnd += uint32(len(req.outputs))
+	return dryRun, nil
+}
+
+func (w *Wallet) newDryRun(mint *walletMint) *DryRun {
+	counter := w.counterForKeyset(mint.activeKeyset.Id)
+	return &DryRun{
+		Mint:         mint.mintURL,
+		KeysetId:     mint.activeKeyset.Id,
+		CounterStart: counter,
+		CounterEnd:   counter,
+	}
+}
+
+// dryRunProofsForAmount sets the proofs that getProofsForAmount would
+// select and the swap it would make if they do not add up to the amount
+func (w *Wallet) dryRunProofsForAmount(
+	dryRun *DryRun,
+	amount uint64,
+	mint *walletMint,
+	includeFees bool,
+) error {
+	selectedProofs, err := w.selectProofsForAmount(amount, mint, includeFees)
+	if err != nil {
+		return err
+	}
+
+	var fees uint64 = 0
+	if includeFees {
+		fees = uint64(feesForProofs(selectedProofs, mint))
+	}
+	if selectedProofs.Amount() == amount+fees {
+		dryRun.Inputs = selectedProofs
+		dryRun.Fees = fees
+		return nil
+	}
+
+	req, err := w.createSwapToSendRequest(amount, mint, &mint.activeKeyset, nil, includeFees)
+	if err != nil {
+		return err
+	}
+	dryRun.Inputs = req.inputs
+	dryRun.Swap = &nut03.PostSwapRequest{Inputs: req.inputs, Outputs: req.outputs}
+	for _, msg := range req.send {
+		dryRun.SendAmounts = append(dryRun.SendAmounts, msg.Amount)
+	}
+	dryRun.Fees = uint64(feesForProofs(req.inputs, mint))
+	dryRun.CounterEnd = req.counter
+	return nil
+}
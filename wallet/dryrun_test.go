@@ -0,0 +1,168 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestDryRun(t *testing.T) {
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	mintURL := "http://localhost:3338"
+	keyset, walletKeyset := newTestKeyset(t, master, cashu.Sat, 100)
+	walletKeyset.MintURL = mintURL
+	otherMintURL := "http://localhost:3339"
+	otherSeed, _ := hdkeychain.GenerateSeed(32)
+	otherMaster, _ := hdkeychain.NewMaster(otherSeed, &chaincfg.MainNetParams)
+	otherKeyset, otherWalletKeyset := newTestKeyset(t, otherMaster, cashu.Sat, 0)
+	otherWalletKeyset.MintURL = otherMintURL
+	w := newTestWallet(t, master, walletKeyset, otherWalletKeyset)
+	w.defaultMint = mintURL
+	db := w.db
+
+	proofs := cashu.Proofs{
+		signProof(t, keyset, 8, "secret1", false),
+		signProof(t, keyset, 4, "secret2", false),
+		signProof(t, keyset, 2, "secret3", false),
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	// proofs add up to amount so no swap needed
+	dryRun, err := w.SendDryRun(12, mintURL, false)
+	if err != nil {
+		t.Fatalf("unexpected error in send dry run: %v", err)
+	}
+	if dryRun.Swap != nil {
+		t.Fatalf("expected no swap but got '%+v'", dryRun.Swap)
+	}
+	if dryRun.Inputs.Amount() != 12 {
+		t.Fatalf("expected inputs of 12 but got %v", dryRun.Inputs.Amount())
+	}
+	if dryRun.CounterEnd != dryRun.CounterStart {
+		t.Fatalf("expected no counters used but got range %v-%v", dryRun.CounterStart, dryRun.CounterEnd)
+	}
+
+	dryRun, err = w.SendDryRun(5, mintURL, false)
+	if err != nil {
+		t.Fatalf("unexpected error in send dry run: %v", err)
+	}
+	if dryRun.Swap == nil {
+		t.Fatal("expected swap in send dry run")
+	}
+	swapOutputs := uint32(len(dryRun.Swap.Outputs))
+	if dryRun.CounterEnd-dryRun.CounterStart != swapOutputs {
+		t.Fatalf("expected %v counters used but got %v", swapOutputs, dryRun.CounterEnd-dryRun.CounterStart)
+	}
+	if dryRun.Swap.Outputs.Amount() != dryRun.Inputs.Amount()-dryRun.Fees {
+		t.Fatalf("expected outputs of %v but got %v",
+			dryRun.Inputs.Amount()-dryRun.Fees, dryRun.Swap.Outputs.Amount())
+	}
+	var sendAmount uint64
+	for _, amount := range dryRun.SendAmounts {
+		sendAmount += amount
+	}
+	if sendAmount != 5 {
+		t.Fatalf("expected send amount of 5 but got %v", sendAmount)
+	}
+
+	if err := db.SaveMeltQuote(storage.MeltQuote{
+		QuoteId:    "quote1",
+		Mint:       mintURL,
+		State:      nut05.Unpaid,
+		Amount:     10,
+		FeeReserve: 2,
+	}); err != nil {
+		t.Fatalf("error saving melt quote: %v", err)
+	}
+	dryRun, err = w.MeltDryRun("quote1")
+	if err != nil {
+		t.Fatalf("unexpected error in melt dry run: %v", err)
+	}
+	if dryRun.Melt == nil || dryRun.Melt.Quote != "quote1" {
+		t.Fatalf("expected melt request for quote 'quote1' but got '%+v'", dryRun.Melt)
+	}
+	if len(dryRun.Melt.Outputs) != calculateBlankOutputs(2) {
+		t.Fatalf("expected %v blank outputs but got %v", calculateBlankOutputs(2), len(dryRun.Melt.Outputs))
+	}
+	var usedCounters uint32 = uint32(len(dryRun.Melt.Outputs))
+	if dryRun.Swap != nil {
+		usedCounters += uint32(len(dryRun.Swap.Outputs))
+	}
+	if dryRun.CounterEnd-dryRun.CounterStart != usedCounters {
+		t.Fatalf("expected %v counters used but got %v", usedCounters, dryRun.CounterEnd-dryRun.CounterStart)
+	}
+
+	if err := db.SaveMeltQuote(storage.MeltQuote{
+		QuoteId: "quote2",
+		Mint:    "http://localhost:3340",
+		State:   nut05.Unpaid,
+		Amount:  10,
+	}); err != nil {
+		t.Fatalf("error saving melt quote: %v", err)
+	}
+	if _, err := w.MeltDryRun("quote2"); !errors.Is(err, ErrMintNotExist) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintNotExist, err)
+	}
+
+	// tokens from the trusted mint are swapped there
+	token, _ := cashu.NewTokenV4(cashu.Proofs{signProof(t, keyset, 4, "secret4", false)}, mintURL, cashu.Sat, false)
+	dryRun, err = w.ReceiveDryRun(token, true)
+	if err != nil {
+		t.Fatalf("unexpected error in receive dry run: %v", err)
+	}
+	if dryRun.Swap == nil || dryRun.Melt != nil || len(dryRun.TrustedMint) > 0 {
+		t.Fatalf("expected swap at the mint of the token but got '%+v'", dryRun)
+	}
+
+	otherProofs := cashu.Proofs{
+		signProof(t, otherKeyset, 8, "secret5", false),
+		signProof(t, otherKeyset, 8, "secret6", false),
+	}
+	token, _ = cashu.NewTokenV4(otherProofs, otherMintURL, cashu.Sat, false)
+	dryRun, err = w.ReceiveDryRun(token, false)
+	if err != nil {
+		t.Fatalf("unexpected error in receive dry run: %v", err)
+	}
+	if dryRun.Swap == nil || dryRun.Mint != otherMintURL || dryRun.KeysetId != otherKeyset.Id {
+		t.Fatalf("expected swap at the mint of the token but got '%+v'", dryRun)
+	}
+
+	dryRun, err = w.ReceiveDryRun(token, true)
+	if err != nil {
+		t.Fatalf("unexpected error in receive dry run: %v", err)
+	}
+	if dryRun.Swap != nil || dryRun.Melt == nil || dryRun.Melt.Inputs.Amount() != 16 {
+		t.Fatalf("expected melt of the proofs received but got '%+v'", dryRun)
+	}
+	if dryRun.Mint != otherMintURL || dryRun.TrustedMint != mintURL || dryRun.KeysetId != keyset.Id {
+		t.Fatalf("expected proofs from '%v' moved to keyset '%v' of '%v' but got '%+v'",
+			otherMintURL, keyset.Id, mintURL, dryRun)
+	}
+	if dryRun.CounterEnd-dryRun.CounterStart != 1 {
+		t.Fatalf("expected 1 counter used but got %v", dryRun.CounterEnd-dryRun.CounterStart)
+	}
+
+	// nothing was changed in the wallet
+	if len(db.GetProofs()) != len(proofs) {
+		t.Fatalf("expected %v proofs in wallet but got %v", len(proofs), len(db.GetProofs()))
+	}
+	if len(db.GetPendingProofs()) != 0 {
+		t.Fatalf("expected no pending proofs but got %v", len(db.GetPendingProofs()))
+	}
+	if counter := db.GetKeysetCounter(keyset.Id); counter != 0 {
+		t.Fatalf("expected keyset counter of 0 but got %v", counter)
+	}
+	if len(db.GetOperations()) != 0 {
+		t.Fatalf("expected no operations in journal but got %v", len(db.GetOperations()))
+	}
+}
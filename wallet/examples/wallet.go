@@ -43,6 +43,10 @@ func main() {
 	swapToTrustedMint := true
 	amountReceived, err := wallet.Receive(receiveToken, swapToTrustedMint)
 
+	// Send and receive serialized tokens with the default options
+	tokenString, err := wallet.SendString(21, mint)
+	amountReceived, err = wallet.ReceiveString("cashuBo2FteBtodHRwczovL...")
+
 	// Melt (pay invoice)
 	meltQuote, err := wallet.RequestMeltQuote("lnbc100n1pja0w9pdqqx...", mint)
 	meltResult, err := wallet.Melt(meltQuote.Quote)
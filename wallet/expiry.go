@@ -0,0 +1,188 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// DefaultQuoteRenewalWindow is how long before they expire Watch
+// renews the mint quotes that were marked for renewal
+const DefaultQuoteRenewalWindow = 5 * time.Minute
+
+var ErrQuoteExpired = errors.New("quote expired without being paid")
+
+type QuoteKind int
+
+const (
+	MintQuoteKind QuoteKind = iota + 1
+	MeltQuoteKind
+)
+
+func (kind QuoteKind) String() string {
+	switch kind {
+	case MintQuoteKind:
+		return "mint"
+	case MeltQuoteKind:
+		return "melt"
+	default:
+		return "unknown"
+	}
+}
+
+// ExpiringQuote is an unpaid quote of the wallet that has an expiry
+type ExpiringQuote struct {
+	Kind           QuoteKind
+	QuoteId        string
+	Mint           string
+	Amount         uint64
+	PaymentRequest string
+	ExpiresAt      time.Time
+	// the mint quote is renewed before it expires
+	Renew bool
+}
+
+// Expired returns whether the quote expired at the time
+func (quote ExpiringQuote) Expired(now time.Time) bool {
+	return !quote.ExpiresAt.After(now)
+}
+
+// ExpiringQuotes returns the unpaid mint and melt quotes that expire
+// within the duration from now, including the ones that already
+// expired, sorted by the time they expire
+func (w *Wallet) ExpiringQuotes(within time.Duration) []ExpiringQuote {
+	deadline := time.Now().Add(within).Unix()
+	var quotes []ExpiringQuote
+	for _, quote := range w.db.GetMintQuotes() {
+		if quote.State != nut04.Unpaid || quote.QuoteExpiry == 0 || int64(quote.QuoteExpiry) > deadline {
+			continue
+		}
+		quotes = append(quotes, ExpiringQuote{
+			Kind:           MintQuoteKind,
+			QuoteId:        quote.QuoteId,
+			Mint:           quote.Mint,
+			Amount:         quote.Amount,
+			PaymentRequest: quote.PaymentRequest,
+			ExpiresAt:      time.Unix(int64(quote.QuoteExpiry), 0),
+			Renew:          quote.Renew,
+		})
+	}
+	for _, quote := range w.db.GetMeltQuotes() {
+		if quote.State != nut05.Unpaid || quote.QuoteExpiry == 0 || int64(quote.QuoteExpiry) > deadline {
+			continue
+		}
+		quotes = append(quotes, ExpiringQuote{
+			Kind:           MeltQuoteKind,
+			QuoteId:        quote.QuoteId,
+			Mint:           quote.Mint,
+			Amount:         quote.Amount,
+			PaymentRequest: quote.PaymentRequest,
+			ExpiresAt:      time.Unix(int64(quote.QuoteExpiry), 0),
+		})
+	}
+	slices.SortFunc(quotes, func(a, b ExpiringQuote) int {
+		return a.ExpiresAt.Compare(b.ExpiresAt)
+	})
+	return quotes
+}
+
+// SetQuoteRenewal marks an unpaid mint quote that the user still intends
+// to pay to be renewed by RenewExpiringQuotes before it expires
+func (w *Wallet) SetQuoteRenewal(quoteId string, renew bool) error {
+	quote := w.db.GetMintQuoteById(quoteId)
+	if quote == nil {
+		return ErrQuoteNotFound
+	}
+	if quote.State != nut04.Unpaid {
+		return fmt.Errorf("cannot renew mint quote in state '%v'", quote.State)
+	}
+	quote.Renew = renew
+	if err := w.db.SaveMintQuote(*quote); err != nil {
+		return fmt.Errorf("error saving mint quote: %v", err)
+	}
+	return nil
+}
+
+// RenewExpiringQuotes requests a new quote for the same amount from the
+// mint for the unpaid mint quotes marked for renewal that expire within
+// the duration. The new quote replaces the old one in the wallet and
+// the handler is called with a MintQuoteRenewed event that has the new
+// invoice to pay. If a quote that already expired cannot be renewed, it
+// is not renewed again and a MintQuoteRenewalFailed event is sent.
+func (w *Wallet) RenewExpiringQuotes(within time.Duration, handler func(Event)) {
+	now := time.Now()
+	for _, quote := range w.ExpiringQuotes(within) {
+		if quote.Kind != MintQuoteKind || !quote.Renew {
+			continue
+		}
+		renewed, err := w.renewMintQuote(quote.QuoteId)
+		if err == nil {
+			handler(Event{
+				Kind:            MintQuoteRenewed,
+				Mint:            quote.Mint,
+				QuoteId:         renewed.QuoteId,
+				PreviousQuoteId: quote.QuoteId,
+				Amount:          renewed.Amount,
+				PaymentRequest:  renewed.PaymentRequest,
+			})
+			continue
+		}
+		if current := w.db.GetMintQuoteById(quote.QuoteId); current != nil && current.State != nut04.Unpaid {
+			// paid before it could be renewed
+			continue
+		}
+		if !quote.Expired(now) {
+			w.logErrorf("could not renew mint quote '%v': %v. Retrying before it expires", quote.QuoteId, err)
+			continue
+		}
+		w.logErrorf("could not renew expired mint quote '%v': %v", quote.QuoteId, err)
+		if err := w.SetQuoteRenewal(quote.QuoteId, false); err != nil {
+			w.logErrorf("could not save mint quote '%v': %v", quote.QuoteId, err)
+		}
+		handler(Event{
+			Kind:    MintQuoteRenewalFailed,
+			Mint:    quote.Mint,
+			QuoteId: quote.QuoteId,
+			Amount:  quote.Amount,
+			Err:     err,
+		})
+	}
+}
+
+// renewMintQuote replaces an unpaid mint quote with a new one from the mint
+func (w *Wallet) renewMintQuote(quoteId string) (storage.MintQuote, error) {
+	// the invoice of the quote could have been paid since it was last checked
+	response, err := w.MintQuoteState(quoteId)
+	if err != nil {
+		return storage.MintQuote{}, err
+	}
+	if response.State != nut04.Unpaid {
+		return storage.MintQuote{}, fmt.Errorf("mint quote is %v", response.State)
+	}
+
+	quote := w.db.GetMintQuoteById(quoteId)
+	newQuote, err := w.requestMint(quote.Amount, quote.Mint, w.unit, quote.Description)
+	if err != nil {
+		return storage.MintQuote{}, err
+	}
+	renewed := w.db.GetMintQuoteById(newQuote.Quote)
+	renewed.Renew = true
+	if err := w.db.SaveMintQuote(*renewed); err != nil {
+		return storage.MintQuote{}, fmt.Errorf("error saving mint quote: %v", err)
+	}
+	if err := w.db.DeleteMintQuote(quoteId); err != nil {
+		return storage.MintQuote{}, fmt.Errorf("error removing mint quote '%v': %v", quoteId, err)
+	}
+	w.logInfof("renewed mint quote '%v' with new quote '%v' from mint '%v'", quoteId, renewed.QuoteId, renewed.Mint)
+	return *renewed, nil
+}
+
+// quoteExpired returns whether the quote has an expiry before the time
+func quoteExpired(expiry uint64, now time.Time) bool {
+	return expiry > 0 && int64(expiry) < now.Unix()
+}
@@ -0,0 +1,85 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestExpiringQuotes(t *testing.T) {
+	db := storage.NewMemoryDB()
+	w := &Wallet{db: db}
+
+	now := time.Now()
+	expired := uint64(now.Add(-time.Hour).Unix())
+	soon := uint64(now.Add(2 * time.Minute).Unix())
+	later := uint64(now.Add(time.Hour).Unix())
+
+	mintQuotes := []storage.MintQuote{
+		{QuoteId: "mint-soon", State: nut04.Unpaid, QuoteExpiry: soon, Renew: true},
+		{QuoteId: "mint-expired", State: nut04.Unpaid, QuoteExpiry: expired},
+		{QuoteId: "mint-later", State: nut04.Unpaid, QuoteExpiry: later},
+		{QuoteId: "mint-paid", State: nut04.Paid, QuoteExpiry: expired},
+		{QuoteId: "mint-no-expiry", State: nut04.Unpaid},
+	}
+	meltQuotes := []storage.MeltQuote{
+		{QuoteId: "melt-soon", State: nut05.Unpaid, QuoteExpiry: soon + 1},
+		{QuoteId: "melt-pending", State: nut05.Pending, QuoteExpiry: soon},
+	}
+	for _, quote := range mintQuotes {
+		if err := db.SaveMintQuote(quote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, quote := range meltQuotes {
+		if err := db.SaveMeltQuote(quote); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	quotes := w.ExpiringQuotes(5 * time.Minute)
+	expectedIds := []string{"mint-expired", "mint-soon", "melt-soon"}
+	if len(quotes) != len(expectedIds) {
+		t.Fatalf("expected %v expiring quotes but got %v", len(expectedIds), len(quotes))
+	}
+	for i, id := range expectedIds {
+		if quotes[i].QuoteId != id {
+			t.Fatalf("expected quote '%v' at position %v but got '%v'", id, i, quotes[i].QuoteId)
+		}
+	}
+	if !quotes[0].Expired(now) || quotes[1].Expired(now) {
+		t.Fatal("unexpected expired state of quotes")
+	}
+	if !quotes[1].Renew || quotes[2].Kind != MeltQuoteKind {
+		t.Fatalf("unexpected quote fields: %+v, %+v", quotes[1], quotes[2])
+	}
+
+	if err := w.SetQuoteRenewal("mint-later", true); err != nil {
+		t.Fatalf("unexpected error marking quote for renewal: %v", err)
+	}
+	if !db.GetMintQuoteById("mint-later").Renew {
+		t.Fatal("expected quote to be marked for renewal")
+	}
+	if err := w.SetQuoteRenewal("mint-paid", true); err == nil {
+		t.Fatal("expected error marking paid quote for renewal")
+	}
+	if err := w.SetQuoteRenewal("unknown", true); err != ErrQuoteNotFound {
+		t.Fatalf("expected error '%v' but got '%v'", ErrQuoteNotFound, err)
+	}
+
+	// quotes not marked for renewal are left as they are
+	if err := w.SetQuoteRenewal("mint-soon", false); err != nil {
+		t.Fatal(err)
+	}
+	w.RenewExpiringQuotes(5*time.Minute, func(event Event) {
+		t.Fatalf("unexpected event %v", event.Kind)
+	})
+	if db.GetMintQuoteById("mint-expired") == nil {
+		t.Fatal("expected quote not marked for renewal to be kept")
+	}
+}
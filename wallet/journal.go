@@ -0,0 +1,293 @@
+package wallet
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut09"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/client"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+var ErrOperationPending = errors.New("operation is still pending in the mint")
+
+// beginOperation saves the operation to the journal before making the
+// requests to the mint. The blinding factors of the outputs are saved with
+// it so the signatures can be restored from the mint.
+func (w *Wallet) beginOperation(
+	operation storage.Operation,
+	rs []*secp256k1.PrivateKey,
+) (*storage.Operation, error) {
+	id, err := randomId()
+	if err != nil {
+		return nil, err
+	}
+	operation.Id = id
+	operation.CreatedAt = time.Now().Unix()
+
+	operation.Rs = make([]string, len(rs))
+	for i, r := range rs {
+		operation.Rs[i] = hex.EncodeToString(r.Serialize())
+	}
+
+	if err := w.db.SaveOperation(operation); err != nil {
+		return nil, fmt.Errorf("error saving operation to journal: %v", err)
+	}
+	return &operation, nil
+}
+
+// completeOperation removes the operation from the journal
+// once the wallet has saved the result of it.
+func (w *Wallet) completeOperation(operation *storage.Operation) error {
+	if err := w.db.DeleteOperation(operation.Id); err != nil {
+		return fmt.Errorf("error removing operation from journal: %v", err)
+	}
+	return nil
+}
+
+// abortOperation is called when a request of the operation fails. If the mint
+// rejected the request nothing changed so the operation is removed from the journal.
+// Otherwise, it is kept so that Recover can check what happened in the mint.
+func (w *Wallet) abortOperation(operation *storage.Operation, err error) {
+	var cashuErr cashu.Error
+	if errors.As(err, &cashuErr) {
+		w.db.DeleteOperation(operation.Id)
+		return
+	}
+	w.logInfof("keeping %v operation '%v' in journal to recover later", operation.Kind, operation.Id)
+}
+
+// PendingOperations returns the operations in the journal that did not complete
+func (w *Wallet) PendingOperations() []storage.Operation {
+	return w.db.GetOperations()
+}
+
+// Recover resolves the operations left in the journal by operations
+// that did not complete (i.e the wallet crashed or lost connection to the mint).
+// If the inputs of an operation are unspent in the mint, it is rolled back
+// and the inputs are available again. If they were spent, it is rolled forward
+// by restoring the signatures for the outputs from the mint. Operations with
+// inputs still pending in the mint are kept for a later call.
+// It returns the amount that was added back to the wallet.
+func (w *Wallet) Recover() (uint64, error) {
+	var recovered uint64
+	var errs []error
+	for _, operation := range w.db.GetOperations() {
+		amount, err := w.recoverOperation(operation)
+		if err != nil {
+			if !errors.Is(err, ErrOperationPending) {
+				errs = append(errs, fmt.Errorf("could not recover %v operation '%v': %v",
+					operation.Kind, operation.Id, err))
+			}
+			continue
+		}
+		recovered += amount
+	}
+
+	return recovered, errors.Join(errs...)
+}
+
+func (w *Wallet) recoverOperation(operation storage.Operation) (uint64, error) {
+	states, err := proofStates(operation.Mint, operation.Inputs)
+	if err != nil {
+		return 0, err
+	}
+
+	spent := false
+	for _, state := range states {
+		if state == nut07.Pending {
+			return 0, ErrOperationPending
+		}
+		if state == nut07.Spent {
+			spent = true
+		}
+	}
+
+	var recovered uint64
+	if spent {
+		recovered, err = w.rollForward(operation)
+	} else {
+		recovered, err = w.rollBack(operation)
+	}
+	if err != nil {
+		return 0, err
+	}
+	w.logInfof("recovered %v from %v operation '%v' (inputs spent: %v)",
+		recovered, operation.Kind, operation.Id, spent)
+
+	if err := w.completeOperation(&operation); err != nil {
+		return 0, err
+	}
+	return recovered, nil
+}
+
+// rollBack makes the inputs of an operation that did not happen
+// in the mint available again
+func (w *Wallet) rollBack(operation storage.Operation) (uint64, error) {
+	switch operation.Kind {
+	case storage.SwapOperation:
+		if err := w.db.SaveProofs(operation.Inputs); err != nil {
+			return 0, fmt.Errorf("error storing proofs: %v", err)
+		}
+		return operation.Inputs.Amount(), nil
+	case storage.MeltOperation:
+		if err := w.db.SaveProofs(operation.Inputs); err != nil {
+			return 0, fmt.Errorf("error storing proofs: %v", err)
+		}
+		if err := w.db.DeletePendingProofsByQuoteId(operation.QuoteId); err != nil {
+			return 0, fmt.Errorf("error removing pending proofs: %v", err)
+		}
+		return operation.Inputs.Amount(), nil
+	}
+
+	// inputs in a receive were never in the wallet so there is nothing
+	// to roll back. The token can be received again.
+	return 0, nil
+}
+
+// rollForward restores the signatures for the outputs of an operation
+// whose inputs were spent and saves the proofs that are unspent.
+func (w *Wallet) rollForward(operation storage.Operation) (uint64, error) {
+	for _, proof := range operation.Inputs {
+		w.db.DeleteProof(proof.Secret)
+	}
+
+	if operation.Kind == storage.MeltOperation {
+		if _, err := w.CheckMeltQuoteState(operation.QuoteId); err != nil {
+			return 0, fmt.Errorf("error checking state of quote: %v", err)
+		}
+	}
+
+	proofs, err := w.restoreOutputs(operation)
+	if err != nil {
+		return 0, err
+	}
+
+	states, err := proofStates(operation.Mint, proofs)
+	if err != nil {
+		return 0, err
+	}
+	unspentProofs := cashu.Proofs{}
+	for i, proof := range proofs {
+		// locked proofs from a send were for someone else
+		if _, err := nut10.DeserializeSecret(proof.Secret); err == nil {
+			continue
+		}
+		if states[i] == nut07.Unspent {
+			unspentProofs = append(unspentProofs, proof)
+		}
+	}
+	if err := w.db.SaveProofs(unspentProofs); err != nil {
+		return 0, fmt.Errorf("error storing proofs: %v", err)
+	}
+
+	// the counter might have been incremented before the operation stopped
+	counter := w.counterForKeyset(operation.KeysetId)
+	if counter < operation.CounterEnd {
+		if err := w.db.IncrementKeysetCounter(operation.KeysetId, operation.CounterEnd-counter); err != nil {
+			return 0, fmt.Errorf("error incrementing keyset counter: %v", err)
+		}
+	}
+
+	return unspentProofs.Amount(), nil
+}
+
+// restoreOutputs gets the signatures the mint has for
+// the outputs of the operation and unblinds them
+func (w *Wallet) restoreOutputs(operation storage.Operation) (cashu.Proofs, error) {
+	if len(operation.Outputs) == 0 {
+		return cashu.Proofs{}, nil
+	}
+
+	keyset := w.db.GetKeyset(operation.KeysetId)
+	if keyset == nil {
+		return nil, fmt.Errorf("keyset '%v' not found", operation.KeysetId)
+	}
+
+	restoreRequest := nut09.PostRestoreRequest{Outputs: operation.Outputs}
+	restoreResponse, err := client.PostRestore(operation.Mint, restoreRequest)
+	if err != nil {
+		return nil, fmt.Errorf("error restoring signatures from mint: %v", err)
+	}
+
+	if len(restoreResponse.Outputs) != len(restoreResponse.Signatures) {
+		return nil, errors.New("number of outputs and signatures from mint do not match")
+	}
+
+	outputIdx := make(map[string]int, len(operation.Outputs))
+	for i, output := range operation.Outputs {
+		outputIdx[output.B_] = i
+	}
+
+	outputs := make(cashu.BlindedMessages, len(restoreResponse.Signatures))
+	secrets := make([]string, len(restoreResponse.Signatures))
+	rs := make([]*secp256k1.PrivateKey, len(restoreResponse.Signatures))
+	for i, output := range restoreResponse.Outputs {
+		idx, ok := outputIdx[output.B_]
+		if !ok {
+			return nil, errors.New("mint returned signature for unknown output")
+		}
+
+		rbytes, err := hex.DecodeString(operation.Rs[idx])
+		if err != nil {
+			return nil, fmt.Errorf("invalid blinding factor: %v", err)
+		}
+		outputs[i] = operation.Outputs[idx]
+		secrets[i] = operation.Secrets[idx]
+		rs[i] = secp256k1.PrivKeyFromBytes(rbytes)
+	}
+
+	return constructProofs(restoreResponse.Signatures, outputs, secrets, rs, keyset)
+}
+
+// proofStates returns the state in the mint for each of the proofs
+func proofStates(mint string, proofs cashu.Proofs) ([]nut07.State, error) {
+	if len(proofs) == 0 {
+		return []nut07.State{}, nil
+	}
+
+	Ys := make([]string, len(proofs))
+	for i, proof := range proofs {
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			return nil, err
+		}
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+	}
+
+	stateResponse, err := client.PostCheckProofState(mint, nut07.PostCheckStateRequest{Ys: Ys})
+	if err != nil {
+		return nil, fmt.Errorf("could not check proof states: %v", err)
+	}
+	statesByY := make(map[string]nut07.State, len(stateResponse.States))
+	for _, state := range stateResponse.States {
+		statesByY[state.Y] = state.State
+	}
+
+	states := make([]nut07.State, len(proofs))
+	for i, Y := range Ys {
+		state, ok := statesByY[Y]
+		if !ok {
+			state = nut07.Unknown
+		}
+		states[i] = state
+	}
+	return states, nil
+}
+
+// randomId generates an id for entries saved in the db
+func randomId() (string, error) {
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(idBytes), nil
+}
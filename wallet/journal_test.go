@@ -0,0 +1,188 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut09"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestRecover(t *testing.T) {
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	keyset, err := crypto.GenerateKeyset(master, 0, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+
+	unspentInput := signProof(t, keyset, 8, "unspent", false)
+	spentInput := signProof(t, keyset, 8, "spent", false)
+	pendingInput := signProof(t, keyset, 8, "pending", false)
+	states := map[string]nut07.State{
+		proofY(spentInput):   nut07.Spent,
+		proofY(pendingInput): nut07.Pending,
+	}
+
+	// outputs of the swap that spent the input. Mint only signed the first two
+	outputs := make(cashu.BlindedMessages, 3)
+	secrets := []string{"output1", "output2", "output3"}
+	rs := make([]*secp256k1.PrivateKey, 3)
+	for i, amount := range []uint64{4, 4, 8} {
+		r, _ := secp256k1.GeneratePrivateKey()
+		B_, r, err := crypto.BlindMessage(secrets[i], r)
+		if err != nil {
+			t.Fatalf("error blinding message: %v", err)
+		}
+		outputs[i] = cashu.NewBlindedMessage(keyset.Id, amount, B_)
+		rs[i] = r
+	}
+	signedOutputs := outputs[:2]
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/checkstate":
+			var req nut07.PostCheckStateRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			proofStates := make([]nut07.ProofState, len(req.Ys))
+			for i, Y := range req.Ys {
+				state, ok := states[Y]
+				if !ok {
+					state = nut07.Unspent
+				}
+				proofStates[i] = nut07.ProofState{Y: Y, State: state}
+			}
+			json.NewEncoder(w).Encode(nut07.PostCheckStateResponse{States: proofStates})
+		case "/v1/restore":
+			var res nut09.PostRestoreResponse
+			for _, output := range signedOutputs {
+				B_bytes, _ := hex.DecodeString(output.B_)
+				B_, _ := secp256k1.ParsePubKey(B_bytes)
+				C_ := crypto.SignBlindedMessage(B_, keyset.Keys[output.Amount].PrivateKey)
+				res.Outputs = append(res.Outputs, output)
+				res.Signatures = append(res.Signatures, cashu.BlindedSignature{
+					Amount: output.Amount,
+					Id:     keyset.Id,
+					C_:     hex.EncodeToString(C_.SerializeCompressed()),
+				})
+			}
+			json.NewEncoder(w).Encode(&res)
+		case "/v1/melt/quote/bolt11/quote1":
+			json.NewEncoder(w).Encode(&nut05.PostMeltQuoteBolt11Response{
+				Quote:    "quote1",
+				State:    nut05.Paid,
+				Preimage: "preimage",
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db := storage.NewMemoryDB()
+
+	walletKeyset := crypto.WalletKeyset{
+		Id:         keyset.Id,
+		MintURL:    server.URL,
+		Unit:       cashu.Sat.String(),
+		Active:     true,
+		PublicKeys: make(map[uint64]*secp256k1.PublicKey),
+	}
+	for amount, key := range keyset.Keys {
+		walletKeyset.PublicKeys[amount] = key.PublicKey
+	}
+	if err := db.SaveKeyset(&walletKeyset); err != nil {
+		t.Fatalf("error saving keyset: %v", err)
+	}
+	w := &Wallet{db: db, mints: map[string]walletMint{
+		server.URL: {mintURL: server.URL, activeKeyset: walletKeyset},
+	}}
+
+	// spent input was deleted from the wallet before the operation stopped
+	if err := db.SaveProofs(cashu.Proofs{unspentInput}); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	for _, operation := range []storage.Operation{
+		{Kind: storage.SwapOperation, Mint: server.URL, Inputs: cashu.Proofs{unspentInput}},
+		{
+			Kind:       storage.SwapOperation,
+			Mint:       server.URL,
+			Inputs:     cashu.Proofs{spentInput},
+			Outputs:    outputs,
+			Secrets:    secrets,
+			KeysetId:   keyset.Id,
+			CounterEnd: 3,
+		},
+		{Kind: storage.MeltOperation, Mint: server.URL, Inputs: cashu.Proofs{pendingInput}, QuoteId: "quote1"},
+	} {
+		operationRs := []*secp256k1.PrivateKey{}
+		if len(operation.Outputs) > 0 {
+			operationRs = rs
+		}
+		if _, err := w.beginOperation(operation, operationRs); err != nil {
+			t.Fatalf("error saving operation: %v", err)
+		}
+	}
+
+	recovered, err := w.Recover()
+	if err != nil {
+		t.Fatalf("unexpected error recovering operations: %v", err)
+	}
+	// unspent input rolled back and 2 signed outputs rolled forward
+	if recovered != 16 {
+		t.Fatalf("expected to recover 16 but got %v", recovered)
+	}
+	if balance := w.GetBalance(); balance != 16 {
+		t.Fatalf("expected balance of 16 but got %v", balance)
+	}
+	if counter := db.GetKeysetCounter(keyset.Id); counter != 3 {
+		t.Fatalf("expected keyset counter of 3 but got %v", counter)
+	}
+
+	pendingOperations := w.PendingOperations()
+	if len(pendingOperations) != 1 || pendingOperations[0].QuoteId != "quote1" {
+		t.Fatalf("expected melt operation to still be pending but got '%+v'", pendingOperations)
+	}
+
+	// once melt input is spent the operation is resolved
+	quote := storage.MeltQuote{QuoteId: "quote1", Mint: server.URL, State: nut05.Pending}
+	if err := db.SaveMeltQuote(quote); err != nil {
+		t.Fatalf("error saving melt quote: %v", err)
+	}
+	if err := db.AddPendingProofsByQuoteId(cashu.Proofs{pendingInput}, "quote1"); err != nil {
+		t.Fatalf("error saving pending proofs: %v", err)
+	}
+	states[proofY(pendingInput)] = nut07.Spent
+	signedOutputs = nil
+
+	if _, err := w.Recover(); err != nil {
+		t.Fatalf("unexpected error recovering operations: %v", err)
+	}
+	if len(w.PendingOperations()) != 0 {
+		t.Fatalf("expected no pending operations but got '%+v'", w.PendingOperations())
+	}
+	if savedQuote := db.GetMeltQuoteById("quote1"); savedQuote.Preimage != "preimage" {
+		t.Fatalf("expected melt quote to be updated but got '%+v'", savedQuote)
+	}
+	if pendingBalance := w.PendingBalance(); pendingBalance != 0 {
+		t.Fatalf("expected pending balance of 0 but got %v", pendingBalance)
+	}
+}
+
+func proofY(proof cashu.Proof) string {
+	Y, _ := crypto.HashToCurve([]byte(proof.Secret))
+	return hex.EncodeToString(Y.SerializeCompressed())
+}
@@ -90,10 +90,15 @@ func GetKeysetKeys(mintURL, id string) (map[uint64]*secp256k1.PublicKey, error)
 // if mint passed is known and the latest active keyset has changed,
 // it will inactivate the previous active and save new active to db
 func (w *Wallet) getActiveKeyset(mintURL string) (*crypto.WalletKeyset, error) {
-	mint, ok := w.mints[mintURL]
-	// if mint is not known, get active sat keyset from calling mint
+	return w.getUnitActiveKeyset(mintURL, w.unit)
+}
+
+// getUnitActiveKeyset is getActiveKeyset for the keysets of the mint in the unit
+func (w *Wallet) getUnitActiveKeyset(mintURL string, unit cashu.Unit) (*crypto.WalletKeyset, error) {
+	mint, ok := w.getMint(mintURL, unit)
+	// if mint is not known, get active keyset of the unit from calling mint
 	if !ok {
-		activeKeyset, err := GetMintActiveKeyset(mintURL, w.unit)
+		activeKeyset, err := GetMintActiveKeyset(mintURL, unit)
 		if err != nil {
 			return nil, err
 		}
@@ -128,7 +133,7 @@ func (w *Wallet) getActiveKeyset(mintURL string) (*crypto.WalletKeyset, error) {
 
 		for _, keyset := range allKeysets.Keysets {
 			_, err = hex.DecodeString(keyset.Id)
-			if keyset.Active && keyset.Unit == w.unit.String() && err == nil {
+			if keyset.Active && keyset.Unit == unit.String() && err == nil {
 				storedKeyset := w.db.GetKeyset(keyset.Id)
 				if storedKeyset != nil {
 					storedKeyset.Active = true
@@ -158,7 +163,7 @@ func (w *Wallet) getActiveKeyset(mintURL string) (*crypto.WalletKeyset, error) {
 					}
 					mint.activeKeyset = activeKeyset
 				}
-				w.mints[mintURL] = mint
+				w.setMint(mint)
 			}
 		}
 	}
@@ -171,7 +176,7 @@ func (w *Wallet) getActiveKeyset(mintURL string) (*crypto.WalletKeyset, error) {
 				return nil, err
 			}
 			mint.activeKeyset = activeKeyset
-			w.mints[mintURL] = mint
+			w.setMint(mint)
 		}
 	}
 
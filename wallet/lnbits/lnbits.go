@@ -0,0 +1,439 @@
+// Package lnbits serves a Cashu wallet behind a subset of the LNbits
+// wallet API so that tools built for an LNbits wallet can sit on top of it.
+//
+// Supported endpoints:
+//   - GET /api/v1/wallet: balance of the wallet in msat.
+//   - POST /api/v1/payments: create an invoice (mint quote) if "out" is false
+//     or pay the "bolt11" invoice (melt) if "out" is true.
+//   - GET /api/v1/payments/{payment_hash}: whether an invoice or a payment
+//     was paid. Paid invoices are minted when checked.
+//   - POST /api/v1/cashu/send: create a token for an amount.
+//   - POST /api/v1/cashu/receive: receive a token.
+//
+// Requests are authenticated with the X-Api-Key header. As in LNbits, the
+// invoice key can read the wallet and create invoices while the admin key
+// is needed to pay invoices and send tokens.
+package lnbits
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/wallet"
+	"github.com/elnosh/gonuts/wallet/storage"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+const ApiKeyHeader = "X-Api-Key"
+
+// max size of a request body
+const maxBodySize = 64 * 1024
+
+var (
+	ErrMissingKey = errors.New("admin and invoice keys are required")
+	ErrSameKeys   = errors.New("admin and invoice keys must be different")
+)
+
+// Wallet is the part of the Cashu wallet used by the server
+type Wallet interface {
+	GetBalance() uint64
+	CurrentMint() string
+	RequestMint(amount uint64, mint string) (*nut04.PostMintQuoteBolt11Response, error)
+	MintTokens(quoteId string) (uint64, error)
+	MintQuoteState(quoteId string) (*nut04.PostMintQuoteBolt11Response, error)
+	GetMintQuotes() []storage.MintQuote
+	RequestMeltQuote(request, mint string) (*nut05.PostMeltQuoteBolt11Response, error)
+	Melt(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error)
+	GetMeltQuotes() []storage.MeltQuote
+	Send(amount uint64, mintURL string, includeFees bool) (cashu.Proofs, error)
+	Receive(token cashu.Token, swapToTrusted bool) (uint64, error)
+	NewToken(proofs cashu.Proofs, mint string, version wallet.TokenVersion, includeDLEQ bool) (cashu.Token, error)
+}
+
+type WalletResponse struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// balance in msat
+	Balance uint64 `json:"balance"`
+}
+
+type CreatePaymentRequest struct {
+	// pay the invoice in Bolt11 if true. Create an invoice for Amount otherwise
+	Out    bool   `json:"out"`
+	Amount uint64 `json:"amount,omitempty"`
+	Unit   string `json:"unit,omitempty"`
+	// memo is accepted but not set in the invoice since mints do not support it
+	Memo   string `json:"memo,omitempty"`
+	Bolt11 string `json:"bolt11,omitempty"`
+}
+
+type CreatePaymentResponse struct {
+	PaymentHash    string `json:"payment_hash"`
+	PaymentRequest string `json:"payment_request,omitempty"`
+	CheckingId     string `json:"checking_id"`
+}
+
+type PaymentStatusResponse struct {
+	Paid     bool           `json:"paid"`
+	Preimage string         `json:"preimage,omitempty"`
+	Details  PaymentDetails `json:"details"`
+}
+
+type PaymentDetails struct {
+	PaymentHash string `json:"payment_hash"`
+	Bolt11      string `json:"bolt11"`
+	// amounts in msat. Amount is negative for outgoing payments
+	Amount  int64 `json:"amount"`
+	Fee     int64 `json:"fee"`
+	Pending bool  `json:"pending"`
+}
+
+type SendTokenRequest struct {
+	Amount uint64 `json:"amount"`
+}
+
+type SendTokenResponse struct {
+	Token  string `json:"token"`
+	Amount uint64 `json:"amount"`
+}
+
+type ReceiveTokenRequest struct {
+	Token string `json:"token"`
+}
+
+type ReceiveTokenResponse struct {
+	Amount uint64 `json:"amount"`
+}
+
+type ErrorResponse struct {
+	Detail string `json:"detail"`
+}
+
+type Config struct {
+	// name of the wallet in the wallet details
+	Name string
+	// key to pay invoices and send tokens
+	AdminKey string
+	// key to read the wallet, create invoices and receive tokens
+	InvoiceKey string
+}
+
+type Server struct {
+	// the wallet is not safe for concurrent
+	// use so requests are handled one at a time
+	mu     sync.Mutex
+	wallet Wallet
+	config Config
+	mux    *http.ServeMux
+}
+
+// NewServer returns a server for the wallet.
+// It is an http.Handler to serve with an http.Server.
+func NewServer(wallet Wallet, config Config) (*Server, error) {
+	if len(config.AdminKey) == 0 || len(config.InvoiceKey) == 0 {
+		return nil, ErrMissingKey
+	}
+	if config.AdminKey == config.InvoiceKey {
+		return nil, ErrSameKeys
+	}
+	if len(config.Name) == 0 {
+		config.Name = "gonuts"
+	}
+
+	s := &Server{wallet: wallet, config: config, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /api/v1/wallet", s.auth(false, s.getWallet))
+	s.mux.HandleFunc("POST /api/v1/payments", s.auth(false, s.createPayment))
+	s.mux.HandleFunc("GET /api/v1/payments/{payment_hash}", s.auth(false, s.getPayment))
+	s.mux.HandleFunc("POST /api/v1/cashu/send", s.auth(true, s.sendToken))
+	s.mux.HandleFunc("POST /api/v1/cashu/receive", s.auth(false, s.receiveToken))
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	s.mux.ServeHTTP(rw, req)
+}
+
+type keyType int
+
+const (
+	noKey keyType = iota
+	invoiceKey
+	adminKey
+)
+
+type keyTypeCtx struct{}
+
+func contextWithKey(req *http.Request, key keyType) context.Context {
+	return context.WithValue(req.Context(), keyTypeCtx{}, key)
+}
+
+func isAdmin(req *http.Request) bool {
+	key, _ := req.Context().Value(keyTypeCtx{}).(keyType)
+	return key == adminKey
+}
+
+// auth checks the api key of the request. If admin is
+// true, only the admin key is accepted. The handler can
+// check which key was used with isAdmin.
+func (s *Server) auth(admin bool, handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		key := s.keyType(req.Header.Get(ApiKeyHeader))
+		switch {
+		case key == noKey:
+			writeErr(rw, http.StatusUnauthorized, errors.New("invalid api key"))
+		case admin && key != adminKey:
+			writeErr(rw, http.StatusForbidden, errors.New("admin key required"))
+		default:
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			handler(rw, req.WithContext(contextWithKey(req, key)))
+		}
+	}
+}
+
+// GET /api/v1/wallet
+func (s *Server) getWallet(rw http.ResponseWriter, req *http.Request) {
+	writeJSON(rw, http.StatusOK, WalletResponse{
+		Name:    s.config.Name,
+		Balance: s.wallet.GetBalance() * 1000,
+	})
+}
+
+// POST /api/v1/payments
+func (s *Server) createPayment(rw http.ResponseWriter, req *http.Request) {
+	var request CreatePaymentRequest
+	if err := decodeBody(rw, req, &request); err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	if !request.Out {
+		s.createInvoice(rw, request)
+		return
+	}
+	if !isAdmin(req) {
+		writeErr(rw, http.StatusForbidden, errors.New("admin key required"))
+		return
+	}
+	s.payInvoice(rw, request)
+}
+
+func (s *Server) createInvoice(rw http.ResponseWriter, request CreatePaymentRequest) {
+	if request.Amount == 0 {
+		writeErr(rw, http.StatusBadRequest, errors.New("amount is required"))
+		return
+	}
+	if len(request.Unit) > 0 && request.Unit != cashu.Sat.String() {
+		writeErr(rw, http.StatusBadRequest, fmt.Errorf("unit '%v' not supported", request.Unit))
+		return
+	}
+
+	mintQuote, err := s.wallet.RequestMint(request.Amount, s.wallet.CurrentMint())
+	if err != nil {
+		writeErr(rw, http.StatusBadGateway, err)
+		return
+	}
+	bolt11, err := decodepay.Decodepay(mintQuote.Request)
+	if err != nil {
+		writeErr(rw, http.StatusBadGateway, fmt.Errorf("invalid invoice from mint: %v", err))
+		return
+	}
+
+	writeJSON(rw, http.StatusCreated, CreatePaymentResponse{
+		PaymentHash:    bolt11.PaymentHash,
+		PaymentRequest: mintQuote.Request,
+		CheckingId:     bolt11.PaymentHash,
+	})
+}
+
+func (s *Server) payInvoice(rw http.ResponseWriter, request CreatePaymentRequest) {
+	bolt11, err := decodepay.Decodepay(request.Bolt11)
+	if err != nil {
+		writeErr(rw, http.StatusBadRequest, fmt.Errorf("invalid invoice: %v", err))
+		return
+	}
+
+	meltQuote, err := s.wallet.RequestMeltQuote(request.Bolt11, s.wallet.CurrentMint())
+	if err != nil {
+		writeErr(rw, http.StatusBadGateway, err)
+		return
+	}
+	meltResponse, err := s.wallet.Melt(meltQuote.Quote)
+	if err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+	if meltResponse.State == nut05.Unpaid {
+		writeErr(rw, http.StatusBadRequest, errors.New("payment failed"))
+		return
+	}
+
+	writeJSON(rw, http.StatusCreated, CreatePaymentResponse{
+		PaymentHash: bolt11.PaymentHash,
+		CheckingId:  bolt11.PaymentHash,
+	})
+}
+
+// GET /api/v1/payments/{payment_hash}
+func (s *Server) getPayment(rw http.ResponseWriter, req *http.Request) {
+	paymentHash := req.PathValue("payment_hash")
+
+	for _, quote := range s.wallet.GetMintQuotes() {
+		if quotePaymentHash(quote.PaymentRequest) != paymentHash {
+			continue
+		}
+
+		paid := quote.State == nut04.Issued
+		if !paid {
+			mintQuote, err := s.wallet.MintQuoteState(quote.QuoteId)
+			if err != nil {
+				writeErr(rw, http.StatusBadGateway, err)
+				return
+			}
+			// mint the ecash for the invoice once it is paid
+			if mintQuote.State == nut04.Paid {
+				if _, err := s.wallet.MintTokens(quote.QuoteId); err != nil {
+					writeErr(rw, http.StatusBadGateway, err)
+					return
+				}
+			}
+			paid = mintQuote.State != nut04.Unpaid
+		}
+		writeJSON(rw, http.StatusOK, PaymentStatusResponse{
+			Paid: paid,
+			Details: PaymentDetails{
+				PaymentHash: paymentHash,
+				Bolt11:      quote.PaymentRequest,
+				Amount:      int64(quote.Amount * 1000),
+				Pending:     !paid,
+			},
+		})
+		return
+	}
+
+	for _, quote := range s.wallet.GetMeltQuotes() {
+		if quotePaymentHash(quote.PaymentRequest) != paymentHash {
+			continue
+		}
+
+		paid := quote.State == nut05.Paid
+		writeJSON(rw, http.StatusOK, PaymentStatusResponse{
+			Paid:     paid,
+			Preimage: quote.Preimage,
+			Details: PaymentDetails{
+				PaymentHash: paymentHash,
+				Bolt11:      quote.PaymentRequest,
+				// outgoing amounts are negative as in LNbits
+				Amount:  -int64(quote.Amount * 1000),
+				Fee:     int64(quote.FeeReserve * 1000),
+				Pending: quote.State == nut05.Pending,
+			},
+		})
+		return
+	}
+
+	writeErr(rw, http.StatusNotFound, errors.New("payment does not exist"))
+}
+
+// POST /api/v1/cashu/send
+func (s *Server) sendToken(rw http.ResponseWriter, req *http.Request) {
+	var request SendTokenRequest
+	if err := decodeBody(rw, req, &request); err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+	if request.Amount == 0 {
+		writeErr(rw, http.StatusBadRequest, errors.New("amount is required"))
+		return
+	}
+
+	mint := s.wallet.CurrentMint()
+	proofs, err := s.wallet.Send(request.Amount, mint, true)
+	if err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+	token, err := s.wallet.NewToken(proofs, mint, wallet.DefaultTokenVersion, false)
+	if err != nil {
+		writeErr(rw, http.StatusInternalServerError, err)
+		return
+	}
+	tokenStr, err := token.Serialize()
+	if err != nil {
+		writeErr(rw, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, SendTokenResponse{Token: tokenStr, Amount: proofs.Amount()})
+}
+
+// POST /api/v1/cashu/receive
+func (s *Server) receiveToken(rw http.ResponseWriter, req *http.Request) {
+	var request ReceiveTokenRequest
+	if err := decodeBody(rw, req, &request); err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+	token, err := cashu.DecodeToken(request.Token)
+	if err != nil {
+		writeErr(rw, http.StatusBadRequest, fmt.Errorf("invalid token: %v", err))
+		return
+	}
+
+	amount, err := s.wallet.Receive(token, false)
+	if err != nil {
+		writeErr(rw, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(rw, http.StatusOK, ReceiveTokenResponse{Amount: amount})
+}
+
+func (s *Server) keyType(key string) keyType {
+	switch {
+	case len(key) == 0:
+		return noKey
+	case subtle.ConstantTimeCompare([]byte(key), []byte(s.config.AdminKey)) == 1:
+		return adminKey
+	case subtle.ConstantTimeCompare([]byte(key), []byte(s.config.InvoiceKey)) == 1:
+		return invoiceKey
+	default:
+		return noKey
+	}
+}
+
+// quotePaymentHash returns the payment hash of the invoice of a quote
+func quotePaymentHash(request string) string {
+	bolt11, err := decodepay.Decodepay(request)
+	if err != nil {
+		return ""
+	}
+	return bolt11.PaymentHash
+}
+
+func decodeBody(rw http.ResponseWriter, req *http.Request, dst any) error {
+	req.Body = http.MaxBytesReader(rw, req.Body, maxBodySize)
+	if err := json.NewDecoder(req.Body).Decode(dst); err != nil {
+		return fmt.Errorf("invalid request body: %v", err)
+	}
+	return nil
+}
+
+func writeJSON(rw http.ResponseWriter, status int, body any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(body)
+}
+
+// errors are returned as in LNbits
+func writeErr(rw http.ResponseWriter, status int, err error) {
+	writeJSON(rw, status, ErrorResponse{Detail: err.Error()})
+}
@@ -0,0 +1,298 @@
+package lnbits
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/mint/lightning"
+	"github.com/elnosh/gonuts/wallet"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+const (
+	testMint       = "http://127.0.0.1:3338"
+	testAdminKey   = "adminkey"
+	testInvoiceKey = "invoicekey"
+)
+
+// fakeWallet keeps quotes in memory. Mint quotes are paid when
+// their state is checked and melt quotes are always paid.
+type fakeWallet struct {
+	balance    uint64
+	mintQuotes []storage.MintQuote
+	meltQuotes []storage.MeltQuote
+	received   []cashu.Token
+}
+
+func (w *fakeWallet) GetBalance() uint64 { return w.balance }
+
+func (w *fakeWallet) CurrentMint() string { return testMint }
+
+func (w *fakeWallet) RequestMint(amount uint64, mint string) (*nut04.PostMintQuoteBolt11Response, error) {
+	invoice, _, _, err := lightning.CreateFakeInvoice(amount, false)
+	if err != nil {
+		return nil, err
+	}
+	quote := storage.MintQuote{
+		QuoteId:        invoice[len(invoice)-10:],
+		Mint:           mint,
+		State:          nut04.Unpaid,
+		PaymentRequest: invoice,
+		Amount:         amount,
+	}
+	w.mintQuotes = append(w.mintQuotes, quote)
+	return &nut04.PostMintQuoteBolt11Response{Quote: quote.QuoteId, Request: invoice, State: quote.State}, nil
+}
+
+func (w *fakeWallet) MintQuoteState(quoteId string) (*nut04.PostMintQuoteBolt11Response, error) {
+	for i, quote := range w.mintQuotes {
+		if quote.QuoteId == quoteId {
+			if quote.State == nut04.Unpaid {
+				w.mintQuotes[i].State = nut04.Paid
+			}
+			return &nut04.PostMintQuoteBolt11Response{Quote: quoteId, State: w.mintQuotes[i].State}, nil
+		}
+	}
+	return nil, errors.New("quote not found")
+}
+
+func (w *fakeWallet) MintTokens(quoteId string) (uint64, error) {
+	for i, quote := range w.mintQuotes {
+		if quote.QuoteId == quoteId && quote.State == nut04.Paid {
+			w.mintQuotes[i].State = nut04.Issued
+			w.balance += quote.Amount
+			return quote.Amount, nil
+		}
+	}
+	return 0, errors.New("quote not paid")
+}
+
+func (w *fakeWallet) GetMintQuotes() []storage.MintQuote { return w.mintQuotes }
+
+func (w *fakeWallet) RequestMeltQuote(request, mint string) (*nut05.PostMeltQuoteBolt11Response, error) {
+	quote := storage.MeltQuote{
+		QuoteId:        request[len(request)-10:],
+		Mint:           mint,
+		State:          nut05.Unpaid,
+		PaymentRequest: request,
+		Amount:         10,
+		FeeReserve:     1,
+	}
+	w.meltQuotes = append(w.meltQuotes, quote)
+	return &nut05.PostMeltQuoteBolt11Response{Quote: quote.QuoteId, Amount: quote.Amount, State: quote.State}, nil
+}
+
+func (w *fakeWallet) Melt(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error) {
+	for i, quote := range w.meltQuotes {
+		if quote.QuoteId == quoteId {
+			if w.balance < quote.Amount+quote.FeeReserve {
+				return nil, errors.New("not enough funds")
+			}
+			w.balance -= quote.Amount + quote.FeeReserve
+			w.meltQuotes[i].State = nut05.Paid
+			w.meltQuotes[i].Preimage = "preimage"
+			return &nut05.PostMeltQuoteBolt11Response{Quote: quoteId, State: nut05.Paid, Preimage: "preimage"}, nil
+		}
+	}
+	return nil, errors.New("quote not found")
+}
+
+func (w *fakeWallet) GetMeltQuotes() []storage.MeltQuote { return w.meltQuotes }
+
+func (w *fakeWallet) Send(amount uint64, mintURL string, includeFees bool) (cashu.Proofs, error) {
+	if amount > w.balance {
+		return nil, errors.New("not enough funds")
+	}
+	w.balance -= amount
+	return cashu.Proofs{{Amount: amount, Id: "009a1f293253e41e", Secret: "secret", C: "02aa"}}, nil
+}
+
+func (w *fakeWallet) Receive(token cashu.Token, swapToTrusted bool) (uint64, error) {
+	w.received = append(w.received, token)
+	w.balance += token.Amount()
+	return token.Amount(), nil
+}
+
+func (w *fakeWallet) NewToken(
+	proofs cashu.Proofs,
+	mint string,
+	version wallet.TokenVersion,
+	includeDLEQ bool,
+) (cashu.Token, error) {
+	return cashu.NewTokenV4(proofs, mint, cashu.Sat, includeDLEQ)
+}
+
+func request(t *testing.T, server http.Handler, method, path, key string, body, response any) int {
+	t.Helper()
+	var reqBody bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&reqBody).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &reqBody)
+	if len(key) > 0 {
+		req.Header.Set(ApiKeyHeader, key)
+	}
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if response != nil && rec.Code < http.StatusBadRequest {
+		if err := json.NewDecoder(rec.Body).Decode(response); err != nil {
+			t.Fatalf("error decoding response: %v", err)
+		}
+	}
+	return rec.Code
+}
+
+func TestNewServer(t *testing.T) {
+	if _, err := NewServer(&fakeWallet{}, Config{AdminKey: testAdminKey}); !errors.Is(err, ErrMissingKey) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMissingKey, err)
+	}
+	if _, err := NewServer(&fakeWallet{}, Config{AdminKey: testAdminKey, InvoiceKey: testAdminKey}); !errors.Is(err, ErrSameKeys) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrSameKeys, err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	server, err := NewServer(&fakeWallet{}, Config{AdminKey: testAdminKey, InvoiceKey: testInvoiceKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	invoice, _, _, _ := lightning.CreateFakeInvoice(10, false)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		key      string
+		body     any
+		expected int
+	}{
+		{"no key", http.MethodGet, "/api/v1/wallet", "", nil, http.StatusUnauthorized},
+		{"invalid key", http.MethodGet, "/api/v1/wallet", "notakey", nil, http.StatusUnauthorized},
+		{"invoice key", http.MethodGet, "/api/v1/wallet", testInvoiceKey, nil, http.StatusOK},
+		{"admin key", http.MethodGet, "/api/v1/wallet", testAdminKey, nil, http.StatusOK},
+		{
+			"pay with invoice key", http.MethodPost, "/api/v1/payments", testInvoiceKey,
+			CreatePaymentRequest{Out: true, Bolt11: invoice}, http.StatusForbidden,
+		},
+		{
+			"send with invoice key", http.MethodPost, "/api/v1/cashu/send", testInvoiceKey,
+			SendTokenRequest{Amount: 1}, http.StatusForbidden,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if status := request(t, server, test.method, test.path, test.key, test.body, nil); status != test.expected {
+				t.Fatalf("expected status %v but got %v", test.expected, status)
+			}
+		})
+	}
+}
+
+func TestPayments(t *testing.T) {
+	wallet := &fakeWallet{}
+	server, err := NewServer(wallet, Config{AdminKey: testAdminKey, InvoiceKey: testInvoiceKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var invoice CreatePaymentResponse
+	status := request(t, server, http.MethodPost, "/api/v1/payments", testInvoiceKey,
+		CreatePaymentRequest{Amount: 100, Memo: "test"}, &invoice)
+	if status != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v", http.StatusCreated, status)
+	}
+	if len(invoice.PaymentHash) == 0 || invoice.PaymentRequest != wallet.mintQuotes[0].PaymentRequest {
+		t.Fatalf("unexpected invoice '%+v'", invoice)
+	}
+	status = request(t, server, http.MethodPost, "/api/v1/payments", testInvoiceKey,
+		CreatePaymentRequest{Amount: 100, Unit: "usd"}, nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected status %v but got %v", http.StatusBadRequest, status)
+	}
+
+	// checking the payment mints the ecash once the invoice is paid
+	var paymentStatus PaymentStatusResponse
+	request(t, server, http.MethodGet, "/api/v1/payments/"+invoice.PaymentHash, testInvoiceKey, nil, &paymentStatus)
+	if !paymentStatus.Paid || paymentStatus.Details.Amount != 100000 {
+		t.Fatalf("unexpected payment status '%+v'", paymentStatus)
+	}
+	if wallet.mintQuotes[0].State != nut04.Issued {
+		t.Fatalf("expected mint quote to be issued but got '%v'", wallet.mintQuotes[0].State)
+	}
+
+	var walletResponse WalletResponse
+	request(t, server, http.MethodGet, "/api/v1/wallet", testInvoiceKey, nil, &walletResponse)
+	if walletResponse.Balance != 100000 || walletResponse.Name != "gonuts" {
+		t.Fatalf("unexpected wallet response '%+v'", walletResponse)
+	}
+
+	toPay, _, _, _ := lightning.CreateFakeInvoice(10, false)
+	var payment CreatePaymentResponse
+	status = request(t, server, http.MethodPost, "/api/v1/payments", testAdminKey,
+		CreatePaymentRequest{Out: true, Bolt11: toPay}, &payment)
+	if status != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v", http.StatusCreated, status)
+	}
+	request(t, server, http.MethodGet, "/api/v1/payments/"+payment.PaymentHash, testInvoiceKey, nil, &paymentStatus)
+	if !paymentStatus.Paid || paymentStatus.Preimage != "preimage" || paymentStatus.Details.Amount != -10000 {
+		t.Fatalf("unexpected payment status '%+v'", paymentStatus)
+	}
+	if wallet.balance != 89 {
+		t.Fatalf("expected balance of 89 but got %v", wallet.balance)
+	}
+
+	status = request(t, server, http.MethodPost, "/api/v1/payments", testAdminKey,
+		CreatePaymentRequest{Out: true, Bolt11: "notaninvoice"}, nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected status %v but got %v", http.StatusBadRequest, status)
+	}
+	status = request(t, server, http.MethodGet, "/api/v1/payments/notfound", testInvoiceKey, nil, nil)
+	if status != http.StatusNotFound {
+		t.Fatalf("expected status %v but got %v", http.StatusNotFound, status)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	wallet := &fakeWallet{balance: 50}
+	server, err := NewServer(wallet, Config{AdminKey: testAdminKey, InvoiceKey: testInvoiceKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent SendTokenResponse
+	status := request(t, server, http.MethodPost, "/api/v1/cashu/send", testAdminKey, SendTokenRequest{Amount: 21}, &sent)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %v but got %v", http.StatusOK, status)
+	}
+	token, err := cashu.DecodeToken(sent.Token)
+	if err != nil {
+		t.Fatalf("error decoding token: %v", err)
+	}
+	if token.Amount() != 21 || token.Mint() != testMint || sent.Amount != 21 {
+		t.Fatalf("unexpected token of %v from '%v'", token.Amount(), token.Mint())
+	}
+
+	var received ReceiveTokenResponse
+	status = request(t, server, http.MethodPost, "/api/v1/cashu/receive", testInvoiceKey,
+		ReceiveTokenRequest{Token: sent.Token}, &received)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %v but got %v", http.StatusOK, status)
+	}
+	if received.Amount != 21 || wallet.balance != 50 {
+		t.Fatalf("expected to receive 21 with balance of 50 but got %v and %v", received.Amount, wallet.balance)
+	}
+
+	status = request(t, server, http.MethodPost, "/api/v1/cashu/receive", testInvoiceKey,
+		ReceiveTokenRequest{Token: "cashuBnotatoken"}, nil)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected status %v but got %v", http.StatusBadRequest, status)
+	}
+}
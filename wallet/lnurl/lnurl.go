@@ -0,0 +1,280 @@
+// Package lnurl resolves Lightning addresses (LUD-16) to LNURL-pay (LUD-06)
+// endpoints and requests invoices from them, optionally attaching
+// a comment (LUD-12) and payer data (LUD-18).
+package lnurl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+const payRequestTag = "payRequest"
+
+var (
+	ErrInvalidAddress       = errors.New("invalid lightning address")
+	ErrCommentNotAllowed    = errors.New("receiver does not accept comments")
+	ErrCommentTooLong       = errors.New("comment exceeds length allowed by receiver")
+	ErrAmountOutOfRange     = errors.New("amount is outside of range accepted by receiver")
+	ErrPayerDataNotAccepted = errors.New("receiver does not accept payer data")
+)
+
+// PayParams is the response from the LNURL-pay endpoint
+// describing how to request an invoice from the receiver.
+type PayParams struct {
+	Callback       string         `json:"callback"`
+	MinSendable    uint64         `json:"minSendable"`
+	MaxSendable    uint64         `json:"maxSendable"`
+	Metadata       string         `json:"metadata"`
+	Tag            string         `json:"tag"`
+	CommentAllowed int            `json:"commentAllowed,omitempty"`
+	PayerData      *PayerDataSpec `json:"payerData,omitempty"`
+}
+
+type PayerDataField struct {
+	Mandatory bool `json:"mandatory"`
+}
+
+// PayerDataSpec lists the payer data fields the receiver
+// accepts and whether they are mandatory.
+type PayerDataSpec struct {
+	Name       *PayerDataField `json:"name,omitempty"`
+	Pubkey     *PayerDataField `json:"pubkey,omitempty"`
+	Identifier *PayerDataField `json:"identifier,omitempty"`
+	Email      *PayerDataField `json:"email,omitempty"`
+}
+
+// PayerData is the identity of the payer sent to the receiver.
+// NOTE: the 'auth' field from LUD-18 is not supported.
+type PayerData struct {
+	Name       string `json:"name,omitempty"`
+	Pubkey     string `json:"pubkey,omitempty"`
+	Identifier string `json:"identifier,omitempty"`
+	Email      string `json:"email,omitempty"`
+}
+
+type PayOptions struct {
+	Comment   string
+	PayerData *PayerData
+}
+
+type invoiceResponse struct {
+	PR string `json:"pr"`
+}
+
+type errorResponse struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// AddressURL returns the LNURL-pay endpoint for a lightning address
+// in the form user@domain.
+func AddressURL(address string) (string, error) {
+	user, domain, found := strings.Cut(strings.TrimSpace(address), "@")
+	if !found || len(user) == 0 || len(domain) == 0 || strings.Contains(domain, "@") {
+		return "", ErrInvalidAddress
+	}
+
+	scheme := "https"
+	if strings.HasSuffix(domain, ".onion") {
+		scheme = "http"
+	}
+
+	endpoint := url.URL{
+		Scheme: scheme,
+		Host:   domain,
+		Path:   "/.well-known/lnurlp/" + strings.ToLower(user),
+	}
+	return endpoint.String(), nil
+}
+
+// IsAddress returns whether the request looks like a lightning address.
+func IsAddress(request string) bool {
+	_, err := AddressURL(request)
+	return err == nil
+}
+
+// ResolveAddress gets the pay parameters for the lightning address.
+func ResolveAddress(address string) (*PayParams, error) {
+	endpoint, err := AddressURL(address)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := get(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	var params PayParams
+	if err := json.Unmarshal(body, &params); err != nil {
+		return nil, fmt.Errorf("error reading pay params: %v", err)
+	}
+	if params.Tag != payRequestTag {
+		return nil, fmt.Errorf("unexpected tag '%v' in pay params", params.Tag)
+	}
+	if len(params.Callback) == 0 {
+		return nil, errors.New("pay params have no callback")
+	}
+
+	return &params, nil
+}
+
+// ValidatePayerData checks that the payer data has all the fields the receiver
+// requires and returns the payer data with only the fields the receiver accepts.
+func (p *PayParams) ValidatePayerData(payerData *PayerData) (*PayerData, error) {
+	if p.PayerData == nil {
+		if payerData != nil {
+			return nil, ErrPayerDataNotAccepted
+		}
+		return nil, nil
+	}
+	if payerData == nil {
+		payerData = &PayerData{}
+	}
+
+	validated := &PayerData{}
+	check := func(name string, field *PayerDataField, value string, dst *string) error {
+		if field == nil {
+			return nil
+		}
+		if field.Mandatory && len(value) == 0 {
+			return fmt.Errorf("receiver requires payer data field '%v'", name)
+		}
+		*dst = value
+		return nil
+	}
+
+	if err := check("name", p.PayerData.Name, payerData.Name, &validated.Name); err != nil {
+		return nil, err
+	}
+	if err := check("pubkey", p.PayerData.Pubkey, payerData.Pubkey, &validated.Pubkey); err != nil {
+		return nil, err
+	}
+	if err := check("identifier", p.PayerData.Identifier, payerData.Identifier, &validated.Identifier); err != nil {
+		return nil, err
+	}
+	if err := check("email", p.PayerData.Email, payerData.Email, &validated.Email); err != nil {
+		return nil, err
+	}
+
+	if *validated == (PayerData{}) {
+		return nil, nil
+	}
+	return validated, nil
+}
+
+// RequestInvoice requests an invoice for the amount (in msats) from the callback
+// in the pay params. It verifies that the invoice returned is for the requested amount
+// and that it commits to the metadata and payer data sent.
+func (p *PayParams) RequestInvoice(amountMsat uint64, opts PayOptions) (string, error) {
+	if amountMsat < p.MinSendable || amountMsat > p.MaxSendable {
+		return "", ErrAmountOutOfRange
+	}
+
+	if len(opts.Comment) > 0 {
+		if p.CommentAllowed == 0 {
+			return "", ErrCommentNotAllowed
+		}
+		if len(opts.Comment) > p.CommentAllowed {
+			return "", ErrCommentTooLong
+		}
+	}
+
+	payerData, err := p.ValidatePayerData(opts.PayerData)
+	if err != nil {
+		return "", err
+	}
+
+	callback, err := url.Parse(p.Callback)
+	if err != nil {
+		return "", fmt.Errorf("invalid callback url: %v", err)
+	}
+	query := callback.Query()
+	query.Set("amount", strconv.FormatUint(amountMsat, 10))
+	if len(opts.Comment) > 0 {
+		query.Set("comment", opts.Comment)
+	}
+
+	var payerDataJson []byte
+	if payerData != nil {
+		payerDataJson, err = json.Marshal(payerData)
+		if err != nil {
+			return "", err
+		}
+		query.Set("payerdata", string(payerDataJson))
+	}
+	callback.RawQuery = query.Encode()
+
+	body, err := get(callback.String())
+	if err != nil {
+		return "", err
+	}
+
+	var response invoiceResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("error reading invoice response: %v", err)
+	}
+
+	bolt11, err := decodepay.Decodepay(response.PR)
+	if err != nil {
+		return "", fmt.Errorf("invalid invoice from receiver: %v", err)
+	}
+	if uint64(bolt11.MSatoshi) != amountMsat {
+		return "", fmt.Errorf("invoice amount '%v' msats does not match requested amount '%v' msats",
+			bolt11.MSatoshi, amountMsat)
+	}
+
+	// description hash commits to the metadata and, if sent, the payer data
+	hash := sha256.Sum256(append([]byte(p.Metadata), payerDataJson...))
+	if bolt11.DescriptionHash != hex.EncodeToString(hash[:]) {
+		return "", errors.New("invoice description hash does not match pay params metadata")
+	}
+
+	return response.PR, nil
+}
+
+// GetInvoice resolves the lightning address and requests an invoice
+// for the amount (in sats).
+func GetInvoice(address string, amount uint64, opts PayOptions) (string, error) {
+	params, err := ResolveAddress(address)
+	if err != nil {
+		return "", err
+	}
+	return params.RequestInvoice(amount*1000, opts)
+}
+
+func get(url string) ([]byte, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// LNURL services report errors with a status field
+	// regardless of the http status code
+	var errResponse errorResponse
+	if err := json.Unmarshal(body, &errResponse); err == nil && strings.ToUpper(errResponse.Status) == "ERROR" {
+		return nil, fmt.Errorf("lnurl error: %v", errResponse.Reason)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response status '%v': %s", resp.StatusCode, body)
+	}
+
+	return body, nil
+}
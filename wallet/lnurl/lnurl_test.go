@@ -0,0 +1,171 @@
+package lnurl
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/lightningnetwork/lnd/lnwire"
+	"github.com/lightningnetwork/lnd/zpay32"
+)
+
+func TestAddressURL(t *testing.T) {
+	tests := []struct {
+		address     string
+		expectedURL string
+		expectedErr error
+	}{
+		{
+			address:     "Satoshi@bitcoin.org",
+			expectedURL: "https://bitcoin.org/.well-known/lnurlp/satoshi",
+		},
+		{
+			address:     "user@someaddress.onion",
+			expectedURL: "http://someaddress.onion/.well-known/lnurlp/user",
+		},
+		{address: "bitcoin.org", expectedErr: ErrInvalidAddress},
+		{address: "@bitcoin.org", expectedErr: ErrInvalidAddress},
+		{address: "user@", expectedErr: ErrInvalidAddress},
+		{address: "user@bitcoin@org", expectedErr: ErrInvalidAddress},
+	}
+
+	for _, test := range tests {
+		url, err := AddressURL(test.address)
+		if !errors.Is(err, test.expectedErr) {
+			t.Fatalf("expected error '%v' but got '%v'", test.expectedErr, err)
+		}
+		if url != test.expectedURL {
+			t.Fatalf("expected url '%v' but got '%v'", test.expectedURL, url)
+		}
+	}
+}
+
+func TestValidatePayerData(t *testing.T) {
+	params := PayParams{
+		PayerData: &PayerDataSpec{
+			Name:  &PayerDataField{Mandatory: false},
+			Email: &PayerDataField{Mandatory: true},
+		},
+	}
+
+	_, err := params.ValidatePayerData(&PayerData{Name: "satoshi"})
+	if err == nil {
+		t.Fatal("expected error for missing mandatory field but got nil")
+	}
+
+	payerData, err := params.ValidatePayerData(&PayerData{
+		Name:   "satoshi",
+		Email:  "satoshi@bitcoin.org",
+		Pubkey: "02abc",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := PayerData{Name: "satoshi", Email: "satoshi@bitcoin.org"}
+	if *payerData != expected {
+		t.Fatalf("expected payer data '%+v' but got '%+v'", expected, *payerData)
+	}
+
+	noPayerData := PayParams{}
+	_, err = noPayerData.ValidatePayerData(&PayerData{Name: "satoshi"})
+	if !errors.Is(err, ErrPayerDataNotAccepted) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrPayerDataNotAccepted, err)
+	}
+}
+
+func TestRequestInvoice(t *testing.T) {
+	metadata := `[["text/plain","pay to satoshi"]]`
+	var gotComment string
+	var gotPayerData string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		gotComment = query.Get("comment")
+		gotPayerData = query.Get("payerdata")
+
+		amount, err := strconv.ParseUint(query.Get("amount"), 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		invoice, err := createInvoice(amount, sha256.Sum256([]byte(metadata+gotPayerData)))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(invoiceResponse{PR: invoice})
+	}))
+	defer server.Close()
+
+	params := PayParams{
+		Callback:       server.URL,
+		MinSendable:    1000,
+		MaxSendable:    100000000,
+		Metadata:       metadata,
+		Tag:            payRequestTag,
+		CommentAllowed: 20,
+		PayerData:      &PayerDataSpec{Name: &PayerDataField{}},
+	}
+
+	_, err := params.RequestInvoice(100, PayOptions{})
+	if !errors.Is(err, ErrAmountOutOfRange) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrAmountOutOfRange, err)
+	}
+
+	_, err = params.RequestInvoice(21000, PayOptions{Comment: "this comment is way too long"})
+	if !errors.Is(err, ErrCommentTooLong) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrCommentTooLong, err)
+	}
+
+	opts := PayOptions{Comment: "thanks", PayerData: &PayerData{Name: "hal"}}
+	invoice, err := params.RequestInvoice(21000, opts)
+	if err != nil {
+		t.Fatalf("unexpected error requesting invoice: %v", err)
+	}
+	if len(invoice) == 0 {
+		t.Fatal("got empty invoice")
+	}
+	if gotComment != "thanks" {
+		t.Fatalf("expected comment 'thanks' but got '%v'", gotComment)
+	}
+	if gotPayerData != `{"name":"hal"}` {
+		t.Fatalf("unexpected payer data sent '%v'", gotPayerData)
+	}
+}
+
+func createInvoice(amountMsat uint64, descriptionHash [32]byte) (string, error) {
+	var paymentHash [32]byte
+	if _, err := rand.Read(paymentHash[:]); err != nil {
+		return "", err
+	}
+
+	invoice, err := zpay32.NewInvoice(
+		&chaincfg.SigNetParams,
+		paymentHash,
+		time.Now(),
+		zpay32.Amount(lnwire.MilliSatoshi(amountMsat)),
+		zpay32.DescriptionHash(descriptionHash),
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return invoice.Encode(zpay32.MessageSigner{
+		SignCompact: func(msg []byte) ([]byte, error) {
+			key, err := secp256k1.GeneratePrivateKey()
+			if err != nil {
+				return nil, err
+			}
+			return ecdsa.SignCompact(key, msg, true), nil
+		},
+	})
+}
@@ -0,0 +1,67 @@
+//go:build !js
+
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/elnosh/gonuts/wallet/storage"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// The wallets loaded from a path keep their state in a bolt db in it.
+// Wasm builds don't have a filesystem so wallets are created with
+// NewWallet and a db passed to it (i.e storage.OpenIndexedDB).
+
+func InitStorage(path string) (storage.WalletDB, error) {
+	// bolt db atm
+	return storage.InitBolt(path)
+}
+
+// LoadWallet loads the wallet at the WalletPath in the config.
+// The directory and the db are created if they do not exist.
+func LoadWallet(config Config) (*Wallet, error) {
+	path := config.WalletPath
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+
+	db, err := InitStorage(path)
+	if err != nil {
+		return nil, fmt.Errorf("InitStorage: %v", err)
+	}
+
+	return NewWallet(Options{Config: config, DB: db})
+}
+
+// Restore creates a wallet at the path restored from the mnemonic.
+// It returns the amount in sats of the proofs restored.
+func Restore(walletPath, mnemonic string, mintsToRestore []string) (uint64, error) {
+	return RestoreWithConfig(walletPath, mnemonic, RestoreConfig{Mints: mintsToRestore})
+}
+
+// RestoreWithConfig creates a wallet at the path restored from the mnemonic.
+// If there is a wallet at the path from a restore of the same mnemonic that
+// was interrupted, it is resumed. It returns the amount in sats of the proofs restored.
+func RestoreWithConfig(walletPath, mnemonic string, config RestoreConfig) (uint64, error) {
+	if err := os.MkdirAll(walletPath, 0700); err != nil {
+		return 0, err
+	}
+
+	// check mnemonic is valid
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return 0, errors.New("invalid mnemonic")
+	}
+
+	// create wallet db or open the one of a restore to resume. It
+	// fails if the wallet at the path was not being restored
+	db, err := InitStorage(walletPath)
+	if err != nil {
+		return 0, fmt.Errorf("error restoring wallet: %v", err)
+	}
+	defer db.Close()
+
+	return RestoreToDBWithConfig(db, mnemonic, config)
+}
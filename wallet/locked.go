@@ -0,0 +1,306 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/cashu/nuts/nut11"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// LockedToken is a token with proofs that the wallet sent locked
+// to a third party (P2PK or HTLC) and that have not been spent yet.
+type LockedToken struct {
+	// id of the locked send in the wallet
+	Id   string
+	Mint string
+	// serialized token with the unspent proofs
+	Token  string
+	Amount uint64
+	Kind   nut10.SecretKind
+	// public key (P2PK) or hash (HTLC) the proofs are locked to
+	LockTarget string
+	// additional public keys that can sign
+	Pubkeys []string
+	// unix time after which the refund keys can spend the proofs. 0 if not set
+	Locktime   int64
+	RefundKeys []string
+	CreatedAt  int64
+}
+
+// saveLockedSend keeps the locked proofs sent so they can be exported later
+func (w *Wallet) saveLockedSend(proofs cashu.Proofs, mint string) (storage.LockedSend, error) {
+	id, err := randomId()
+	if err != nil {
+		return storage.LockedSend{}, err
+	}
+	lockedSend := storage.LockedSend{
+		Id:        id,
+		Mint:      mint,
+		Proofs:    proofs,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := w.db.SaveLockedSend(lockedSend); err != nil {
+		return storage.LockedSend{}, fmt.Errorf("error saving locked proofs: %v", err)
+	}
+	return lockedSend, nil
+}
+
+// ExportLockedTokens returns the locked proofs (P2PK or HTLC) sent from the
+// wallet that are still unspent as tokens, with the conditions they are
+// locked to. It can be used to hand them off when migrating wallets or to
+// reclaim them after the locktime. Proofs that have been spent are removed.
+func (w *Wallet) ExportLockedTokens() ([]LockedToken, error) {
+	var lockedTokens []LockedToken
+	for _, lockedSend := range w.db.GetLockedSends() {
+		states, err := proofStates(lockedSend.Mint, lockedSend.Proofs)
+		if err != nil {
+			return nil, err
+		}
+
+		var unspent cashu.Proofs
+		for i, state := range states {
+			if state != nut07.Spent {
+				unspent = append(unspent, lockedSend.Proofs[i])
+			}
+		}
+
+		if len(unspent) == 0 {
+			w.logDebugf("locked proofs sent '%v' were spent", lockedSend.Id)
+			if err := w.db.DeleteLockedSend(lockedSend.Id); err != nil {
+				return nil, fmt.Errorf("error removing locked proofs: %v", err)
+			}
+			continue
+		}
+		if len(unspent) < len(lockedSend.Proofs) {
+			lockedSend.Proofs = unspent
+			if err := w.db.SaveLockedSend(lockedSend); err != nil {
+				return nil, err
+			}
+		}
+
+		lockedToken, err := w.newLockedToken(lockedSend)
+		if err != nil {
+			return nil, fmt.Errorf("could not export locked proofs '%v': %v", lockedSend.Id, err)
+		}
+		lockedTokens = append(lockedTokens, lockedToken)
+	}
+
+	return lockedTokens, nil
+}
+
+func (w *Wallet) newLockedToken(lockedSend storage.LockedSend) (LockedToken, error) {
+	token, err := w.NewToken(lockedSend.Proofs, lockedSend.Mint, DefaultTokenVersion, true)
+	if err != nil {
+		return LockedToken{}, err
+	}
+	serializedToken, err := token.Serialize()
+	if err != nil {
+		return LockedToken{}, err
+	}
+
+	// all proofs sent have the same spending condition
+	secret, err := nut10.DeserializeSecret(lockedSend.Proofs[0].Secret)
+	if err != nil {
+		return LockedToken{}, fmt.Errorf("invalid secret: %v", err)
+	}
+	tags, err := nut11.ParseP2PKTags(secret.Data.Tags)
+	if err != nil {
+		return LockedToken{}, fmt.Errorf("invalid tags: %v", err)
+	}
+
+	lockedToken := LockedToken{
+		Id:         lockedSend.Id,
+		Mint:       lockedSend.Mint,
+		Token:      serializedToken,
+		Amount:     lockedSend.Proofs.Amount(),
+		Kind:       secret.Kind,
+		LockTarget: secret.Data.Data,
+		Locktime:   tags.Locktime,
+		CreatedAt:  lockedSend.CreatedAt,
+	}
+	for _, pubkey := range tags.Pubkeys {
+		lockedToken.Pubkeys = append(lockedToken.Pubkeys, hex.EncodeToString(pubkey.SerializeCompressed()))
+	}
+	for _, pubkey := range tags.Refund {
+		lockedToken.RefundKeys = append(lockedToken.RefundKeys, hex.EncodeToString(pubkey.SerializeCompressed()))
+	}
+	return lockedToken, nil
+}
+
+// ReissueLockedSend reclaims the unspent proofs of a P2PK locked send that the
+// receiver did not claim before its locktime and sends the same amount again
+// locked to the pubkey with the tags. It returns the new locked token. If pubkey is nil, the new proofs are locked
+// to the same pubkey. If tags is nil, the tags of the expired send are used with
+// the locktime extended by the same duration it originally had.
+// The proofs can only be reclaimed after the locktime if the wallet's key is
+// one of the refund keys or there are none.
+func (w *Wallet) ReissueLockedSend(
+	lockedSendId string,
+	pubkey *btcec.PublicKey,
+	tags *nut11.P2PKTags,
+	includeFees bool,
+) (*LockedToken, error) {
+	lockedSends := w.db.GetLockedSends()
+	idx := slices.IndexFunc(lockedSends, func(lockedSend storage.LockedSend) bool {
+		return lockedSend.Id == lockedSendId
+	})
+	if idx == -1 {
+		return nil, errors.New("locked send not found")
+	}
+	lockedSend := lockedSends[idx]
+
+	mint, ok := w.mints[lockedSend.Mint]
+	if !ok {
+		return nil, ErrMintNotExist
+	}
+
+	secret, err := nut10.DeserializeSecret(lockedSend.Proofs[0].Secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret: %v", err)
+	}
+	if secret.Kind != nut10.P2PK {
+		return nil, errors.New("locked send is not P2PK")
+	}
+	lockedTags, err := nut11.ParseP2PKTags(secret.Data.Tags)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tags: %v", err)
+	}
+	if err := w.canReclaim(lockedTags); err != nil {
+		return nil, err
+	}
+	if tags == nil {
+		duration := lockedTags.Locktime - lockedSend.CreatedAt
+		if duration <= 0 {
+			return nil, errors.New("tags with a new locktime are needed to reissue the locked send")
+		}
+		reissueTags := *lockedTags
+		reissueTags.Locktime = time.Now().Unix() + duration
+		tags = &reissueTags
+	}
+
+	states, err := proofStates(lockedSend.Mint, lockedSend.Proofs)
+	if err != nil {
+		return nil, err
+	}
+	var unspent cashu.Proofs
+	for i, state := range states {
+		if state == nut07.Unspent {
+			unspent = append(unspent, lockedSend.Proofs[i])
+		}
+	}
+	if len(unspent) == 0 {
+		if err := w.db.DeleteLockedSend(lockedSend.Id); err != nil {
+			return nil, fmt.Errorf("error removing locked proofs: %v", err)
+		}
+		return nil, errors.New("locked proofs were already claimed")
+	}
+
+	if err := w.reclaimLockedProofs(unspent, secret, &mint); err != nil {
+		return nil, err
+	}
+	if err := w.db.DeleteLockedSend(lockedSend.Id); err != nil {
+		return nil, fmt.Errorf("error removing locked proofs: %v", err)
+	}
+
+	if pubkey == nil {
+		pubkey, err = nut11.ParsePublicKey(secret.Data.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	spendingCondition := nut10.SpendingCondition{
+		Kind: nut10.P2PK,
+		Data: hex.EncodeToString(pubkey.SerializeCompressed()),
+		Tags: nut11.SerializeP2PKTags(*tags),
+	}
+	lockedProofs, err := w.swapToSend(unspent.Amount(), &mint, &spendingCondition, includeFees)
+	if err != nil {
+		return nil, fmt.Errorf("proofs were reclaimed but could not be sent again: %v", err)
+	}
+	reissued, err := w.saveLockedSend(lockedProofs, lockedSend.Mint)
+	if err != nil {
+		w.logErrorf("could not save locked proofs sent: %v", err)
+		reissued = storage.LockedSend{Mint: lockedSend.Mint, Proofs: lockedProofs, CreatedAt: time.Now().Unix()}
+	}
+	w.logInfof("reissued %v locked to '%v' from expired locked send '%v'",
+		lockedProofs.Amount(), spendingCondition.Data, lockedSend.Id)
+
+	lockedToken, err := w.newLockedToken(reissued)
+	if err != nil {
+		return nil, err
+	}
+	return &lockedToken, nil
+}
+
+// canReclaim checks that the wallet can spend proofs
+// with the tags through the refund path
+func (w *Wallet) canReclaim(tags *nut11.P2PKTags) error {
+	if tags.Locktime == 0 {
+		return errors.New("locked proofs do not have a locktime")
+	}
+	if time.Now().Unix() <= tags.Locktime {
+		return fmt.Errorf("locktime has not expired. Proofs can be reclaimed after %v",
+			time.Unix(tags.Locktime, 0).Format(time.RFC3339))
+	}
+	if len(tags.Refund) == 0 {
+		return nil
+	}
+	walletPubkey := w.privateKey.PubKey().SerializeCompressed()
+	for _, refundKey := range tags.Refund {
+		if slices.Equal(refundKey.SerializeCompressed(), walletPubkey) {
+			return nil
+		}
+	}
+	return errors.New("wallet's public key is not a refund key of the locked proofs")
+}
+
+// reclaimLockedProofs swaps the locked proofs
+// signed with the refund key for new proofs
+func (w *Wallet) reclaimLockedProofs(proofs cashu.Proofs, secret nut10.WellKnownSecret, mint *walletMint) error {
+	proofs, err := nut11.AddSignatureToInputs(proofs, w.privateKey)
+	if err != nil {
+		return fmt.Errorf("error signing inputs: %v", err)
+	}
+	req, err := w.createReceiveSwapRequest(proofs, secret, mint)
+	if err != nil {
+		return err
+	}
+
+	operation, err := w.beginOperation(storage.Operation{
+		Kind:       storage.ReceiveOperation,
+		Mint:       mint.mintURL,
+		Inputs:     req.inputs,
+		Outputs:    req.outputs,
+		Secrets:    req.secrets,
+		KeysetId:   req.keyset.Id,
+		CounterEnd: w.counterForKeyset(req.keyset.Id) + uint32(len(req.outputs)),
+	}, req.rs)
+	if err != nil {
+		return err
+	}
+
+	newProofs, err := w.swap(mint.mintURL, req)
+	if err != nil {
+		w.abortOperation(operation, err)
+		return fmt.Errorf("could not reclaim locked proofs: %v", err)
+	}
+	if err := w.db.IncrementKeysetCounter(req.keyset.Id, uint32(len(req.outputs))); err != nil {
+		return fmt.Errorf("error incrementing keyset counter: %v", err)
+	}
+	if err := w.db.SaveProofs(newProofs); err != nil {
+		return fmt.Errorf("error storing proofs: %v", err)
+	}
+	if err := w.completeOperation(operation); err != nil {
+		return err
+	}
+	w.logInfof("reclaimed %v from expired locked proofs", newProofs.Amount())
+	return nil
+}
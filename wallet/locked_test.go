@@ -0,0 +1,177 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/cashu/nuts/nut11"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestExportLockedTokens(t *testing.T) {
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	keyset, err := crypto.GenerateKeyset(master, 0, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+
+	receiverKey, _ := secp256k1.GeneratePrivateKey()
+	refundKey, _ := secp256k1.GeneratePrivateKey()
+	locktime := time.Now().Add(time.Hour).Unix()
+	tags := nut11.SerializeP2PKTags(nut11.P2PKTags{
+		Locktime: locktime,
+		Refund:   []*secp256k1.PublicKey{refundKey.PubKey()},
+	})
+	receiverPubkey := hex.EncodeToString(receiverKey.PubKey().SerializeCompressed())
+
+	lockedProof := func(amount uint64) cashu.Proof {
+		secret, err := nut10.NewSecretFromSpendingCondition(nut10.SpendingCondition{
+			Kind: nut10.P2PK,
+			Data: receiverPubkey,
+			Tags: tags,
+		})
+		if err != nil {
+			t.Fatalf("error creating secret: %v", err)
+		}
+		return signProof(t, keyset, amount, secret, false)
+	}
+
+	unspentProof := lockedProof(8)
+	spentProof := lockedProof(2)
+	states := map[string]nut07.State{proofY(spentProof): nut07.Spent}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/checkstate" {
+			http.NotFound(w, r)
+			return
+		}
+		var req nut07.PostCheckStateRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		proofStates := make([]nut07.ProofState, len(req.Ys))
+		for i, Y := range req.Ys {
+			state, ok := states[Y]
+			if !ok {
+				state = nut07.Unspent
+			}
+			proofStates[i] = nut07.ProofState{Y: Y, State: state}
+		}
+		json.NewEncoder(w).Encode(nut07.PostCheckStateResponse{States: proofStates})
+	}))
+	defer server.Close()
+
+	db := storage.NewMemoryDB()
+	w := &Wallet{db: db, unit: cashu.Sat}
+
+	if _, err := w.saveLockedSend(cashu.Proofs{unspentProof, spentProof}, server.URL); err != nil {
+		t.Fatalf("error saving locked proofs: %v", err)
+	}
+	if _, err := w.saveLockedSend(cashu.Proofs{lockedProof(4)}, server.URL); err != nil {
+		t.Fatalf("error saving locked proofs: %v", err)
+	}
+
+	// all proofs in the second send are spent
+	for _, lockedSend := range db.GetLockedSends() {
+		if len(lockedSend.Proofs) == 1 {
+			states[proofY(lockedSend.Proofs[0])] = nut07.Spent
+		}
+	}
+
+	lockedTokens, err := w.ExportLockedTokens()
+	if err != nil {
+		t.Fatalf("unexpected error exporting locked tokens: %v", err)
+	}
+	if len(lockedTokens) != 1 {
+		t.Fatalf("expected 1 locked token but got %v", len(lockedTokens))
+	}
+
+	lockedToken := lockedTokens[0]
+	if lockedToken.Amount != 8 {
+		t.Fatalf("expected amount of 8 but got %v", lockedToken.Amount)
+	}
+	if lockedToken.Kind != nut10.P2PK || lockedToken.LockTarget != receiverPubkey {
+		t.Fatalf("expected P2PK lock to '%v' but got '%v' to '%v'",
+			receiverPubkey, lockedToken.Kind, lockedToken.LockTarget)
+	}
+	if lockedToken.Locktime != locktime {
+		t.Fatalf("expected locktime %v but got %v", locktime, lockedToken.Locktime)
+	}
+	expectedRefundKey := hex.EncodeToString(refundKey.PubKey().SerializeCompressed())
+	if len(lockedToken.RefundKeys) != 1 || lockedToken.RefundKeys[0] != expectedRefundKey {
+		t.Fatalf("expected refund key '%v' but got '%v'", expectedRefundKey, lockedToken.RefundKeys)
+	}
+
+	token, err := cashu.DecodeToken(lockedToken.Token)
+	if err != nil {
+		t.Fatalf("could not decode exported token: %v", err)
+	}
+	proofs := token.Proofs()
+	if len(proofs) != 1 || proofs[0].Secret != unspentProof.Secret {
+		t.Fatalf("expected token with unspent proof but got '%+v'", proofs)
+	}
+
+	// spent proofs are removed
+	lockedSends := db.GetLockedSends()
+	if len(lockedSends) != 1 || len(lockedSends[0].Proofs) != 1 {
+		t.Fatalf("expected only the unspent proof to be kept but got '%+v'", lockedSends)
+	}
+}
+
+func TestCanReclaim(t *testing.T) {
+	walletKey, _ := secp256k1.GeneratePrivateKey()
+	otherKey, _ := secp256k1.GeneratePrivateKey()
+	w := &Wallet{privateKey: walletKey}
+
+	expired := time.Now().Add(-time.Minute).Unix()
+	tests := []struct {
+		name        string
+		tags        nut11.P2PKTags
+		reclaimable bool
+	}{
+		{"no locktime", nut11.P2PKTags{Refund: []*secp256k1.PublicKey{walletKey.PubKey()}}, false},
+		{
+			"locktime not expired",
+			nut11.P2PKTags{
+				Locktime: time.Now().Add(time.Hour).Unix(),
+				Refund:   []*secp256k1.PublicKey{walletKey.PubKey()},
+			},
+			false,
+		},
+		{"no refund keys", nut11.P2PKTags{Locktime: expired}, true},
+		{
+			"wallet is refund key",
+			nut11.P2PKTags{Locktime: expired, Refund: []*secp256k1.PublicKey{otherKey.PubKey(), walletKey.PubKey()}},
+			true,
+		},
+		{
+			"wallet is not refund key",
+			nut11.P2PKTags{Locktime: expired, Refund: []*secp256k1.PublicKey{otherKey.PubKey()}},
+			false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := w.canReclaim(&test.tags)
+			if test.reclaimable && err != nil {
+				t.Fatalf("expected proofs to be reclaimable but got error: %v", err)
+			}
+			if !test.reclaimable && err == nil {
+				t.Fatal("expected error reclaiming proofs")
+			}
+		})
+	}
+}
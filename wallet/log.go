@@ -0,0 +1,65 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+)
+
+// value logged in place of secrets (proof secrets, preimages)
+// unless Config.LogSecrets is set
+const redacted = "[redacted]"
+
+func (w *Wallet) logInfof(format string, args ...any) {
+	w.log(slog.LevelInfo, format, args...)
+}
+
+func (w *Wallet) logErrorf(format string, args ...any) {
+	w.log(slog.LevelError, format, args...)
+}
+
+func (w *Wallet) logDebugf(format string, args ...any) {
+	w.log(slog.LevelDebug, format, args...)
+}
+
+func (w *Wallet) log(level slog.Level, format string, args ...any) {
+	if w.logger == nil || !w.logger.Enabled(context.Background(), level) {
+		return
+	}
+
+	// skip this and the logInfof, logErrorf or logDebugf caller
+	// so the source is from where those were called
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	r := slog.NewRecord(time.Now(), level, fmt.Sprintf(format, args...), pcs[0])
+	_ = w.logger.Handler().Handle(context.Background(), r)
+}
+
+// redact returns the secret only if logging secrets was enabled
+func (w *Wallet) redact(secret string) string {
+	if w.logSecrets {
+		return secret
+	}
+	return redacted
+}
+
+// proofsLog describes the proofs for logs. Secrets are redacted unless enabled.
+func (w *Wallet) proofsLog(proofs cashu.Proofs) string {
+	amounts := make([]uint64, len(proofs))
+	for i, proof := range proofs {
+		amounts[i] = proof.Amount
+	}
+	if !w.logSecrets {
+		return fmt.Sprintf("%v proofs with amounts %v", len(proofs), amounts)
+	}
+
+	secrets := make([]string, len(proofs))
+	for i, proof := range proofs {
+		secrets[i] = proof.Secret
+	}
+	return fmt.Sprintf("%v proofs with amounts %v and secrets %v", len(proofs), amounts, secrets)
+}
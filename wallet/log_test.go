@@ -0,0 +1,44 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/elnosh/gonuts/cashu"
+)
+
+func TestLogRedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{AddSource: true, Level: slog.LevelDebug}))
+	proofs := cashu.Proofs{{Amount: 2, Secret: "proofsecret"}, {Amount: 8, Secret: "othersecret"}}
+
+	w := &Wallet{logger: logger}
+	w.logDebugf("selected %v with preimage '%v'", w.proofsLog(proofs), w.redact("preimage"))
+	logged := buf.String()
+	if strings.Contains(logged, "proofsecret") || strings.Contains(logged, "preimage'") {
+		t.Fatalf("expected secrets to be redacted but got '%v'", logged)
+	}
+	if !strings.Contains(logged, "2 proofs with amounts [2 8]") || !strings.Contains(logged, redacted) {
+		t.Fatalf("unexpected log '%v'", logged)
+	}
+	// source is where the log method was called
+	if !strings.Contains(logged, "log_test.go") {
+		t.Fatalf("expected source of log to be the test but got '%v'", logged)
+	}
+
+	buf.Reset()
+	w.logSecrets = true
+	w.logInfof("selected %v with preimage '%v'", w.proofsLog(proofs), w.redact("preimage"))
+	logged = buf.String()
+	if !strings.Contains(logged, "proofsecret") || !strings.Contains(logged, "preimage 'preimage'") {
+		t.Fatalf("expected secrets in log but got '%v'", logged)
+	}
+
+	// no logger set
+	w = &Wallet{}
+	w.logErrorf("nothing is logged")
+}
@@ -0,0 +1,150 @@
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	satsPerBTC = 100_000_000
+
+	DefaultPriceCacheDuration = time.Minute * 5
+	DefaultMempoolURL         = "https://mempool.space"
+)
+
+var ErrNoPriceProvider = errors.New("wallet does not have a price provider")
+
+// PriceProvider gets the price of 1 BTC in a currency (i.e USD, EUR).
+type PriceProvider interface {
+	BTCPrice(currency string) (float64, error)
+}
+
+// MempoolPriceProvider gets prices from the prices endpoint of a
+// mempool.space instance. URL can be set to use a self-hosted instance.
+type MempoolPriceProvider struct {
+	URL string
+}
+
+func (mp *MempoolPriceProvider) BTCPrice(currency string) (float64, error) {
+	baseURL := mp.URL
+	if len(baseURL) == 0 {
+		baseURL = DefaultMempoolURL
+	}
+
+	resp, err := http.Get(strings.TrimSuffix(baseURL, "/") + "/api/v1/prices")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("error getting prices: %s", body)
+	}
+
+	var prices map[string]float64
+	if err := json.Unmarshal(body, &prices); err != nil {
+		return 0, fmt.Errorf("error reading prices: %v", err)
+	}
+
+	price, ok := prices[strings.ToUpper(currency)]
+	if !ok || price <= 0 {
+		return 0, fmt.Errorf("no price available for currency '%v'", currency)
+	}
+	return price, nil
+}
+
+type cachedPrice struct {
+	price     float64
+	fetchedAt time.Time
+}
+
+// CachedPriceProvider wraps a PriceProvider and keeps prices
+// for the cache duration before fetching them again.
+type CachedPriceProvider struct {
+	provider      PriceProvider
+	cacheDuration time.Duration
+
+	mu     sync.Mutex
+	prices map[string]cachedPrice
+}
+
+func NewCachedPriceProvider(provider PriceProvider, cacheDuration time.Duration) *CachedPriceProvider {
+	return &CachedPriceProvider{
+		provider:      provider,
+		cacheDuration: cacheDuration,
+		prices:        make(map[string]cachedPrice),
+	}
+}
+
+func (cp *CachedPriceProvider) BTCPrice(currency string) (float64, error) {
+	currency = strings.ToUpper(currency)
+
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+
+	cached, ok := cp.prices[currency]
+	if ok && time.Since(cached.fetchedAt) < cp.cacheDuration {
+		return cached.price, nil
+	}
+
+	price, err := cp.provider.BTCPrice(currency)
+	if err != nil {
+		return 0, err
+	}
+	cp.prices[currency] = cachedPrice{price: price, fetchedAt: time.Now()}
+	return price, nil
+}
+
+// SatsToCurrency converts the amount in sats to a currency
+// given the price of 1 BTC in that currency.
+func SatsToCurrency(amount uint64, btcPrice float64) float64 {
+	return float64(amount) / satsPerBTC * btcPrice
+}
+
+// ConvertAmount converts the amount in sats to the currency
+// using the price provider of the wallet.
+func (w *Wallet) ConvertAmount(amount uint64, currency string) (float64, error) {
+	if w.priceProvider == nil {
+		return 0, ErrNoPriceProvider
+	}
+
+	price, err := w.priceProvider.BTCPrice(currency)
+	if err != nil {
+		return 0, fmt.Errorf("could not get price: %v", err)
+	}
+	return SatsToCurrency(amount, price), nil
+}
+
+// GetBalanceIn returns the balance of the wallet in the currency.
+func (w *Wallet) GetBalanceIn(currency string) (float64, error) {
+	return w.ConvertAmount(w.GetBalance(), currency)
+}
+
+// GetBalanceByMintsIn returns the balance of each mint in the currency.
+func (w *Wallet) GetBalanceByMintsIn(currency string) (map[string]float64, error) {
+	if w.priceProvider == nil {
+		return nil, ErrNoPriceProvider
+	}
+
+	// get price once so all balances use the same one
+	price, err := w.priceProvider.BTCPrice(currency)
+	if err != nil {
+		return nil, fmt.Errorf("could not get price: %v", err)
+	}
+
+	balances := make(map[string]float64)
+	for mint, balance := range w.GetBalanceByMints() {
+		balances[mint] = SatsToCurrency(balance, price)
+	}
+	return balances, nil
+}
@@ -0,0 +1,86 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type countingPriceProvider struct {
+	price float64
+	calls int
+}
+
+func (cp *countingPriceProvider) BTCPrice(currency string) (float64, error) {
+	cp.calls++
+	return cp.price, nil
+}
+
+func TestCachedPriceProvider(t *testing.T) {
+	provider := &countingPriceProvider{price: 100000}
+	cached := NewCachedPriceProvider(provider, time.Millisecond*100)
+
+	for i := 0; i < 3; i++ {
+		price, err := cached.BTCPrice("usd")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if price != provider.price {
+			t.Fatalf("expected price %v but got %v", provider.price, price)
+		}
+	}
+	if provider.calls != 1 {
+		t.Fatalf("expected 1 call to provider but got %v", provider.calls)
+	}
+
+	time.Sleep(time.Millisecond * 150)
+	if _, err := cached.BTCPrice("USD"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider.calls != 2 {
+		t.Fatalf("expected 2 calls to provider after cache expired but got %v", provider.calls)
+	}
+}
+
+func TestMempoolPriceProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/prices" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"time":1700000000,"USD":50000,"EUR":45000}`))
+	}))
+	defer server.Close()
+
+	provider := &MempoolPriceProvider{URL: server.URL}
+	price, err := provider.BTCPrice("eur")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if price != 45000 {
+		t.Fatalf("expected price 45000 but got %v", price)
+	}
+
+	if _, err := provider.BTCPrice("XYZ"); err == nil {
+		t.Fatal("expected error for unknown currency but got nil")
+	}
+}
+
+func TestConvertAmount(t *testing.T) {
+	w := &Wallet{}
+	if _, err := w.ConvertAmount(1000, "USD"); err != ErrNoPriceProvider {
+		t.Fatalf("expected error '%v' but got '%v'", ErrNoPriceProvider, err)
+	}
+
+	w.priceProvider = &countingPriceProvider{price: 50000}
+	converted, err := w.ConvertAmount(21000, "USD")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if converted != 10.5 {
+		t.Fatalf("expected 10.5 but got %v", converted)
+	}
+}
@@ -0,0 +1,137 @@
+package wallet
+
+import (
+	"cmp"
+	"encoding/hex"
+	"slices"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// ProofInfo is a proof stored in the wallet with
+// the mint it is from and its state in the wallet.
+type ProofInfo struct {
+	cashu.Proof
+	Y    string
+	Mint string
+	// set if the secret has a spending condition (P2PK or HTLC)
+	Locked   bool
+	LockKind nut10.SecretKind
+	// pending proofs were sent or used in a melt and
+	// are not available to spend until they are checked
+	Pending bool
+	// melt quote for which the pending proof was used, if any
+	MeltQuoteId string
+}
+
+// ProofFilter selects the proofs returned by ListProofs.
+// Fields that are not set do not filter.
+type ProofFilter struct {
+	Mint     string
+	KeysetId string
+	// denomination of the proofs
+	Amount uint64
+	// only locked or only unlocked proofs if set
+	Locked *bool
+	// only pending or only available proofs if set
+	Pending *bool
+
+	// number of matching proofs to skip and max number to return.
+	// All matching proofs are returned if Limit is not set.
+	Offset int
+	Limit  int
+}
+
+// ListProofs returns the proofs in the wallet that match the filter
+// and the total number of matching proofs, for pagination.
+// Proofs are sorted by mint, keyset, amount and Y so pages are stable.
+func (w *Wallet) ListProofs(filter ProofFilter) ([]ProofInfo, int) {
+	mintByKeyset := make(map[string]string)
+	for _, mint := range w.mints {
+		mintByKeyset[mint.activeKeyset.Id] = mint.mintURL
+		for _, keyset := range mint.inactiveKeysets {
+			mintByKeyset[keyset.Id] = mint.mintURL
+		}
+	}
+
+	var proofs []ProofInfo
+	if filter.Pending == nil || !*filter.Pending {
+		for _, proof := range w.db.GetProofs() {
+			Y, err := crypto.HashToCurve([]byte(proof.Secret))
+			if err != nil {
+				continue
+			}
+			proofs = append(proofs, newProofInfo(proof, hex.EncodeToString(Y.SerializeCompressed())))
+		}
+	}
+	if filter.Pending == nil || *filter.Pending {
+		for _, dbProof := range w.db.GetPendingProofs() {
+			proofInfo := newProofInfo(pendingToProof(dbProof), dbProof.Y)
+			proofInfo.Pending = true
+			proofInfo.MeltQuoteId = dbProof.MeltQuoteId
+			proofs = append(proofs, proofInfo)
+		}
+	}
+
+	matching := make([]ProofInfo, 0, len(proofs))
+	for _, proof := range proofs {
+		proof.Mint = mintByKeyset[proof.Id]
+		if filter.matches(proof) {
+			matching = append(matching, proof)
+		}
+	}
+	slices.SortFunc(matching, func(a, b ProofInfo) int {
+		return cmp.Or(
+			cmp.Compare(a.Mint, b.Mint),
+			cmp.Compare(a.Id, b.Id),
+			cmp.Compare(a.Amount, b.Amount),
+			cmp.Compare(a.Y, b.Y),
+		)
+	})
+
+	total := len(matching)
+	start := min(max(filter.Offset, 0), total)
+	end := total
+	if filter.Limit > 0 {
+		end = min(start+filter.Limit, total)
+	}
+	return matching[start:end], total
+}
+
+func newProofInfo(proof cashu.Proof, Y string) ProofInfo {
+	proofInfo := ProofInfo{Proof: proof, Y: Y}
+	if secret, err := nut10.DeserializeSecret(proof.Secret); err == nil {
+		proofInfo.Locked = true
+		proofInfo.LockKind = secret.Kind
+	}
+	return proofInfo
+}
+
+func pendingToProof(dbProof storage.DBProof) cashu.Proof {
+	return cashu.Proof{
+		Amount: dbProof.Amount,
+		Id:     dbProof.Id,
+		Secret: dbProof.Secret,
+		C:      dbProof.C,
+		DLEQ:   dbProof.DLEQ,
+	}
+}
+
+func (filter ProofFilter) matches(proof ProofInfo) bool {
+	if len(filter.Mint) > 0 && proof.Mint != filter.Mint {
+		return false
+	}
+	if len(filter.KeysetId) > 0 && proof.Id != filter.KeysetId {
+		return false
+	}
+	if filter.Amount > 0 && proof.Amount != filter.Amount {
+		return false
+	}
+	if filter.Locked != nil && proof.Locked != *filter.Locked {
+		return false
+	}
+	return true
+}
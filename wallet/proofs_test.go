@@ -0,0 +1,121 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestListProofs(t *testing.T) {
+	db := storage.NewMemoryDB()
+
+	mintA := walletMint{
+		mintURL:      "http://mint-a.com",
+		activeKeyset: crypto.WalletKeyset{Id: "00aaaaaaaaaaaaaa"},
+		inactiveKeysets: map[string]crypto.WalletKeyset{
+			"00cccccccccccccc": {Id: "00cccccccccccccc"},
+		},
+	}
+	mintB := walletMint{mintURL: "http://mint-b.com", activeKeyset: crypto.WalletKeyset{Id: "00bbbbbbbbbbbbbb"}}
+	w := &Wallet{
+		db:    db,
+		unit:  cashu.Sat,
+		mints: map[string]walletMint{mintA.mintURL: mintA, mintB.mintURL: mintB},
+	}
+
+	newProofs := func(keysetId string, amounts ...uint64) cashu.Proofs {
+		proofs := make(cashu.Proofs, len(amounts))
+		for i, amount := range amounts {
+			proofs[i] = cashu.Proof{
+				Amount: amount,
+				Id:     keysetId,
+				Secret: fmt.Sprintf("secret-%v-%v-%v", keysetId, amount, i),
+				C:      "02aa",
+			}
+		}
+		return proofs
+	}
+
+	key, _ := secp256k1.GeneratePrivateKey()
+	lockedSecret, err := nut10.NewSecretFromSpendingCondition(nut10.SpendingCondition{
+		Kind: nut10.P2PK,
+		Data: fmt.Sprintf("%x", key.PubKey().SerializeCompressed()),
+	})
+	if err != nil {
+		t.Fatalf("error creating secret: %v", err)
+	}
+	lockedProof := cashu.Proof{Amount: 4, Id: mintB.activeKeyset.Id, Secret: lockedSecret, C: "02aa"}
+
+	if err := db.SaveProofs(newProofs(mintA.activeKeyset.Id, 1, 2, 2, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveProofs(newProofs("00cccccccccccccc", 16)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveProofs(append(newProofs(mintB.activeKeyset.Id, 2), lockedProof)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddPendingProofsByQuoteId(newProofs(mintB.activeKeyset.Id, 32), "quote1"); err != nil {
+		t.Fatal(err)
+	}
+
+	yes, no := true, false
+	tests := []struct {
+		name          string
+		filter        ProofFilter
+		expectedCount int
+		expectedTotal int
+	}{
+		{"all", ProofFilter{}, 8, 8},
+		{"mint with inactive keyset", ProofFilter{Mint: mintA.mintURL}, 5, 5},
+		{"keyset", ProofFilter{KeysetId: mintA.activeKeyset.Id}, 4, 4},
+		{"denomination", ProofFilter{Amount: 2}, 3, 3},
+		{"locked", ProofFilter{Locked: &yes}, 1, 1},
+		{"pending", ProofFilter{Pending: &yes}, 1, 1},
+		{"available", ProofFilter{Pending: &no}, 7, 7},
+		{"page", ProofFilter{Offset: 2, Limit: 4}, 4, 8},
+		{"last page", ProofFilter{Offset: 6, Limit: 4}, 2, 8},
+		{"offset over total", ProofFilter{Offset: 10, Limit: 4}, 0, 8},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			proofs, total := w.ListProofs(test.filter)
+			if len(proofs) != test.expectedCount {
+				t.Fatalf("expected %v proofs but got %v", test.expectedCount, len(proofs))
+			}
+			if total != test.expectedTotal {
+				t.Fatalf("expected total of %v but got %v", test.expectedTotal, total)
+			}
+		})
+	}
+
+	lockedProofs, _ := w.ListProofs(ProofFilter{Locked: &yes})
+	if lockedProofs[0].Secret != lockedSecret || lockedProofs[0].LockKind != nut10.P2PK {
+		t.Fatalf("expected locked P2PK proof but got '%+v'", lockedProofs[0])
+	}
+	pendingProofs, _ := w.ListProofs(ProofFilter{Pending: &yes})
+	if pendingProofs[0].MeltQuoteId != "quote1" || pendingProofs[0].Mint != mintB.mintURL {
+		t.Fatalf("expected pending proof for quote from mint B but got '%+v'", pendingProofs[0])
+	}
+
+	// pages have all proofs in the same order
+	allProofs, _ := w.ListProofs(ProofFilter{})
+	var pagedProofs []ProofInfo
+	for offset := 0; offset < len(allProofs); offset += 3 {
+		page, _ := w.ListProofs(ProofFilter{Offset: offset, Limit: 3})
+		pagedProofs = append(pagedProofs, page...)
+	}
+	for i := range allProofs {
+		if allProofs[i].Y != pagedProofs[i].Y {
+			t.Fatalf("expected proof '%v' at %v but got '%v'", allProofs[i].Y, i, pagedProofs[i].Y)
+		}
+	}
+}
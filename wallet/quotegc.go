@@ -0,0 +1,76 @@
+package wallet
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+)
+
+// RemovedQuotes is the number of quotes removed by RemoveStaleQuotes
+type RemovedQuotes struct {
+	MintQuotes int
+	MeltQuotes int
+}
+
+// RemoveStaleQuotes removes the mint and melt quotes that are done and older
+// than the retention from the wallet db. Quotes are done if they were issued
+// or paid, or if they expired without being paid. Paid mint quotes that
+// have not been issued yet and melt quotes still referenced by pending
+// proofs or an unfinished operation are never removed.
+func (w *Wallet) RemoveStaleQuotes(retention time.Duration) (RemovedQuotes, error) {
+	var removed RemovedQuotes
+	now := time.Now()
+	cutoff := now.Add(-retention).Unix()
+
+	for _, quote := range w.db.GetMintQuotes() {
+		if quoteTime(quote.CreatedAt, quote.SettledAt) > cutoff {
+			continue
+		}
+		expired := quote.QuoteExpiry > 0 && int64(quote.QuoteExpiry) < now.Unix()
+		if quote.State != nut04.Issued && !(quote.State == nut04.Unpaid && expired) {
+			continue
+		}
+		if err := w.db.DeleteMintQuote(quote.QuoteId); err != nil {
+			return removed, fmt.Errorf("error removing mint quote '%v': %v", quote.QuoteId, err)
+		}
+		removed.MintQuotes++
+	}
+
+	// melt quotes used in operations that have not completed
+	inOperation := make(map[string]bool)
+	for _, operation := range w.db.GetOperations() {
+		if len(operation.QuoteId) > 0 {
+			inOperation[operation.QuoteId] = true
+		}
+	}
+	for _, quote := range w.db.GetMeltQuotes() {
+		if quoteTime(quote.CreatedAt, quote.SettledAt) > cutoff {
+			continue
+		}
+		expired := quote.QuoteExpiry > 0 && int64(quote.QuoteExpiry) < now.Unix()
+		if quote.State != nut05.Paid && !(quote.State == nut05.Unpaid && expired) {
+			continue
+		}
+		if inOperation[quote.QuoteId] || len(w.db.GetPendingProofsByQuoteId(quote.QuoteId)) > 0 {
+			continue
+		}
+		if err := w.db.DeleteMeltQuote(quote.QuoteId); err != nil {
+			return removed, fmt.Errorf("error removing melt quote '%v': %v", quote.QuoteId, err)
+		}
+		removed.MeltQuotes++
+	}
+
+	if removed.MintQuotes > 0 || removed.MeltQuotes > 0 {
+		w.logInfof("removed %v mint quotes and %v melt quotes older than %v",
+			removed.MintQuotes, removed.MeltQuotes, retention)
+	}
+	return removed, nil
+}
+
+// quoteTime is when the quote was last updated. Quotes migrated
+// from invoices might not have either time and are treated as old.
+func quoteTime(createdAt, settledAt int64) int64 {
+	return max(createdAt, settledAt)
+}
@@ -0,0 +1,98 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestRemoveStaleQuotes(t *testing.T) {
+	db := storage.NewMemoryDB()
+	w := &Wallet{db: db}
+
+	now := time.Now()
+	old := now.Add(-48 * time.Hour).Unix()
+	recent := now.Add(-time.Hour).Unix()
+	expired := uint64(now.Add(-24 * time.Hour).Unix())
+	notExpired := uint64(now.Add(time.Hour).Unix())
+
+	mintQuotes := []storage.MintQuote{
+		{QuoteId: "issued", State: nut04.Issued, CreatedAt: old, SettledAt: old},
+		{QuoteId: "unpaid-expired", State: nut04.Unpaid, CreatedAt: old, QuoteExpiry: expired},
+		{QuoteId: "no-time", State: nut04.Issued},
+		{QuoteId: "issued-recent", State: nut04.Issued, CreatedAt: old, SettledAt: recent},
+		{QuoteId: "unpaid", State: nut04.Unpaid, CreatedAt: old, QuoteExpiry: notExpired},
+		{QuoteId: "paid", State: nut04.Paid, CreatedAt: old, QuoteExpiry: expired},
+	}
+	meltQuotes := []storage.MeltQuote{
+		{QuoteId: "paid", State: nut05.Paid, CreatedAt: old, SettledAt: old},
+		{QuoteId: "unpaid-expired", State: nut05.Unpaid, CreatedAt: old, QuoteExpiry: expired},
+		{QuoteId: "paid-recent", State: nut05.Paid, CreatedAt: recent},
+		{QuoteId: "pending", State: nut05.Pending, CreatedAt: old, QuoteExpiry: expired},
+		{QuoteId: "pending-proofs", State: nut05.Paid, CreatedAt: old},
+		{QuoteId: "in-operation", State: nut05.Paid, CreatedAt: old},
+	}
+	for _, quote := range mintQuotes {
+		if err := db.SaveMintQuote(quote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, quote := range meltQuotes {
+		if err := db.SaveMeltQuote(quote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proofs := cashu.Proofs{{Amount: 8, Id: "keyset", Secret: "secret", C: "02aa"}}
+	if err := db.AddPendingProofsByQuoteId(proofs, "pending-proofs"); err != nil {
+		t.Fatal(err)
+	}
+	operation := storage.Operation{Id: "op", Kind: storage.MeltOperation, QuoteId: "in-operation"}
+	if err := db.SaveOperation(operation); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := w.RemoveStaleQuotes(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error removing quotes: %v", err)
+	}
+	expected := RemovedQuotes{MintQuotes: 3, MeltQuotes: 2}
+	if removed != expected {
+		t.Fatalf("expected removed quotes '%+v' but got '%+v'", expected, removed)
+	}
+
+	for _, id := range []string{"issued", "unpaid-expired", "no-time"} {
+		if db.GetMintQuoteById(id) != nil {
+			t.Fatalf("expected mint quote '%v' to be removed", id)
+		}
+	}
+	for _, id := range []string{"issued-recent", "unpaid", "paid"} {
+		if db.GetMintQuoteById(id) == nil {
+			t.Fatalf("expected mint quote '%v' to be kept", id)
+		}
+	}
+	for _, id := range []string{"paid", "unpaid-expired"} {
+		if db.GetMeltQuoteById(id) != nil {
+			t.Fatalf("expected melt quote '%v' to be removed", id)
+		}
+	}
+	for _, id := range []string{"paid-recent", "pending", "pending-proofs", "in-operation"} {
+		if db.GetMeltQuoteById(id) == nil {
+			t.Fatalf("expected melt quote '%v' to be kept", id)
+		}
+	}
+
+	// nothing else to remove
+	removed, err = w.RemoveStaleQuotes(24 * time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error removing quotes: %v", err)
+	}
+	if removed != (RemovedQuotes{}) {
+		t.Fatalf("expected no quotes removed but got '%+v'", removed)
+	}
+}
@@ -0,0 +1,97 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+)
+
+var ErrReceiveFeesTooHigh = errors.New("token too small to redeem economically")
+
+// ReceiveFeePolicy rejects tokens received to the same mint for which the input
+// fees of the swap are too high compared to their amount. Fees of receiving to
+// the default mint are limited by MaxSwapLoss instead. The zero value has no limits.
+type ReceiveFeePolicy struct {
+	// MaxFeePercent is the max percent of the amount of the
+	// token that can be paid in fees. 0 means no limit.
+	MaxFeePercent float64
+
+	// MinAmount is the min amount that has to be
+	// received after paying the fees. 0 means no limit.
+	MinAmount uint64
+}
+
+// ReceiveFeeError is returned when receiving a token is rejected by the
+// ReceiveFeePolicy. It has the fees so apps can show why the token was not
+// received. It matches ErrReceiveFeesTooHigh with errors.Is.
+type ReceiveFeeError struct {
+	Mint string
+	// amount of the token
+	Amount uint64
+	// input fees for the swap to receive the token and to
+	// refresh the proofs received if RefreshAfterReceive is set
+	Fees uint64
+
+	Policy ReceiveFeePolicy
+}
+
+func (e *ReceiveFeeError) Error() string {
+	return fmt.Sprintf("%v: fees of %v for token of %v from mint '%v' exceed the receive fee policy",
+		ErrReceiveFeesTooHigh, e.Fees, e.Amount, e.Mint)
+}
+
+func (e *ReceiveFeeError) Unwrap() error {
+	return ErrReceiveFeesTooHigh
+}
+
+// FeePercent is the percent of the amount paid in fees
+func (e *ReceiveFeeError) FeePercent() float64 {
+	if e.Amount == 0 {
+		return 100
+	}
+	return float64(e.Fees) * 100 / float64(e.Amount)
+}
+
+// checkReceiveFees checks the fees to receive the proofs against the ReceiveFeePolicy.
+// The mint can be one that is not in the wallet yet.
+func (w *Wallet) checkReceiveFees(proofs cashu.Proofs, mint *walletMint) error {
+	policy := w.receiveFeePolicy
+	if policy.MaxFeePercent <= 0 && policy.MinAmount == 0 {
+		return nil
+	}
+
+	amount := proofs.Amount()
+	fees := uint64(feesForProofs(proofs, mint))
+	if w.refreshAfterReceive && fees < amount {
+		// the proofs received are inputs of another swap
+		count := len(cashu.AmountSplit(amount - fees))
+		fees += uint64(feesForCount(count, &mint.activeKeyset))
+	}
+
+	feeErr := &ReceiveFeeError{Mint: mint.mintURL, Amount: amount, Fees: fees, Policy: policy}
+	if fees >= amount {
+		return feeErr
+	}
+	if policy.MaxFeePercent > 0 && feeErr.FeePercent() > policy.MaxFeePercent {
+		return feeErr
+	}
+	if policy.MinAmount > 0 && amount-fees < policy.MinAmount {
+		return feeErr
+	}
+	return nil
+}
+
+// receiveMint returns the mint to receive the token with the active keyset passed.
+// Inactive keysets of mints not in the wallet are fetched to get the fees of proofs from them.
+func (w *Wallet) receiveMint(mintURL string, activeKeyset *crypto.WalletKeyset) (*walletMint, error) {
+	if mint, ok := w.mints[mintURL]; ok {
+		return &mint, nil
+	}
+	inactiveKeysets, err := GetMintInactiveKeysets(mintURL, w.unit)
+	if err != nil {
+		return nil, err
+	}
+	return &walletMint{mintURL: mintURL, activeKeyset: *activeKeyset, inactiveKeysets: inactiveKeysets}, nil
+}
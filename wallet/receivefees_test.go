@@ -0,0 +1,69 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+)
+
+func TestCheckReceiveFees(t *testing.T) {
+	mintURL := "http://127.0.0.1:3338"
+	mint := &walletMint{
+		mintURL:      mintURL,
+		activeKeyset: crypto.WalletKeyset{Id: "009a1f293253e41e", InputFeePpk: 1000},
+		inactiveKeysets: map[string]crypto.WalletKeyset{
+			"00ad268c4d1f5826": {Id: "00ad268c4d1f5826", InputFeePpk: 100},
+		},
+	}
+	// 1 sat in fees for each proof from the active keyset
+	// and 1 sat for the 3 proofs from the inactive keyset
+	proofs := cashu.Proofs{
+		{Amount: 8, Id: "009a1f293253e41e"},
+		{Amount: 4, Id: "009a1f293253e41e"},
+		{Amount: 8, Id: "00ad268c4d1f5826"},
+		{Amount: 8, Id: "00ad268c4d1f5826"},
+		{Amount: 2, Id: "00ad268c4d1f5826"},
+	}
+
+	tests := []struct {
+		policy  ReceiveFeePolicy
+		refresh bool
+		// expected fees if rejected
+		fees uint64
+	}{
+		{policy: ReceiveFeePolicy{}},
+		{policy: ReceiveFeePolicy{MaxFeePercent: 10}},
+		{policy: ReceiveFeePolicy{MaxFeePercent: 5}, fees: 3},
+		{policy: ReceiveFeePolicy{MinAmount: 27}},
+		{policy: ReceiveFeePolicy{MinAmount: 28}, fees: 3},
+		// 27 received are split in 4 proofs to refresh
+		{policy: ReceiveFeePolicy{MaxFeePercent: 10}, refresh: true, fees: 7},
+		{policy: ReceiveFeePolicy{MaxFeePercent: 25}, refresh: true},
+	}
+
+	for _, test := range tests {
+		w := &Wallet{receiveFeePolicy: test.policy, refreshAfterReceive: test.refresh}
+		err := w.checkReceiveFees(proofs, mint)
+		if test.fees == 0 {
+			if err != nil {
+				t.Fatalf("unexpected error with policy '%+v': %v", test.policy, err)
+			}
+			continue
+		}
+
+		if !errors.Is(err, ErrReceiveFeesTooHigh) {
+			t.Fatalf("expected error '%v' with policy '%+v' but got '%v'", ErrReceiveFeesTooHigh, test.policy, err)
+		}
+		var feeErr *ReceiveFeeError
+		if !errors.As(err, &feeErr) {
+			t.Fatalf("expected ReceiveFeeError but got '%v'", err)
+		}
+		if feeErr.Amount != 30 || feeErr.Fees != test.fees || feeErr.Mint != mintURL {
+			t.Fatalf("expected fees of %v for amount 30 but got '%+v'", test.fees, feeErr)
+		}
+	}
+}
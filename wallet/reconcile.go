@@ -0,0 +1,231 @@
+package wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/client"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+const (
+	// DefaultReconcileInterval is how often RunReconcile checks the proofs if not set
+	DefaultReconcileInterval = time.Hour
+	// DefaultReconcileSampleSize is the number of proofs checked
+	// from each mint in a reconciliation if not set
+	DefaultReconcileSampleSize = 64
+)
+
+type ReconcileOptions struct {
+	// DefaultReconcileInterval if not set
+	Interval time.Duration
+	// max number of proofs checked from each mint.
+	// DefaultReconcileSampleSize if not set
+	SampleSize int
+	// remove the proofs the mint reports as spent
+	// from the wallet and keep them in quarantine
+	Quarantine bool
+}
+
+// Discrepancy is a proof held by the wallet as unspent that the mint
+// reports as spent or pending. The wallet did not spend it, which can mean
+// that the seed is being used by another wallet or there is a bug.
+type Discrepancy struct {
+	Mint     string
+	Y        string
+	Amount   uint64
+	KeysetId string
+	State    nut07.State
+	// proof was removed from the wallet. Only proofs
+	// in spent state are quarantined.
+	Quarantined bool
+
+	proof cashu.Proof
+}
+
+// ReconcileReport is the result of checking the
+// state of a sample of the proofs held by the wallet
+type ReconcileReport struct {
+	Time int64
+	// number of proofs checked by mint
+	Checked       map[string]int
+	Discrepancies []Discrepancy
+	// mints that could not be checked
+	Errors map[string]error
+}
+
+// Amount of the proofs with discrepancies
+func (report ReconcileReport) Amount() uint64 {
+	var amount uint64
+	for _, discrepancy := range report.Discrepancies {
+		amount += discrepancy.Amount
+	}
+	return amount
+}
+
+// Reconcile checks the state (NUT-07) of a random sample of the proofs of each
+// mint and reports the ones that the mint does not have as unspent. If quarantine
+// is set, proofs in spent state are moved out of the wallet so they are not
+// used. Mints that can't be reached are reported in the errors of the report.
+func (w *Wallet) Reconcile(options ReconcileOptions) (ReconcileReport, error) {
+	sampleSize := options.SampleSize
+	if sampleSize <= 0 {
+		sampleSize = DefaultReconcileSampleSize
+	}
+
+	// inputs of operations that did not complete can be spent. Those are
+	// resolved by Recover
+	inOperation := make(map[string]bool)
+	for _, operation := range w.db.GetOperations() {
+		for _, proof := range operation.Inputs {
+			inOperation[proof.Secret] = true
+		}
+	}
+
+	report := ReconcileReport{
+		Time:    time.Now().Unix(),
+		Checked: make(map[string]int),
+		Errors:  make(map[string]error),
+	}
+	for mintURL := range w.mints {
+		var proofs cashu.Proofs
+		for _, proof := range w.getProofsFromMint(mintURL) {
+			if !inOperation[proof.Secret] {
+				proofs = append(proofs, proof)
+			}
+		}
+		if len(proofs) == 0 {
+			continue
+		}
+		rand.Shuffle(len(proofs), func(i, j int) {
+			proofs[i], proofs[j] = proofs[j], proofs[i]
+		})
+		proofs = proofs[:min(len(proofs), sampleSize)]
+
+		discrepancies, err := reconcileMint(mintURL, proofs)
+		if err != nil {
+			w.logErrorf("could not reconcile proofs from mint '%v': %v", mintURL, err)
+			report.Errors[mintURL] = err
+			continue
+		}
+		report.Checked[mintURL] = len(proofs)
+
+		var toQuarantine []storage.QuarantinedProof
+		for i, discrepancy := range discrepancies {
+			w.logErrorf("proof '%v' with amount %v held by the wallet is %v in mint '%v'",
+				discrepancy.Y, discrepancy.Amount, discrepancy.State, mintURL)
+			if options.Quarantine && discrepancy.State == nut07.Spent {
+				discrepancies[i].Quarantined = true
+				toQuarantine = append(toQuarantine, storage.QuarantinedProof{
+					Y:             discrepancy.Y,
+					Mint:          mintURL,
+					Proof:         discrepancy.proof,
+					State:         discrepancy.State.String(),
+					QuarantinedAt: report.Time,
+				})
+			}
+		}
+		if len(toQuarantine) > 0 {
+			if err := w.db.QuarantineProofs(toQuarantine); err != nil {
+				return report, fmt.Errorf("error quarantining proofs: %v", err)
+			}
+			w.logInfof("quarantined %v proofs from mint '%v'", len(toQuarantine), mintURL)
+		}
+		report.Discrepancies = append(report.Discrepancies, discrepancies...)
+	}
+
+	if len(report.Discrepancies) > 0 {
+		w.logErrorf("found %v proofs with amount %v that the mint does not have as unspent",
+			len(report.Discrepancies), report.Amount())
+	}
+	w.lastReconcile = &report
+	return report, nil
+}
+
+// reconcileMint returns the proofs that are not unspent in the mint
+func reconcileMint(mintURL string, proofs cashu.Proofs) ([]Discrepancy, error) {
+	Ys := make([]string, len(proofs))
+	proofsByY := make(map[string]cashu.Proof, len(proofs))
+	for i, proof := range proofs {
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			return nil, err
+		}
+		Ys[i] = hex.EncodeToString(Y.SerializeCompressed())
+		proofsByY[Ys[i]] = proof
+	}
+
+	response, err := client.PostCheckProofState(mintURL, nut07.PostCheckStateRequest{Ys: Ys})
+	if err != nil {
+		return nil, fmt.Errorf("could not check proof states: %v", err)
+	}
+
+	var discrepancies []Discrepancy
+	for _, state := range response.States {
+		proof, ok := proofsByY[state.Y]
+		if !ok || state.State == nut07.Unspent {
+			continue
+		}
+		discrepancies = append(discrepancies, Discrepancy{
+			Mint:     mintURL,
+			Y:        state.Y,
+			Amount:   proof.Amount,
+			KeysetId: proof.Id,
+			State:    state.State,
+			proof:    proof,
+		})
+	}
+	return discrepancies, nil
+}
+
+// RunReconcile calls Reconcile every interval until the context is done
+// and passes the report to the handler. It is called from the goroutine of
+// RunReconcile so the handler can use the wallet.
+func (w *Wallet) RunReconcile(
+	ctx context.Context,
+	options ReconcileOptions,
+	handler func(ReconcileReport),
+) error {
+	interval := options.Interval
+	if interval <= 0 {
+		interval = DefaultReconcileInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		report, err := w.Reconcile(options)
+		if err != nil {
+			return err
+		}
+		if handler != nil {
+			handler(report)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// LastReconcileReport returns the report of the last reconciliation
+// and false if there has not been one
+func (w *Wallet) LastReconcileReport() (ReconcileReport, bool) {
+	if w.lastReconcile == nil {
+		return ReconcileReport{}, false
+	}
+	return *w.lastReconcile, true
+}
+
+// QuarantinedProofs returns the proofs moved out of the
+// wallet because the mint reported them as spent
+func (w *Wallet) QuarantinedProofs() []storage.QuarantinedProof {
+	return w.db.GetQuarantinedProofs()
+}
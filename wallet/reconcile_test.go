@@ -0,0 +1,144 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestReconcile(t *testing.T) {
+	Y := func(secret string) string {
+		Y, _ := crypto.HashToCurve([]byte(secret))
+		return hex.EncodeToString(Y.SerializeCompressed())
+	}
+	mintStates := map[string]nut07.State{
+		Y("spent"):     nut07.Spent,
+		Y("pending"):   nut07.Pending,
+		Y("operation"): nut07.Spent,
+	}
+	checked := make(chan []string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request nut07.PostCheckStateRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		checked <- request.Ys
+		states := make([]nut07.ProofState, len(request.Ys))
+		for i, Y := range request.Ys {
+			states[i] = nut07.ProofState{Y: Y, State: mintStates[Y]}
+		}
+		json.NewEncoder(w).Encode(nut07.PostCheckStateResponse{States: states})
+	}))
+	defer server.Close()
+	unreachableMint := "http://127.0.0.1:1"
+
+	db := storage.NewMemoryDB()
+	keyset := crypto.WalletKeyset{Id: "009a1f293253e41e", MintURL: server.URL}
+	otherKeyset := crypto.WalletKeyset{Id: "00ad268c4d1f5826", MintURL: unreachableMint}
+	w := &Wallet{
+		db:   db,
+		unit: cashu.Sat,
+		mints: map[string]walletMint{
+			server.URL:      {mintURL: server.URL, activeKeyset: keyset},
+			unreachableMint: {mintURL: unreachableMint, activeKeyset: otherKeyset},
+		},
+	}
+
+	proofs := cashu.Proofs{
+		{Amount: 8, Id: keyset.Id, Secret: "spent", C: "02aa"},
+		{Amount: 4, Id: keyset.Id, Secret: "pending", C: "02aa"},
+		{Amount: 2, Id: keyset.Id, Secret: "unspent", C: "02aa"},
+		{Amount: 1, Id: keyset.Id, Secret: "operation", C: "02aa"},
+		{Amount: 16, Id: otherKeyset.Id, Secret: "othermint", C: "02aa"},
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatal(err)
+	}
+	// inputs of operations in the journal are left for Recover
+	operation := storage.Operation{Id: "operation", Kind: storage.SwapOperation, Inputs: proofs[3:4]}
+	if err := db.SaveOperation(operation); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := w.LastReconcileReport(); ok {
+		t.Fatal("expected no report before reconciling")
+	}
+
+	report, err := w.Reconcile(ReconcileOptions{Quarantine: true})
+	if err != nil {
+		t.Fatalf("unexpected error reconciling: %v", err)
+	}
+	if report.Checked[server.URL] != 3 {
+		t.Fatalf("expected 3 proofs checked but got %v", report.Checked[server.URL])
+	}
+	if _, ok := report.Errors[unreachableMint]; !ok || len(report.Errors) != 1 {
+		t.Fatalf("expected error from unreachable mint but got '%v'", report.Errors)
+	}
+	if len(report.Discrepancies) != 2 || report.Amount() != 12 {
+		t.Fatalf("expected 2 discrepancies with amount 12 but got '%+v'", report.Discrepancies)
+	}
+	for _, discrepancy := range report.Discrepancies {
+		switch discrepancy.Y {
+		case Y("spent"):
+			if discrepancy.State != nut07.Spent || !discrepancy.Quarantined {
+				t.Fatalf("expected spent proof to be quarantined but got '%+v'", discrepancy)
+			}
+		case Y("pending"):
+			if discrepancy.State != nut07.Pending || discrepancy.Quarantined {
+				t.Fatalf("expected pending proof to not be quarantined but got '%+v'", discrepancy)
+			}
+		default:
+			t.Fatalf("unexpected discrepancy '%+v'", discrepancy)
+		}
+	}
+
+	quarantined := w.QuarantinedProofs()
+	if len(quarantined) != 1 || quarantined[0].Proof != proofs[0] || quarantined[0].Mint != server.URL {
+		t.Fatalf("expected spent proof in quarantine but got '%+v'", quarantined)
+	}
+	if slices.Contains(db.GetProofs(), proofs[0]) {
+		t.Fatal("expected quarantined proof to be removed from wallet")
+	}
+	if balance := w.GetBalance(); balance != 23 {
+		t.Fatalf("expected balance of 23 but got %v", balance)
+	}
+	if last, ok := w.LastReconcileReport(); !ok || last.Time != report.Time {
+		t.Fatalf("expected last report '%+v' but got '%+v'", report, last)
+	}
+	<-checked
+
+	// sample is limited to the size
+	ctx, cancel := context.WithCancel(context.Background())
+	reports := make(chan ReconcileReport)
+	done := make(chan error)
+	go func() {
+		done <- w.RunReconcile(ctx, ReconcileOptions{Interval: time.Hour, SampleSize: 1}, func(report ReconcileReport) {
+			reports <- report
+		})
+	}()
+	select {
+	case report := <-reports:
+		if report.Checked[server.URL] != 1 {
+			t.Fatalf("expected 1 proof checked but got %v", report.Checked[server.URL])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not get reconcile report")
+	}
+	if Ys := <-checked; len(Ys) != 1 {
+		t.Fatalf("expected 1 proof in request but got %v", len(Ys))
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error from reconcile: %v", err)
+	}
+}
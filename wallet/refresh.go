@@ -0,0 +1,103 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// max number of proofs swapped in a single request when refreshing
+const maxRefreshInputs = 100
+
+var ErrRefreshFees = errors.New("fees to refresh proofs are more than their amount")
+
+// RefreshProofs swaps all the proofs from the mint for new ones. The mint can't
+// link the new proofs to the ones the wallet received or minted. Each swap pays
+// the input fees of the mint. It returns the amount of the new proofs.
+func (w *Wallet) RefreshProofs(mintURL string) (uint64, error) {
+	mint, ok := w.mints[mintURL]
+	if !ok {
+		return 0, ErrMintNotExist
+	}
+	if _, err := w.getActiveKeyset(mintURL); err != nil {
+		return 0, fmt.Errorf("could not get active keyset: %v", err)
+	}
+	mint = w.mints[mintURL]
+
+	proofs := w.getProofsFromMint(mintURL)
+	var refreshed uint64
+	for i := 0; i < len(proofs); i += maxRefreshInputs {
+		batch := proofs[i:min(i+maxRefreshInputs, len(proofs))]
+		newProofs, err := w.refreshProofs(batch, &mint)
+		if err != nil {
+			return refreshed, err
+		}
+		refreshed += newProofs.Amount()
+	}
+	if refreshed > 0 {
+		w.logInfof("refreshed %v proofs with amount %v from mint '%v'", len(proofs), refreshed, mintURL)
+	}
+	return refreshed, nil
+}
+
+// RefreshAllProofs refreshes the proofs from all the mints in the wallet.
+// Mints that fail do not stop the rest from being refreshed.
+func (w *Wallet) RefreshAllProofs() (uint64, error) {
+	var refreshed uint64
+	var errs []error
+	for mintURL := range w.mints {
+		amount, err := w.RefreshProofs(mintURL)
+		refreshed += amount
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not refresh proofs from mint '%v': %v", mintURL, err))
+		}
+	}
+	return refreshed, errors.Join(errs...)
+}
+
+// refreshProofs swaps the proofs in the wallet for new ones
+// and replaces them in the db with the new proofs
+func (w *Wallet) refreshProofs(proofs cashu.Proofs, mint *walletMint) (cashu.Proofs, error) {
+	if uint64(feesForProofs(proofs, mint)) >= proofs.Amount() {
+		return nil, ErrRefreshFees
+	}
+
+	req, err := w.createSwapRequest(proofs, mint)
+	if err != nil {
+		return nil, fmt.Errorf("could not create swap request: %v", err)
+	}
+	operation, err := w.beginOperation(storage.Operation{
+		Kind:       storage.SwapOperation,
+		Mint:       mint.mintURL,
+		Inputs:     req.inputs,
+		Outputs:    req.outputs,
+		Secrets:    req.secrets,
+		KeysetId:   req.keyset.Id,
+		CounterEnd: w.counterForKeyset(req.keyset.Id) + uint32(len(req.outputs)),
+	}, req.rs)
+	if err != nil {
+		return nil, err
+	}
+
+	newProofs, err := w.swap(mint.mintURL, req)
+	if err != nil {
+		w.abortOperation(operation, err)
+		return nil, fmt.Errorf("could not swap proofs: %v", err)
+	}
+
+	for _, proof := range proofs {
+		w.db.DeleteProof(proof.Secret)
+	}
+	if err := w.db.IncrementKeysetCounter(req.keyset.Id, uint32(len(req.outputs))); err != nil {
+		return nil, fmt.Errorf("error incrementing keyset counter: %v", err)
+	}
+	if err := w.db.SaveProofs(newProofs); err != nil {
+		return nil, fmt.Errorf("error storing proofs: %v", err)
+	}
+	if err := w.completeOperation(operation); err != nil {
+		return nil, err
+	}
+	return newProofs, nil
+}
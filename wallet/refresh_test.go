@@ -0,0 +1,43 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestRefreshProofs(t *testing.T) {
+	mintURL := "http://127.0.0.1:1"
+	keyset := crypto.WalletKeyset{Id: "009a1f293253e41e", MintURL: mintURL, InputFeePpk: 1000}
+	db := storage.NewMemoryDB()
+	w := &Wallet{
+		db:    db,
+		unit:  cashu.Sat,
+		mints: map[string]walletMint{mintURL: {mintURL: mintURL, activeKeyset: keyset}},
+	}
+
+	if _, err := w.RefreshProofs("http://unknown.mint"); !errors.Is(err, ErrMintNotExist) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintNotExist, err)
+	}
+
+	// proofs are not swapped if the fees take all their amount
+	proofs := cashu.Proofs{
+		{Amount: 1, Id: keyset.Id, Secret: "secret1", C: "02aa"},
+		{Amount: 1, Id: keyset.Id, Secret: "secret2", C: "02aa"},
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatal(err)
+	}
+	mint := w.mints[mintURL]
+	if _, err := w.refreshProofs(proofs, &mint); !errors.Is(err, ErrRefreshFees) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrRefreshFees, err)
+	}
+	if len(db.GetProofs()) != 2 || len(db.GetOperations()) != 0 {
+		t.Fatal("expected proofs to be kept and no operation in journal")
+	}
+}
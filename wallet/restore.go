@@ -4,42 +4,57 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
-	"path/filepath"
+	"slices"
 
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut07"
 	"github.com/elnosh/gonuts/cashu/nuts/nut09"
 	"github.com/elnosh/gonuts/cashu/nuts/nut13"
 	"github.com/elnosh/gonuts/crypto"
 	"github.com/elnosh/gonuts/wallet/client"
+	"github.com/elnosh/gonuts/wallet/storage"
 	"github.com/tyler-smith/go-bip39"
 )
 
-func Restore(walletPath, mnemonic string, mintsToRestore []string) (uint64, error) {
-	// check if wallet db already exists, if there is one, throw error.
-	dbpath := filepath.Join(walletPath, "wallet.db")
-	_, err := os.Stat(dbpath)
-	if err == nil {
-		return 0, errors.New("wallet already exists")
-	}
+// RestoreConfig are the settings to restore a wallet from its mnemonic
+type RestoreConfig struct {
+	// mints to restore from. All their keysets, active and inactive, are
+	// scanned. The mints of a restore that is resumed are added to them.
+	Mints []string
+	// outputs per restore request and consecutive batches without signatures
+	// after which the scan of a keyset stops. nut13.DefaultBatchSize and
+	// nut13.DefaultGapLimit if not set
+	BatchSize int
+	GapLimit  int
+	// OnProgress is called after each batch scanned of a keyset and
+	// when the scan of the keyset is done. Optional.
+	OnProgress func(progress storage.RestoreProgress)
+}
 
-	if err := os.MkdirAll(walletPath, 0700); err != nil {
-		return 0, err
-	}
+// RestoreToDB restores the wallet from the mnemonic into the db, which
+// has to be empty. It returns the amount of the proofs restored.
+func RestoreToDB(db storage.WalletDB, mnemonic string, mintsToRestore []string) (uint64, error) {
+	return RestoreToDBWithConfig(db, mnemonic, RestoreConfig{Mints: mintsToRestore})
+}
 
-	// check mnemonic is valid
+// RestoreToDBWithConfig restores the wallet from the mnemonic into the db.
+// The progress of each keyset is saved in the db so that if the restore is
+// interrupted, calling it again with the same mnemonic resumes it. The db
+// has to be empty otherwise. Keysets of all the units supported by the wallet
+// are restored. It returns the amount in sats of the proofs restored.
+func RestoreToDBWithConfig(db storage.WalletDB, mnemonic string, config RestoreConfig) (uint64, error) {
 	if !bip39.IsMnemonicValid(mnemonic) {
 		return 0, errors.New("invalid mnemonic")
 	}
-
-	// create wallet db
-	db, err := InitStorage(walletPath)
-	if err != nil {
-		return 0, fmt.Errorf("error restoring wallet: %v", err)
+	savedProgress := db.GetRestoreProgress()
+	if len(db.GetSeed()) > 0 {
+		resuming := db.GetMnemonic() == mnemonic && slices.ContainsFunc(savedProgress,
+			func(progress storage.RestoreProgress) bool { return !progress.Done })
+		if !resuming {
+			return 0, errors.New("wallet already exists")
+		}
 	}
 
 	seed := bip39.NewSeed(mnemonic, "")
@@ -48,164 +63,220 @@ func Restore(walletPath, mnemonic string, mintsToRestore []string) (uint64, erro
 	if err != nil {
 		return 0, err
 	}
-	db.SaveMnemonicSeed(mnemonic, seed)
 
-	proofsRestored := cashu.Proofs{}
+	progress := make(map[string]storage.RestoreProgress, len(savedProgress))
+	mints := slices.Clone(config.Mints)
+	for _, keysetProgress := range savedProgress {
+		progress[keysetProgress.KeysetId] = keysetProgress
+		if !slices.Contains(mints, keysetProgress.Mint) {
+			mints = append(mints, keysetProgress.Mint)
+		}
+	}
 
-	// for each mint get the keysets and do restore process for each keyset
-	for _, mint := range mintsToRestore {
-		mintInfo, err := client.GetMintInfo(mint)
+	// get the keysets of each mint and save the progress of the new ones
+	// before the seed so that a restore interrupted from here is resumed
+	var keysets []crypto.WalletKeyset
+	for _, mint := range mints {
+		mintKeysets, err := restoreKeysets(mint)
 		if err != nil {
-			return 0, fmt.Errorf("error getting info from mint: %v", err)
+			return 0, err
+		}
+		for _, keyset := range mintKeysets {
+			if _, ok := progress[keyset.Id]; !ok {
+				keysetProgress := storage.RestoreProgress{KeysetId: keyset.Id, Mint: mint}
+				if err := db.SaveRestoreProgress(keysetProgress); err != nil {
+					return 0, err
+				}
+				progress[keyset.Id] = keysetProgress
+			}
+		}
+		keysets = append(keysets, mintKeysets...)
+	}
+	if len(db.GetSeed()) == 0 {
+		db.SaveMnemonicSeed(mnemonic, seed)
+	}
+
+	var amountRestored uint64
+	for _, keyset := range keysets {
+		keysetProgress := progress[keyset.Id]
+		if !keysetProgress.Done {
+			keysetProgress, err = restoreKeyset(db, masterKey, keyset, keysetProgress, config)
+			if err != nil {
+				return 0, err
+			}
 		}
+		// amounts of other units can't be added to the amount in sats
+		if keyset.Unit == cashu.Sat.String() {
+			amountRestored += keysetProgress.Restored
+		}
+	}
+
+	return amountRestored, nil
+}
+
+// restoreKeysets returns the keysets, active and inactive, of the mint in the
+// units supported by the wallet. It is empty if the mint does not support restoring.
+func restoreKeysets(mint string) ([]crypto.WalletKeyset, error) {
+	mintInfo, err := client.GetMintInfo(mint)
+	if err != nil {
+		return nil, fmt.Errorf("error getting info from mint: %v", err)
+	}
+
+	nut7, ok := mintInfo.Nuts[7].(map[string]interface{})
+	nut9, ok2 := mintInfo.Nuts[9].(map[string]interface{})
+	if !ok || !ok2 || nut7["supported"] != true || nut9["supported"] != true {
+		fmt.Println("mint does not support the necessary operations to restore wallet")
+		return nil, nil
+	}
+
+	// call to get mint keysets
+	keysetsResponse, err := client.GetAllKeysets(mint)
+	if err != nil {
+		return nil, err
+	}
 
-		nut7, ok := mintInfo.Nuts[7].(map[string]interface{})
-		nut9, ok2 := mintInfo.Nuts[9].(map[string]interface{})
-		if !ok || !ok2 || nut7["supported"] != true || nut9["supported"] != true {
-			fmt.Println("mint does not support the necessary operations to restore wallet")
+	var keysets []crypto.WalletKeyset
+	for _, keyset := range keysetsResponse.Keysets {
+		if _, err := cashu.UnitFromString(keyset.Unit); err != nil {
 			continue
 		}
 
-		// call to get mint keysets
-		keysetsResponse, err := client.GetAllKeysets(mint)
+		_, err := hex.DecodeString(keyset.Id)
+		// ignore keysets with non-hex ids
 		if err != nil {
-			return 0, err
+			continue
 		}
 
-		for _, keyset := range keysetsResponse.Keysets {
-			if keyset.Unit != cashu.Sat.String() {
-				break
-			}
+		keysetKeys, err := GetKeysetKeys(mint, keyset.Id)
+		if err != nil {
+			return nil, err
+		}
 
-			_, err := hex.DecodeString(keyset.Id)
-			// ignore keysets with non-hex ids
-			if err != nil {
-				continue
-			}
+		keysets = append(keysets, crypto.WalletKeyset{
+			Id:          keyset.Id,
+			MintURL:     mint,
+			Unit:        keyset.Unit,
+			Active:      keyset.Active,
+			PublicKeys:  keysetKeys,
+			InputFeePpk: keyset.InputFeePpk,
+		})
+	}
+	return keysets, nil
+}
 
-			var counter uint32 = 0
+// restoreKeyset scans the outputs of the keyset from where its progress got,
+// saves the unspent proofs restored and returns the progress once it is done
+func restoreKeyset(
+	db storage.WalletDB,
+	masterKey *hdkeychain.ExtendedKey,
+	keyset crypto.WalletKeyset,
+	progress storage.RestoreProgress,
+	config RestoreConfig,
+) (storage.RestoreProgress, error) {
+	mint := keyset.MintURL
+	if db.GetKeyset(keyset.Id) == nil {
+		if err := db.SaveKeyset(&keyset); err != nil {
+			return progress, err
+		}
+	}
 
-			keysetKeys, err := GetKeysetKeys(mint, keyset.Id)
-			if err != nil {
-				return 0, err
-			}
+	// check state of the proofs restored in each batch and save the unspent ones
+	saveUnspent := func(restored []nut13.RestoredProof) error {
+		return saveUnspentProofs(db, mint, restored)
+	}
 
-			walletKeyset := crypto.WalletKeyset{
-				Id:         keyset.Id,
-				MintURL:    mint,
-				Unit:       keyset.Unit,
-				Active:     keyset.Active,
-				PublicKeys: keysetKeys,
-				Counter:    counter,
-			}
+	restore := func(outputs cashu.BlindedMessages) (cashu.BlindedMessages, cashu.BlindedSignatures, error) {
+		restoreRequest := nut09.PostRestoreRequest{Outputs: outputs}
+		restoreResponse, err := client.PostRestore(mint, restoreRequest)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error restoring signatures from mint '%v': %v", mint, err)
+		}
+		return restoreResponse.Outputs, restoreResponse.Signatures, nil
+	}
 
-			if err := db.SaveKeyset(&walletKeyset); err != nil {
-				return 0, err
-			}
+	// the amount restored is taken from the proofs saved so that
+	// batches scanned again after resuming are not counted twice
+	saveProgress := func() error {
+		progress.Restored = db.GetProofsByKeysetId(keyset.Id).Amount()
+		if err := db.SaveRestoreProgress(progress); err != nil {
+			return err
+		}
+		if config.OnProgress != nil {
+			config.OnProgress(progress)
+		}
+		return nil
+	}
 
-			keysetDerivationPath, err := nut13.DeriveKeysetPath(masterKey, keyset.Id)
-			if err != nil {
-				return 0, err
-			}
+	scanConfig := nut13.ScanConfig{
+		BatchSize: config.BatchSize,
+		GapLimit:  config.GapLimit,
+		OnBatch:   saveUnspent,
+		OnProgress: func(scanProgress nut13.ScanProgress) error {
+			progress.Counter = scanProgress.Counter
+			progress.EmptyBatches = scanProgress.EmptyBatches
+			progress.NextCounter = scanProgress.NextCounter
+			return saveProgress()
+		},
+	}
+	if progress.Counter > 0 {
+		scanConfig.Resume = &nut13.ScanProgress{
+			Counter:      progress.Counter,
+			EmptyBatches: progress.EmptyBatches,
+			NextCounter:  progress.NextCounter,
+		}
+	}
 
-			// stop when it reaches 3 consecutive empty batches
-			emptyBatches := 0
-			for emptyBatches < 3 {
-				blindedMessages := make(cashu.BlindedMessages, 100)
-				rs := make([]*secp256k1.PrivateKey, 100)
-				secrets := make([]string, 100)
-
-				// create batch of 100 blinded messages
-				for i := 0; i < 100; i++ {
-					secret, r, err := generateDeterministicSecret(keysetDerivationPath, counter)
-					if err != nil {
-						return 0, err
-					}
-					B_, r, err := crypto.BlindMessage(secret, r)
-					if err != nil {
-						return 0, err
-					}
-
-					B_str := hex.EncodeToString(B_.SerializeCompressed())
-					blindedMessages[i] = cashu.BlindedMessage{B_: B_str, Id: keyset.Id}
-					rs[i] = r
-					secrets[i] = secret
-					counter++
-				}
+	scanResult, err := nut13.Scan(masterKey, keyset.Id, keyset.PublicKeys, restore, scanConfig)
+	if err != nil {
+		return progress, err
+	}
 
-				// if response has signatures, unblind them and check proof states
-				restoreRequest := nut09.PostRestoreRequest{Outputs: blindedMessages}
-				restoreResponse, err := client.PostRestore(mint, restoreRequest)
-				if err != nil {
-					return 0, fmt.Errorf("error restoring signatures from mint '%v': %v", mint, err)
-				}
+	// move the counter of the keyset past the outputs restored
+	if counter := db.GetKeysetCounter(keyset.Id); scanResult.NextCounter > counter {
+		if err := db.IncrementKeysetCounter(keyset.Id, scanResult.NextCounter-counter); err != nil {
+			return progress, fmt.Errorf("error incrementing keyset counter: %v", err)
+		}
+	}
 
-				if len(restoreResponse.Signatures) == 0 {
-					emptyBatches++
-					break
-				}
+	progress.Done = true
+	return progress, saveProgress()
+}
 
-				Ys := make([]string, len(restoreResponse.Signatures))
-				proofs := make(map[string]cashu.Proof, len(restoreResponse.Signatures))
-
-				// unblind signatures
-				for i, signature := range restoreResponse.Signatures {
-					pubkey, ok := keysetKeys[signature.Amount]
-					if !ok {
-						return 0, errors.New("key not found")
-					}
-
-					C, err := unblindSignature(signature.C_, rs[i], pubkey)
-					if err != nil {
-						return 0, err
-					}
-
-					Y, err := crypto.HashToCurve([]byte(secrets[i]))
-					if err != nil {
-						return 0, err
-					}
-					Yhex := hex.EncodeToString(Y.SerializeCompressed())
-					Ys[i] = Yhex
-
-					proof := cashu.Proof{
-						Amount: signature.Amount,
-						Secret: secrets[i],
-						C:      C,
-						Id:     signature.Id,
-					}
-					proofs[Yhex] = proof
-				}
+// saveUnspentProofs checks the state of the proofs restored
+// from the mint and saves the ones that are unspent
+func saveUnspentProofs(db storage.WalletDB, mint string, restored []nut13.RestoredProof) error {
+	Ys := make([]string, len(restored))
+	proofs := make(map[string]cashu.Proof, len(restored))
+	for i, restoredProof := range restored {
+		Y, err := crypto.HashToCurve([]byte(restoredProof.Proof.Secret))
+		if err != nil {
+			return err
+		}
+		Yhex := hex.EncodeToString(Y.SerializeCompressed())
+		Ys[i] = Yhex
+		proofs[Yhex] = restoredProof.Proof
+	}
 
-				proofStateRequest := nut07.PostCheckStateRequest{Ys: Ys}
-				proofStateResponse, err := client.PostCheckProofState(mint, proofStateRequest)
-				if err != nil {
-					return 0, err
-				}
+	proofStateRequest := nut07.PostCheckStateRequest{Ys: Ys}
+	proofStateResponse, err := client.PostCheckProofState(mint, proofStateRequest)
+	if err != nil {
+		return err
+	}
 
-				for _, proofState := range proofStateResponse.States {
-					// NUT-07 can also respond with witness data. Since not supporting this yet, ignore proofs that have witness
-					if len(proofState.Witness) > 0 {
-						break
-					}
-
-					// save unspent proofs
-					if proofState.State == nut07.Unspent {
-						proof := proofs[proofState.Y]
-						proofsRestored = append(proofsRestored, proof)
-					}
-				}
-				if err := db.SaveProofs(proofsRestored); err != nil {
-					return 0, fmt.Errorf("error saving restored proofs: %v", err)
-				}
+	var unspentProofs cashu.Proofs
+	for _, proofState := range proofStateResponse.States {
+		// NUT-07 can also respond with witness data. Since not supporting this yet, ignore proofs that have witness
+		if len(proofState.Witness) > 0 {
+			break
+		}
 
-				// save wallet keyset with latest counter moving forward for wallet
-				if err := db.IncrementKeysetCounter(keyset.Id, counter); err != nil {
-					return 0, fmt.Errorf("error incrementing keyset counter: %v", err)
-				}
-				emptyBatches = 0
-			}
+		// save unspent proofs
+		if proofState.State == nut07.Unspent {
+			unspentProofs = append(unspentProofs, proofs[proofState.Y])
 		}
 	}
-
-	return proofsRestored.Amount(), nil
+	if err := db.SaveProofs(unspentProofs); err != nil {
+		return fmt.Errorf("error saving restored proofs: %v", err)
+	}
+	return nil
 }
@@ -0,0 +1,121 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut01"
+	"github.com/elnosh/gonuts/cashu/nuts/nut02"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut09"
+	"github.com/elnosh/gonuts/cashu/nuts/nut13"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+	"github.com/tyler-smith/go-bip39"
+)
+
+func TestRestoreUnits(t *testing.T) {
+	entropy, _ := bip39.NewEntropy(128)
+	mnemonic, _ := bip39.NewMnemonic(entropy)
+	walletMaster, _ := hdkeychain.NewMaster(bip39.NewSeed(mnemonic, ""), &chaincfg.MainNetParams)
+
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	satKeyset, _ := newTestKeyset(t, master, cashu.Sat, 0)
+	usdKeyset, _ := newTestKeyset(t, master, cashu.Usd, 0)
+	keysets := map[string]*crypto.MintKeyset{satKeyset.Id: satKeyset, usdKeyset.Id: usdKeyset}
+
+	// the wallet used the first 8 counters of the sat
+	// keyset and the first 4 counters of the usd keyset
+	signed := make(map[string]*crypto.MintKeyset)
+	for keyset, counters := range map[*crypto.MintKeyset]int{satKeyset: 8, usdKeyset: 4} {
+		keysetPath, err := nut13.DeriveKeysetPath(walletMaster, keyset.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs, err := nut13.DeriveOutputs(keysetPath, keyset.Id, 0, counters)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, output := range outputs {
+			signed[output.Output.B_] = keyset
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/info":
+			w.Write([]byte(`{"nuts": {"7": {"supported": true}, "9": {"supported": true}}}`))
+		case "/v1/keysets":
+			json.NewEncoder(w).Encode(nut02.GetKeysetsResponse{Keysets: []nut02.Keyset{
+				{Id: satKeyset.Id, Unit: satKeyset.Unit, Active: true},
+				{Id: usdKeyset.Id, Unit: usdKeyset.Unit, Active: true},
+				{Id: "00ffffffffffffff", Unit: "btc", Active: true},
+			}})
+		case "/v1/keys/" + satKeyset.Id, "/v1/keys/" + usdKeyset.Id:
+			keyset := keysets[r.URL.Path[len("/v1/keys/"):]]
+			json.NewEncoder(w).Encode(nut01.GetKeysResponse{Keysets: []nut01.Keyset{
+				{Id: keyset.Id, Unit: keyset.Unit, Keys: keyset.DerivePublic()},
+			}})
+		case "/v1/restore":
+			var req nut09.PostRestoreRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			var res nut09.PostRestoreResponse
+			for _, output := range req.Outputs {
+				keyset, ok := signed[output.B_]
+				if !ok || keyset.Id != output.Id {
+					continue
+				}
+				B_bytes, _ := hex.DecodeString(output.B_)
+				B_, _ := secp256k1.ParsePubKey(B_bytes)
+				C_ := crypto.SignBlindedMessage(B_, keyset.Keys[1].PrivateKey)
+				res.Outputs = append(res.Outputs, output)
+				res.Signatures = append(res.Signatures, cashu.BlindedSignature{
+					Amount: 1,
+					Id:     keyset.Id,
+					C_:     hex.EncodeToString(C_.SerializeCompressed()),
+				})
+			}
+			json.NewEncoder(w).Encode(&res)
+		case "/v1/checkstate":
+			var req nut07.PostCheckStateRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			var res nut07.PostCheckStateResponse
+			for _, Y := range req.Ys {
+				res.States = append(res.States, nut07.ProofState{Y: Y, State: nut07.Unspent})
+			}
+			json.NewEncoder(w).Encode(&res)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	db := storage.NewMemoryDB()
+	amountRestored, err := RestoreToDB(db, mnemonic, []string{server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error restoring wallet: %v", err)
+	}
+	// only the amount in sats is returned
+	if amountRestored != 8 {
+		t.Fatalf("expected 8 sats restored but got %v", amountRestored)
+	}
+	if amount := db.GetProofsByKeysetId(usdKeyset.Id).Amount(); amount != 4 {
+		t.Fatalf("expected 4 usd restored but got %v", amount)
+	}
+	if db.GetKeyset("00ffffffffffffff") != nil {
+		t.Fatal("expected keyset of unit not supported to not be restored")
+	}
+	if counter := db.GetKeysetCounter(usdKeyset.Id); counter != 4 {
+		t.Fatalf("expected counter of usd keyset at 4 but got %v", counter)
+	}
+}
@@ -0,0 +1,268 @@
+package wallet
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut06"
+	"github.com/elnosh/gonuts/wallet/client"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// mintRetirementCheckInterval is how often Watch checks
+// the info of the trusted mints to see if they are retiring
+const mintRetirementCheckInterval = time.Hour
+
+var (
+	ErrMintNotTrusted = errors.New("mint is not trusted")
+	// not all the balance could be moved out of the mint. The
+	// EvacuationResult has what was moved and what is left.
+	ErrEvacuationIncomplete = errors.New("could not move all the balance out of the mint")
+
+	// the proofs of a batch might have been spent but nothing was minted yet
+	errEvacuationPending = errors.New("payment to the other mint is pending")
+)
+
+// retirementMotdWords are words in the motd of a mint announcing that it is closing
+var retirementMotdWords = []string{
+	"winding down", "wind down", "retiring", "retired", "shutting down", "shut down",
+	"closing", "sunset", "discontinued", "deprecated", "move your funds",
+}
+
+// MintRetirement is what the info of a mint says about whether it is retiring.
+type MintRetirement struct {
+	Mint string
+	// the mint advertises minting (NUT-04) as disabled. It could
+	// also be temporary (i.e the mint reached its max balance)
+	MintingDisabled bool
+	Motd            string
+	// the motd announces that the mint is closing
+	RetirementMotd bool
+}
+
+// Retiring reports whether the mint is winding down and
+// the balance in it should be moved to another mint.
+func (r MintRetirement) Retiring() bool {
+	return r.MintingDisabled || r.RetirementMotd
+}
+
+// CheckMintRetirement gets the info of the mint to see if it has disabled
+// minting or posted a motd announcing that it is closing.
+func (w *Wallet) CheckMintRetirement(mint string) (MintRetirement, error) {
+	info, err := client.GetMintInfo(mint)
+	if err != nil {
+		return MintRetirement{}, fmt.Errorf("error getting info from mint: %v", err)
+	}
+
+	retirement := MintRetirement{Mint: mint, Motd: info.Motd}
+	// nuts in the info are decoded without a type
+	if setting, ok := info.Nuts[4]; ok {
+		var nut04 nut06.NutSetting
+		if jsonSetting, err := json.Marshal(setting); err == nil && json.Unmarshal(jsonSetting, &nut04) == nil {
+			retirement.MintingDisabled = nut04.Disabled
+		}
+	}
+	motd := strings.ToLower(info.Motd)
+	for _, word := range retirementMotdWords {
+		if strings.Contains(motd, word) {
+			retirement.RetirementMotd = true
+			break
+		}
+	}
+	return retirement, nil
+}
+
+// EvacuationResult is what was moved out of a mint by EvacuateMint.
+type EvacuationResult struct {
+	// amount minted in the mint the balance was moved to
+	Moved uint64
+	// input and lightning fees paid to move it
+	Fees uint64
+	// amount of payments to the other mint that are still pending. It
+	// can be minted with the mint quote once the payment settles
+	Pending uint64
+	// balance left in the mint
+	Remaining uint64
+}
+
+// EvacuateMint moves the whole balance in the 'from' mint to the trusted 'to' mint
+// by melting it to pay mint quotes of the 'to' mint, i.e when the 'from' mint is
+// retiring. The fees are taken from the balance. If the mints reject moving the
+// balance at once (i.e over their limits), it is moved in smaller batches. Batches
+// that fail are left in the mint and ErrEvacuationIncomplete is returned with
+// the result of the batches that were moved.
+func (w *Wallet) EvacuateMint(from, to string) (EvacuationResult, error) {
+	fromMint, fromOk := w.mints[from]
+	toMint, toOk := w.mints[to]
+	if !fromOk || !toOk {
+		return EvacuationResult{}, ErrMintNotExist
+	}
+	if from == to {
+		return EvacuationResult{}, errors.New("cannot move balance to the same mint")
+	}
+	if toMint.trustLevel != storage.Trusted {
+		return EvacuationResult{}, ErrMintNotTrusted
+	}
+
+	var result EvacuationResult
+	proofs := w.getProofsFromMint(from)
+	if len(proofs) == 0 {
+		return result, nil
+	}
+	w.logInfof("moving balance of %v from mint '%v' to '%v'", proofs.Amount(), from, to)
+
+	var lastErr error
+	batches := []cashu.Proofs{proofs}
+	for len(batches) > 0 {
+		batch := batches[0]
+		batches = batches[1:]
+
+		moved, err := w.evacuateBatch(batch, &fromMint, &toMint)
+		switch {
+		case err == nil:
+			result.Moved += moved
+			result.Fees += batch.Amount() - min(batch.Amount(), moved)
+			w.recordTransaction(storage.TransferOutTransaction, from, moved, batch.Amount()-min(batch.Amount(), moved), to)
+			w.recordTransaction(storage.TransferInTransaction, to, moved, 0, from)
+		case errors.Is(err, errEvacuationPending):
+			w.logErrorf("payment of batch of %v from mint '%v' to '%v' is pending: %v", batch.Amount(), from, to, err)
+			result.Pending += batch.Amount()
+			lastErr = err
+		case len(batch) > 1:
+			// proofs are still in the wallet so try with smaller batches
+			w.logDebugf("could not move batch of %v from mint '%v': %v. Splitting it", batch.Amount(), from, err)
+			first, second := splitBatch(batch)
+			batches = append(batches, first, second)
+		default:
+			w.logErrorf("could not move proof of %v from mint '%v' to '%v': %v", batch.Amount(), from, to, err)
+			lastErr = err
+		}
+	}
+
+	result.Remaining = w.GetBalanceByMints()[from]
+	w.logInfof("moved %v from mint '%v' to '%v' with fees of %v. Pending: %v. Remaining: %v",
+		result.Moved, from, to, result.Fees, result.Pending, result.Remaining)
+	if lastErr != nil {
+		return result, fmt.Errorf("%w: %v", ErrEvacuationIncomplete, lastErr)
+	}
+	return result, nil
+}
+
+// splitBatch splits the proofs in two batches with similar amounts
+func splitBatch(proofs cashu.Proofs) (cashu.Proofs, cashu.Proofs) {
+	sorted := slices.Clone(proofs)
+	slices.SortFunc(sorted, func(a, b cashu.Proof) int {
+		return cmp.Compare(b.Amount, a.Amount)
+	})
+
+	var first, second cashu.Proofs
+	var firstAmount, secondAmount uint64
+	for _, proof := range sorted {
+		if firstAmount <= secondAmount {
+			first = append(first, proof)
+			firstAmount += proof.Amount
+		} else {
+			second = append(second, proof)
+			secondAmount += proof.Amount
+		}
+	}
+	return first, second
+}
+
+// evacuateBatch melts the proofs in the 'from' mint to pay a mint quote of the 'to'
+// mint and mints the proofs for it. If the mint rejects the melt, the proofs are
+// kept in the wallet. If the melt is pending or the outcome is not known, the proofs
+// are kept as pending for the melt quote and errEvacuationPending is returned.
+func (w *Wallet) evacuateBatch(proofs cashu.Proofs, from, to *walletMint) (uint64, error) {
+	quotes, err := w.mintSwapQuotes(proofs, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	// melt quote is saved so a pending payment can be followed with its state
+	meltQuote := storage.MeltQuote{
+		QuoteId:        quotes.meltQuote.Quote,
+		Mint:           from.mintURL,
+		Method:         cashu.BOLT11_METHOD,
+		Unit:           w.unit.String(),
+		State:          quotes.meltQuote.State,
+		PaymentRequest: quotes.mintQuote.Request,
+		Amount:         quotes.meltQuote.Amount,
+		FeeReserve:     quotes.meltQuote.FeeReserve,
+		CreatedAt:      time.Now().Unix(),
+		QuoteExpiry:    quotes.meltQuote.Expiry,
+	}
+	if err := w.db.SaveMeltQuote(meltQuote); err != nil {
+		return 0, fmt.Errorf("error saving melt quote: %v", err)
+	}
+	for _, proof := range proofs {
+		if err := w.db.DeleteProof(proof.Secret); err != nil {
+			return 0, fmt.Errorf("error removing proof: %v", err)
+		}
+	}
+	if err := w.db.AddPendingProofsByQuoteId(proofs, meltQuote.QuoteId); err != nil {
+		return 0, fmt.Errorf("error saving pending proofs: %v", err)
+	}
+	restoreProofs := func() error {
+		if err := w.db.SaveProofs(proofs); err != nil {
+			return fmt.Errorf("error storing proofs: %v", err)
+		}
+		if err := w.db.DeletePendingProofsByQuoteId(meltQuote.QuoteId); err != nil {
+			return fmt.Errorf("error removing pending proofs: %v", err)
+		}
+		return nil
+	}
+
+	meltRequest := nut05.PostMeltBolt11Request{Quote: meltQuote.QuoteId, Inputs: proofs}
+	meltResponse, err := client.PostMeltBolt11(from.mintURL, meltRequest)
+	if err != nil {
+		// if the mint rejected the melt the proofs were not spent.
+		// Otherwise the melt might have happened
+		var cashuErr cashu.Error
+		if errors.As(err, &cashuErr) {
+			if err := restoreProofs(); err != nil {
+				return 0, err
+			}
+			return 0, fmt.Errorf("error melting proofs: %w", err)
+		}
+		return 0, fmt.Errorf("%w: %v", errEvacuationPending, err)
+	}
+
+	switch meltResponse.State {
+	case nut05.Paid:
+		if err := w.db.DeletePendingProofsByQuoteId(meltQuote.QuoteId); err != nil {
+			return 0, fmt.Errorf("error removing pending proofs: %v", err)
+		}
+		meltQuote.State = nut05.Paid
+		meltQuote.Preimage = meltResponse.Preimage
+		meltQuote.SettledAt = time.Now().Unix()
+		if err := w.db.SaveMeltQuote(meltQuote); err != nil {
+			return 0, fmt.Errorf("error updating melt quote: %v", err)
+		}
+
+		mintedProofs, err := w.mintTokens(quotes.mintQuote.Quote)
+		if err != nil {
+			// invoice was paid so it can be minted later with the quote
+			return 0, fmt.Errorf("%w: error minting quote '%v': %v", errEvacuationPending, quotes.mintQuote.Quote, err)
+		}
+		return mintedProofs.Amount(), nil
+	case nut05.Pending:
+		meltQuote.State = nut05.Pending
+		if err := w.db.SaveMeltQuote(meltQuote); err != nil {
+			return 0, fmt.Errorf("error updating melt quote: %v", err)
+		}
+		return 0, fmt.Errorf("%w: melt quote '%v'", errEvacuationPending, meltQuote.QuoteId)
+	default:
+		if err := restoreProofs(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("mint could not pay lightning invoice")
+	}
+}
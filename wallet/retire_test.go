@@ -0,0 +1,236 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut06"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/lightning"
+	"github.com/elnosh/gonuts/wallet/storage"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
+)
+
+func TestCheckMintRetirement(t *testing.T) {
+	var info atomic.Value
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/info", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(info.Load())
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	w := &Wallet{db: storage.NewMemoryDB(), unit: cashu.Sat}
+	tests := []struct {
+		info     nut06.MintInfo
+		expected MintRetirement
+	}{
+		{
+			info: nut06.MintInfo{Motd: "new release", Nuts: nut06.NutsMap{
+				4: nut06.NutSetting{Disabled: false},
+			}},
+			expected: MintRetirement{Mint: server.URL, Motd: "new release"},
+		},
+		{
+			info: nut06.MintInfo{Nuts: nut06.NutsMap{
+				4: nut06.NutSetting{Disabled: true},
+			}},
+			expected: MintRetirement{Mint: server.URL, MintingDisabled: true},
+		},
+		{
+			info:     nut06.MintInfo{Motd: "This mint is Shutting Down on March 1st", Nuts: nut06.NutsMap{}},
+			expected: MintRetirement{Mint: server.URL, Motd: "This mint is Shutting Down on March 1st", RetirementMotd: true},
+		},
+	}
+
+	for _, test := range tests {
+		info.Store(test.info)
+		retirement, err := w.CheckMintRetirement(server.URL)
+		if err != nil {
+			t.Fatalf("unexpected error checking mint: %v", err)
+		}
+		if retirement != test.expected {
+			t.Fatalf("expected '%+v' but got '%+v'", test.expected, retirement)
+		}
+		if retirement.Retiring() != (test.expected.MintingDisabled || test.expected.RetirementMotd) {
+			t.Fatalf("unexpected retiring status for '%+v'", retirement)
+		}
+	}
+}
+
+func TestWatchMintRetiring(t *testing.T) {
+	motd := "This mint is winding down. Please move your funds"
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/info", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(nut06.MintInfo{Motd: motd, Nuts: nut06.NutsMap{
+			4: nut06.NutSetting{Disabled: true},
+		}})
+	})
+	retiringServer := httptest.NewServer(mux)
+	defer retiringServer.Close()
+	// mint added automatically is not checked
+	autoAddedServer := httptest.NewServer(mux)
+	defer autoAddedServer.Close()
+
+	w := &Wallet{
+		db:   storage.NewMemoryDB(),
+		unit: cashu.Sat,
+		mints: map[string]walletMint{
+			retiringServer.URL:  {mintURL: retiringServer.URL, trustLevel: storage.Trusted},
+			autoAddedServer.URL: {mintURL: autoAddedServer.URL, trustLevel: storage.AutoAdded},
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan Event, 10)
+	done := make(chan error)
+	go func() {
+		done <- w.Watch(ctx, 10*time.Millisecond, func(event Event) { events <- event })
+	}()
+
+	select {
+	case event := <-events:
+		expected := Event{Kind: MintRetiring, Mint: retiringServer.URL, Motd: motd}
+		if event != expected {
+			t.Fatalf("expected event '%+v' but got '%+v'", expected, event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("did not get event for retiring mint")
+	}
+
+	// notified only once
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event '%+v'", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error from watch: %v", err)
+	}
+}
+
+func TestSplitBatch(t *testing.T) {
+	proofs := cashu.Proofs{{Amount: 4}, {Amount: 32}, {Amount: 8}, {Amount: 16}, {Amount: 2}}
+	first, second := splitBatch(proofs)
+	if len(first)+len(second) != len(proofs) {
+		t.Fatalf("expected %v proofs in batches but got %v", len(proofs), len(first)+len(second))
+	}
+	if first.Amount() != 32 || second.Amount() != 30 {
+		t.Fatalf("expected batches of 32 and 30 but got %v and %v", first.Amount(), second.Amount())
+	}
+}
+
+func TestEvacuateMint(t *testing.T) {
+	// 'to' mint gives quotes with invoices for the amount
+	toMux := http.NewServeMux()
+	toMux.HandleFunc("POST /v1/mint/quote/bolt11", func(w http.ResponseWriter, r *http.Request) {
+		var request nut04.PostMintQuoteBolt11Request
+		json.NewDecoder(r.Body).Decode(&request)
+		invoice, _, _, _ := lightning.CreateFakeInvoice(request.Amount, false)
+		json.NewEncoder(w).Encode(&nut04.PostMintQuoteBolt11Response{
+			Quote: "mintquote" + invoice[len(invoice)-8:], Request: invoice, State: nut04.Unpaid,
+		})
+	})
+	toServer := httptest.NewServer(toMux)
+	defer toServer.Close()
+
+	// 'from' mint rejects melts over 30 and leaves the rest pending
+	var quotes atomic.Int32
+	fromMux := http.NewServeMux()
+	fromMux.HandleFunc("POST /v1/melt/quote/bolt11", func(w http.ResponseWriter, r *http.Request) {
+		var request nut05.PostMeltQuoteBolt11Request
+		json.NewDecoder(r.Body).Decode(&request)
+		bolt11, _ := decodepay.Decodepay(request.Request)
+		json.NewEncoder(w).Encode(&nut05.PostMeltQuoteBolt11Response{
+			Quote:  "meltquote" + strconv.Itoa(int(quotes.Add(1))),
+			Amount: uint64(bolt11.MSatoshi / 1000),
+			State:  nut05.Unpaid,
+		})
+	})
+	fromMux.HandleFunc("POST /v1/melt/bolt11", func(w http.ResponseWriter, r *http.Request) {
+		var request nut05.PostMeltBolt11Request
+		json.NewDecoder(r.Body).Decode(&request)
+		if request.Inputs.Amount() > 30 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(cashu.MeltAmountExceededErr)
+			return
+		}
+		json.NewEncoder(w).Encode(&nut05.PostMeltQuoteBolt11Response{Quote: request.Quote, State: nut05.Pending})
+	})
+	fromServer := httptest.NewServer(fromMux)
+	defer fromServer.Close()
+
+	db := storage.NewMemoryDB()
+	fromKeyset := crypto.WalletKeyset{Id: "009a1f293253e41e", MintURL: fromServer.URL}
+	w := &Wallet{
+		db:   db,
+		unit: cashu.Sat,
+		mints: map[string]walletMint{
+			fromServer.URL: {mintURL: fromServer.URL, activeKeyset: fromKeyset},
+			toServer.URL: {
+				mintURL:      toServer.URL,
+				activeKeyset: crypto.WalletKeyset{Id: "00ad268c4d1f5826", MintURL: toServer.URL},
+			},
+		},
+	}
+	if err := db.SaveProofs(cashu.Proofs{
+		{Amount: 32, Id: fromKeyset.Id, Secret: "secret1", C: "C1"},
+		{Amount: 16, Id: fromKeyset.Id, Secret: "secret2", C: "C2"},
+		{Amount: 8, Id: fromKeyset.Id, Secret: "secret3", C: "C3"},
+		{Amount: 4, Id: fromKeyset.Id, Secret: "secret4", C: "C4"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := w.EvacuateMint(fromServer.URL, "http://unknown.mint"); !errors.Is(err, ErrMintNotExist) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintNotExist, err)
+	}
+	if _, err := w.EvacuateMint(fromServer.URL, fromServer.URL); err == nil {
+		t.Fatal("expected error moving balance to the same mint")
+	}
+	toMint := w.mints[toServer.URL]
+	toMint.trustLevel = storage.AutoAdded
+	w.mints[toServer.URL] = toMint
+	if _, err := w.EvacuateMint(fromServer.URL, toServer.URL); !errors.Is(err, ErrMintNotTrusted) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintNotTrusted, err)
+	}
+	toMint.trustLevel = storage.Trusted
+	w.mints[toServer.URL] = toMint
+
+	// whole balance is rejected, then the batch of 32 is rejected
+	// and the batch of 16, 8 and 4 is pending
+	result, err := w.EvacuateMint(fromServer.URL, toServer.URL)
+	if !errors.Is(err, ErrEvacuationIncomplete) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrEvacuationIncomplete, err)
+	}
+	expected := EvacuationResult{Pending: 28, Remaining: 32}
+	if result != expected {
+		t.Fatalf("expected result '%+v' but got '%+v'", expected, result)
+	}
+
+	proofs := db.GetProofs()
+	if len(proofs) != 1 || proofs[0].Amount != 32 {
+		t.Fatalf("expected proof of 32 to be kept in the wallet but got %v", proofs)
+	}
+	pending := db.GetPendingProofs()
+	if len(pending) != 3 {
+		t.Fatalf("expected 3 pending proofs but got %v", len(pending))
+	}
+	meltQuote := db.GetMeltQuoteById(pending[0].MeltQuoteId)
+	if meltQuote == nil || meltQuote.State != nut05.Pending || meltQuote.Amount != 28 {
+		t.Fatalf("expected pending melt quote for 28 but got %+v", meltQuote)
+	}
+}
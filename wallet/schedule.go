@@ -0,0 +1,303 @@
+package wallet
+
+import (
+	"cmp"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/wallet/lnurl"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+const (
+	// DefaultScheduleInterval is how often RunScheduledPayments
+	// checks for payments that are due if not set
+	DefaultScheduleInterval = 30 * time.Second
+
+	// MaxScheduledPaymentAttempts is the number of times a scheduled
+	// payment is tried before it fails
+	MaxScheduledPaymentAttempts = 5
+
+	// delay before retrying a scheduled payment that failed.
+	// It doubles after each attempt.
+	scheduledRetryDelay = time.Minute
+
+	// shortest interval allowed between recurring payments
+	minRecurringInterval = time.Minute
+)
+
+var ErrScheduledPaymentNotFound = errors.New("scheduled payment not found")
+
+// PaymentTarget is how a scheduled payment is made. If it has a lightning
+// address, it is paid with a melt from the mint. Otherwise, the wallet
+// creates a token that is passed in the ScheduledPaymentMade event.
+type PaymentTarget struct {
+	Mint             string
+	LightningAddress string
+	// public key to lock the token to (P2PK). Optional and only for tokens
+	Pubkey *btcec.PublicKey
+}
+
+// SchedulePayment saves a payment of the amount to the target that is made
+// at the time by RunScheduledPayments. It returns the payment saved.
+func (w *Wallet) SchedulePayment(
+	at time.Time,
+	amount uint64,
+	target PaymentTarget,
+) (storage.ScheduledPayment, error) {
+	return w.schedulePayment(at, 0, amount, target)
+}
+
+// ScheduleRecurringPayment saves a payment that is made at the
+// time and then again every interval by RunScheduledPayments.
+func (w *Wallet) ScheduleRecurringPayment(
+	at time.Time,
+	every time.Duration,
+	amount uint64,
+	target PaymentTarget,
+) (storage.ScheduledPayment, error) {
+	if every < minRecurringInterval {
+		return storage.ScheduledPayment{}, fmt.Errorf("interval of recurring payment has to be at least %v", minRecurringInterval)
+	}
+	return w.schedulePayment(at, every, amount, target)
+}
+
+func (w *Wallet) schedulePayment(
+	at time.Time,
+	every time.Duration,
+	amount uint64,
+	target PaymentTarget,
+) (storage.ScheduledPayment, error) {
+	if _, ok := w.mints[target.Mint]; !ok {
+		return storage.ScheduledPayment{}, ErrMintNotExist
+	}
+	if amount == 0 {
+		return storage.ScheduledPayment{}, errors.New("amount of scheduled payment has to be greater than 0")
+	}
+
+	payment := storage.ScheduledPayment{
+		Kind:      storage.ScheduledSend,
+		Mint:      target.Mint,
+		Amount:    amount,
+		At:        at.Unix(),
+		Interval:  int64(every.Seconds()),
+		CreatedAt: time.Now().Unix(),
+	}
+	switch {
+	case len(target.LightningAddress) > 0 && target.Pubkey != nil:
+		return storage.ScheduledPayment{}, errors.New("scheduled payment can't have both a lightning address and a public key")
+	case len(target.LightningAddress) > 0:
+		payment.Kind = storage.ScheduledMelt
+		payment.Target = target.LightningAddress
+	case target.Pubkey != nil:
+		payment.Target = hex.EncodeToString(target.Pubkey.SerializeCompressed())
+	}
+
+	id, err := randomId()
+	if err != nil {
+		return storage.ScheduledPayment{}, err
+	}
+	payment.Id = id
+	if err := w.db.SaveScheduledPayment(payment); err != nil {
+		return storage.ScheduledPayment{}, err
+	}
+	w.logInfof("scheduled %v payment '%v' of %v from mint '%v' at %v",
+		payment.Kind, payment.Id, amount, payment.Mint, at.Format(time.RFC3339))
+
+	return payment, nil
+}
+
+// ScheduledPayments returns the payments that have not been made yet
+// and the recurring payments, sorted by the time they are scheduled for.
+func (w *Wallet) ScheduledPayments() []storage.ScheduledPayment {
+	payments := w.db.GetScheduledPayments()
+	slices.SortStableFunc(payments, func(a, b storage.ScheduledPayment) int {
+		return cmp.Compare(a.At, b.At)
+	})
+	return payments
+}
+
+// CancelScheduledPayment removes the scheduled payment so it is not made.
+func (w *Wallet) CancelScheduledPayment(id string) error {
+	for _, payment := range w.db.GetScheduledPayments() {
+		if payment.Id == id {
+			if err := w.db.DeleteScheduledPayment(id); err != nil {
+				return fmt.Errorf("error removing scheduled payment: %v", err)
+			}
+			w.logInfof("canceled scheduled payment '%v'", id)
+			return nil
+		}
+	}
+	return ErrScheduledPaymentNotFound
+}
+
+// RunScheduledPayments makes the scheduled payments that are due every interval
+// (DefaultScheduleInterval if not set) until the context is done. Payments that
+// fail are retried with a backoff up to MaxScheduledPaymentAttempts times. The
+// handler is called with a ScheduledPaymentMade or ScheduledPaymentFailed event
+// for each payment from the goroutine of RunScheduledPayments. Recurring payments
+// missed while the wallet was not running are made once and then rescheduled.
+func (w *Wallet) RunScheduledPayments(ctx context.Context, interval time.Duration, handler func(Event)) error {
+	if interval <= 0 {
+		interval = DefaultScheduleInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		w.runDuePayments(time.Now(), handler)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDuePayments makes the payments that are due at the time
+func (w *Wallet) runDuePayments(now time.Time, handler func(Event)) {
+	for _, payment := range w.ScheduledPayments() {
+		due := payment.At
+		if payment.Attempts > 0 {
+			due = payment.RetryAt
+		}
+		if due <= now.Unix() {
+			w.runScheduledPayment(payment, now, handler)
+		}
+	}
+}
+
+func (w *Wallet) runScheduledPayment(payment storage.ScheduledPayment, now time.Time, handler func(Event)) {
+	event, err := w.makeScheduledPayment(payment)
+	if err == nil {
+		w.logInfof("made scheduled payment '%v' of %v from mint '%v'", payment.Id, payment.Amount, payment.Mint)
+		payment.LastError = ""
+		w.rescheduleOrRemove(payment, now)
+		handler(event)
+		return
+	}
+
+	payment.Attempts++
+	payment.LastError = err.Error()
+	retryable := !errors.Is(err, ErrMintNotExist) && !errors.Is(err, ErrSpendNotConfirmed)
+	if retryable && payment.Attempts < MaxScheduledPaymentAttempts {
+		delay := scheduledRetryDelay << (payment.Attempts - 1)
+		payment.RetryAt = now.Add(delay).Unix()
+		w.logErrorf("attempt %v of scheduled payment '%v' failed: %v. Retrying in %v",
+			payment.Attempts, payment.Id, err, delay)
+		if err := w.db.SaveScheduledPayment(payment); err != nil {
+			w.logErrorf("could not save scheduled payment '%v': %v", payment.Id, err)
+		}
+		return
+	}
+
+	w.logErrorf("scheduled payment '%v' failed after %v attempts: %v", payment.Id, payment.Attempts, err)
+	w.rescheduleOrRemove(payment, now)
+	handler(Event{
+		Kind:      ScheduledPaymentFailed,
+		Mint:      payment.Mint,
+		Amount:    payment.Amount,
+		PaymentId: payment.Id,
+		Err:       err,
+	})
+}
+
+// rescheduleOrRemove moves a recurring payment to the next time
+// after now it is scheduled for and removes payments made once
+func (w *Wallet) rescheduleOrRemove(payment storage.ScheduledPayment, now time.Time) {
+	if payment.Interval <= 0 {
+		if err := w.db.DeleteScheduledPayment(payment.Id); err != nil {
+			w.logErrorf("could not remove scheduled payment '%v': %v", payment.Id, err)
+		}
+		return
+	}
+
+	for payment.At <= now.Unix() {
+		payment.At += payment.Interval
+	}
+	payment.Attempts = 0
+	payment.RetryAt = 0
+	if err := w.db.SaveScheduledPayment(payment); err != nil {
+		w.logErrorf("could not save scheduled payment '%v': %v", payment.Id, err)
+	}
+}
+
+// makeScheduledPayment creates the token or pays the lightning address
+func (w *Wallet) makeScheduledPayment(payment storage.ScheduledPayment) (Event, error) {
+	event := Event{
+		Kind:      ScheduledPaymentMade,
+		Mint:      payment.Mint,
+		Amount:    payment.Amount,
+		PaymentId: payment.Id,
+	}
+
+	switch payment.Kind {
+	case storage.ScheduledSend:
+		var proofs cashu.Proofs
+		var err error
+		if len(payment.Target) > 0 {
+			pubkeyBytes, err := hex.DecodeString(payment.Target)
+			if err != nil {
+				return Event{}, fmt.Errorf("invalid public key: %v", err)
+			}
+			pubkey, err := btcec.ParsePubKey(pubkeyBytes)
+			if err != nil {
+				return Event{}, fmt.Errorf("invalid public key: %v", err)
+			}
+			proofs, err = w.SendToPubkey(payment.Amount, payment.Mint, pubkey, nil, true)
+			if err != nil {
+				return Event{}, err
+			}
+		} else {
+			proofs, err = w.Send(payment.Amount, payment.Mint, true)
+			if err != nil {
+				return Event{}, err
+			}
+		}
+
+		// proofs are already pending so the payment is not made again if the
+		// token can't be created. They can be reclaimed from the pending proofs.
+		token, err := w.NewToken(proofs, payment.Mint, DefaultTokenVersion, false)
+		if err != nil {
+			w.logErrorf("could not create token for scheduled payment '%v': %v", payment.Id, err)
+			return event, nil
+		}
+		event.Token, err = token.Serialize()
+		if err != nil {
+			w.logErrorf("could not serialize token for scheduled payment '%v': %v", payment.Id, err)
+		}
+		return event, nil
+
+	case storage.ScheduledMelt:
+		quote, err := w.RequestMeltQuoteForAddress(payment.Target, payment.Amount, payment.Mint, lnurl.PayOptions{})
+		if err != nil {
+			return Event{}, err
+		}
+		event.QuoteId = quote.Quote
+
+		response, err := w.Melt(quote.Quote)
+		if err != nil {
+			// if the proofs are still pending, the payment might have been made
+			// so it is not tried again. The journal recovers the melt.
+			if len(w.db.GetPendingProofsByQuoteId(quote.Quote)) > 0 {
+				w.logErrorf("scheduled payment '%v' might have been made. Melt quote '%v' is pending: %v",
+					payment.Id, quote.Quote, err)
+				return event, nil
+			}
+			return Event{}, err
+		}
+		if response.State == nut05.Unpaid {
+			return Event{}, fmt.Errorf("payment of melt quote '%v' failed", quote.Quote)
+		}
+		return event, nil
+
+	default:
+		return Event{}, fmt.Errorf("unknown scheduled payment kind %v", payment.Kind)
+	}
+}
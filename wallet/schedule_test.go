@@ -0,0 +1,166 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestSchedulePayment(t *testing.T) {
+	mintURL := "http://127.0.0.1:1"
+	keyset := crypto.WalletKeyset{Id: "009a1f293253e41e", MintURL: mintURL}
+	w := &Wallet{
+		db:    storage.NewMemoryDB(),
+		unit:  cashu.Sat,
+		mints: map[string]walletMint{mintURL: {mintURL: mintURL, activeKeyset: keyset}},
+	}
+	at := time.Now().Add(time.Hour)
+
+	if _, err := w.SchedulePayment(at, 100, PaymentTarget{Mint: "http://unknown.mint"}); !errors.Is(err, ErrMintNotExist) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintNotExist, err)
+	}
+	if _, err := w.SchedulePayment(at, 0, PaymentTarget{Mint: mintURL}); err == nil {
+		t.Fatal("expected error scheduling payment with amount of 0")
+	}
+	key, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := PaymentTarget{Mint: mintURL, LightningAddress: "alice@example.com", Pubkey: key.PubKey()}
+	if _, err := w.SchedulePayment(at, 100, target); err == nil {
+		t.Fatal("expected error scheduling payment with lightning address and public key")
+	}
+	if _, err := w.ScheduleRecurringPayment(at, time.Second, 100, PaymentTarget{Mint: mintURL}); err == nil {
+		t.Fatal("expected error scheduling recurring payment with interval below min")
+	}
+
+	melt, err := w.ScheduleRecurringPayment(at, 24*time.Hour, 21, PaymentTarget{Mint: mintURL, LightningAddress: "alice@example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error scheduling payment: %v", err)
+	}
+	if melt.Kind != storage.ScheduledMelt || melt.Target != "alice@example.com" || melt.Interval != 86400 {
+		t.Fatalf("unexpected scheduled payment '%+v'", melt)
+	}
+	send, err := w.SchedulePayment(at.Add(-time.Minute), 100, PaymentTarget{Mint: mintURL, Pubkey: key.PubKey()})
+	if err != nil {
+		t.Fatalf("unexpected error scheduling payment: %v", err)
+	}
+	if send.Kind != storage.ScheduledSend || len(send.Target) != 66 || send.Interval != 0 {
+		t.Fatalf("unexpected scheduled payment '%+v'", send)
+	}
+
+	payments := w.ScheduledPayments()
+	if len(payments) != 2 || payments[0].Id != send.Id || payments[1].Id != melt.Id {
+		t.Fatalf("expected scheduled payments sorted by time but got '%+v'", payments)
+	}
+
+	if err := w.CancelScheduledPayment(send.Id); err != nil {
+		t.Fatalf("unexpected error canceling payment: %v", err)
+	}
+	if err := w.CancelScheduledPayment(send.Id); !errors.Is(err, ErrScheduledPaymentNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrScheduledPaymentNotFound, err)
+	}
+	if payments := w.ScheduledPayments(); len(payments) != 1 || payments[0].Id != melt.Id {
+		t.Fatalf("expected only melt payment but got '%+v'", payments)
+	}
+}
+
+func TestRunScheduledPayments(t *testing.T) {
+	mintURL := "http://127.0.0.1:1"
+	keyset := crypto.WalletKeyset{Id: "009a1f293253e41e", MintURL: mintURL}
+	db := storage.NewMemoryDB()
+	w := &Wallet{
+		db:    db,
+		unit:  cashu.Sat,
+		mints: map[string]walletMint{mintURL: {mintURL: mintURL, activeKeyset: keyset}},
+	}
+	proofs := cashu.Proofs{
+		{Amount: 1, Id: keyset.Id, Secret: "secret1", C: "02aa"},
+		{Amount: 2, Id: keyset.Id, Secret: "secret2", C: "02bb"},
+	}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []Event
+	handler := func(event Event) { events = append(events, event) }
+	now := time.Now()
+
+	// payment is not made before its time
+	send, err := w.ScheduleRecurringPayment(now.Add(time.Minute), time.Hour, 3, PaymentTarget{Mint: mintURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.runDuePayments(now, handler)
+	if len(events) != 0 {
+		t.Fatalf("expected no events but got '%+v'", events)
+	}
+
+	// proofs with the exact amount are sent without a swap
+	now = now.Add(2 * time.Minute)
+	w.runDuePayments(now, handler)
+	if len(events) != 1 || events[0].Kind != ScheduledPaymentMade || events[0].PaymentId != send.Id {
+		t.Fatalf("expected scheduled payment made event but got '%+v'", events)
+	}
+	token, err := cashu.DecodeToken(events[0].Token)
+	if err != nil {
+		t.Fatalf("invalid token in event: %v", err)
+	}
+	if token.Amount() != 3 {
+		t.Fatalf("expected token of 3 but got %v", token.Amount())
+	}
+	payments := w.ScheduledPayments()
+	if len(payments) != 1 || payments[0].At != send.At+3600 || payments[0].Attempts != 0 {
+		t.Fatalf("expected recurring payment to be rescheduled but got '%+v'", payments)
+	}
+
+	// payment is retried with a backoff and fails after the max attempts
+	events = nil
+	now = time.Unix(payments[0].At, 0)
+	for i := range MaxScheduledPaymentAttempts {
+		w.runDuePayments(now, handler)
+		payment := w.ScheduledPayments()[0]
+		if i < MaxScheduledPaymentAttempts-1 {
+			if payment.Attempts != i+1 || len(payment.LastError) == 0 {
+				t.Fatalf("expected %v failed attempts but got '%+v'", i+1, payment)
+			}
+			expectedRetry := now.Add(scheduledRetryDelay << i).Unix()
+			if payment.RetryAt != expectedRetry {
+				t.Fatalf("expected retry at %v but got %v", expectedRetry, payment.RetryAt)
+			}
+			// not retried before the delay
+			w.runDuePayments(now.Add(scheduledRetryDelay<<i-time.Second), handler)
+			if w.ScheduledPayments()[0].Attempts != i+1 {
+				t.Fatal("expected payment not to be retried before the delay")
+			}
+			now = time.Unix(payment.RetryAt, 0)
+		}
+	}
+	if len(events) != 1 || events[0].Kind != ScheduledPaymentFailed || !errors.Is(events[0].Err, ErrInsufficientMintBalance) {
+		t.Fatalf("expected scheduled payment failed event but got '%+v'", events)
+	}
+	payments = w.ScheduledPayments()
+	if len(payments) != 1 || payments[0].At != send.At+7200 || payments[0].Attempts != 0 {
+		t.Fatalf("expected recurring payment to be rescheduled after failing but got '%+v'", payments)
+	}
+
+	// payments made once are removed after failing
+	events = nil
+	w.CancelScheduledPayment(send.Id)
+	w.mints = map[string]walletMint{}
+	db.SaveScheduledPayment(storage.ScheduledPayment{Id: "once", Kind: storage.ScheduledSend, Mint: mintURL, Amount: 1, At: now.Unix()})
+	w.runDuePayments(now, handler)
+	if len(events) != 1 || !errors.Is(events[0].Err, ErrMintNotExist) {
+		t.Fatalf("expected payment to fail without retries but got '%+v'", events)
+	}
+	if payments := w.ScheduledPayments(); len(payments) != 0 {
+		t.Fatalf("expected no scheduled payments but got '%+v'", payments)
+	}
+}
@@ -0,0 +1,48 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrSpendNotConfirmed = errors.New("spending over the limit was not confirmed")
+
+// SpendingPolicy sets limits on the amount that can be spent in a single
+// send or melt. Spending over a limit needs to be confirmed by the Confirm
+// callback (i.e to prompt the user or ask for a PIN). The zero value has no limits.
+type SpendingPolicy struct {
+	// MaxAmount is the max amount that can be spent in one transaction
+	// without confirmation. 0 means no limit.
+	MaxAmount uint64
+
+	// MintLimits are limits for spending from specific mints that
+	// are used instead of MaxAmount. A limit of 0 means no limit.
+	MintLimits map[string]uint64
+
+	// Confirm is called with the mint and amount when a transaction is over
+	// the limit. The transaction is rejected if Confirm is nil or returns false.
+	// It can be called concurrently when paying from multiple mints.
+	Confirm func(mint string, amount uint64) bool
+}
+
+// limit returns the spending limit for the mint
+func (policy SpendingPolicy) limit(mint string) uint64 {
+	if limit, ok := policy.MintLimits[mint]; ok {
+		return limit
+	}
+	return policy.MaxAmount
+}
+
+func (w *Wallet) checkSpendingPolicy(mint string, amount uint64) error {
+	policy := w.spendingPolicy
+	limit := policy.limit(mint)
+	if limit == 0 || amount <= limit {
+		return nil
+	}
+
+	if policy.Confirm == nil || !policy.Confirm(mint, amount) {
+		return fmt.Errorf("%w: amount %v is over the limit of %v", ErrSpendNotConfirmed, amount, limit)
+	}
+	w.logInfof("confirmed spending %v from mint '%v' over the limit of %v", amount, mint, limit)
+	return nil
+}
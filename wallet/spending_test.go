@@ -0,0 +1,98 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestCheckSpendingPolicy(t *testing.T) {
+	mint := "http://localhost:3338"
+	otherMint := "http://localhost:8888"
+	w := &Wallet{}
+
+	// no limits in zero value policy
+	if err := w.checkSpendingPolicy(mint, 1000000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var confirmed []string
+	confirm := false
+	w.spendingPolicy = SpendingPolicy{
+		MaxAmount:  100,
+		MintLimits: map[string]uint64{otherMint: 1000},
+		Confirm: func(mint string, amount uint64) bool {
+			confirmed = append(confirmed, mint)
+			return confirm
+		},
+	}
+	if err := w.checkSpendingPolicy(mint, 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.checkSpendingPolicy(mint, 101); !errors.Is(err, ErrSpendNotConfirmed) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrSpendNotConfirmed, err)
+	}
+	// mint limit is used instead of the max amount
+	if err := w.checkSpendingPolicy(otherMint, 1000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.checkSpendingPolicy(otherMint, 1001); !errors.Is(err, ErrSpendNotConfirmed) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrSpendNotConfirmed, err)
+	}
+	confirm = true
+	if err := w.checkSpendingPolicy(mint, 101); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{mint, otherMint, mint}
+	if len(confirmed) != len(expected) {
+		t.Fatalf("expected confirm to be called %v times but got %v", len(expected), len(confirmed))
+	}
+	for i := range expected {
+		if confirmed[i] != expected[i] {
+			t.Fatalf("expected confirm for mint '%v' but got '%v'", expected[i], confirmed[i])
+		}
+	}
+
+	// limit of 0 for a mint means no limit
+	w.spendingPolicy = SpendingPolicy{MaxAmount: 100, MintLimits: map[string]uint64{otherMint: 0}}
+	if err := w.checkSpendingPolicy(otherMint, 1000000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// limit without callback rejects amounts above it
+	if err := w.checkSpendingPolicy(mint, 101); !errors.Is(err, ErrSpendNotConfirmed) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrSpendNotConfirmed, err)
+	}
+}
+
+func TestSpendingPolicyLimits(t *testing.T) {
+	mint := "http://localhost:3338"
+	db := storage.NewMemoryDB()
+	w := &Wallet{
+		db:             db,
+		mints:          map[string]walletMint{mint: {mintURL: mint}},
+		spendingPolicy: SpendingPolicy{MaxAmount: 100},
+	}
+
+	if _, err := w.Send(101, mint, false); !errors.Is(err, ErrSpendNotConfirmed) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrSpendNotConfirmed, err)
+	}
+	if _, err := w.BulkSend(3, 50, mint, BulkSendOptions{}); !errors.Is(err, ErrSpendNotConfirmed) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrSpendNotConfirmed, err)
+	}
+	if _, err := w.Burn(101, mint); !errors.Is(err, ErrSpendNotConfirmed) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrSpendNotConfirmed, err)
+	}
+
+	// fee reserve counts towards the limit
+	quote := storage.MeltQuote{QuoteId: "quote", Mint: mint, State: nut05.Unpaid, Amount: 98, FeeReserve: 3}
+	if err := db.SaveMeltQuote(quote); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Melt(quote.QuoteId); !errors.Is(err, ErrSpendNotConfirmed) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrSpendNotConfirmed, err)
+	}
+}
@@ -0,0 +1,200 @@
+package wallet
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+type StatementFormat int
+
+const (
+	StatementCSV StatementFormat = iota + 1
+	StatementJSON
+)
+
+// Statement has the transactions of a mint in a period with the balance after
+// each of them. Balances are worked out back from the current balance so they
+// are off while a melt is pending and its proofs are not in the balance.
+type Statement struct {
+	Mint           string           `json:"mint"`
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	OpeningBalance int64            `json:"opening_balance"`
+	ClosingBalance int64            `json:"closing_balance"`
+	TotalIn        uint64           `json:"total_in"`
+	TotalOut       uint64           `json:"total_out"`
+	TotalFees      uint64           `json:"total_fees"`
+	Entries        []StatementEntry `json:"entries"`
+}
+
+type StatementEntry struct {
+	Id     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"`
+	Amount uint64    `json:"amount"`
+	Fee    uint64    `json:"fee"`
+	// change in the balance
+	Net       int64  `json:"net"`
+	Balance   int64  `json:"balance"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// Transactions returns the transactions of the mint sorted by time.
+// Transactions of all mints are returned if mint is empty.
+func (w *Wallet) Transactions(mint string) []storage.Transaction {
+	var transactions []storage.Transaction
+	for _, tx := range w.db.GetTransactions() {
+		if len(mint) == 0 || tx.Mint == mint {
+			transactions = append(transactions, tx)
+		}
+	}
+	slices.SortStableFunc(transactions, func(a, b storage.Transaction) int {
+		return cmp.Compare(a.CreatedAt, b.CreatedAt)
+	})
+	return transactions
+}
+
+// GetStatement returns the statement of the transactions of the mint from
+// the time (inclusive) to the time (exclusive). The zero time for to is now.
+func (w *Wallet) GetStatement(mint string, from, to time.Time) (*Statement, error) {
+	if _, ok := w.mints[mint]; !ok {
+		return nil, ErrMintNotExist
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if !from.Before(to) {
+		return nil, errors.New("start of the statement has to be before its end")
+	}
+
+	transactions := w.Transactions(mint)
+	opening := int64(w.GetBalanceByMints()[mint])
+	for _, tx := range transactions {
+		if tx.CreatedAt >= from.Unix() {
+			opening -= tx.Net()
+		}
+	}
+
+	statement := &Statement{
+		Mint:           mint,
+		From:           from,
+		To:             to,
+		OpeningBalance: opening,
+		ClosingBalance: opening,
+		Entries:        []StatementEntry{},
+	}
+	for _, tx := range transactions {
+		if tx.CreatedAt < from.Unix() || tx.CreatedAt >= to.Unix() {
+			continue
+		}
+		statement.ClosingBalance += tx.Net()
+		if tx.Kind.Incoming() {
+			statement.TotalIn += tx.Amount
+		} else {
+			statement.TotalOut += tx.Amount
+		}
+		statement.TotalFees += tx.Fee
+		statement.Entries = append(statement.Entries, StatementEntry{
+			Id:        tx.Id,
+			Time:      time.Unix(tx.CreatedAt, 0),
+			Kind:      tx.Kind.String(),
+			Amount:    tx.Amount,
+			Fee:       tx.Fee,
+			Net:       tx.Net(),
+			Balance:   statement.ClosingBalance,
+			Reference: tx.Reference,
+		})
+	}
+	return statement, nil
+}
+
+// ExportStatement returns the statement of the mint for the period
+// encoded as CSV, with a row for the opening balance, or as JSON.
+func (w *Wallet) ExportStatement(mint string, from, to time.Time, format StatementFormat) ([]byte, error) {
+	statement, err := w.GetStatement(mint, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case StatementJSON:
+		return json.MarshalIndent(statement, "", "  ")
+	case StatementCSV:
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		writer.Write([]string{"time", "kind", "amount", "fee", "net", "balance", "reference", "id"})
+		writer.Write([]string{
+			statement.From.UTC().Format(time.RFC3339), "opening balance", "0", "0", "0",
+			strconv.FormatInt(statement.OpeningBalance, 10), "", "",
+		})
+		for _, entry := range statement.Entries {
+			writer.Write([]string{
+				entry.Time.UTC().Format(time.RFC3339),
+				entry.Kind,
+				strconv.FormatUint(entry.Amount, 10),
+				strconv.FormatUint(entry.Fee, 10),
+				strconv.FormatInt(entry.Net, 10),
+				strconv.FormatInt(entry.Balance, 10),
+				entry.Reference,
+				entry.Id,
+			})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, errors.New("unknown statement format")
+	}
+}
+
+// recordTransaction saves the transaction in the history of the wallet.
+// The operation already happened so errors are only logged.
+func (w *Wallet) recordTransaction(
+	kind storage.TransactionKind,
+	mint string,
+	amount, fee uint64,
+	reference string,
+) {
+	id, err := randomId()
+	if err != nil {
+		w.logErrorf("could not save %v transaction: %v", kind, err)
+		return
+	}
+	tx := storage.Transaction{
+		Id:        id,
+		Kind:      kind,
+		Mint:      mint,
+		Amount:    amount,
+		Fee:       fee,
+		Reference: reference,
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := w.db.SaveTransaction(tx); err != nil {
+		w.logErrorf("could not save %v transaction: %v", kind, err)
+	}
+}
+
+// recordSpent saves an outgoing transaction of the amount with the
+// fees being what the balance of the mint went down on top of it
+func (w *Wallet) recordSpent(
+	kind storage.TransactionKind,
+	mint string,
+	amount, balanceBefore uint64,
+	reference string,
+) {
+	var fee uint64
+	if spent := balanceBefore - min(balanceBefore, w.GetBalanceByMints()[mint]); spent > amount {
+		fee = spent - amount
+	}
+	w.recordTransaction(kind, mint, amount, fee, reference)
+}
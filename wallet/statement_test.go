@@ -0,0 +1,113 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestExportStatement(t *testing.T) {
+	mintURL := "http://127.0.0.1:1"
+	otherMint := "http://127.0.0.1:2"
+	keyset := crypto.WalletKeyset{Id: "009a1f293253e41e", MintURL: mintURL}
+	w := &Wallet{
+		db:   storage.NewMemoryDB(),
+		unit: cashu.Sat,
+		mints: map[string]walletMint{
+			mintURL:   {mintURL: mintURL, activeKeyset: keyset},
+			otherMint: {mintURL: otherMint, activeKeyset: crypto.WalletKeyset{Id: "00ad268c4d1f5826", MintURL: otherMint}},
+		},
+	}
+	if err := w.db.SaveProofs(cashu.Proofs{
+		{Amount: 64, Id: keyset.Id, Secret: "secret1", C: "C1"},
+		{Amount: 32, Id: keyset.Id, Secret: "secret2", C: "C2"},
+		{Amount: 4, Id: keyset.Id, Secret: "secret3", C: "C3"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	transactions := []storage.Transaction{
+		{Id: "1", Kind: storage.MintTransaction, Mint: mintURL, Amount: 200, Reference: "quote1", CreatedAt: start.Unix()},
+		{Id: "2", Kind: storage.SendTransaction, Mint: mintURL, Amount: 50, Fee: 2, CreatedAt: start.Add(24 * time.Hour).Unix()},
+		{Id: "3", Kind: storage.ReceiveTransaction, Mint: mintURL, Amount: 10, Fee: 1, CreatedAt: start.Add(48 * time.Hour).Unix()},
+		{Id: "4", Kind: storage.MeltTransaction, Mint: mintURL, Amount: 50, Fee: 7, Reference: "quote2", CreatedAt: start.Add(72 * time.Hour).Unix()},
+		{Id: "5", Kind: storage.MintTransaction, Mint: otherMint, Amount: 1000, CreatedAt: start.Add(48 * time.Hour).Unix()},
+	}
+	for _, tx := range transactions {
+		if err := w.db.SaveTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := w.ExportStatement("http://unknown.mint", start, time.Time{}, StatementCSV); !errors.Is(err, ErrMintNotExist) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintNotExist, err)
+	}
+	if _, err := w.ExportStatement(mintURL, start, start, StatementCSV); err == nil {
+		t.Fatal("expected error for empty period")
+	}
+
+	// statement of the 2nd and 3rd day
+	from := start.Add(24 * time.Hour)
+	to := start.Add(72 * time.Hour)
+	statement, err := w.GetStatement(mintURL, from, to)
+	if err != nil {
+		t.Fatalf("unexpected error getting statement: %v", err)
+	}
+	// balance of 100 now was 200 before the send
+	if statement.OpeningBalance != 200 || statement.ClosingBalance != 157 {
+		t.Fatalf("expected opening balance of 200 and closing of 157 but got %v and %v",
+			statement.OpeningBalance, statement.ClosingBalance)
+	}
+	if len(statement.Entries) != 2 || statement.Entries[0].Id != "2" || statement.Entries[1].Id != "3" {
+		t.Fatalf("unexpected entries in statement: %+v", statement.Entries)
+	}
+	if statement.Entries[0].Net != -52 || statement.Entries[0].Balance != 148 || statement.Entries[1].Net != 9 {
+		t.Fatalf("unexpected entries in statement: %+v", statement.Entries)
+	}
+	if statement.TotalIn != 10 || statement.TotalOut != 50 || statement.TotalFees != 3 {
+		t.Fatalf("unexpected totals in statement: %+v", statement)
+	}
+
+	csvStatement, err := w.ExportStatement(mintURL, from, to, StatementCSV)
+	if err != nil {
+		t.Fatalf("unexpected error exporting statement: %v", err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(csvStatement)).ReadAll()
+	if err != nil {
+		t.Fatalf("invalid csv: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 rows in csv but got %v", len(rows))
+	}
+	if rows[1][1] != "opening balance" || rows[1][5] != "200" {
+		t.Fatalf("unexpected opening balance row %v", rows[1])
+	}
+	expected := []string{"2024-01-02T00:00:00Z", "send", "50", "2", "-52", "148", "", "2"}
+	for i, value := range expected {
+		if rows[2][i] != value {
+			t.Fatalf("expected row %v but got %v", expected, rows[2])
+		}
+	}
+
+	jsonStatement, err := w.ExportStatement(mintURL, start, time.Time{}, StatementJSON)
+	if err != nil {
+		t.Fatalf("unexpected error exporting statement: %v", err)
+	}
+	var decoded Statement
+	if err := json.Unmarshal(jsonStatement, &decoded); err != nil {
+		t.Fatalf("invalid json: %v", err)
+	}
+	if decoded.OpeningBalance != 0 || decoded.ClosingBalance != 100 || len(decoded.Entries) != 4 {
+		t.Fatalf("unexpected statement: %+v", decoded)
+	}
+}
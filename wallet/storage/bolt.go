@@ -1,3 +1,5 @@
+//go:build !js
+
 package storage
 
 import (
@@ -22,13 +24,17 @@ const (
 	MELT_QUOTES_BUCKET    = "melt_quotes"
 	INVOICES_BUCKET       = "invoices"
 	SEED_BUCKET           = "seed"
+	MINT_TRUST_BUCKET     = "mint_trust"
+	OPERATIONS_BUCKET     = "operations"
+	LOCKED_SENDS_BUCKET   = "locked_sends"
+	QUARANTINE_BUCKET     = "quarantined_proofs"
+	SCHEDULED_BUCKET      = "scheduled_payments"
+	TRANSACTIONS_BUCKET   = "transactions"
+	COUNTER_LEASES_BUCKET = "counter_leases"
+	RESTORE_BUCKET        = "restore_progress"
 	MNEMONIC_KEY          = "mnemonic"
 )
 
-var (
-	ProofNotFound = errors.New("proof not found")
-)
-
 type BoltDB struct {
 	bolt *bolt.DB
 }
@@ -88,6 +94,46 @@ func (db *BoltDB) initWalletBuckets() error {
 			return err
 		}
 
+		_, err = tx.CreateBucketIfNotExists([]byte(MINT_TRUST_BUCKET))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists([]byte(OPERATIONS_BUCKET))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists([]byte(LOCKED_SENDS_BUCKET))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists([]byte(QUARANTINE_BUCKET))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists([]byte(SCHEDULED_BUCKET))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists([]byte(TRANSACTIONS_BUCKET))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists([]byte(COUNTER_LEASES_BUCKET))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucketIfNotExists([]byte(RESTORE_BUCKET))
+		if err != nil {
+			return err
+		}
+
 		return nil
 	})
 }
@@ -488,6 +534,34 @@ func (db *BoltDB) GetKeysetCounter(keysetId string) uint32 {
 	return counter
 }
 
+func (db *BoltDB) SaveMintTrustLevel(mintURL string, level TrustLevel) error {
+	if err := db.bolt.Update(func(tx *bolt.Tx) error {
+		trustb := tx.Bucket([]byte(MINT_TRUST_BUCKET))
+		return trustb.Put([]byte(mintURL), []byte{byte(level)})
+	}); err != nil {
+		return fmt.Errorf("error saving mint trust level: %v", err)
+	}
+	return nil
+}
+
+// GetMintTrustLevels returns the trust level of the mints that have one saved.
+// Mints without a saved level were added before levels existed.
+func (db *BoltDB) GetMintTrustLevels() map[string]TrustLevel {
+	levels := make(map[string]TrustLevel)
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		trustb := tx.Bucket([]byte(MINT_TRUST_BUCKET))
+		return trustb.ForEach(func(mintURL, v []byte) error {
+			if len(v) == 1 {
+				levels[string(mintURL)] = TrustLevel(v[0])
+			}
+			return nil
+		})
+	})
+
+	return levels
+}
+
 func (db *BoltDB) SaveMintQuote(quote MintQuote) error {
 	jsonbytes, err := json.Marshal(quote)
 	if err != nil {
@@ -537,6 +611,13 @@ func (db *BoltDB) GetMintQuoteById(id string) *MintQuote {
 	return quote
 }
 
+func (db *BoltDB) DeleteMintQuote(id string) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		quotesb := tx.Bucket([]byte(MINT_QUOTES_BUCKET))
+		return quotesb.Delete([]byte(id))
+	})
+}
+
 func (db *BoltDB) SaveMeltQuote(quote MeltQuote) error {
 	jsonbytes, err := json.Marshal(quote)
 	if err != nil {
@@ -586,6 +667,279 @@ func (db *BoltDB) GetMeltQuoteById(id string) *MeltQuote {
 	return quote
 }
 
+func (db *BoltDB) DeleteMeltQuote(id string) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		quotesb := tx.Bucket([]byte(MELT_QUOTES_BUCKET))
+		return quotesb.Delete([]byte(id))
+	})
+}
+
+func (db *BoltDB) SaveOperation(operation Operation) error {
+	jsonOperation, err := json.Marshal(operation)
+	if err != nil {
+		return fmt.Errorf("invalid operation: %v", err)
+	}
+
+	if err := db.bolt.Update(func(tx *bolt.Tx) error {
+		operationsb := tx.Bucket([]byte(OPERATIONS_BUCKET))
+		return operationsb.Put([]byte(operation.Id), jsonOperation)
+	}); err != nil {
+		return fmt.Errorf("error saving operation: %v", err)
+	}
+	return nil
+}
+
+func (db *BoltDB) GetOperations() []Operation {
+	var operations []Operation
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		operationsb := tx.Bucket([]byte(OPERATIONS_BUCKET))
+
+		c := operationsb.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var operation Operation
+			if err := json.Unmarshal(v, &operation); err != nil {
+				continue
+			}
+			operations = append(operations, operation)
+		}
+		return nil
+	})
+
+	return operations
+}
+
+func (db *BoltDB) DeleteOperation(id string) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		operationsb := tx.Bucket([]byte(OPERATIONS_BUCKET))
+		return operationsb.Delete([]byte(id))
+	})
+}
+
+func (db *BoltDB) SaveLockedSend(lockedSend LockedSend) error {
+	jsonLockedSend, err := json.Marshal(lockedSend)
+	if err != nil {
+		return fmt.Errorf("invalid locked send: %v", err)
+	}
+
+	if err := db.bolt.Update(func(tx *bolt.Tx) error {
+		lockedSendsb := tx.Bucket([]byte(LOCKED_SENDS_BUCKET))
+		return lockedSendsb.Put([]byte(lockedSend.Id), jsonLockedSend)
+	}); err != nil {
+		return fmt.Errorf("error saving locked send: %v", err)
+	}
+	return nil
+}
+
+func (db *BoltDB) GetLockedSends() []LockedSend {
+	var lockedSends []LockedSend
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		lockedSendsb := tx.Bucket([]byte(LOCKED_SENDS_BUCKET))
+
+		c := lockedSendsb.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var lockedSend LockedSend
+			if err := json.Unmarshal(v, &lockedSend); err != nil {
+				continue
+			}
+			lockedSends = append(lockedSends, lockedSend)
+		}
+		return nil
+	})
+
+	return lockedSends
+}
+
+func (db *BoltDB) DeleteLockedSend(id string) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		lockedSendsb := tx.Bucket([]byte(LOCKED_SENDS_BUCKET))
+		return lockedSendsb.Delete([]byte(id))
+	})
+}
+
+func (db *BoltDB) SaveTransaction(transaction Transaction) error {
+	jsonTransaction, err := json.Marshal(transaction)
+	if err != nil {
+		return fmt.Errorf("invalid transaction: %v", err)
+	}
+
+	if err := db.bolt.Update(func(tx *bolt.Tx) error {
+		transactionsb := tx.Bucket([]byte(TRANSACTIONS_BUCKET))
+		return transactionsb.Put([]byte(transaction.Id), jsonTransaction)
+	}); err != nil {
+		return fmt.Errorf("error saving transaction: %v", err)
+	}
+	return nil
+}
+
+func (db *BoltDB) GetTransactions() []Transaction {
+	var transactions []Transaction
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		transactionsb := tx.Bucket([]byte(TRANSACTIONS_BUCKET))
+
+		c := transactionsb.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var transaction Transaction
+			if err := json.Unmarshal(v, &transaction); err != nil {
+				continue
+			}
+			transactions = append(transactions, transaction)
+		}
+		return nil
+	})
+
+	return transactions
+}
+
+func (db *BoltDB) SaveScheduledPayment(payment ScheduledPayment) error {
+	jsonPayment, err := json.Marshal(payment)
+	if err != nil {
+		return fmt.Errorf("invalid scheduled payment: %v", err)
+	}
+
+	if err := db.bolt.Update(func(tx *bolt.Tx) error {
+		scheduledb := tx.Bucket([]byte(SCHEDULED_BUCKET))
+		return scheduledb.Put([]byte(payment.Id), jsonPayment)
+	}); err != nil {
+		return fmt.Errorf("error saving scheduled payment: %v", err)
+	}
+	return nil
+}
+
+func (db *BoltDB) GetScheduledPayments() []ScheduledPayment {
+	var payments []ScheduledPayment
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		scheduledb := tx.Bucket([]byte(SCHEDULED_BUCKET))
+
+		c := scheduledb.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var payment ScheduledPayment
+			if err := json.Unmarshal(v, &payment); err != nil {
+				continue
+			}
+			payments = append(payments, payment)
+		}
+		return nil
+	})
+
+	return payments
+}
+
+func (db *BoltDB) DeleteScheduledPayment(id string) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		scheduledb := tx.Bucket([]byte(SCHEDULED_BUCKET))
+		return scheduledb.Delete([]byte(id))
+	})
+}
+
+func (db *BoltDB) QuarantineProofs(proofs []QuarantinedProof) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		proofsb := tx.Bucket([]byte(PROOFS_BUCKET))
+		quarantineb := tx.Bucket([]byte(QUARANTINE_BUCKET))
+		for _, proof := range proofs {
+			jsonProof, err := json.Marshal(proof)
+			if err != nil {
+				return fmt.Errorf("invalid proof: %v", err)
+			}
+			if err := quarantineb.Put([]byte(proof.Y), jsonProof); err != nil {
+				return err
+			}
+			if err := proofsb.Delete([]byte(proof.Proof.Secret)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (db *BoltDB) GetQuarantinedProofs() []QuarantinedProof {
+	var proofs []QuarantinedProof
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		quarantineb := tx.Bucket([]byte(QUARANTINE_BUCKET))
+
+		c := quarantineb.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var proof QuarantinedProof
+			if err := json.Unmarshal(v, &proof); err != nil {
+				continue
+			}
+			proofs = append(proofs, proof)
+		}
+		return nil
+	})
+
+	return proofs
+}
+
+func (db *BoltDB) SaveCounterLease(lease CounterLease) error {
+	jsonLease, err := json.Marshal(lease)
+	if err != nil {
+		return fmt.Errorf("invalid counter lease: %v", err)
+	}
+
+	if err := db.bolt.Update(func(tx *bolt.Tx) error {
+		leasesb := tx.Bucket([]byte(COUNTER_LEASES_BUCKET))
+		return leasesb.Put([]byte(lease.KeysetId), jsonLease)
+	}); err != nil {
+		return fmt.Errorf("error saving counter lease: %v", err)
+	}
+	return nil
+}
+
+func (db *BoltDB) GetCounterLease(keysetId string) *CounterLease {
+	var lease *CounterLease
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		leasesb := tx.Bucket([]byte(COUNTER_LEASES_BUCKET))
+		leaseBytes := leasesb.Get([]byte(keysetId))
+		if leaseBytes == nil {
+			return nil
+		}
+		return json.Unmarshal(leaseBytes, &lease)
+	})
+
+	return lease
+}
+
+func (db *BoltDB) SaveRestoreProgress(progress RestoreProgress) error {
+	jsonProgress, err := json.Marshal(progress)
+	if err != nil {
+		return fmt.Errorf("invalid restore progress: %v", err)
+	}
+
+	if err := db.bolt.Update(func(tx *bolt.Tx) error {
+		restoreb := tx.Bucket([]byte(RESTORE_BUCKET))
+		return restoreb.Put([]byte(progress.KeysetId), jsonProgress)
+	}); err != nil {
+		return fmt.Errorf("error saving restore progress: %v", err)
+	}
+	return nil
+}
+
+func (db *BoltDB) GetRestoreProgress() []RestoreProgress {
+	var progress []RestoreProgress
+
+	db.bolt.View(func(tx *bolt.Tx) error {
+		restoreb := tx.Bucket([]byte(RESTORE_BUCKET))
+
+		c := restoreb.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var keysetProgress RestoreProgress
+			if err := json.Unmarshal(v, &keysetProgress); err != nil {
+				continue
+			}
+			progress = append(progress, keysetProgress)
+		}
+		return nil
+	})
+
+	return progress
+}
+
 func (db *BoltDB) MigrateInvoicesToQuotes() error {
 	invoices := db.GetInvoices()
 
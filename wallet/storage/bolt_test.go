@@ -1,20 +1,14 @@
+//go:build !js
+
 package storage
 
 import (
-	"encoding/hex"
 	"log"
-	"math/rand/v2"
 	"os"
 	"reflect"
 	"slices"
 	"strings"
 	"testing"
-
-	"github.com/decred/dcrd/dcrec/secp256k1/v4"
-	"github.com/elnosh/gonuts/cashu"
-	"github.com/elnosh/gonuts/cashu/nuts/nut04"
-	"github.com/elnosh/gonuts/cashu/nuts/nut05"
-	"github.com/elnosh/gonuts/crypto"
 )
 
 var (
@@ -219,6 +213,186 @@ func TestKeysets(t *testing.T) {
 	}
 }
 
+func TestMintTrustLevels(t *testing.T) {
+	if err := db.SaveMintTrustLevel("http://localhost:3338", Trusted); err != nil {
+		t.Fatalf("error saving mint trust level: %v", err)
+	}
+	if err := db.SaveMintTrustLevel("http://localhost:8888", AutoAdded); err != nil {
+		t.Fatalf("error saving mint trust level: %v", err)
+	}
+
+	expected := map[string]TrustLevel{
+		"http://localhost:3338": Trusted,
+		"http://localhost:8888": AutoAdded,
+	}
+	levels := db.GetMintTrustLevels()
+	if !reflect.DeepEqual(expected, levels) {
+		t.Fatalf("expected trust levels '%v' but got '%v'", expected, levels)
+	}
+
+	if err := db.SaveMintTrustLevel("http://localhost:8888", Trusted); err != nil {
+		t.Fatalf("error saving mint trust level: %v", err)
+	}
+	levels = db.GetMintTrustLevels()
+	if levels["http://localhost:8888"] != Trusted {
+		t.Fatalf("expected mint to be trusted but got '%v'", levels["http://localhost:8888"])
+	}
+}
+
+func TestOperations(t *testing.T) {
+	operations := []Operation{
+		{
+			Id:         "operation1",
+			Kind:       SwapOperation,
+			Mint:       "http://localhost:3338",
+			Inputs:     generateRandomProofs("keysetId1", 3),
+			Secrets:    []string{"secret1"},
+			Rs:         []string{"r1"},
+			KeysetId:   "keysetId1",
+			CounterEnd: 5,
+		},
+		{
+			Id:      "operation2",
+			Kind:    MeltOperation,
+			Mint:    "http://localhost:3338",
+			Inputs:  generateRandomProofs("keysetId1", 2),
+			QuoteId: "quoteId1",
+		},
+	}
+	for _, operation := range operations {
+		if err := db.SaveOperation(operation); err != nil {
+			t.Fatalf("error saving operation: %v", err)
+		}
+	}
+
+	savedOperations := db.GetOperations()
+	slices.SortFunc(savedOperations, func(a, b Operation) int {
+		return strings.Compare(a.Id, b.Id)
+	})
+	if !reflect.DeepEqual(operations, savedOperations) {
+		t.Fatalf("expected operations '%+v' but got '%+v'", operations, savedOperations)
+	}
+
+	if err := db.DeleteOperation("operation1"); err != nil {
+		t.Fatalf("error deleting operation: %v", err)
+	}
+	savedOperations = db.GetOperations()
+	if len(savedOperations) != 1 || savedOperations[0].Id != "operation2" {
+		t.Fatalf("expected only operation2 in journal but got '%+v'", savedOperations)
+	}
+}
+
+func TestLockedSends(t *testing.T) {
+	lockedSend := LockedSend{
+		Id:        "send1",
+		Mint:      "http://localhost:3338",
+		Proofs:    generateRandomProofs("keysetId1", 2),
+		CreatedAt: 1700000000,
+	}
+	if err := db.SaveLockedSend(lockedSend); err != nil {
+		t.Fatalf("error saving locked send: %v", err)
+	}
+
+	lockedSends := db.GetLockedSends()
+	if len(lockedSends) != 1 || !reflect.DeepEqual(lockedSends[0], lockedSend) {
+		t.Fatalf("expected locked send '%+v' but got '%+v'", lockedSend, lockedSends)
+	}
+
+	if err := db.DeleteLockedSend(lockedSend.Id); err != nil {
+		t.Fatalf("error deleting locked send: %v", err)
+	}
+	if lockedSends := db.GetLockedSends(); len(lockedSends) != 0 {
+		t.Fatalf("expected no locked sends but got '%+v'", lockedSends)
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	transactions := []Transaction{
+		{Id: "tx1", Kind: MintTransaction, Mint: "http://localhost:3338", Amount: 100, Reference: "quote1", CreatedAt: 1700000000},
+		{Id: "tx2", Kind: SendTransaction, Mint: "http://localhost:3338", Amount: 21, Fee: 1, CreatedAt: 1700000100},
+		{Id: "tx3", Kind: ReceiveTransaction, Mint: "http://localhost:3338", Amount: 10, Fee: 2, CreatedAt: 1700000200},
+	}
+	for _, transaction := range transactions {
+		if err := db.SaveTransaction(transaction); err != nil {
+			t.Fatalf("error saving transaction: %v", err)
+		}
+	}
+
+	savedTransactions := db.GetTransactions()
+	if !reflect.DeepEqual(savedTransactions, transactions) {
+		t.Fatalf("expected transactions '%+v' but got '%+v'", transactions, savedTransactions)
+	}
+
+	expectedNet := []int64{100, -22, 8}
+	for i, transaction := range savedTransactions {
+		if transaction.Net() != expectedNet[i] {
+			t.Fatalf("expected net of %v for %v transaction but got %v", expectedNet[i], transaction.Kind, transaction.Net())
+		}
+	}
+}
+
+func TestScheduledPayments(t *testing.T) {
+	payment := ScheduledPayment{
+		Id:        "payment1",
+		Kind:      ScheduledMelt,
+		Mint:      "http://localhost:3338",
+		Amount:    21,
+		Target:    "alice@example.com",
+		At:        1700003600,
+		Interval:  86400,
+		CreatedAt: 1700000000,
+	}
+	if err := db.SaveScheduledPayment(payment); err != nil {
+		t.Fatalf("error saving scheduled payment: %v", err)
+	}
+
+	payment.Attempts = 1
+	payment.RetryAt = 1700003660
+	payment.LastError = "mint is offline"
+	if err := db.SaveScheduledPayment(payment); err != nil {
+		t.Fatalf("error saving scheduled payment: %v", err)
+	}
+	payments := db.GetScheduledPayments()
+	if len(payments) != 1 || !reflect.DeepEqual(payments[0], payment) {
+		t.Fatalf("expected scheduled payment '%+v' but got '%+v'", payment, payments)
+	}
+
+	if err := db.DeleteScheduledPayment(payment.Id); err != nil {
+		t.Fatalf("error deleting scheduled payment: %v", err)
+	}
+	if payments := db.GetScheduledPayments(); len(payments) != 0 {
+		t.Fatalf("expected no scheduled payments but got '%+v'", payments)
+	}
+}
+
+func TestQuarantineProofs(t *testing.T) {
+	keysetId := "quarantineKeysetId"
+	proofs := generateRandomProofs(keysetId, 3)
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	quarantined := QuarantinedProof{
+		Y:             "02aa",
+		Mint:          "http://localhost:3338",
+		Proof:         proofs[0],
+		State:         "SPENT",
+		QuarantinedAt: 1700000000,
+	}
+	if err := db.QuarantineProofs([]QuarantinedProof{quarantined}); err != nil {
+		t.Fatalf("error quarantining proofs: %v", err)
+	}
+
+	quarantinedProofs := db.GetQuarantinedProofs()
+	if len(quarantinedProofs) != 1 || !reflect.DeepEqual(quarantinedProofs[0], quarantined) {
+		t.Fatalf("expected quarantined proof '%+v' but got '%+v'", quarantined, quarantinedProofs)
+	}
+	keysetProofs := db.GetProofsByKeysetId(keysetId)
+	if len(keysetProofs) != 2 || slices.Contains(keysetProofs, proofs[0]) {
+		t.Fatalf("expected quarantined proof to be removed from proofs but got '%+v'", keysetProofs)
+	}
+}
+
 func TestMintQuotes(t *testing.T) {
 	quoteId := "quoteId1"
 	mintQuote := generateMintQuote(quoteId)
@@ -248,6 +422,16 @@ func TestMintQuotes(t *testing.T) {
 	if len(quotesFromDb) != expectedNumQuotes {
 		t.Fatalf("expected '%v' mint quotes but got '%v' ", expectedNumQuotes, len(quotesFromDb))
 	}
+
+	if err := db.DeleteMintQuote(quoteId); err != nil {
+		t.Fatalf("error deleting mint quote: %v", err)
+	}
+	if db.GetMintQuoteById(quoteId) != nil {
+		t.Fatal("expected deleted quote to not be found")
+	}
+	if len(db.GetMintQuotes()) != expectedNumQuotes-1 {
+		t.Fatalf("expected '%v' mint quotes but got '%v' ", expectedNumQuotes-1, len(db.GetMintQuotes()))
+	}
 }
 
 func TestMeltQuotes(t *testing.T) {
@@ -279,114 +463,33 @@ func TestMeltQuotes(t *testing.T) {
 	if len(quotesFromDb) != expectedNumQuotes {
 		t.Fatalf("expected '%v' melt quotes but got '%v' ", expectedNumQuotes, len(quotesFromDb))
 	}
-}
-
-func generateRandomString(length int) string {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = letters[rand.IntN(len(letters))]
-	}
-	return string(b)
-}
-
-func generateRandomProofs(keysetId string, num int) cashu.Proofs {
-	proofs := make(cashu.Proofs, num)
 
-	for i := 0; i < num; i++ {
-		proof := cashu.Proof{
-			Amount: 21,
-			Id:     keysetId,
-			Secret: generateRandomString(64),
-			C:      generateRandomString(64),
-		}
-		proofs[i] = proof
+	if err := db.DeleteMeltQuote(quoteId); err != nil {
+		t.Fatalf("error deleting melt quote: %v", err)
 	}
-
-	return proofs
-}
-
-func toDBProofs(proofs cashu.Proofs, quoteId string) []DBProof {
-	dbProofs := make([]DBProof, len(proofs))
-
-	for i, proof := range proofs {
-		Y, _ := crypto.HashToCurve([]byte(proof.Secret))
-		Yhex := hex.EncodeToString(Y.SerializeCompressed())
-
-		dbProof := DBProof{
-			Y:           Yhex,
-			Amount:      proof.Amount,
-			Id:          proof.Id,
-			Secret:      proof.Secret,
-			C:           proof.C,
-			DLEQ:        proof.DLEQ,
-			MeltQuoteId: quoteId,
-		}
-		dbProofs[i] = dbProof
+	if db.GetMeltQuoteById(quoteId) != nil {
+		t.Fatal("expected deleted quote to not be found")
 	}
-
-	return dbProofs
-}
-
-func sortProofs(proofs cashu.Proofs) {
-	slices.SortFunc(proofs, func(a, b cashu.Proof) int {
-		return strings.Compare(a.Secret, b.Secret)
-	})
-}
-
-func sortDBProofs(proofs []DBProof) {
-	slices.SortFunc(proofs, func(a, b DBProof) int {
-		return strings.Compare(a.Secret, b.Secret)
-	})
-}
-
-func generateKeyset(mint string) crypto.WalletKeyset {
-	return crypto.WalletKeyset{
-		Id:          generateRandomString(32),
-		MintURL:     mint,
-		Unit:        cashu.Sat.String(),
-		Active:      true,
-		PublicKeys:  make(map[uint64]*secp256k1.PublicKey),
-		InputFeePpk: 100,
+	if len(db.GetMeltQuotes()) != expectedNumQuotes-1 {
+		t.Fatalf("expected '%v' melt quotes but got '%v' ", expectedNumQuotes-1, len(db.GetMeltQuotes()))
 	}
 }
 
-func generateMintQuote(id string) MintQuote {
-	return MintQuote{
-		QuoteId: id,
-		Mint:    "http://localhost:3338",
-		Method:  "bolt11",
-		State:   nut04.Unpaid,
-		Amount:  21,
+func TestCounterLeases(t *testing.T) {
+	keysetId := "leaseKeysetId"
+	if lease := db.GetCounterLease(keysetId); lease != nil {
+		t.Fatalf("expected no counter lease but got '%+v'", lease)
 	}
-}
 
-func generateRandomMintQuotes(num int) []MintQuote {
-	quotes := make([]MintQuote, num)
-	for i := 0; i < num; i++ {
-		id := generateRandomString(32)
-		quote := generateMintQuote(id)
-		quotes[i] = quote
+	lease := CounterLease{KeysetId: keysetId, Mint: "http://localhost:3338", Start: 0, End: 100, CheckedAt: 1700000000}
+	if err := db.SaveCounterLease(lease); err != nil {
+		t.Fatalf("error saving counter lease: %v", err)
 	}
-	return quotes
-}
-
-func generateMeltQuote(id string) MeltQuote {
-	return MeltQuote{
-		QuoteId: id,
-		Mint:    "http://localhost:3338",
-		Method:  "bolt11",
-		State:   nut05.Unpaid,
-		Amount:  21,
+	lease.Start, lease.End = 150, 250
+	if err := db.SaveCounterLease(lease); err != nil {
+		t.Fatalf("error saving counter lease: %v", err)
 	}
-}
-
-func generateRandomMeltQuotes(num int) []MeltQuote {
-	quotes := make([]MeltQuote, num)
-	for i := 0; i < num; i++ {
-		id := generateRandomString(32)
-		quote := generateMeltQuote(id)
-		quotes[i] = quote
+	if savedLease := db.GetCounterLease(keysetId); savedLease == nil || *savedLease != lease {
+		t.Fatalf("expected counter lease '%+v' but got '%+v'", lease, savedLease)
 	}
-	return quotes
 }
@@ -0,0 +1,21 @@
+//go:build !js
+
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/elnosh/gonuts/wallet/storage"
+	"github.com/elnosh/gonuts/wallet/storage/storagetest"
+)
+
+func TestBoltDBContract(t *testing.T) {
+	storagetest.TestWalletDB(t, func(t *testing.T) storage.WalletDB {
+		db, err := storage.InitBolt(t.TempDir())
+		if err != nil {
+			t.Fatalf("error setting up bolt db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	})
+}
@@ -0,0 +1,41 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/elnosh/gonuts/wallet/storage"
+	"github.com/elnosh/gonuts/wallet/storage/storagetest"
+)
+
+func TestMemoryDBContract(t *testing.T) {
+	storagetest.TestWalletDB(t, func(t *testing.T) storage.WalletDB {
+		return storage.NewMemoryDB()
+	})
+}
+
+func TestSnapshotDBContract(t *testing.T) {
+	storagetest.TestWalletDB(t, func(t *testing.T) storage.WalletDB {
+		db, err := storage.NewSnapshotDB(&memoryStore{})
+		if err != nil {
+			t.Fatalf("error setting up snapshot db: %v", err)
+		}
+		return db
+	})
+}
+
+func TestMockDBContract(t *testing.T) {
+	storagetest.TestWalletDB(t, func(t *testing.T) storage.WalletDB {
+		return storagetest.NewMockDB(nil)
+	})
+}
+
+type memoryStore struct {
+	snapshot []byte
+}
+
+func (s *memoryStore) Load() ([]byte, error) { return s.snapshot, nil }
+
+func (s *memoryStore) Save(snapshot []byte) error {
+	s.snapshot = snapshot
+	return nil
+}
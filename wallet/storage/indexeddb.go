@@ -0,0 +1,92 @@
+//go:build js && wasm
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"syscall/js"
+)
+
+const (
+	indexedDBStore       = "wallet"
+	indexedDBSnapshotKey = "snapshot"
+)
+
+// indexedDB is a SnapshotStore that keeps the snapshot
+// in an object store of an IndexedDB database in the browser
+type indexedDB struct {
+	db js.Value
+}
+
+// OpenIndexedDB opens (or creates) the IndexedDB database with the name
+// and loads the wallet saved in it. It is the storage for wallets in the browser.
+func OpenIndexedDB(name string) (*SnapshotDB, error) {
+	factory := js.Global().Get("indexedDB")
+	if factory.IsUndefined() {
+		return nil, errors.New("IndexedDB is not available")
+	}
+
+	request := factory.Call("open", name, 1)
+	upgrade := js.FuncOf(func(this js.Value, args []js.Value) any {
+		db := request.Get("result")
+		if !db.Get("objectStoreNames").Call("contains", indexedDBStore).Bool() {
+			db.Call("createObjectStore", indexedDBStore)
+		}
+		return nil
+	})
+	defer upgrade.Release()
+	request.Set("onupgradeneeded", upgrade)
+
+	db, err := await(request)
+	if err != nil {
+		return nil, fmt.Errorf("error opening IndexedDB '%v': %v", name, err)
+	}
+	return NewSnapshotDB(&indexedDB{db: db})
+}
+
+func (idb *indexedDB) Load() ([]byte, error) {
+	store := idb.db.Call("transaction", indexedDBStore, "readonly").Call("objectStore", indexedDBStore)
+	snapshot, err := await(store.Call("get", indexedDBSnapshotKey))
+	if err != nil {
+		return nil, err
+	}
+	if snapshot.IsUndefined() || snapshot.IsNull() {
+		return nil, nil
+	}
+	return []byte(snapshot.String()), nil
+}
+
+func (idb *indexedDB) Save(snapshot []byte) error {
+	store := idb.db.Call("transaction", indexedDBStore, "readwrite").Call("objectStore", indexedDBStore)
+	_, err := await(store.Call("put", string(snapshot), indexedDBSnapshotKey))
+	return err
+}
+
+// await blocks until the IndexedDB request finishes and returns its result.
+// It needs to be called from a goroutine other than the one running the
+// js event loop, like all the other blocking calls of the wallet.
+func await(request js.Value) (js.Value, error) {
+	done := make(chan error, 1)
+	onSuccess := js.FuncOf(func(this js.Value, args []js.Value) any {
+		done <- nil
+		return nil
+	})
+	defer onSuccess.Release()
+	onError := js.FuncOf(func(this js.Value, args []js.Value) any {
+		errMsg := "request failed"
+		if reqErr := request.Get("error"); !reqErr.IsNull() && !reqErr.IsUndefined() {
+			errMsg = reqErr.Get("message").String()
+		}
+		done <- errors.New(errMsg)
+		return nil
+	})
+	defer onError.Release()
+	request.Set("onsuccess", onSuccess)
+	request.Set("onerror", onError)
+
+	if err := <-done; err != nil {
+		return js.Value{}, err
+	}
+	return request.Get("result"), nil
+}
@@ -0,0 +1,473 @@
+package storage
+
+import (
+	"encoding/hex"
+	"errors"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+)
+
+// MemoryDB is a WalletDB that keeps everything in memory.
+// Nothing is persisted so it is meant for tests or for applications
+// that store the wallet state on their own.
+// Lists are returned in the same order as the BoltDB.
+type MemoryDB struct {
+	mu sync.RWMutex
+
+	mnemonic string
+	seed     []byte
+	// keyed by secret
+	proofs map[string]cashu.Proof
+	// keyed by Y
+	pendingProofs map[string]DBProof
+	// keysets by mint and id
+	keysets      map[string]map[string]crypto.WalletKeyset
+	trustLevels  map[string]TrustLevel
+	mintQuotes   map[string]MintQuote
+	meltQuotes   map[string]MeltQuote
+	operations   map[string]Operation
+	lockedSends  map[string]LockedSend
+	scheduled    map[string]ScheduledPayment
+	transactions map[string]Transaction
+	// keyed by Y
+	quarantined map[string]QuarantinedProof
+	// keyed by keyset id
+	counterLeases map[string]CounterLease
+	restore       map[string]RestoreProgress
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		proofs:        make(map[string]cashu.Proof),
+		pendingProofs: make(map[string]DBProof),
+		keysets:       make(map[string]map[string]crypto.WalletKeyset),
+		trustLevels:   make(map[string]TrustLevel),
+		mintQuotes:    make(map[string]MintQuote),
+		meltQuotes:    make(map[string]MeltQuote),
+		operations:    make(map[string]Operation),
+		lockedSends:   make(map[string]LockedSend),
+		scheduled:     make(map[string]ScheduledPayment),
+		transactions:  make(map[string]Transaction),
+		quarantined:   make(map[string]QuarantinedProof),
+		counterLeases: make(map[string]CounterLease),
+		restore:       make(map[string]RestoreProgress),
+	}
+}
+
+func (db *MemoryDB) Close() error {
+	return nil
+}
+
+func (db *MemoryDB) SaveMnemonicSeed(mnemonic string, seed []byte) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.mnemonic = mnemonic
+	db.seed = slices.Clone(seed)
+}
+
+func (db *MemoryDB) GetMnemonic() string {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return db.mnemonic
+}
+
+func (db *MemoryDB) GetSeed() []byte {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return slices.Clone(db.seed)
+}
+
+func (db *MemoryDB) SaveProofs(proofs cashu.Proofs) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, proof := range proofs {
+		db.proofs[proof.Secret] = proof
+	}
+	return nil
+}
+
+func (db *MemoryDB) GetProofs() cashu.Proofs {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	proofs := cashu.Proofs{}
+	for _, secret := range sortedKeys(db.proofs) {
+		proofs = append(proofs, db.proofs[secret])
+	}
+	return proofs
+}
+
+func (db *MemoryDB) GetProofsByKeysetId(id string) cashu.Proofs {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	proofs := cashu.Proofs{}
+	for _, secret := range sortedKeys(db.proofs) {
+		if db.proofs[secret].Id == id {
+			proofs = append(proofs, db.proofs[secret])
+		}
+	}
+	return proofs
+}
+
+func (db *MemoryDB) DeleteProof(secret string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, ok := db.proofs[secret]; !ok {
+		return ProofNotFound
+	}
+	delete(db.proofs, secret)
+	return nil
+}
+
+func (db *MemoryDB) AddPendingProofs(proofs cashu.Proofs) error {
+	return db.AddPendingProofsByQuoteId(proofs, "")
+}
+
+func (db *MemoryDB) AddPendingProofsByQuoteId(proofs cashu.Proofs, quoteId string) error {
+	dbProofs := make([]DBProof, len(proofs))
+	for i, proof := range proofs {
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			return err
+		}
+		dbProofs[i] = DBProof{
+			Y:           hex.EncodeToString(Y.SerializeCompressed()),
+			Amount:      proof.Amount,
+			Id:          proof.Id,
+			Secret:      proof.Secret,
+			C:           proof.C,
+			DLEQ:        proof.DLEQ,
+			MeltQuoteId: quoteId,
+		}
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, dbProof := range dbProofs {
+		db.pendingProofs[dbProof.Y] = dbProof
+	}
+	return nil
+}
+
+func (db *MemoryDB) GetPendingProofs() []DBProof {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	proofs := []DBProof{}
+	for _, Y := range sortedKeys(db.pendingProofs) {
+		proofs = append(proofs, db.pendingProofs[Y])
+	}
+	return proofs
+}
+
+func (db *MemoryDB) GetPendingProofsByQuoteId(quoteId string) []DBProof {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	proofs := []DBProof{}
+	for _, Y := range sortedKeys(db.pendingProofs) {
+		if db.pendingProofs[Y].MeltQuoteId == quoteId {
+			proofs = append(proofs, db.pendingProofs[Y])
+		}
+	}
+	return proofs
+}
+
+func (db *MemoryDB) DeletePendingProofs(Ys []string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, Y := range Ys {
+		delete(db.pendingProofs, Y)
+	}
+	return nil
+}
+
+func (db *MemoryDB) DeletePendingProofsByQuoteId(quoteId string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for Y, proof := range db.pendingProofs {
+		if proof.MeltQuoteId == quoteId {
+			delete(db.pendingProofs, Y)
+		}
+	}
+	return nil
+}
+
+func (db *MemoryDB) SaveKeyset(keyset *crypto.WalletKeyset) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	mintKeysets, ok := db.keysets[keyset.MintURL]
+	if !ok {
+		mintKeysets = make(map[string]crypto.WalletKeyset)
+		db.keysets[keyset.MintURL] = mintKeysets
+	}
+	mintKeysets[keyset.Id] = copyKeyset(*keyset)
+	return nil
+}
+
+func (db *MemoryDB) GetKeysets() crypto.KeysetsMap {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	keysets := make(crypto.KeysetsMap)
+	for mintURL, mintKeysets := range db.keysets {
+		keysetsList := []crypto.WalletKeyset{}
+		for _, id := range sortedKeys(mintKeysets) {
+			keysetsList = append(keysetsList, copyKeyset(mintKeysets[id]))
+		}
+		keysets[mintURL] = keysetsList
+	}
+	return keysets
+}
+
+func (db *MemoryDB) GetKeyset(keysetId string) *crypto.WalletKeyset {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, mintKeysets := range db.keysets {
+		if keyset, ok := mintKeysets[keysetId]; ok {
+			keyset = copyKeyset(keyset)
+			return &keyset
+		}
+	}
+	return nil
+}
+
+func (db *MemoryDB) IncrementKeysetCounter(keysetId string, num uint32) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, mintKeysets := range db.keysets {
+		if keyset, ok := mintKeysets[keysetId]; ok {
+			keyset.Counter += num
+			mintKeysets[keysetId] = keyset
+			return nil
+		}
+	}
+	return errors.New("keyset does not exist")
+}
+
+func (db *MemoryDB) GetKeysetCounter(keysetId string) uint32 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, mintKeysets := range db.keysets {
+		if keyset, ok := mintKeysets[keysetId]; ok {
+			return keyset.Counter
+		}
+	}
+	return 0
+}
+
+func (db *MemoryDB) SaveMintTrustLevel(mintURL string, level TrustLevel) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.trustLevels[mintURL] = level
+	return nil
+}
+
+func (db *MemoryDB) GetMintTrustLevels() map[string]TrustLevel {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return maps.Clone(db.trustLevels)
+}
+
+func (db *MemoryDB) SaveMintQuote(quote MintQuote) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.mintQuotes[quote.QuoteId] = quote
+	return nil
+}
+
+func (db *MemoryDB) GetMintQuotes() []MintQuote {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return sortedValues(db.mintQuotes)
+}
+
+func (db *MemoryDB) GetMintQuoteById(id string) *MintQuote {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	quote, ok := db.mintQuotes[id]
+	if !ok {
+		return nil
+	}
+	return &quote
+}
+
+func (db *MemoryDB) DeleteMintQuote(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.mintQuotes, id)
+	return nil
+}
+
+func (db *MemoryDB) SaveMeltQuote(quote MeltQuote) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.meltQuotes[quote.QuoteId] = quote
+	return nil
+}
+
+func (db *MemoryDB) GetMeltQuotes() []MeltQuote {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return sortedValues(db.meltQuotes)
+}
+
+func (db *MemoryDB) GetMeltQuoteById(id string) *MeltQuote {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	quote, ok := db.meltQuotes[id]
+	if !ok {
+		return nil
+	}
+	return &quote
+}
+
+func (db *MemoryDB) DeleteMeltQuote(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.meltQuotes, id)
+	return nil
+}
+
+func (db *MemoryDB) SaveOperation(operation Operation) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.operations[operation.Id] = operation
+	return nil
+}
+
+func (db *MemoryDB) GetOperations() []Operation {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return sortedValues(db.operations)
+}
+
+func (db *MemoryDB) DeleteOperation(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.operations, id)
+	return nil
+}
+
+func (db *MemoryDB) SaveLockedSend(lockedSend LockedSend) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.lockedSends[lockedSend.Id] = lockedSend
+	return nil
+}
+
+func (db *MemoryDB) GetLockedSends() []LockedSend {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return sortedValues(db.lockedSends)
+}
+
+func (db *MemoryDB) DeleteLockedSend(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.lockedSends, id)
+	return nil
+}
+
+func (db *MemoryDB) SaveTransaction(transaction Transaction) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.transactions[transaction.Id] = transaction
+	return nil
+}
+
+func (db *MemoryDB) GetTransactions() []Transaction {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return sortedValues(db.transactions)
+}
+
+func (db *MemoryDB) SaveScheduledPayment(payment ScheduledPayment) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.scheduled[payment.Id] = payment
+	return nil
+}
+
+func (db *MemoryDB) GetScheduledPayments() []ScheduledPayment {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return sortedValues(db.scheduled)
+}
+
+func (db *MemoryDB) DeleteScheduledPayment(id string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	delete(db.scheduled, id)
+	return nil
+}
+
+func (db *MemoryDB) QuarantineProofs(proofs []QuarantinedProof) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, proof := range proofs {
+		db.quarantined[proof.Y] = proof
+		delete(db.proofs, proof.Proof.Secret)
+	}
+	return nil
+}
+
+func (db *MemoryDB) GetQuarantinedProofs() []QuarantinedProof {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return sortedValues(db.quarantined)
+}
+
+func (db *MemoryDB) SaveCounterLease(lease CounterLease) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.counterLeases[lease.KeysetId] = lease
+	return nil
+}
+
+func (db *MemoryDB) GetCounterLease(keysetId string) *CounterLease {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	lease, ok := db.counterLeases[keysetId]
+	if !ok {
+		return nil
+	}
+	return &lease
+}
+
+func (db *MemoryDB) SaveRestoreProgress(progress RestoreProgress) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.restore[progress.KeysetId] = progress
+	return nil
+}
+
+func (db *MemoryDB) GetRestoreProgress() []RestoreProgress {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return sortedValues(db.restore)
+}
+
+// copyKeyset so callers can't modify the public keys of a saved keyset
+func copyKeyset(keyset crypto.WalletKeyset) crypto.WalletKeyset {
+	keyset.PublicKeys = maps.Clone(keyset.PublicKeys)
+	return keyset
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// sortedValues returns nil if the map is empty, same as the BoltDB
+func sortedValues[V any](m map[string]V) []V {
+	var values []V
+	for _, k := range sortedKeys(m) {
+		values = append(values, m[k])
+	}
+	return values
+}
@@ -0,0 +1,149 @@
+//go:build !js
+
+package storage
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/elnosh/gonuts/crypto"
+)
+
+// MemoryDB should return the same as the BoltDB after the same changes
+func TestMemoryDB(t *testing.T) {
+	boltDB, err := InitBolt(t.TempDir())
+	if err != nil {
+		t.Fatalf("error setting up db: %v", err)
+	}
+	defer boltDB.Close()
+	memDB := NewMemoryDB()
+	dbs := []WalletDB{boltDB, memDB}
+
+	keyset := generateKeyset("http://localhost:3338")
+	otherKeyset := generateKeyset("http://localhost:3339")
+	proofs := generateRandomProofs(keyset.Id, 20)
+	pendingProofs := generateRandomProofs(otherKeyset.Id, 10)
+	mintQuotes := generateRandomMintQuotes(5)
+	meltQuotes := generateRandomMeltQuotes(5)
+
+	for _, db := range dbs {
+		db.SaveMnemonicSeed("mnemonic", []byte("seed"))
+		if err := db.SaveProofs(proofs); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.DeleteProof(proofs[0].Secret); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.DeleteProof("notfound"); err != ProofNotFound {
+			t.Fatalf("expected error '%v' but got '%v'", ProofNotFound, err)
+		}
+		if err := db.AddPendingProofs(pendingProofs[:5]); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.AddPendingProofsByQuoteId(pendingProofs[5:], "quote1"); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.DeletePendingProofs([]string{toDBProofs(pendingProofs[:1], "")[0].Y}); err != nil {
+			t.Fatal(err)
+		}
+		for _, keyset := range []crypto.WalletKeyset{keyset, otherKeyset} {
+			if err := db.SaveKeyset(&keyset); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := db.IncrementKeysetCounter(keyset.Id, 7); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.IncrementKeysetCounter("notfound", 7); err == nil {
+			t.Fatal("expected error incrementing counter of keyset that does not exist")
+		}
+		lease := CounterLease{KeysetId: keyset.Id, Mint: keyset.MintURL, Start: 7, End: 107, CheckedAt: 1700000000}
+		if err := db.SaveCounterLease(lease); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SaveMintTrustLevel(keyset.MintURL, AutoAdded); err != nil {
+			t.Fatal(err)
+		}
+		quarantined := []QuarantinedProof{
+			{Y: "02aa", Mint: keyset.MintURL, Proof: proofs[1], State: "SPENT", QuarantinedAt: 1700000000},
+			{Y: "02bb", Mint: keyset.MintURL, Proof: proofs[2], State: "SPENT", QuarantinedAt: 1700000000},
+		}
+		if err := db.QuarantineProofs(quarantined); err != nil {
+			t.Fatal(err)
+		}
+		scheduled := []ScheduledPayment{
+			{Id: "payment2", Kind: ScheduledMelt, Mint: keyset.MintURL, Amount: 21, Target: "alice@example.com", At: 1700000000},
+			{Id: "payment1", Kind: ScheduledSend, Mint: keyset.MintURL, Amount: 100, At: 1700000000, Interval: 3600},
+		}
+		transactions := []Transaction{
+			{Id: "tx2", Kind: SendTransaction, Mint: keyset.MintURL, Amount: 21, Fee: 1, CreatedAt: 1700000100},
+			{Id: "tx1", Kind: MintTransaction, Mint: keyset.MintURL, Amount: 100, Reference: "quote1", CreatedAt: 1700000000},
+		}
+		for _, transaction := range transactions {
+			if err := db.SaveTransaction(transaction); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, payment := range scheduled {
+			if err := db.SaveScheduledPayment(payment); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for i := range mintQuotes {
+			if err := db.SaveMintQuote(mintQuotes[i]); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.SaveMeltQuote(meltQuotes[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// saved keyset can't be changed from outside the db
+	keyset.Counter = 100
+	if memDB.GetKeysetCounter(keyset.Id) != 7 {
+		t.Fatalf("expected counter of 7 but got %v", memDB.GetKeysetCounter(keyset.Id))
+	}
+
+	results := func(db WalletDB) []any {
+		return []any{
+			db.GetSeed(),
+			db.GetMnemonic(),
+			db.GetProofs(),
+			db.GetProofsByKeysetId(keyset.Id),
+			db.GetPendingProofs(),
+			db.GetPendingProofsByQuoteId("quote1"),
+			db.GetKeysets(),
+			db.GetKeyset(otherKeyset.Id),
+			db.GetKeysetCounter(keyset.Id),
+			db.GetCounterLease(keyset.Id),
+			db.GetCounterLease(otherKeyset.Id),
+			db.GetMintTrustLevels(),
+			db.GetMintQuotes(),
+			db.GetMintQuoteById(mintQuotes[2].QuoteId),
+			db.GetMintQuoteById("notfound"),
+			db.GetMeltQuotes(),
+			db.GetMeltQuoteById(meltQuotes[3].QuoteId),
+			db.GetOperations(),
+			db.GetLockedSends(),
+			db.GetScheduledPayments(),
+			db.GetTransactions(),
+			db.GetQuarantinedProofs(),
+		}
+	}
+	boltResults := results(boltDB)
+	memResults := results(memDB)
+	for i := range boltResults {
+		if !reflect.DeepEqual(boltResults[i], memResults[i]) {
+			t.Fatalf("result %v from memory db does not match bolt db.\nexpected: %+v\n\ngot: %+v",
+				i, boltResults[i], memResults[i])
+		}
+	}
+
+	if err := memDB.DeletePendingProofsByQuoteId("quote1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(memDB.GetPendingProofs()) != 4 {
+		t.Fatalf("expected 4 pending proofs but got %v", len(memDB.GetPendingProofs()))
+	}
+}
@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+)
+
+// SnapshotStore keeps the snapshot of a SnapshotDB
+type SnapshotStore interface {
+	// Load returns the last snapshot saved or nil if there is none
+	Load() ([]byte, error)
+	Save(snapshot []byte) error
+}
+
+// memoryDB is embedded in the SnapshotDB without
+// exporting it so that it can't be changed without saving
+type memoryDB = MemoryDB
+
+// SnapshotDB is a WalletDB kept in memory that saves a snapshot of the
+// whole wallet to its store after every change. It is meant for platforms
+// where the BoltDB can't be used (i.e the browser with OpenIndexedDB),
+// since the wallet state is small enough to save it all every time.
+//
+// If saving the snapshot fails, the change is returned with the error but
+// is kept in memory and saved with the next change. SaveMnemonicSeed can't
+// return the error so it is returned by the next change or by Close.
+type SnapshotDB struct {
+	*memoryDB
+	store SnapshotStore
+
+	// snapshots are saved one at a time so that an older
+	// snapshot does not overwrite a newer one
+	saveMu  sync.Mutex
+	saveErr error
+}
+
+// NewSnapshotDB loads the wallet from the last snapshot in the store
+func NewSnapshotDB(store SnapshotStore) (*SnapshotDB, error) {
+	snapshot, err := store.Load()
+	if err != nil {
+		return nil, fmt.Errorf("error loading wallet snapshot: %v", err)
+	}
+	db := NewMemoryDB()
+	if len(snapshot) > 0 {
+		db, err = memoryDBFromSnapshot(snapshot)
+		if err != nil {
+			return nil, fmt.Errorf("error loading wallet snapshot: %v", err)
+		}
+	}
+	return &SnapshotDB{memoryDB: db, store: store}, nil
+}
+
+func (db *SnapshotDB) save(err error) error {
+	if err != nil {
+		return err
+	}
+
+	db.saveMu.Lock()
+	defer db.saveMu.Unlock()
+	snapshot, err := db.memoryDB.snapshot()
+	if err == nil {
+		err = db.store.Save(snapshot)
+	}
+	if err != nil {
+		db.saveErr = fmt.Errorf("error saving wallet snapshot: %v", err)
+	} else {
+		db.saveErr = nil
+	}
+	return db.saveErr
+}
+
+func (db *SnapshotDB) Close() error {
+	db.saveMu.Lock()
+	defer db.saveMu.Unlock()
+	return db.saveErr
+}
+
+func (db *SnapshotDB) SaveMnemonicSeed(mnemonic string, seed []byte) {
+	db.memoryDB.SaveMnemonicSeed(mnemonic, seed)
+	db.save(nil)
+}
+
+func (db *SnapshotDB) SaveProofs(proofs cashu.Proofs) error {
+	return db.save(db.memoryDB.SaveProofs(proofs))
+}
+
+func (db *SnapshotDB) DeleteProof(secret string) error {
+	return db.save(db.memoryDB.DeleteProof(secret))
+}
+
+func (db *SnapshotDB) AddPendingProofs(proofs cashu.Proofs) error {
+	return db.save(db.memoryDB.AddPendingProofs(proofs))
+}
+
+func (db *SnapshotDB) AddPendingProofsByQuoteId(proofs cashu.Proofs, quoteId string) error {
+	return db.save(db.memoryDB.AddPendingProofsByQuoteId(proofs, quoteId))
+}
+
+func (db *SnapshotDB) DeletePendingProofs(Ys []string) error {
+	return db.save(db.memoryDB.DeletePendingProofs(Ys))
+}
+
+func (db *SnapshotDB) DeletePendingProofsByQuoteId(quoteId string) error {
+	return db.save(db.memoryDB.DeletePendingProofsByQuoteId(quoteId))
+}
+
+func (db *SnapshotDB) SaveKeyset(keyset *crypto.WalletKeyset) error {
+	return db.save(db.memoryDB.SaveKeyset(keyset))
+}
+
+func (db *SnapshotDB) IncrementKeysetCounter(keysetId string, num uint32) error {
+	return db.save(db.memoryDB.IncrementKeysetCounter(keysetId, num))
+}
+
+func (db *SnapshotDB) SaveCounterLease(lease CounterLease) error {
+	return db.save(db.memoryDB.SaveCounterLease(lease))
+}
+
+func (db *SnapshotDB) SaveRestoreProgress(progress RestoreProgress) error {
+	return db.save(db.memoryDB.SaveRestoreProgress(progress))
+}
+
+func (db *SnapshotDB) SaveMintTrustLevel(mint string, level TrustLevel) error {
+	return db.save(db.memoryDB.SaveMintTrustLevel(mint, level))
+}
+
+func (db *SnapshotDB) SaveMintQuote(quote MintQuote) error {
+	return db.save(db.memoryDB.SaveMintQuote(quote))
+}
+
+func (db *SnapshotDB) DeleteMintQuote(id string) error {
+	return db.save(db.memoryDB.DeleteMintQuote(id))
+}
+
+func (db *SnapshotDB) SaveMeltQuote(quote MeltQuote) error {
+	return db.save(db.memoryDB.SaveMeltQuote(quote))
+}
+
+func (db *SnapshotDB) DeleteMeltQuote(id string) error {
+	return db.save(db.memoryDB.DeleteMeltQuote(id))
+}
+
+func (db *SnapshotDB) SaveOperation(operation Operation) error {
+	return db.save(db.memoryDB.SaveOperation(operation))
+}
+
+func (db *SnapshotDB) DeleteOperation(id string) error {
+	return db.save(db.memoryDB.DeleteOperation(id))
+}
+
+func (db *SnapshotDB) SaveLockedSend(lockedSend LockedSend) error {
+	return db.save(db.memoryDB.SaveLockedSend(lockedSend))
+}
+
+func (db *SnapshotDB) DeleteLockedSend(id string) error {
+	return db.save(db.memoryDB.DeleteLockedSend(id))
+}
+
+func (db *SnapshotDB) SaveTransaction(tx Transaction) error {
+	return db.save(db.memoryDB.SaveTransaction(tx))
+}
+
+func (db *SnapshotDB) SaveScheduledPayment(payment ScheduledPayment) error {
+	return db.save(db.memoryDB.SaveScheduledPayment(payment))
+}
+
+func (db *SnapshotDB) DeleteScheduledPayment(id string) error {
+	return db.save(db.memoryDB.DeleteScheduledPayment(id))
+}
+
+func (db *SnapshotDB) QuarantineProofs(proofs []QuarantinedProof) error {
+	return db.save(db.memoryDB.QuarantineProofs(proofs))
+}
+
+// memorySnapshot is the encoding of the state of a MemoryDB
+type memorySnapshot struct {
+	Mnemonic      string                `json:"mnemonic"`
+	Seed          []byte                `json:"seed"`
+	Proofs        cashu.Proofs          `json:"proofs"`
+	PendingProofs []DBProof             `json:"pending_proofs"`
+	Keysets       []crypto.WalletKeyset `json:"keysets"`
+	TrustLevels   map[string]TrustLevel `json:"trust_levels"`
+	MintQuotes    []MintQuote           `json:"mint_quotes"`
+	MeltQuotes    []MeltQuote           `json:"melt_quotes"`
+	Operations    []Operation           `json:"operations"`
+	LockedSends   []LockedSend          `json:"locked_sends"`
+	Scheduled     []ScheduledPayment    `json:"scheduled_payments"`
+	Transactions  []Transaction         `json:"transactions"`
+	Quarantined   []QuarantinedProof    `json:"quarantined_proofs"`
+	CounterLeases []CounterLease        `json:"counter_leases"`
+	Restore       []RestoreProgress     `json:"restore_progress"`
+}
+
+func (db *MemoryDB) snapshot() ([]byte, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	snapshot := memorySnapshot{
+		Mnemonic:      db.mnemonic,
+		Seed:          db.seed,
+		Proofs:        mapValues(db.proofs),
+		PendingProofs: mapValues(db.pendingProofs),
+		TrustLevels:   db.trustLevels,
+		MintQuotes:    mapValues(db.mintQuotes),
+		MeltQuotes:    mapValues(db.meltQuotes),
+		Operations:    mapValues(db.operations),
+		LockedSends:   mapValues(db.lockedSends),
+		Scheduled:     mapValues(db.scheduled),
+		Transactions:  mapValues(db.transactions),
+		Quarantined:   mapValues(db.quarantined),
+		CounterLeases: mapValues(db.counterLeases),
+		Restore:       mapValues(db.restore),
+	}
+	for _, mintKeysets := range db.keysets {
+		snapshot.Keysets = append(snapshot.Keysets, mapValues(mintKeysets)...)
+	}
+	return json.Marshal(snapshot)
+}
+
+// memoryDBFromSnapshot creates a MemoryDB with the state in the snapshot
+func memoryDBFromSnapshot(data []byte) (*MemoryDB, error) {
+	var snapshot memorySnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, err
+	}
+	restored := NewMemoryDB()
+	restored.mnemonic = snapshot.Mnemonic
+	restored.seed = snapshot.Seed
+	for _, proof := range snapshot.Proofs {
+		restored.proofs[proof.Secret] = proof
+	}
+	for _, proof := range snapshot.PendingProofs {
+		restored.pendingProofs[proof.Y] = proof
+	}
+	for _, keyset := range snapshot.Keysets {
+		if _, ok := restored.keysets[keyset.MintURL]; !ok {
+			restored.keysets[keyset.MintURL] = make(map[string]crypto.WalletKeyset)
+		}
+		restored.keysets[keyset.MintURL][keyset.Id] = keyset
+	}
+	for mint, level := range snapshot.TrustLevels {
+		restored.trustLevels[mint] = level
+	}
+	for _, quote := range snapshot.MintQuotes {
+		restored.mintQuotes[quote.QuoteId] = quote
+	}
+	for _, quote := range snapshot.MeltQuotes {
+		restored.meltQuotes[quote.QuoteId] = quote
+	}
+	for _, operation := range snapshot.Operations {
+		restored.operations[operation.Id] = operation
+	}
+	for _, lockedSend := range snapshot.LockedSends {
+		restored.lockedSends[lockedSend.Id] = lockedSend
+	}
+	for _, payment := range snapshot.Scheduled {
+		restored.scheduled[payment.Id] = payment
+	}
+	for _, tx := range snapshot.Transactions {
+		restored.transactions[tx.Id] = tx
+	}
+	for _, proof := range snapshot.Quarantined {
+		restored.quarantined[proof.Y] = proof
+	}
+	for _, lease := range snapshot.CounterLeases {
+		restored.counterLeases[lease.KeysetId] = lease
+	}
+	for _, progress := range snapshot.Restore {
+		restored.restore[progress.KeysetId] = progress
+	}
+
+	return restored, nil
+}
+
+func mapValues[K comparable, V any](m map[K]V) []V {
+	values := make([]V, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values
+}
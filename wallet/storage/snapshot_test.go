@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testSnapshotStore struct {
+	snapshot []byte
+	err      error
+}
+
+func (s *testSnapshotStore) Load() ([]byte, error) { return s.snapshot, nil }
+
+func (s *testSnapshotStore) Save(snapshot []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.snapshot = snapshot
+	return nil
+}
+
+// the wallet loaded from the last snapshot should be the same as the one that saved it
+func TestSnapshotDBReload(t *testing.T) {
+	store := &testSnapshotStore{}
+	db, err := NewSnapshotDB(store)
+	if err != nil {
+		t.Fatalf("error setting up db: %v", err)
+	}
+
+	keyset := generateKeyset("http://localhost:3338")
+	proofs := generateRandomProofs(keyset.Id, 10)
+	mintQuotes := generateRandomMintQuotes(3)
+	meltQuotes := generateRandomMeltQuotes(3)
+
+	db.SaveMnemonicSeed("mnemonic", []byte("seed"))
+	if err := db.SaveKeyset(&keyset); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.IncrementKeysetCounter(keyset.Id, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveCounterLease(CounterLease{KeysetId: keyset.Id, Mint: keyset.MintURL, Start: 10, End: 110}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveProofs(proofs[:7]); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AddPendingProofsByQuoteId(proofs[7:], meltQuotes[0].QuoteId); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SaveMintTrustLevel(keyset.MintURL, Trusted); err != nil {
+		t.Fatal(err)
+	}
+	for i := range mintQuotes {
+		if err := db.SaveMintQuote(mintQuotes[i]); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.SaveMeltQuote(meltQuotes[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SaveTransaction(Transaction{Id: "tx1", Kind: MintTransaction, Mint: keyset.MintURL, Amount: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QuarantineProofs([]QuarantinedProof{{Y: "02aa", Mint: keyset.MintURL, Proof: proofs[0], State: "SPENT"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewSnapshotDB(store)
+	if err != nil {
+		t.Fatalf("error reloading db: %v", err)
+	}
+
+	results := func(db WalletDB) []any {
+		return []any{
+			db.GetSeed(),
+			db.GetMnemonic(),
+			db.GetProofs(),
+			db.GetPendingProofsByQuoteId(meltQuotes[0].QuoteId),
+			db.GetKeysets(),
+			db.GetKeysetCounter(keyset.Id),
+			db.GetCounterLease(keyset.Id),
+			db.GetMintTrustLevels(),
+			db.GetMintQuotes(),
+			db.GetMeltQuotes(),
+			db.GetTransactions(),
+			db.GetQuarantinedProofs(),
+		}
+	}
+	expected := results(db)
+	got := results(reloaded)
+	for i := range expected {
+		if !reflect.DeepEqual(expected[i], got[i]) {
+			t.Fatalf("result %v from reloaded db does not match.\nexpected: %+v\n\ngot: %+v",
+				i, expected[i], got[i])
+		}
+	}
+}
+
+func TestSnapshotDBSaveError(t *testing.T) {
+	store := &testSnapshotStore{}
+	db, err := NewSnapshotDB(store)
+	if err != nil {
+		t.Fatalf("error setting up db: %v", err)
+	}
+
+	keyset := generateKeyset("http://localhost:3338")
+	proofs := generateRandomProofs(keyset.Id, 5)
+
+	store.err = errors.New("quota exceeded")
+	if err := db.SaveProofs(proofs); err == nil {
+		t.Fatal("expected error saving snapshot")
+	}
+	// change is kept in memory and returned by Close until the next save
+	if len(db.GetProofs()) != 5 {
+		t.Fatalf("expected 5 proofs but got %v", len(db.GetProofs()))
+	}
+	if err := db.Close(); err == nil {
+		t.Fatal("expected save error from Close")
+	}
+
+	store.err = nil
+	if err := db.DeleteProof(proofs[0].Secret); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("unexpected error from Close: %v", err)
+	}
+	reloaded, err := NewSnapshotDB(store)
+	if err != nil {
+		t.Fatalf("error reloading db: %v", err)
+	}
+	if len(reloaded.GetProofs()) != 4 {
+		t.Fatalf("expected 4 proofs but got %v", len(reloaded.GetProofs()))
+	}
+}
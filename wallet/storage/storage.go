@@ -1,12 +1,18 @@
 package storage
 
 import (
+	"errors"
+
 	"github.com/elnosh/gonuts/cashu"
 	"github.com/elnosh/gonuts/cashu/nuts/nut04"
 	"github.com/elnosh/gonuts/cashu/nuts/nut05"
 	"github.com/elnosh/gonuts/crypto"
 )
 
+var (
+	ProofNotFound = errors.New("proof not found")
+)
+
 type QuoteType int
 
 const (
@@ -25,16 +31,144 @@ func (quote QuoteType) String() string {
 	}
 }
 
+// TrustLevel of a mint in the wallet
+type TrustLevel int
+
+const (
+	// Trusted mints were explicitly added by the user.
+	Trusted TrustLevel = iota
+	// AutoAdded mints were added when receiving tokens from them.
+	AutoAdded
+)
+
+func (level TrustLevel) String() string {
+	switch level {
+	case Trusted:
+		return "trusted"
+	case AutoAdded:
+		return "auto-added"
+	default:
+		return "unknown"
+	}
+}
+
+// OperationKind of a journaled operation
+type OperationKind int
+
+const (
+	SwapOperation OperationKind = iota + 1
+	MeltOperation
+	ReceiveOperation
+)
+
+func (kind OperationKind) String() string {
+	switch kind {
+	case SwapOperation:
+		return "swap"
+	case MeltOperation:
+		return "melt"
+	case ReceiveOperation:
+		return "receive"
+	default:
+		return "unknown"
+	}
+}
+
+// ScheduledPaymentKind is how a scheduled payment is made
+type ScheduledPaymentKind int
+
+const (
+	// ScheduledSend creates a token, optionally locked to a public key
+	ScheduledSend ScheduledPaymentKind = iota + 1
+	// ScheduledMelt pays a lightning address with a melt
+	ScheduledMelt
+)
+
+func (kind ScheduledPaymentKind) String() string {
+	switch kind {
+	case ScheduledSend:
+		return "send"
+	case ScheduledMelt:
+		return "melt"
+	default:
+		return "unknown"
+	}
+}
+
+// TransactionKind is the operation that changed the balance of a mint in the wallet
+type TransactionKind int
+
+const (
+	MintTransaction TransactionKind = iota + 1
+	MeltTransaction
+	SendTransaction
+	ReceiveTransaction
+	// proofs moved from another mint of the wallet
+	TransferInTransaction
+	// proofs moved to another mint of the wallet
+	TransferOutTransaction
+	// unspent proofs of tokens sent that were taken back
+	ReclaimTransaction
+	// only fees were paid (i.e refreshing proofs)
+	FeeTransaction
+)
+
+func (kind TransactionKind) String() string {
+	switch kind {
+	case MintTransaction:
+		return "mint"
+	case MeltTransaction:
+		return "melt"
+	case SendTransaction:
+		return "send"
+	case ReceiveTransaction:
+		return "receive"
+	case TransferInTransaction:
+		return "transfer in"
+	case TransferOutTransaction:
+		return "transfer out"
+	case ReclaimTransaction:
+		return "reclaim"
+	case FeeTransaction:
+		return "fee"
+	default:
+		return "unknown"
+	}
+}
+
+// Incoming reports whether the transactions of the kind add to the balance
+func (kind TransactionKind) Incoming() bool {
+	switch kind {
+	case MintTransaction, ReceiveTransaction, TransferInTransaction, ReclaimTransaction:
+		return true
+	default:
+		return false
+	}
+}
+
+// WalletDB is the storage of the wallet. BoltDB and MemoryDB implement it
+// and other stores can be checked against the same behavior with the
+// tests in the storagetest package.
+//
+// Implementations need to be safe for concurrent use. Getters return nil
+// (or the zero value) when nothing is found instead of an error and lists
+// can be in any order. Saving an item with the id of one already saved
+// replaces it, and deleting an id that is not saved is not an error unless
+// noted otherwise.
 type WalletDB interface {
 	SaveMnemonicSeed(string, []byte)
 	GetSeed() []byte
 	GetMnemonic() string
 
+	// proofs are keyed by their secret. DeleteProof
+	// returns ProofNotFound if the proof is not saved
 	SaveProofs(cashu.Proofs) error
 	GetProofs() cashu.Proofs
 	GetProofsByKeysetId(string) cashu.Proofs
 	DeleteProof(string) error
 
+	// pending proofs are keyed by their Y (hex of the compressed
+	// point) and can be tied to the id of a melt quote
 	AddPendingProofs(cashu.Proofs) error
 	AddPendingProofsByQuoteId(cashu.Proofs, string) error
 	GetPendingProofs() []DBProof
@@ -42,19 +176,54 @@ type WalletDB interface {
 	DeletePendingProofs([]string) error
 	DeletePendingProofsByQuoteId(string) error
 
+	// keysets are grouped by mint in GetKeysets. Incrementing
+	// the counter of a keyset that is not saved is an error
 	SaveKeyset(*crypto.WalletKeyset) error
 	GetKeysets() crypto.KeysetsMap
 	GetKeyset(string) *crypto.WalletKeyset
 	IncrementKeysetCounter(string, uint32) error
 	GetKeysetCounter(string) uint32
 
+	// SaveCounterLease replaces the lease of the keyset
+	SaveCounterLease(CounterLease) error
+	GetCounterLease(string) *CounterLease
+
+	// restore progress is keyed by keyset id
+	SaveRestoreProgress(RestoreProgress) error
+	GetRestoreProgress() []RestoreProgress
+
+	SaveMintTrustLevel(string, TrustLevel) error
+	GetMintTrustLevels() map[string]TrustLevel
+
 	SaveMintQuote(MintQuote) error
 	GetMintQuotes() []MintQuote
 	GetMintQuoteById(string) *MintQuote
+	DeleteMintQuote(string) error
 
 	SaveMeltQuote(MeltQuote) error
 	GetMeltQuotes() []MeltQuote
 	GetMeltQuoteById(string) *MeltQuote
+	DeleteMeltQuote(string) error
+
+	SaveOperation(Operation) error
+	GetOperations() []Operation
+	DeleteOperation(string) error
+
+	SaveLockedSend(LockedSend) error
+	GetLockedSends() []LockedSend
+	DeleteLockedSend(string) error
+
+	SaveTransaction(Transaction) error
+	GetTransactions() []Transaction
+
+	SaveScheduledPayment(ScheduledPayment) error
+	GetScheduledPayments() []ScheduledPayment
+	DeleteScheduledPayment(string) error
+
+	// QuarantineProofs removes the proofs from the wallet proofs
+	// and keeps them apart so that they are not used.
+	QuarantineProofs([]QuarantinedProof) error
+	GetQuarantinedProofs() []QuarantinedProof
 
 	Close() error
 }
@@ -70,6 +239,124 @@ type DBProof struct {
 	MeltQuoteId string `json:"quote_id"`
 }
 
+// CounterLease is a range of counters of a keyset that were checked to not
+// have been used by another device with the same seed. The wallet checks
+// the counters again when it gets close to the end of the lease.
+type CounterLease struct {
+	KeysetId string `json:"keyset_id"`
+	Mint     string `json:"mint"`
+	Start    uint32 `json:"start"`
+	End      uint32 `json:"end"`
+	// time the counters were checked with the mint
+	CheckedAt int64 `json:"checked_at"`
+}
+
+// RestoreProgress is how far the restore of a keyset from the seed got. It
+// is saved after each batch of outputs scanned so that a restore that was
+// interrupted can be resumed.
+type RestoreProgress struct {
+	KeysetId string `json:"keyset_id"`
+	Mint     string `json:"mint"`
+	// counter of the next batch to scan and consecutive batches without
+	// signatures before it
+	Counter      uint32 `json:"counter"`
+	EmptyBatches int    `json:"empty_batches"`
+	// one after the highest counter with a signature found so far
+	NextCounter uint32 `json:"next_counter"`
+	// amount of the unspent proofs restored so far
+	Restored uint64 `json:"restored"`
+	Done     bool   `json:"done"`
+}
+
+// Operation is a journal entry saved before making the requests of a
+// multi-step operation to the mint. It has what is needed to roll the
+// operation back or forward if it does not complete.
+type Operation struct {
+	Id   string        `json:"id"`
+	Kind OperationKind `json:"kind"`
+	Mint string        `json:"mint"`
+	// proofs used as inputs in the operation
+	Inputs cashu.Proofs `json:"inputs"`
+	// outputs and the secrets and blinding factors (hex) to unblind them
+	Outputs cashu.BlindedMessages `json:"outputs"`
+	Secrets []string              `json:"secrets"`
+	Rs      []string              `json:"rs"`
+	// keyset of the outputs and the value its counter
+	// needs to be at once the outputs have been signed
+	KeysetId   string `json:"keyset_id"`
+	CounterEnd uint32 `json:"counter_end"`
+	// set for melt operations
+	QuoteId   string `json:"quote_id,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// LockedSend are proofs locked to a spending condition (P2PK or HTLC)
+// that the wallet sent. They are kept so they can be exported or
+// reclaimed later while they are unspent.
+type LockedSend struct {
+	Id        string       `json:"id"`
+	Mint      string       `json:"mint"`
+	Proofs    cashu.Proofs `json:"proofs"`
+	CreatedAt int64        `json:"created_at"`
+}
+
+// Transaction is an operation that changed the balance of a mint in the wallet
+type Transaction struct {
+	Id   string          `json:"id"`
+	Kind TransactionKind `json:"kind"`
+	Mint string          `json:"mint"`
+	// amount paid or received. The fees are paid on top of the amount for
+	// outgoing transactions and taken from it for incoming transactions.
+	Amount uint64 `json:"amount"`
+	Fee    uint64 `json:"fee"`
+	// quote id for mints and melts, mint of the token for receives
+	// swapped to the wallet's mint or the other mint for transfers
+	Reference string `json:"reference,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// Net is the change in the balance of the mint from the transaction
+func (tx Transaction) Net() int64 {
+	if tx.Kind.Incoming() {
+		return int64(tx.Amount) - int64(tx.Fee)
+	}
+	return -int64(tx.Amount + tx.Fee)
+}
+
+// ScheduledPayment is a payment the wallet makes at a future time.
+// Recurring payments are made again every interval after each run.
+type ScheduledPayment struct {
+	Id     string               `json:"id"`
+	Kind   ScheduledPaymentKind `json:"kind"`
+	Mint   string               `json:"mint"`
+	Amount uint64               `json:"amount"`
+	// hex public key to lock the token to for sends (optional)
+	// or the lightning address to pay for melts
+	Target string `json:"target,omitempty"`
+	// unix time the payment is scheduled for
+	At int64 `json:"at"`
+	// seconds between recurring payments. 0 if it is made once
+	Interval int64 `json:"interval,omitempty"`
+	// failed attempts of the current run, the unix time
+	// of the next attempt and the last error
+	Attempts  int    `json:"attempts,omitempty"`
+	RetryAt   int64  `json:"retry_at,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// QuarantinedProof is a proof held by the wallet that the mint reported
+// as spent without the wallet spending it (i.e the seed is being used by
+// another wallet or a bug). It is kept apart so that it is not used again.
+type QuarantinedProof struct {
+	Y     string      `json:"y"`
+	Mint  string      `json:"mint"`
+	Proof cashu.Proof `json:"proof"`
+	// state reported by the mint
+	State         string `json:"state"`
+	QuarantinedAt int64  `json:"quarantined_at"`
+}
+
 type MintQuote struct {
 	QuoteId        string
 	Mint           string
@@ -81,6 +368,10 @@ type MintQuote struct {
 	CreatedAt      int64
 	SettledAt      int64
 	QuoteExpiry    uint64
+	// memo of the invoice requested from the mint
+	Description string
+	// renew the quote before it expires if it has not been paid
+	Renew bool
 }
 
 type MeltQuote struct {
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"encoding/hex"
+	"math/rand/v2"
+	"slices"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/crypto"
+)
+
+func generateRandomString(length int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	b := make([]byte, length)
+	for i := range b {
+		b[i] = letters[rand.IntN(len(letters))]
+	}
+	return string(b)
+}
+
+func generateRandomProofs(keysetId string, num int) cashu.Proofs {
+	proofs := make(cashu.Proofs, num)
+
+	for i := 0; i < num; i++ {
+		proof := cashu.Proof{
+			Amount: 21,
+			Id:     keysetId,
+			Secret: generateRandomString(64),
+			C:      generateRandomString(64),
+		}
+		proofs[i] = proof
+	}
+
+	return proofs
+}
+
+func toDBProofs(proofs cashu.Proofs, quoteId string) []DBProof {
+	dbProofs := make([]DBProof, len(proofs))
+
+	for i, proof := range proofs {
+		Y, _ := crypto.HashToCurve([]byte(proof.Secret))
+		Yhex := hex.EncodeToString(Y.SerializeCompressed())
+
+		dbProof := DBProof{
+			Y:           Yhex,
+			Amount:      proof.Amount,
+			Id:          proof.Id,
+			Secret:      proof.Secret,
+			C:           proof.C,
+			DLEQ:        proof.DLEQ,
+			MeltQuoteId: quoteId,
+		}
+		dbProofs[i] = dbProof
+	}
+
+	return dbProofs
+}
+
+func sortProofs(proofs cashu.Proofs) {
+	slices.SortFunc(proofs, func(a, b cashu.Proof) int {
+		return strings.Compare(a.Secret, b.Secret)
+	})
+}
+
+func sortDBProofs(proofs []DBProof) {
+	slices.SortFunc(proofs, func(a, b DBProof) int {
+		return strings.Compare(a.Secret, b.Secret)
+	})
+}
+
+func generateKeyset(mint string) crypto.WalletKeyset {
+	return crypto.WalletKeyset{
+		Id:          generateRandomString(32),
+		MintURL:     mint,
+		Unit:        cashu.Sat.String(),
+		Active:      true,
+		PublicKeys:  make(map[uint64]*secp256k1.PublicKey),
+		InputFeePpk: 100,
+	}
+}
+
+func generateMintQuote(id string) MintQuote {
+	return MintQuote{
+		QuoteId: id,
+		Mint:    "http://localhost:3338",
+		Method:  "bolt11",
+		State:   nut04.Unpaid,
+		Amount:  21,
+	}
+}
+
+func generateRandomMintQuotes(num int) []MintQuote {
+	quotes := make([]MintQuote, num)
+	for i := 0; i < num; i++ {
+		id := generateRandomString(32)
+		quote := generateMintQuote(id)
+		quotes[i] = quote
+	}
+	return quotes
+}
+
+func generateMeltQuote(id string) MeltQuote {
+	return MeltQuote{
+		QuoteId: id,
+		Mint:    "http://localhost:3338",
+		Method:  "bolt11",
+		State:   nut05.Unpaid,
+		Amount:  21,
+	}
+}
+
+func generateRandomMeltQuotes(num int) []MeltQuote {
+	quotes := make([]MeltQuote, num)
+	for i := 0; i < num; i++ {
+		id := generateRandomString(32)
+		quote := generateMeltQuote(id)
+		quotes[i] = quote
+	}
+	return quotes
+}
@@ -0,0 +1,340 @@
+package storagetest
+
+import (
+	"sync"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+var _ storage.WalletDB = (*MockDB)(nil)
+
+// MockDB is a storage.WalletDB that records the methods called and
+// can fail them with an error set with SetError. Calls that do not
+// fail are passed to the db it wraps.
+type MockDB struct {
+	db storage.WalletDB
+
+	mu     sync.Mutex
+	calls  map[string]int
+	errors map[string]error
+}
+
+// NewMockDB returns a MockDB that saves to db.
+// If db is nil, it saves to a storage.MemoryDB.
+func NewMockDB(db storage.WalletDB) *MockDB {
+	if db == nil {
+		db = storage.NewMemoryDB()
+	}
+	return &MockDB{
+		db:     db,
+		calls:  make(map[string]int),
+		errors: make(map[string]error),
+	}
+}
+
+// SetError makes calls to the method (i.e "SaveProofs") return err until it
+// is set to nil. Only methods that return an error can fail.
+func (m *MockDB) SetError(method string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		delete(m.errors, method)
+		return
+	}
+	m.errors[method] = err
+}
+
+// Calls returns the number of times the method was called
+func (m *MockDB) Calls(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.calls[method]
+}
+
+// call records the call to the method and returns the error set for it
+func (m *MockDB) call(method string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls[method]++
+	return m.errors[method]
+}
+
+func (m *MockDB) SaveMnemonicSeed(mnemonic string, seed []byte) {
+	m.call("SaveMnemonicSeed")
+	m.db.SaveMnemonicSeed(mnemonic, seed)
+}
+
+func (m *MockDB) GetSeed() []byte {
+	m.call("GetSeed")
+	return m.db.GetSeed()
+}
+
+func (m *MockDB) GetMnemonic() string {
+	m.call("GetMnemonic")
+	return m.db.GetMnemonic()
+}
+
+func (m *MockDB) SaveProofs(proofs cashu.Proofs) error {
+	if err := m.call("SaveProofs"); err != nil {
+		return err
+	}
+	return m.db.SaveProofs(proofs)
+}
+
+func (m *MockDB) GetProofs() cashu.Proofs {
+	m.call("GetProofs")
+	return m.db.GetProofs()
+}
+
+func (m *MockDB) GetProofsByKeysetId(id string) cashu.Proofs {
+	m.call("GetProofsByKeysetId")
+	return m.db.GetProofsByKeysetId(id)
+}
+
+func (m *MockDB) DeleteProof(secret string) error {
+	if err := m.call("DeleteProof"); err != nil {
+		return err
+	}
+	return m.db.DeleteProof(secret)
+}
+
+func (m *MockDB) AddPendingProofs(proofs cashu.Proofs) error {
+	if err := m.call("AddPendingProofs"); err != nil {
+		return err
+	}
+	return m.db.AddPendingProofs(proofs)
+}
+
+func (m *MockDB) AddPendingProofsByQuoteId(proofs cashu.Proofs, quoteId string) error {
+	if err := m.call("AddPendingProofsByQuoteId"); err != nil {
+		return err
+	}
+	return m.db.AddPendingProofsByQuoteId(proofs, quoteId)
+}
+
+func (m *MockDB) GetPendingProofs() []storage.DBProof {
+	m.call("GetPendingProofs")
+	return m.db.GetPendingProofs()
+}
+
+func (m *MockDB) GetPendingProofsByQuoteId(quoteId string) []storage.DBProof {
+	m.call("GetPendingProofsByQuoteId")
+	return m.db.GetPendingProofsByQuoteId(quoteId)
+}
+
+func (m *MockDB) DeletePendingProofs(Ys []string) error {
+	if err := m.call("DeletePendingProofs"); err != nil {
+		return err
+	}
+	return m.db.DeletePendingProofs(Ys)
+}
+
+func (m *MockDB) DeletePendingProofsByQuoteId(quoteId string) error {
+	if err := m.call("DeletePendingProofsByQuoteId"); err != nil {
+		return err
+	}
+	return m.db.DeletePendingProofsByQuoteId(quoteId)
+}
+
+func (m *MockDB) SaveKeyset(keyset *crypto.WalletKeyset) error {
+	if err := m.call("SaveKeyset"); err != nil {
+		return err
+	}
+	return m.db.SaveKeyset(keyset)
+}
+
+func (m *MockDB) GetKeysets() crypto.KeysetsMap {
+	m.call("GetKeysets")
+	return m.db.GetKeysets()
+}
+
+func (m *MockDB) GetKeyset(id string) *crypto.WalletKeyset {
+	m.call("GetKeyset")
+	return m.db.GetKeyset(id)
+}
+
+func (m *MockDB) IncrementKeysetCounter(id string, num uint32) error {
+	if err := m.call("IncrementKeysetCounter"); err != nil {
+		return err
+	}
+	return m.db.IncrementKeysetCounter(id, num)
+}
+
+func (m *MockDB) GetKeysetCounter(id string) uint32 {
+	m.call("GetKeysetCounter")
+	return m.db.GetKeysetCounter(id)
+}
+
+func (m *MockDB) SaveCounterLease(lease storage.CounterLease) error {
+	if err := m.call("SaveCounterLease"); err != nil {
+		return err
+	}
+	return m.db.SaveCounterLease(lease)
+}
+
+func (m *MockDB) GetCounterLease(keysetId string) *storage.CounterLease {
+	m.call("GetCounterLease")
+	return m.db.GetCounterLease(keysetId)
+}
+
+func (m *MockDB) SaveRestoreProgress(progress storage.RestoreProgress) error {
+	if err := m.call("SaveRestoreProgress"); err != nil {
+		return err
+	}
+	return m.db.SaveRestoreProgress(progress)
+}
+
+func (m *MockDB) GetRestoreProgress() []storage.RestoreProgress {
+	m.call("GetRestoreProgress")
+	return m.db.GetRestoreProgress()
+}
+
+func (m *MockDB) SaveMintTrustLevel(mint string, level storage.TrustLevel) error {
+	if err := m.call("SaveMintTrustLevel"); err != nil {
+		return err
+	}
+	return m.db.SaveMintTrustLevel(mint, level)
+}
+
+func (m *MockDB) GetMintTrustLevels() map[string]storage.TrustLevel {
+	m.call("GetMintTrustLevels")
+	return m.db.GetMintTrustLevels()
+}
+
+func (m *MockDB) SaveMintQuote(quote storage.MintQuote) error {
+	if err := m.call("SaveMintQuote"); err != nil {
+		return err
+	}
+	return m.db.SaveMintQuote(quote)
+}
+
+func (m *MockDB) GetMintQuotes() []storage.MintQuote {
+	m.call("GetMintQuotes")
+	return m.db.GetMintQuotes()
+}
+
+func (m *MockDB) GetMintQuoteById(id string) *storage.MintQuote {
+	m.call("GetMintQuoteById")
+	return m.db.GetMintQuoteById(id)
+}
+
+func (m *MockDB) DeleteMintQuote(id string) error {
+	if err := m.call("DeleteMintQuote"); err != nil {
+		return err
+	}
+	return m.db.DeleteMintQuote(id)
+}
+
+func (m *MockDB) SaveMeltQuote(quote storage.MeltQuote) error {
+	if err := m.call("SaveMeltQuote"); err != nil {
+		return err
+	}
+	return m.db.SaveMeltQuote(quote)
+}
+
+func (m *MockDB) GetMeltQuotes() []storage.MeltQuote {
+	m.call("GetMeltQuotes")
+	return m.db.GetMeltQuotes()
+}
+
+func (m *MockDB) GetMeltQuoteById(id string) *storage.MeltQuote {
+	m.call("GetMeltQuoteById")
+	return m.db.GetMeltQuoteById(id)
+}
+
+func (m *MockDB) DeleteMeltQuote(id string) error {
+	if err := m.call("DeleteMeltQuote"); err != nil {
+		return err
+	}
+	return m.db.DeleteMeltQuote(id)
+}
+
+func (m *MockDB) SaveOperation(operation storage.Operation) error {
+	if err := m.call("SaveOperation"); err != nil {
+		return err
+	}
+	return m.db.SaveOperation(operation)
+}
+
+func (m *MockDB) GetOperations() []storage.Operation {
+	m.call("GetOperations")
+	return m.db.GetOperations()
+}
+
+func (m *MockDB) DeleteOperation(id string) error {
+	if err := m.call("DeleteOperation"); err != nil {
+		return err
+	}
+	return m.db.DeleteOperation(id)
+}
+
+func (m *MockDB) SaveLockedSend(lockedSend storage.LockedSend) error {
+	if err := m.call("SaveLockedSend"); err != nil {
+		return err
+	}
+	return m.db.SaveLockedSend(lockedSend)
+}
+
+func (m *MockDB) GetLockedSends() []storage.LockedSend {
+	m.call("GetLockedSends")
+	return m.db.GetLockedSends()
+}
+
+func (m *MockDB) DeleteLockedSend(id string) error {
+	if err := m.call("DeleteLockedSend"); err != nil {
+		return err
+	}
+	return m.db.DeleteLockedSend(id)
+}
+
+func (m *MockDB) SaveTransaction(tx storage.Transaction) error {
+	if err := m.call("SaveTransaction"); err != nil {
+		return err
+	}
+	return m.db.SaveTransaction(tx)
+}
+
+func (m *MockDB) GetTransactions() []storage.Transaction {
+	m.call("GetTransactions")
+	return m.db.GetTransactions()
+}
+
+func (m *MockDB) SaveScheduledPayment(payment storage.ScheduledPayment) error {
+	if err := m.call("SaveScheduledPayment"); err != nil {
+		return err
+	}
+	return m.db.SaveScheduledPayment(payment)
+}
+
+func (m *MockDB) GetScheduledPayments() []storage.ScheduledPayment {
+	m.call("GetScheduledPayments")
+	return m.db.GetScheduledPayments()
+}
+
+func (m *MockDB) DeleteScheduledPayment(id string) error {
+	if err := m.call("DeleteScheduledPayment"); err != nil {
+		return err
+	}
+	return m.db.DeleteScheduledPayment(id)
+}
+
+func (m *MockDB) QuarantineProofs(proofs []storage.QuarantinedProof) error {
+	if err := m.call("QuarantineProofs"); err != nil {
+		return err
+	}
+	return m.db.QuarantineProofs(proofs)
+}
+
+func (m *MockDB) GetQuarantinedProofs() []storage.QuarantinedProof {
+	m.call("GetQuarantinedProofs")
+	return m.db.GetQuarantinedProofs()
+}
+
+func (m *MockDB) Close() error {
+	if err := m.call("Close"); err != nil {
+		return err
+	}
+	return m.db.Close()
+}
@@ -0,0 +1,673 @@
+// Package storagetest has tests that check a storage.WalletDB implementation
+// behaves as the wallet expects, and a MockDB to test how the wallet
+// handles errors from its storage.
+package storagetest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// TestWalletDB runs the tests of the WalletDB behavior against the
+// implementation. newDB is called for each test and should return an empty
+// db. Closing it after the test is up to newDB (i.e with t.Cleanup).
+//
+//	func TestMyDB(t *testing.T) {
+//		storagetest.TestWalletDB(t, func(t *testing.T) storage.WalletDB {
+//			return NewMyDB(t.TempDir())
+//		})
+//	}
+func TestWalletDB(t *testing.T, newDB func(t *testing.T) storage.WalletDB) {
+	tests := []struct {
+		name string
+		test func(*testing.T, storage.WalletDB)
+	}{
+		{"Seed", testSeed},
+		{"Proofs", testProofs},
+		{"PendingProofs", testPendingProofs},
+		{"Keysets", testKeysets},
+		{"CounterLeases", testCounterLeases},
+		{"RestoreProgress", testRestoreProgress},
+		{"MintTrustLevels", testMintTrustLevels},
+		{"MintQuotes", testMintQuotes},
+		{"MeltQuotes", testMeltQuotes},
+		{"Operations", testOperations},
+		{"LockedSends", testLockedSends},
+		{"Transactions", testTransactions},
+		{"ScheduledPayments", testScheduledPayments},
+		{"QuarantineProofs", testQuarantineProofs},
+		{"Concurrency", testConcurrency},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, newDB(t))
+		})
+	}
+}
+
+func testSeed(t *testing.T, db storage.WalletDB) {
+	if len(db.GetSeed()) > 0 || len(db.GetMnemonic()) > 0 {
+		t.Fatal("expected no seed in empty db")
+	}
+
+	seed := randomBytes(64)
+	db.SaveMnemonicSeed("mnemonic", seed)
+	if mnemonic := db.GetMnemonic(); mnemonic != "mnemonic" {
+		t.Fatalf("expected mnemonic 'mnemonic' but got '%v'", mnemonic)
+	}
+	savedSeed := db.GetSeed()
+	if !slices.Equal(seed, savedSeed) {
+		t.Fatalf("expected seed '%x' but got '%x'", seed, savedSeed)
+	}
+
+	// changes to the returned seed are not saved
+	savedSeed[0] ^= 0xff
+	if !slices.Equal(seed, db.GetSeed()) {
+		t.Fatal("seed in db was changed by changing the returned seed")
+	}
+}
+
+func testProofs(t *testing.T, db storage.WalletDB) {
+	if len(db.GetProofs()) > 0 {
+		t.Fatal("expected no proofs in empty db")
+	}
+
+	proofs := randomProofs("keyset1", 10)
+	otherProofs := randomProofs("keyset2", 5)
+	if err := db.SaveProofs(append(slices.Clone(proofs), otherProofs...)); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+	// saving the same proofs again does not add them twice
+	if err := db.SaveProofs(proofs[:2]); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+	assertProofs(t, append(slices.Clone(proofs), otherProofs...), db.GetProofs())
+	assertProofs(t, proofs, db.GetProofsByKeysetId("keyset1"))
+	assertProofs(t, otherProofs, db.GetProofsByKeysetId("keyset2"))
+	if len(db.GetProofsByKeysetId("keyset3")) > 0 {
+		t.Fatal("expected no proofs for keyset not saved")
+	}
+
+	if err := db.DeleteProof(proofs[0].Secret); err != nil {
+		t.Fatalf("error deleting proof: %v", err)
+	}
+	assertProofs(t, proofs[1:], db.GetProofsByKeysetId("keyset1"))
+	if err := db.DeleteProof(proofs[0].Secret); !errors.Is(err, storage.ProofNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", storage.ProofNotFound, err)
+	}
+}
+
+func testPendingProofs(t *testing.T, db storage.WalletDB) {
+	if len(db.GetPendingProofs()) > 0 {
+		t.Fatal("expected no pending proofs in empty db")
+	}
+
+	proofs := randomProofs("keyset1", 10)
+	quoteProofs := randomProofs("keyset1", 5)
+	if err := db.AddPendingProofs(proofs); err != nil {
+		t.Fatalf("error adding pending proofs: %v", err)
+	}
+	if err := db.AddPendingProofsByQuoteId(quoteProofs, "quote1"); err != nil {
+		t.Fatalf("error adding pending proofs: %v", err)
+	}
+
+	expected := append(toDBProofs(t, proofs, ""), toDBProofs(t, quoteProofs, "quote1")...)
+	assertDBProofs(t, expected, db.GetPendingProofs())
+	assertDBProofs(t, toDBProofs(t, quoteProofs, "quote1"), db.GetPendingProofsByQuoteId("quote1"))
+	if len(db.GetPendingProofsByQuoteId("quote2")) > 0 {
+		t.Fatal("expected no pending proofs for other quote")
+	}
+
+	dbProofs := toDBProofs(t, proofs, "")
+	if err := db.DeletePendingProofs([]string{dbProofs[0].Y, dbProofs[1].Y}); err != nil {
+		t.Fatalf("error deleting pending proofs: %v", err)
+	}
+	expected = append(dbProofs[2:], toDBProofs(t, quoteProofs, "quote1")...)
+	assertDBProofs(t, expected, db.GetPendingProofs())
+
+	if err := db.DeletePendingProofsByQuoteId("quote1"); err != nil {
+		t.Fatalf("error deleting pending proofs: %v", err)
+	}
+	assertDBProofs(t, dbProofs[2:], db.GetPendingProofs())
+	if len(db.GetPendingProofsByQuoteId("quote1")) > 0 {
+		t.Fatal("expected pending proofs of quote to be deleted")
+	}
+}
+
+func testKeysets(t *testing.T, db storage.WalletDB) {
+	if len(db.GetKeysets()) > 0 {
+		t.Fatal("expected no keysets in empty db")
+	}
+
+	keyset1 := randomKeyset("http://localhost:3338")
+	keyset2 := randomKeyset("http://localhost:3338")
+	keyset3 := randomKeyset("http://localhost:3339")
+	for _, keyset := range []crypto.WalletKeyset{keyset1, keyset2, keyset3} {
+		if err := db.SaveKeyset(&keyset); err != nil {
+			t.Fatalf("error saving keyset: %v", err)
+		}
+	}
+
+	keysets := db.GetKeysets()
+	if len(keysets) != 2 || len(keysets["http://localhost:3338"]) != 2 || len(keysets["http://localhost:3339"]) != 1 {
+		t.Fatalf("expected 2 keysets for one mint and 1 for the other but got %v", keysets)
+	}
+	keyset := db.GetKeyset(keyset1.Id)
+	if keyset == nil {
+		t.Fatal("expected keyset but got nil")
+	}
+	assertKeyset(t, keyset1, *keyset)
+	if keyset := db.GetKeyset("unknown"); keyset != nil {
+		t.Fatalf("expected nil for keyset not saved but got %v", keyset)
+	}
+
+	// changes to the returned keyset are not saved
+	delete(keyset.PublicKeys, 1)
+	assertKeyset(t, keyset1, *db.GetKeyset(keyset1.Id))
+
+	if counter := db.GetKeysetCounter(keyset2.Id); counter != 0 {
+		t.Fatalf("expected counter 0 but got %v", counter)
+	}
+	if err := db.IncrementKeysetCounter(keyset2.Id, 5); err != nil {
+		t.Fatalf("error incrementing keyset counter: %v", err)
+	}
+	if err := db.IncrementKeysetCounter(keyset2.Id, 3); err != nil {
+		t.Fatalf("error incrementing keyset counter: %v", err)
+	}
+	if counter := db.GetKeysetCounter(keyset2.Id); counter != 8 {
+		t.Fatalf("expected counter 8 but got %v", counter)
+	}
+	if counter := db.GetKeyset(keyset2.Id).Counter; counter != 8 {
+		t.Fatalf("expected counter 8 in keyset but got %v", counter)
+	}
+	if counter := db.GetKeysetCounter(keyset1.Id); counter != 0 {
+		t.Fatalf("expected counter of other keyset to be 0 but got %v", counter)
+	}
+	if err := db.IncrementKeysetCounter("unknown", 1); err == nil {
+		t.Fatal("expected error incrementing counter of keyset not saved")
+	}
+	if counter := db.GetKeysetCounter("unknown"); counter != 0 {
+		t.Fatalf("expected counter 0 for keyset not saved but got %v", counter)
+	}
+
+	// saving the keyset again replaces it
+	keyset1.Active = false
+	if err := db.SaveKeyset(&keyset1); err != nil {
+		t.Fatalf("error saving keyset: %v", err)
+	}
+	if db.GetKeyset(keyset1.Id).Active {
+		t.Fatal("expected keyset to be replaced")
+	}
+}
+
+func testCounterLeases(t *testing.T, db storage.WalletDB) {
+	if lease := db.GetCounterLease("keyset1"); lease != nil {
+		t.Fatalf("expected no lease but got %v", lease)
+	}
+
+	lease := storage.CounterLease{KeysetId: "keyset1", Mint: "http://localhost:3338", Start: 0, End: 100, CheckedAt: 1700000000}
+	if err := db.SaveCounterLease(lease); err != nil {
+		t.Fatalf("error saving lease: %v", err)
+	}
+	lease.Start, lease.End = 100, 200
+	if err := db.SaveCounterLease(lease); err != nil {
+		t.Fatalf("error saving lease: %v", err)
+	}
+	assertEqual(t, &lease, db.GetCounterLease("keyset1"))
+}
+
+func testRestoreProgress(t *testing.T, db storage.WalletDB) {
+	if len(db.GetRestoreProgress()) > 0 {
+		t.Fatal("expected no restore progress in empty db")
+	}
+
+	progress1 := storage.RestoreProgress{KeysetId: "keyset1", Mint: "http://localhost:3338", Counter: 100, NextCounter: 42}
+	progress2 := storage.RestoreProgress{KeysetId: "keyset2", Mint: "http://localhost:3338", Counter: 300, Done: true}
+	for _, progress := range []storage.RestoreProgress{progress1, progress2} {
+		if err := db.SaveRestoreProgress(progress); err != nil {
+			t.Fatalf("error saving restore progress: %v", err)
+		}
+	}
+	progress1.Counter, progress1.EmptyBatches, progress1.Restored = 200, 1, 21
+	if err := db.SaveRestoreProgress(progress1); err != nil {
+		t.Fatalf("error saving restore progress: %v", err)
+	}
+	assertUnordered(t, []storage.RestoreProgress{progress1, progress2}, db.GetRestoreProgress(),
+		func(progress storage.RestoreProgress) string { return progress.KeysetId })
+}
+
+func testMintTrustLevels(t *testing.T, db storage.WalletDB) {
+	if len(db.GetMintTrustLevels()) > 0 {
+		t.Fatal("expected no trust levels in empty db")
+	}
+
+	if err := db.SaveMintTrustLevel("http://localhost:3338", storage.Trusted); err != nil {
+		t.Fatalf("error saving trust level: %v", err)
+	}
+	if err := db.SaveMintTrustLevel("http://localhost:3339", storage.AutoAdded); err != nil {
+		t.Fatalf("error saving trust level: %v", err)
+	}
+	assertEqual(t, map[string]storage.TrustLevel{
+		"http://localhost:3338": storage.Trusted,
+		"http://localhost:3339": storage.AutoAdded,
+	}, db.GetMintTrustLevels())
+
+	if err := db.SaveMintTrustLevel("http://localhost:3339", storage.Trusted); err != nil {
+		t.Fatalf("error saving trust level: %v", err)
+	}
+	if level := db.GetMintTrustLevels()["http://localhost:3339"]; level != storage.Trusted {
+		t.Fatalf("expected trust level '%v' but got '%v'", storage.Trusted, level)
+	}
+}
+
+func testMintQuotes(t *testing.T, db storage.WalletDB) {
+	quotes := make([]storage.MintQuote, 3)
+	for i := range quotes {
+		quotes[i] = storage.MintQuote{
+			QuoteId:        randomId(),
+			Mint:           "http://localhost:3338",
+			Method:         cashu.BOLT11_METHOD,
+			State:          nut04.Unpaid,
+			Unit:           cashu.Sat.String(),
+			PaymentRequest: "lnbc",
+			Amount:         21,
+			CreatedAt:      1700000000,
+			QuoteExpiry:    1700000600,
+		}
+	}
+	testRecords(t, records[storage.MintQuote]{
+		id:   func(quote storage.MintQuote) string { return quote.QuoteId },
+		save: db.SaveMintQuote,
+		list: db.GetMintQuotes,
+		get: func(id string) (storage.MintQuote, bool) {
+			quote := db.GetMintQuoteById(id)
+			if quote == nil {
+				return storage.MintQuote{}, false
+			}
+			return *quote, true
+		},
+		delete: db.DeleteMintQuote,
+		change: func(quote storage.MintQuote) storage.MintQuote {
+			quote.State = nut04.Paid
+			quote.SettledAt = 1700000100
+			return quote
+		},
+	}, quotes)
+}
+
+func testMeltQuotes(t *testing.T, db storage.WalletDB) {
+	quotes := make([]storage.MeltQuote, 3)
+	for i := range quotes {
+		quotes[i] = storage.MeltQuote{
+			QuoteId:        randomId(),
+			Mint:           "http://localhost:3338",
+			Method:         cashu.BOLT11_METHOD,
+			State:          nut05.Unpaid,
+			Unit:           cashu.Sat.String(),
+			PaymentRequest: "lnbc",
+			Amount:         21,
+			FeeReserve:     1,
+			CreatedAt:      1700000000,
+			QuoteExpiry:    1700000600,
+		}
+	}
+	testRecords(t, records[storage.MeltQuote]{
+		id:   func(quote storage.MeltQuote) string { return quote.QuoteId },
+		save: db.SaveMeltQuote,
+		list: db.GetMeltQuotes,
+		get: func(id string) (storage.MeltQuote, bool) {
+			quote := db.GetMeltQuoteById(id)
+			if quote == nil {
+				return storage.MeltQuote{}, false
+			}
+			return *quote, true
+		},
+		delete: db.DeleteMeltQuote,
+		change: func(quote storage.MeltQuote) storage.MeltQuote {
+			quote.State = nut05.Paid
+			quote.Preimage = "preimage"
+			return quote
+		},
+	}, quotes)
+}
+
+func testOperations(t *testing.T, db storage.WalletDB) {
+	operations := make([]storage.Operation, 3)
+	for i := range operations {
+		operations[i] = storage.Operation{
+			Id:         randomId(),
+			Kind:       storage.SwapOperation,
+			Mint:       "http://localhost:3338",
+			Inputs:     randomProofs("keyset1", 2),
+			Outputs:    cashu.BlindedMessages{{Amount: 21, B_: randomId(), Id: "keyset1"}},
+			Secrets:    []string{randomId()},
+			Rs:         []string{randomId()},
+			KeysetId:   "keyset1",
+			CounterEnd: 10,
+			CreatedAt:  1700000000,
+		}
+	}
+	testRecords(t, records[storage.Operation]{
+		id:     func(operation storage.Operation) string { return operation.Id },
+		save:   db.SaveOperation,
+		list:   db.GetOperations,
+		delete: db.DeleteOperation,
+		change: func(operation storage.Operation) storage.Operation {
+			operation.CounterEnd = 20
+			return operation
+		},
+	}, operations)
+}
+
+func testLockedSends(t *testing.T, db storage.WalletDB) {
+	lockedSends := make([]storage.LockedSend, 3)
+	for i := range lockedSends {
+		lockedSends[i] = storage.LockedSend{
+			Id:        randomId(),
+			Mint:      "http://localhost:3338",
+			Proofs:    randomProofs("keyset1", 2),
+			CreatedAt: 1700000000,
+		}
+	}
+	testRecords(t, records[storage.LockedSend]{
+		id:     func(lockedSend storage.LockedSend) string { return lockedSend.Id },
+		save:   db.SaveLockedSend,
+		list:   db.GetLockedSends,
+		delete: db.DeleteLockedSend,
+		change: func(lockedSend storage.LockedSend) storage.LockedSend {
+			lockedSend.Proofs = lockedSend.Proofs[:1]
+			return lockedSend
+		},
+	}, lockedSends)
+}
+
+func testTransactions(t *testing.T, db storage.WalletDB) {
+	transactions := make([]storage.Transaction, 3)
+	for i := range transactions {
+		transactions[i] = storage.Transaction{
+			Id:        randomId(),
+			Kind:      storage.MintTransaction,
+			Mint:      "http://localhost:3338",
+			Amount:    21,
+			Fee:       1,
+			Reference: randomId(),
+			CreatedAt: 1700000000,
+		}
+	}
+	testRecords(t, records[storage.Transaction]{
+		id:   func(transaction storage.Transaction) string { return transaction.Id },
+		save: db.SaveTransaction,
+		list: db.GetTransactions,
+		change: func(transaction storage.Transaction) storage.Transaction {
+			transaction.Fee = 2
+			return transaction
+		},
+	}, transactions)
+}
+
+func testScheduledPayments(t *testing.T, db storage.WalletDB) {
+	payments := make([]storage.ScheduledPayment, 3)
+	for i := range payments {
+		payments[i] = storage.ScheduledPayment{
+			Id:        randomId(),
+			Kind:      storage.ScheduledMelt,
+			Mint:      "http://localhost:3338",
+			Amount:    21,
+			Target:    "alice@example.com",
+			At:        1700000000,
+			Interval:  3600,
+			CreatedAt: 1700000000,
+		}
+	}
+	testRecords(t, records[storage.ScheduledPayment]{
+		id:     func(payment storage.ScheduledPayment) string { return payment.Id },
+		save:   db.SaveScheduledPayment,
+		list:   db.GetScheduledPayments,
+		delete: db.DeleteScheduledPayment,
+		change: func(payment storage.ScheduledPayment) storage.ScheduledPayment {
+			payment.Attempts = 1
+			payment.LastError = "error"
+			return payment
+		},
+	}, payments)
+}
+
+func testQuarantineProofs(t *testing.T, db storage.WalletDB) {
+	if len(db.GetQuarantinedProofs()) > 0 {
+		t.Fatal("expected no quarantined proofs in empty db")
+	}
+
+	proofs := randomProofs("keyset1", 5)
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+	dbProofs := toDBProofs(t, proofs, "")
+	quarantined := []storage.QuarantinedProof{
+		{Y: dbProofs[0].Y, Mint: "http://localhost:3338", Proof: proofs[0], State: "SPENT", QuarantinedAt: 1700000000},
+		{Y: dbProofs[1].Y, Mint: "http://localhost:3338", Proof: proofs[1], State: "SPENT", QuarantinedAt: 1700000000},
+	}
+	if err := db.QuarantineProofs(quarantined); err != nil {
+		t.Fatalf("error quarantining proofs: %v", err)
+	}
+
+	// quarantined proofs are removed from the proofs of the wallet
+	assertProofs(t, proofs[2:], db.GetProofs())
+	assertUnordered(t, quarantined, db.GetQuarantinedProofs(), func(proof storage.QuarantinedProof) string {
+		return proof.Y
+	})
+}
+
+// testConcurrency checks that the db can be used from multiple goroutines
+func testConcurrency(t *testing.T, db storage.WalletDB) {
+	keyset := randomKeyset("http://localhost:3338")
+	if err := db.SaveKeyset(&keyset); err != nil {
+		t.Fatalf("error saving keyset: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := db.IncrementKeysetCounter(keyset.Id, 1); err != nil {
+				errs <- err
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := db.SaveProofs(randomProofs(keyset.Id, 2)); err != nil {
+				errs <- err
+			}
+			db.GetProofs()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if counter := db.GetKeysetCounter(keyset.Id); counter != 10 {
+		t.Fatalf("expected counter 10 but got %v", counter)
+	}
+	if proofs := db.GetProofs(); len(proofs) != 20 {
+		t.Fatalf("expected 20 proofs but got %v", len(proofs))
+	}
+}
+
+// records are the methods to save, list, get and delete a type of record
+// saved by id. get and delete are nil if the db does not have them.
+type records[T any] struct {
+	id     func(T) string
+	save   func(T) error
+	list   func() []T
+	get    func(string) (T, bool)
+	delete func(string) error
+	// change returns the record with a change to replace it
+	change func(T) T
+}
+
+func testRecords[T any](t *testing.T, r records[T], values []T) {
+	if len(r.list()) > 0 {
+		t.Fatal("expected no records in empty db")
+	}
+
+	for _, value := range values {
+		if err := r.save(value); err != nil {
+			t.Fatalf("error saving: %v", err)
+		}
+	}
+	assertUnordered(t, values, r.list(), r.id)
+
+	if r.get != nil {
+		value, ok := r.get(r.id(values[0]))
+		if !ok {
+			t.Fatalf("expected record '%v' but got nil", r.id(values[0]))
+		}
+		assertEqual(t, values[0], value)
+		if _, ok := r.get("unknown"); ok {
+			t.Fatal("expected nil for record not saved")
+		}
+	}
+
+	// saving with the same id replaces the record
+	values[0] = r.change(values[0])
+	if err := r.save(values[0]); err != nil {
+		t.Fatalf("error saving: %v", err)
+	}
+	assertUnordered(t, values, r.list(), r.id)
+
+	if r.delete != nil {
+		if err := r.delete(r.id(values[0])); err != nil {
+			t.Fatalf("error deleting: %v", err)
+		}
+		assertUnordered(t, values[1:], r.list(), r.id)
+		if r.get != nil {
+			if _, ok := r.get(r.id(values[0])); ok {
+				t.Fatal("expected record to be deleted")
+			}
+		}
+	}
+}
+
+func assertEqual(t *testing.T, expected, got any) {
+	t.Helper()
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected '%+v' but got '%+v'", expected, got)
+	}
+}
+
+// assertUnordered checks the lists have the same elements in any order
+func assertUnordered[T any](t *testing.T, expected, got []T, id func(T) string) {
+	t.Helper()
+	compare := func(a, b T) int { return strings.Compare(id(a), id(b)) }
+	expected, got = slices.Clone(expected), slices.Clone(got)
+	slices.SortFunc(expected, compare)
+	slices.SortFunc(got, compare)
+	if len(expected) == 0 && len(got) == 0 {
+		return
+	}
+	assertEqual(t, expected, got)
+}
+
+func assertProofs(t *testing.T, expected, got cashu.Proofs) {
+	t.Helper()
+	assertUnordered(t, expected, got, func(proof cashu.Proof) string { return proof.Secret })
+}
+
+func assertDBProofs(t *testing.T, expected, got []storage.DBProof) {
+	t.Helper()
+	assertUnordered(t, expected, got, func(proof storage.DBProof) string { return proof.Y })
+}
+
+// assertKeyset compares the public keys by their serialization
+// since the keys could have been decoded from the db
+func assertKeyset(t *testing.T, expected, got crypto.WalletKeyset) {
+	t.Helper()
+	expectedKeys, gotKeys := expected.PublicKeys, got.PublicKeys
+	expected.PublicKeys, got.PublicKeys = nil, nil
+	assertEqual(t, expected, got)
+	if len(expectedKeys) != len(gotKeys) {
+		t.Fatalf("expected %v public keys but got %v", len(expectedKeys), len(gotKeys))
+	}
+	for amount, key := range expectedKeys {
+		gotKey, ok := gotKeys[amount]
+		if !ok || !key.IsEqual(gotKey) {
+			t.Fatalf("public key for amount %v does not match", amount)
+		}
+	}
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func randomId() string {
+	return hex.EncodeToString(randomBytes(16))
+}
+
+func randomProofs(keysetId string, num int) cashu.Proofs {
+	proofs := make(cashu.Proofs, num)
+	for i := range proofs {
+		proofs[i] = cashu.Proof{
+			Amount: 21,
+			Id:     keysetId,
+			Secret: hex.EncodeToString(randomBytes(32)),
+			C:      hex.EncodeToString(randomBytes(33)),
+		}
+	}
+	return proofs
+}
+
+func toDBProofs(t *testing.T, proofs cashu.Proofs, quoteId string) []storage.DBProof {
+	dbProofs := make([]storage.DBProof, len(proofs))
+	for i, proof := range proofs {
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dbProofs[i] = storage.DBProof{
+			Y:           hex.EncodeToString(Y.SerializeCompressed()),
+			Amount:      proof.Amount,
+			Id:          proof.Id,
+			Secret:      proof.Secret,
+			C:           proof.C,
+			DLEQ:        proof.DLEQ,
+			MeltQuoteId: quoteId,
+		}
+	}
+	return dbProofs
+}
+
+func randomKeyset(mint string) crypto.WalletKeyset {
+	publicKeys := make(map[uint64]*secp256k1.PublicKey)
+	for _, amount := range []uint64{1, 2, 4} {
+		key, _ := secp256k1.GeneratePrivateKey()
+		publicKeys[amount] = key.PubKey()
+	}
+	return crypto.WalletKeyset{
+		Id:          "00" + hex.EncodeToString(randomBytes(7)),
+		MintURL:     mint,
+		Unit:        cashu.Sat.String(),
+		Active:      true,
+		PublicKeys:  publicKeys,
+		InputFeePpk: 100,
+	}
+}
@@ -0,0 +1,120 @@
+package wallet
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elnosh/gonuts/cashu"
+)
+
+// TokenVersion is the format of the tokens created by the wallet
+type TokenVersion int
+
+const (
+	// DefaultTokenVersion uses the version set in the Config of the wallet
+	DefaultTokenVersion TokenVersion = iota
+	// TokenV4 is the CBOR encoded token (cashuB)
+	TokenV4
+	// TokenV3 is the JSON base64 encoded token (cashuA). Some
+	// wallets can only receive tokens in this format.
+	TokenV3
+)
+
+func (version TokenVersion) String() string {
+	switch version {
+	case DefaultTokenVersion:
+		return "default"
+	case TokenV4:
+		return "v4"
+	case TokenV3:
+		return "v3"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseTokenVersion parses a token version from 'v3' or 'v4'
+func ParseTokenVersion(version string) (TokenVersion, error) {
+	switch strings.ToLower(version) {
+	case "v4", "4", "cashub":
+		return TokenV4, nil
+	case "v3", "3", "cashua":
+		return TokenV3, nil
+	default:
+		return DefaultTokenVersion, fmt.Errorf("invalid token version '%v'. Expected v3 or v4", version)
+	}
+}
+
+// NewToken creates a token with the proofs from the mint. The version
+// overrides the one in the Config of the wallet unless it is DefaultTokenVersion.
+// Tokens received can be in either version regardless of this.
+func (w *Wallet) NewToken(
+	proofs cashu.Proofs,
+	mint string,
+	version TokenVersion,
+	includeDLEQ bool,
+) (cashu.Token, error) {
+	if version == DefaultTokenVersion {
+		version = w.tokenVersion
+	}
+	unit := w.unit
+	if len(proofs) > 0 {
+		unit = w.keysetUnit(proofs[0].Id)
+	}
+	switch version {
+	case TokenV3:
+		token, err := cashu.NewTokenV3(proofs, mint, unit, includeDLEQ)
+		if err != nil {
+			return nil, err
+		}
+		return token, nil
+	case DefaultTokenVersion, TokenV4:
+		token, err := cashu.NewTokenV4(proofs, mint, unit, includeDLEQ)
+		if err != nil {
+			return nil, err
+		}
+		return token, nil
+	default:
+		return nil, fmt.Errorf("invalid token version '%v'", version)
+	}
+}
+
+// ReceiveString decodes a serialized token (V3 or V4) and receives it to
+// the mint of the token. Mints not in the wallet are added as allowed by the
+// TrustPolicy. It returns the amount received. Use Receive for more options.
+func (w *Wallet) ReceiveString(token string) (uint64, error) {
+	decodedToken, err := cashu.DecodeToken(strings.TrimSpace(token))
+	if err != nil {
+		return 0, fmt.Errorf("invalid token: %w", err)
+	}
+	amount, err := w.Receive(decodedToken, false)
+	if err != nil {
+		return amount, fmt.Errorf("could not receive token: %w", err)
+	}
+	return amount, nil
+}
+
+// SendString creates a token for the amount from the mint (the current mint
+// if empty) serialized in the TokenVersion of the wallet. The fees for the
+// receiver to redeem it are included. Use Send and NewToken for more options.
+func (w *Wallet) SendString(amount uint64, mint string) (string, error) {
+	if len(mint) == 0 {
+		mint = w.CurrentMint()
+	}
+	proofs, err := w.Send(amount, mint, true)
+	if err != nil {
+		return "", fmt.Errorf("could not send: %w", err)
+	}
+
+	// proofs are pending once sent. If the token can't be
+	// created they can be reclaimed from the pending proofs
+	token, err := w.NewToken(proofs, mint, DefaultTokenVersion, false)
+	if err != nil {
+		return "", fmt.Errorf("could not create token: %w", err)
+	}
+	tokenString, err := token.Serialize()
+	if err != nil {
+		return "", fmt.Errorf("could not serialize token: %w", err)
+	}
+	return tokenString, nil
+}
@@ -0,0 +1,74 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestNewToken(t *testing.T) {
+	proofs := cashu.Proofs{
+		{Amount: 2, Id: "00aaaaaaaaaaaaaa", Secret: "secret1", C: "02aa"},
+		{Amount: 8, Id: "00aaaaaaaaaaaaaa", Secret: "secret2", C: "02bb"},
+	}
+	mint := "http://localhost:3338"
+
+	tests := []struct {
+		configVersion TokenVersion
+		version       TokenVersion
+		prefix        string
+	}{
+		{configVersion: DefaultTokenVersion, version: DefaultTokenVersion, prefix: "cashuB"},
+		{configVersion: TokenV3, version: DefaultTokenVersion, prefix: "cashuA"},
+		{configVersion: TokenV3, version: TokenV4, prefix: "cashuB"},
+		{configVersion: TokenV4, version: TokenV3, prefix: "cashuA"},
+	}
+
+	for _, test := range tests {
+		w := &Wallet{db: storage.NewMemoryDB(), unit: cashu.Sat, tokenVersion: test.configVersion}
+		token, err := w.NewToken(proofs, mint, test.version, false)
+		if err != nil {
+			t.Fatalf("unexpected error creating token: %v", err)
+		}
+		serialized, err := token.Serialize()
+		if err != nil {
+			t.Fatalf("unexpected error serializing token: %v", err)
+		}
+		if !strings.HasPrefix(serialized, test.prefix) {
+			t.Fatalf("expected token with prefix '%v' for config version %v and version %v but got '%v'",
+				test.prefix, test.configVersion, test.version, serialized[:6])
+		}
+
+		// tokens in both versions can be decoded
+		decoded, err := cashu.DecodeToken(serialized)
+		if err != nil {
+			t.Fatalf("unexpected error decoding token: %v", err)
+		}
+		if decoded.Amount() != 10 || decoded.Mint() != mint {
+			t.Fatalf("unexpected decoded token: amount %v, mint '%v'", decoded.Amount(), decoded.Mint())
+		}
+	}
+
+	if _, err := ParseTokenVersion("v5"); err == nil {
+		t.Fatal("expected error parsing invalid token version")
+	}
+	if version, _ := ParseTokenVersion("V3"); version != TokenV3 {
+		t.Fatalf("expected version %v but got %v", TokenV3, version)
+	}
+}
+
+func TestSendReceiveStringErrors(t *testing.T) {
+	w := &Wallet{db: storage.NewMemoryDB(), unit: cashu.Sat, mints: map[string]walletMint{}}
+
+	if _, err := w.ReceiveString("cashuBnotatoken"); err == nil || !strings.HasPrefix(err.Error(), "invalid token") {
+		t.Fatalf("expected invalid token error but got '%v'", err)
+	}
+	if _, err := w.SendString(21, "http://localhost:3338"); !errors.Is(err, ErrMintNotExist) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintNotExist, err)
+	}
+}
@@ -0,0 +1,87 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+var (
+	ErrMintBalanceLimit    = errors.New("receiving would exceed the balance limit for untrusted mint")
+	ErrReceiveNotConfirmed = errors.New("receiving from untrusted mint was not confirmed")
+)
+
+// TrustPolicy sets the rules for receiving tokens from mints that
+// have not been explicitly trusted. Mints added when receiving
+// without swapping to a trusted mint have the AutoAdded trust level.
+// The zero value has no limits.
+type TrustPolicy struct {
+	// MaxAutoMintBalance is the max balance that can be held in a mint
+	// that was added automatically. 0 means no limit.
+	MaxAutoMintBalance uint64
+
+	// ConfirmThreshold is the amount above which receiving from an untrusted
+	// mint needs to be confirmed by the Confirm callback. If the threshold
+	// is set and Confirm is nil, receiving above it is rejected.
+	ConfirmThreshold uint64
+	Confirm          func(mint string, amount uint64) bool
+}
+
+func (w *Wallet) checkTrustPolicy(mint string, amount uint64) error {
+	if walletMint, ok := w.mints[mint]; ok && walletMint.trustLevel == storage.Trusted {
+		return nil
+	}
+
+	policy := w.trustPolicy
+	if policy.MaxAutoMintBalance > 0 {
+		balance := w.GetBalanceByMints()[mint]
+		if balance+amount > policy.MaxAutoMintBalance {
+			return fmt.Errorf("%w: balance would be %v and limit is %v",
+				ErrMintBalanceLimit, balance+amount, policy.MaxAutoMintBalance)
+		}
+	}
+
+	if (policy.ConfirmThreshold > 0 || policy.Confirm != nil) && amount > policy.ConfirmThreshold {
+		if policy.Confirm == nil || !policy.Confirm(mint, amount) {
+			return ErrReceiveNotConfirmed
+		}
+	}
+
+	return nil
+}
+
+// MintTrustLevel returns the trust level of the mint
+func (w *Wallet) MintTrustLevel(mint string) (storage.TrustLevel, error) {
+	walletMint, ok := w.mints[mint]
+	if !ok {
+		return 0, ErrMintNotExist
+	}
+	return walletMint.trustLevel, nil
+}
+
+// MintsByTrustLevel returns the mints in the wallet with the trust level
+func (w *Wallet) MintsByTrustLevel(level storage.TrustLevel) []string {
+	mints := []string{}
+	for mintURL, mint := range w.mints {
+		if mint.trustLevel == level {
+			mints = append(mints, mintURL)
+		}
+	}
+	return mints
+}
+
+// TrustMint sets a mint that was added automatically as trusted
+// so that the trust policy no longer applies to it.
+func (w *Wallet) TrustMint(mint string) error {
+	walletMint, ok := w.mints[mint]
+	if !ok {
+		return ErrMintNotExist
+	}
+	if err := w.db.SaveMintTrustLevel(mint, storage.Trusted); err != nil {
+		return err
+	}
+	walletMint.trustLevel = storage.Trusted
+	w.mints[mint] = walletMint
+	return nil
+}
@@ -0,0 +1,109 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestCheckTrustPolicy(t *testing.T) {
+	db := storage.NewMemoryDB()
+
+	trustedMint := "http://localhost:3338"
+	autoMint := "http://localhost:8888"
+	keyset := crypto.WalletKeyset{Id: "009a1f293253e41e", MintURL: autoMint}
+	proofs := cashu.Proofs{{Amount: 64, Id: keyset.Id, Secret: "secret1", C: "C1"}}
+	if err := db.SaveProofs(proofs); err != nil {
+		t.Fatalf("error saving proofs: %v", err)
+	}
+
+	w := &Wallet{
+		db: db,
+		mints: map[string]walletMint{
+			trustedMint: {mintURL: trustedMint, trustLevel: storage.Trusted},
+			autoMint:    {mintURL: autoMint, activeKeyset: keyset, trustLevel: storage.AutoAdded},
+		},
+	}
+
+	// no limits in zero value policy
+	if err := w.checkTrustPolicy(autoMint, 10000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	w.trustPolicy = TrustPolicy{MaxAutoMintBalance: 100}
+	if err := w.checkTrustPolicy(autoMint, 36); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.checkTrustPolicy(autoMint, 37); !errors.Is(err, ErrMintBalanceLimit) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintBalanceLimit, err)
+	}
+	// limit does not apply to new mints' existing balance or trusted mints
+	if err := w.checkTrustPolicy("http://newmint.com", 100); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.checkTrustPolicy(trustedMint, 1000); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var confirmed []uint64
+	confirm := false
+	w.trustPolicy = TrustPolicy{
+		ConfirmThreshold: 50,
+		Confirm: func(mint string, amount uint64) bool {
+			confirmed = append(confirmed, amount)
+			return confirm
+		},
+	}
+	if err := w.checkTrustPolicy(autoMint, 50); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := w.checkTrustPolicy(autoMint, 51); !errors.Is(err, ErrReceiveNotConfirmed) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrReceiveNotConfirmed, err)
+	}
+	confirm = true
+	if err := w.checkTrustPolicy(autoMint, 51); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(confirmed) != 2 {
+		t.Fatalf("expected confirm to be called 2 times but got %v", len(confirmed))
+	}
+
+	// threshold without callback rejects amounts above it
+	w.trustPolicy = TrustPolicy{ConfirmThreshold: 50}
+	if err := w.checkTrustPolicy(autoMint, 51); !errors.Is(err, ErrReceiveNotConfirmed) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrReceiveNotConfirmed, err)
+	}
+}
+
+func TestMintsByTrustLevel(t *testing.T) {
+	db := storage.NewMemoryDB()
+
+	autoMint := "http://localhost:8888"
+	w := &Wallet{
+		db: db,
+		mints: map[string]walletMint{
+			"http://localhost:3338": {trustLevel: storage.Trusted},
+			autoMint:                {trustLevel: storage.AutoAdded},
+		},
+	}
+
+	autoMints := w.MintsByTrustLevel(storage.AutoAdded)
+	if len(autoMints) != 1 || autoMints[0] != autoMint {
+		t.Fatalf("expected auto-added mints '[%v]' but got '%v'", autoMint, autoMints)
+	}
+
+	if err := w.TrustMint(autoMint); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(w.MintsByTrustLevel(storage.AutoAdded)) != 0 {
+		t.Fatal("expected no auto-added mints after trusting mint")
+	}
+	if level := db.GetMintTrustLevels()[autoMint]; level != storage.Trusted {
+		t.Fatalf("expected saved trust level '%v' but got '%v'", storage.Trusted, level)
+	}
+}
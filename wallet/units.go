@@ -0,0 +1,236 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+)
+
+var ErrUnitNotEnabled = errors.New("unit is not enabled for the mint")
+
+// AddMintUnit enables the unit (i.e usd or eur) for a mint in the wallet
+// so that it can mint, send, receive and melt proofs in that unit with it.
+// The mint needs to have an active keyset for the unit. Amounts in the unit
+// are not limited by the SpendingPolicy nor saved in the transaction history,
+// which are both in the unit of the wallet.
+func (w *Wallet) AddMintUnit(mintURL string, unit cashu.Unit) error {
+	mint, ok := w.mints[mintURL]
+	if !ok {
+		return ErrMintNotExist
+	}
+	if unit == w.unit {
+		return nil
+	}
+	if _, ok := w.getMint(mintURL, unit); ok {
+		return nil
+	}
+
+	activeKeyset, err := GetMintActiveKeyset(mintURL, unit)
+	if err != nil {
+		return err
+	}
+	inactiveKeysets, err := GetMintInactiveKeysets(mintURL, unit)
+	if err != nil {
+		return err
+	}
+
+	if err := w.db.SaveKeyset(activeKeyset); err != nil {
+		return err
+	}
+	for i, keyset := range inactiveKeysets {
+		if err := w.db.SaveKeyset(&keyset); err != nil {
+			return err
+		}
+		// do not have public keys of inactive keysets in memory
+		keyset.PublicKeys = make(map[uint64]*secp256k1.PublicKey)
+		inactiveKeysets[i] = keyset
+	}
+	w.setMint(walletMint{mintURL, *activeKeyset, inactiveKeysets, mint.trustLevel, unit})
+	w.logInfof("enabled unit '%v' for mint '%v'", unit, mintURL)
+
+	return nil
+}
+
+// MintUnits returns the units enabled for the mint, starting with the unit of the wallet
+func (w *Wallet) MintUnits(mintURL string) []cashu.Unit {
+	if _, ok := w.mints[mintURL]; !ok {
+		return nil
+	}
+	units := []cashu.Unit{w.unit}
+	for unit := range w.unitMints[mintURL] {
+		units = append(units, unit)
+	}
+	slices.Sort(units)
+	return units
+}
+
+// GetBalanceByUnit returns the balance of the wallet in each unit
+func (w *Wallet) GetBalanceByUnit() map[cashu.Unit]uint64 {
+	balances := make(map[cashu.Unit]uint64)
+	units := make(map[string]cashu.Unit)
+	for _, proof := range w.db.GetProofs() {
+		unit, ok := units[proof.Id]
+		if !ok {
+			unit = w.keysetUnit(proof.Id)
+			units[proof.Id] = unit
+		}
+		balances[unit] += proof.Amount
+	}
+	return balances
+}
+
+// GetUnitBalanceByMints returns the balance in the unit
+// of each mint for which the unit is enabled
+func (w *Wallet) GetUnitBalanceByMints(unit cashu.Unit) map[string]uint64 {
+	if unit == w.unit {
+		return w.GetBalanceByMints()
+	}
+	balances := make(map[string]uint64)
+	for mintURL, unitMints := range w.unitMints {
+		if mint, ok := unitMints[unit]; ok {
+			balances[mintURL] = w.mintBalance(&mint)
+		}
+	}
+	return balances
+}
+
+// getMint returns the mint with its keysets in the unit
+func (w *Wallet) getMint(mintURL string, unit cashu.Unit) (walletMint, bool) {
+	if unit == w.unit {
+		mint, ok := w.mints[mintURL]
+		return mint, ok
+	}
+	mint, ok := w.unitMints[mintURL][unit]
+	return mint, ok
+}
+
+func (w *Wallet) setMint(mint walletMint) {
+	if mint.unit == w.unit {
+		w.mints[mint.mintURL] = mint
+		return
+	}
+	if w.unitMints == nil {
+		w.unitMints = make(map[string]map[cashu.Unit]walletMint)
+	}
+	if _, ok := w.unitMints[mint.mintURL]; !ok {
+		w.unitMints[mint.mintURL] = make(map[cashu.Unit]walletMint)
+	}
+	w.unitMints[mint.mintURL][mint.unit] = mint
+}
+
+// mintForUnit returns the mint in the wallet with its keysets in the unit
+func (w *Wallet) mintForUnit(mintURL string, unit cashu.Unit) (*walletMint, error) {
+	if _, ok := w.mints[mintURL]; !ok {
+		return nil, ErrMintNotExist
+	}
+	mint, ok := w.getMint(mintURL, unit)
+	if !ok {
+		return nil, fmt.Errorf("%w: '%v' for mint '%v'", ErrUnitNotEnabled, unit, mintURL)
+	}
+	return &mint, nil
+}
+
+// keysetUnit returns the unit of the keyset in the db. Keysets
+// that are not in the db are taken to be in the unit of the wallet.
+func (w *Wallet) keysetUnit(keysetId string) cashu.Unit {
+	keyset := w.db.GetKeyset(keysetId)
+	if keyset == nil || len(keyset.Unit) == 0 {
+		return w.unit
+	}
+	unit, err := cashu.UnitFromString(keyset.Unit)
+	if err != nil {
+		return w.unit
+	}
+	return unit
+}
+
+// parseUnit returns the unit of a token or quote, which
+// is the unit of the wallet if it was not set
+func (w *Wallet) parseUnit(unit string) (cashu.Unit, error) {
+	if len(unit) == 0 {
+		return w.unit, nil
+	}
+	return cashu.UnitFromString(unit)
+}
+
+// tokenUnit returns the unit of the token
+func (w *Wallet) tokenUnit(token cashu.Token) (cashu.Unit, error) {
+	var unit string
+	switch t := token.(type) {
+	case *cashu.TokenV3:
+		unit = t.Unit
+	case cashu.TokenV3:
+		unit = t.Unit
+	case *cashu.TokenV4:
+		unit = t.Unit
+	case cashu.TokenV4:
+		unit = t.Unit
+	}
+	tokenUnit, err := w.parseUnit(unit)
+	if err != nil {
+		return tokenUnit, fmt.Errorf("invalid unit in token: %v", err)
+	}
+	return tokenUnit, nil
+}
+
+// checkProofsUnit checks that the proofs known to be from
+// keysets in the wallet are from keysets in the unit
+func (w *Wallet) checkProofsUnit(proofs cashu.Proofs, unit cashu.Unit) error {
+	for _, proof := range proofs {
+		if w.db.GetKeyset(proof.Id) == nil {
+			continue
+		}
+		if keysetUnit := w.keysetUnit(proof.Id); keysetUnit != unit {
+			return fmt.Errorf("proofs of keyset '%v' in unit '%v' do not match unit '%v' of token",
+				proof.Id, keysetUnit, unit)
+		}
+	}
+	return nil
+}
+
+// SendInUnit returns proofs for the amount in the unit, which has to be
+// enabled for the mint with AddMintUnit unless it is the unit of the wallet.
+func (w *Wallet) SendInUnit(amount uint64, mintURL string, unit cashu.Unit, includeFees bool) (cashu.Proofs, error) {
+	if unit == w.unit {
+		return w.Send(amount, mintURL, includeFees)
+	}
+	mint, err := w.mintForUnit(mintURL, unit)
+	if err != nil {
+		return nil, err
+	}
+
+	proofsToSend, err := w.getProofsForAmount(amount, mint, includeFees)
+	if err != nil {
+		return nil, err
+	}
+	if err := w.db.AddPendingProofs(proofsToSend); err != nil {
+		return nil, fmt.Errorf("could not save proofs to pending: %v", err)
+	}
+	w.logInfof("sending %v %v from mint '%v'", proofsToSend.Amount(), unit, mintURL)
+
+	return proofsToSend, nil
+}
+
+// receiveUnitFromMint receives the proofs of a token in a unit other than the
+// unit of the wallet to its mint. The ReceiveFeePolicy and TrustPolicy are not
+// checked since the unit has to be enabled for the mint with AddMintUnit.
+func (w *Wallet) receiveUnitFromMint(token cashu.Token, unit cashu.Unit) (MintReceipt, error) {
+	if _, err := w.mintForUnit(token.Mint(), unit); err != nil {
+		return MintReceipt{}, err
+	}
+	keyset, err := w.getUnitActiveKeyset(token.Mint(), unit)
+	if err != nil {
+		return MintReceipt{}, fmt.Errorf("could not get active keyset: %v", err)
+	}
+	// the active keyset could have changed
+	mint, _ := w.getMint(token.Mint(), unit)
+
+	proofs, nut10Secret, err := w.receiveInputs(token.Proofs(), keyset)
+	if err != nil {
+		return MintReceipt{}, err
+	}
+	return w.receiveToMint(token, proofs, nut10Secret, &mint)
+}
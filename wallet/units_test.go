@@ -0,0 +1,134 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut01"
+	"github.com/elnosh/gonuts/cashu/nuts/nut02"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+func TestMintUnits(t *testing.T) {
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	satKeyset, _ := newTestKeyset(t, master, cashu.Sat, 0)
+	usdKeyset, _ := newTestKeyset(t, master, cashu.Usd, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/keysets":
+			json.NewEncoder(w).Encode(nut02.GetKeysetsResponse{Keysets: []nut02.Keyset{
+				{Id: satKeyset.Id, Unit: satKeyset.Unit, Active: true},
+				{Id: usdKeyset.Id, Unit: usdKeyset.Unit, Active: true},
+			}})
+		case "/v1/keys/" + satKeyset.Id:
+			json.NewEncoder(w).Encode(nut01.GetKeysResponse{Keysets: []nut01.Keyset{
+				{Id: satKeyset.Id, Unit: satKeyset.Unit, Keys: satKeyset.DerivePublic()},
+			}})
+		case "/v1/keys/" + usdKeyset.Id:
+			json.NewEncoder(w).Encode(nut01.GetKeysResponse{Keysets: []nut01.Keyset{
+				{Id: usdKeyset.Id, Unit: usdKeyset.Unit, Keys: usdKeyset.DerivePublic()},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	walletSeed, _ := hdkeychain.GenerateSeed(64)
+	db := storage.NewMemoryDB()
+	opts := Options{
+		Config: Config{CurrentMintURL: server.URL},
+		DB:     db,
+		Seed:   walletSeed,
+	}
+	w, err := NewWallet(opts)
+	if err != nil {
+		t.Fatalf("unexpected error creating wallet: %v", err)
+	}
+	if units := w.MintUnits(server.URL); !slices.Equal(units, []cashu.Unit{cashu.Sat}) {
+		t.Fatalf("expected only sat unit but got %v", units)
+	}
+	if _, err := w.SendInUnit(4, server.URL, cashu.Usd, false); !errors.Is(err, ErrUnitNotEnabled) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrUnitNotEnabled, err)
+	}
+	if err := w.AddMintUnit("http://127.0.0.1:1", cashu.Usd); !errors.Is(err, ErrMintNotExist) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrMintNotExist, err)
+	}
+
+	if err := w.AddMintUnit(server.URL, cashu.Usd); err != nil {
+		t.Fatalf("unexpected error adding unit: %v", err)
+	}
+	if units := w.MintUnits(server.URL); !slices.Equal(units, []cashu.Unit{cashu.Sat, cashu.Usd}) {
+		t.Fatalf("expected sat and usd units but got %v", units)
+	}
+	if err := w.AddMintUnit(server.URL, cashu.Eur); err == nil {
+		t.Fatal("expected error adding unit without active keyset")
+	}
+
+	db.SaveProofs(cashu.Proofs{
+		{Amount: 8, Id: satKeyset.Id, Secret: "sat1"},
+		{Amount: 2, Id: satKeyset.Id, Secret: "sat2"},
+		{Amount: 16, Id: usdKeyset.Id, Secret: "usd1"},
+		{Amount: 4, Id: usdKeyset.Id, Secret: "usd2"},
+	})
+	balances := w.GetBalanceByUnit()
+	if balances[cashu.Sat] != 10 || balances[cashu.Usd] != 20 {
+		t.Fatalf("expected balances of 10 sat and 20 usd but got %v", balances)
+	}
+	if w.GetBalance() != 10 {
+		t.Fatalf("expected balance of 10 but got %v", w.GetBalance())
+	}
+	if balance := w.GetUnitBalanceByMints(cashu.Usd)[server.URL]; balance != 20 {
+		t.Fatalf("expected usd balance of 20 for mint but got %v", balance)
+	}
+
+	// units are kept when loading the wallet again
+	opts.Seed = nil
+	w, err = NewWallet(opts)
+	if err != nil {
+		t.Fatalf("unexpected error creating wallet: %v", err)
+	}
+	if units := w.MintUnits(server.URL); !slices.Equal(units, []cashu.Unit{cashu.Sat, cashu.Usd}) {
+		t.Fatalf("expected sat and usd units after loading wallet but got %v", units)
+	}
+
+	proofs, err := w.SendInUnit(4, server.URL, cashu.Usd, false)
+	if err != nil {
+		t.Fatalf("unexpected error sending: %v", err)
+	}
+	if proofs.Amount() != 4 || proofs[0].Id != usdKeyset.Id {
+		t.Fatalf("expected usd proofs for 4 but got %v", proofs)
+	}
+	if balance := w.GetBalanceByUnit()[cashu.Usd]; balance != 16 {
+		t.Fatalf("expected usd balance of 16 but got %v", balance)
+	}
+
+	token, err := w.NewToken(proofs, server.URL, TokenV4, false)
+	if err != nil {
+		t.Fatalf("unexpected error creating token: %v", err)
+	}
+	if unit, _ := w.tokenUnit(token); unit != cashu.Usd {
+		t.Fatalf("expected token in usd but got '%v'", unit)
+	}
+
+	// proofs of usd keyset in token with a different unit
+	satToken, _ := cashu.NewTokenV4(proofs, server.URL, cashu.Sat, false)
+	if _, err := w.Receive(satToken, false); err == nil {
+		t.Fatal("expected error receiving token with proofs that do not match its unit")
+	}
+	eurToken, _ := cashu.NewTokenV4(cashu.Proofs{{Amount: 2, Id: "00aabbccddeeff00", Secret: "eur"}},
+		server.URL, cashu.Eur, false)
+	if _, err := w.Receive(eurToken, false); !errors.Is(err, ErrUnitNotEnabled) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrUnitNotEnabled, err)
+	}
+}
@@ -0,0 +1,183 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut10"
+	"github.com/elnosh/gonuts/cashu/nuts/nut12"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/client"
+)
+
+type DLEQStatus int
+
+const (
+	// proof did not include a DLEQ proof
+	DLEQMissing DLEQStatus = iota
+	DLEQValid
+	DLEQInvalid
+)
+
+func (status DLEQStatus) String() string {
+	switch status {
+	case DLEQMissing:
+		return "missing"
+	case DLEQValid:
+		return "valid"
+	case DLEQInvalid:
+		return "invalid"
+	default:
+		return "unknown"
+	}
+}
+
+// ProofValidation is the result of validating a proof against its mint
+type ProofValidation struct {
+	Proof cashu.Proof
+	Y     string
+	// false if the mint does not have the keyset of the proof
+	KnownKeyset bool
+	DLEQ        DLEQStatus
+	// state of the proof in the mint. Unknown if the keyset is not known
+	State nut07.State
+	// proof has a P2PK or HTLC spending condition
+	Locked bool
+}
+
+// Valid returns whether the proof is from a known keyset,
+// does not have an invalid DLEQ proof and is unspent.
+func (pv ProofValidation) Valid() bool {
+	return pv.KnownKeyset && pv.DLEQ != DLEQInvalid && pv.State == nut07.Unspent
+}
+
+// TokenValidation is the report from validating a token against its mint
+type TokenValidation struct {
+	Mint   string
+	Amount uint64
+	// amount of the proofs that are valid
+	ValidAmount uint64
+	Proofs      []ProofValidation
+}
+
+// Valid returns true if all the proofs in the token are valid
+func (tv TokenValidation) Valid() bool {
+	return tv.ValidAmount == tv.Amount && len(tv.Proofs) > 0
+}
+
+// ValidateToken checks the proofs in the token against the mint in it without
+// redeeming them. It fetches the keys for the keysets in the token, verifies
+// DLEQ proofs if present and checks the state of the proofs in the mint.
+// It does not need a wallet so it can be used to accept tokens that are
+// going to be forwarded somewhere else.
+func ValidateToken(token cashu.Token) (*TokenValidation, error) {
+	mintURL := token.Mint()
+	proofs := token.Proofs()
+	if len(proofs) == 0 {
+		return nil, errors.New("token has no proofs")
+	}
+
+	validation := &TokenValidation{
+		Mint:   mintURL,
+		Amount: token.Amount(),
+		Proofs: make([]ProofValidation, len(proofs)),
+	}
+
+	keysets := make(map[string]map[uint64]*secp256k1.PublicKey)
+	Ys := []string{}
+	for i, proof := range proofs {
+		keys, ok := keysets[proof.Id]
+		if !ok {
+			var err error
+			keys, err = getValidationKeys(mintURL, proof.Id)
+			if err != nil {
+				return nil, err
+			}
+			keysets[proof.Id] = keys
+		}
+
+		Y, err := crypto.HashToCurve([]byte(proof.Secret))
+		if err != nil {
+			return nil, err
+		}
+		Yhex := hex.EncodeToString(Y.SerializeCompressed())
+
+		proofValidation := ProofValidation{
+			Proof:       proof,
+			Y:           Yhex,
+			KnownKeyset: keys != nil,
+			State:       nut07.Unknown,
+		}
+
+		if proof.DLEQ != nil {
+			proofValidation.DLEQ = DLEQInvalid
+			if pubkey, ok := keys[proof.Amount]; ok && nut12.VerifyProofDLEQ(proof, pubkey) {
+				proofValidation.DLEQ = DLEQValid
+			}
+		}
+
+		if _, err := nut10.DeserializeSecret(proof.Secret); err == nil {
+			proofValidation.Locked = true
+		}
+
+		if proofValidation.KnownKeyset {
+			Ys = append(Ys, Yhex)
+		}
+		validation.Proofs[i] = proofValidation
+	}
+
+	if len(Ys) > 0 {
+		stateResponse, err := client.PostCheckProofState(mintURL, nut07.PostCheckStateRequest{Ys: Ys})
+		if err != nil {
+			return nil, fmt.Errorf("could not check proof states: %v", err)
+		}
+
+		states := make(map[string]nut07.State, len(stateResponse.States))
+		for _, state := range stateResponse.States {
+			states[state.Y] = state.State
+		}
+		for i, proofValidation := range validation.Proofs {
+			if state, ok := states[proofValidation.Y]; ok {
+				validation.Proofs[i].State = state
+			}
+		}
+	}
+
+	for _, proofValidation := range validation.Proofs {
+		if proofValidation.Valid() {
+			validation.ValidAmount += proofValidation.Proof.Amount
+		}
+	}
+
+	return validation, nil
+}
+
+// getValidationKeys returns the keys of the keyset or nil
+// if the keyset is not known by the mint
+func getValidationKeys(mintURL, id string) (map[uint64]*secp256k1.PublicKey, error) {
+	keysetsResponse, err := client.GetKeysetById(mintURL, id)
+	if err != nil {
+		var cashuErr cashu.Error
+		if errors.As(err, &cashuErr) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error getting keyset from mint: %v", err)
+	}
+	if len(keysetsResponse.Keysets) == 0 {
+		return nil, nil
+	}
+
+	keys, err := crypto.MapPubKeys(keysetsResponse.Keysets[0].Keys)
+	if err != nil {
+		return nil, err
+	}
+	// do not trust keys that do not match the id
+	if crypto.DeriveKeysetId(keys) != id {
+		return nil, nil
+	}
+	return keys, nil
+}
@@ -0,0 +1,149 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut01"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/crypto"
+)
+
+func TestValidateToken(t *testing.T) {
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	keyset, err := crypto.GenerateKeyset(master, 0, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+
+	validProof := signProof(t, keyset, 8, "secret1", true)
+	noDLEQProof := signProof(t, keyset, 2, "secret2", false)
+	spentProof := signProof(t, keyset, 4, "secret3", true)
+	invalidDLEQProof := signProof(t, keyset, 16, "secret4", true)
+	invalidDLEQProof.DLEQ.S = validProof.DLEQ.S
+	unknownKeysetProof := cashu.Proof{Amount: 1, Id: "00ffffffffffffff", Secret: "secret5", C: validProof.C}
+
+	spentY, _ := crypto.HashToCurve([]byte(spentProof.Secret))
+	spentYhex := hex.EncodeToString(spentY.SerializeCompressed())
+
+	var checkedYs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v1/keys/"+keyset.Id:
+			json.NewEncoder(w).Encode(nut01.GetKeysResponse{Keysets: []nut01.Keyset{
+				{Id: keyset.Id, Unit: keyset.Unit, Keys: keyset.DerivePublic()},
+			}})
+		case strings.HasPrefix(r.URL.Path, "/v1/keys/"):
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(cashu.UnknownKeysetErr)
+		case r.URL.Path == "/v1/checkstate":
+			var req nut07.PostCheckStateRequest
+			json.NewDecoder(r.Body).Decode(&req)
+			checkedYs = req.Ys
+
+			states := make([]nut07.ProofState, len(req.Ys))
+			for i, Y := range req.Ys {
+				states[i] = nut07.ProofState{Y: Y, State: nut07.Unspent}
+				if Y == spentYhex {
+					states[i].State = nut07.Spent
+				}
+			}
+			res := nut07.PostCheckStateResponse{States: states}
+			json.NewEncoder(w).Encode(&res)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	proofs := cashu.Proofs{validProof, noDLEQProof, spentProof, invalidDLEQProof, unknownKeysetProof}
+	token, err := cashu.NewTokenV3(proofs, server.URL, cashu.Sat, true)
+	if err != nil {
+		t.Fatalf("error creating token: %v", err)
+	}
+
+	validation, err := ValidateToken(token)
+	if err != nil {
+		t.Fatalf("unexpected error validating token: %v", err)
+	}
+
+	if validation.Valid() {
+		t.Fatal("expected token to not be valid")
+	}
+	if validation.Amount != 31 {
+		t.Fatalf("expected amount 31 but got %v", validation.Amount)
+	}
+	if validation.ValidAmount != 10 {
+		t.Fatalf("expected valid amount 10 but got %v", validation.ValidAmount)
+	}
+	if len(checkedYs) != 4 {
+		t.Fatalf("expected state of 4 proofs to be checked but got %v", len(checkedYs))
+	}
+
+	expected := []struct {
+		knownKeyset bool
+		dleq        DLEQStatus
+		state       nut07.State
+	}{
+		{true, DLEQValid, nut07.Unspent},
+		{true, DLEQMissing, nut07.Unspent},
+		{true, DLEQValid, nut07.Spent},
+		{true, DLEQInvalid, nut07.Unspent},
+		{false, DLEQMissing, nut07.Unknown},
+	}
+	for i, proofValidation := range validation.Proofs {
+		if proofValidation.KnownKeyset != expected[i].knownKeyset ||
+			proofValidation.DLEQ != expected[i].dleq ||
+			proofValidation.State != expected[i].state {
+			t.Fatalf("unexpected validation for proof %v: %+v", i, proofValidation)
+		}
+	}
+
+	validToken, _ := cashu.NewTokenV3(cashu.Proofs{validProof, noDLEQProof}, server.URL, cashu.Sat, true)
+	validation, err = ValidateToken(validToken)
+	if err != nil {
+		t.Fatalf("unexpected error validating token: %v", err)
+	}
+	if !validation.Valid() {
+		t.Fatalf("expected token to be valid: %+v", validation)
+	}
+}
+
+func signProof(t *testing.T, keyset *crypto.MintKeyset, amount uint64, secret string, withDLEQ bool) cashu.Proof {
+	r, _ := secp256k1.GeneratePrivateKey()
+	B_, r, err := crypto.BlindMessage(secret, r)
+	if err != nil {
+		t.Fatalf("error blinding message: %v", err)
+	}
+
+	k := keyset.Keys[amount].PrivateKey
+	C_ := crypto.SignBlindedMessage(B_, k)
+	C := crypto.UnblindSignature(C_, r, k.PubKey())
+
+	proof := cashu.Proof{
+		Amount: amount,
+		Id:     keyset.Id,
+		Secret: secret,
+		C:      hex.EncodeToString(C.SerializeCompressed()),
+	}
+	if withDLEQ {
+		e, s := crypto.GenerateDLEQ(k, B_, C_)
+		proof.DLEQ = &cashu.DLEQProof{
+			E: hex.EncodeToString(e.Serialize()),
+			S: hex.EncodeToString(s.Serialize()),
+			R: hex.EncodeToString(r.Serialize()),
+		}
+	}
+	return proof
+}
@@ -0,0 +1,248 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+	"github.com/elnosh/gonuts/wallet/client"
+)
+
+const (
+	// DefaultWaitTimeout is how long to wait for the state of a quote if not set
+	DefaultWaitTimeout = 10 * time.Minute
+	// DefaultWaitMinInterval is the first interval between checks of
+	// the state of a quote in mints without websockets if not set
+	DefaultWaitMinInterval = time.Second
+	// DefaultWaitMaxInterval is the longest interval between checks if not set
+	DefaultWaitMaxInterval = 30 * time.Second
+)
+
+var ErrWaitTimeout = errors.New("timed out waiting for quote state")
+
+// WaitOptions sets how long to wait for the state of a quote and how often
+// it is checked in mints that do not notify changes over websockets (NUT-17).
+// The interval between checks doubles from MinInterval up to MaxInterval
+// and is randomized so that wallets do not check at the same time.
+type WaitOptions struct {
+	Timeout     time.Duration
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+func (opts WaitOptions) withDefaults() WaitOptions {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultWaitTimeout
+	}
+	if opts.MinInterval <= 0 {
+		opts.MinInterval = DefaultWaitMinInterval
+	}
+	if opts.MaxInterval <= 0 {
+		opts.MaxInterval = DefaultWaitMaxInterval
+	}
+	opts.MaxInterval = max(opts.MaxInterval, opts.MinInterval)
+	return opts
+}
+
+// WaitForMintQuote waits until the invoice of the mint quote is paid
+// or the timeout, or the expiry of the quote if sooner, is reached.
+func (w *Wallet) WaitForMintQuote(
+	ctx context.Context,
+	quoteId string,
+	opts WaitOptions,
+) (*nut04.PostMintQuoteBolt11Response, error) {
+	quote := w.db.GetMintQuoteById(quoteId)
+	if quote == nil {
+		return nil, ErrQuoteNotFound
+	}
+	mint := quote.Mint
+	if len(mint) == 0 {
+		mint = w.defaultMint
+	}
+	if quote.QuoteExpiry > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.Unix(int64(quote.QuoteExpiry), 0))
+		defer cancel()
+	}
+
+	var state *nut04.PostMintQuoteBolt11Response
+	err := w.waitFor(ctx, mint, nut17.Bolt11MintQuote, quoteId, opts, func() (bool, error) {
+		response, err := w.MintQuoteState(quoteId)
+		if err != nil {
+			return false, err
+		}
+		state = response
+		return response.State != nut04.Unpaid, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// MintWhenPaid waits until the invoice of the mint quote
+// is paid and then mints the proofs for it.
+func (w *Wallet) MintWhenPaid(ctx context.Context, quoteId string, opts WaitOptions) (uint64, error) {
+	state, err := w.WaitForMintQuote(ctx, quoteId, opts)
+	if err != nil {
+		return 0, err
+	}
+	if state.State == nut04.Issued {
+		return 0, errors.New("quote has already been issued")
+	}
+	return w.MintTokens(quoteId)
+}
+
+// WaitForMeltQuote waits until the payment of a pending melt quote
+// succeeds or fails. If it fails, its proofs can be used again.
+func (w *Wallet) WaitForMeltQuote(
+	ctx context.Context,
+	quoteId string,
+	opts WaitOptions,
+) (*nut05.PostMeltQuoteBolt11Response, error) {
+	quote := w.db.GetMeltQuoteById(quoteId)
+	if quote == nil {
+		return nil, ErrQuoteNotFound
+	}
+
+	var state *nut05.PostMeltQuoteBolt11Response
+	err := w.waitFor(ctx, quote.Mint, nut17.Bolt11MeltQuote, quoteId, opts, func() (bool, error) {
+		response, err := w.CheckMeltQuoteState(quoteId)
+		if err != nil {
+			return false, err
+		}
+		state = response
+		return response.State != nut05.Pending, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// waitFor calls check until it returns true. If the mint supports notifications
+// of the kind over websockets, check is called when the mint notifies a change.
+// Otherwise, or if the websocket is closed, it is called with a backoff. Errors
+// from the mint are returned and other errors (i.e network) are retried.
+func (w *Wallet) waitFor(
+	ctx context.Context,
+	mint string,
+	kind nut17.SubscriptionKind,
+	filter string,
+	opts WaitOptions,
+	check func() (bool, error),
+) error {
+	opts = opts.withDefaults()
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	var lastErr error
+	checkState := func() (bool, error) {
+		done, err := check()
+		if err != nil {
+			var cashuErr cashu.Error
+			if errors.As(err, &cashuErr) {
+				return false, err
+			}
+			w.logDebugf("could not check state of %v '%v': %v", kind, filter, err)
+			lastErr = err
+			return false, nil
+		}
+		return done, nil
+	}
+	if done, err := checkState(); err != nil || done {
+		return err
+	}
+
+	notifications := w.subscribeForWait(ctx, mint, kind, filter)
+	interval := opts.MinInterval
+	var poll <-chan time.Time
+	var timer *time.Timer
+	if notifications == nil {
+		timer = time.NewTimer(jitter(interval))
+		poll = timer.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				if lastErr != nil {
+					return fmt.Errorf("%w: %v", ErrWaitTimeout, lastErr)
+				}
+				return ErrWaitTimeout
+			}
+			return ctx.Err()
+		case _, ok := <-notifications:
+			if !ok {
+				w.logErrorf("lost websocket connection to mint '%v'. Checking state of %v '%v' instead", mint, kind, filter)
+				notifications = nil
+				timer = time.NewTimer(jitter(interval))
+				poll = timer.C
+			}
+		case <-poll:
+			interval = min(interval*2, opts.MaxInterval)
+			timer.Reset(jitter(interval))
+		}
+
+		if done, err := checkState(); err != nil || done {
+			if timer != nil {
+				timer.Stop()
+			}
+			return err
+		}
+	}
+}
+
+// subscribeForWait subscribes to the changes of the filter if the mint supports
+// it. The channel gets a value for each notification and is closed if the
+// connection is lost. It returns nil if the mint does not support it.
+func (w *Wallet) subscribeForWait(
+	ctx context.Context,
+	mint string,
+	kind nut17.SubscriptionKind,
+	filter string,
+) <-chan struct{} {
+	info, err := client.GetMintInfo(mint)
+	if err != nil || !slices.Contains(nut17.SupportedKinds(*info, cashu.BOLT11_METHOD, w.unit.String()), kind) {
+		return nil
+	}
+	subscription, err := client.Subscribe(mint, kind, []string{filter})
+	if err != nil {
+		w.logErrorf("could not subscribe to %v from mint '%v': %v. Checking state instead", kind, mint, err)
+		return nil
+	}
+
+	notifications := make(chan struct{}, 1)
+	go func() {
+		defer close(notifications)
+		for {
+			if _, err := subscription.Read(); err != nil {
+				return
+			}
+			select {
+			case notifications <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		subscription.Close()
+	}()
+	return notifications
+}
+
+// jitter returns a random duration between 80% and 120% of d
+func jitter(d time.Duration) time.Duration {
+	return d*4/5 + rand.N(d*2/5+1)
+}
@@ -0,0 +1,175 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut06"
+	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+	"github.com/gorilla/websocket"
+)
+
+func TestWaitForQuotePolling(t *testing.T) {
+	var checks atomic.Int32
+	mux := http.NewServeMux()
+	// mint without websockets
+	mux.HandleFunc("/v1/info", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(nut06.MintInfo{Nuts: nut06.NutsMap{}})
+	})
+	mux.HandleFunc("/v1/mint/quote/bolt11/{id}", func(w http.ResponseWriter, r *http.Request) {
+		switch r.PathValue("id") {
+		case "paidquote":
+			state := nut04.Unpaid
+			if checks.Add(1) >= 3 {
+				state = nut04.Paid
+			}
+			json.NewEncoder(w).Encode(&nut04.PostMintQuoteBolt11Response{Quote: "paidquote", State: state})
+		case "unknownquote":
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(cashu.QuoteNotExistErr)
+		default:
+			json.NewEncoder(w).Encode(&nut04.PostMintQuoteBolt11Response{Quote: r.PathValue("id"), State: nut04.Unpaid})
+		}
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	db := storage.NewMemoryDB()
+	keyset := crypto.WalletKeyset{Id: "009a1f293253e41e", MintURL: server.URL}
+	w := &Wallet{
+		db:    db,
+		unit:  cashu.Sat,
+		mints: map[string]walletMint{server.URL: {mintURL: server.URL, activeKeyset: keyset}},
+	}
+	for _, quoteId := range []string{"paidquote", "unpaidquote", "unknownquote"} {
+		if err := db.SaveMintQuote(storage.MintQuote{QuoteId: quoteId, Mint: server.URL, State: nut04.Unpaid}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := WaitOptions{Timeout: 5 * time.Second, MinInterval: 10 * time.Millisecond, MaxInterval: 20 * time.Millisecond}
+
+	state, err := w.WaitForMintQuote(context.Background(), "paidquote", opts)
+	if err != nil {
+		t.Fatalf("unexpected error waiting for quote: %v", err)
+	}
+	if state.State != nut04.Paid || checks.Load() != 3 {
+		t.Fatalf("expected quote paid after 3 checks but got '%v' after %v", state.State, checks.Load())
+	}
+	if quote := db.GetMintQuoteById("paidquote"); quote.State != nut04.Paid {
+		t.Fatalf("expected quote state '%v' in db but got '%v'", nut04.Paid, quote.State)
+	}
+
+	opts.Timeout = 100 * time.Millisecond
+	if _, err := w.WaitForMintQuote(context.Background(), "unpaidquote", opts); !errors.Is(err, ErrWaitTimeout) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrWaitTimeout, err)
+	}
+
+	var cashuErr cashu.Error
+	if _, err := w.WaitForMintQuote(context.Background(), "unknownquote", opts); !errors.As(err, &cashuErr) {
+		t.Fatalf("expected error from mint but got '%v'", err)
+	}
+	if _, err := w.WaitForMintQuote(context.Background(), "notsaved", opts); !errors.Is(err, ErrQuoteNotFound) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrQuoteNotFound, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := w.WaitForMintQuote(ctx, "unpaidquote", opts); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected error '%v' but got '%v'", context.Canceled, err)
+	}
+}
+
+func TestWaitForQuoteWebsocket(t *testing.T) {
+	var paid atomic.Bool
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/info", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(nut06.MintInfo{Nuts: nut06.NutsMap{
+			17: nut17.Settings{Supported: []nut17.SupportedMethod{{
+				Method:   cashu.BOLT11_METHOD,
+				Unit:     cashu.Sat.String(),
+				Commands: []nut17.SubscriptionKind{nut17.Bolt11MeltQuote},
+			}}},
+		}})
+	})
+	mux.HandleFunc("/v1/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var request nut17.WsRequest
+		if err := conn.ReadJSON(&request); err != nil {
+			return
+		}
+		conn.WriteJSON(nut17.WsResponse{
+			JSONRPC: nut17.JSONRPC,
+			Result:  &nut17.Result{Status: "OK", SubId: request.Params.SubId},
+			Id:      request.Id,
+		})
+
+		time.Sleep(50 * time.Millisecond)
+		paid.Store(true)
+		payload, _ := json.Marshal(&nut05.PostMeltQuoteBolt11Response{Quote: "meltquote", State: nut05.Paid})
+		conn.WriteJSON(nut17.WsNotification{
+			JSONRPC: nut17.JSONRPC,
+			Method:  nut17.Subscribe,
+			Params:  nut17.NotificationParams{SubId: request.Params.SubId, Payload: payload},
+		})
+		conn.ReadMessage()
+	})
+	mux.HandleFunc("/v1/melt/quote/bolt11/{id}", func(w http.ResponseWriter, r *http.Request) {
+		state := nut05.Pending
+		if paid.Load() {
+			state = nut05.Paid
+		}
+		json.NewEncoder(w).Encode(&nut05.PostMeltQuoteBolt11Response{Quote: r.PathValue("id"), State: state})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	db := storage.NewMemoryDB()
+	keyset := crypto.WalletKeyset{Id: "009a1f293253e41e", MintURL: server.URL}
+	w := &Wallet{
+		db:    db,
+		unit:  cashu.Sat,
+		mints: map[string]walletMint{server.URL: {mintURL: server.URL, activeKeyset: keyset}},
+	}
+	meltQuote := storage.MeltQuote{QuoteId: "meltquote", Mint: server.URL, State: nut05.Pending, Amount: 10}
+	if err := db.SaveMeltQuote(meltQuote); err != nil {
+		t.Fatal(err)
+	}
+
+	// state is only checked again when notified
+	opts := WaitOptions{Timeout: 5 * time.Second, MinInterval: time.Hour}
+	state, err := w.WaitForMeltQuote(context.Background(), meltQuote.QuoteId, opts)
+	if err != nil {
+		t.Fatalf("unexpected error waiting for quote: %v", err)
+	}
+	if state.State != nut05.Paid {
+		t.Fatalf("expected quote state '%v' but got '%v'", nut05.Paid, state.State)
+	}
+	if quote := db.GetMeltQuoteById(meltQuote.QuoteId); quote.State != nut05.Paid {
+		t.Fatalf("expected quote state '%v' in db but got '%v'", nut05.Paid, quote.State)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for range 100 {
+		if d := jitter(time.Second); d < 800*time.Millisecond || d > 1200*time.Millisecond {
+			t.Fatalf("jitter of %v out of range", d)
+		}
+	}
+}
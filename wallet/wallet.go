@@ -1,14 +1,17 @@
 package wallet
 
 import (
+	"bytes"
+	"cmp"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
 	"math"
 	"net/url"
-	"os"
 	"slices"
 	"sort"
 	"sync"
@@ -31,6 +34,7 @@ import (
 	"github.com/elnosh/gonuts/cashu/nuts/nut15"
 	"github.com/elnosh/gonuts/crypto"
 	"github.com/elnosh/gonuts/wallet/client"
+	"github.com/elnosh/gonuts/wallet/lnurl"
 	"github.com/elnosh/gonuts/wallet/storage"
 	"github.com/tyler-smith/go-bip39"
 
@@ -41,6 +45,8 @@ var (
 	ErrMintNotExist            = errors.New("mint does not exist")
 	ErrInsufficientMintBalance = errors.New("not enough funds in selected mint")
 	ErrQuoteNotFound           = errors.New("quote not found")
+	ErrDescriptionNotSupported = errors.New("mint does not support descriptions in mint quotes")
+	ErrSwapLossTooHigh         = errors.New("fees for swap between mints are higher than max loss")
 )
 
 type Wallet struct {
@@ -54,37 +60,143 @@ type Wallet struct {
 
 	// list of mints that have been trusted
 	mints map[string]walletMint
+	// keysets of the mints in units other than the unit
+	// of the wallet that were enabled with AddMintUnit
+	unitMints map[string]map[cashu.Unit]walletMint
+
+	// optional provider for converting amounts to other currencies
+	priceProvider PriceProvider
+
+	trustPolicy TrustPolicy
+	// limits on sends and melts
+	spendingPolicy SpendingPolicy
+
+	// max amount that can be lost to fees when moving funds between mints
+	maxSwapLoss uint64
+
+	// swap proofs received again so they can't be linked to the token
+	refreshAfterReceive bool
+	// limits on fees to receive tokens
+	receiveFeePolicy ReceiveFeePolicy
+	// format of the tokens created
+	tokenVersion TokenVersion
+
+	// check counters with the mint before using them
+	checkCounters bool
+	// conflicts with other devices using the seed found since loaded
+	counterConflicts []CounterConflict
+
+	logger     *slog.Logger
+	logSecrets bool
+
+	// report of the last call to Reconcile
+	lastReconcile *ReconcileReport
+
+	// handlers for proofs locked with custom NUT-10 kinds
+	conditionHandlers map[nut10.SecretKind]ConditionHandler
 }
 
 type walletMint struct {
 	mintURL         string
 	activeKeyset    crypto.WalletKeyset
 	inactiveKeysets map[string]crypto.WalletKeyset
+	trustLevel      storage.TrustLevel
+	// unit of the keysets
+	unit cashu.Unit
 }
 
 type Config struct {
 	WalletPath     string
 	CurrentMintURL string
-}
 
-func InitStorage(path string) (storage.WalletDB, error) {
-	// bolt db atm
-	return storage.InitBolt(path)
+	// PriceProvider is optional. If set, it is used to convert
+	// amounts to other currencies for display. Prices are cached
+	// for PriceCacheDuration (DefaultPriceCacheDuration if not set).
+	PriceProvider      PriceProvider
+	PriceCacheDuration time.Duration
+
+	// TrustPolicy sets limits on mints that get added
+	// automatically when receiving tokens from them.
+	TrustPolicy TrustPolicy
+
+	// SpendingPolicy sets limits on sends and melts
+	// that need to be confirmed if exceeded.
+	SpendingPolicy SpendingPolicy
+
+	// MaxSwapLoss is the max amount that can be lost to fees when moving
+	// funds between mints (MintSwap or receiving to the default mint).
+	// No limit if 0.
+	MaxSwapLoss uint64
+
+	// RefreshAfterReceive swaps the proofs received in a token to the same mint
+	// again for new ones. The mint can't link the proofs kept in the wallet to
+	// the token received at the cost of the fees for the additional swap.
+	RefreshAfterReceive bool
+
+	// ReceiveFeePolicy rejects tokens that cost too much in fees to receive.
+	ReceiveFeePolicy ReceiveFeePolicy
+
+	// TokenVersion is the format of the tokens created by the wallet
+	// unless overridden when sending. TokenV4 if not set.
+	TokenVersion TokenVersion
+
+	// DisableCounterCheck stops the wallet from checking with the mint that
+	// the counters it is about to use to derive outputs were not used by
+	// another device with the same seed. Conflicts found are in CounterConflicts.
+	DisableCounterCheck bool
+
+	// QuoteRetention is how long mint and melt quotes that are done are
+	// kept in the db. Stale quotes are removed when the wallet is loaded.
+	// Quotes are kept forever if 0.
+	QuoteRetention time.Duration
+
+	// ConditionHandlers create the secrets and witnesses for proofs locked
+	// with custom NUT-10 kinds registered with nut10.RegisterKind.
+	ConditionHandlers map[nut10.SecretKind]ConditionHandler
+
+	// Logger is optional. Nothing is logged if not set.
+	// Secrets in logs are redacted unless LogSecrets is set.
+	Logger     *slog.Logger
+	LogSecrets bool
 }
 
-func LoadWallet(config Config) (*Wallet, error) {
-	path := config.WalletPath
-	if err := os.MkdirAll(path, 0700); err != nil {
-		return nil, err
-	}
+// Options to create a wallet with NewWallet
+type Options struct {
+	// Config of the wallet. WalletPath is not used.
+	Config
 
-	db, err := InitStorage(path)
-	if err != nil {
-		return nil, fmt.Errorf("InitStorage: %v", err)
+	// DB where the wallet state is kept. Use storage.NewMemoryDB
+	// for a wallet that is not persisted.
+	DB storage.WalletDB
+
+	// Seed of the wallet. If the DB already has a seed it has to be
+	// the same. A new one is generated if neither has one.
+	Seed []byte
+}
+
+// NewWallet creates a wallet with the DB in the options.
+// Unlike LoadWallet, nothing is written to the filesystem by it.
+func NewWallet(opts Options) (*Wallet, error) {
+	if opts.DB == nil {
+		return nil, errors.New("wallet db is required")
 	}
+	db := opts.DB
+	config := opts.Config
 
 	seed := db.GetSeed()
-	if len(seed) == 0 {
+	if len(opts.Seed) > 0 {
+		if len(seed) > 0 && !bytes.Equal(seed, opts.Seed) {
+			return nil, errors.New("seed does not match the one in the wallet db")
+		}
+		if len(seed) == 0 {
+			// check it is a valid seed before saving it
+			if _, err := hdkeychain.NewMaster(opts.Seed, &chaincfg.MainNetParams); err != nil {
+				return nil, fmt.Errorf("invalid seed: %v", err)
+			}
+			seed = opts.Seed
+			db.SaveMnemonicSeed("", seed)
+		}
+	} else if len(seed) == 0 {
 		// create and save new seed if none existed previously
 		entropy, err := bip39.NewEntropy(128)
 		if err != nil {
@@ -111,8 +223,33 @@ func LoadWallet(config Config) (*Wallet, error) {
 		return nil, err
 	}
 
-	wallet := &Wallet{db: db, unit: cashu.Sat, masterKey: masterKey, privateKey: privateKey}
-	wallet.mints, err = wallet.loadWalletMints()
+	wallet := &Wallet{
+		db:                  db,
+		unit:                cashu.Sat,
+		masterKey:           masterKey,
+		privateKey:          privateKey,
+		trustPolicy:         config.TrustPolicy,
+		spendingPolicy:      config.SpendingPolicy,
+		maxSwapLoss:         config.MaxSwapLoss,
+		refreshAfterReceive: config.RefreshAfterReceive,
+		receiveFeePolicy:    config.ReceiveFeePolicy,
+		tokenVersion:        config.TokenVersion,
+		checkCounters:       !config.DisableCounterCheck,
+		logger:              config.Logger,
+		logSecrets:          config.LogSecrets,
+	}
+	if err := checkConditionHandlers(config.ConditionHandlers); err != nil {
+		return nil, err
+	}
+	wallet.conditionHandlers = maps.Clone(config.ConditionHandlers)
+	if config.PriceProvider != nil {
+		cacheDuration := config.PriceCacheDuration
+		if cacheDuration == 0 {
+			cacheDuration = DefaultPriceCacheDuration
+		}
+		wallet.priceProvider = NewCachedPriceProvider(config.PriceProvider, cacheDuration)
+	}
+	wallet.mints, wallet.unitMints, err = wallet.loadWalletMints()
 	if err != nil {
 		return nil, err
 	}
@@ -138,6 +275,12 @@ func LoadWallet(config Config) (*Wallet, error) {
 		}
 	}
 
+	if config.QuoteRetention > 0 {
+		if _, err := wallet.RemoveStaleQuotes(config.QuoteRetention); err != nil {
+			return nil, err
+		}
+	}
+
 	return wallet, nil
 }
 
@@ -147,6 +290,10 @@ func (w *Wallet) Shutdown() error {
 
 // AddMint adds the mint to the list of mints trusted by the wallet
 func (w *Wallet) AddMint(mint string) (*walletMint, error) {
+	return w.addMint(mint, storage.Trusted)
+}
+
+func (w *Wallet) addMint(mint string, trustLevel storage.TrustLevel) (*walletMint, error) {
 	url, err := url.Parse(mint)
 	if err != nil {
 		return nil, fmt.Errorf("invalid mint url: %v", err)
@@ -174,15 +321,19 @@ func (w *Wallet) AddMint(mint string) (*walletMint, error) {
 		keyset.PublicKeys = make(map[uint64]*secp256k1.PublicKey)
 		inactiveKeysets[i] = keyset
 	}
-	newWalletMint := walletMint{mintURL, *activeKeyset, inactiveKeysets}
+	if err := w.db.SaveMintTrustLevel(mintURL, trustLevel); err != nil {
+		return nil, err
+	}
+	newWalletMint := walletMint{mintURL, *activeKeyset, inactiveKeysets, trustLevel, w.unit}
 	w.mints[mintURL] = newWalletMint
 
 	return &newWalletMint, nil
 }
 
-// GetBalance returns the total balance aggregated from all proofs
+// GetBalance returns the total balance aggregated from the proofs of all
+// mints in the unit of the wallet (sat). Use GetBalanceByUnit for other units.
 func (w *Wallet) GetBalance() uint64 {
-	return w.db.GetProofs().Amount()
+	return w.GetBalanceByUnit()[w.unit]
 }
 
 // GetBalanceByMints returns a map of string mint
@@ -191,20 +342,21 @@ func (w *Wallet) GetBalanceByMints() map[string]uint64 {
 	mintsBalances := make(map[string]uint64)
 
 	for _, mint := range w.mints {
-		proofs := w.db.GetProofsByKeysetId(mint.activeKeyset.Id)
-		mintBalance := proofs.Amount()
-
-		for _, keyset := range mint.inactiveKeysets {
-			proofs := w.db.GetProofsByKeysetId(keyset.Id)
-			mintBalance += proofs.Amount()
-		}
-
-		mintsBalances[mint.mintURL] = mintBalance
+		mintsBalances[mint.mintURL] = w.mintBalance(&mint)
 	}
 
 	return mintsBalances
 }
 
+// mintBalance returns the amount of the proofs of the keysets of the mint
+func (w *Wallet) mintBalance(mint *walletMint) uint64 {
+	balance := w.db.GetProofsByKeysetId(mint.activeKeyset.Id).Amount()
+	for _, keyset := range mint.inactiveKeysets {
+		balance += w.db.GetProofsByKeysetId(keyset.Id).Amount()
+	}
+	return balance
+}
+
 func (w *Wallet) PendingBalance() uint64 {
 	return amount(w.db.GetPendingProofs())
 }
@@ -219,14 +371,58 @@ func amount(proofs []storage.DBProof) uint64 {
 
 // RequestMint requests a mint quote to the mint for the specified amount
 func (w *Wallet) RequestMint(amount uint64, mint string) (*nut04.PostMintQuoteBolt11Response, error) {
-	selectedMint, ok := w.mints[mint]
-	if !ok {
-		return nil, ErrMintNotExist
+	return w.requestMint(amount, mint, w.unit, "")
+}
+
+// RequestMintWithDescription requests a mint quote for the amount with the
+// description as the memo of the invoice. The mint has to support the description
+// option (NUT-04) or ErrDescriptionNotSupported is returned. The mint can remove
+// characters from the description that would not be shown properly.
+func (w *Wallet) RequestMintWithDescription(
+	amount uint64,
+	mint string,
+	description string,
+) (*nut04.PostMintQuoteBolt11Response, error) {
+	return w.requestMint(amount, mint, w.unit, description)
+}
+
+// RequestMintInUnit requests a mint quote for the amount in the unit,
+// which has to be enabled for the mint with AddMintUnit unless it is
+// the unit of the wallet. The proofs minted for it are in the unit.
+func (w *Wallet) RequestMintInUnit(
+	amount uint64,
+	mint string,
+	unit cashu.Unit,
+) (*nut04.PostMintQuoteBolt11Response, error) {
+	return w.requestMint(amount, mint, unit, "")
+}
+
+func (w *Wallet) requestMint(
+	amount uint64,
+	mint string,
+	unit cashu.Unit,
+	description string,
+) (*nut04.PostMintQuoteBolt11Response, error) {
+	selectedMint, err := w.mintForUnit(mint, unit)
+	if err != nil {
+		return nil, err
+	}
+	if len(description) > 0 {
+		info, err := client.GetMintInfo(selectedMint.mintURL)
+		if err != nil {
+			return nil, fmt.Errorf("error getting info from mint: %v", err)
+		}
+		setting, ok := info.MethodSetting(4, cashu.BOLT11_METHOD, unit.String())
+		if !ok || setting.Options == nil || !setting.Options.Description {
+			return nil, ErrDescriptionNotSupported
+		}
 	}
 
-	mintRequest := nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: w.unit.String()}
+	mintRequest := nut04.PostMintQuoteBolt11Request{Amount: amount, Unit: unit.String(), Description: description}
+	w.logDebugf("requesting mint quote for amount %v from mint '%v'", amount, selectedMint.mintURL)
 	mintResponse, err := client.PostMintQuoteBolt11(selectedMint.mintURL, mintRequest)
 	if err != nil {
+		w.logErrorf("mint quote request to '%v' failed: %v", selectedMint.mintURL, err)
 		return nil, err
 	}
 
@@ -240,15 +436,17 @@ func (w *Wallet) RequestMint(amount uint64, mint string) (*nut04.PostMintQuoteBo
 		Mint:           selectedMint.mintURL,
 		Method:         cashu.BOLT11_METHOD,
 		State:          mintResponse.State,
-		Unit:           w.unit.String(),
+		Unit:           unit.String(),
 		Amount:         amount,
 		PaymentRequest: mintResponse.Request,
 		CreatedAt:      int64(bolt11.CreatedAt),
 		QuoteExpiry:    mintResponse.Expiry,
+		Description:    description,
 	}
 	if err := w.db.SaveMintQuote(quote); err != nil {
 		return nil, fmt.Errorf("error saving mint quote: %v", err)
 	}
+	w.logInfof("got mint quote '%v' for amount %v from mint '%v'", quote.QuoteId, amount, quote.Mint)
 
 	return mintResponse, nil
 }
@@ -258,6 +456,9 @@ func (w *Wallet) MintQuoteState(quoteId string) (*nut04.PostMintQuoteBolt11Respo
 	if quote == nil {
 		return nil, ErrQuoteNotFound
 	}
+	if quote.Method == cashu.BOLT12_METHOD {
+		return nil, fmt.Errorf("quote '%v' is for a bolt12 offer", quoteId)
+	}
 
 	mint := quote.Mint
 	if len(quote.Mint) == 0 {
@@ -276,8 +477,12 @@ func (w *Wallet) MintQuoteState(quoteId string) (*nut04.PostMintQuoteBolt11Respo
 
 	mintQuote, err := client.GetMintQuoteState(mint, quoteId)
 	if err != nil {
+		w.logErrorf("could not get state of mint quote '%v' from '%v': %v", quoteId, mint, err)
 		return nil, err
 	}
+	if mintQuote.State != quote.State {
+		w.logInfof("mint quote '%v' changed state from '%v' to '%v'", quoteId, quote.State, mintQuote.State)
+	}
 	quote.State = mintQuote.State
 	if mintQuote.State == nut04.Issued {
 		quote.SettledAt = time.Now().Unix()
@@ -296,9 +501,38 @@ func (w *Wallet) MintQuoteState(quoteId string) (*nut04.PostMintQuoteBolt11Respo
 // If successful, it will unblind the signatures to generate proofs
 // and store the proofs in the db.
 func (w *Wallet) MintTokens(quoteId string) (uint64, error) {
+	proofs, err := w.mintTokens(quoteId)
+	if err != nil {
+		return 0, err
+	}
+	amount := proofs.Amount()
+	quote := w.db.GetMintQuoteById(quoteId)
+	if unit, _ := w.parseUnit(quote.Unit); unit == w.unit {
+		w.recordTransaction(storage.MintTransaction, quote.Mint, amount, 0, quoteId)
+	}
+	return amount, nil
+}
+
+// mintTokens mints the proofs for a paid quote
+// without saving it in the transaction history
+func (w *Wallet) mintTokens(quoteId string) (cashu.Proofs, error) {
+	quote := w.db.GetMintQuoteById(quoteId)
+	if quote == nil {
+		return nil, ErrQuoteNotFound
+	}
+	unit, err := w.parseUnit(quote.Unit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unit of quote: %v", err)
+	}
+	return retryOnSignedOutputs(w, cmp.Or(quote.Mint, w.defaultMint), unit, func() (cashu.Proofs, error) {
+		return w.mintQuoteTokens(quoteId)
+	})
+}
+
+func (w *Wallet) mintQuoteTokens(quoteId string) (cashu.Proofs, error) {
 	quote := w.db.GetMintQuoteById(quoteId)
 	if quote == nil {
-		return 0, ErrQuoteNotFound
+		return nil, ErrQuoteNotFound
 	}
 
 	mint := quote.Mint
@@ -309,77 +543,143 @@ func (w *Wallet) MintTokens(quoteId string) (uint64, error) {
 
 	mintQuote, err := w.MintQuoteState(quoteId)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	if mintQuote.State == nut04.Unpaid {
-		return 0, errors.New("payment request has not paid")
+		if quoteExpired(quote.QuoteExpiry, time.Now()) {
+			return nil, ErrQuoteExpired
+		}
+		return nil, errors.New("payment request has not paid")
 	}
 	if mintQuote.State == nut04.Issued {
-		return 0, errors.New("quote has already been issued")
+		return nil, errors.New("quote has already been issued")
 	}
 
-	activeKeyset, err := w.getActiveKeyset(mint)
+	unit, err := w.parseUnit(quote.Unit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unit of quote: %v", err)
+	}
+	activeKeyset, err := w.getUnitActiveKeyset(mint, unit)
 	if err != nil {
-		return 0, fmt.Errorf("error getting active sat keyset: %v", err)
+		return nil, fmt.Errorf("error getting active %v keyset: %v", unit, err)
 	}
 	// get counter for keyset
 	counter := w.counterForKeyset(activeKeyset.Id)
 
-	split := w.splitWalletTarget(quote.Amount, mint)
+	selectedMint, _ := w.getMint(mint, unit)
+	split := w.splitWalletTarget(quote.Amount, &selectedMint)
 	blindedMessages, secrets, rs, err := w.createBlindedMessages(split, activeKeyset.Id, &counter)
 	if err != nil {
-		return 0, fmt.Errorf("error creating blinded messages: %v", err)
+		return nil, fmt.Errorf("error creating blinded messages: %v", err)
 	}
 
 	// request mint to sign the blinded messages
 	postMintRequest := nut04.PostMintBolt11Request{Quote: quoteId, Outputs: blindedMessages}
+	w.logDebugf("requesting signatures for %v outputs for mint quote '%v'", len(blindedMessages), quoteId)
 	mintResponse, err := client.PostMintBolt11(mint, postMintRequest)
 	if err != nil {
-		return 0, err
+		w.logErrorf("minting for quote '%v' at '%v' failed: %v", quoteId, mint, err)
+		return nil, err
 	}
 
 	// unblind the signatures from the promises and build the proofs
 	proofs, err := constructProofs(mintResponse.Signatures, blindedMessages, secrets, rs, activeKeyset)
 	if err != nil {
-		return 0, fmt.Errorf("error constructing proofs: %v", err)
+		return nil, fmt.Errorf("error constructing proofs: %v", err)
 	}
 
 	// store proofs in db
 	if err := w.db.SaveProofs(proofs); err != nil {
-		return 0, fmt.Errorf("error storing proofs: %v", err)
+		return nil, fmt.Errorf("error storing proofs: %v", err)
 	}
 
 	// only increase counter if mint was successful
 	if err := w.db.IncrementKeysetCounter(activeKeyset.Id, uint32(len(blindedMessages))); err != nil {
-		return 0, fmt.Errorf("error incrementing keyset counter: %v", err)
+		return nil, fmt.Errorf("error incrementing keyset counter: %v", err)
 	}
 
 	quote.State = nut04.Issued
 	quote.SettledAt = time.Now().Unix()
 	if err = w.db.SaveMintQuote(*quote); err != nil {
-		return 0, err
+		return nil, err
 	}
+	w.logInfof("minted %v from quote '%v' at mint '%v'", proofs.Amount(), quoteId, mint)
+
+	return proofs, nil
+}
 
-	return proofs.Amount(), nil
+// SendResult is the result of a send with the proofs and what was paid for them
+type SendResult struct {
+	Proofs cashu.Proofs
+	// amount of the proofs sent. It includes the fees for
+	// the receiver if they were included.
+	Amount uint64
+	// fees paid to the mint to swap for the proofs to send.
+	// It is 0 if the proofs were selected without a swap.
+	Fees uint64
+	// fees included in the proofs for the receiver to swap them
+	ReceiverFees uint64
+	// keysets of the proofs sent
+	Keysets  []string
+	Duration time.Duration
 }
 
 // Send will return proofs for the given amount
 func (w *Wallet) Send(amount uint64, mintURL string, includeFees bool) (cashu.Proofs, error) {
+	result, err := w.SendWithResult(amount, mintURL, includeFees)
+	if err != nil {
+		return nil, err
+	}
+	return result.Proofs, nil
+}
+
+// SendWithResult returns proofs for the given amount like Send
+// along with the fees paid and the keysets of the proofs
+func (w *Wallet) SendWithResult(amount uint64, mintURL string, includeFees bool) (SendResult, error) {
+	start := time.Now()
 	selectedMint, ok := w.mints[mintURL]
 	if !ok {
-		return nil, ErrMintNotExist
+		return SendResult{}, ErrMintNotExist
+	}
+	if err := w.checkSpendingPolicy(mintURL, amount); err != nil {
+		return SendResult{}, err
 	}
 
+	balance := w.GetBalanceByMints()[mintURL]
 	proofsToSend, err := w.getProofsForAmount(amount, &selectedMint, includeFees)
 	if err != nil {
-		return nil, err
+		return SendResult{}, err
 	}
 
 	if err := w.db.AddPendingProofs(proofsToSend); err != nil {
-		return nil, fmt.Errorf("could not save proofs to pending: %v\n", err)
+		return SendResult{}, fmt.Errorf("could not save proofs to pending: %v\n", err)
 	}
+	w.recordSpent(storage.SendTransaction, mintURL, proofsToSend.Amount(), balance, "")
 
-	return proofsToSend, nil
+	// what left the balance and was not sent went to the mint in a swap
+	spent := balance - min(balance, w.GetBalanceByMints()[mintURL])
+	result := SendResult{
+		Proofs:   proofsToSend,
+		Amount:   proofsToSend.Amount(),
+		Fees:     spent - min(spent, proofsToSend.Amount()),
+		Keysets:  proofsKeysets(proofsToSend),
+		Duration: time.Since(start),
+	}
+	if includeFees {
+		result.ReceiverFees = uint64(feesForProofs(proofsToSend, &selectedMint))
+	}
+	return result, nil
+}
+
+// proofsKeysets returns the ids of the keysets of the proofs
+func proofsKeysets(proofs cashu.Proofs) []string {
+	var keysets []string
+	for _, proof := range proofs {
+		if !slices.Contains(keysets, proof.Id) {
+			keysets = append(keysets, proof.Id)
+		}
+	}
+	return keysets
 }
 
 // SendToPubkey returns proofs that are locked to the passed pubkey
@@ -394,6 +694,9 @@ func (w *Wallet) SendToPubkey(
 	if !ok {
 		return nil, ErrMintNotExist
 	}
+	if err := w.checkSpendingPolicy(mintURL, amount); err != nil {
+		return nil, err
+	}
 
 	// check first if mint supports P2PK NUT
 	mintInfo, err := client.GetMintInfo(mintURL)
@@ -418,10 +721,16 @@ func (w *Wallet) SendToPubkey(
 		Data: hexPubkey,
 		Tags: serializedTags,
 	}
+	balance := w.GetBalanceByMints()[mintURL]
 	lockedProofs, err := w.swapToSend(amount, &selectedMint, &p2pkSpendingCondition, includeFees)
 	if err != nil {
 		return nil, err
 	}
+	w.recordSpent(storage.SendTransaction, mintURL, lockedProofs.Amount(), balance, hexPubkey)
+	// proofs were already swapped so they are returned even if they could not be saved
+	if _, err := w.saveLockedSend(lockedProofs, mintURL); err != nil {
+		w.logErrorf("could not save locked proofs sent: %v", err)
+	}
 
 	return lockedProofs, nil
 }
@@ -438,6 +747,9 @@ func (w *Wallet) HTLCLockedProofs(
 	if !ok {
 		return nil, ErrMintNotExist
 	}
+	if err := w.checkSpendingPolicy(mintURL, amount); err != nil {
+		return nil, err
+	}
 
 	// check first if mint supports HTLC NUT
 	mintInfo, err := client.GetMintInfo(mintURL)
@@ -465,41 +777,192 @@ func (w *Wallet) HTLCLockedProofs(
 		Data: hash,
 		Tags: serializedTags,
 	}
+	balance := w.GetBalanceByMints()[mintURL]
 	lockedProofs, err := w.swapToSend(amount, &selectedMint, &htlcSpendingCondition, includeFees)
 	if err != nil {
 		return nil, err
 	}
+	w.recordSpent(storage.SendTransaction, mintURL, lockedProofs.Amount(), balance, hash)
+	// proofs were already swapped so they are returned even if they could not be saved
+	if _, err := w.saveLockedSend(lockedProofs, mintURL); err != nil {
+		w.logErrorf("could not save locked proofs sent: %v", err)
+	}
 
 	return lockedProofs, nil
 }
 
 // Receives Cashu token. If swap is true, it will swap the funds to the configured default mint.
 // If false, it will add the proofs from the mint and add that mint to the list of trusted mints.
+// Tokens for which the fees exceed the ReceiveFeePolicy are rejected with a *ReceiveFeeError.
+// V3 tokens with proofs from several mints are received from each mint and only the proofs
+// from mints not in the wallet are swapped. If receiving from some of the mints fails, it
+// returns the amount received from the rest with the error.
 func (w *Wallet) Receive(token cashu.Token, swapToTrusted bool) (uint64, error) {
+	result, err := w.receive(token, swapToTrusted, true)
+	return result.Received, err
+}
+
+// ReceiveIgnoringFeePolicy receives the token like Receive
+// even if the fees exceed the ReceiveFeePolicy.
+func (w *Wallet) ReceiveIgnoringFeePolicy(token cashu.Token, swapToTrusted bool) (uint64, error) {
+	result, err := w.receive(token, swapToTrusted, false)
+	return result.Received, err
+}
+
+// ReceiveResult is the result of receiving a token
+type ReceiveResult struct {
+	// amount of the token
+	Amount uint64
+	// amount received after fees
+	Received uint64
+	// fees paid to the mints to receive the token
+	Fees uint64
+	// number of proofs received
+	ProofsCount int
+	// keyset of the proofs received. It is empty if they
+	// are from more than one keyset, see the Receipts.
+	KeysetId string
+	// what was received from each of the mints in the token
+	Receipts []MintReceipt
+	Duration time.Duration
+}
+
+// ReceiveWithResult receives the token like Receive and returns
+// the fees paid and the proofs received from each mint in it.
+func (w *Wallet) ReceiveWithResult(token cashu.Token, swapToTrusted bool) (ReceiveResult, error) {
+	return w.receive(token, swapToTrusted, true)
+}
+
+// MintReceipt is the result of receiving the proofs
+// of a token that were from one of its mints
+type MintReceipt struct {
+	Mint string
+	// amount of the proofs from the mint in the token
+	Amount uint64
+	// amount received after fees. If the proofs were swapped
+	// to the default mint, it is the amount received there.
+	Received uint64
+	// input fees paid to the mint and, if the proofs
+	// were swapped, the lightning fees to the default mint
+	Fees uint64
+	// number of proofs received
+	ProofsCount int
+	// keyset of the proofs received
+	KeysetId string
+	Err      error
+}
+
+// ReceiveByMint receives the token like Receive and returns what was received from
+// each of the mints in it. The proofs from each mint are received separately so
+// the ones from a mint are received even if receiving from another one fails.
+// The error returned has the errors of the mints that failed.
+func (w *Wallet) ReceiveByMint(token cashu.Token, swapToTrusted bool) ([]MintReceipt, error) {
+	return w.receiveByMint(token, swapToTrusted, true)
+}
+
+func (w *Wallet) receive(token cashu.Token, swapToTrusted, checkFees bool) (ReceiveResult, error) {
+	start := time.Now()
+	receipts, err := w.receiveByMint(token, swapToTrusted, checkFees)
+	result := ReceiveResult{Amount: token.Amount(), Receipts: receipts}
+	var keysets []string
+	for _, receipt := range receipts {
+		result.Received += receipt.Received
+		result.Fees += receipt.Fees
+		result.ProofsCount += receipt.ProofsCount
+		if len(receipt.KeysetId) > 0 && !slices.Contains(keysets, receipt.KeysetId) {
+			keysets = append(keysets, receipt.KeysetId)
+		}
+	}
+	if len(keysets) == 1 {
+		result.KeysetId = keysets[0]
+	}
+	result.Duration = time.Since(start)
+	if len(receipts) == 1 {
+		return result, receipts[0].Err
+	}
+	return result, err
+}
+
+func (w *Wallet) receiveByMint(token cashu.Token, swapToTrusted, checkFees bool) ([]MintReceipt, error) {
+	tokens := tokensByMint(token)
+	if len(tokens) > 1 {
+		w.logInfof("receiving token with proofs from %v mints", len(tokens))
+	}
+
+	receipts := make([]MintReceipt, len(tokens))
+	var errs []error
+	for i, mintToken := range tokens {
+		swap := swapToTrusted
+		if _, ok := w.mints[mintToken.Mint()]; ok && len(tokens) > 1 {
+			// proofs from mints already in the wallet are kept there
+			swap = false
+		}
+		receipt, err := w.receiveFromMint(mintToken, swap, checkFees)
+		receipt.Mint = mintToken.Mint()
+		receipt.Amount = mintToken.Amount()
+		receipt.Err = err
+		receipts[i] = receipt
+		if err != nil {
+			if len(tokens) > 1 {
+				w.logErrorf("could not receive proofs from mint '%v': %v", mintToken.Mint(), err)
+				err = fmt.Errorf("mint '%v': %w", mintToken.Mint(), err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return receipts, errors.Join(errs...)
+}
+
+// tokensByMint splits V3 tokens that have proofs from several mints
+// in a token for each mint. Other tokens are returned as they are.
+func tokensByMint(token cashu.Token) []cashu.Token {
+	var tokenV3 cashu.TokenV3
+	switch t := token.(type) {
+	case *cashu.TokenV3:
+		tokenV3 = *t
+	case cashu.TokenV3:
+		tokenV3 = t
+	default:
+		return []cashu.Token{token}
+	}
+
+	split := tokenV3.SplitByMint()
+	if len(split) <= 1 {
+		return []cashu.Token{token}
+	}
+	tokens := make([]cashu.Token, len(split))
+	for i, t := range split {
+		tokens[i] = t
+	}
+	return tokens
+}
+
+// receiveFromMint receives the proofs of a token from a single mint
+func (w *Wallet) receiveFromMint(token cashu.Token, swapToTrusted, checkFees bool) (MintReceipt, error) {
 	proofsToSwap := token.Proofs()
 	tokenMint := token.Mint()
+	w.logDebugf("receiving token with %v from mint '%v'", w.proofsLog(proofsToSwap), tokenMint)
 
-	keyset, err := w.getActiveKeyset(tokenMint)
+	unit, err := w.tokenUnit(token)
 	if err != nil {
-		return 0, fmt.Errorf("could not get active keyset: %v", err)
+		return MintReceipt{}, err
+	}
+	if err := w.checkProofsUnit(proofsToSwap, unit); err != nil {
+		return MintReceipt{}, err
+	}
+	if unit != w.unit {
+		// tokens in other units are not swapped to the trusted mint
+		return w.receiveUnitFromMint(token, unit)
 	}
 
-	// verify DLEQ in proofs if present
-	if !nut12.VerifyProofsDLEQ(proofsToSwap, *keyset) {
-		return 0, errors.New("invalid DLEQ proof")
+	keyset, err := w.getActiveKeyset(tokenMint)
+	if err != nil {
+		return MintReceipt{}, fmt.Errorf("could not get active keyset: %v", err)
 	}
 
-	// if P2PK, add signature to Witness in the proofs
-	nut10Secret, err := nut10.DeserializeSecret(proofsToSwap[0].Secret)
-	if err == nil && nut10Secret.Kind == nut10.P2PK {
-		// check that public key in data is one wallet can sign for
-		if !nut11.CanSign(nut10Secret, w.privateKey) {
-			return 0, fmt.Errorf("cannot sign locked proofs")
-		}
-		proofsToSwap, err = nut11.AddSignatureToInputs(proofsToSwap, w.privateKey)
-		if err != nil {
-			return 0, fmt.Errorf("error signing inputs: %v", err)
-		}
+	proofsToSwap, nut10Secret, err := w.receiveInputs(proofsToSwap, keyset)
+	if err != nil {
+		return MintReceipt{}, err
 	}
 
 	// if mint in token is already the default mint, do not swap to trusted
@@ -510,53 +973,185 @@ func (w *Wallet) Receive(token cashu.Token, swapToTrusted bool) (uint64, error)
 	if swapToTrusted {
 		inactiveKeysets, err := GetMintInactiveKeysets(tokenMint, w.unit)
 		if err != nil {
-			return 0, err
+			return MintReceipt{}, err
 		}
 		mint := &walletMint{mintURL: tokenMint, activeKeyset: *keyset, inactiveKeysets: inactiveKeysets}
-		amountSwapped, err := w.swapToTrusted(proofsToSwap, mint)
+		swappedProofs, err := w.swapToTrusted(proofsToSwap, mint)
 		if err != nil {
-			return 0, fmt.Errorf("error swapping token to trusted mint: %v", err)
+			return MintReceipt{}, fmt.Errorf("error swapping token to trusted mint: %v", err)
 		}
-		return amountSwapped, nil
+		amountSwapped := swappedProofs.Amount()
+		w.logInfof("received %v from mint '%v' to default mint '%v'", amountSwapped, tokenMint, w.defaultMint)
+		w.recordTransaction(storage.ReceiveTransaction, w.defaultMint, token.Amount(),
+			token.Amount()-min(token.Amount(), amountSwapped), tokenMint)
+		return receivedProofsReceipt(token, swappedProofs), nil
 	} else {
+		if err := w.checkTrustPolicy(tokenMint, token.Amount()); err != nil {
+			return MintReceipt{}, err
+		}
+		if checkFees {
+			// checked before adding the mint so it is not added if rejected
+			mint, err := w.receiveMint(tokenMint, keyset)
+			if err != nil {
+				return MintReceipt{}, err
+			}
+			if err := w.checkReceiveFees(proofsToSwap, mint); err != nil {
+				return MintReceipt{}, err
+			}
+		}
+
 		// only add mint if not previously trusted
 		mint, ok := w.mints[tokenMint]
 		if !ok {
-			newMint, err := w.AddMint(tokenMint)
+			newMint, err := w.addMint(tokenMint, storage.AutoAdded)
 			if err != nil {
-				return 0, err
+				return MintReceipt{}, err
 			}
 			mint = *newMint
 		}
 
-		req, err := w.createSwapRequest(proofsToSwap, &mint)
+		return w.receiveToMint(token, proofsToSwap, nut10Secret, &mint)
+	}
+}
+
+// receiveToMint swaps the proofs received in the token
+// for new ones from the mint, which is the mint of the token
+func (w *Wallet) receiveToMint(
+	token cashu.Token,
+	proofs cashu.Proofs,
+	nut10Secret nut10.WellKnownSecret,
+	mint *walletMint,
+) (MintReceipt, error) {
+	return retryOnSignedOutputs(w, mint.mintURL, mint.unit, func() (MintReceipt, error) {
+		return w.swapReceived(token, proofs, nut10Secret, mint)
+	})
+}
+
+func (w *Wallet) swapReceived(
+	token cashu.Token,
+	proofs cashu.Proofs,
+	nut10Secret nut10.WellKnownSecret,
+	mint *walletMint,
+) (MintReceipt, error) {
+	req, err := w.createReceiveSwapRequest(proofs, nut10Secret, mint)
+	if err != nil {
+		return MintReceipt{}, err
+	}
+
+	operation, err := w.beginOperation(storage.Operation{
+		Kind:       storage.ReceiveOperation,
+		Mint:       mint.mintURL,
+		Inputs:     req.inputs,
+		Outputs:    req.outputs,
+		Secrets:    req.secrets,
+		KeysetId:   req.keyset.Id,
+		CounterEnd: w.counterForKeyset(req.keyset.Id) + uint32(len(req.outputs)),
+	}, req.rs)
+	if err != nil {
+		return MintReceipt{}, err
+	}
+
+	newProofs, err := w.swap(mint.mintURL, req)
+	if err != nil {
+		w.abortOperation(operation, err)
+		return MintReceipt{}, fmt.Errorf("could not swap proofs: %w", err)
+	}
+
+	err = w.db.IncrementKeysetCounter(req.keyset.Id, uint32(len(req.outputs)))
+	if err != nil {
+		return MintReceipt{}, fmt.Errorf("error incrementing keyset counter: %v", err)
+	}
+
+	if err := w.db.SaveProofs(newProofs); err != nil {
+		return MintReceipt{}, fmt.Errorf("error storing proofs: %v", err)
+	}
+	if err := w.completeOperation(operation); err != nil {
+		return MintReceipt{}, err
+	}
+	w.logInfof("received %v %v from mint '%v'", newProofs.Amount(), mint.unit, mint.mintURL)
+
+	receivedProofs := newProofs
+	if w.refreshAfterReceive {
+		// the token was received even if the refresh fails
+		refreshedProofs, err := w.refreshProofs(newProofs, mint)
 		if err != nil {
-			return 0, fmt.Errorf("could not create swap request: %v", err)
+			w.logErrorf("could not refresh proofs received: %v", err)
+		} else {
+			receivedProofs = refreshedProofs
 		}
+	}
+	if mint.unit == w.unit {
+		received := receivedProofs.Amount()
+		w.recordTransaction(storage.ReceiveTransaction, mint.mintURL, token.Amount(),
+			token.Amount()-min(token.Amount(), received), "")
+	}
+	return receivedProofsReceipt(token, receivedProofs), nil
+}
 
-		//if P2PK locked ecash has `SIG_ALL` flag, sign outputs
-		if nut10Secret.Kind == nut10.P2PK && nut11.IsSigAll(nut10Secret) {
-			req.outputs, err = nut11.AddSignatureToOutputs(req.outputs, w.privateKey)
-			if err != nil {
-				return 0, fmt.Errorf("error signing outputs: %v", err)
-			}
-		}
+// receivedProofsReceipt returns the receipt for the proofs received for the token
+func receivedProofsReceipt(token cashu.Token, proofs cashu.Proofs) MintReceipt {
+	receipt := MintReceipt{
+		Received:    proofs.Amount(),
+		Fees:        token.Amount() - min(token.Amount(), proofs.Amount()),
+		ProofsCount: len(proofs),
+	}
+	if len(proofs) > 0 {
+		receipt.KeysetId = proofs[0].Id
+	}
+	return receipt
+}
+
+// receiveInputs verifies the DLEQ proofs in the proofs received and signs them
+// if they are locked to the wallet's public key. Proofs locked with a custom
+// NUT-10 kind get the witness from the ConditionHandler of the kind.
+func (w *Wallet) receiveInputs(
+	proofs cashu.Proofs,
+	keyset *crypto.WalletKeyset,
+) (cashu.Proofs, nut10.WellKnownSecret, error) {
+	// verify DLEQ in proofs if present
+	if !nut12.VerifyProofsDLEQ(proofs, *keyset) {
+		return nil, nut10.WellKnownSecret{}, errors.New("invalid DLEQ proof")
+	}
 
-		newProofs, err := swap(tokenMint, req)
+	// if P2PK, add signature to Witness in the proofs
+	nut10Secret, err := nut10.DeserializeSecret(proofs[0].Secret)
+	if err == nil && nut10Secret.Kind == nut10.P2PK {
+		// check that public key in data is one wallet can sign for
+		if !nut11.CanSign(nut10Secret, w.privateKey) {
+			return nil, nut10Secret, fmt.Errorf("cannot sign locked proofs")
+		}
+		proofs, err = nut11.AddSignatureToInputs(proofs, w.privateKey)
 		if err != nil {
-			return 0, fmt.Errorf("could not swap proofs: %v", err)
+			return nil, nut10Secret, fmt.Errorf("error signing inputs: %v", err)
 		}
-
-		err = w.db.IncrementKeysetCounter(req.keyset.Id, uint32(len(req.outputs)))
+	} else if err == nil && nut10.IsCustomKind(nut10Secret.Kind) {
+		proofs, err = w.addConditionWitness(proofs, nut10Secret)
 		if err != nil {
-			return 0, fmt.Errorf("error incrementing keyset counter: %v", err)
+			return nil, nut10Secret, err
 		}
+	}
+	return proofs, nut10Secret, nil
+}
 
-		if err := w.db.SaveProofs(newProofs); err != nil {
-			return 0, fmt.Errorf("error storing proofs: %v", err)
+// createReceiveSwapRequest creates the request to swap the proofs received
+func (w *Wallet) createReceiveSwapRequest(
+	proofs cashu.Proofs,
+	nut10Secret nut10.WellKnownSecret,
+	mint *walletMint,
+) (swapRequestPayload, error) {
+	req, err := w.createSwapRequest(proofs, mint)
+	if err != nil {
+		return swapRequestPayload{}, fmt.Errorf("could not create swap request: %v", err)
+	}
+
+	//if P2PK locked ecash has `SIG_ALL` flag, sign outputs
+	if nut10Secret.Kind == nut10.P2PK && nut11.IsSigAll(nut10Secret) {
+		req.outputs, err = nut11.AddSignatureToOutputs(req.outputs, w.privateKey)
+		if err != nil {
+			return swapRequestPayload{}, fmt.Errorf("error signing outputs: %v", err)
 		}
-		return newProofs.Amount(), nil
 	}
+	return req, nil
 }
 
 // ReceiveHTLC will add the preimage and any signatures if needed in order to redeem the
@@ -577,15 +1172,20 @@ func (w *Wallet) ReceiveHTLC(token cashu.Token, preimage string) (uint64, error)
 
 	nut10Secret, err := nut10.DeserializeSecret(proofs[0].Secret)
 	if err == nil && nut10Secret.Kind == nut10.HTLC {
+		w.logDebugf("adding HTLC witness with preimage '%v' to %v", w.redact(preimage), w.proofsLog(proofs))
 		proofs, err = nut14.AddWitnessHTLC(proofs, nut10Secret, preimage, w.privateKey)
 		if err != nil {
 			return 0, fmt.Errorf("could not add HTLC witness: %v", err)
 		}
 
+		if err := w.checkTrustPolicy(tokenMint, token.Amount()); err != nil {
+			return 0, err
+		}
+
 		// only add mint if not previously trusted
 		mint, ok := w.mints[tokenMint]
 		if !ok {
-			newMint, err := w.AddMint(tokenMint)
+			newMint, err := w.addMint(tokenMint, storage.AutoAdded)
 			if err != nil {
 				return 0, err
 			}
@@ -605,8 +1205,22 @@ func (w *Wallet) ReceiveHTLC(token cashu.Token, preimage string) (uint64, error)
 			}
 		}
 
-		newProofs, err := swap(tokenMint, req)
+		operation, err := w.beginOperation(storage.Operation{
+			Kind:       storage.ReceiveOperation,
+			Mint:       tokenMint,
+			Inputs:     req.inputs,
+			Outputs:    req.outputs,
+			Secrets:    req.secrets,
+			KeysetId:   req.keyset.Id,
+			CounterEnd: w.counterForKeyset(req.keyset.Id) + uint32(len(req.outputs)),
+		}, req.rs)
 		if err != nil {
+			return 0, err
+		}
+
+		newProofs, err := w.swap(tokenMint, req)
+		if err != nil {
+			w.abortOperation(operation, err)
 			return 0, fmt.Errorf("could not swap proofs: %v", err)
 		}
 
@@ -618,6 +1232,11 @@ func (w *Wallet) ReceiveHTLC(token cashu.Token, preimage string) (uint64, error)
 		if err := w.db.SaveProofs(newProofs); err != nil {
 			return 0, fmt.Errorf("error storing proofs: %v", err)
 		}
+		if err := w.completeOperation(operation); err != nil {
+			return 0, err
+		}
+		w.recordTransaction(storage.ReceiveTransaction, tokenMint, token.Amount(),
+			token.Amount()-min(token.Amount(), newProofs.Amount()), nut10Secret.Data.Data)
 		return newProofs.Amount(), nil
 	}
 
@@ -637,7 +1256,7 @@ func (w *Wallet) createSwapRequest(proofs cashu.Proofs, mint *walletMint) (swapR
 	keysetCounter := w.counterForKeyset(mint.activeKeyset.Id)
 
 	fees := feesForProofs(proofs, mint)
-	split := w.splitWalletTarget(proofs.Amount()-uint64(fees), mint.mintURL)
+	split := w.splitWalletTarget(proofs.Amount()-uint64(fees), mint)
 	outputs, secrets, rs, err := w.createBlindedMessages(split, mint.activeKeyset.Id, &keysetCounter)
 	if err != nil {
 		return swapRequestPayload{}, fmt.Errorf("createBlindedMessages: %v", err)
@@ -652,13 +1271,16 @@ func (w *Wallet) createSwapRequest(proofs cashu.Proofs, mint *walletMint) (swapR
 	}, nil
 }
 
-func swap(mint string, swapRequest swapRequestPayload) (cashu.Proofs, error) {
+func (w *Wallet) swap(mint string, swapRequest swapRequestPayload) (cashu.Proofs, error) {
 	request := nut03.PostSwapRequest{
 		Inputs:  swapRequest.inputs,
 		Outputs: swapRequest.outputs,
 	}
+	w.logDebugf("swapping %v for %v outputs at mint '%v'",
+		w.proofsLog(swapRequest.inputs), len(swapRequest.outputs), mint)
 	swapResponse, err := client.PostSwap(mint, request)
 	if err != nil {
+		w.logErrorf("swap at mint '%v' failed: %v", mint, err)
 		return nil, err
 	}
 
@@ -677,9 +1299,9 @@ func swap(mint string, swapRequest swapRequestPayload) (cashu.Proofs, error) {
 	return proofs, nil
 }
 
-// swapToTrusted will swap the proofs from mint
-// to the wallet's configured default mint
-func (w *Wallet) swapToTrusted(proofs cashu.Proofs, mint *walletMint) (uint64, error) {
+// swapToTrusted will swap the proofs from mint to the wallet's
+// configured default mint and returns the proofs minted there
+func (w *Wallet) swapToTrusted(proofs cashu.Proofs, mint *walletMint) (cashu.Proofs, error) {
 	proofsToSwap := proofs
 
 	// if proofs are P2PK locked and sig all, add signatures to swap them first and then melt
@@ -687,34 +1309,45 @@ func (w *Wallet) swapToTrusted(proofs cashu.Proofs, mint *walletMint) (uint64, e
 	if err == nil && nut10Secret.Kind == nut10.P2PK && nut11.IsSigAll(nut10Secret) {
 		req, err := w.createSwapRequest(proofs, mint)
 		if err != nil {
-			return 0, fmt.Errorf("could not create swap request: %v", err)
+			return nil, fmt.Errorf("could not create swap request: %v", err)
 		}
 		req.outputs, err = nut11.AddSignatureToOutputs(req.outputs, w.privateKey)
 		if err != nil {
-			return 0, fmt.Errorf("error signing outputs: %v", err)
+			return nil, fmt.Errorf("error signing outputs: %v", err)
 		}
 
-		newProofs, err := swap(mint.mintURL, req)
+		newProofs, err := w.swap(mint.mintURL, req)
 		if err != nil {
-			return 0, fmt.Errorf("could not swap proofs: %v", err)
+			return nil, fmt.Errorf("could not swap proofs: %v", err)
 		}
 		proofsToSwap = newProofs
 	}
 
 	defaultMint := w.mints[w.defaultMint]
-	amountSwapped, err := w.swapProofs(proofsToSwap, mint, &defaultMint)
-	if err != nil {
-		return 0, err
-	}
-
-	return amountSwapped, nil
+	return w.swapProofs(proofsToSwap, mint, &defaultMint)
 }
 
-// RequestMeltQuote will request a melt quote to the mint for the specified request
+// RequestMeltQuote will request a melt quote to the mint for the specified request.
+// The request can be a BOLT11 invoice or a BOLT12 offer with an amount.
 func (w *Wallet) RequestMeltQuote(request, mint string) (*nut05.PostMeltQuoteBolt11Response, error) {
-	_, ok := w.mints[mint]
-	if !ok {
-		return nil, ErrMintNotExist
+	return w.RequestMeltQuoteInUnit(request, mint, w.unit)
+}
+
+// RequestMeltQuoteInUnit requests a melt quote for the request to be paid
+// with proofs in the unit, which has to be enabled for the mint with
+// AddMintUnit unless it is the unit of the wallet.
+func (w *Wallet) RequestMeltQuoteInUnit(
+	request, mint string,
+	unit cashu.Unit,
+) (*nut05.PostMeltQuoteBolt11Response, error) {
+	if _, err := w.mintForUnit(mint, unit); err != nil {
+		return nil, err
+	}
+	if IsOffer(request) {
+		if unit != cashu.Sat {
+			return nil, fmt.Errorf("offers can only be paid with proofs in %v", cashu.Sat)
+		}
+		return w.RequestMeltQuoteBolt12(request, 0, mint)
 	}
 
 	_, err := decodepay.Decodepay(request)
@@ -722,9 +1355,17 @@ func (w *Wallet) RequestMeltQuote(request, mint string) (*nut05.PostMeltQuoteBol
 		return nil, fmt.Errorf("invalid invoice: %v", err)
 	}
 
-	meltRequest := nut05.PostMeltQuoteBolt11Request{Request: request, Unit: w.unit.String()}
+	// the mint rejects another quote for the same invoice
+	// so a quote for it that can still be used is returned
+	if existingQuote := w.reusableMeltQuote(request, mint, unit); existingQuote != nil {
+		return existingQuote, nil
+	}
+
+	meltRequest := nut05.PostMeltQuoteBolt11Request{Request: request, Unit: unit.String()}
+	w.logDebugf("requesting melt quote from mint '%v'", mint)
 	meltQuoteResponse, err := client.PostMeltQuoteBolt11(mint, meltRequest)
 	if err != nil {
+		w.logErrorf("melt quote request to '%v' failed: %v", mint, err)
 		return nil, err
 	}
 
@@ -732,7 +1373,7 @@ func (w *Wallet) RequestMeltQuote(request, mint string) (*nut05.PostMeltQuoteBol
 		QuoteId:        meltQuoteResponse.Quote,
 		Mint:           mint,
 		Method:         cashu.BOLT11_METHOD,
-		Unit:           w.unit.String(),
+		Unit:           unit.String(),
 		State:          meltQuoteResponse.State,
 		PaymentRequest: request,
 		Amount:         meltQuoteResponse.Amount,
@@ -740,11 +1381,70 @@ func (w *Wallet) RequestMeltQuote(request, mint string) (*nut05.PostMeltQuoteBol
 		CreatedAt:      time.Now().Unix(),
 		QuoteExpiry:    meltQuoteResponse.Expiry,
 	}
-	if err := w.db.SaveMeltQuote(quote); err != nil {
-		return nil, fmt.Errorf("error saving melt quote: %v", err)
+	if err := w.db.SaveMeltQuote(quote); err != nil {
+		return nil, fmt.Errorf("error saving melt quote: %v", err)
+	}
+	w.logInfof("got melt quote '%v' for amount %v with fee reserve %v from mint '%v'",
+		quote.QuoteId, quote.Amount, quote.FeeReserve, mint)
+
+	return meltQuoteResponse, nil
+}
+
+// reusableMeltQuote returns a quote in the db for the invoice from the mint with
+// its state refreshed. Quotes that expired without being paid or whose state could
+// not be checked (i.e the mint does not know them) are not reused. It returns nil
+// if there is no quote that can be reused.
+func (w *Wallet) reusableMeltQuote(request, mint string, unit cashu.Unit) *nut05.PostMeltQuoteBolt11Response {
+	var quotes []storage.MeltQuote
+	for _, quote := range w.db.GetMeltQuotes() {
+		if quote.Mint == mint && quote.PaymentRequest == request && quote.Unit == unit.String() {
+			quotes = append(quotes, quote)
+		}
+	}
+	// latest quotes first
+	slices.SortFunc(quotes, func(a, b storage.MeltQuote) int {
+		return cmp.Compare(b.CreatedAt, a.CreatedAt)
+	})
+
+	now := time.Now().Unix()
+	for _, quote := range quotes {
+		expired := quote.QuoteExpiry > 0 && now >= int64(quote.QuoteExpiry)
+		if expired && quote.State == nut05.Unpaid {
+			continue
+		}
+		quoteState, err := w.CheckMeltQuoteState(quote.QuoteId)
+		if err != nil {
+			w.logDebugf("could not reuse melt quote '%v': %v", quote.QuoteId, err)
+			continue
+		}
+		if expired && quoteState.State == nut05.Unpaid {
+			continue
+		}
+		w.logInfof("reusing melt quote '%v' with state '%v' for the invoice", quote.QuoteId, quoteState.State)
+		return quoteState
+	}
+	return nil
+}
+
+// RequestMeltQuoteForAddress gets an invoice for the amount (in sats) from the
+// lightning address, attaching the comment and payer data in opts if the receiver
+// accepts them, and requests a melt quote to the mint for that invoice.
+func (w *Wallet) RequestMeltQuoteForAddress(
+	address string,
+	amount uint64,
+	mint string,
+	opts lnurl.PayOptions,
+) (*nut05.PostMeltQuoteBolt11Response, error) {
+	if _, ok := w.mints[mint]; !ok {
+		return nil, ErrMintNotExist
+	}
+
+	invoice, err := lnurl.GetInvoice(address, amount, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not get invoice from lightning address: %v", err)
 	}
 
-	return meltQuoteResponse, nil
+	return w.RequestMeltQuote(invoice, mint)
 }
 
 func (w *Wallet) CheckMeltQuoteState(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error) {
@@ -753,14 +1453,19 @@ func (w *Wallet) CheckMeltQuoteState(quoteId string) (*nut05.PostMeltQuoteBolt11
 		return nil, ErrQuoteNotFound
 	}
 
-	quoteStateResponse, err := client.GetMeltQuoteState(quote.Mint, quoteId)
+	quoteStateResponse, err := getMeltQuoteState(quote)
 	if err != nil {
+		w.logErrorf("could not get state of melt quote '%v' from '%v': %v", quoteId, quote.Mint, err)
 		return nil, err
 	}
+	if quoteStateResponse.State != quote.State {
+		w.logInfof("melt quote '%v' changed state from '%v' to '%v'", quoteId, quote.State, quoteStateResponse.State)
+	}
 
 	if quote.State != nut05.Paid {
 		// if quote was previously not paid and status has changed, update in db
 		if quoteStateResponse.State == nut05.Paid {
+			quote.State = nut05.Paid
 			quote.Preimage = quoteStateResponse.Preimage
 			quote.SettledAt = time.Now().Unix()
 			if err := w.db.SaveMeltQuote(*quote); err != nil {
@@ -769,9 +1474,13 @@ func (w *Wallet) CheckMeltQuoteState(quoteId string) (*nut05.PostMeltQuoteBolt11
 
 			pendingProofs := w.db.GetPendingProofsByQuoteId(quoteId)
 			var keysetId string
+			var pendingAmount uint64
 			if len(pendingProofs) > 0 {
 				keysetId = pendingProofs[0].Id
 			}
+			for _, proof := range pendingProofs {
+				pendingAmount += proof.Amount
+			}
 			if err := w.db.DeletePendingProofsByQuoteId(quoteId); err != nil {
 				return nil, fmt.Errorf("error removing pending proofs: %v", err)
 			}
@@ -782,6 +1491,12 @@ func (w *Wallet) CheckMeltQuoteState(quoteId string) (*nut05.PostMeltQuoteBolt11
 					return nil, fmt.Errorf("error incrementing keyset counter: %v", err)
 				}
 			}
+			// the melt is only recorded if the proofs were pending in this wallet
+			if pendingAmount > 0 {
+				spent := pendingAmount - min(pendingAmount, quoteStateResponse.Change.Amount())
+				w.recordTransaction(storage.MeltTransaction, quote.Mint, quote.Amount,
+					spent-min(spent, quote.Amount), quoteId)
+			}
 		} else if quoteStateResponse.State == nut05.Unpaid {
 			pendingProofs := w.db.GetPendingProofsByQuoteId(quoteId)
 			// if there were any pending proofs tied to this quote, remove them from pending
@@ -818,55 +1533,175 @@ func (w *Wallet) CheckMeltQuoteState(quoteId string) (*nut05.PostMeltQuoteBolt11
 	return quoteStateResponse, nil
 }
 
+// RequoteMelt requests a new quote with a higher fee reserve for the same
+// payment request, i.e after the payment of the quote failed because the
+// fee reserve was not enough. The mint supersedes the old quote with the
+// new one, so the old quote is removed from the wallet.
+func (w *Wallet) RequoteMelt(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error) {
+	quote := w.db.GetMeltQuoteById(quoteId)
+	if quote == nil {
+		return nil, ErrQuoteNotFound
+	}
+	if quote.State != nut05.Unpaid {
+		// the state could have changed if the payment failed after the melt request
+		meltState, err := w.CheckMeltQuoteState(quoteId)
+		if err != nil {
+			return nil, fmt.Errorf("error checking state of quote: %v", err)
+		}
+		if meltState.State == nut05.Pending {
+			return nil, errors.New("quote is still pending")
+		} else if meltState.State == nut05.Paid {
+			return nil, errors.New("request is already paid")
+		}
+	}
+
+	meltQuoteResponse, err := client.PostMeltRequoteBolt11(quote.Mint, quoteId)
+	if err != nil {
+		w.logErrorf("requote of melt quote '%v' to '%v' failed: %v", quoteId, quote.Mint, err)
+		return nil, err
+	}
+
+	newQuote := *quote
+	newQuote.QuoteId = meltQuoteResponse.Quote
+	newQuote.State = meltQuoteResponse.State
+	newQuote.Amount = meltQuoteResponse.Amount
+	newQuote.FeeReserve = meltQuoteResponse.FeeReserve
+	newQuote.CreatedAt = time.Now().Unix()
+	newQuote.QuoteExpiry = meltQuoteResponse.Expiry
+	if err := w.db.SaveMeltQuote(newQuote); err != nil {
+		return nil, fmt.Errorf("error saving melt quote: %v", err)
+	}
+	if err := w.db.DeleteMeltQuote(quoteId); err != nil {
+		return nil, fmt.Errorf("error removing superseded melt quote: %v", err)
+	}
+	w.logInfof("melt quote '%v' superseded by quote '%v' with fee reserve %v",
+		quoteId, newQuote.QuoteId, newQuote.FeeReserve)
+
+	return meltQuoteResponse, nil
+}
+
+// MeltResult is the result of a melt with the fees paid for it
+type MeltResult struct {
+	Response *nut05.PostMeltQuoteBolt11Response
+	// amount of the payment. It is 0 if the quote was not paid.
+	Amount uint64
+	// fees paid to the mint for the payment, which are the
+	// InputFees and LightningFees. They are 0 if the quote was not paid.
+	Fees uint64
+	// fees for the proofs spent
+	InputFees uint64
+	// fee reserve of the quote that was not returned as change
+	LightningFees uint64
+	// amount of the change returned for overpaid lightning fees
+	Change uint64
+	// number of proofs spent
+	ProofsCount int
+	// keyset of the outputs for the change
+	KeysetId string
+	Duration time.Duration
+}
+
 // Melt will melt proofs by requesting the mint to pay the
 // payment request from the melt quote passed
 func (w *Wallet) Melt(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error) {
+	result, err := w.MeltWithResult(quoteId)
+	if err != nil {
+		return nil, err
+	}
+	return result.Response, nil
+}
+
+// MeltWithResult melts proofs to pay the payment request from the melt
+// quote like Melt and returns the fees paid and the change received
+func (w *Wallet) MeltWithResult(quoteId string) (MeltResult, error) {
 	quote := w.db.GetMeltQuoteById(quoteId)
 	if quote == nil {
-		return nil, ErrQuoteNotFound
+		return MeltResult{}, ErrQuoteNotFound
+	}
+	unit, err := w.parseUnit(quote.Unit)
+	if err != nil {
+		return MeltResult{}, fmt.Errorf("invalid unit of quote: %v", err)
+	}
+	return retryOnSignedOutputs(w, quote.Mint, unit, func() (MeltResult, error) {
+		return w.meltWithResult(quoteId)
+	})
+}
+
+func (w *Wallet) meltWithResult(quoteId string) (MeltResult, error) {
+	start := time.Now()
+	quote := w.db.GetMeltQuoteById(quoteId)
+	if quote == nil {
+		return MeltResult{}, ErrQuoteNotFound
 	}
 	if quote.State == nut05.Paid {
-		return nil, errors.New("request is already paid")
+		return MeltResult{}, errors.New("request is already paid")
 	}
 	if quote.State == nut05.Pending {
 		// if quote was previously pending, check if state has changed
 		meltState, err := w.CheckMeltQuoteState(quoteId)
 		if err != nil {
-			return nil, fmt.Errorf("error checking state of quote: %v", err)
+			return MeltResult{}, fmt.Errorf("error checking state of quote: %v", err)
 		}
 
 		if meltState.State == nut05.Pending {
-			return nil, fmt.Errorf("quote is still pending")
+			return MeltResult{}, fmt.Errorf("quote is still pending")
 		} else if meltState.State == nut05.Paid {
-			return nil, errors.New("request is already paid")
+			return MeltResult{}, errors.New("request is already paid")
 		}
 	}
 
-	mint := w.mints[quote.Mint]
-
-	amountNeeded := quote.Amount + quote.FeeReserve
-	proofs, err := w.getProofsForAmount(amountNeeded, &mint, true)
+	unit, err := w.parseUnit(quote.Unit)
 	if err != nil {
-		return nil, err
+		return MeltResult{}, fmt.Errorf("invalid unit of quote: %v", err)
+	}
+	mint, ok := w.getMint(quote.Mint, unit)
+	if !ok {
+		return MeltResult{}, fmt.Errorf("%w: '%v' for mint '%v'", ErrUnitNotEnabled, unit, quote.Mint)
+	}
+	amountNeeded := quote.Amount + quote.FeeReserve
+	if unit == w.unit {
+		if err := w.checkSpendingPolicy(mint.mintURL, amountNeeded); err != nil {
+			return MeltResult{}, err
+		}
 	}
 
-	// set proofs to pending
-	if err := w.db.AddPendingProofsByQuoteId(proofs, quote.QuoteId); err != nil {
-		return nil, fmt.Errorf("error saving pending proofs: %v", err)
+	activeKeyset, err := w.getUnitActiveKeyset(mint.mintURL, unit)
+	if err != nil {
+		return MeltResult{}, fmt.Errorf("error getting active %v keyset: %v", unit, err)
 	}
 
-	activeKeyset, err := w.getActiveKeyset(mint.mintURL)
+	balance := w.mintBalance(&mint)
+	proofs, err := w.getProofsForAmount(amountNeeded, &mint, true)
 	if err != nil {
-		return nil, fmt.Errorf("error getting active sat keyset: %v", err)
+		return MeltResult{}, err
 	}
+
+	// counter is read after getting the proofs since
+	// it could have been incremented by a swap
 	counter := w.counterForKeyset(activeKeyset.Id)
 
-	// NUT-08 include blank outputs in request for overpaid lightning fees
-	numBlankOutputs := calculateBlankOutputs(quote.FeeReserve)
-	split := make([]uint64, numBlankOutputs)
-	outputs, outputsSecrets, outputsRs, err := w.createBlindedMessages(split, activeKeyset.Id, &counter)
+	outputs, outputsSecrets, outputsRs, err := w.createMeltChangeOutputs(quote.FeeReserve, activeKeyset.Id, &counter)
+	if err != nil {
+		return MeltResult{}, err
+	}
+
+	operation, err := w.beginOperation(storage.Operation{
+		Kind:       storage.MeltOperation,
+		Mint:       mint.mintURL,
+		Inputs:     proofs,
+		Outputs:    outputs,
+		Secrets:    outputsSecrets,
+		KeysetId:   activeKeyset.Id,
+		CounterEnd: counter,
+		QuoteId:    quote.QuoteId,
+	}, outputsRs)
 	if err != nil {
-		return nil, fmt.Errorf("error generating blinded messages for change: %v", err)
+		return MeltResult{}, err
+	}
+
+	// set proofs to pending
+	if err := w.db.AddPendingProofsByQuoteId(proofs, quote.QuoteId); err != nil {
+		return MeltResult{}, fmt.Errorf("error saving pending proofs: %v", err)
 	}
 
 	meltBolt11Request := nut05.PostMeltBolt11Request{
@@ -874,46 +1709,68 @@ func (w *Wallet) Melt(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error
 		Inputs:  proofs,
 		Outputs: outputs,
 	}
-	meltBolt11Response, err := client.PostMeltBolt11(mint.mintURL, meltBolt11Request)
+	w.logDebugf("melting %v for quote '%v' at mint '%v'", w.proofsLog(proofs), quote.QuoteId, mint.mintURL)
+	meltBolt11Response, err := postMelt(quote, meltBolt11Request)
 	if err != nil {
-		// if there was error with melt, remove proofs from pending and save them for use
-		if err := w.db.SaveProofs(proofs); err != nil {
-			return nil, fmt.Errorf("error storing proofs: %v", err)
-		}
-		if err := w.db.DeletePendingProofsByQuoteId(quote.QuoteId); err != nil {
-			return nil, fmt.Errorf("error removing pending proofs: %v", err)
+		w.logErrorf("melt for quote '%v' at '%v' failed: %v", quote.QuoteId, mint.mintURL, err)
+		// if the mint rejected the melt, remove proofs from pending and save them for use.
+		// Otherwise the melt might have happened so proofs are kept as pending
+		// and the operation is left in the journal for Recover to check it
+		var cashuErr cashu.Error
+		if errors.As(err, &cashuErr) {
+			if err := w.db.SaveProofs(proofs); err != nil {
+				return MeltResult{}, fmt.Errorf("error storing proofs: %v", err)
+			}
+			if err := w.db.DeletePendingProofsByQuoteId(quote.QuoteId); err != nil {
+				return MeltResult{}, fmt.Errorf("error removing pending proofs: %v", err)
+			}
+			w.abortOperation(operation, err)
 		}
-		return nil, err
+		return MeltResult{}, err
 	}
 
+	w.logInfof("melt quote '%v' is '%v' after melt", quote.QuoteId, meltBolt11Response.State)
+	result := MeltResult{
+		Response:    meltBolt11Response,
+		ProofsCount: len(proofs),
+		KeysetId:    activeKeyset.Id,
+	}
 	switch meltBolt11Response.State {
 	case nut05.Unpaid:
 		// if quote is unpaid, remove proofs from pending and add them
 		// to proofs available
 		if err := w.db.SaveProofs(proofs); err != nil {
-			return nil, fmt.Errorf("error storing proofs: %v", err)
+			return MeltResult{}, fmt.Errorf("error storing proofs: %v", err)
 		}
 		if err := w.db.DeletePendingProofsByQuoteId(quote.QuoteId); err != nil {
-			return nil, fmt.Errorf("error removing pending proofs: %v", err)
+			return MeltResult{}, fmt.Errorf("error removing pending proofs: %v", err)
+		}
+		if err := w.completeOperation(operation); err != nil {
+			return MeltResult{}, err
 		}
 	case nut05.Pending:
+		// operation is kept in the journal so that the change
+		// can be restored once the payment settles
 		quote.State = nut05.Pending
 		if err := w.db.SaveMeltQuote(*quote); err != nil {
-			return nil, fmt.Errorf("error updating melt quote: %v", err)
+			return MeltResult{}, fmt.Errorf("error updating melt quote: %v", err)
 		}
 
 	case nut05.Paid:
+		result.Amount = quote.Amount
+		result.InputFees = uint64(feesForProofs(proofs, &mint))
 		// payment succeeded so remove proofs from pending
 		if err := w.db.DeletePendingProofsByQuoteId(quote.QuoteId); err != nil {
-			return nil, fmt.Errorf("error removing pending proofs: %v", err)
+			return MeltResult{}, fmt.Errorf("error removing pending proofs: %v", err)
 		}
 
 		quote.Preimage = meltBolt11Response.Preimage
 		quote.State = meltBolt11Response.State
 		quote.SettledAt = time.Now().Unix()
 		if err := w.db.SaveMeltQuote(*quote); err != nil {
-			return nil, err
+			return MeltResult{}, err
 		}
+		w.logDebugf("melt quote '%v' paid with preimage '%v'", quote.QuoteId, w.redact(quote.Preimage))
 
 		change := len(meltBolt11Response.Change)
 		// if mint provided blind signtures for any overpaid lightning fees:
@@ -928,17 +1785,30 @@ func (w *Wallet) Melt(quoteId string) (*nut05.PostMeltQuoteBolt11Response, error
 				activeKeyset,
 			)
 			if err != nil {
-				return nil, fmt.Errorf("error unblinding signature from change: %v", err)
+				return MeltResult{}, fmt.Errorf("error unblinding signature from change: %v", err)
 			}
 			if err := w.db.SaveProofs(changeProofs); err != nil {
-				return nil, fmt.Errorf("error storing change proofs: %v", err)
+				return MeltResult{}, fmt.Errorf("error storing change proofs: %v", err)
 			}
 			if err := w.db.IncrementKeysetCounter(activeKeyset.Id, uint32(change)); err != nil {
-				return nil, fmt.Errorf("error incrementing keyset counter: %v", err)
+				return MeltResult{}, fmt.Errorf("error incrementing keyset counter: %v", err)
 			}
+			w.logInfof("got change of %v for melt quote '%v'", changeProofs.Amount(), quote.QuoteId)
+			result.Change = changeProofs.Amount()
+		}
+		if err := w.completeOperation(operation); err != nil {
+			return MeltResult{}, err
 		}
+		if unit == w.unit {
+			w.recordSpent(storage.MeltTransaction, mint.mintURL, quote.Amount, balance, quote.QuoteId)
+		}
+
+		spent := proofs.Amount() - min(proofs.Amount(), result.Change)
+		result.Fees = spent - min(spent, quote.Amount)
+		result.LightningFees = result.Fees - min(result.Fees, result.InputFees)
 	}
-	return meltBolt11Response, err
+	result.Duration = time.Since(start)
+	return result, nil
 }
 
 func (w *Wallet) MultiMintPayment(request string, split map[string]uint64) ([]nut05.PostMeltQuoteBolt11Response, error) {
@@ -978,6 +1848,11 @@ func (w *Wallet) MultiMintPayment(request string, split map[string]uint64) ([]nu
 		}
 		splitSum += amount
 	}
+	// split amounts in the melt quotes are in sats
+	// so the parts could not add up to the msat amount
+	if bolt11.MSatoshi%1000 != 0 {
+		return nil, fmt.Errorf("invoice amount of %v msat can not be split in sats", bolt11.MSatoshi)
+	}
 	invoiceAmount := uint64(bolt11.MSatoshi / 1000)
 	if splitSum != invoiceAmount {
 		return nil, fmt.Errorf("sum of split amounts '%v' does not equal invoice amount of '%v'",
@@ -1000,7 +1875,7 @@ func (w *Wallet) MultiMintPayment(request string, split map[string]uint64) ([]nu
 				meltRequest := nut05.PostMeltQuoteBolt11Request{
 					Request: invoice,
 					Unit:    w.unit.String(),
-					Options: map[string]nut05.MppOption{"mpp": {Amount: amount}},
+					Options: &nut05.MeltOptions{Mpp: &nut05.MppOption{Amount: amount}},
 				}
 				meltQuoteResponse, err := client.PostMeltQuoteBolt11(mint, meltRequest)
 				if err != nil {
@@ -1071,6 +1946,9 @@ func (w *Wallet) MintSwap(amount uint64, from, to string) (uint64, error) {
 	if !fromOk || !toOk {
 		return 0, ErrMintNotExist
 	}
+	if from == to {
+		return 0, errors.New("cannot swap to the same mint")
+	}
 
 	balanceByMints := w.GetBalanceByMints()
 	if balanceByMints[from] < amount {
@@ -1082,81 +1960,196 @@ func (w *Wallet) MintSwap(amount uint64, from, to string) (uint64, error) {
 		return 0, err
 	}
 
-	amountSwapped, err := w.swapProofs(proofsToSwap, &fromMint, &toMint)
+	quotes, err := w.mintSwapQuotes(proofsToSwap, &fromMint, &toMint)
+	if err != nil {
+		// proofs were not spent so add them back
+		if err := w.db.SaveProofs(proofsToSwap); err != nil {
+			return 0, fmt.Errorf("error storing proofs: %v", err)
+		}
+		return 0, err
+	}
+
+	swappedProofs, change, err := w.meltToMintQuote(proofsToSwap, &fromMint, quotes)
 	if err != nil {
 		return 0, err
 	}
+	amountSwapped := swappedProofs.Amount()
+	w.logInfof("swapped %v from mint '%v' to '%v'", amountSwapped, from, to)
+	w.recordTransaction(storage.TransferOutTransaction, from, amountSwapped,
+		proofsToSwap.Amount()-min(proofsToSwap.Amount(), amountSwapped+change), to)
+	w.recordTransaction(storage.TransferInTransaction, to, amountSwapped, 0, from)
 
 	return amountSwapped, nil
 }
 
+// maxSwapQuoteAttempts is the number of times quotes are requested
+// with a lower amount to find one where the proofs cover the fees.
+// Each attempt leaves a mint and a melt quote unused at the mints
+const maxSwapQuoteAttempts = 3
+
+type swapQuotes struct {
+	mintQuote *nut04.PostMintQuoteBolt11Response
+	meltQuote *nut05.PostMeltQuoteBolt11Response
+}
+
 // swapProofs will swap the proofs in the from mint to specified mint
-func (w *Wallet) swapProofs(proofs cashu.Proofs, from, to *walletMint) (uint64, error) {
-	var mintResponse *nut04.PostMintQuoteBolt11Response
-	var meltQuoteResponse *nut05.PostMeltQuoteBolt11Response
-	invoicePct := 0.99
+func (w *Wallet) swapProofs(proofs cashu.Proofs, from, to *walletMint) (cashu.Proofs, error) {
+	quotes, err := w.mintSwapQuotes(proofs, from, to)
+	if err != nil {
+		return nil, err
+	}
+	swappedProofs, _, err := w.meltToMintQuote(proofs, from, quotes)
+	return swappedProofs, err
+}
+
+// mintSwapQuotes requests a mint quote to the 'to' mint and a melt quote to the 'from'
+// mint to pay the invoice of the mint quote. It first asks for the whole amount of the
+// proofs minus input fees. If the mints can settle the quotes internally (i.e they share
+// the operator or lightning node) the fee reserve is 0 and nothing is lost. Otherwise the
+// amount is lowered by what the fee reserve of the melt quote leaves uncovered.
+func (w *Wallet) mintSwapQuotes(proofs cashu.Proofs, from, to *walletMint) (swapQuotes, error) {
 	proofsAmount := proofs.Amount()
-	amount := float64(proofsAmount) * invoicePct
 	fees := uint64(feesForProofs(proofs, from))
-	for {
+	if proofsAmount <= fees {
+		return swapQuotes{}, errors.New("amount is not enough to pay fees")
+	}
+
+	mintAmount := proofsAmount - fees
+	for attempt := 0; ; attempt++ {
+		if attempt == maxSwapQuoteAttempts {
+			return swapQuotes{}, errors.New("could not get quotes for an amount that covers the fees")
+		}
+
 		// request mint quote to the 'to' mint
 		// this will generate an invoice
-		mintAmountRequest := uint64(amount) - fees
-		var err error
-		mintResponse, err = w.RequestMint(mintAmountRequest, to.mintURL)
+		mintResponse, err := w.RequestMint(mintAmount, to.mintURL)
 		if err != nil {
-			return 0, fmt.Errorf("error requesting mint quote: %v", err)
+			return swapQuotes{}, fmt.Errorf("error requesting mint quote: %v", err)
 		}
 
 		// request melt quote from the 'from' mint
 		// this melt will pay the invoice generated from the previous mint quote request
 		meltRequest := nut05.PostMeltQuoteBolt11Request{Request: mintResponse.Request, Unit: cashu.Sat.String()}
-		meltQuoteResponse, err = client.PostMeltQuoteBolt11(from.mintURL, meltRequest)
+		meltQuoteResponse, err := client.PostMeltQuoteBolt11(from.mintURL, meltRequest)
 		if err != nil {
-			return 0, fmt.Errorf("error with melt request: %v", err)
+			return swapQuotes{}, fmt.Errorf("error with melt request: %v", err)
 		}
 
-		// if amount in proofs is less than amount asked from mint in melt request,
-		// lower the amount for mint request
-		if meltQuoteResponse.Amount+meltQuoteResponse.FeeReserve+fees > proofsAmount {
-			invoicePct -= 0.01
-			amount *= invoicePct
-		} else {
-			break
+		amountNeeded := meltQuoteResponse.Amount + meltQuoteResponse.FeeReserve + fees
+		if amountNeeded <= proofsAmount {
+			loss := proofsAmount - mintAmount
+			if w.maxSwapLoss > 0 && loss > w.maxSwapLoss {
+				return swapQuotes{}, fmt.Errorf("%w: swap would lose %v and max is %v",
+					ErrSwapLossTooHigh, loss, w.maxSwapLoss)
+			}
+			return swapQuotes{mintQuote: mintResponse, meltQuote: meltQuoteResponse}, nil
+		}
+
+		// lower the amount for the mint request by what is not covered
+		uncovered := amountNeeded - proofsAmount
+		if uncovered >= mintAmount {
+			return swapQuotes{}, errors.New("amount is not enough to pay fees")
 		}
+		mintAmount -= uncovered
 	}
+}
 
+// meltToMintQuote melts the proofs in the 'from' mint to pay the invoice
+// of the mint quote and mints the proofs for it. It also returns the
+// amount of the change for the fee reserve that was not spent
+func (w *Wallet) meltToMintQuote(proofs cashu.Proofs, from *walletMint, quotes swapQuotes) (cashu.Proofs, uint64, error) {
 	// request from mint to pay invoice from the mint quote request
-	meltBolt11Request := nut05.PostMeltBolt11Request{Quote: meltQuoteResponse.Quote, Inputs: proofs}
-	meltBolt11Response, err := client.PostMeltBolt11(from.mintURL, meltBolt11Request)
+	meltResponse, change, err := w.meltForSwap(proofs, from, quotes.meltQuote)
 	if err != nil {
-		return 0, fmt.Errorf("error melting token: %v", err)
+		return nil, 0, err
 	}
 
 	// if melt request was successful and invoice got paid,
 	// make mint request to get valid proofs
-	if meltBolt11Response.State == nut05.Paid {
-		mintedAmount, err := w.MintTokens(mintResponse.Quote)
+	if meltResponse.State == nut05.Paid {
+		mintedProofs, err := w.mintTokens(quotes.mintQuote.Quote)
 		if err != nil {
-			return 0, fmt.Errorf("error minting tokens: %v", err)
+			return nil, change, fmt.Errorf("error minting tokens: %v", err)
 		}
-		return mintedAmount, nil
+		return mintedProofs, change, nil
 	} else {
-		return 0, errors.New("mint could not pay lightning invoice")
+		return nil, 0, errors.New("mint could not pay lightning invoice")
+	}
+}
+
+// meltForSwap melts the proofs for the melt quote with blank outputs (NUT-08)
+// so that the fee reserve not spent on routing fees is returned as change.
+// The change is saved and its amount is returned.
+func (w *Wallet) meltForSwap(
+	proofs cashu.Proofs,
+	from *walletMint,
+	meltQuote *nut05.PostMeltQuoteBolt11Response,
+) (*nut05.PostMeltQuoteBolt11Response, uint64, error) {
+	keyset := from.activeKeyset
+	counter := w.counterForKeyset(keyset.Id)
+	outputs, outputsSecrets, outputsRs, err := w.createMeltChangeOutputs(meltQuote.FeeReserve, keyset.Id, &counter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	meltBolt11Request := nut05.PostMeltBolt11Request{Quote: meltQuote.Quote, Inputs: proofs, Outputs: outputs}
+	meltBolt11Response, err := client.PostMeltBolt11(from.mintURL, meltBolt11Request)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error melting token: %v", err)
+	}
+
+	if meltBolt11Response.State != nut05.Paid || len(meltBolt11Response.Change) == 0 {
+		return meltBolt11Response, 0, nil
+	}
+	change, err := w.saveSwapChange(meltBolt11Response.Change, outputs, outputsSecrets, outputsRs, &keyset)
+	if err != nil {
+		// the quote was paid so the mint quote can still be minted
+		w.logErrorf("could not save change for melt quote '%v': %v", meltQuote.Quote, err)
+		return meltBolt11Response, 0, nil
+	}
+	w.logInfof("got change of %v for melt quote '%v'", change, meltQuote.Quote)
+	return meltBolt11Response, change, nil
+}
+
+func (w *Wallet) saveSwapChange(
+	signatures cashu.BlindedSignatures,
+	outputs cashu.BlindedMessages,
+	secrets []string,
+	rs []*secp256k1.PrivateKey,
+	keyset *crypto.WalletKeyset,
+) (uint64, error) {
+	change := len(signatures)
+	if change > len(outputs) {
+		return 0, errors.New("mint returned more change than blank outputs")
+	}
+	changeProofs, err := constructProofs(signatures, outputs[:change], secrets[:change], rs[:change], keyset)
+	if err != nil {
+		return 0, fmt.Errorf("error unblinding signature from change: %v", err)
+	}
+	if err := w.db.SaveProofs(changeProofs); err != nil {
+		return 0, fmt.Errorf("error storing change proofs: %v", err)
+	}
+	if err := w.db.IncrementKeysetCounter(keyset.Id, uint32(change)); err != nil {
+		return 0, fmt.Errorf("error incrementing keyset counter: %v", err)
 	}
+	return changeProofs.Amount(), nil
 }
 
 func (w *Wallet) getProofsFromMint(mintURL string) cashu.Proofs {
-	proofs := w.getInactiveProofsByMint(mintURL)
-	proofs = append(proofs, w.getActiveProofsByMint(mintURL)...)
-	return proofs
+	mint := w.mints[mintURL]
+	return w.mintProofs(&mint)
 }
 
-func (w *Wallet) getInactiveProofsByMint(mintURL string) cashu.Proofs {
-	selectedMint := w.mints[mintURL]
+// mintProofs returns the proofs of the keysets of the mint in its unit
+func (w *Wallet) mintProofs(mint *walletMint) cashu.Proofs {
+	proofs := w.getInactiveProofsByMint(mint)
+	proofs = append(proofs, w.getActiveProofsByMint(mint)...)
+	return proofs
+}
 
+func (w *Wallet) getInactiveProofsByMint(mint *walletMint) cashu.Proofs {
 	proofs := cashu.Proofs{}
-	for _, keyset := range selectedMint.inactiveKeysets {
+	for _, keyset := range mint.inactiveKeysets {
 		keysetProofs := w.db.GetProofsByKeysetId(keyset.Id)
 		proofs = append(proofs, keysetProofs...)
 	}
@@ -1164,9 +2157,8 @@ func (w *Wallet) getInactiveProofsByMint(mintURL string) cashu.Proofs {
 	return proofs
 }
 
-func (w *Wallet) getActiveProofsByMint(mintURL string) cashu.Proofs {
-	selectedMint := w.mints[mintURL]
-	return w.db.GetProofsByKeysetId(selectedMint.activeKeyset.Id)
+func (w *Wallet) getActiveProofsByMint(mint *walletMint) cashu.Proofs {
+	return w.db.GetProofsByKeysetId(mint.activeKeyset.Id)
 }
 
 // selectProofsForAmount tries to select proofs from inactive keysets (if any) first
@@ -1179,7 +2171,7 @@ func (w *Wallet) selectProofsForAmount(
 	var selectedProofs cashu.Proofs
 	var fees uint64 = 0
 
-	inactiveKeysetProofs := w.getInactiveProofsByMint(mint.mintURL)
+	inactiveKeysetProofs := w.getInactiveProofsByMint(mint)
 	// if there are proofs from inactive keysets, select from those first
 	if len(inactiveKeysetProofs) > 0 {
 		// safe to ignore error here because if proofs aren't enough for the amount
@@ -1194,18 +2186,21 @@ func (w *Wallet) selectProofsForAmount(
 	selectedAmount := selectedProofs.Amount()
 	// return if amount from inactive proofs selected is already enough
 	if selectedAmount >= totalAmountNeeded {
+		w.logDebugf("selected %v from inactive keysets for amount %v", w.proofsLog(selectedProofs), amount)
 		return selectedProofs, nil
 	} else {
 		remainingAmount := totalAmountNeeded - selectedAmount
-		activeKeysetProofs := w.getActiveProofsByMint(mint.mintURL)
+		activeKeysetProofs := w.getActiveProofsByMint(mint)
 
 		proofsForRemainingAmount, err := selectProofsToSend(activeKeysetProofs, remainingAmount, mint, includeFees)
 		if err != nil {
+			w.logDebugf("could not select proofs for amount %v from mint '%v': %v", amount, mint.mintURL, err)
 			return nil, err
 		}
 		selectedProofs = append(selectedProofs, proofsForRemainingAmount...)
 	}
 
+	w.logDebugf("selected %v for amount %v", w.proofsLog(selectedProofs), amount)
 	return selectedProofs, nil
 }
 
@@ -1289,6 +2284,16 @@ func selectProofsToSend(
 	return selectedProofs, nil
 }
 
+// swapToSendRequest has the outputs to be sent and the change
+// outputs of a swap to get proofs for an amount
+type swapToSendRequest struct {
+	swapRequestPayload
+	send cashu.BlindedMessages
+	// counter of the keyset after the outputs created
+	counter            uint32
+	incrementCounterBy uint32
+}
+
 // swapToSend will swap proofs from the wallet to get new proofs for the specified amount.
 // If spendingCondition is passed then it creates proofs that are locked to it (P2PK or HTLC).
 // If no spendingCondition specified, it returns regular proofs that can be spent by anyone.
@@ -1298,21 +2303,126 @@ func (w *Wallet) swapToSend(
 	spendingCondition *nut10.SpendingCondition,
 	includeFees bool,
 ) (cashu.Proofs, error) {
-	activeSatKeyset, err := w.getActiveKeyset(mint.mintURL)
+	return retryOnSignedOutputs(w, mint.mintURL, mint.unit, func() (cashu.Proofs, error) {
+		activeKeyset, err := w.getUnitActiveKeyset(mint.mintURL, mint.unit)
+		if err != nil {
+			return nil, fmt.Errorf("error getting active %v keyset: %v", mint.unit, err)
+		}
+
+		req, err := w.createSwapToSendRequest(amount, mint, activeKeyset, spendingCondition, includeFees)
+		if err != nil {
+			return nil, err
+		}
+		return w.executeSwapToSend(req, mint)
+	})
+}
+
+// executeSwapToSend makes the swap in the request. It saves the
+// change and returns the proofs for the send outputs
+func (w *Wallet) executeSwapToSend(req swapToSendRequest, mint *walletMint) (cashu.Proofs, error) {
+	activeSatKeyset := req.keyset
+	operation, err := w.beginOperation(storage.Operation{
+		Kind:       storage.SwapOperation,
+		Mint:       mint.mintURL,
+		Inputs:     req.inputs,
+		Outputs:    req.outputs,
+		Secrets:    req.secrets,
+		KeysetId:   activeSatKeyset.Id,
+		CounterEnd: req.counter,
+	}, req.rs)
+	if err != nil {
+		return nil, err
+	}
+
+	// call swap endpoint
+	swapRequest := nut03.PostSwapRequest{Inputs: req.inputs, Outputs: req.outputs}
+	w.logDebugf("swapping %v at mint '%v' to send amount %v",
+		w.proofsLog(req.inputs), mint.mintURL, req.send.Amount())
+	swapResponse, err := client.PostSwap(mint.mintURL, swapRequest)
+	if err != nil {
+		w.logErrorf("swap at mint '%v' failed: %v", mint.mintURL, err)
+		w.abortOperation(operation, err)
+		return nil, err
+	}
+
+	for _, proof := range req.inputs {
+		w.db.DeleteProof(proof.Secret)
+	}
+
+	proofsFromSwap, err := constructProofs(swapResponse.Signatures, req.outputs, req.secrets, req.rs, activeSatKeyset)
+	if err != nil {
+		return nil, fmt.Errorf("wallet.ConstructProofs: %v", err)
+	}
+
+	proofsToSend := make(cashu.Proofs, len(req.send))
+	for i, sendmsg := range req.send {
+		for j, proof := range proofsFromSwap {
+			if sendmsg.Amount == proof.Amount {
+				proofsToSend[i] = proof
+				proofsFromSwap = slices.Delete(proofsFromSwap, j, j+1)
+				break
+			}
+		}
+	}
+
+	// remaining proofs are change proofs to save to db
+	if err := w.db.SaveProofs(proofsFromSwap); err != nil {
+		return nil, fmt.Errorf("error storing proofs: %v", err)
+	}
+
+	err = w.db.IncrementKeysetCounter(activeSatKeyset.Id, req.incrementCounterBy)
 	if err != nil {
-		return nil, fmt.Errorf("error getting active sat keyset: %v", err)
+		return nil, fmt.Errorf("error incrementing keyset counter: %v", err)
+	}
+
+	if err := w.completeOperation(operation); err != nil {
+		return nil, err
 	}
 
-	splitForSendAmount := cashu.AmountSplit(amount)
-	var feesToReceive uint = 0
+	return proofsToSend, nil
+}
+
+// createSwapToSendRequest selects the proofs and creates the outputs
+// to swap for the amount to send plus the change.
+func (w *Wallet) createSwapToSendRequest(
+	amount uint64,
+	mint *walletMint,
+	activeSatKeyset *crypto.WalletKeyset,
+	spendingCondition *nut10.SpendingCondition,
+	includeFees bool,
+) (swapToSendRequest, error) {
+	return w.createSwapToSendSplitRequest(sendSplit(amount, activeSatKeyset, includeFees),
+		mint, activeSatKeyset, spendingCondition)
+}
+
+// sendSplit returns the amounts of the proofs to send for the amount.
+// If includeFees, it adds the fees the receiver will pay to swap them.
+func sendSplit(amount uint64, keyset *crypto.WalletKeyset, includeFees bool) []uint64 {
+	split := cashu.AmountSplit(amount)
 	if includeFees {
-		feesToReceive = feesForCount(len(splitForSendAmount)+1, activeSatKeyset)
-		amount += uint64(feesToReceive)
+		feesToReceive := feesForCount(len(split)+1, keyset)
+		split = append(split, cashu.AmountSplit(uint64(feesToReceive))...)
+	}
+	slices.Sort(split)
+	return split
+}
+
+// createSwapToSendSplitRequest selects the proofs and creates the
+// outputs to swap for the amounts in the split plus the change.
+func (w *Wallet) createSwapToSendSplitRequest(
+	split []uint64,
+	mint *walletMint,
+	activeSatKeyset *crypto.WalletKeyset,
+	spendingCondition *nut10.SpendingCondition,
+) (swapToSendRequest, error) {
+	var amount uint64
+	for _, amt := range split {
+		amount += amt
 	}
 
 	proofsToSwap, err := w.selectProofsForAmount(amount, mint, true)
 	if err != nil {
-		return nil, err
+		return swapToSendRequest{}, err
 	}
 
 	var send, change cashu.BlindedMessages
@@ -1320,21 +2430,19 @@ func (w *Wallet) swapToSend(
 	var rs, changeRs []*secp256k1.PrivateKey
 	var counter, incrementCounterBy uint32
 
-	split := append(splitForSendAmount, cashu.AmountSplit(uint64(feesToReceive))...)
-	slices.Sort(split)
 	// if no spendingCondition passed, create blinded messages from counter
 	if spendingCondition == nil {
 		counter = w.counterForKeyset(activeSatKeyset.Id)
 		// blinded messages for send amount from counter
 		send, secrets, rs, err = w.createBlindedMessages(split, activeSatKeyset.Id, &counter)
 		if err != nil {
-			return nil, err
+			return swapToSendRequest{}, err
 		}
 		incrementCounterBy += uint32(len(send))
 	} else {
-		send, secrets, rs, err = blindedMessagesFromSpendingCondition(split, activeSatKeyset.Id, *spendingCondition)
+		send, secrets, rs, err = w.blindedMessagesFromSpendingCondition(split, activeSatKeyset.Id, *spendingCondition)
 		if err != nil {
-			return nil, err
+			return swapToSendRequest{}, err
 		}
 		counter = w.counterForKeyset(activeSatKeyset.Id)
 	}
@@ -1344,10 +2452,10 @@ func (w *Wallet) swapToSend(
 	// blinded messages for change amount
 	if proofsAmount-amount-uint64(fees) > 0 {
 		changeAmount := proofsAmount - amount - uint64(fees)
-		changeSplit := w.splitWalletTarget(changeAmount, mint.mintURL)
+		changeSplit := w.splitWalletTarget(changeAmount, mint)
 		change, changeSecrets, changeRs, err = w.createBlindedMessages(changeSplit, activeSatKeyset.Id, &counter)
 		if err != nil {
-			return nil, err
+			return swapToSendRequest{}, err
 		}
 		incrementCounterBy += uint32(len(change))
 	}
@@ -1360,44 +2468,18 @@ func (w *Wallet) swapToSend(
 
 	cashu.SortBlindedMessages(blindedMessages, secrets, rs)
 
-	// call swap endpoint
-	swapRequest := nut03.PostSwapRequest{Inputs: proofsToSwap, Outputs: blindedMessages}
-	swapResponse, err := client.PostSwap(mint.mintURL, swapRequest)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, proof := range proofsToSwap {
-		w.db.DeleteProof(proof.Secret)
-	}
-
-	proofsFromSwap, err := constructProofs(swapResponse.Signatures, blindedMessages, secrets, rs, activeSatKeyset)
-	if err != nil {
-		return nil, fmt.Errorf("wallet.ConstructProofs: %v", err)
-	}
-
-	proofsToSend := make(cashu.Proofs, len(send))
-	for i, sendmsg := range send {
-		for j, proof := range proofsFromSwap {
-			if sendmsg.Amount == proof.Amount {
-				proofsToSend[i] = proof
-				proofsFromSwap = slices.Delete(proofsFromSwap, j, j+1)
-				break
-			}
-		}
-	}
-
-	// remaining proofs are change proofs to save to db
-	if err := w.db.SaveProofs(proofsFromSwap); err != nil {
-		return nil, fmt.Errorf("error storing proofs: %v", err)
-	}
-
-	err = w.db.IncrementKeysetCounter(activeSatKeyset.Id, incrementCounterBy)
-	if err != nil {
-		return nil, fmt.Errorf("error incrementing keyset counter: %v", err)
-	}
-
-	return proofsToSend, nil
+	return swapToSendRequest{
+		swapRequestPayload: swapRequestPayload{
+			inputs:  proofsToSwap,
+			outputs: blindedMessages,
+			secrets: secrets,
+			rs:      rs,
+			keyset:  activeSatKeyset,
+		},
+		send:               send,
+		counter:            counter,
+		incrementCounterBy: incrementCounterBy,
+	}, nil
 }
 
 // getProofsForAmount will return proofs from mint for the given amount.
@@ -1439,9 +2521,9 @@ func (w *Wallet) getProofsForAmount(
 // splitWalletTarget returns a split for an amount.
 // creates the split based on the state of the wallet.
 // it has a defautl target of 3 coins of each amount
-func (w *Wallet) splitWalletTarget(amountToSplit uint64, mint string) []uint64 {
+func (w *Wallet) splitWalletTarget(amountToSplit uint64, mint *walletMint) []uint64 {
 	target := 3
-	proofs := w.getProofsFromMint(mint)
+	proofs := w.mintProofs(mint)
 
 	// amounts that are in wallet
 	amountsInWallet := make([]uint64, len(proofs))
@@ -1494,6 +2576,21 @@ func (w *Wallet) splitWalletTarget(amountToSplit uint64, mint string) []uint64 {
 	return amounts
 }
 
+// createMeltChangeOutputs creates the blank outputs (NUT-08)
+// included in a melt request for overpaid lightning fees
+func (w *Wallet) createMeltChangeOutputs(
+	feeReserve uint64,
+	keysetId string,
+	counter *uint32,
+) (cashu.BlindedMessages, []string, []*secp256k1.PrivateKey, error) {
+	split := make([]uint64, calculateBlankOutputs(feeReserve))
+	outputs, secrets, rs, err := w.createBlindedMessages(split, keysetId, counter)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error generating blinded messages for change: %v", err)
+	}
+	return outputs, secrets, rs, nil
+}
+
 func calculateBlankOutputs(feeReserve uint64) int {
 	if feeReserve == 0 {
 		return 0
@@ -1604,7 +2701,7 @@ func generateDeterministicSecret(path *hdkeychain.ExtendedKey, counter uint32) (
 	return secret, r, nil
 }
 
-func blindedMessagesFromSpendingCondition(
+func (w *Wallet) blindedMessagesFromSpendingCondition(
 	splitAmounts []uint64,
 	keysetId string,
 	spendingCondition nut10.SpendingCondition,
@@ -1624,7 +2721,7 @@ func blindedMessagesFromSpendingCondition(
 			return nil, nil, nil, err
 		}
 
-		secret, err := nut10.NewSecretFromSpendingCondition(spendingCondition)
+		secret, err := w.newLockedSecret(spendingCondition)
 		if err != nil {
 			return nil, nil, nil, err
 		}
@@ -1720,49 +2817,80 @@ func unblindSignature(C_str string, r *secp256k1.PrivateKey, key *secp256k1.Publ
 
 // keyset passed should exist in wallet
 func (w *Wallet) counterForKeyset(keysetId string) uint32 {
+	w.leaseCounter(keysetId)
 	return w.db.GetKeysetCounter(keysetId)
 }
 
-func (w *Wallet) loadWalletMints() (map[string]walletMint, error) {
+func (w *Wallet) loadWalletMints() (map[string]walletMint, map[string]map[cashu.Unit]walletMint, error) {
 	walletMints := make(map[string]walletMint)
+	unitMints := make(map[string]map[cashu.Unit]walletMint)
 
+	trustLevels := w.db.GetMintTrustLevels()
 	keysets := w.db.GetKeysets()
 	for k, mintKeysets := range keysets {
-		var activeKeyset crypto.WalletKeyset
-		inactiveKeysets := make(map[string]crypto.WalletKeyset)
+		activeKeysets := make(map[cashu.Unit]crypto.WalletKeyset)
+		inactiveKeysets := map[cashu.Unit]map[string]crypto.WalletKeyset{
+			w.unit: make(map[string]crypto.WalletKeyset),
+		}
 		for _, keyset := range mintKeysets {
 			// ignore keysets with non-hex id
 			_, err := hex.DecodeString(keyset.Id)
 			if err != nil {
 				continue
 			}
+			unit, err := w.parseUnit(keyset.Unit)
+			if err != nil {
+				continue
+			}
 
 			if len(keyset.PublicKeys) == 0 {
 				publicKeys, err := GetKeysetKeys(keyset.MintURL, keyset.Id)
 				if err != nil {
-					return nil, err
+					return nil, nil, err
 				}
 				keyset.PublicKeys = publicKeys
 				w.db.SaveKeyset(&keyset)
 			}
 
 			if keyset.Active {
-				activeKeyset = keyset
+				activeKeysets[unit] = keyset
 			} else {
+				if _, ok := inactiveKeysets[unit]; !ok {
+					inactiveKeysets[unit] = make(map[string]crypto.WalletKeyset)
+				}
 				// no need to have public keys of inactive keysets in memory
 				keyset.PublicKeys = make(map[uint64]*secp256k1.PublicKey)
-				inactiveKeysets[keyset.Id] = keyset
+				inactiveKeysets[unit][keyset.Id] = keyset
 			}
 		}
 
+		// mints without a saved trust level were added
+		// before trust levels existed so they are trusted
 		walletMints[k] = walletMint{
 			mintURL:         k,
-			activeKeyset:    activeKeyset,
-			inactiveKeysets: inactiveKeysets,
+			activeKeyset:    activeKeysets[w.unit],
+			inactiveKeysets: inactiveKeysets[w.unit],
+			trustLevel:      trustLevels[k],
+			unit:            w.unit,
+		}
+
+		// other units are only used if they have an active keyset
+		for unit, activeKeyset := range activeKeysets {
+			if unit == w.unit {
+				continue
+			}
+			if _, ok := unitMints[k]; !ok {
+				unitMints[k] = make(map[cashu.Unit]walletMint)
+			}
+			unitInactiveKeysets := inactiveKeysets[unit]
+			if unitInactiveKeysets == nil {
+				unitInactiveKeysets = make(map[string]crypto.WalletKeyset)
+			}
+			unitMints[k][unit] = walletMint{k, activeKeyset, unitInactiveKeysets, trustLevels[k], unit}
 		}
 	}
 
-	return walletMints, nil
+	return walletMints, unitMints, nil
 }
 
 // CurrentMint returns the current mint url
@@ -1892,7 +3020,7 @@ func (w *Wallet) ReclaimUnspentProofs() (uint64, error) {
 			if err != nil {
 				return 0, fmt.Errorf("could not create swap request: %v", err)
 			}
-			newProofs, err := swap(mintURL, req)
+			newProofs, err := w.swap(mintURL, req)
 			if err != nil {
 				return 0, fmt.Errorf("could not swap proofs: %v", err)
 			}
@@ -1908,6 +3036,8 @@ func (w *Wallet) ReclaimUnspentProofs() (uint64, error) {
 			}
 
 			amountReclaimed = newProofs.Amount()
+			w.recordTransaction(storage.ReclaimTransaction, mintURL, proofsToReclaim.Amount(),
+				proofsToReclaim.Amount()-newProofs.Amount(), "")
 		}
 	}
 
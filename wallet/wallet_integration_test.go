@@ -25,6 +25,8 @@ import (
 	"github.com/elnosh/gonuts/mint/lightning"
 	"github.com/elnosh/gonuts/testutils"
 	"github.com/elnosh/gonuts/wallet"
+	"github.com/elnosh/gonuts/wallet/storage"
+	"github.com/elnosh/gonuts/wallet/storage/storagetest"
 	"github.com/lightningnetwork/lnd/lnrpc"
 )
 
@@ -275,6 +277,43 @@ func TestReceive(t *testing.T) {
 	}
 }
 
+func TestSendReceiveString(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testsendstring")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+
+	if err := testutils.FundCashuWallet(ctx, testWallet, nil, 10000); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+
+	testWalletPath2 := filepath.Join(".", "/testreceivestring")
+	testWallet2, err := testutils.CreateTestWallet(testWalletPath2, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath2)
+
+	token, err := testWallet.SendString(2100, "")
+	if err != nil {
+		t.Fatalf("unexpected error in send: %v", err)
+	}
+	amount, err := testWallet2.ReceiveString(token)
+	if err != nil {
+		t.Fatalf("unexpected error in receive: %v", err)
+	}
+	if amount != 2100 || testWallet2.GetBalance() != 2100 {
+		t.Fatalf("expected to receive 2100 but got %v", amount)
+	}
+
+	// token can't be received twice
+	if _, err := testWallet2.ReceiveString(token); err == nil {
+		t.Fatal("expected error receiving token that was already received")
+	}
+}
+
 func TestReceiveFees(t *testing.T) {
 	testWalletPath := filepath.Join(".", "/testreceivefees")
 	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintWithFeesURL)
@@ -316,6 +355,141 @@ func TestReceiveFees(t *testing.T) {
 	}
 }
 
+func TestReceiveFeePolicy(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testreceivefeepolicy")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintWithFeesURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+	if err := testutils.FundCashuWallet(ctx, testWallet, nil, 5000); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+
+	policyWalletPath := filepath.Join(".", "/testreceivefeepolicy2")
+	if err := os.MkdirAll(policyWalletPath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(policyWalletPath)
+	policyWallet, err := wallet.LoadWallet(wallet.Config{
+		WalletPath:       policyWalletPath,
+		CurrentMintURL:   mintURL1,
+		ReceiveFeePolicy: wallet.ReceiveFeePolicy{MaxFeePercent: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fees of at least 1 sat for a token of a few sats
+	proofsToSend, err := testWallet.Send(2, mintWithFeesURL, true)
+	if err != nil {
+		t.Fatalf("got unexpected error in send: %v", err)
+	}
+	token, _ := cashu.NewTokenV4(proofsToSend, mintWithFeesURL, cashu.Sat, false)
+
+	_, err = policyWallet.Receive(token, false)
+	var feeErr *wallet.ReceiveFeeError
+	if !errors.As(err, &feeErr) {
+		t.Fatalf("expected receive fee error but got '%v'", err)
+	}
+	if feeErr.Amount != proofsToSend.Amount() || feeErr.Fees == 0 {
+		t.Fatalf("unexpected fees in error '%+v'", feeErr)
+	}
+	if slices.Contains(policyWallet.TrustedMints(), mintWithFeesURL) {
+		t.Fatal("expected mint to not be added if token is rejected")
+	}
+
+	amountReceived, err := policyWallet.ReceiveIgnoringFeePolicy(token, false)
+	if err != nil {
+		t.Fatalf("got unexpected error in receive: %v", err)
+	}
+	if amountReceived != feeErr.Amount-feeErr.Fees {
+		t.Fatalf("expected received amount of %v but got %v", feeErr.Amount-feeErr.Fees, amountReceived)
+	}
+}
+
+func TestRefreshProofs(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testrefreshwallet")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+
+	if err := testutils.FundCashuWallet(ctx, testWallet, nil, 1000); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+	secrets := func() []string {
+		proofs, _ := testWallet.ListProofs(wallet.ProofFilter{})
+		secrets := make([]string, len(proofs))
+		for i, proof := range proofs {
+			secrets[i] = proof.Secret
+		}
+		return secrets
+	}
+
+	secretsBefore := secrets()
+	refreshed, err := testWallet.RefreshProofs(mintURL1)
+	if err != nil {
+		t.Fatalf("unexpected error refreshing proofs: %v", err)
+	}
+	if refreshed != 1000 || testWallet.GetBalance() != 1000 {
+		t.Fatalf("expected 1000 refreshed and in balance but got %v and %v", refreshed, testWallet.GetBalance())
+	}
+	for _, secret := range secrets() {
+		if slices.Contains(secretsBefore, secret) {
+			t.Fatal("expected all proofs to be new after refresh")
+		}
+	}
+
+	// proofs received are swapped again
+	feesWalletPath := filepath.Join(".", "/testrefreshfeeswallet")
+	feesWallet, err := testutils.CreateTestWallet(feesWalletPath, mintWithFeesURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(feesWalletPath)
+	if err := testutils.FundCashuWallet(ctx, feesWallet, nil, 5000); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+
+	refreshWalletPath := filepath.Join(".", "/testrefreshreceivewallet")
+	if err := os.MkdirAll(refreshWalletPath, 0750); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(refreshWalletPath)
+	refreshWallet, err := wallet.LoadWallet(wallet.Config{
+		WalletPath:          refreshWalletPath,
+		CurrentMintURL:      mintWithFeesURL,
+		RefreshAfterReceive: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proofsToSend, err := feesWallet.Send(2000, mintWithFeesURL, true)
+	if err != nil {
+		t.Fatalf("got unexpected error in send: %v", err)
+	}
+	token, _ := cashu.NewTokenV4(proofsToSend, mintWithFeesURL, cashu.Sat, false)
+	amountReceived, err := refreshWallet.Receive(token, false)
+	if err != nil {
+		t.Fatalf("got unexpected error in receive: %v", err)
+	}
+
+	receiveFees, err := testutils.Fees(proofsToSend, mintWithFeesURL)
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	// fees for the receive and the refresh were paid
+	if amountReceived >= proofsToSend.Amount()-uint64(receiveFees) {
+		t.Fatalf("expected fees for refresh to be paid but received %v", amountReceived)
+	}
+	if refreshWallet.GetBalance() != amountReceived {
+		t.Fatalf("expected balance of %v but got %v", amountReceived, refreshWallet.GetBalance())
+	}
+}
+
 func TestMelt(t *testing.T) {
 	testWalletPath := filepath.Join(".", "/testmeltwallet")
 	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
@@ -384,6 +558,257 @@ func TestMelt(t *testing.T) {
 	}
 }
 
+func TestTransactionResults(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testresultswallet")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintWithFeesURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+
+	var fundAmount uint64 = 10000
+	if err := testutils.FundCashuWallet(ctx, testWallet, nil, fundAmount); err != nil {
+		t.Fatalf("error funding wallet: %v", err)
+	}
+
+	sendResult, err := testWallet.SendWithResult(2000, testWallet.CurrentMint(), true)
+	if err != nil {
+		t.Fatalf("got unexpected error in send: %v", err)
+	}
+	receiverFees, err := testutils.Fees(sendResult.Proofs, testWallet.CurrentMint())
+	if err != nil {
+		t.Fatalf("got unexpected error: %v", err)
+	}
+	if sendResult.Amount != sendResult.Proofs.Amount() {
+		t.Fatalf("expected send amount of '%v' but got '%v'", sendResult.Proofs.Amount(), sendResult.Amount)
+	}
+	if sendResult.ReceiverFees != uint64(receiverFees) {
+		t.Fatalf("expected receiver fees of '%v' but got '%v'", receiverFees, sendResult.ReceiverFees)
+	}
+	expectedBalance := fundAmount - sendResult.Amount - sendResult.Fees
+	if testWallet.GetBalance() != expectedBalance {
+		t.Fatalf("expected balance of '%v' but got '%v'", expectedBalance, testWallet.GetBalance())
+	}
+	if len(sendResult.Keysets) == 0 {
+		t.Fatal("expected keysets of the proofs sent")
+	}
+
+	testWalletPath2 := filepath.Join(".", "/testresultswallet2")
+	testWallet2, err := testutils.CreateTestWallet(testWalletPath2, mintWithFeesURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath2)
+
+	token, _ := cashu.NewTokenV4(sendResult.Proofs, testWallet.CurrentMint(), cashu.Sat, false)
+	receiveResult, err := testWallet2.ReceiveWithResult(token, false)
+	if err != nil {
+		t.Fatalf("got unexpected error in receive: %v", err)
+	}
+	if receiveResult.Amount != sendResult.Amount {
+		t.Fatalf("expected token amount of '%v' but got '%v'", sendResult.Amount, receiveResult.Amount)
+	}
+	if receiveResult.Fees != sendResult.ReceiverFees {
+		t.Fatalf("expected receive fees of '%v' but got '%v'", sendResult.ReceiverFees, receiveResult.Fees)
+	}
+	if receiveResult.Received != testWallet2.GetBalance() {
+		t.Fatalf("expected received amount of '%v' but got '%v'", testWallet2.GetBalance(), receiveResult.Received)
+	}
+	if receiveResult.ProofsCount == 0 || len(receiveResult.KeysetId) == 0 || len(receiveResult.Receipts) != 1 {
+		t.Fatalf("unexpected receive result: %+v", receiveResult)
+	}
+
+	balance := testWallet.GetBalance()
+	bolt11, _, _, _ := lightning.CreateFakeInvoice(3000, false)
+	meltQuote, err := testWallet.RequestMeltQuote(bolt11, testWallet.CurrentMint())
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+	meltResult, err := testWallet.MeltWithResult(meltQuote.Quote)
+	if err != nil {
+		t.Fatalf("got unexpected melt error: %v", err)
+	}
+	if meltResult.Response.State != nut05.Paid {
+		t.Fatalf("expected paid melt")
+	}
+	if meltResult.Amount != meltQuote.Amount {
+		t.Fatalf("expected melt amount of '%v' but got '%v'", meltQuote.Amount, meltResult.Amount)
+	}
+	if meltResult.Fees != meltResult.InputFees+meltResult.LightningFees {
+		t.Fatalf("expected fees of '%v' but got '%v'", meltResult.InputFees+meltResult.LightningFees, meltResult.Fees)
+	}
+	if meltResult.LightningFees+meltResult.Change > meltQuote.FeeReserve {
+		t.Fatalf("lightning fees '%v' and change '%v' over the fee reserve of '%v'",
+			meltResult.LightningFees, meltResult.Change, meltQuote.FeeReserve)
+	}
+	expectedBalance = balance - meltResult.Amount - meltResult.Fees
+	if testWallet.GetBalance() != expectedBalance {
+		t.Fatalf("expected balance of '%v' but got '%v'", expectedBalance, testWallet.GetBalance())
+	}
+}
+
+func TestBOLT12Mint(t *testing.T) {
+	port, _ := testutils.GetAvailablePort()
+	mintURL := "http://127.0.0.1:" + strconv.Itoa(port)
+
+	testMintPath := filepath.Join(".", "testmintbolt12")
+	fakeBackend := &lightning.FakeBackend{}
+	config, err := testutils.MintConfig(fakeBackend, port, 0, testMintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.EnableBOLT12 = true
+	testMint, err := mint.SetupMintServer(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testMintPath)
+	go func() {
+		if err := testMint.Start(); err != nil {
+			log.Printf("error running mint server: %v", err)
+		}
+	}()
+	defer testMint.Shutdown()
+	time.Sleep(500 * time.Millisecond)
+
+	testWalletPath := filepath.Join(".", "/testwalletbolt12")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+
+	mintQuote, err := testWallet.RequestMintBolt12(0, mintURL)
+	if err != nil {
+		t.Fatalf("unexpected error requesting bolt12 mint quote: %v", err)
+	}
+	if _, err := testWallet.MintBolt12Tokens(mintQuote.Quote); !errors.Is(err, wallet.ErrNothingToMint) {
+		t.Fatalf("expected error '%v' but got '%v'", wallet.ErrNothingToMint, err)
+	}
+	if _, err := testWallet.MintTokens(mintQuote.Quote); err == nil {
+		t.Fatal("expected error minting bolt12 quote as bolt11")
+	}
+
+	offerId := fakeBackend.Offers[0].OfferId
+	fakeBackend.PayOffer(offerId, 2100)
+	minted, err := testWallet.MintBolt12Tokens(mintQuote.Quote)
+	if err != nil {
+		t.Fatalf("unexpected error minting: %v", err)
+	}
+	if minted != 2100 {
+		t.Fatalf("expected to mint 2100 but got %v", minted)
+	}
+
+	fakeBackend.PayOffer(offerId, 500)
+	minted, err = testWallet.MintBolt12Tokens(mintQuote.Quote)
+	if err != nil {
+		t.Fatalf("unexpected error minting: %v", err)
+	}
+	if minted != 500 {
+		t.Fatalf("expected to mint 500 but got %v", minted)
+	}
+	if balance := testWallet.GetBalance(); balance != 2600 {
+		t.Fatalf("expected balance of 2600 but got %v", balance)
+	}
+
+	state, err := testWallet.MintQuoteBolt12State(mintQuote.Quote)
+	if err != nil {
+		t.Fatalf("unexpected error getting quote state: %v", err)
+	}
+	if state.AmountPaid != 2600 || state.Mintable() != 0 {
+		t.Fatalf("expected 2600 paid and nothing to mint but got %v and %v", state.AmountPaid, state.Mintable())
+	}
+}
+
+func TestBOLT12Melt(t *testing.T) {
+	port, _ := testutils.GetAvailablePort()
+	mintURL := "http://127.0.0.1:" + strconv.Itoa(port)
+
+	testMintPath := filepath.Join(".", "testmintbolt12melt")
+	fakeBackend := &lightning.FakeBackend{}
+	config, err := testutils.MintConfig(fakeBackend, port, 0, testMintPath, 0, mint.MintLimits{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.EnableBOLT12 = true
+	testMint, err := mint.SetupMintServer(*config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testMintPath)
+	go func() {
+		if err := testMint.Start(); err != nil {
+			log.Printf("error running mint server: %v", err)
+		}
+	}()
+	defer testMint.Shutdown()
+	time.Sleep(500 * time.Millisecond)
+
+	testWalletPath := filepath.Join(".", "/testwalletbolt12melt")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+
+	mintQuote, err := testWallet.RequestMintBolt12(0, mintURL)
+	if err != nil {
+		t.Fatalf("unexpected error requesting bolt12 mint quote: %v", err)
+	}
+	fakeBackend.PayOffer(fakeBackend.Offers[0].OfferId, 2000)
+	if _, err := testWallet.MintBolt12Tokens(mintQuote.Quote); err != nil {
+		t.Fatalf("unexpected error minting: %v", err)
+	}
+
+	offer, _ := fakeBackend.CreateOffer(300, "offer with amount")
+	meltQuote, err := testWallet.RequestMeltQuote(offer.Request, mintURL)
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote for offer: %v", err)
+	}
+	if meltQuote.Amount != 300 {
+		t.Fatalf("expected melt quote amount of 300 but got %v", meltQuote.Amount)
+	}
+	meltResponse, err := testWallet.Melt(meltQuote.Quote)
+	if err != nil {
+		t.Fatalf("unexpected error melting: %v", err)
+	}
+	if meltResponse.State != nut05.Paid {
+		t.Fatalf("expected paid melt quote but got '%s'", meltResponse.State)
+	}
+	if balance := testWallet.GetBalance(); balance != 1700 {
+		t.Fatalf("expected balance of 1700 but got %v", balance)
+	}
+	quotes := testWallet.GetMeltQuotes()
+	idx := slices.IndexFunc(quotes, func(quote storage.MeltQuote) bool { return quote.QuoteId == meltQuote.Quote })
+	if idx == -1 || quotes[idx].Method != cashu.BOLT12_METHOD || quotes[idx].PaymentRequest != offer.Request {
+		t.Fatal("expected bolt12 melt quote for offer saved in wallet")
+	}
+	quoteState, err := testWallet.CheckMeltQuoteState(meltQuote.Quote)
+	if err != nil {
+		t.Fatalf("unexpected error checking melt quote state: %v", err)
+	}
+	if quoteState.State != nut05.Paid {
+		t.Fatalf("expected paid melt quote but got '%s'", quoteState.State)
+	}
+
+	// offer for any amount from another node needs the amount
+	otherNode := &lightning.FakeBackend{}
+	anyAmountOffer, _ := otherNode.CreateOffer(0, "any amount")
+	if _, err := testWallet.RequestMeltQuote(anyAmountOffer.Request, mintURL); err == nil {
+		t.Fatal("expected error requesting melt quote for offer without amount")
+	}
+	meltQuote, err = testWallet.RequestMeltQuoteBolt12(anyAmountOffer.Request, 200, mintURL)
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote for offer: %v", err)
+	}
+	if _, err := testWallet.Melt(meltQuote.Quote); err != nil {
+		t.Fatalf("unexpected error melting: %v", err)
+	}
+	if balance := testWallet.GetBalance(); balance != 1500 {
+		t.Fatalf("expected balance of 1500 but got %v", balance)
+	}
+}
+
 func TestMintSwap(t *testing.T) {
 	testWalletPath := filepath.Join(".", "/testmintswapwallet")
 	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
@@ -929,6 +1354,70 @@ func testWalletRestore(
 	}
 }
 
+func TestWalletRestoreResume(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testrestoreresume")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+
+	var mintAmount uint64 = 2100
+	mintRequest, err := testWallet.RequestMint(mintAmount, mintURL1)
+	if err != nil {
+		t.Fatalf("unexpected error in mint request: %v", err)
+	}
+	if _, err := testWallet.MintTokens(mintRequest.Quote); err != nil {
+		t.Fatalf("unexpected error in mint tokens: %v", err)
+	}
+
+	// interrupt the restore by failing to save its progress after the first batch
+	db := storagetest.NewMockDB(nil)
+	errInterrupted := errors.New("interrupted")
+	config := wallet.RestoreConfig{
+		Mints:     []string{mintURL1},
+		BatchSize: 2,
+		GapLimit:  2,
+		OnProgress: func(progress storage.RestoreProgress) {
+			db.SetError("SaveRestoreProgress", errInterrupted)
+		},
+	}
+	if _, err := wallet.RestoreToDBWithConfig(db, testWallet.Mnemonic(), config); !errors.Is(err, errInterrupted) {
+		t.Fatalf("expected interrupted restore but got %v", err)
+	}
+
+	// resume it without the mints, which are taken from the progress saved
+	db.SetError("SaveRestoreProgress", nil)
+	var progressCalls int
+	config = wallet.RestoreConfig{
+		BatchSize:  2,
+		GapLimit:   2,
+		OnProgress: func(progress storage.RestoreProgress) { progressCalls++ },
+	}
+	amountRestored, err := wallet.RestoreToDBWithConfig(db, testWallet.Mnemonic(), config)
+	if err != nil {
+		t.Fatalf("error resuming restore: %v", err)
+	}
+	if amountRestored != mintAmount {
+		t.Fatalf("restored amount '%v' does not match expected amount '%v'", amountRestored, mintAmount)
+	}
+	if progressCalls == 0 {
+		t.Fatal("expected progress of resumed restore")
+	}
+	for _, progress := range db.GetRestoreProgress() {
+		if !progress.Done {
+			t.Fatalf("expected restore of keyset '%v' to be done", progress.KeysetId)
+		}
+		if counter := db.GetKeysetCounter(progress.KeysetId); counter != progress.NextCounter {
+			t.Fatalf("expected counter of keyset '%v' to be %v but got %v", progress.KeysetId, progress.NextCounter, counter)
+		}
+	}
+
+	if _, err := wallet.RestoreToDBWithConfig(db, testWallet.Mnemonic(), config); err == nil {
+		t.Fatal("expected error restoring to db of wallet that was restored")
+	}
+}
+
 func TestHTLC(t *testing.T) {
 	htlcMintURL := mintURL1
 
@@ -1097,6 +1586,229 @@ func testP2PK(
 	}
 }
 
+func TestReissueLockedSend(t *testing.T) {
+	senderPath := filepath.Join(".", "/testwalletreissue")
+	sender, err := testutils.CreateTestWallet(senderPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(senderPath)
+
+	receiverPath := filepath.Join(".", "/testwalletreissue2")
+	receiver, err := testutils.CreateTestWallet(receiverPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(receiverPath)
+
+	mintRequest, err := sender.RequestMint(1000, mintURL1)
+	if err != nil {
+		t.Fatalf("unexpected error in mint request: %v", err)
+	}
+	if _, err := sender.MintTokens(mintRequest.Quote); err != nil {
+		t.Fatalf("unexpected error in mint tokens: %v", err)
+	}
+
+	tags := nut11.P2PKTags{
+		Locktime: time.Now().Add(time.Second * 2).Unix(),
+		Refund:   []*btcec.PublicKey{sender.GetReceivePubkey()},
+	}
+	if _, err := sender.SendToPubkey(100, mintURL1, receiver.GetReceivePubkey(), &tags, false); err != nil {
+		t.Fatalf("unexpected error generating locked ecash: %v", err)
+	}
+	lockedTokens, err := sender.ExportLockedTokens()
+	if err != nil {
+		t.Fatalf("unexpected error exporting locked tokens: %v", err)
+	}
+	if len(lockedTokens) != 1 {
+		t.Fatalf("expected 1 locked token but got %v", len(lockedTokens))
+	}
+	lockedSendId := lockedTokens[0].Id
+
+	// locktime has not expired yet
+	if _, err := sender.ReissueLockedSend(lockedSendId, nil, nil, false); err == nil {
+		t.Fatal("expected error reissuing locked send before locktime")
+	}
+
+	time.Sleep(time.Second * 3)
+	reissued, err := sender.ReissueLockedSend(lockedSendId, nil, nil, false)
+	if err != nil {
+		t.Fatalf("unexpected error reissuing locked send: %v", err)
+	}
+	if reissued.Amount != 100 {
+		t.Fatalf("expected reissued amount of 100 but got %v", reissued.Amount)
+	}
+	if reissued.Locktime <= time.Now().Unix() {
+		t.Fatalf("expected new locktime in the future but got %v", reissued.Locktime)
+	}
+
+	lockedTokens, err = sender.ExportLockedTokens()
+	if err != nil {
+		t.Fatalf("unexpected error exporting locked tokens: %v", err)
+	}
+	if len(lockedTokens) != 1 || lockedTokens[0].Id != reissued.Id {
+		t.Fatalf("expected only the reissued locked token but got '%+v'", lockedTokens)
+	}
+
+	token, err := cashu.DecodeToken(reissued.Token)
+	if err != nil {
+		t.Fatalf("could not decode reissued token: %v", err)
+	}
+	amountReceived, err := receiver.Receive(token, false)
+	if err != nil {
+		t.Fatalf("unexpected error receiving reissued token: %v", err)
+	}
+	if amountReceived != 100 {
+		t.Fatalf("expected to receive 100 but got %v", amountReceived)
+	}
+}
+
+func TestBurn(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testwalletburn")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+
+	mintRequest, err := testWallet.RequestMint(1000, mintURL1)
+	if err != nil {
+		t.Fatalf("unexpected error in mint request: %v", err)
+	}
+	if _, err := testWallet.MintTokens(mintRequest.Quote); err != nil {
+		t.Fatalf("unexpected error in mint tokens: %v", err)
+	}
+
+	receipt, err := testWallet.Burn(300, mintURL1)
+	if err != nil {
+		t.Fatalf("unexpected error burning proofs: %v", err)
+	}
+	if receipt.Amount != 300 {
+		t.Fatalf("expected burned amount of 300 but got %v", receipt.Amount)
+	}
+	if balance := testWallet.GetBalance(); balance != 700 {
+		t.Fatalf("expected balance of 700 but got %v", balance)
+	}
+	if err := wallet.VerifyBurnReceipt(*receipt); err != nil {
+		t.Fatalf("unexpected error verifying burn receipt: %v", err)
+	}
+
+	// burned proofs cannot be received
+	token, _ := cashu.NewTokenV4(receipt.Proofs, mintURL1, cashu.Sat, false)
+	if _, err := testWallet.Receive(token, false); err == nil {
+		t.Fatal("expected error receiving burned proofs")
+	}
+}
+
+func TestBulkSend(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testwalletbulksend")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+
+	mintRequest, err := testWallet.RequestMint(10000, mintURL1)
+	if err != nil {
+		t.Fatalf("unexpected error in mint request: %v", err)
+	}
+	if _, err := testWallet.MintTokens(mintRequest.Quote); err != nil {
+		t.Fatalf("unexpected error in mint tokens: %v", err)
+	}
+
+	// 21 needs 3 outputs so at most 5 tokens fit in a swap of 16 outputs
+	tokens, err := testWallet.BulkSend(12, 21, mintURL1, wallet.BulkSendOptions{MaxOutputsPerSwap: 16})
+	if err != nil {
+		t.Fatalf("unexpected error in bulk send: %v", err)
+	}
+	if len(tokens) != 12 {
+		t.Fatalf("expected 12 tokens but got %v", len(tokens))
+	}
+	for _, token := range tokens {
+		if token.Amount() != 21 {
+			t.Fatalf("expected token of 21 but got %v", token.Amount())
+		}
+	}
+	if balance := testWallet.GetBalance(); balance != 10000-12*21 {
+		t.Fatalf("expected balance of %v but got %v", 10000-12*21, balance)
+	}
+
+	receiverPath := filepath.Join(".", "/testwalletbulksend2")
+	receiver, err := testutils.CreateTestWallet(receiverPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(receiverPath)
+	for _, proofs := range tokens {
+		token, _ := cashu.NewTokenV4(proofs, mintURL1, cashu.Sat, false)
+		if _, err := receiver.Receive(token, false); err != nil {
+			t.Fatalf("unexpected error receiving token: %v", err)
+		}
+	}
+	if balance := receiver.GetBalance(); balance != 12*21 {
+		t.Fatalf("expected balance of %v but got %v", 12*21, balance)
+	}
+}
+
+func TestReceiveBatch(t *testing.T) {
+	testWalletPath := filepath.Join(".", "/testwalletreceivebatch")
+	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(testWalletPath)
+
+	mintRequest, err := testWallet.RequestMint(10000, mintURL1)
+	if err != nil {
+		t.Fatalf("unexpected error in mint request: %v", err)
+	}
+	if _, err := testWallet.MintTokens(mintRequest.Quote); err != nil {
+		t.Fatalf("unexpected error in mint tokens: %v", err)
+	}
+
+	tokens, err := testWallet.BulkSend(6, 21, mintURL1, wallet.BulkSendOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error in bulk send: %v", err)
+	}
+	serializedTokens := make([]string, len(tokens))
+	for i, proofs := range tokens {
+		token, _ := cashu.NewTokenV4(proofs, mintURL1, cashu.Sat, false)
+		serializedTokens[i], _ = token.Serialize()
+	}
+
+	receiverPath := filepath.Join(".", "/testwalletreceivebatch2")
+	receiver, err := testutils.CreateTestWallet(receiverPath, mintURL1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(receiverPath)
+
+	// first token was already received
+	if _, err := receiver.ReceiveString(serializedTokens[0]); err != nil {
+		t.Fatalf("unexpected error receiving token: %v", err)
+	}
+	serializedTokens = append(serializedTokens, "cashuBinvalid")
+
+	receipts := receiver.ReceiveBatch(serializedTokens, wallet.BatchReceiveOptions{Concurrency: 3})
+	if len(receipts) != len(serializedTokens) {
+		t.Fatalf("expected %v receipts but got %v", len(serializedTokens), len(receipts))
+	}
+	if receipts[0].Status != wallet.BatchReceiveAlreadySpent {
+		t.Fatalf("expected first token to be already spent but got '%v'", receipts[0].Status)
+	}
+	for _, receipt := range receipts[1:6] {
+		if receipt.Status != wallet.BatchReceiveAccepted || receipt.Received != 21 {
+			t.Fatalf("expected token %v to be accepted but got '%v': %v", receipt.Index, receipt.Status, receipt.Err)
+		}
+	}
+	if receipts[6].Status != wallet.BatchReceiveFailed || receipts[6].Err == nil {
+		t.Fatalf("expected invalid token to fail but got '%v'", receipts[6].Status)
+	}
+	if balance := receiver.GetBalance(); balance != 6*21 {
+		t.Fatalf("expected balance of %v but got %v", 6*21, balance)
+	}
+}
+
 func TestDLEQProofs(t *testing.T) {
 	testWalletPath := filepath.Join(".", "/testdleqwallet")
 	testWallet, err := testutils.CreateTestWallet(testWalletPath, mintURL1)
@@ -3,19 +3,34 @@
 package wallet
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut01"
+	"github.com/elnosh/gonuts/cashu/nuts/nut02"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut06"
 	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/mint/lightning"
+	"github.com/elnosh/gonuts/wallet/storage"
+	decodepay "github.com/nbd-wtf/ln-decodepay"
 )
 
 func TestCreateBlindedMessages(t *testing.T) {
@@ -182,6 +197,297 @@ func TestConstructProofsError(t *testing.T) {
 	}
 }
 
+func TestRequestMintWithDescription(t *testing.T) {
+	var descriptionOption bool
+	var description string
+	var quotes int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if quoteId, ok := strings.CutPrefix(r.URL.Path, "/v1/mint/quote/bolt11/"); ok {
+			json.NewEncoder(w).Encode(&nut04.PostMintQuoteBolt11Response{Quote: quoteId, State: nut04.Unpaid})
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/info":
+			method := nut06.MethodSetting{Method: cashu.BOLT11_METHOD, Unit: cashu.Sat.String()}
+			if descriptionOption {
+				method.Options = &nut06.MethodOptions{Description: true}
+			}
+			json.NewEncoder(w).Encode(nut06.MintInfo{Nuts: nut06.NutsMap{
+				4: nut06.NutSetting{Methods: []nut06.MethodSetting{method}},
+			}})
+		case "/v1/mint/quote/bolt11":
+			var req nut04.PostMintQuoteBolt11Request
+			json.NewDecoder(r.Body).Decode(&req)
+			description = req.Description
+			quotes++
+			invoice, _, _, _ := lightning.CreateFakeInvoice(req.Amount, false)
+			json.NewEncoder(w).Encode(&nut04.PostMintQuoteBolt11Response{
+				Quote:   "quote" + strconv.Itoa(quotes),
+				Request: invoice,
+				State:   nut04.Unpaid,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	w := &Wallet{db: storage.NewMemoryDB(), unit: cashu.Sat, mints: map[string]walletMint{
+		server.URL: {mintURL: server.URL, unit: cashu.Sat},
+	}}
+
+	if _, err := w.RequestMintWithDescription(100, server.URL, "coffee"); !errors.Is(err, ErrDescriptionNotSupported) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrDescriptionNotSupported, err)
+	}
+
+	descriptionOption = true
+	if _, err := w.RequestMintWithDescription(100, server.URL, "coffee"); err != nil {
+		t.Fatalf("unexpected error requesting mint quote: %v", err)
+	}
+	if description != "coffee" {
+		t.Fatalf("expected description 'coffee' in request but got '%v'", description)
+	}
+	if quote := w.db.GetMintQuoteById("quote1"); quote == nil || quote.Description != "coffee" {
+		t.Fatalf("expected quote saved with description but got %+v", quote)
+	}
+
+	// the description is kept when the quote is renewed
+	description = ""
+	renewed, err := w.renewMintQuote("quote1")
+	if err != nil {
+		t.Fatalf("unexpected error renewing quote: %v", err)
+	}
+	if description != "coffee" || renewed.Description != "coffee" {
+		t.Fatalf("expected renewed quote with description but got '%v'", renewed.Description)
+	}
+}
+
+func TestMintSwapQuotes(t *testing.T) {
+	toMint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req nut04.PostMintQuoteBolt11Request
+		json.NewDecoder(r.Body).Decode(&req)
+		invoice, _, _, _ := lightning.CreateFakeInvoice(req.Amount, false)
+		json.NewEncoder(w).Encode(&nut04.PostMintQuoteBolt11Response{
+			Quote:   "mintquote",
+			Request: invoice,
+			State:   nut04.Unpaid,
+		})
+	}))
+	defer toMint.Close()
+
+	var feePercent float64
+	fromMint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req nut05.PostMeltQuoteBolt11Request
+		json.NewDecoder(r.Body).Decode(&req)
+		bolt11, _ := decodepay.Decodepay(req.Request)
+		amount := uint64(bolt11.MSatoshi / 1000)
+		json.NewEncoder(w).Encode(&nut05.PostMeltQuoteBolt11Response{
+			Quote:      "meltquote",
+			Amount:     amount,
+			FeeReserve: uint64(math.Ceil(float64(amount) * feePercent)),
+			State:      nut05.Unpaid,
+		})
+	}))
+	defer fromMint.Close()
+
+	db := storage.NewMemoryDB()
+
+	from := walletMint{mintURL: fromMint.URL, activeKeyset: crypto.WalletKeyset{Id: "from", InputFeePpk: 100}}
+	to := walletMint{mintURL: toMint.URL}
+	w := &Wallet{db: db, unit: cashu.Sat, mints: map[string]walletMint{
+		fromMint.URL: from,
+		toMint.URL:   to,
+	}}
+
+	proofs := cashu.Proofs{{Amount: 1024, Id: "from"}, {Amount: 512, Id: "from"}}
+	// 2 proofs with 100 ppk is 1 in input fees
+
+	// quotes settled internally have no fee reserve so only input fees are lost
+	quotes, err := w.mintSwapQuotes(proofs, &from, &to)
+	if err != nil {
+		t.Fatalf("unexpected error getting quotes: %v", err)
+	}
+	if quotes.meltQuote.Amount != 1535 || quotes.meltQuote.FeeReserve != 0 {
+		t.Fatalf("expected quote for 1535 with no fee reserve but got %+v", quotes.meltQuote)
+	}
+
+	feePercent = 0.01
+	quotes, err = w.mintSwapQuotes(proofs, &from, &to)
+	if err != nil {
+		t.Fatalf("unexpected error getting quotes: %v", err)
+	}
+	amountNeeded := quotes.meltQuote.Amount + quotes.meltQuote.FeeReserve + 1
+	if amountNeeded > proofs.Amount() {
+		t.Fatalf("quote needs %v but proofs only have %v", amountNeeded, proofs.Amount())
+	}
+	// should not lose more than the fee reserve
+	if quotes.meltQuote.Amount < 1535-16 {
+		t.Fatalf("expected quote amount to only be lowered by fee reserve but got %v", quotes.meltQuote.Amount)
+	}
+
+	w.maxSwapLoss = 10
+	if _, err := w.mintSwapQuotes(proofs, &from, &to); !errors.Is(err, ErrSwapLossTooHigh) {
+		t.Fatalf("expected error '%v' but got '%v'", ErrSwapLossTooHigh, err)
+	}
+}
+
+func TestMeltForSwap(t *testing.T) {
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	keyset, err := crypto.GenerateKeyset(master, 0, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+
+	var meltRequest nut05.PostMeltBolt11Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		meltRequest = nut05.PostMeltBolt11Request{}
+		json.NewDecoder(r.Body).Decode(&meltRequest)
+		// return change for 12 in the first two blank outputs
+		var change cashu.BlindedSignatures
+		for i, amount := range []uint64{4, 8} {
+			if i >= len(meltRequest.Outputs) {
+				break
+			}
+			B_bytes, _ := hex.DecodeString(meltRequest.Outputs[i].B_)
+			B_, _ := secp256k1.ParsePubKey(B_bytes)
+			C_ := crypto.SignBlindedMessage(B_, keyset.Keys[amount].PrivateKey)
+			change = append(change, cashu.BlindedSignature{
+				Amount: amount,
+				Id:     keyset.Id,
+				C_:     hex.EncodeToString(C_.SerializeCompressed()),
+			})
+		}
+		json.NewEncoder(w).Encode(&nut05.PostMeltQuoteBolt11Response{
+			Quote:  meltRequest.Quote,
+			State:  nut05.Paid,
+			Change: change,
+		})
+	}))
+	defer server.Close()
+
+	walletKeyset := crypto.WalletKeyset{
+		Id:         keyset.Id,
+		MintURL:    server.URL,
+		Unit:       cashu.Sat.String(),
+		Active:     true,
+		PublicKeys: make(map[uint64]*secp256k1.PublicKey),
+	}
+	for amount, key := range keyset.Keys {
+		walletKeyset.PublicKeys[amount] = key.PublicKey
+	}
+	db := storage.NewMemoryDB()
+	if err := db.SaveKeyset(&walletKeyset); err != nil {
+		t.Fatalf("error saving keyset: %v", err)
+	}
+	walletMaster, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	from := walletMint{mintURL: server.URL, activeKeyset: walletKeyset}
+	w := &Wallet{db: db, masterKey: walletMaster, unit: cashu.Sat, mints: map[string]walletMint{server.URL: from}}
+
+	proofs := cashu.Proofs{{Amount: 1024, Id: keyset.Id}}
+	meltQuote := &nut05.PostMeltQuoteBolt11Response{Quote: "meltquote", Amount: 1000, FeeReserve: 16}
+	response, change, err := w.meltForSwap(proofs, &from, meltQuote)
+	if err != nil {
+		t.Fatalf("unexpected error melting: %v", err)
+	}
+	if response.State != nut05.Paid {
+		t.Fatalf("expected paid melt but got '%v'", response.State)
+	}
+	if len(meltRequest.Outputs) != calculateBlankOutputs(meltQuote.FeeReserve) {
+		t.Fatalf("expected %v blank outputs but got %v", calculateBlankOutputs(meltQuote.FeeReserve), len(meltRequest.Outputs))
+	}
+	if change != 12 || db.GetProofs().Amount() != 12 {
+		t.Fatalf("expected change of 12 saved but got %v and %v in the db", change, db.GetProofs().Amount())
+	}
+	if counter := db.GetKeysetCounter(keyset.Id); counter != 2 {
+		t.Fatalf("expected keyset counter of 2 but got %v", counter)
+	}
+
+	// no blank outputs without fee reserve
+	meltQuote.FeeReserve = 0
+	if _, change, err = w.meltForSwap(proofs, &from, meltQuote); err != nil {
+		t.Fatalf("unexpected error melting: %v", err)
+	}
+	if len(meltRequest.Outputs) != 0 || change != 0 {
+		t.Fatalf("expected no blank outputs and no change but got %v and %v", len(meltRequest.Outputs), change)
+	}
+}
+
+func TestRequestMeltQuoteReuse(t *testing.T) {
+	var quotesCreated int
+	unknownQuotes := make(map[string]bool)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/melt/quote/bolt11", func(w http.ResponseWriter, r *http.Request) {
+		quotesCreated++
+		json.NewEncoder(w).Encode(&nut05.PostMeltQuoteBolt11Response{
+			Quote:  "quote" + strconv.Itoa(quotesCreated),
+			Amount: 100,
+			State:  nut05.Unpaid,
+			Expiry: uint64(time.Now().Add(time.Hour).Unix()),
+		})
+	})
+	mux.HandleFunc("GET /v1/melt/quote/bolt11/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if unknownQuotes[r.PathValue("id")] {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(cashu.QuoteNotExistErr)
+			return
+		}
+		json.NewEncoder(w).Encode(&nut05.PostMeltQuoteBolt11Response{
+			Quote:  r.PathValue("id"),
+			Amount: 100,
+			State:  nut05.Unpaid,
+		})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	db := storage.NewMemoryDB()
+	w := &Wallet{db: db, unit: cashu.Sat, mints: map[string]walletMint{server.URL: {mintURL: server.URL}}}
+	invoice, _, _, _ := lightning.CreateFakeInvoice(100, false)
+
+	quote, err := w.RequestMeltQuote(invoice, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+	// unexpired quote for the same invoice is reused
+	reused, err := w.RequestMeltQuote(invoice, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+	if reused.Quote != quote.Quote || quotesCreated != 1 {
+		t.Fatalf("expected quote '%v' to be reused but got '%v'", quote.Quote, reused.Quote)
+	}
+
+	otherInvoice, _, _, _ := lightning.CreateFakeInvoice(100, false)
+	if other, _ := w.RequestMeltQuote(otherInvoice, server.URL); other.Quote == quote.Quote {
+		t.Fatal("expected new quote for a different invoice")
+	}
+
+	// expired quote is not reused
+	expired := db.GetMeltQuoteById(quote.Quote)
+	expired.QuoteExpiry = uint64(time.Now().Add(-time.Minute).Unix())
+	if err := db.SaveMeltQuote(*expired); err != nil {
+		t.Fatal(err)
+	}
+	newQuote, err := w.RequestMeltQuote(invoice, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+	if newQuote.Quote == quote.Quote || quotesCreated != 3 {
+		t.Fatalf("expected new quote but got '%v'", newQuote.Quote)
+	}
+
+	// quote the mint does not know about is not reused
+	unknownQuotes[newQuote.Quote] = true
+	lastQuote, err := w.RequestMeltQuote(invoice, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error requesting melt quote: %v", err)
+	}
+	if lastQuote.Quote == newQuote.Quote || quotesCreated != 4 {
+		t.Fatalf("expected new quote but got '%v'", lastQuote.Quote)
+	}
+}
+
 func generateWalletKeyset(seed, derivationPath string) *crypto.WalletKeyset {
 	keys := make(map[uint64]*secp256k1.PublicKey, 64)
 
@@ -194,3 +500,115 @@ func generateWalletKeyset(seed, derivationPath string) *crypto.WalletKeyset {
 	keysetId := crypto.DeriveKeysetId(keys)
 	return &crypto.WalletKeyset{Id: keysetId, Unit: "sat", Active: true, PublicKeys: keys}
 }
+
+func TestNewWallet(t *testing.T) {
+	seed, _ := hdkeychain.GenerateSeed(32)
+	master, _ := hdkeychain.NewMaster(seed, &chaincfg.MainNetParams)
+	keyset, err := crypto.GenerateKeyset(master, 0, 0)
+	if err != nil {
+		t.Fatalf("error generating keyset: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/keysets":
+			json.NewEncoder(w).Encode(nut02.GetKeysetsResponse{Keysets: []nut02.Keyset{
+				{Id: keyset.Id, Unit: keyset.Unit, Active: true},
+			}})
+		case "/v1/keys/" + keyset.Id:
+			json.NewEncoder(w).Encode(nut01.GetKeysResponse{Keysets: []nut01.Keyset{
+				{Id: keyset.Id, Unit: keyset.Unit, Keys: keyset.DerivePublic()},
+			}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	if _, err := NewWallet(Options{Config: Config{CurrentMintURL: server.URL}}); err == nil {
+		t.Fatal("expected error creating wallet without db")
+	}
+
+	walletSeed, _ := hdkeychain.GenerateSeed(64)
+	db := storage.NewMemoryDB()
+	opts := Options{
+		Config: Config{CurrentMintURL: server.URL},
+		DB:     db,
+		Seed:   walletSeed,
+	}
+	w, err := NewWallet(opts)
+	if err != nil {
+		t.Fatalf("unexpected error creating wallet: %v", err)
+	}
+	if !bytes.Equal(db.GetSeed(), walletSeed) {
+		t.Fatal("expected seed passed to be saved in db")
+	}
+	if w.CurrentMint() != server.URL || w.mints[server.URL].activeKeyset.Id != keyset.Id {
+		t.Fatalf("expected wallet with mint '%v' and keyset '%v'", server.URL, keyset.Id)
+	}
+
+	// seed is kept when loading the wallet again with the same db
+	opts.Seed = nil
+	w2, err := NewWallet(opts)
+	if err != nil {
+		t.Fatalf("unexpected error creating wallet: %v", err)
+	}
+	if !w2.GetReceivePubkey().IsEqual(w.GetReceivePubkey()) {
+		t.Fatal("expected wallet with same keys from the seed in db")
+	}
+
+	otherSeed, _ := hdkeychain.GenerateSeed(64)
+	opts.Seed = otherSeed
+	if _, err := NewWallet(opts); err == nil {
+		t.Fatal("expected error for seed different than the one in db")
+	}
+
+	opts = Options{Config: Config{CurrentMintURL: server.URL}, DB: storage.NewMemoryDB(), Seed: []byte{1, 2}}
+	if _, err := NewWallet(opts); err == nil {
+		t.Fatal("expected error for invalid seed")
+	}
+	if len(opts.DB.GetSeed()) > 0 {
+		t.Fatal("expected invalid seed to not be saved")
+	}
+}
+
+func TestReceiveByMint(t *testing.T) {
+	// mints without keysets so receiving from them fails
+	mint1 := httptest.NewServer(http.NotFoundHandler())
+	defer mint1.Close()
+	mint2 := httptest.NewServer(http.NotFoundHandler())
+	defer mint2.Close()
+
+	w := &Wallet{db: storage.NewMemoryDB(), mints: make(map[string]walletMint)}
+	token := &cashu.TokenV3{
+		Token: []cashu.TokenV3Proof{
+			{Mint: mint1.URL, Proofs: cashu.Proofs{{Amount: 2, Secret: "s1"}}},
+			{Mint: mint2.URL, Proofs: cashu.Proofs{{Amount: 8, Secret: "s2"}}},
+			{Mint: mint1.URL, Proofs: cashu.Proofs{{Amount: 4, Secret: "s3"}}},
+		},
+		Unit: cashu.Sat.String(),
+	}
+
+	receipts, err := w.ReceiveByMint(token, false)
+	if err == nil {
+		t.Fatal("expected error receiving from mints")
+	}
+	if len(receipts) != 2 {
+		t.Fatalf("expected 2 receipts but got %v", len(receipts))
+	}
+	expected := []MintReceipt{{Mint: mint1.URL, Amount: 6}, {Mint: mint2.URL, Amount: 8}}
+	for i, receipt := range receipts {
+		if receipt.Mint != expected[i].Mint || receipt.Amount != expected[i].Amount ||
+			receipt.Received != 0 || receipt.Err == nil {
+			t.Errorf("unexpected receipt %+v", receipt)
+		}
+		if !strings.Contains(err.Error(), receipt.Mint) {
+			t.Errorf("expected error '%v' to include mint '%v'", err, receipt.Mint)
+		}
+	}
+
+	// tokens from a single mint are not split
+	single := token.SplitByMint()[0]
+	if tokens := tokensByMint(single); len(tokens) != 1 || tokens[0].Mint() != mint1.URL {
+		t.Fatalf("unexpected tokens %v", tokens)
+	}
+}
@@ -0,0 +1,398 @@
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+	"github.com/elnosh/gonuts/wallet/client"
+	"github.com/elnosh/gonuts/wallet/storage"
+)
+
+// DefaultWatchInterval is how often Watch checks the state
+// of quotes and proofs in mints without websockets if not set
+const DefaultWatchInterval = 10 * time.Second
+
+type EventKind int
+
+const (
+	// invoice of a mint quote was paid
+	MintQuotePaid EventKind = iota + 1
+	// payment of a pending melt quote succeeded
+	MeltQuotePaid
+	// payment of a pending melt quote failed and its proofs can be used again
+	MeltQuoteFailed
+	// proofs of a token that was sent were redeemed
+	ProofsSpent
+	// scheduled payment was made. Melts can still be pending
+	// and their result is seen as a melt quote event
+	ScheduledPaymentMade
+	// scheduled payment failed after all its attempts
+	ScheduledPaymentFailed
+	// trusted mint disabled minting or announced in its motd that it is
+	// closing. The balance in it can be moved with EvacuateMint
+	MintRetiring
+	// mint quote marked for renewal was replaced by a new quote
+	MintQuoteRenewed
+	// mint quote marked for renewal expired and could not be renewed
+	MintQuoteRenewalFailed
+)
+
+func (kind EventKind) String() string {
+	switch kind {
+	case MintQuotePaid:
+		return "mint quote paid"
+	case MeltQuotePaid:
+		return "melt quote paid"
+	case MeltQuoteFailed:
+		return "melt quote failed"
+	case ProofsSpent:
+		return "sent proofs spent"
+	case ScheduledPaymentMade:
+		return "scheduled payment made"
+	case ScheduledPaymentFailed:
+		return "scheduled payment failed"
+	case MintRetiring:
+		return "mint retiring"
+	case MintQuoteRenewed:
+		return "mint quote renewed"
+	case MintQuoteRenewalFailed:
+		return "mint quote renewal failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a change in the state of a quote or of pending proofs of
+// the wallet seen by Watch, or a scheduled payment run by RunScheduledPayments
+type Event struct {
+	Kind EventKind
+	Mint string
+	// not set for ProofsSpent events and scheduled sends
+	QuoteId string
+	Amount  uint64
+
+	// only set for scheduled payment events
+	PaymentId string
+	// token created by a scheduled send
+	Token string
+	// error of the last attempt of a scheduled payment that failed
+	Err error
+
+	// motd of a mint that is retiring
+	Motd string
+
+	// quote replaced by a renewed mint quote and
+	// the invoice of the new quote to pay
+	PreviousQuoteId string
+	PaymentRequest  string
+}
+
+// Watch follows the unpaid mint quotes, pending melt quotes and pending proofs
+// of tokens sent by the wallet and calls the handler when their state changes
+// until the context is done. Mints that support websockets (NUT-17) notify the
+// changes and the rest are checked every interval (DefaultWatchInterval if not
+// set). The info of the trusted mints is checked every hour to notify once if
+// they are retiring. Mint quotes marked for renewal are renewed when they are
+// within DefaultQuoteRenewalWindow of expiring. The handler is called from the goroutine of Watch so it
+// can use the wallet.
+func (w *Wallet) Watch(ctx context.Context, interval time.Duration, handler func(Event)) error {
+	watcher := &watcher{
+		w:             w,
+		handler:       handler,
+		wsKinds:       make(map[string][]nut17.SubscriptionKind),
+		subscribed:    make(map[string]string),
+		notifications: make(chan notification),
+		infoChecked:   make(map[string]time.Time),
+		retiring:      make(map[string]bool),
+	}
+	defer watcher.close()
+
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		watcher.check(ctx)
+		for done := false; !done; {
+			select {
+			case <-ctx.Done():
+				return nil
+			case n := <-watcher.notifications:
+				watcher.handle(n)
+			case <-ticker.C:
+				done = true
+			}
+		}
+	}
+}
+
+type watcher struct {
+	w       *Wallet
+	handler func(Event)
+
+	// kinds of subscriptions supported by each mint.
+	// Empty if the mint does not support websockets.
+	wsKinds map[string][]nut17.SubscriptionKind
+	// mint of the quote ids and Ys that have a subscription
+	subscribed    map[string]string
+	subscriptions []*client.Subscription
+	notifications chan notification
+
+	// last time the info of each trusted mint was checked
+	// and the mints that were notified as retiring
+	infoChecked map[string]time.Time
+	retiring    map[string]bool
+}
+
+type notification struct {
+	mint    string
+	kind    nut17.SubscriptionKind
+	payload json.RawMessage
+	err     error
+}
+
+// check subscribes to the changes of new quotes and proofs
+// in mints with websockets and checks the state of the rest
+func (wt *watcher) check(ctx context.Context) {
+	wt.w.RenewExpiringQuotes(DefaultQuoteRenewalWindow, wt.handler)
+
+	now := time.Now()
+	mintQuotes := make(map[string][]string)
+	for _, quote := range wt.w.db.GetMintQuotes() {
+		expired := quoteExpired(quote.QuoteExpiry, now)
+		if quote.State == nut04.Unpaid && !expired && len(quote.Mint) > 0 && quote.Method != cashu.BOLT12_METHOD {
+			mintQuotes[quote.Mint] = append(mintQuotes[quote.Mint], quote.QuoteId)
+		}
+	}
+	meltQuotes := make(map[string][]string)
+	for _, quote := range wt.w.db.GetMeltQuotes() {
+		if quote.State == nut05.Pending {
+			meltQuotes[quote.Mint] = append(meltQuotes[quote.Mint], quote.QuoteId)
+		}
+	}
+	for mint, quotes := range mintQuotes {
+		for _, quoteId := range wt.subscribe(ctx, mint, nut17.Bolt11MintQuote, quotes) {
+			wt.checkMintQuote(quoteId)
+		}
+	}
+	for mint, quotes := range meltQuotes {
+		for _, quoteId := range wt.subscribe(ctx, mint, nut17.Bolt11MeltQuote, quotes) {
+			wt.checkMeltQuote(quoteId)
+		}
+	}
+	for mint, Ys := range wt.sentProofs() {
+		if Ys := wt.subscribe(ctx, mint, nut17.ProofState, Ys); len(Ys) > 0 {
+			wt.checkProofs(mint, Ys)
+		}
+	}
+	wt.checkRetiringMints()
+}
+
+// checkRetiringMints checks the info of the trusted mints that were not
+// checked in the last hour and notifies the ones that started retiring
+func (wt *watcher) checkRetiringMints() {
+	for _, mint := range wt.w.MintsByTrustLevel(storage.Trusted) {
+		if time.Since(wt.infoChecked[mint]) < mintRetirementCheckInterval {
+			continue
+		}
+		retirement, err := wt.w.CheckMintRetirement(mint)
+		if err != nil {
+			wt.w.logDebugf("could not check if mint '%v' is retiring: %v", mint, err)
+			continue
+		}
+		wt.infoChecked[mint] = time.Now()
+
+		retiring := retirement.Retiring()
+		if retiring && !wt.retiring[mint] {
+			wt.w.logInfof("mint '%v' is retiring. Motd: '%v'", mint, retirement.Motd)
+			wt.handler(Event{Kind: MintRetiring, Mint: mint, Motd: retirement.Motd})
+		}
+		wt.retiring[mint] = retiring
+	}
+}
+
+// subscribe to the filters that do not have a subscription if the mint
+// supports it. It returns the filters that need to be checked by polling.
+func (wt *watcher) subscribe(
+	ctx context.Context,
+	mint string,
+	kind nut17.SubscriptionKind,
+	filters []string,
+) []string {
+	kinds, ok := wt.wsKinds[mint]
+	if !ok {
+		if info, err := client.GetMintInfo(mint); err == nil {
+			kinds = nut17.SupportedKinds(*info, cashu.BOLT11_METHOD, wt.w.unit.String())
+		}
+		wt.wsKinds[mint] = kinds
+	}
+	if !slices.Contains(kinds, kind) {
+		return filters
+	}
+
+	var newFilters []string
+	for _, filter := range filters {
+		if _, ok := wt.subscribed[filter]; !ok {
+			newFilters = append(newFilters, filter)
+		}
+	}
+	if len(newFilters) == 0 {
+		return nil
+	}
+	subscription, err := client.Subscribe(mint, kind, newFilters)
+	if err != nil {
+		wt.w.logErrorf("could not subscribe to %v from mint '%v': %v. Checking state instead", kind, mint, err)
+		return newFilters
+	}
+	wt.subscriptions = append(wt.subscriptions, subscription)
+	for _, filter := range newFilters {
+		wt.subscribed[filter] = mint
+	}
+
+	go func() {
+		for {
+			n, err := subscription.Read()
+			select {
+			case wt.notifications <- notification{mint: mint, kind: kind, payload: n.Params.Payload, err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (wt *watcher) handle(n notification) {
+	if n.err != nil {
+		// check the state by polling if the connection to the mint is lost
+		wt.w.logErrorf("lost websocket connection to mint '%v': %v", n.mint, n.err)
+		wt.wsKinds[n.mint] = nil
+		for filter, mint := range wt.subscribed {
+			if mint == n.mint {
+				delete(wt.subscribed, filter)
+			}
+		}
+		return
+	}
+
+	switch n.kind {
+	case nut17.Bolt11MintQuote:
+		var quote nut04.PostMintQuoteBolt11Response
+		if err := json.Unmarshal(n.payload, &quote); err == nil && quote.State != nut04.Unpaid {
+			wt.checkMintQuote(quote.Quote)
+		}
+	case nut17.Bolt11MeltQuote:
+		var quote nut05.PostMeltQuoteBolt11Response
+		if err := json.Unmarshal(n.payload, &quote); err == nil && quote.State != nut05.Pending {
+			wt.checkMeltQuote(quote.Quote)
+		}
+	case nut17.ProofState:
+		var state nut07.ProofState
+		if err := json.Unmarshal(n.payload, &state); err == nil && state.State == nut07.Spent {
+			// check all the proofs sent from the mint so that
+			// there is one event for the proofs of a token
+			wt.checkProofs(n.mint, wt.sentProofs()[n.mint])
+		}
+	}
+}
+
+func (wt *watcher) checkMintQuote(quoteId string) {
+	quote := wt.w.db.GetMintQuoteById(quoteId)
+	if quote == nil || quote.State != nut04.Unpaid {
+		return
+	}
+	response, err := wt.w.MintQuoteState(quoteId)
+	if err != nil {
+		return
+	}
+	if response.State == nut04.Paid || response.State == nut04.Issued {
+		wt.handler(Event{Kind: MintQuotePaid, Mint: quote.Mint, QuoteId: quoteId, Amount: quote.Amount})
+	}
+}
+
+func (wt *watcher) checkMeltQuote(quoteId string) {
+	quote := wt.w.db.GetMeltQuoteById(quoteId)
+	if quote == nil || quote.State != nut05.Pending {
+		return
+	}
+	response, err := wt.w.CheckMeltQuoteState(quoteId)
+	if err != nil {
+		return
+	}
+	switch response.State {
+	case nut05.Paid:
+		wt.handler(Event{Kind: MeltQuotePaid, Mint: quote.Mint, QuoteId: quoteId, Amount: quote.Amount})
+	case nut05.Unpaid:
+		wt.handler(Event{Kind: MeltQuoteFailed, Mint: quote.Mint, QuoteId: quoteId, Amount: quote.Amount})
+	}
+}
+
+// sentProofs returns the Ys of the pending proofs by mint. Proofs
+// pending for a melt are followed with the melt quote instead.
+func (wt *watcher) sentProofs() map[string][]string {
+	sent := make(map[string][]string)
+	for mint, proofs := range wt.w.pendingProofsByMint() {
+		for _, proof := range proofs {
+			if len(proof.MeltQuoteId) == 0 {
+				sent[mint] = append(sent[mint], proof.Y)
+			}
+		}
+	}
+	return sent
+}
+
+// checkProofs removes the pending proofs that are spent
+func (wt *watcher) checkProofs(mint string, Ys []string) {
+	pending := make(map[string]storage.DBProof)
+	for _, proof := range wt.w.db.GetPendingProofs() {
+		pending[proof.Y] = proof
+	}
+	var pendingYs []string
+	for _, Y := range Ys {
+		if _, ok := pending[Y]; ok {
+			pendingYs = append(pendingYs, Y)
+		}
+	}
+	if len(pendingYs) == 0 {
+		return
+	}
+
+	response, err := client.PostCheckProofState(mint, nut07.PostCheckStateRequest{Ys: pendingYs})
+	if err != nil {
+		wt.w.logErrorf("could not check state of pending proofs from mint '%v': %v", mint, err)
+		return
+	}
+	var spent []string
+	var amount uint64
+	for _, state := range response.States {
+		if state.State == nut07.Spent {
+			spent = append(spent, state.Y)
+			amount += pending[state.Y].Amount
+		}
+	}
+	if len(spent) == 0 {
+		return
+	}
+	if err := wt.w.db.DeletePendingProofs(spent); err != nil {
+		wt.w.logErrorf("could not remove spent pending proofs: %v", err)
+		return
+	}
+	wt.handler(Event{Kind: ProofsSpent, Mint: mint, Amount: amount})
+}
+
+func (wt *watcher) close() {
+	for _, subscription := range wt.subscriptions {
+		subscription.Close()
+	}
+}
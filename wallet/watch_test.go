@@ -0,0 +1,151 @@
+//go:build !integration
+
+package wallet
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/elnosh/gonuts/cashu"
+	"github.com/elnosh/gonuts/cashu/nuts/nut04"
+	"github.com/elnosh/gonuts/cashu/nuts/nut05"
+	"github.com/elnosh/gonuts/cashu/nuts/nut06"
+	"github.com/elnosh/gonuts/cashu/nuts/nut07"
+	"github.com/elnosh/gonuts/cashu/nuts/nut17"
+	"github.com/elnosh/gonuts/crypto"
+	"github.com/elnosh/gonuts/wallet/storage"
+	"github.com/gorilla/websocket"
+)
+
+func TestWatch(t *testing.T) {
+	subscribed := make(chan nut17.RequestParams, 1)
+	mux := http.NewServeMux()
+	// only mint quotes are notified over the websocket
+	mux.HandleFunc("/v1/info", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(nut06.MintInfo{Nuts: nut06.NutsMap{
+			17: nut17.Settings{Supported: []nut17.SupportedMethod{{
+				Method:   cashu.BOLT11_METHOD,
+				Unit:     cashu.Sat.String(),
+				Commands: []nut17.SubscriptionKind{nut17.Bolt11MintQuote},
+			}}},
+		}})
+	})
+	mux.HandleFunc("/v1/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var request nut17.WsRequest
+		if err := conn.ReadJSON(&request); err != nil {
+			return
+		}
+		subscribed <- request.Params
+		conn.WriteJSON(nut17.WsResponse{
+			JSONRPC: nut17.JSONRPC,
+			Result:  &nut17.Result{Status: "OK", SubId: request.Params.SubId},
+			Id:      request.Id,
+		})
+		payload, _ := json.Marshal(&nut04.PostMintQuoteBolt11Response{Quote: "mintquote", State: nut04.Paid})
+		conn.WriteJSON(nut17.WsNotification{
+			JSONRPC: nut17.JSONRPC,
+			Method:  nut17.Subscribe,
+			Params:  nut17.NotificationParams{SubId: request.Params.SubId, Payload: payload},
+		})
+		// keep the connection open until the client closes it
+		conn.ReadMessage()
+	})
+	mux.HandleFunc("/v1/mint/quote/bolt11/{id}", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&nut04.PostMintQuoteBolt11Response{Quote: r.PathValue("id"), State: nut04.Paid})
+	})
+	mux.HandleFunc("/v1/melt/quote/bolt11/{id}", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&nut05.PostMeltQuoteBolt11Response{Quote: r.PathValue("id"), State: nut05.Paid})
+	})
+	mux.HandleFunc("/v1/checkstate", func(w http.ResponseWriter, r *http.Request) {
+		var request nut07.PostCheckStateRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		states := make([]nut07.ProofState, len(request.Ys))
+		for i, Y := range request.Ys {
+			states[i] = nut07.ProofState{Y: Y, State: nut07.Spent}
+		}
+		json.NewEncoder(w).Encode(nut07.PostCheckStateResponse{States: states})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	db := storage.NewMemoryDB()
+	keyset := crypto.WalletKeyset{Id: "009a1f293253e41e", MintURL: server.URL}
+	w := &Wallet{
+		db:    db,
+		unit:  cashu.Sat,
+		mints: map[string]walletMint{server.URL: {mintURL: server.URL, activeKeyset: keyset}},
+	}
+
+	mintQuote := storage.MintQuote{QuoteId: "mintquote", Mint: server.URL, State: nut04.Unpaid, Amount: 21}
+	if err := db.SaveMintQuote(mintQuote); err != nil {
+		t.Fatal(err)
+	}
+	meltQuote := storage.MeltQuote{QuoteId: "meltquote", Mint: server.URL, State: nut05.Pending, Amount: 10}
+	if err := db.SaveMeltQuote(meltQuote); err != nil {
+		t.Fatal(err)
+	}
+	meltProofs := cashu.Proofs{{Amount: 16, Id: keyset.Id, Secret: "meltsecret", C: "02aa"}}
+	if err := db.AddPendingProofsByQuoteId(meltProofs, meltQuote.QuoteId); err != nil {
+		t.Fatal(err)
+	}
+	sentProofs := cashu.Proofs{
+		{Amount: 4, Id: keyset.Id, Secret: "sentsecret1", C: "02aa"},
+		{Amount: 1, Id: keyset.Id, Secret: "sentsecret2", C: "02aa"},
+	}
+	if err := db.AddPendingProofs(sentProofs); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan Event, 10)
+	done := make(chan error)
+	go func() {
+		done <- w.Watch(ctx, time.Hour, func(event Event) { events <- event })
+	}()
+
+	params := <-subscribed
+	if params.Kind != nut17.Bolt11MintQuote || len(params.Filters) != 1 || params.Filters[0] != mintQuote.QuoteId {
+		t.Fatalf("unexpected subscription '%+v'", params)
+	}
+
+	expected := map[EventKind]Event{
+		MintQuotePaid: {Kind: MintQuotePaid, Mint: server.URL, QuoteId: mintQuote.QuoteId, Amount: 21},
+		MeltQuotePaid: {Kind: MeltQuotePaid, Mint: server.URL, QuoteId: meltQuote.QuoteId, Amount: 10},
+		ProofsSpent:   {Kind: ProofsSpent, Mint: server.URL, Amount: 5},
+	}
+	for len(expected) > 0 {
+		select {
+		case event := <-events:
+			if event != expected[event.Kind] {
+				t.Fatalf("expected event '%+v' but got '%+v'", expected[event.Kind], event)
+			}
+			delete(expected, event.Kind)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("did not get events: %+v", expected)
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error from watch: %v", err)
+	}
+
+	if quote := db.GetMintQuoteById(mintQuote.QuoteId); quote.State != nut04.Paid {
+		t.Fatalf("expected mint quote state '%v' but got '%v'", nut04.Paid, quote.State)
+	}
+	if quote := db.GetMeltQuoteById(meltQuote.QuoteId); quote.State != nut05.Paid {
+		t.Fatalf("expected melt quote state '%v' but got '%v'", nut05.Paid, quote.State)
+	}
+	if pending := db.GetPendingProofs(); len(pending) != 0 {
+		t.Fatalf("expected no pending proofs but got %v", len(pending))
+	}
+}